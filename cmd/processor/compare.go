@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	aiprocessor "github.com/fortxun/caza-otel-ai-processor/pkg/processor"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/replay"
+)
+
+// runCompare implements the "compare" subcommand: it runs a recorded corpus
+// through two model versions and prints agreement, the error category
+// confusion matrix, the sampler keep-rate delta and the latency delta.
+// Returns the process exit code.
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	configPath := flags.String("config", "config/config.yaml", "configuration with the baseline models")
+	candidateConfigPath := flags.String("candidate-config", "", "configuration with the candidate models (defaults to --config)")
+	errorClassifier := flags.String("candidate-error-classifier", "", "candidate error classifier model path")
+	sampler := flags.String("candidate-sampler", "", "candidate importance sampler model path")
+	entityExtractor := flags.String("candidate-entity-extractor", "", "candidate entity extractor model path")
+	corpusPath := flags.String("corpus", "", "recorded corpus file (JSON lines)")
+	tolerance := flags.Float64("tolerance", 1e-6, "maximum difference for numeric outputs to be considered equal")
+	minAgreement := flags.Float64("min-agreement", 0, "fail if any model agrees on fewer records than this rate (0.0-1.0)")
+	jsonOutput := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *corpusPath == "" {
+		fmt.Fprintln(os.Stderr, "compare: --corpus is required")
+		return 2
+	}
+
+	baselineConfig, err := aiprocessor.LoadConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+		return 1
+	}
+
+	candidateConfig := baselineConfig
+	if *candidateConfigPath != "" {
+		candidateConfig, err = aiprocessor.LoadConfigFile(*candidateConfigPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+			return 1
+		}
+	}
+
+	// Apply per-model overrides on a copy of the candidate configuration
+	overridden := *candidateConfig
+	if *errorClassifier != "" {
+		overridden.Models.ErrorClassifier.Path = *errorClassifier
+	}
+	if *sampler != "" {
+		overridden.Models.ImportanceSampler.Path = *sampler
+	}
+	if *entityExtractor != "" {
+		overridden.Models.EntityExtractor.Path = *entityExtractor
+	}
+	candidateConfig = &overridden
+
+	corpus, err := replay.ReadCorpus(*corpusPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+		return 1
+	}
+
+	baselineRuntime, err := aiprocessor.NewRuntimeFromConfig(zap.NewNop(), baselineConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: failed to initialize baseline runtime: %v\n", err)
+		return 1
+	}
+	defer baselineRuntime.Close()
+
+	candidateRuntime, err := aiprocessor.NewRuntimeFromConfig(zap.NewNop(), candidateConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: failed to initialize candidate runtime: %v\n", err)
+		return 1
+	}
+	defer candidateRuntime.Close()
+
+	comparison, err := replay.Compare(context.Background(), corpus, baselineRuntime, candidateRuntime,
+		replay.CompareOptions{Options: replay.Options{Tolerance: *tolerance}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(comparison); err != nil {
+			fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+			return 1
+		}
+	} else {
+		comparison.WriteText(os.Stdout)
+	}
+
+	for _, stats := range comparison.ByModel {
+		if stats.AgreementRate() < *minAgreement {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build !exporters
+// +build !exporters
+
+// This file lists the additional exporters of collectors built without them
+
+package main
+
+import (
+	"go.opentelemetry.io/collector/exporter"
+)
+
+// extraExporters returns no exporters, since the additional exporters are
+// only included when building with the exporters tag
+func extraExporters() []exporter.Factory {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build exporters
+// +build exporters
+
+// This file registers the exporters beyond OTLP, which are only included
+// when building with the exporters tag since they depend on the collector
+// contrib modules
+
+package main
+
+import (
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/fileexporter"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/kafkaexporter"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusremotewriteexporter"
+	"go.opentelemetry.io/collector/exporter"
+)
+
+// extraExporters returns the file, Kafka and Prometheus remote write
+// exporters
+func extraExporters() []exporter.Factory {
+	return []exporter.Factory{
+		fileexporter.NewFactory(),
+		kafkaexporter.NewFactory(),
+		prometheusremotewriteexporter.NewFactory(),
+	}
+}
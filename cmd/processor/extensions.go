@@ -0,0 +1,16 @@
+//go:build !extensions
+// +build !extensions
+
+// This file lists the extensions of collectors built without them
+
+package main
+
+import (
+	"go.opentelemetry.io/collector/extension"
+)
+
+// extraExtensions returns no extensions, since the health check and pprof
+// extensions are only included when building with the extensions tag
+func extraExtensions() []extension.Factory {
+	return nil
+}
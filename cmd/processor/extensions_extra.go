@@ -0,0 +1,23 @@
+//go:build extensions
+// +build extensions
+
+// This file registers the health check and pprof extensions, which are only
+// included when building with the extensions tag since they depend on the
+// collector contrib modules
+
+package main
+
+import (
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/healthcheckextension"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/pprofextension"
+	"go.opentelemetry.io/collector/extension"
+)
+
+// extraExtensions returns the health check extension, serving the liveness
+// and readiness probes, and the pprof extension, serving the Go profiles
+func extraExtensions() []extension.Factory {
+	return []extension.Factory{
+		healthcheckextension.NewFactory(),
+		pprofextension.NewFactory(),
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/confmap"
 	"go.opentelemetry.io/collector/confmap/provider/fileprovider"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/debugexporter"
 	"go.opentelemetry.io/collector/exporter/otlpexporter"
 	"go.opentelemetry.io/collector/otelcol"
 	"go.opentelemetry.io/collector/receiver/otlpreceiver"
@@ -21,6 +23,18 @@ func main() {
 		Version:     "0.1.0",
 	}
 
+	// Run the model tools instead of the collector if requested
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "models":
+			os.Exit(runModels(os.Args[2:]))
+		}
+	}
+
 	// Explicitly add the config file path to argv if not provided
 	args := os.Args
 	if len(args) == 1 || (len(args) > 1 && args[1] != "--config") {
@@ -77,14 +91,21 @@ func components() (otelcol.Factories, error) {
 	}
 	factories.Processors = processors
 
-	// Register exporters
+	// Register exporters, with the additional ones if built with them
 	exporters, err := otelcol.MakeFactoryMap(
-		otlpexporter.NewFactory(),
+		append([]exporter.Factory{otlpexporter.NewFactory(), debugexporter.NewFactory()}, extraExporters()...)...,
 	)
 	if err != nil {
 		return otelcol.Factories{}, fmt.Errorf("failed to create exporter factories: %w", err)
 	}
 	factories.Exporters = exporters
 
+	// Register the extensions the collector was built with
+	extensions, err := otelcol.MakeFactoryMap(extraExtensions()...)
+	if err != nil {
+		return otelcol.Factories{}, fmt.Errorf("failed to create extension factories: %w", err)
+	}
+	factories.Extensions = extensions
+
 	return factories, nil
 }
\ No newline at end of file
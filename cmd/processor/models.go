@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/registry"
+)
+
+// runModels implements the "models" subcommand for working with a model
+// registry: "models list" prints the available models and "models pull <ref>"
+// downloads one into the local cache. Returns the process exit code.
+func runModels(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: models list|pull [flags] [registry://name@version]")
+		return 2
+	}
+	command := args[0]
+
+	flags := flag.NewFlagSet("models "+command, flag.ContinueOnError)
+	endpoint := flags.String("registry", os.Getenv("OTEL_AI_MODEL_REGISTRY"), "URL of the registry index JSON, or oci:// URI of the index artifact")
+	cacheDir := flags.String("cache-dir", "/var/lib/otel-ai-processor/models", "directory where pulled models are stored")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout for each registry request")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	client, err := registry.NewClient(registry.Config{
+		Endpoint: *endpoint,
+		CacheDir: *cacheDir,
+		Timeout:  *timeout,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "models: %v\n", err)
+		return 2
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "list":
+		entries, err := client.List(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "models: %v\n", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tSHA256")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Name, entry.Version, entry.SHA256)
+		}
+		w.Flush()
+		return 0
+
+	case "pull":
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "usage: models pull [flags] registry://name@version")
+			return 2
+		}
+
+		path, err := client.PullRef(ctx, flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "models: %v\n", err)
+			return 1
+		}
+		fmt.Println(path)
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "models: unknown command %q\n", command)
+		return 2
+	}
+}
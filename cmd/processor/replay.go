@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	aiprocessor "github.com/fortxun/caza-otel-ai-processor/pkg/processor"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/replay"
+)
+
+// runReplay implements the "replay" subcommand: it runs a recorded corpus
+// through the models of the given configuration and diffs the decisions
+// against the recorded baseline. Returns the process exit code.
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configPath := flags.String("config", "config/config.yaml", "collector or processor configuration file")
+	corpusPath := flags.String("corpus", "", "recorded corpus file (JSON lines)")
+	baselinePath := flags.String("baseline", "", "baseline corpus to compare against (defaults to the recorded outputs)")
+	updateBaseline := flags.String("update-baseline", "", "write the replayed outputs as a new baseline to this file")
+	tolerance := flags.Float64("tolerance", 1e-6, "maximum difference for numeric outputs to be considered equal")
+	maxMismatchRate := flags.Float64("max-mismatch-rate", 0, "fail if the mismatch rate exceeds this value (0.0-1.0)")
+	maxDiffs := flags.Int("max-diffs", 50, "maximum number of differences to print (0 for all)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *corpusPath == "" {
+		fmt.Fprintln(os.Stderr, "replay: --corpus is required")
+		return 2
+	}
+
+	config, err := aiprocessor.LoadConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	corpus, err := replay.ReadCorpus(*corpusPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	// Compare against a separate baseline if provided
+	if *baselinePath != "" {
+		baseline, err := replay.ReadCorpus(*baselinePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+			return 1
+		}
+		if len(baseline) != len(corpus) {
+			fmt.Fprintf(os.Stderr, "replay: baseline has %d records but corpus has %d\n", len(baseline), len(corpus))
+			return 1
+		}
+		for i := range corpus {
+			corpus[i].Output = baseline[i].Output
+		}
+	}
+
+	wasmRuntime, err := aiprocessor.NewRuntimeFromConfig(zap.NewNop(), config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: failed to initialize WASM runtime: %v\n", err)
+		return 1
+	}
+	defer wasmRuntime.Close()
+
+	report, err := replay.Replay(context.Background(), corpus, wasmRuntime, replay.Options{
+		Tolerance: *tolerance,
+		Sanitizer: replay.NewSanitizer(config.Recording.RedactKeys),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+	report.WriteText(os.Stdout, *maxDiffs)
+
+	if *updateBaseline != "" {
+		if err := replay.WriteCorpus(*updateBaseline, report.Results); err != nil {
+			fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote new baseline to %s\n", *updateBaseline)
+	}
+
+	if report.MismatchRate() > *maxMismatchRate {
+		return 1
+	}
+	return 0
+}
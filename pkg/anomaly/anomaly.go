@@ -0,0 +1,220 @@
+// Package anomaly detects values deviating from the recent behavior of
+// their series. Each series keeps an exponentially weighted moving average
+// and variance of its values, optionally one per time of day or another
+// seasonal period, and values are scored by their z-score against them.
+package anomaly
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Directions of anomalous values
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// Config defines the detection
+type Config struct {
+	// Alpha is the weight of each new value in the moving statistics, in
+	// (0, 1]. Larger values adapt faster and remember less.
+	Alpha float64
+
+	// Threshold is the absolute z-score from which values are anomalous
+	Threshold float64
+
+	// MinSamples is the number of values a baseline needs before values are
+	// scored against it
+	MinSamples int
+
+	// MaxSeries bounds the series tracked; the least recently seen series
+	// are forgotten beyond it
+	MaxSeries int
+
+	// Season is the period of the seasonal baselines, such as a day, zero
+	// for a single baseline per series
+	Season time.Duration
+
+	// SeasonBuckets is the number of baselines per season, 24 for hourly
+	// baselines of a daily season
+	SeasonBuckets int
+}
+
+// Result is the score of a value
+type Result struct {
+	// Score is the absolute z-score of the value
+	Score float64
+
+	// Direction is Up or Down
+	Direction string
+
+	// Anomalous is set if the score reached the threshold
+	Anomalous bool
+}
+
+// Detector tracks the baselines of series. It is safe for concurrent use.
+type Detector struct {
+	config Config
+	mutex  sync.Mutex
+	series *lru.Cache[uint64, *series]
+}
+
+// series is the state of one series
+type series struct {
+	baselines []baseline
+
+	// The last total of a cumulative series
+	total    float64
+	hasTotal bool
+
+	// The last counts of a cumulative distribution, and the layout of their
+	// buckets
+	counts []uint64
+	layout uint64
+}
+
+// baseline is the moving mean and variance of a series
+type baseline struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// New creates a detector for config
+func New(config Config) (*Detector, error) {
+	if config.Alpha <= 0 || config.Alpha > 1 {
+		return nil, errors.New("alpha must be in (0, 1]")
+	}
+	if config.Threshold <= 0 {
+		return nil, errors.New("threshold must be positive")
+	}
+	if config.MaxSeries <= 0 {
+		return nil, errors.New("maximum number of series must be positive")
+	}
+	if config.Season < 0 {
+		return nil, errors.New("season must not be negative")
+	}
+	if config.Season == 0 || config.SeasonBuckets <= 0 {
+		config.SeasonBuckets = 1
+	}
+
+	cache, err := lru.New[uint64, *series](config.MaxSeries)
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{config: config, series: cache}, nil
+}
+
+// Observe scores a value of the series key seen at a time against its
+// baseline, then adds it to the baseline
+func (d *Detector) Observe(key uint64, value float64, at time.Time) Result {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.observe(d.get(key), value, at)
+}
+
+// ObserveCumulative scores the increase of a cumulative series, such as a
+// monotonic counter, since its previous total. The first total of a series
+// and totals following a reset are not scored.
+func (d *Detector) ObserveCumulative(key uint64, total float64, at time.Time) Result {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	s := d.get(key)
+	previous, known := s.total, s.hasTotal
+	s.total, s.hasTotal = total, true
+	if !known || total < previous {
+		return Result{}
+	}
+	return d.observe(s, total-previous, at)
+}
+
+// ObserveCumulativeCounts scores a value of the increase of the bucket
+// counts of a cumulative distribution, such as a cumulative histogram, since
+// its previous counts. layout identifies the bounds of the buckets, and
+// value computes the scored value from the increase of each bucket, or
+// returns false if there is none. The first counts of a series, counts
+// after a reset and counts whose layout changed are not scored.
+func (d *Detector) ObserveCumulativeCounts(key uint64, layout uint64, counts []uint64, at time.Time, value func(increase []uint64) (float64, bool)) Result {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	s := d.get(key)
+	previous, known := s.counts, s.counts != nil && s.layout == layout && len(s.counts) == len(counts)
+	s.counts, s.layout = append(s.counts[:0:0], counts...), layout
+	if !known {
+		return Result{}
+	}
+	increase := make([]uint64, len(counts))
+	for i, count := range counts {
+		if count < previous[i] {
+			return Result{}
+		}
+		increase[i] = count - previous[i]
+	}
+	v, ok := value(increase)
+	if !ok {
+		return Result{}
+	}
+	return d.observe(s, v, at)
+}
+
+// get returns the state of a series, creating it if needed. The caller
+// holds the mutex.
+func (d *Detector) get(key uint64) *series {
+	s, ok := d.series.Get(key)
+	if !ok {
+		s = &series{baselines: make([]baseline, d.config.SeasonBuckets)}
+		d.series.Add(key, s)
+	}
+	return s
+}
+
+// observe scores and records a value. The caller holds the mutex.
+func (d *Detector) observe(s *series, value float64, at time.Time) Result {
+	b := &s.baselines[d.bucket(at)]
+
+	var result Result
+	if b.samples >= d.config.MinSamples && b.samples > 0 {
+		// Series that were constant deviate by any change
+		stddev := math.Max(math.Sqrt(b.variance), 1e-9*math.Max(1, math.Abs(b.mean)))
+		z := (value - b.mean) / stddev
+		result = Result{Score: math.Abs(z), Direction: Up}
+		if z < 0 {
+			result.Direction = Down
+		}
+		result.Anomalous = result.Score >= d.config.Threshold
+	}
+
+	// Early values are weighted equally, so young baselines are their plain
+	// mean and variance rather than biased towards the first value
+	alpha := math.Max(d.config.Alpha, 1/float64(b.samples+1))
+	diff := value - b.mean
+	increment := alpha * diff
+	b.mean += increment
+	b.variance = (1 - alpha) * (b.variance + diff*increment)
+	b.samples++
+	return result
+}
+
+// bucket returns the seasonal baseline of a time
+func (d *Detector) bucket(at time.Time) int {
+	if d.config.SeasonBuckets == 1 {
+		return 0
+	}
+	offset := time.Duration(at.UnixNano()) % d.config.Season
+	if offset < 0 {
+		offset += d.config.Season
+	}
+	return int(int64(offset) * int64(d.config.SeasonBuckets) / int64(d.config.Season))
+}
+
+// Len returns the number of series tracked
+func (d *Detector) Len() int {
+	return d.series.Len()
+}
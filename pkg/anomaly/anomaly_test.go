@@ -0,0 +1,106 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectorScoresDeviations(t *testing.T) {
+	d, err := New(Config{Alpha: 0.2, Threshold: 3, MinSamples: 5, MaxSeries: 10})
+	require.NoError(t, err)
+	start := time.Unix(0, 0)
+
+	// Values are not scored before the baseline has enough samples
+	for i, value := range []float64{100, 102, 98, 101, 99, 100, 103, 97} {
+		result := d.Observe(1, value, start.Add(time.Duration(i)*time.Minute))
+		assert.False(t, result.Anomalous, "value %d", i)
+	}
+
+	spike := d.Observe(1, 160, start.Add(10*time.Minute))
+	assert.True(t, spike.Anomalous)
+	assert.Equal(t, Up, spike.Direction)
+	assert.Greater(t, spike.Score, 3.0)
+
+	// Other series have their own baselines
+	assert.False(t, d.Observe(2, 160, start).Anomalous)
+
+	// Constant series deviate by any change
+	for i := 0; i < 5; i++ {
+		d.Observe(3, 0, start)
+	}
+	drop := d.Observe(3, -1, start)
+	assert.True(t, drop.Anomalous)
+	assert.Equal(t, Down, drop.Direction)
+}
+
+func TestDetectorScoresIncreasesOfCumulativeSeries(t *testing.T) {
+	d, err := New(Config{Alpha: 0.5, Threshold: 3, MinSamples: 3, MaxSeries: 10})
+	require.NoError(t, err)
+	start := time.Unix(0, 0)
+
+	// A counter growing by 10 a minute, then by 100
+	total := 0.0
+	for i := 0; i < 6; i++ {
+		total += 10
+		assert.False(t, d.ObserveCumulative(1, total, start).Anomalous)
+	}
+	assert.True(t, d.ObserveCumulative(1, total+100, start).Anomalous)
+
+	// Resets are not scored
+	assert.Equal(t, Result{}, d.ObserveCumulative(1, 5, start))
+}
+
+func TestDetectorScoresIncreasesOfCumulativeCounts(t *testing.T) {
+	d, err := New(Config{Alpha: 0.5, Threshold: 3, MinSamples: 3, MaxSeries: 10})
+	require.NoError(t, err)
+	start := time.Unix(0, 0)
+
+	// The scored value is the share of the increase in the last bucket
+	share := func(increase []uint64) (float64, bool) {
+		total := increase[0] + increase[1]
+		if total == 0 {
+			return 0, false
+		}
+		return float64(increase[1]) / float64(total), true
+	}
+
+	// Counts growing by 9 fast and 1 slow observations, then by 10 slow ones
+	counts := []uint64{0, 0}
+	for i := 0; i < 6; i++ {
+		counts[0] += 9
+		counts[1]++
+		assert.False(t, d.ObserveCumulativeCounts(1, 1, counts, start, share).Anomalous)
+	}
+	assert.True(t, d.ObserveCumulativeCounts(1, 1, []uint64{counts[0], counts[1] + 10}, start, share).Anomalous)
+
+	// Resets, new layouts and counts without increase are not scored
+	assert.Equal(t, Result{}, d.ObserveCumulativeCounts(1, 1, []uint64{1, 1}, start, share))
+	assert.Equal(t, Result{}, d.ObserveCumulativeCounts(1, 2, []uint64{5, 5}, start, share))
+	assert.Equal(t, Result{}, d.ObserveCumulativeCounts(1, 2, []uint64{5, 5}, start, share))
+}
+
+func TestDetectorKeepsSeasonalBaselines(t *testing.T) {
+	d, err := New(Config{Alpha: 0.5, Threshold: 3, MinSamples: 3, MaxSeries: 1, Season: 24 * time.Hour, SeasonBuckets: 24})
+	require.NoError(t, err)
+	night := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	day := night.Add(9 * time.Hour)
+
+	// Busy days and quiet nights are both normal
+	for i := 0; i < 5; i++ {
+		d.Observe(1, 10+float64(i%2), night.Add(time.Duration(i)*24*time.Hour))
+		d.Observe(1, 1000+float64(i%2), day.Add(time.Duration(i)*24*time.Hour))
+	}
+	assert.False(t, d.Observe(1, 1000, day.Add(5*24*time.Hour)).Anomalous)
+	assert.True(t, d.Observe(1, 1000, night.Add(5*24*time.Hour)).Anomalous)
+
+	// Beyond the maximum, the least recently seen series are forgotten
+	d.Observe(2, 1, night)
+	assert.Equal(t, 1, d.Len())
+	assert.False(t, d.Observe(1, 1000, night).Anomalous)
+
+	_, err = New(Config{Alpha: 2, Threshold: 3, MaxSeries: 1})
+	assert.ErrorContains(t, err, "alpha must be in (0, 1]")
+}
@@ -0,0 +1,193 @@
+// Package bundle reads model bundles: tar archives holding the models of a
+// release and a manifest describing them, so all models are distributed and
+// rolled out together as a single artifact. The manifest, manifest.yaml or
+// manifest.json at the root of the archive, names the version of the bundle
+// and the file and expected exports of each model:
+//
+//	version: 2024.06.1
+//	models:
+//	  error_classifier:
+//	    file: error-classifier.wasm.zst
+//	    exports: [classify_error]
+//	  importance_sampler:
+//	    file: importance-sampler.wasm.gz
+//	    exports: [sample_telemetry]
+//
+// Model files may be compressed; they are extracted as they are.
+package bundle
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// manifestNames are the names the manifest is looked up by, in order
+var manifestNames = []string{"manifest.yaml", "manifest.json"}
+
+// Manifest describes the models of a bundle
+type Manifest struct {
+	// Version identifies the release of the models
+	Version string `yaml:"version"`
+
+	// Models are the models of the bundle, keyed by name
+	Models map[string]Model `yaml:"models"`
+}
+
+// Model is a model of a bundle
+type Model struct {
+	// File is the path of the model in the archive
+	File string `yaml:"file"`
+
+	// Exports are the functions the model must export
+	Exports []string `yaml:"exports"`
+}
+
+// Bundle is a bundle extracted to a directory
+type Bundle struct {
+	Manifest
+
+	// Dir is the directory the bundle is extracted to
+	Dir string
+
+	// SHA256 is the hex encoded digest of the archive
+	SHA256 string
+}
+
+// Path returns the path of the extracted file of a model, empty if the
+// bundle has no such model
+func (b *Bundle) Path(model string) string {
+	m, ok := b.Models[model]
+	if !ok {
+		return ""
+	}
+	return filepath.Join(b.Dir, filepath.FromSlash(m.File))
+}
+
+// Extract extracts the bundle at path into a directory of dir named after
+// its digest, and checks that its manifest describes the files it holds. A
+// bundle is extracted completely before its directory appears, so a
+// directory never holds part of a bundle, and bundles extracted before are
+// reused.
+func Extract(path, dir string) (*Bundle, error) {
+	digest, err := runtime.FileSHA256(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model bundle: %w", err)
+	}
+	bundle := &Bundle{Dir: filepath.Join(dir, digest[:16]), SHA256: digest}
+	if manifest, err := readManifest(bundle.Dir); err == nil {
+		bundle.Manifest = *manifest
+		return bundle, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(dir, ".extract-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := extractArchive(path, staging); err != nil {
+		return nil, err
+	}
+	manifest, err := readManifest(staging)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another process may have extracted the same bundle meanwhile
+	if err := os.Rename(staging, bundle.Dir); err != nil {
+		if _, statErr := os.Stat(bundle.Dir); statErr != nil {
+			return nil, fmt.Errorf("failed to extract model bundle: %w", err)
+		}
+	}
+	bundle.Manifest = *manifest
+	return bundle, nil
+}
+
+// extractArchive writes the regular files of the tar archive at path into
+// dir
+func extractArchive(path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read model bundle: %w", err)
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid model bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid model bundle: file %q is outside the bundle", header.Name)
+		}
+
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to extract model bundle: %w", err)
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to extract model bundle: %w", err)
+		}
+		_, err = io.Copy(out, reader)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s from model bundle: %w", header.Name, err)
+		}
+	}
+}
+
+// readManifest reads and checks the manifest of the bundle extracted to dir
+func readManifest(dir string) (*Manifest, error) {
+	var data []byte
+	var err error
+	for _, name := range manifestNames {
+		if data, err = os.ReadFile(filepath.Join(dir, name)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid model bundle: no manifest.yaml or manifest.json")
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid model bundle manifest: %w", err)
+	}
+	if manifest.Version == "" {
+		return nil, fmt.Errorf("invalid model bundle manifest: version is required")
+	}
+	if len(manifest.Models) == 0 {
+		return nil, fmt.Errorf("invalid model bundle manifest: no models")
+	}
+	for name, model := range manifest.Models {
+		file := filepath.FromSlash(model.File)
+		if model.File == "" || !filepath.IsLocal(file) {
+			return nil, fmt.Errorf("invalid model bundle manifest: invalid file %q for model %s", model.File, name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			return nil, fmt.Errorf("invalid model bundle: missing file %s of model %s", model.File, name)
+		}
+	}
+	return &manifest, nil
+}
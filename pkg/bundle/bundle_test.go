@@ -0,0 +1,79 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeArchive writes a tar archive of files to a temporary file
+func writeArchive(t *testing.T, files map[string]string) string {
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	for name, content := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	path := filepath.Join(t.TempDir(), "models.tar")
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+	return path
+}
+
+func TestExtractBundle(t *testing.T) {
+	path := writeArchive(t, map[string]string{
+		"manifest.yaml": `
+version: "1.2.0"
+models:
+  error_classifier:
+    file: models/error-classifier.wasm.gz
+    exports: [classify_error]
+`,
+		"models/error-classifier.wasm.gz": "model",
+	})
+	dir := t.TempDir()
+
+	bundle, err := Extract(path, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.0", bundle.Version)
+	assert.Equal(t, []string{"classify_error"}, bundle.Models["error_classifier"].Exports)
+	assert.Empty(t, bundle.Path("sampler"))
+	data, err := os.ReadFile(bundle.Path("error_classifier"))
+	require.NoError(t, err)
+	assert.Equal(t, "model", string(data))
+
+	// Bundles extracted before are reused
+	again, err := Extract(path, dir)
+	require.NoError(t, err)
+	assert.Equal(t, bundle.Dir, again.Dir)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestExtractRejectsInvalidBundles(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"no manifest":     {"model.wasm": "model"},
+		"missing version": {"manifest.json": `{"models": {"sampler": {"file": "sampler.wasm"}}}`, "sampler.wasm": "model"},
+		"missing file":    {"manifest.json": `{"version": "1", "models": {"sampler": {"file": "sampler.wasm"}}}`},
+		"outside":         {"manifest.json": `{"version": "1", "models": {"sampler": {"file": "../sampler.wasm"}}}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := Extract(writeArchive(t, files), dir)
+			assert.Error(t, err)
+
+			// Nothing is left behind
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// The process-wide caches of converted attribute maps, keyed by the hash of
+// their content. Resources get their own cache, so the diversity of item
+// attributes doesn't evict the few resources every item refers to.
+var (
+	attributeCache mapCache
+	resourceCache  mapCache
+)
+
+// CacheStats are the counters of a converted map cache
+type CacheStats struct {
+	Size      int
+	Capacity  int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// mapCache is a bounded cache of converted maps. It is disabled until it is
+// configured with a positive size.
+type mapCache struct {
+	mutex     sync.Mutex
+	capacity  int
+	cache     atomic.Pointer[lru.Cache[uint64, map[string]interface{}]]
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// ConfigureAttributeCache sizes the cache used by AttributesToMap. The cache
+// is shared by all processors in the process and keeps the largest size any
+// of them configures; it stays disabled while no size is positive.
+func ConfigureAttributeCache(size int) error {
+	return attributeCache.configure(size)
+}
+
+// ConfigureResourceCache sizes the cache used by ResourceToMap, like
+// ConfigureAttributeCache
+func ConfigureResourceCache(size int) error {
+	return resourceCache.configure(size)
+}
+
+// AttributeCacheStatistics returns the counters of the attribute map cache
+func AttributeCacheStatistics() CacheStats {
+	return attributeCache.stats()
+}
+
+// ResourceCacheStatistics returns the counters of the resource cache
+func ResourceCacheStatistics() CacheStats {
+	return resourceCache.stats()
+}
+
+// ResourceToMap converts the attributes of a resource to a Go map, like
+// AttributesToMap but cached separately
+func ResourceToMap(resource pcommon.Resource) map[string]interface{} {
+	return convertAttributes(resource.Attributes(), &resourceCache)
+}
+
+// configure grows the cache to size
+func (c *mapCache) configure(size int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if size <= c.capacity {
+		return nil
+	}
+
+	if cache := c.cache.Load(); cache != nil {
+		cache.Resize(size)
+	} else {
+		cache, err := lru.NewWithEvict(size, func(uint64, map[string]interface{}) {
+			c.evictions.Add(1)
+		})
+		if err != nil {
+			return err
+		}
+		c.cache.Store(cache)
+	}
+	c.capacity = size
+	return nil
+}
+
+// stats returns the counters of the cache
+func (c *mapCache) stats() CacheStats {
+	stats := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+	if cache := c.cache.Load(); cache != nil {
+		c.mutex.Lock()
+		stats.Capacity = c.capacity
+		c.mutex.Unlock()
+		stats.Size = cache.Len()
+	}
+	return stats
+}
+
+// get returns the cached conversion of the map with hash, if the cache is
+// enabled and holds it
+func (c *mapCache) get(hash uint64) (map[string]interface{}, bool) {
+	cache := c.cache.Load()
+	if cache == nil {
+		return nil, false
+	}
+	cached, found := cache.Get(hash)
+	if !found {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return cached, true
+}
+
+// put caches a copy of the conversion of the map with hash, so callers may
+// modify the conversion they were given
+func (c *mapCache) put(hash uint64, converted map[string]interface{}) {
+	if cache := c.cache.Load(); cache != nil {
+		cache.Add(hash, copyMap(converted))
+	}
+}
+
+// copyMap returns a shallow copy of a converted map
+func copyMap(converted map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(converted))
+	for k, v := range converted {
+		copied[k] = v
+	}
+	return copied
+}
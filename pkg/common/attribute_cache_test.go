@@ -0,0 +1,106 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// attributesOf returns an attribute map distinct for each i
+func attributesOf(i int) pcommon.Map {
+	attributes := pcommon.NewMap()
+	attributes.PutStr("http.route", fmt.Sprintf("/users/%d", i))
+	return attributes
+}
+
+func TestMapCacheIsBoundedByItsSize(t *testing.T) {
+	cache := &mapCache{}
+	require.NoError(t, cache.configure(4))
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, map[string]interface{}{"http.route": fmt.Sprintf("/users/%d", i)}, convertAttributes(attributesOf(i), cache))
+	}
+	stats := cache.stats()
+	assert.Equal(t, 4, stats.Capacity)
+	assert.LessOrEqual(t, stats.Size, stats.Capacity)
+	assert.Equal(t, int64(6), stats.Evictions)
+	assert.Equal(t, int64(10), stats.Misses)
+
+	// The most recent maps are served from the cache, the oldest are gone
+	convertAttributes(attributesOf(9), cache)
+	convertAttributes(attributesOf(0), cache)
+	stats = cache.stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(11), stats.Misses)
+	assert.LessOrEqual(t, stats.Size, stats.Capacity)
+
+	// The cache keeps the largest size configured
+	require.NoError(t, cache.configure(2))
+	assert.Equal(t, 4, cache.stats().Capacity)
+	require.NoError(t, cache.configure(8))
+	assert.Equal(t, 8, cache.stats().Capacity)
+}
+
+func TestMapCacheIsDisabledWithoutSize(t *testing.T) {
+	cache := &mapCache{}
+	require.NoError(t, cache.configure(0))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, map[string]interface{}{"http.route": "/users/1"}, convertAttributes(attributesOf(1), cache))
+	}
+	assert.Equal(t, CacheStats{}, cache.stats())
+}
+
+func TestCachedMapsAreCopies(t *testing.T) {
+	cache := &mapCache{}
+	require.NoError(t, cache.configure(4))
+
+	first := convertAttributes(attributesOf(1), cache)
+	first["http.route"] = "changed"
+	assert.Equal(t, map[string]interface{}{"http.route": "/users/1"}, convertAttributes(attributesOf(1), cache))
+}
+
+// resourceOf returns a resource distinct for each i
+func resourceOf(i int) pcommon.Resource {
+	resource := pcommon.NewResource()
+	resource.Attributes().PutStr("service.name", fmt.Sprintf("service-%d", i))
+	return resource
+}
+
+func TestResourceCacheIsBoundedByItsSize(t *testing.T) {
+	require.NoError(t, ConfigureResourceCache(2))
+	before := ResourceCacheStatistics()
+
+	// The cache keeps the largest size configured in the process
+	capacity := before.Capacity
+	for i := 0; i < capacity+3; i++ {
+		assert.Equal(t, map[string]interface{}{"service.name": fmt.Sprintf("service-%d", i)}, ResourceToMap(resourceOf(i)))
+	}
+	after := ResourceCacheStatistics()
+	assert.Equal(t, capacity, after.Capacity)
+	assert.LessOrEqual(t, after.Size, after.Capacity)
+	assert.GreaterOrEqual(t, after.Evictions-before.Evictions, int64(3))
+}
+
+func TestAttributeChurnDoesNotEvictResources(t *testing.T) {
+	require.NoError(t, ConfigureResourceCache(2))
+	require.NoError(t, ConfigureAttributeCache(2))
+	resource := resourceOf(-1)
+	ResourceToMap(resource)
+
+	resources := ResourceCacheStatistics()
+	attributes := AttributeCacheStatistics()
+	for i := 0; i < attributes.Capacity+10; i++ {
+		AttributesToMap(attributesOf(i))
+		ResourceToMap(resource)
+	}
+
+	assert.Greater(t, AttributeCacheStatistics().Evictions, attributes.Evictions)
+	after := ResourceCacheStatistics()
+	assert.Equal(t, resources.Evictions, after.Evictions)
+	assert.Equal(t, resources.Misses, after.Misses)
+	assert.Equal(t, resources.Hits+int64(attributes.Capacity+10), after.Hits)
+}
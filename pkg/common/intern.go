@@ -0,0 +1,110 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxInternedValueLength bounds the values that are interned. Longer values
+// are rarely repeated enum-like values and are converted as they are.
+const maxInternedValueLength = 64
+
+// internedStrings is the process-wide table of canonical attribute keys and
+// values. It is disabled until it is configured with a positive size.
+var internedStrings struct {
+	mutex    sync.Mutex
+	capacity int
+	table    atomic.Pointer[internTable]
+}
+
+// internTable holds canonical copies of strings, boxed so that storing them
+// in the converted maps doesn't allocate. Strings are only added until the
+// table is full, so the table keeps the keys and values seen first, which
+// on a steady workload are the common ones.
+type internTable struct {
+	strings  sync.Map // string -> interface{} holding the canonical string
+	size     atomic.Int64
+	capacity int64
+}
+
+// InternStats are the counters of the string intern table
+type InternStats struct {
+	Size     int
+	Capacity int
+}
+
+// ConfigureStringInterning sizes the table of interned attribute keys and
+// values. Like the attribute cache it is shared by all processors in the
+// process and keeps the largest size any of them configures.
+func ConfigureStringInterning(size int) {
+	internedStrings.mutex.Lock()
+	defer internedStrings.mutex.Unlock()
+
+	if size <= internedStrings.capacity {
+		return
+	}
+	table := internedStrings.table.Load()
+	if table == nil {
+		table = &internTable{}
+	}
+	grown := &internTable{capacity: int64(size)}
+	table.strings.Range(func(key, value interface{}) bool {
+		grown.strings.Store(key, value)
+		grown.size.Add(1)
+		return true
+	})
+	internedStrings.table.Store(grown)
+	internedStrings.capacity = size
+}
+
+// StringInterningStatistics returns the counters of the intern table
+func StringInterningStatistics() InternStats {
+	table := internedStrings.table.Load()
+	if table == nil {
+		return InternStats{}
+	}
+	return InternStats{Size: int(table.size.Load()), Capacity: int(table.capacity)}
+}
+
+// internKey returns the canonical copy of an attribute key, if it is
+// interned. Interned keys of cached maps don't keep the batch they were read
+// from alive.
+func internKey(key string) string {
+	if interned, ok := intern(key); ok {
+		return interned.(string)
+	}
+	return key
+}
+
+// internValue returns a string attribute value boxed for a converted map
+func internValue(value string) interface{} {
+	if len(value) <= maxInternedValueLength {
+		if interned, ok := intern(value); ok {
+			return interned
+		}
+	}
+	return value
+}
+
+// intern returns the canonical boxed copy of s, adding it if the table has
+// room
+func intern(s string) (interface{}, bool) {
+	table := internedStrings.table.Load()
+	if table == nil {
+		return nil, false
+	}
+	if interned, ok := table.strings.Load(s); ok {
+		return interned, true
+	}
+	if table.size.Load() >= table.capacity {
+		return nil, false
+	}
+
+	canonical := strings.Clone(s)
+	interned, loaded := table.strings.LoadOrStore(canonical, interface{}(canonical))
+	if !loaded {
+		table.size.Add(1)
+	}
+	return interned, true
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestAttributesToMapInternsStrings(t *testing.T) {
+	ConfigureStringInterning(2)
+
+	convert := func(method string) map[string]interface{} {
+		attributes := pcommon.NewMap()
+		attributes.PutStr("http.method", method)
+		return AttributesToMap(attributes)
+	}
+	first := convert(strings.Clone("GET"))
+	second := convert(strings.Clone("GET"))
+
+	// Both maps share the canonical key and value
+	for key := range first {
+		for other := range second {
+			assert.Equal(t, unsafe.StringData(key), unsafe.StringData(other))
+		}
+	}
+	assert.Equal(t, unsafe.StringData(first["http.method"].(string)), unsafe.StringData(second["http.method"].(string)))
+
+	// Strings are converted as they are once the table is full
+	assert.Equal(t, "POST", convert("POST")["http.method"])
+	assert.Equal(t, InternStats{Size: 2, Capacity: 2}, StringInterningStatistics())
+}
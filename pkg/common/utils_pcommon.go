@@ -2,9 +2,12 @@
 package common
 
 import (
+	"encoding/binary"
 	"math"
 	"math/rand"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +17,11 @@ import (
 
 // AttributesToMap converts an OpenTelemetry attribute map to a Go map
 func AttributesToMap(attributes pcommon.Map) map[string]interface{} {
+	return convertAttributes(attributes, &attributeCache)
+}
+
+// convertAttributes converts an attribute map, using cache for repeated maps
+func convertAttributes(attributes pcommon.Map, cache *mapCache) map[string]interface{} {
 	// If the attribute map is empty, return an empty map
 	if attributes.Len() == 0 {
 		return make(map[string]interface{})
@@ -23,21 +31,18 @@ func AttributesToMap(attributes pcommon.Map) map[string]interface{} {
 	hash := CalculateAttributeMapHash(attributes)
 	
 	// Check if we have the map in cache
-	if cachedMap, found := AttributeMapCache.Load(hash); found {
+	if cachedMap, found := cache.get(hash); found {
 		// Return a copy of the cached map to avoid concurrent modification
-		result := make(map[string]interface{}, len(cachedMap.(map[string]interface{})))
-		for k, v := range cachedMap.(map[string]interface{}) {
-			result[k] = v
-		}
-		return result
+		return copyMap(cachedMap)
 	}
 	
 	// Not in cache, convert the map
 	result := make(map[string]interface{}, attributes.Len())
 	attributes.Range(func(k string, v pcommon.Value) bool {
+		k = internKey(k)
 		switch v.Type() {
 		case pcommon.ValueTypeStr:
-			result[k] = v.Str()
+			result[k] = internValue(v.Str())
 		case pcommon.ValueTypeBool:
 			result[k] = v.Bool()
 		case pcommon.ValueTypeInt:
@@ -49,7 +54,7 @@ func AttributesToMap(attributes pcommon.Map) map[string]interface{} {
 	})
 	
 	// Store in cache
-	AttributeMapCache.Store(hash, result)
+	cache.put(hash, result)
 	
 	return result
 }
@@ -72,27 +77,7 @@ func SetAttribute(attributes pcommon.Map, key string, value interface{}) {
 
 // ResourcesEqual checks if two resources are equal by comparing their attributes
 func ResourcesEqual(r1, r2 pcommon.Resource) bool {
-	// Fast path: pointer equality
-	if &r1 == &r2 {
-		return true
-	}
-	
-	// Get or calculate hash for r1
-	hash1, ok := ResourceCache.Load(r1)
-	if !ok {
-		hash1 = CalculateResourceHash(r1)
-		ResourceCache.Store(r1, hash1)
-	}
-	
-	// Get or calculate hash for r2
-	hash2, ok := ResourceCache.Load(r2)
-	if !ok {
-		hash2 = CalculateResourceHash(r2)
-		ResourceCache.Store(r2, hash2)
-	}
-	
-	// Compare hashes
-	return hash1 == hash2
+	return CalculateResourceHash(r1) == CalculateResourceHash(r2)
 }
 
 // SamplerRand is a global random number generator for sampling
@@ -119,9 +104,66 @@ func RandomSample(rate float64) bool {
 	return r < rate
 }
 
-// AttributeMapCache is a cache of attribute maps to avoid repeated conversions
-// The key is a hash of the attribute map, and the value is the converted map
-var AttributeMapCache sync.Map
+// TraceIDSample returns true if the trace should be kept based on the
+// sampling rate (0.0-1.0). The decision is a hash of the trace ID rather
+// than random, so every span of a trace gets the same decision, and a trace
+// kept at a rate is kept at any higher rate.
+func TraceIDSample(id pcommon.TraceID, rate float64) bool {
+	if rate >= 1.0 {
+		return true
+	}
+	if rate <= 0.0 {
+		return false
+	}
+
+	// The low 63 bits of the trace ID are random in W3C trace IDs, and are
+	// what the OpenTelemetry SDK ratio samplers compare against their rate
+	value := binary.BigEndian.Uint64(id[8:]) >> 1
+	return value < uint64(rate*(1<<63))
+}
+
+// randomnessBits is the number of bits of the randomness of a trace in W3C
+// Trace Context Level 2
+const randomnessBits = 56
+
+// TraceRandomness returns the 56-bit randomness of a trace, as defined by
+// W3C Trace Context Level 2 and used by OpenTelemetry consistent sampling:
+// the rv value of the ot entry of its trace state if it has one, or the 56
+// least significant bits of its trace ID.
+func TraceRandomness(id pcommon.TraceID, traceState string) uint64 {
+	for _, entry := range strings.Split(traceState, ",") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(entry), "ot=")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Split(value, ";") {
+			rv, ok := strings.CutPrefix(field, "rv:")
+			if !ok || len(rv) != randomnessBits/4 {
+				continue
+			}
+			if randomness, err := strconv.ParseUint(rv, 16, 64); err == nil {
+				return randomness
+			}
+		}
+	}
+	return binary.BigEndian.Uint64(id[8:]) & (1<<randomnessBits - 1)
+}
+
+// ThresholdSample returns true if an item with a 56-bit randomness should
+// be kept based on the sampling rate (0.0-1.0). It is kept if its
+// randomness reaches the rejection threshold of the rate, as OpenTelemetry
+// threshold samplers decide, so an item kept at a rate is kept at any
+// higher rate.
+func ThresholdSample(randomness uint64, rate float64) bool {
+	if rate >= 1.0 {
+		return true
+	}
+	if rate <= 0.0 {
+		return false
+	}
+	threshold := uint64((1 - rate) * (1 << randomnessBits))
+	return randomness >= threshold
+}
 
 // CalculateAttributeMapHash calculates a hash for an attribute map
 // This is used as a cache key for the AttributesToMap function
@@ -212,7 +254,4 @@ func GetOrCreateScope(rs ptrace.ResourceSpans, scope pcommon.InstrumentationScop
 // CalculateResourceHash calculates a hash for a resource based on its attributes
 func CalculateResourceHash(r pcommon.Resource) uint64 {
 	return CalculateAttributeMapHash(r.Attributes())
-}
-
-// ResourceCache is a cache of resource hashes for fast comparison
-var ResourceCache sync.Map
\ No newline at end of file
+}
\ No newline at end of file
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestTraceRandomness(t *testing.T) {
+	id := pcommon.TraceID([16]byte{8: 0xaa, 9: 0x12, 15: 0x34})
+	assert.Equal(t, uint64(0x12000000000034), TraceRandomness(id, ""))
+
+	// The rv value of the trace state takes precedence
+	assert.Equal(t, uint64(0x7fffffffffffff), TraceRandomness(id, "vendor=x,ot=th:8;rv:7fffffffffffff"))
+	assert.Equal(t, uint64(0x12000000000034), TraceRandomness(id, "ot=rv:7fff"))
+}
+
+func TestThresholdSample(t *testing.T) {
+	assert.True(t, ThresholdSample(0, 1))
+	assert.False(t, ThresholdSample(1<<56-1, 0))
+
+	// Items with randomness 0x80000000000000 are kept at rates from one half
+	assert.True(t, ThresholdSample(0x80000000000000, 0.5))
+	assert.False(t, ThresholdSample(0x7fffffffffffff, 0.5))
+	assert.True(t, ThresholdSample(0x7fffffffffffff, 0.51))
+}
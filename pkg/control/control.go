@@ -0,0 +1,307 @@
+// Package control implements the gRPC control-plane service used to manage a
+// running processor: reload models, update sampling rates, toggle features,
+// query statistics and clear the model result caches.
+//
+// Requests and responses are google.protobuf.Struct messages so the service
+// can be called from any gRPC client without generated stubs; see
+// control.proto for the service definition. The same methods are served as
+// JSON over HTTP by StartHTTP.
+//
+// Endpoints without a host listen on localhost only. Since the service
+// reloads models from any path and changes sampling, endpoints reachable
+// from other hosts should be served over TLS with a bearer token.
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is the fully qualified gRPC service name
+const ServiceName = "aiprocessor.control.v1.ControlPlane"
+
+// Method names of the control-plane service
+const (
+	MethodReloadModel    = "ReloadModel"
+	MethodUpdateSampling = "UpdateSampling"
+	MethodSetFeatures    = "SetFeatures"
+	MethodGetStats       = "GetStats"
+	MethodGetCacheStats  = "GetCacheStats"
+	MethodClearCache     = "ClearCache"
+)
+
+// Controller is implemented by the processor to apply control-plane requests
+type Controller interface {
+	// ReloadModel loads a new version of a model from path
+	ReloadModel(ctx context.Context, model string, path string) error
+
+	// UpdateSampling changes sampling rates and returns the effective settings
+	UpdateSampling(ctx context.Context, rates map[string]float64) (map[string]interface{}, error)
+
+	// SetFeatures toggles features and returns the effective settings
+	SetFeatures(ctx context.Context, features map[string]bool) (map[string]interface{}, error)
+
+	// Stats returns processor and model statistics
+	Stats(ctx context.Context) (map[string]interface{}, error)
+
+	// CacheStats returns the statistics of the model result caches
+	CacheStats(ctx context.Context) (map[string]interface{}, error)
+
+	// ClearCache removes the cached model results of tenant, or of every
+	// tenant if empty, and returns the cache statistics
+	ClearCache(ctx context.Context, tenant string) (map[string]interface{}, error)
+}
+
+// Security defines how the control-plane endpoints are secured
+type Security struct {
+	// TLS serves the endpoints over TLS if set
+	TLS *tls.Config
+
+	// BearerToken, if set, must be sent by every request in its
+	// authorization header or metadata as "Bearer <token>"
+	BearerToken string
+}
+
+// authorized reports whether an authorization header or metadata value
+// carries the bearer token, if one is required
+func (s Security) authorized(authorization string) bool {
+	if s.BearerToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.BearerToken)) == 1
+}
+
+// listen listens on endpoint (host:port), on localhost if it has no host
+func (s Security) listen(endpoint string) (net.Listener, error) {
+	if strings.HasPrefix(endpoint, ":") {
+		endpoint = "localhost" + endpoint
+	}
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", endpoint, err)
+	}
+	return listener, nil
+}
+
+// Register adds the control-plane service to a gRPC server
+func Register(server *grpc.Server, controller Controller) {
+	server.RegisterService(&serviceDesc, controller)
+}
+
+// Server serves the control-plane service on a TCP endpoint
+type Server struct {
+	logger   *zap.Logger
+	server   *grpc.Server
+	listener net.Listener
+}
+
+// Start listens on endpoint (host:port) and serves the control-plane service,
+// secured as security defines
+func Start(logger *zap.Logger, endpoint string, security Security, controller Controller) (*Server, error) {
+	listener, err := security.listen(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(security.authenticate)}
+	if security.TLS != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(security.TLS)))
+	}
+	server := grpc.NewServer(options...)
+	Register(server, controller)
+
+	s := &Server{
+		logger:   logger,
+		server:   server,
+		listener: listener,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.Error("Control-plane server stopped", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Control-plane gRPC service started", zap.String("endpoint", listener.Addr().String()))
+	return s, nil
+}
+
+// authenticate rejects requests without the bearer token, if one is required
+func (s Security) authenticate(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	if !s.authorized(authorization) {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	return handler(ctx, request)
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Stop gracefully stops the server
+func (s *Server) Stop() {
+	s.server.GracefulStop()
+}
+
+// Call invokes a control-plane method on conn. It is a convenience for
+// automation written in Go.
+func Call(ctx context.Context, conn grpc.ClientConnInterface, method string, request map[string]interface{}) (map[string]interface{}, error) {
+	in, err := structpb.NewStruct(request)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	out := &structpb.Struct{}
+	if err := conn.Invoke(ctx, "/"+ServiceName+"/"+method, in, out); err != nil {
+		return nil, err
+	}
+
+	return out.AsMap(), nil
+}
+
+// serviceDesc describes the control-plane service for grpc.Server
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Controller)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: MethodReloadModel, Handler: unaryHandler(MethodReloadModel, reloadModel)},
+		{MethodName: MethodUpdateSampling, Handler: unaryHandler(MethodUpdateSampling, updateSampling)},
+		{MethodName: MethodSetFeatures, Handler: unaryHandler(MethodSetFeatures, setFeatures)},
+		{MethodName: MethodGetStats, Handler: unaryHandler(MethodGetStats, getStats)},
+		{MethodName: MethodGetCacheStats, Handler: unaryHandler(MethodGetCacheStats, getCacheStats)},
+		{MethodName: MethodClearCache, Handler: unaryHandler(MethodClearCache, clearCache)},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "control.proto",
+}
+
+// methodFunc implements one control-plane method on plain maps
+type methodFunc func(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error)
+
+// unaryHandler adapts a methodFunc to a gRPC unary handler
+func unaryHandler(method string, fn methodFunc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := &structpb.Struct{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			result, err := fn(ctx, srv.(Controller), req.(*structpb.Struct).AsMap())
+			if err != nil {
+				return nil, err
+			}
+			out, err := structpb.NewStruct(result)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+			}
+			return out, nil
+		}
+
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + ServiceName + "/" + method,
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+func reloadModel(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error) {
+	model, _ := request["model"].(string)
+	path, _ := request["path"].(string)
+	if model == "" || path == "" {
+		return nil, status.Error(codes.InvalidArgument, "model and path are required")
+	}
+
+	if err := controller.ReloadModel(ctx, model, path); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to reload model: %v", err)
+	}
+
+	return map[string]interface{}{"model": model, "path": path}, nil
+}
+
+func updateSampling(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error) {
+	rates := make(map[string]float64, len(request))
+	for k, v := range request {
+		rate, ok := v.(float64)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "sampling setting %s must be a number", k)
+		}
+		rates[k] = rate
+	}
+
+	result, err := controller.UpdateSampling(ctx, rates)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return result, nil
+}
+
+func setFeatures(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error) {
+	features := make(map[string]bool, len(request))
+	for k, v := range request {
+		enabled, ok := v.(bool)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "feature %s must be a bool", k)
+		}
+		features[k] = enabled
+	}
+
+	result, err := controller.SetFeatures(ctx, features)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return result, nil
+}
+
+func getStats(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error) {
+	result, err := controller.Stats(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return result, nil
+}
+
+func getCacheStats(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error) {
+	result, err := controller.CacheStats(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return result, nil
+}
+
+func clearCache(ctx context.Context, controller Controller, request map[string]interface{}) (map[string]interface{}, error) {
+	tenant, ok := request["tenant"].(string)
+	if _, present := request["tenant"]; present && !ok {
+		return nil, status.Error(codes.InvalidArgument, "tenant must be a string")
+	}
+
+	result, err := controller.ClearCache(ctx, tenant)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return result, nil
+}
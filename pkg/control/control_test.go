@@ -0,0 +1,35 @@
+package control
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestStartRequiresBearerToken(t *testing.T) {
+	controller := &fakeController{features: map[string]bool{"smart_sampling": true}}
+	server, err := Start(zap.NewNop(), "127.0.0.1:0", Security{BearerToken: "s3cret"}, controller)
+	require.NoError(t, err)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(server.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = Call(context.Background(), conn, MethodSetFeatures, map[string]interface{}{"smart_sampling": false})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.True(t, controller.features["smart_sampling"], "rejected requests change nothing")
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	features, err := Call(ctx, conn, MethodSetFeatures, map[string]interface{}{"smart_sampling": false})
+	require.NoError(t, err)
+	assert.Equal(t, false, features["smart_sampling"])
+}
@@ -0,0 +1,146 @@
+package control
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRequestSize bounds the JSON body of HTTP requests
+const maxRequestSize = 1 << 20
+
+// HTTPServer serves the control-plane methods as JSON over HTTP, for
+// operators without a gRPC client. Requests and responses are JSON objects
+// with the fields of the gRPC methods.
+type HTTPServer struct {
+	logger   *zap.Logger
+	server   *http.Server
+	listener net.Listener
+}
+
+// StartHTTP listens on endpoint (host:port) and serves the control-plane
+// methods over HTTP, or HTTPS, secured as security defines
+func StartHTTP(logger *zap.Logger, endpoint string, security Security, controller Controller) (*HTTPServer, error) {
+	listener, err := security.listen(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if security.TLS != nil {
+		listener = tls.NewListener(listener, security.TLS)
+	}
+
+	s := &HTTPServer{
+		logger:   logger,
+		server:   &http.Server{Handler: authenticated(security, Handler(controller)), ReadHeaderTimeout: 10 * time.Second},
+		listener: listener,
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Control-plane HTTP server stopped", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Control-plane HTTP service started", zap.String("endpoint", listener.Addr().String()))
+	return s, nil
+}
+
+// Handler returns the HTTP handler of the control-plane methods. Reading the
+// features or sampling settings returns them unchanged.
+func Handler(controller Controller) http.Handler {
+	mux := http.NewServeMux()
+	for pattern, fn := range map[string]methodFunc{
+		"POST /models/reload": reloadModel,
+		"GET /sampling":       updateSampling,
+		"POST /sampling":      updateSampling,
+		"GET /features":       setFeatures,
+		"POST /features":      setFeatures,
+		"GET /stats":          getStats,
+		"GET /cache/stats":    getCacheStats,
+		"POST /cache/clear":   clearCache,
+	} {
+		mux.Handle(pattern, httpHandler(controller, fn))
+	}
+	return mux
+}
+
+// authenticated rejects requests to handler without the bearer token, if
+// one is required
+func authenticated(security Security, handler http.Handler) http.Handler {
+	if security.BearerToken == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !security.authorized(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "missing or invalid bearer token"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Addr returns the address the server is listening on
+func (s *HTTPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Stop gracefully stops the server, waiting for up to 5 seconds for
+// requests in progress
+func (s *HTTPServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Warn("Failed to stop control-plane HTTP server", zap.Error(err))
+	}
+}
+
+// httpHandler adapts a methodFunc to an HTTP handler. GET requests and
+// requests without a body have an empty request.
+func httpHandler(controller Controller, fn methodFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := make(map[string]interface{})
+		if r.Method != http.MethodGet {
+			err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&request)
+			if err != nil && !errors.Is(err, io.EOF) {
+				writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid JSON request: " + err.Error()})
+				return
+			}
+		}
+
+		result, err := fn(r.Context(), controller, request)
+		if err != nil {
+			writeJSON(w, httpStatus(status.Code(err)), map[string]interface{}{"error": status.Convert(err).Message()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// httpStatus returns the HTTP status of a gRPC status code
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, code int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,129 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeController records the requests it is given
+type fakeController struct {
+	features map[string]bool
+	cleared  []string
+}
+
+func (c *fakeController) ReloadModel(ctx context.Context, model string, path string) error {
+	return errors.New("no such file")
+}
+
+func (c *fakeController) UpdateSampling(ctx context.Context, rates map[string]float64) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (c *fakeController) SetFeatures(ctx context.Context, features map[string]bool) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for k, v := range features {
+		c.features[k] = v
+	}
+	for k, v := range c.features {
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (c *fakeController) Stats(ctx context.Context) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (c *fakeController) CacheStats(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"cleared": len(c.cleared)}, nil
+}
+
+func (c *fakeController) ClearCache(ctx context.Context, tenant string) (map[string]interface{}, error) {
+	c.cleared = append(c.cleared, tenant)
+	return c.CacheStats(ctx)
+}
+
+func TestHandlerServesControlPlaneMethods(t *testing.T) {
+	controller := &fakeController{features: map[string]bool{"smart_sampling": true}}
+	handler := Handler(controller)
+	do := func(method, path, body string) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder.Code, strings.TrimSpace(recorder.Body.String())
+	}
+
+	code, body := do(http.MethodGet, "/features", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"smart_sampling": true}`, body)
+
+	code, body = do(http.MethodPost, "/features", `{"smart_sampling": false}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"smart_sampling": false}`, body)
+
+	code, body = do(http.MethodPost, "/features", `{"smart_sampling": "off"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.JSONEq(t, `{"error": "feature smart_sampling must be a bool"}`, body)
+
+	code, body = do(http.MethodPost, "/models/reload", `{"model": "sampler", "path": "/models/v2.wasm"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.JSONEq(t, `{"error": "failed to reload model: no such file"}`, body)
+
+	// Clearing without a body clears every tenant
+	code, _ = do(http.MethodPost, "/cache/clear", "")
+	require.Equal(t, http.StatusOK, code)
+	code, body = do(http.MethodPost, "/cache/clear", `{"tenant": "acme"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"", "acme"}, controller.cleared)
+	assert.JSONEq(t, `{"cleared": 2}`, body)
+
+	code, _ = do(http.MethodGet, "/cache/clear", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestStartHTTPSecuresEndpoint(t *testing.T) {
+	// The test server's certificate is valid for 127.0.0.1, and its client
+	// trusts it
+	certified := httptest.NewUnstartedServer(http.NotFoundHandler())
+	certified.StartTLS()
+	client := certified.Client()
+	security := Security{TLS: certified.TLS, BearerToken: "s3cret"}
+	certified.Close()
+
+	// Endpoints without a host listen on localhost only
+	server, err := StartHTTP(zap.NewNop(), ":0", security, &fakeController{features: map[string]bool{}})
+	require.NoError(t, err)
+	defer server.Stop()
+	host, port, err := net.SplitHostPort(server.Addr())
+	require.NoError(t, err)
+	assert.True(t, net.ParseIP(host).IsLoopback())
+
+	get := func(token string) int {
+		request, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+port+"/features", nil)
+		require.NoError(t, err)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := client.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, get(""))
+	assert.Equal(t, http.StatusUnauthorized, get("guess"))
+	assert.Equal(t, http.StatusOK, get("s3cret"))
+
+	// Plain HTTP is refused
+	response, err := http.Get("http://127.0.0.1:" + port + "/features")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
@@ -0,0 +1,194 @@
+// Package download fetches models from remote locations into a local cache
+// directory, so models can be updated without rebuilding the images they
+// run in. Models are located by URIs:
+//
+//	https://models.example.com/error-classifier.wasm
+//	s3://bucket/models/error-classifier.wasm
+//	oci://ghcr.io/acme/error-classifier:1.4.0
+//
+// S3 objects are signed with the AWS credentials of the environment, if
+// any, and OCI artifacts are pulled through the distribution API, with the
+// anonymous or basic token flow of the registry.
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Schemes of the URIs models are downloaded from
+var schemes = []string{"http://", "https://", "s3://", "oci://"}
+
+// IsURI reports whether s locates a remote model rather than a local file
+func IsURI(s string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config defines how models are downloaded
+type Config struct {
+	// CacheDir is where downloaded models are stored
+	CacheDir string
+
+	// Headers are added to HTTP requests and to the token requests of OCI
+	// registries, e.g. for authorization
+	Headers map[string]string
+
+	// Timeout bounds each request
+	Timeout time.Duration
+
+	// HTTPClient sends the requests, instead of a client bounded by Timeout
+	HTTPClient *http.Client
+}
+
+// Client downloads models
+type Client struct {
+	cacheDir   string
+	headers    map[string]string
+	httpClient *http.Client
+
+	// Bearer tokens of the OCI repositories, keyed by host and repository
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient creates a download client
+func NewClient(config Config) *Client {
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "otel-ai-processor", "downloads")
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: timeout}
+	}
+	return &Client{
+		cacheDir:   cacheDir,
+		headers:    config.Headers,
+		httpClient: httpClient,
+		tokens:     make(map[string]string),
+	}
+}
+
+// Fetch downloads the model at uri into the cache directory and returns its
+// local path and hex encoded SHA-256 digest. With an expected digest, the
+// download is verified against it and a cached model with that digest is
+// used without downloading it again. A failed download never replaces the
+// cached model.
+func (c *Client) Fetch(ctx context.Context, uri string, expected string) (string, string, error) {
+	target, err := c.CachePath(uri)
+	if err != nil {
+		return "", "", err
+	}
+	if expected != "" {
+		if digest, err := runtime.FileSHA256(target); err == nil && strings.EqualFold(digest, expected) {
+			return target, digest, nil
+		}
+	}
+
+	body, err := c.Open(ctx, uri)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download %s: %w", uri, err)
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".download-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return "", "", fmt.Errorf("failed to download %s: %w", uri, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", "", err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if expected != "" && !strings.EqualFold(digest, expected) {
+		return "", "", fmt.Errorf("digest mismatch for %s: expected %s, got %s", uri, expected, digest)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", "", fmt.Errorf("failed to store model: %w", err)
+	}
+	return target, digest, nil
+}
+
+// CachePath returns the local path the model at uri is downloaded to, in a
+// directory named after the URI so models with the same file name don't
+// collide
+func (c *Client) CachePath(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || !IsURI(uri) {
+		return "", fmt.Errorf("invalid model URI %q", uri)
+	}
+	name := path.Base(parsed.Path)
+	if i := strings.IndexAny(name, ":@"); i > 0 {
+		name = name[:i]
+	}
+	if name == "" || name == "/" || name == "." {
+		name = "model"
+	}
+	key := sha256.Sum256([]byte(uri))
+	return filepath.Join(c.cacheDir, hex.EncodeToString(key[:8]), name), nil
+}
+
+// Open starts downloading the file at uri without caching it. OCI layers
+// are verified against their digest as they are read.
+func (c *Client) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(uri, "s3://"):
+		return c.openS3(ctx, uri)
+	case strings.HasPrefix(uri, "oci://"):
+		return c.openOCI(ctx, uri)
+	default:
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range c.headers {
+			request.Header.Set(key, value)
+		}
+		return c.do(request)
+	}
+}
+
+// do sends a request and returns the response body on success
+func (c *Client) do(request *http.Request) (io.ReadCloser, error) {
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s from %s", response.Status, request.URL.Redacted())
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,240 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Media types of the manifests accepted from OCI registries
+var ociManifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociManifest is the part of an image manifest listing its layers
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// ociDescriptor describes a blob of a repository
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// ociReference is a parsed oci://host/repository:tag or
+// oci://host/repository@digest URI
+type ociReference struct {
+	host       string
+	repository string
+	reference  string
+}
+
+// parseOCIReference parses an oci:// URI. The tag defaults to latest.
+func parseOCIReference(uri string) (ociReference, error) {
+	host, name, ok := strings.Cut(strings.TrimPrefix(uri, "oci://"), "/")
+	if !ok || host == "" || name == "" {
+		return ociReference{}, fmt.Errorf("invalid OCI URI %q: expected oci://host/repository:tag", uri)
+	}
+	ref := ociReference{host: host, repository: name, reference: "latest"}
+	if repository, digest, ok := strings.Cut(name, "@"); ok {
+		ref.repository, ref.reference = repository, digest
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.repository, ref.reference = name[:i], name[i+1:]
+	}
+	if ref.repository == "" || ref.reference == "" {
+		return ociReference{}, fmt.Errorf("invalid OCI URI %q", uri)
+	}
+	return ref, nil
+}
+
+// openOCI starts downloading the model layer of an OCI artifact: the layer
+// whose media type mentions wasm, or the only layer of the artifact. The
+// layer is verified against its digest as it is read.
+func (c *Client) openOCI(ctx context.Context, uri string) (io.ReadCloser, error) {
+	ref, err := parseOCIReference(uri)
+	if err != nil {
+		return nil, err
+	}
+	base := "https://" + ref.host + "/v2/" + ref.repository
+
+	body, err := c.ociGet(ctx, ref, base+"/manifests/"+ref.reference, strings.Join(ociManifestTypes, ", "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	var manifest ociManifest
+	err = json.NewDecoder(body).Decode(&manifest)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	var layer *ociDescriptor
+	for i := range manifest.Layers {
+		if strings.Contains(manifest.Layers[i].MediaType, "wasm") {
+			layer = &manifest.Layers[i]
+			break
+		}
+	}
+	if layer == nil && len(manifest.Layers) == 1 {
+		layer = &manifest.Layers[0]
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("artifact has %d layers and none of them is a WASM layer", len(manifest.Layers))
+	}
+	expected, ok := strings.CutPrefix(layer.Digest, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("unsupported layer digest %q", layer.Digest)
+	}
+
+	body, err = c.ociGet(ctx, ref, base+"/blobs/"+layer.Digest, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch layer: %w", err)
+	}
+	return &verifyingReader{body: body, hash: sha256.New(), expected: expected}, nil
+}
+
+// ociGet sends a GET request to a registry, authenticating with a bearer
+// token when the registry challenges the request
+func (c *Client) ociGet(ctx context.Context, ref ociReference, target string, accept string) (io.ReadCloser, error) {
+	scope := ref.host + "/" + ref.repository
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		c.mutex.Lock()
+		token := c.tokens[scope]
+		c.mutex.Unlock()
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusOK {
+			return response.Body, nil
+		}
+		response.Body.Close()
+		challenge := response.Header.Get("WWW-Authenticate")
+		if response.StatusCode != http.StatusUnauthorized || attempt > 0 || challenge == "" {
+			return nil, fmt.Errorf("unexpected status %s from %s", response.Status, target)
+		}
+
+		token, err = c.ociToken(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.mutex.Lock()
+		c.tokens[scope] = token
+		c.mutex.Unlock()
+	}
+}
+
+// ociToken requests a bearer token as a WWW-Authenticate challenge asks,
+// sending the configured headers, such as basic credentials
+func (c *Client) ociToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported registry authentication %q", scheme)
+	}
+	values := parseChallenge(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("invalid registry authentication realm %q", values["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			query.Set(key, values[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range c.headers {
+		request.Header.Set(key, value)
+	}
+	body, err := c.do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to authenticate to registry: %w", err)
+	}
+	defer body.Close()
+
+	var response struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if response.Token != "" {
+		return response.Token, nil
+	}
+	if response.AccessToken != "" {
+		return response.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry returned no token")
+}
+
+// parseChallenge parses the key="value" parameters of a challenge
+func parseChallenge(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		values[strings.ToLower(strings.TrimSpace(key))] = value
+		params = rest
+	}
+	return values
+}
+
+// verifyingReader fails the read completing a blob whose SHA-256 digest
+// isn't the expected one
+type verifyingReader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+// Read implements io.Reader
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if digest := hex.EncodeToString(r.hash.Sum(nil)); digest != r.expected {
+			return n, fmt.Errorf("layer digest mismatch: expected %s, got %s", r.expected, digest)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *verifyingReader) Close() error {
+	return r.body.Close()
+}
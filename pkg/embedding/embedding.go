@@ -0,0 +1,170 @@
+// Package embedding computes vector embeddings of telemetry text, such as
+// span names and log bodies, and finds the embeddings of recently seen items
+// nearest to a new one. Embeddings are computed locally by feature hashing,
+// or by a model such as a WASM module or a remote embedding API.
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ErrEmpty is returned for texts without any feature to embed, such as
+// texts made only of numbers
+var ErrEmpty = errors.New("text has no features to embed")
+
+// Embedder computes the embeddings of texts
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+	Close() error
+}
+
+// Hashing embeds texts by hashing their words and the character trigrams of
+// their words into a fixed number of dimensions. Words holding digits, such
+// as IDs and durations, are left out, so texts differing only by them embed
+// the same, and texts sharing most of their words embed close to each
+// other. It needs no model.
+type Hashing struct {
+	dimensions int
+}
+
+// NewHashing creates a hashing embedder of the given dimensions
+func NewHashing(dimensions int) (*Hashing, error) {
+	if dimensions <= 0 {
+		return nil, errors.New("dimensions must be positive")
+	}
+	return &Hashing{dimensions: dimensions}, nil
+}
+
+// Embed implements Embedder
+func (h *Hashing) Embed(ctx context.Context, text string) ([]float32, error) {
+	vector := make([]float32, h.dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			continue
+		}
+		h.add(vector, "w:"+word, 2)
+		runes := []rune(word)
+		for i := 0; i+3 <= len(runes); i++ {
+			h.add(vector, "t:"+string(runes[i:i+3]), 1)
+		}
+	}
+	if !Normalize(vector) {
+		return nil, ErrEmpty
+	}
+	return vector, nil
+}
+
+// add adds a feature to vector, the sign of its weight hashed with it so
+// colliding features cancel out rather than add up
+func (h *Hashing) add(vector []float32, feature string, weight float32) {
+	hash := fnv.New64a()
+	hash.Write([]byte(feature))
+	sum := hash.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[int(sum%uint64(h.dimensions))] += weight
+}
+
+// Close implements Embedder
+func (h *Hashing) Close() error {
+	return nil
+}
+
+// Invoker runs a model on a JSON-encoded input, as the model backends of
+// the runtime and the remote client do
+type Invoker interface {
+	Invoke(ctx context.Context, input []byte) (map[string]interface{}, error)
+	Close() error
+}
+
+// Model embeds texts with a model. The model receives {"input": text}, with
+// the configured model name as "model", as OpenAI-compatible embedding APIs
+// expect, and returns the embedding as "embedding", or in "data" as those
+// APIs do.
+type Model struct {
+	invoker Invoker
+	name    string
+}
+
+// NewModel creates an embedder invoking a model, name being the model the
+// embedding API serves, if it serves several
+func NewModel(invoker Invoker, name string) *Model {
+	return &Model{invoker: invoker, name: name}
+}
+
+// embeddingRequest is the input of embedding models
+type embeddingRequest struct {
+	Input string `json:"input"`
+	Model string `json:"model,omitempty"`
+}
+
+// Embed implements Embedder
+func (m *Model) Embed(ctx context.Context, text string) ([]float32, error) {
+	input, err := json.Marshal(embeddingRequest{Input: text, Model: m.name})
+	if err != nil {
+		return nil, err
+	}
+	output, err := m.invoker.Invoke(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := output["embedding"].([]interface{})
+	if !ok {
+		if data, ok := output["data"].([]interface{}); ok && len(data) > 0 {
+			if first, ok := data[0].(map[string]interface{}); ok {
+				values, _ = first["embedding"].([]interface{})
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, errors.New("embedding model returned no embedding")
+	}
+
+	vector := make([]float32, len(values))
+	for i, value := range values {
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("embedding model returned a non-numeric value at %d", i)
+		}
+		vector[i] = float32(number)
+	}
+	if !Normalize(vector) {
+		return nil, ErrEmpty
+	}
+	return vector, nil
+}
+
+// Close implements Embedder, closing the model
+func (m *Model) Close() error {
+	return m.invoker.Close()
+}
+
+// Normalize scales vector to unit length, so the cosine similarity of
+// normalized vectors is their dot product. It reports false for zero
+// vectors, which have no direction.
+func Normalize(vector []float32) bool {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return false
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return true
+}
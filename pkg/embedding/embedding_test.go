@@ -0,0 +1,105 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashingEmbedsSimilarTextsClose(t *testing.T) {
+	embedder, err := NewHashing(256)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	timeout, err := embedder.Embed(ctx, "connection to db-7 timed out after 30s")
+	require.NoError(t, err)
+	other, err := embedder.Embed(ctx, "connection to db-12 timed out after 45s")
+	require.NoError(t, err)
+	refused, err := embedder.Embed(ctx, "user profile cache refreshed")
+	require.NoError(t, err)
+
+	// Words holding digits are left out
+	assert.InDelta(t, 1.0, dot(timeout, other), 1e-6)
+	assert.Less(t, dot(timeout, refused), 0.5)
+
+	_, err = embedder.Embed(ctx, "42 1.5 0x1f")
+	assert.ErrorIs(t, err, ErrEmpty)
+}
+
+// invokerFunc adapts a function to an Invoker
+type invokerFunc func(input []byte) (map[string]interface{}, error)
+
+func (f invokerFunc) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	return f(input)
+}
+
+func (f invokerFunc) Close() error { return nil }
+
+func TestModelDecodesEmbeddings(t *testing.T) {
+	var inputs []string
+	outputs := []map[string]interface{}{
+		{"embedding": []interface{}{3.0, 4.0}},
+		{"data": []interface{}{map[string]interface{}{"embedding": []interface{}{0.0, 2.0}}}},
+		{"label": "none"},
+	}
+	model := NewModel(invokerFunc(func(input []byte) (map[string]interface{}, error) {
+		inputs = append(inputs, string(input))
+		if len(outputs) == 0 {
+			return nil, errors.New("unavailable")
+		}
+		output := outputs[0]
+		outputs = outputs[1:]
+		return output, nil
+	}), "text-embedding-3-small")
+	ctx := context.Background()
+
+	vector, err := model.Embed(ctx, "GET /users")
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, vector, 1e-6)
+	assert.Equal(t, `{"input":"GET /users","model":"text-embedding-3-small"}`, inputs[0])
+
+	vector, err = model.Embed(ctx, "GET /users")
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0, 1}, vector)
+
+	_, err = model.Embed(ctx, "GET /users")
+	assert.Error(t, err)
+	_, err = model.Embed(ctx, "GET /users")
+	assert.Error(t, err)
+}
+
+func TestIndexFindsNearEmbeddings(t *testing.T) {
+	index, err := NewIndex(IndexConfig{Capacity: 2, Tables: 4, Bits: 4, Seed: 1})
+	require.NoError(t, err)
+
+	similarity, added, err := index.Observe([]float32{1, 0, 0}, 0.9)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 0.0, similarity)
+
+	// Identical embeddings always share their buckets
+	similarity, added, err = index.Observe([]float32{1, 0, 0}, 0.9)
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.InDelta(t, 1.0, similarity, 1e-6)
+
+	_, added, err = index.Observe([]float32{0, 1, 0}, 0.9)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 2, index.Len())
+
+	// The oldest embedding is forgotten beyond the capacity
+	_, added, err = index.Observe([]float32{0, 0, 1}, 0.9)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 2, index.Len())
+	_, added, err = index.Observe([]float32{1, 0, 0}, 0.9)
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	_, _, err = index.Observe([]float32{1, 0}, 0.9)
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+// This file contains the approximate nearest neighbor index of recently
+// seen embeddings
+
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+)
+
+// IndexConfig defines an index
+type IndexConfig struct {
+	// Capacity bounds the embeddings held; the oldest are forgotten
+	// beyond it
+	Capacity int
+
+	// Tables is the number of hash tables. More tables find more of the
+	// near embeddings, at the cost of comparing more candidates.
+	Tables int
+
+	// Bits is the number of hyperplanes hashing embeddings in each table.
+	// More bits make buckets smaller and only nearer embeddings share them.
+	Bits int
+
+	// Seed seeds the random hyperplanes, so indexes of the same seed hash
+	// embeddings the same
+	Seed uint64
+}
+
+// Index finds the embeddings nearest to a query among those added, by
+// locality-sensitive hashing with random hyperplanes: embeddings on the same
+// side of every hyperplane of a table share its bucket, and only the
+// embeddings sharing a bucket with the query are compared with it. It is
+// safe for concurrent use.
+type Index struct {
+	config IndexConfig
+
+	mutex sync.Mutex
+
+	// hyperplanes holds Bits hyperplanes per table, created for the
+	// dimensions of the first embedding
+	hyperplanes [][]float32
+	dimensions  int
+
+	// entries is a ring of the embeddings, next the slot of the next one
+	entries []indexEntry
+	next    int
+
+	// buckets maps the hash of each table to the slots of its embeddings
+	buckets []map[uint32][]int
+}
+
+// indexEntry is an embedding held by the index and its hash in each table
+type indexEntry struct {
+	vector []float32
+	hashes []uint32
+}
+
+// NewIndex creates an index for config
+func NewIndex(config IndexConfig) (*Index, error) {
+	if config.Capacity <= 0 {
+		return nil, errors.New("capacity must be positive")
+	}
+	if config.Tables <= 0 {
+		return nil, errors.New("number of tables must be positive")
+	}
+	if config.Bits <= 0 || config.Bits > 32 {
+		return nil, errors.New("number of bits must be between 1 and 32")
+	}
+
+	index := &Index{
+		config:  config,
+		entries: make([]indexEntry, 0, config.Capacity),
+		buckets: make([]map[uint32][]int, config.Tables),
+	}
+	for i := range index.buckets {
+		index.buckets[i] = make(map[uint32][]int)
+	}
+	return index, nil
+}
+
+// Observe returns the cosine similarity of vector to the nearest embedding
+// in the index, 0 if none is found, and adds vector unless the similarity
+// reaches threshold. It reports whether vector was added. vector must be
+// normalized.
+func (ix *Index) Observe(vector []float32, threshold float64) (similarity float64, added bool, err error) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+
+	if ix.hyperplanes == nil {
+		ix.createHyperplanes(len(vector))
+	}
+	if len(vector) != ix.dimensions {
+		return 0, false, fmt.Errorf("embedding has %d dimensions, the index %d", len(vector), ix.dimensions)
+	}
+
+	hashes := make([]uint32, ix.config.Tables)
+	for table := range hashes {
+		hashes[table] = ix.hash(table, vector)
+	}
+
+	// Embeddings sharing buckets in several tables are compared once
+	compared := make(map[int]bool)
+	for table, hash := range hashes {
+		for _, slot := range ix.buckets[table][hash] {
+			if compared[slot] {
+				continue
+			}
+			compared[slot] = true
+			if s := dot(vector, ix.entries[slot].vector); s > similarity {
+				similarity = s
+			}
+		}
+	}
+	if similarity >= threshold {
+		return similarity, false, nil
+	}
+
+	ix.add(indexEntry{vector: append([]float32(nil), vector...), hashes: hashes})
+	return similarity, true, nil
+}
+
+// Len returns the number of embeddings in the index
+func (ix *Index) Len() int {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	return len(ix.entries)
+}
+
+// add adds an entry, replacing the oldest once the index is full. The
+// caller holds the mutex.
+func (ix *Index) add(entry indexEntry) {
+	slot := ix.next
+	if slot < len(ix.entries) {
+		for table, hash := range ix.entries[slot].hashes {
+			ix.buckets[table][hash] = removeSlot(ix.buckets[table][hash], slot)
+			if len(ix.buckets[table][hash]) == 0 {
+				delete(ix.buckets[table], hash)
+			}
+		}
+		ix.entries[slot] = entry
+	} else {
+		ix.entries = append(ix.entries, entry)
+	}
+	for table, hash := range entry.hashes {
+		ix.buckets[table][hash] = append(ix.buckets[table][hash], slot)
+	}
+	ix.next = (slot + 1) % ix.config.Capacity
+}
+
+// createHyperplanes draws the hyperplanes of every table for embeddings of
+// the given dimensions. The caller holds the mutex.
+func (ix *Index) createHyperplanes(dimensions int) {
+	random := rand.New(rand.NewPCG(ix.config.Seed, ix.config.Seed))
+	ix.dimensions = dimensions
+	ix.hyperplanes = make([][]float32, ix.config.Tables*ix.config.Bits)
+	for i := range ix.hyperplanes {
+		plane := make([]float32, dimensions)
+		for j := range plane {
+			plane[j] = float32(random.NormFloat64())
+		}
+		ix.hyperplanes[i] = plane
+	}
+}
+
+// hash returns the bucket of vector in a table, one bit per hyperplane
+// telling on which side of it vector lies
+func (ix *Index) hash(table int, vector []float32) uint32 {
+	var hash uint32
+	for bit := 0; bit < ix.config.Bits; bit++ {
+		if dot(vector, ix.hyperplanes[table*ix.config.Bits+bit]) >= 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+// dot returns the dot product of two vectors of the same dimensions
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// removeSlot removes slot from slots, which holds it once
+func removeSlot(slots []int, slot int) []int {
+	for i, s := range slots {
+		if s == slot {
+			return append(slots[:i], slots[i+1:]...)
+		}
+	}
+	return slots
+}
@@ -0,0 +1,260 @@
+// Package expression implements a CEL based rules engine that is evaluated
+// before model invocation. Rules can set attributes, force a keep or drop
+// sampling decision, or skip models, without compiling a WASM model.
+package expression
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Signal names used to restrict rules to one kind of telemetry
+const (
+	SignalTraces  = "traces"
+	SignalLogs    = "logs"
+	SignalMetrics = "metrics"
+)
+
+// Sampling decisions a rule can force
+const (
+	SamplingKeep = "keep"
+	SamplingDrop = "drop"
+)
+
+// SkipAllModels in a rule's skip list skips every model
+const SkipAllModels = "all"
+
+// Rule is a single rule as written in the configuration
+type Rule struct {
+	// Name identifies the rule in logs and results
+	Name string `mapstructure:"name"`
+
+	// Condition is a CEL expression that must evaluate to a bool
+	Condition string `mapstructure:"condition"`
+
+	// Signals restricts the rule to traces, logs or metrics (all if empty)
+	Signals []string `mapstructure:"signals"`
+
+	// SetAttributes maps attribute keys to CEL expressions for their values
+	SetAttributes map[string]string `mapstructure:"set_attributes"`
+
+	// Sampling forces a "keep" or "drop" decision
+	Sampling string `mapstructure:"sampling"`
+
+	// SkipModels lists the models that are not invoked, or "all"
+	SkipModels []string `mapstructure:"skip_models"`
+}
+
+// Input is the telemetry item the rules are evaluated against. Fields that
+// do not apply to a signal are left empty.
+type Input struct {
+	Signal         string
+	Name           string
+	Kind           string
+	Status         string
+	StatusMessage  string
+	DurationMs     int64
+	Severity       string
+	SeverityNumber int64
+	Body           string
+	Attributes     map[string]interface{}
+	Resource       map[string]interface{}
+}
+
+// Result is the combined outcome of all matching rules
+type Result struct {
+	// Matched lists the names of the rules whose condition was true
+	Matched []string
+
+	// Attributes to set on the telemetry item
+	Attributes map[string]interface{}
+
+	// Sampling is the forced decision of the first matching rule that has one
+	Sampling string
+
+	// SkipModels holds the models that must not be invoked
+	SkipModels map[string]bool
+}
+
+// Skips reports whether the model must not be invoked. Items forced to be
+// dropped skip every model, since their results would be discarded.
+func (r *Result) Skips(model string) bool {
+	return r.Sampling == SamplingDrop || r.SkipModels[model] || r.SkipModels[SkipAllModels]
+}
+
+// compiledRule is a rule with its CEL programs
+type compiledRule struct {
+	rule       Rule
+	signals    map[string]bool
+	condition  cel.Program
+	attributes map[string]cel.Program
+}
+
+// Engine evaluates compiled rules. It is safe for concurrent use.
+type Engine struct {
+	rules []compiledRule
+}
+
+// NewEngine compiles the rules. Rules are evaluated in the given order.
+func NewEngine(rules []Rule) (*Engine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("signal", cel.StringType),
+		cel.Variable("name", cel.StringType),
+		cel.Variable("kind", cel.StringType),
+		cel.Variable("status", cel.StringType),
+		cel.Variable("status_message", cel.StringType),
+		cel.Variable("duration_ms", cel.IntType),
+		cel.Variable("severity", cel.StringType),
+		cel.Variable("severity_number", cel.IntType),
+		cel.Variable("body", cel.StringType),
+		cel.Variable("attributes", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	engine := &Engine{}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule[%d]", i)
+			rule.Name = name
+		}
+
+		if rule.Sampling != "" && rule.Sampling != SamplingKeep && rule.Sampling != SamplingDrop {
+			return nil, fmt.Errorf("rule %s: sampling must be %q or %q", name, SamplingKeep, SamplingDrop)
+		}
+
+		condition, err := compile(env, rule.Condition, cel.BoolType)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid condition: %w", name, err)
+		}
+
+		compiled := compiledRule{
+			rule:       rule,
+			condition:  condition,
+			attributes: make(map[string]cel.Program, len(rule.SetAttributes)),
+		}
+
+		if len(rule.Signals) > 0 {
+			compiled.signals = make(map[string]bool, len(rule.Signals))
+			for _, signal := range rule.Signals {
+				compiled.signals[signal] = true
+			}
+		}
+
+		for key, expr := range rule.SetAttributes {
+			program, err := compile(env, expr, nil)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid expression for attribute %s: %w", name, key, err)
+			}
+			compiled.attributes[key] = program
+		}
+
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	return engine, nil
+}
+
+// Len returns the number of rules
+func (e *Engine) Len() int {
+	return len(e.rules)
+}
+
+// Evaluate runs all rules applicable to the input's signal. Rules that fail
+// to evaluate are treated as not matching; their errors are returned joined
+// alongside the result of the other rules.
+func (e *Engine) Evaluate(input Input) (Result, error) {
+	result := Result{}
+	if len(e.rules) == 0 {
+		return result, nil
+	}
+
+	activation := map[string]interface{}{
+		"signal":          input.Signal,
+		"name":            input.Name,
+		"kind":            input.Kind,
+		"status":          input.Status,
+		"status_message":  input.StatusMessage,
+		"duration_ms":     input.DurationMs,
+		"severity":        input.Severity,
+		"severity_number": input.SeverityNumber,
+		"body":            input.Body,
+		"attributes":      nonNil(input.Attributes),
+		"resource":        nonNil(input.Resource),
+	}
+
+	var errs []error
+	for _, rule := range e.rules {
+		if rule.signals != nil && !rule.signals[input.Signal] {
+			continue
+		}
+
+		matched, _, err := rule.condition.Eval(activation)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.rule.Name, err))
+			continue
+		}
+		if matched.Value() != true {
+			continue
+		}
+
+		result.Matched = append(result.Matched, rule.rule.Name)
+
+		for key, program := range rule.attributes {
+			value, _, err := program.Eval(activation)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rule %s: attribute %s: %w", rule.rule.Name, key, err))
+				continue
+			}
+			if result.Attributes == nil {
+				result.Attributes = make(map[string]interface{})
+			}
+			result.Attributes[key] = value.Value()
+		}
+
+		// The first rule that forces a decision wins
+		if rule.rule.Sampling != "" && result.Sampling == "" {
+			result.Sampling = rule.rule.Sampling
+		}
+
+		for _, model := range rule.rule.SkipModels {
+			if result.SkipModels == nil {
+				result.SkipModels = make(map[string]bool)
+			}
+			result.SkipModels[model] = true
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// compile parses and checks an expression, optionally requiring an output type
+func compile(env *cel.Env, expr string, outputType *cel.Type) (cel.Program, error) {
+	if expr == "" {
+		return nil, errors.New("expression is empty")
+	}
+
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if outputType != nil && !ast.OutputType().IsExactType(outputType) {
+		return nil, fmt.Errorf("expression must evaluate to %s, got %s", outputType, ast.OutputType())
+	}
+
+	return env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+}
+
+// nonNil returns an empty map for nil so map lookups in rules do not fail
+func nonNil(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
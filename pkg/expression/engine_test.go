@@ -0,0 +1,96 @@
+package expression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineEvaluatesRules(t *testing.T) {
+	engine, err := NewEngine([]Rule{
+		{
+			Name:       "drop-health-checks",
+			Condition:  `name == "GET /health" && duration_ms < 10`,
+			Signals:    []string{SignalTraces},
+			Sampling:   SamplingDrop,
+			SkipModels: []string{SkipAllModels},
+		},
+		{
+			Name:          "tag-payments",
+			Condition:     `resource["service.name"] == "payments"`,
+			SetAttributes: map[string]string{"ai.owner": `"team-" + resource["service.name"]`},
+			Sampling:      SamplingKeep,
+		},
+		{
+			Name:      "logs-only",
+			Condition: `severity_number >= 17`,
+			Signals:   []string{SignalLogs},
+			Sampling:  SamplingKeep,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, engine.Len())
+
+	result, err := engine.Evaluate(Input{
+		Signal:     SignalTraces,
+		Name:       "GET /health",
+		DurationMs: 3,
+		Resource:   map[string]interface{}{"service.name": "payments"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"drop-health-checks", "tag-payments"}, result.Matched)
+	assert.Equal(t, SamplingDrop, result.Sampling, "first forced decision wins")
+	assert.Equal(t, "team-payments", result.Attributes["ai.owner"])
+	assert.True(t, result.Skips("error_classifier"))
+}
+
+func TestDroppedItemsSkipModels(t *testing.T) {
+	engine, err := NewEngine([]Rule{{
+		Name:      "drop-fast-ok",
+		Condition: `resource["service.name"] == "checkout" && attributes["http.status_code"] == 200 && duration_ms < 10`,
+		Sampling:  SamplingDrop,
+	}})
+	require.NoError(t, err)
+
+	input := Input{
+		Signal:     SignalTraces,
+		DurationMs: 4,
+		Attributes: map[string]interface{}{"http.status_code": int64(200)},
+		Resource:   map[string]interface{}{"service.name": "checkout"},
+	}
+	result, err := engine.Evaluate(input)
+	require.NoError(t, err)
+	assert.Equal(t, SamplingDrop, result.Sampling)
+	assert.True(t, result.Skips("entity_extractor"), "dropped items skip models without skip_models")
+
+	input.DurationMs = 40
+	result, err = engine.Evaluate(input)
+	require.NoError(t, err)
+	assert.False(t, result.Skips("entity_extractor"))
+}
+
+func TestEngineReportsEvaluationErrors(t *testing.T) {
+	engine, err := NewEngine([]Rule{
+		{Name: "missing-key", Condition: `attributes["http.status_code"] >= 500`, Sampling: SamplingKeep},
+	})
+	require.NoError(t, err)
+
+	// A missing attribute fails evaluation and the rule does not match
+	result, err := engine.Evaluate(Input{Signal: SignalTraces})
+	assert.Error(t, err)
+	assert.Empty(t, result.Matched)
+	assert.False(t, result.Skips("sampler"))
+}
+
+func TestEngineRejectsInvalidRules(t *testing.T) {
+	_, err := NewEngine([]Rule{{Name: "not-bool", Condition: `name`}})
+	assert.ErrorContains(t, err, "must evaluate to bool")
+
+	_, err = NewEngine([]Rule{{Name: "bad-syntax", Condition: `name ==`}})
+	assert.Error(t, err)
+
+	_, err = NewEngine([]Rule{{Name: "bad-sampling", Condition: `true`, Sampling: "maybe"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+// Package logtemplate extracts the templates of log messages. The variable
+// parts of a message, such as numbers, identifiers, addresses and the values
+// of key=value pairs, are replaced by a wildcard, so the messages printed by
+// the same statement share a template, as with Drain-style log parsers.
+package logtemplate
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Wildcard replaces the variable parts of messages
+const Wildcard = "<*>"
+
+// Punctuation kept around masked tokens, e.g. the comma of "id 42,"
+const (
+	leadingPunctuation  = `([{<'"`
+	trailingPunctuation = `)]}>'",;:.!?`
+)
+
+// Template returns the template of message. Tokens holding a digit are
+// variable, and consecutive variable tokens collapse into one wildcard, so
+// lists of varying lengths share a template.
+func Template(message string) string {
+	tokens := make([]string, 0, 16)
+	collapsible := false
+	for _, token := range strings.Fields(message) {
+		// Only the value of key=value pairs varies
+		if i := strings.IndexByte(token, '='); i > 0 {
+			lead, trail, masked := mask(token[i+1:])
+			if masked {
+				token = token[:i+1] + lead + Wildcard + trail
+			}
+			tokens = append(tokens, token)
+			collapsible = false
+			continue
+		}
+
+		lead, trail, masked := mask(token)
+		switch {
+		case !masked:
+			tokens = append(tokens, token)
+		case collapsible:
+			// Extend the previous wildcard, keeping its leading and this
+			// token's trailing punctuation, e.g. "[1, 2, 3]" to "[<*>]"
+			last := tokens[len(tokens)-1]
+			tokens[len(tokens)-1] = last[:strings.Index(last, Wildcard)] + Wildcard + trail
+		default:
+			tokens = append(tokens, lead+Wildcard+trail)
+		}
+		collapsible = masked
+	}
+	return strings.Join(tokens, " ")
+}
+
+// Fingerprint returns a hash of the template of message
+func Fingerprint(message string) uint64 {
+	return Hash(Template(message))
+}
+
+// Hash returns a hash of a template
+func Hash(template string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(template))
+	return hash.Sum64()
+}
+
+// mask splits a token into its leading punctuation, core and trailing
+// punctuation, and reports whether the core is variable
+func mask(token string) (lead string, trail string, masked bool) {
+	start := 0
+	for start < len(token) && strings.IndexByte(leadingPunctuation, token[start]) >= 0 {
+		start++
+	}
+	end := len(token)
+	for end > start && strings.IndexByte(trailingPunctuation, token[end-1]) >= 0 {
+		end--
+	}
+	return token[:start], token[end:], variable(token[start:end])
+}
+
+// variable reports whether a token varies between messages of a template
+func variable(token string) bool {
+	for _, r := range token {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package logtemplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateMasksVariableParts(t *testing.T) {
+	for message, template := range map[string]string{
+		"connection to 10.0.0.12:5432 refused":                   "connection to <*> refused",
+		"user=42 order=ord-9f3a failed, retrying in 5s":          "user=<*> order=<*> failed, retrying in <*>",
+		"timeout after 3000ms (attempt 2/5)":                     "timeout after <*> (attempt <*>)",
+		"payment declined":                                       "payment declined",
+		"request 4bf92f3577b34da6 took 12 ms for tenant=acme":    "request <*> took <*> ms for tenant=acme",
+		"  extra   spaces  ":                                     "extra spaces",
+		"batch [1, 2] rejected":                                  "batch [<*>] rejected",
+		"batch [1, 2, 3] rejected":                               "batch [<*>] rejected",
+		"failed to open /var/data/shard-7.db: permission denied": "failed to open <*>: permission denied",
+	} {
+		assert.Equal(t, template, Template(message), message)
+	}
+}
+
+func TestFingerprintGroupsMessagesOfATemplate(t *testing.T) {
+	assert.Equal(t, Fingerprint("order 17 not found"), Fingerprint("order 90210 not found"))
+	assert.NotEqual(t, Fingerprint("order 17 not found"), Fingerprint("user 17 not found"))
+	assert.Equal(t, Hash(Template("order 17 not found")), Fingerprint("order 17 not found"))
+}
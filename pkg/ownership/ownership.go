@@ -0,0 +1,274 @@
+// Package ownership maps the owners, error categories and services of
+// telemetry to the teams of an organization, read from a team registry:
+//
+//	teams:
+//	  data-platform:
+//	    name: Data Platform
+//	    slack: "#data-platform-oncall"
+//	    pagerduty: PDATA01
+//	owners:
+//	  database-team: data-platform
+//	categories:
+//	  database_timeout: data-platform
+//	services:
+//	  billing-*: payments
+//
+// The owner given by a model is looked up first, then the category, then
+// the service, where a trailing * matches a prefix and the longest prefix
+// wins. The registry is YAML or JSON, read from a file or an HTTP endpoint.
+package ownership
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Team is a team of the organization and where it is reached
+type Team struct {
+	// ID is the key of the team in the registry
+	ID string `yaml:"-"`
+
+	// Name is the display name of the team, its ID if empty
+	Name string `yaml:"name"`
+
+	// Slack is the Slack channel of the team
+	Slack string `yaml:"slack"`
+
+	// PagerDuty is the PagerDuty service paging the team
+	PagerDuty string `yaml:"pagerduty"`
+}
+
+// Registry maps owners, categories and services to teams. It is immutable
+// and safe for concurrent use.
+type Registry struct {
+	teams      map[string]Team
+	owners     map[string]string
+	categories map[string]string
+	services   map[string]string
+	prefixes   []servicePrefix
+}
+
+// servicePrefix maps the services starting with prefix to a team
+type servicePrefix struct {
+	prefix string
+	team   string
+}
+
+// file is the registry document
+type file struct {
+	Teams      map[string]Team   `yaml:"teams"`
+	Owners     map[string]string `yaml:"owners"`
+	Categories map[string]string `yaml:"categories"`
+	Services   map[string]string `yaml:"services"`
+}
+
+// Parse reads a YAML or JSON registry. Every mapping must name a team of
+// the registry.
+func Parse(data []byte) (*Registry, error) {
+	var document file
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse team registry: %w", err)
+	}
+
+	registry := &Registry{
+		teams:      make(map[string]Team, len(document.Teams)),
+		owners:     document.Owners,
+		categories: document.Categories,
+		services:   make(map[string]string),
+	}
+	for id, team := range document.Teams {
+		team.ID = id
+		if team.Name == "" {
+			team.Name = id
+		}
+		registry.teams[id] = team
+	}
+
+	for _, section := range []struct {
+		name     string
+		mappings map[string]string
+	}{
+		{"owners", document.Owners},
+		{"categories", document.Categories},
+		{"services", document.Services},
+	} {
+		for key, team := range section.mappings {
+			if _, ok := registry.teams[team]; !ok {
+				return nil, fmt.Errorf("%s.%s maps to unknown team %q", section.name, key, team)
+			}
+		}
+	}
+
+	for service, team := range document.Services {
+		if prefix, ok := strings.CutSuffix(service, "*"); ok {
+			registry.prefixes = append(registry.prefixes, servicePrefix{prefix: prefix, team: team})
+		} else {
+			registry.services[service] = team
+		}
+	}
+	sort.Slice(registry.prefixes, func(i, j int) bool {
+		return len(registry.prefixes[i].prefix) > len(registry.prefixes[j].prefix)
+	})
+	return registry, nil
+}
+
+// Resolve returns the team of an owner given by a model, an error category
+// and a service, any of which may be empty, in that order of precedence
+func (r *Registry) Resolve(owner, category, service string) (Team, bool) {
+	if id, ok := r.owners[owner]; ok && owner != "" {
+		return r.teams[id], true
+	}
+	if id, ok := r.categories[category]; ok && category != "" {
+		return r.teams[id], true
+	}
+	if service == "" {
+		return Team{}, false
+	}
+	if id, ok := r.services[service]; ok {
+		return r.teams[id], true
+	}
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(service, prefix.prefix) {
+			return r.teams[prefix.team], true
+		}
+	}
+	return Team{}, false
+}
+
+// Teams returns the number of teams in the registry
+func (r *Registry) Teams() int {
+	return len(r.teams)
+}
+
+// Config defines where the registry is read from and how often
+type Config struct {
+	// Path is the registry file, read when Endpoint is empty
+	Path string
+
+	// Endpoint is the URL the registry is fetched from
+	Endpoint string
+
+	// Headers are added to every request, e.g. for authorization
+	Headers map[string]string
+
+	// Timeout bounds each HTTP request
+	Timeout time.Duration
+
+	// RefreshInterval is how often the registry is read again (0 to read it
+	// once)
+	RefreshInterval time.Duration
+}
+
+// Source holds the latest registry read and reads it again periodically.
+// A registry that fails to read or parse keeps the previous one in use.
+type Source struct {
+	logger     *zap.Logger
+	config     Config
+	httpClient *http.Client
+	registry   atomic.Pointer[Registry]
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+// Open reads the registry and starts refreshing it
+func Open(logger *zap.Logger, config Config) (*Source, error) {
+	if config.Path == "" && config.Endpoint == "" {
+		return nil, fmt.Errorf("team registry path or endpoint must be set")
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	source := &Source{
+		logger:     logger,
+		config:     config,
+		httpClient: &http.Client{Timeout: timeout},
+		stop:       make(chan struct{}),
+	}
+	registry, err := source.read(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	source.registry.Store(registry)
+
+	if config.RefreshInterval > 0 {
+		source.done.Add(1)
+		go source.refresh()
+	}
+	return source, nil
+}
+
+// Registry returns the latest registry read
+func (s *Source) Registry() *Registry {
+	return s.registry.Load()
+}
+
+// Close stops refreshing the registry
+func (s *Source) Close() {
+	close(s.stop)
+	s.done.Wait()
+}
+
+// refresh reads the registry at every interval until the source is closed
+func (s *Source) refresh() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			registry, err := s.read(context.Background())
+			if err != nil {
+				s.logger.Warn("Failed to refresh team registry, keeping the previous one", zap.Error(err))
+				continue
+			}
+			s.registry.Store(registry)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// read reads and parses the registry
+func (s *Source) read(ctx context.Context) (*Registry, error) {
+	if s.config.Endpoint == "" {
+		data, err := os.ReadFile(s.config.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read team registry: %w", err)
+		}
+		return Parse(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.Endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid team registry endpoint: %w", err)
+	}
+	for key, value := range s.config.Headers {
+		request.Header.Set(key, value)
+	}
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch team registry: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch team registry: %s", response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch team registry: %w", err)
+	}
+	return Parse(data)
+}
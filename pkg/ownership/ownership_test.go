@@ -0,0 +1,97 @@
+package ownership
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testRegistry = `
+teams:
+  data-platform:
+    name: Data Platform
+    slack: "#data-platform-oncall"
+    pagerduty: PDATA01
+  payments:
+    slack: "#payments"
+  checkout:
+    pagerduty: PCHK02
+owners:
+  database-team: data-platform
+categories:
+  payment_failure: payments
+services:
+  checkout: checkout
+  billing-*: payments
+  billing-ledger*: data-platform
+`
+
+func TestRegistryResolvesOwnersCategoriesAndServices(t *testing.T) {
+	registry, err := Parse([]byte(testRegistry))
+	require.NoError(t, err)
+	assert.Equal(t, 3, registry.Teams())
+
+	// The owner given by the model takes precedence
+	team, ok := registry.Resolve("database-team", "payment_failure", "checkout")
+	require.True(t, ok)
+	assert.Equal(t, Team{ID: "data-platform", Name: "Data Platform", Slack: "#data-platform-oncall", PagerDuty: "PDATA01"}, team)
+
+	team, ok = registry.Resolve("unknown-team", "payment_failure", "checkout")
+	require.True(t, ok)
+	assert.Equal(t, Team{ID: "payments", Name: "payments", Slack: "#payments"}, team)
+
+	team, ok = registry.Resolve("", "", "checkout")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", team.ID)
+
+	// The longest prefix wins
+	team, _ = registry.Resolve("", "", "billing-api")
+	assert.Equal(t, "payments", team.ID)
+	team, _ = registry.Resolve("", "", "billing-ledger-writer")
+	assert.Equal(t, "data-platform", team.ID)
+
+	_, ok = registry.Resolve("", "timeout", "frontend")
+	assert.False(t, ok)
+
+	_, err = Parse([]byte("teams: {a: {}}\ncategories: {timeout: b}"))
+	assert.ErrorContains(t, err, `categories.timeout maps to unknown team "b"`)
+}
+
+func TestSourceRefreshesFromEndpoint(t *testing.T) {
+	var body atomic.Value
+	body.Store(testRegistry)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+
+	source, err := Open(zap.NewNop(), Config{
+		Endpoint:        server.URL,
+		Headers:         map[string]string{"Authorization": "Bearer token"},
+		RefreshInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer source.Close()
+	assert.Equal(t, 3, source.Registry().Teams())
+
+	// Invalid registries keep the previous one
+	body.Store("teams: [")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 3, source.Registry().Teams())
+
+	body.Store(`{"teams": {"payments": {}}, "services": {"checkout": "payments"}}`)
+	assert.Eventually(t, func() bool { return source.Registry().Teams() == 1 }, time.Second, 10*time.Millisecond)
+	team, ok := source.Registry().Resolve("", "", "checkout")
+	assert.True(t, ok)
+	assert.Equal(t, "payments", team.Name)
+
+	_, err = Open(zap.NewNop(), Config{Path: "/nonexistent/teams.yaml"})
+	assert.ErrorContains(t, err, "failed to read team registry")
+}
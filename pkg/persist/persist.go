@@ -0,0 +1,83 @@
+// Package persist stores snapshots of in-memory caches in a local BoltDB
+// file, so they survive restarts. Each cache is a bucket of keys and values
+// replaced as a whole by every snapshot; caches are read from their bucket
+// once when they are restored.
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout bounds the wait for the lock of a file held by another
+// process
+const openTimeout = time.Second
+
+// Store is a file of cache snapshots. It is safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store at path, creating it and its directory if needed.
+// A file can only be opened by one store at a time.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory of %s: %w", path, err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Save replaces the contents of bucket with the entries next returns, until
+// it returns a nil key. The entries are written in one transaction, so a
+// snapshot is never partly written.
+func (s *Store) Save(bucket string, next func() (key []byte, value []byte)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(bucket)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		b, err := tx.CreateBucket([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		// Snapshots are written in key order by few writers
+		b.FillPercent = 0.9
+		for {
+			key, value := next()
+			if key == nil {
+				return nil
+			}
+			if err := b.Put(key, value); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// Load calls fn with the entries of bucket in key order. Keys and values
+// are only valid during the call. A missing bucket has no entries.
+func (s *Store) Load(bucket string, fn func(key []byte, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(fn)
+	})
+}
+
+// Close closes the file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,49 @@
+package persist
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreReplacesSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "caches.db")
+	store, err := Open(path)
+	require.NoError(t, err)
+
+	save := func(entries ...string) {
+		i := 0
+		require.NoError(t, store.Save("cache", func() ([]byte, []byte) {
+			if i == len(entries) {
+				return nil, nil
+			}
+			i++
+			return []byte(entries[i-1]), []byte("value of " + entries[i-1])
+		}))
+	}
+	load := func() map[string]string {
+		loaded := make(map[string]string)
+		require.NoError(t, store.Load("cache", func(key, value []byte) error {
+			loaded[string(key)] = string(value)
+			return nil
+		}))
+		return loaded
+	}
+
+	save("a", "b")
+	save("c")
+	assert.Equal(t, map[string]string{"c": "value of c"}, load())
+
+	// Snapshots survive reopening, missing buckets are empty
+	require.NoError(t, store.Close())
+	store, err = Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+	assert.Equal(t, map[string]string{"c": "value of c"}, load())
+	require.NoError(t, store.Load("missing", func(key, value []byte) error {
+		t.Fatalf("unexpected entry %s", key)
+		return nil
+	}))
+}
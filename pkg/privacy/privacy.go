@@ -0,0 +1,79 @@
+// Package privacy protects aggregate values, such as error-rate metrics and
+// service topology counts, before they are shared across tenants. It adds
+// Laplace noise for epsilon-differential privacy and suppresses counts below
+// a k-anonymity threshold.
+package privacy
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+// Config defines the privacy guarantees
+type Config struct {
+	// Epsilon is the privacy budget per released value. Smaller values add
+	// more noise. Zero disables noise.
+	Epsilon float64
+
+	// Sensitivity is the largest change a single individual can make to a
+	// value, 1 for counts
+	Sensitivity float64
+
+	// MinCount is the k-anonymity threshold: counts below it are suppressed.
+	// Zero disables suppression.
+	MinCount float64
+}
+
+// Mechanism applies noise and suppression. It is safe for concurrent use.
+type Mechanism struct {
+	config Config
+
+	// uniform returns a value in [0, 1), replaceable in tests
+	uniform func() float64
+}
+
+// New creates a mechanism for config
+func New(config Config) (*Mechanism, error) {
+	if config.Epsilon < 0 {
+		return nil, errors.New("epsilon must not be negative")
+	}
+	if config.MinCount < 0 {
+		return nil, errors.New("minimum count must not be negative")
+	}
+	if config.Sensitivity <= 0 {
+		config.Sensitivity = 1
+	}
+
+	return &Mechanism{
+		config:  config,
+		uniform: rand.Float64,
+	}, nil
+}
+
+// Noise returns value with Laplace noise scaled to sensitivity/epsilon
+func (m *Mechanism) Noise(value float64) float64 {
+	if m.config.Epsilon == 0 {
+		return value
+	}
+
+	// Inverse CDF of the Laplace distribution for u uniform in (-0.5, 0.5)
+	scale := m.config.Sensitivity / m.config.Epsilon
+	u := m.uniform() - 0.5
+	if u == -0.5 {
+		u = 0
+	}
+	return value - scale*math.Copysign(1, u)*math.Log(1-2*math.Abs(u))
+}
+
+// NoisyCount returns count with noise, rounded and never negative
+func (m *Mechanism) NoisyCount(count float64) float64 {
+	return math.Max(0, math.Round(m.Noise(count)))
+}
+
+// Suppressed reports whether a count is below the k-anonymity threshold.
+// It must be given the noisy count, since suppressing by the true count
+// reveals whether it is below the threshold.
+func (m *Mechanism) Suppressed(count float64) bool {
+	return count < m.config.MinCount
+}
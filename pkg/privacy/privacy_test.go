@@ -0,0 +1,54 @@
+package privacy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoiseFollowsLaplaceScale(t *testing.T) {
+	m, err := New(Config{Epsilon: 0.5, Sensitivity: 1})
+	require.NoError(t, err)
+
+	// The mean absolute deviation of Laplace(b) is b = sensitivity / epsilon
+	const n = 200000
+	var sum, deviation float64
+	for i := 0; i < n; i++ {
+		noisy := m.Noise(100)
+		sum += noisy
+		deviation += math.Abs(noisy - 100)
+	}
+	assert.InDelta(t, 100, sum/n, 0.1)
+	assert.InDelta(t, 2, deviation/n, 0.05)
+}
+
+func TestNoiseDisabled(t *testing.T) {
+	m, err := New(Config{MinCount: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 42.0, m.Noise(42))
+	assert.Equal(t, 42.0, m.NoisyCount(42))
+}
+
+func TestNoisyCountIsNonNegativeInteger(t *testing.T) {
+	m, err := New(Config{Epsilon: 0.1})
+	require.NoError(t, err)
+	m.uniform = func() float64 { return 0.001 }
+
+	assert.Equal(t, 0.0, m.NoisyCount(3))
+	m.uniform = func() float64 { return 0.9 }
+	count := m.NoisyCount(3)
+	assert.Equal(t, math.Round(count), count)
+	assert.Greater(t, count, 3.0)
+}
+
+func TestSuppressed(t *testing.T) {
+	m, err := New(Config{MinCount: 10})
+	require.NoError(t, err)
+	assert.True(t, m.Suppressed(9))
+	assert.False(t, m.Suppressed(10))
+
+	_, err = New(Config{Epsilon: -1})
+	assert.Error(t, err)
+}
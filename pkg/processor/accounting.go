@@ -0,0 +1,326 @@
+// This file contains the accounting of the telemetry kept and dropped by
+// smart sampling per service
+
+package processor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+)
+
+// Services items are accounted to besides those named by their resource
+const (
+	// accountingUnknownService accounts the items of resources without a
+	// service.name, as the OpenTelemetry SDKs name such services
+	accountingUnknownService = "unknown_service"
+
+	// accountingOtherService accounts the items of the services beyond
+	// max_services
+	accountingOtherService = "_other"
+)
+
+// volume is the telemetry kept and dropped, in items and in bytes of their
+// OTLP protobuf encoding
+type volume struct {
+	keptItems    int64
+	keptBytes    int64
+	droppedItems int64
+	droppedBytes int64
+}
+
+// add adds the volume of other
+func (v *volume) add(other *volume) {
+	v.keptItems += other.keptItems
+	v.keptBytes += other.keptBytes
+	v.droppedItems += other.droppedItems
+	v.droppedBytes += other.droppedBytes
+}
+
+// sub returns the volume added since previous
+func (v volume) sub(previous volume) volume {
+	return volume{
+		keptItems:    v.keptItems - previous.keptItems,
+		keptBytes:    v.keptBytes - previous.keptBytes,
+		droppedItems: v.droppedItems - previous.droppedItems,
+		droppedBytes: v.droppedBytes - previous.droppedBytes,
+	}
+}
+
+// reduction returns the share (0.0-1.0) of the bytes that were dropped
+func (v *volume) reduction() float64 {
+	total := v.keptBytes + v.droppedBytes
+	if total == 0 {
+		return 0
+	}
+	return float64(v.droppedBytes) / float64(total)
+}
+
+// volumeMap returns the volume keyed by the names of its metric and stats
+func (v *volume) volumeMap() map[string]interface{} {
+	return map[string]interface{}{
+		"kept_items":    v.keptItems,
+		"kept_bytes":    v.keptBytes,
+		"dropped_items": v.droppedItems,
+		"dropped_bytes": v.droppedBytes,
+		"reduction":     v.reduction(),
+	}
+}
+
+// accountingKey identifies the volume of a service's signal
+type accountingKey struct {
+	signal  string
+	service string
+}
+
+// costAccounting totals the volume kept and dropped by smart sampling per
+// signal and service, so teams can see what sampling saves them. Batches
+// tally their items and add the tally once, and the totals are reported as
+// metrics, by the control plane and, periodically, in a summary log.
+type costAccounting struct {
+	logger      *zap.Logger
+	maxServices int
+	interval    time.Duration
+
+	mutex    sync.Mutex
+	volumes  map[accountingKey]*volume
+	services map[string]bool
+
+	// Totals at the previous summary, which reports the volume since
+	reported map[accountingKey]volume
+
+	// The loop logging the summaries
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// newCostAccounting creates the accounting for config, nil unless enabled
+func newCostAccounting(logger *zap.Logger, config *AccountingConfig) *costAccounting {
+	if !config.Enabled {
+		return nil
+	}
+	return &costAccounting{
+		logger:      logger,
+		maxServices: config.MaxServices,
+		interval:    time.Duration(config.ReportIntervalMs) * time.Millisecond,
+		volumes:     make(map[accountingKey]*volume),
+		services:    make(map[string]bool),
+		reported:    make(map[accountingKey]volume),
+	}
+}
+
+// volumeTally is the volume of a batch per service, nil if accounting is
+// disabled
+type volumeTally map[string]*volume
+
+// tally returns an empty tally for a batch, nil if accounting is disabled
+func (a *costAccounting) tally() volumeTally {
+	if a == nil {
+		return nil
+	}
+	return make(volumeTally)
+}
+
+// addSpan tallies a span of service kept or dropped
+func (t volumeTally) addSpan(service string, span ptrace.Span, kept bool) {
+	if t == nil {
+		return
+	}
+	t.add(service, (&ptrace.ProtoMarshaler{}).SpanSize(span), kept)
+}
+
+// addSpans tallies the spans of td kept or dropped
+func (t volumeTally) addSpans(td ptrace.Traces, kept bool) {
+	if t == nil {
+		return
+	}
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		service := accountingService(rss.At(i).Resource())
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				t.addSpan(service, spans.At(k), kept)
+			}
+		}
+	}
+}
+
+// addLog tallies a log record of service kept or dropped
+func (t volumeTally) addLog(service string, log plog.LogRecord, kept bool) {
+	if t == nil {
+		return
+	}
+	t.add(service, (&plog.ProtoMarshaler{}).LogRecordSize(log), kept)
+}
+
+// add tallies an item of the given size
+func (t volumeTally) add(service string, bytes int, kept bool) {
+	v := t[service]
+	if v == nil {
+		v = &volume{}
+		t[service] = v
+	}
+	if kept {
+		v.keptItems++
+		v.keptBytes += int64(bytes)
+	} else {
+		v.droppedItems++
+		v.droppedBytes += int64(bytes)
+	}
+}
+
+// record adds the tally of a batch of signal to the totals. Services beyond
+// maxServices are accounted together, the new services of a batch taking
+// the remaining slots in name order.
+func (a *costAccounting) record(signal string, tally volumeTally) {
+	if a == nil || len(tally) == 0 {
+		return
+	}
+	services := make([]string, 0, len(tally))
+	for service := range tally {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, service := range services {
+		batch := tally[service]
+		if !a.services[service] {
+			if a.maxServices > 0 && len(a.services) >= a.maxServices {
+				service = accountingOtherService
+			} else {
+				a.services[service] = true
+			}
+		}
+		key := accountingKey{signal: signal, service: service}
+		total := a.volumes[key]
+		if total == nil {
+			total = &volume{}
+			a.volumes[key] = total
+		}
+		total.add(batch)
+	}
+}
+
+// each calls fn with the totals of every signal and service
+func (a *costAccounting) each(fn func(signal string, service string, total volume)) {
+	if a == nil {
+		return
+	}
+	a.mutex.Lock()
+	totals := make(map[accountingKey]volume, len(a.volumes))
+	for key, total := range a.volumes {
+		totals[key] = *total
+	}
+	a.mutex.Unlock()
+
+	for key, total := range totals {
+		fn(key.signal, key.service, total)
+	}
+}
+
+// stats returns the totals per signal and service
+func (a *costAccounting) stats() map[string]interface{} {
+	stats := make(map[string]interface{})
+	a.each(func(signal string, service string, total volume) {
+		services, ok := stats[signal].(map[string]interface{})
+		if !ok {
+			services = make(map[string]interface{})
+			stats[signal] = services
+		}
+		services[service] = total.volumeMap()
+	})
+	return stats
+}
+
+// start logs a summary every interval, if one is configured, until
+// stopped
+func (a *costAccounting) start() {
+	if a == nil || a.interval <= 0 || a.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	a.stop = stop
+	a.done.Add(1)
+	go func() {
+		defer a.done.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.report()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// shutdown stops logging summaries
+func (a *costAccounting) shutdown() {
+	if a == nil || a.stop == nil {
+		return
+	}
+	close(a.stop)
+	a.done.Wait()
+	a.stop = nil
+}
+
+// report logs the volume of each signal and service since the previous
+// summary, the services dropping the most bytes first
+func (a *costAccounting) report() {
+	type serviceSummary struct {
+		key    accountingKey
+		volume volume
+	}
+	var summaries []serviceSummary
+	a.each(func(signal string, service string, total volume) {
+		key := accountingKey{signal: signal, service: service}
+		a.mutex.Lock()
+		since := total.sub(a.reported[key])
+		a.reported[key] = total
+		a.mutex.Unlock()
+		if since.keptItems+since.droppedItems > 0 {
+			summaries = append(summaries, serviceSummary{key: key, volume: since})
+		}
+	})
+	if len(summaries) == 0 {
+		return
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].volume.droppedBytes > summaries[j].volume.droppedBytes
+	})
+
+	var all volume
+	services := make([]map[string]interface{}, len(summaries))
+	for i, summary := range summaries {
+		all.add(&summary.volume)
+		services[i] = summary.volume.volumeMap()
+		services[i]["signal"] = summary.key.signal
+		services[i]["service"] = summary.key.service
+	}
+	a.logger.Info("Sampling volume by service",
+		zap.Duration("interval", a.interval),
+		zap.Int64("kept_bytes", all.keptBytes),
+		zap.Int64("dropped_bytes", all.droppedBytes),
+		zap.Float64("reduction", all.reduction()),
+		zap.Any("services", services))
+}
+
+// accountingService returns the service the items of a resource are
+// accounted to
+func accountingService(resource pcommon.Resource) string {
+	if service, ok := resource.Attributes().Get("service.name"); ok && service.AsString() != "" {
+		return service.AsString()
+	}
+	return accountingUnknownService
+}
@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+)
+
+func TestCostAccountingTotalsVolumePerService(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	assert.Nil(t, newCostAccounting(zap.NewNop(), &config.Accounting))
+	assert.Nil(t, (*costAccounting)(nil).tally())
+
+	config.Accounting.Enabled = true
+	config.Accounting.MaxServices = 2
+	accounting := newCostAccounting(zap.NewNop(), &config.Accounting)
+	require.NotNil(t, accounting)
+
+	td := ptrace.NewTraces()
+	for _, service := range []string{"checkout", "payments", "search", ""} {
+		rs := td.ResourceSpans().AppendEmpty()
+		if service != "" {
+			rs.Resource().Attributes().PutStr("service.name", service)
+		}
+		span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetName("GET /" + service)
+	}
+	size := (&ptrace.ProtoMarshaler{}).SpanSize(td.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0))
+
+	tally := accounting.tally()
+	tally.addSpans(td, false)
+	tally.addSpan("checkout", td.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0), true)
+	accounting.record(signalTraces, tally)
+
+	stats := accounting.stats()[signalTraces].(map[string]interface{})
+	checkout := stats["checkout"].(map[string]interface{})
+	assert.Equal(t, int64(1), checkout["kept_items"])
+	assert.Equal(t, int64(size), checkout["kept_bytes"])
+	assert.Equal(t, int64(1), checkout["dropped_items"])
+	assert.Equal(t, 0.5, checkout["reduction"])
+
+	// Services beyond max_services are accounted together
+	assert.Len(t, stats, 3)
+	other := stats[accountingOtherService].(map[string]interface{})
+	assert.Equal(t, int64(2), other["dropped_items"])
+}
@@ -0,0 +1,198 @@
+// This file contains the controller adapting the normal spans rate to a
+// throughput budget
+
+package processor
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// rateWindowBuckets is the number of buckets of the sliding window the
+// throughput is measured over. The rate is adjusted once per bucket.
+const rateWindowBuckets = 10
+
+// rateController adjusts the rate of normal spans so the spans passed to
+// the next consumer stay within a budget of spans or bytes per second. It
+// measures the throughput over a sliding window and, every window bucket,
+// moves the rate by the ratio of the target to the throughput, damped so a
+// whole window passes before a deviation is fully corrected.
+type rateController struct {
+	targetSpans float64
+	targetBytes float64
+	minRate     float64
+	maxRate     float64
+	bucket      time.Duration
+
+	mutex sync.Mutex
+	rate  float64
+
+	// Spans and bytes passed on in each bucket of the window, current
+	// being the bucket started at currentStart
+	spans        [rateWindowBuckets]int64
+	bytes        [rateWindowBuckets]int64
+	current      int
+	currentStart time.Time
+
+	// filled counts the buckets of the window measured since the
+	// controller started, up to rateWindowBuckets
+	filled int
+}
+
+// newRateController creates the controller for config, starting at rate,
+// nil unless adaptive sampling is enabled
+func newRateController(config *AdaptiveSamplingConfig, rate float64, now time.Time) *rateController {
+	if !config.Enabled {
+		return nil
+	}
+	c := &rateController{
+		targetSpans:  config.TargetSpansPerSecond,
+		targetBytes:  config.TargetBytesPerSecond,
+		minRate:      config.MinRate,
+		maxRate:      config.MaxRate,
+		bucket:       time.Duration(config.WindowMs) * time.Millisecond / rateWindowBuckets,
+		currentStart: now,
+	}
+	c.rate = c.clamp(rate)
+	return c
+}
+
+// measuresBytes reports whether the controller needs the size of the spans
+// passed on
+func (c *rateController) measuresBytes() bool {
+	return c != nil && c.targetBytes > 0
+}
+
+// observe records spans of the given size passed on at now
+func (c *rateController) observe(spans int, bytes int, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.advance(now)
+	c.spans[c.current] += int64(spans)
+	c.bytes[c.current] += int64(bytes)
+}
+
+// normalRate returns the rate of normal spans at now, configured being the
+// rate used without a controller
+func (c *rateController) normalRate(configured float64, now time.Time) float64 {
+	if c == nil {
+		return configured
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.advance(now)
+	return c.rate
+}
+
+// reset sets the rate, as the controller had started from it
+func (c *rateController) reset(rate float64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rate = c.clamp(rate)
+}
+
+// advance moves the window to now, adjusting the rate at the end of every
+// bucket. The caller holds the mutex.
+func (c *rateController) advance(now time.Time) {
+	for now.Sub(c.currentStart) >= c.bucket {
+		if c.filled < rateWindowBuckets {
+			c.filled++
+		}
+		c.adjust()
+		c.current = (c.current + 1) % rateWindowBuckets
+		c.currentStart = c.currentStart.Add(c.bucket)
+		c.spans[c.current], c.bytes[c.current] = 0, 0
+
+		// Skip the buckets of a long idle period at once
+		if now.Sub(c.currentStart) > c.bucket*rateWindowBuckets {
+			c.currentStart = now.Add(-c.bucket * rateWindowBuckets)
+		}
+	}
+}
+
+// adjust moves the rate towards the target by the throughput of the
+// filled buckets. The caller holds the mutex.
+func (c *rateController) adjust() {
+	spansPerSecond, bytesPerSecond := c.throughput()
+
+	// The budget closest to being exceeded decides
+	ratio := math.Inf(1)
+	if c.targetSpans > 0 {
+		ratio = math.Min(ratio, budgetRatio(c.targetSpans, spansPerSecond))
+	}
+	if c.targetBytes > 0 {
+		ratio = math.Min(ratio, budgetRatio(c.targetBytes, bytesPerSecond))
+	}
+	if math.IsInf(ratio, 1) {
+		return
+	}
+	c.rate = c.clamp(c.rate * math.Pow(ratio, 1.0/rateWindowBuckets))
+}
+
+// throughput returns the spans and bytes per second passed on over the
+// filled buckets of the window. The caller holds the mutex.
+func (c *rateController) throughput() (spansPerSecond float64, bytesPerSecond float64) {
+	if c.filled == 0 {
+		return 0, 0
+	}
+	var spans, bytes int64
+	for i := 0; i < c.filled; i++ {
+		bucket := (c.current - i + rateWindowBuckets) % rateWindowBuckets
+		spans += c.spans[bucket]
+		bytes += c.bytes[bucket]
+	}
+	seconds := (c.bucket * time.Duration(c.filled)).Seconds()
+	return float64(spans) / seconds, float64(bytes) / seconds
+}
+
+// clamp bounds rate to the configured range
+func (c *rateController) clamp(rate float64) float64 {
+	return math.Max(c.minRate, math.Min(c.maxRate, rate))
+}
+
+// stats returns the current rate and throughput
+func (c *rateController) stats() map[string]interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	spansPerSecond, bytesPerSecond := c.throughput()
+	return map[string]interface{}{
+		"normal_spans":     c.rate,
+		"spans_per_second": spansPerSecond,
+		"bytes_per_second": bytesPerSecond,
+	}
+}
+
+// observeSpans records the spans of td passed to the next consumer, for
+// the controller of the normal spans rate
+func (s *controlState) observeSpans(td ptrace.Traces) {
+	if s.adaptive == nil {
+		return
+	}
+	spans := td.SpanCount()
+	if spans == 0 {
+		return
+	}
+	var size int
+	if s.adaptive.measuresBytes() {
+		size = (&ptrace.ProtoMarshaler{}).TracesSize(td)
+	}
+	s.adaptive.observe(spans, size, time.Now())
+}
+
+// budgetRatio returns the factor the throughput must change by to reach
+// the target, at most 10 so an idle window doesn't make it infinite
+func budgetRatio(target float64, throughput float64) float64 {
+	if throughput <= 0 {
+		return 10
+	}
+	return math.Min(target/throughput, 10)
+}
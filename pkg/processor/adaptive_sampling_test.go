@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateControllerTracksThroughputTarget(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	adaptive := &config.Sampling.Adaptive
+	assert.Nil(t, newRateController(adaptive, 0.1, time.Now()))
+	adaptive.Enabled = true
+	adaptive.TargetSpansPerSecond = 100
+	require.NoError(t, config.Validate())
+
+	start := time.Unix(0, 0)
+	controller := newRateController(adaptive, 0.5, start)
+	require.NotNil(t, controller)
+
+	// Simulate 10000 spans per second offered, of which the rate keeps its
+	// share, until the rate settles
+	offered := 10000.0
+	now := start
+	for i := 0; i < 600; i++ {
+		now = now.Add(100 * time.Millisecond)
+		rate := controller.normalRate(config.Sampling.NormalSpans, now)
+		controller.observe(int(offered*rate/10), 0, now)
+	}
+	assert.InDelta(t, 0.01, controller.normalRate(0, now), 0.002)
+	spansPerSecond := controller.stats()["spans_per_second"].(float64)
+	assert.InDelta(t, 100, spansPerSecond, 20)
+
+	// The rate recovers once traffic drops, up to its maximum
+	offered = 50
+	for i := 0; i < 600; i++ {
+		now = now.Add(100 * time.Millisecond)
+		rate := controller.normalRate(config.Sampling.NormalSpans, now)
+		controller.observe(int(offered*rate/10), 0, now)
+	}
+	assert.Equal(t, adaptive.MaxRate, controller.normalRate(0, now))
+
+	// Without a controller the configured rate applies
+	var disabled *rateController
+	assert.Equal(t, 0.1, disabled.normalRate(0.1, now))
+}
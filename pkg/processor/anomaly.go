@@ -0,0 +1,154 @@
+// This file contains the anomaly detection of metric data points, shared by
+// the stub and fullwasm metrics processors
+
+package processor
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/anomaly"
+)
+
+// Attributes written on anomalous data points, under the output namespace
+const (
+	anomalyScoreAttribute     = "anomaly.score"
+	anomalyDirectionAttribute = "anomaly.direction"
+)
+
+// anomalyDetector annotates the gauge, sum and histogram data points
+// deviating from the baseline of their metric and attributes
+type anomalyDetector struct {
+	detector *anomaly.Detector
+	metrics  []string
+
+	// quantile is the quantile histograms are scored by
+	quantile float64
+}
+
+// newAnomalyDetector creates the detector for config. It is created whether
+// or not features.anomaly_detection is enabled, since the control plane can
+// enable it.
+func newAnomalyDetector(config *AnomalyDetectionConfig) (*anomalyDetector, error) {
+	detector, err := anomaly.New(anomaly.Config{
+		Alpha:         config.Alpha,
+		Threshold:     config.Threshold,
+		MinSamples:    config.MinSamples,
+		MaxSeries:     config.MaxSeries,
+		Season:        time.Duration(config.SeasonMs) * time.Millisecond,
+		SeasonBuckets: config.SeasonBuckets,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &anomalyDetector{detector: detector, metrics: config.Metrics, quantile: config.HistogramQuantile}, nil
+}
+
+// annotate scores the data points of md and sets the score and direction of
+// the anomalous ones. Cumulative sums are scored by their increase, and
+// histograms by a quantile of their buckets, of the increase of the buckets
+// for cumulative ones.
+func (d *anomalyDetector) annotate(md pmetric.Metrics, namespace string) {
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		resource := calculateResourceHash(rms.At(i).Resource())
+		sms := rms.At(i).ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			metrics := sms.At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				metric := metrics.At(k)
+				if len(d.metrics) > 0 && !metricNameMatches(d.metrics, metric.Name()) {
+					continue
+				}
+
+				var dps pmetric.NumberDataPointSlice
+				cumulative := false
+				switch metric.Type() {
+				case pmetric.MetricTypeGauge:
+					dps = metric.Gauge().DataPoints()
+				case pmetric.MetricTypeSum:
+					dps = metric.Sum().DataPoints()
+					cumulative = metric.Sum().AggregationTemporality() == pmetric.AggregationTemporalityCumulative
+				case pmetric.MetricTypeHistogram:
+					histogram := metric.Histogram()
+					cumulative = histogram.AggregationTemporality() == pmetric.AggregationTemporalityCumulative
+					for l := 0; l < histogram.DataPoints().Len(); l++ {
+						dp := histogram.DataPoints().At(l)
+						key := seriesKey(resource, metric.Name(), dp.Attributes())
+						result := d.observeBuckets(key, explicitBuckets(dp), cumulative, dp.Timestamp().AsTime())
+						annotateAnomaly(dp.Attributes(), result, namespace)
+					}
+					continue
+				case pmetric.MetricTypeExponentialHistogram:
+					histogram := metric.ExponentialHistogram()
+					cumulative = histogram.AggregationTemporality() == pmetric.AggregationTemporalityCumulative
+					for l := 0; l < histogram.DataPoints().Len(); l++ {
+						dp := histogram.DataPoints().At(l)
+						key := seriesKey(resource, metric.Name(), dp.Attributes())
+						result := d.observeBuckets(key, exponentialBuckets(dp), cumulative, dp.Timestamp().AsTime())
+						annotateAnomaly(dp.Attributes(), result, namespace)
+					}
+					continue
+				default:
+					continue
+				}
+
+				for l := 0; l < dps.Len(); l++ {
+					dp := dps.At(l)
+					key := seriesKey(resource, metric.Name(), dp.Attributes())
+					var result anomaly.Result
+					if cumulative {
+						result = d.detector.ObserveCumulative(key, numberValue(dp), dp.Timestamp().AsTime())
+					} else {
+						result = d.detector.Observe(key, numberValue(dp), dp.Timestamp().AsTime())
+					}
+					annotateAnomaly(dp.Attributes(), result, namespace)
+				}
+			}
+		}
+	}
+}
+
+// observeBuckets scores the quantile of a histogram data point's buckets,
+// or of their increase since the previous data point if it is cumulative
+func (d *anomalyDetector) observeBuckets(key uint64, buckets []histogramBucket, cumulative bool, at time.Time) anomaly.Result {
+	if len(buckets) == 0 {
+		return anomaly.Result{}
+	}
+	if cumulative {
+		return d.detector.ObserveCumulativeCounts(key, bucketLayout(buckets), bucketCounts(buckets), at,
+			func(increase []uint64) (float64, bool) {
+				return bucketQuantile(withCounts(buckets, increase), d.quantile)
+			})
+	}
+	value, ok := bucketQuantile(buckets, d.quantile)
+	if !ok {
+		return anomaly.Result{}
+	}
+	return d.detector.Observe(key, value, at)
+}
+
+// annotateAnomaly sets the score and direction of an anomalous data point
+func annotateAnomaly(attributes pcommon.Map, result anomaly.Result, namespace string) {
+	if result.Anomalous {
+		attributes.PutDouble(namespace+anomalyScoreAttribute, result.Score)
+		attributes.PutStr(namespace+anomalyDirectionAttribute, result.Direction)
+	}
+}
+
+// seriesKey identifies the series of a data point by its resource, metric
+// and attributes
+func seriesKey(resource uint64, name string, attributes pcommon.Map) uint64 {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], resource)
+	binary.LittleEndian.PutUint64(buf[8:], calculateAttributeMapHash(attributes))
+
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	hash.Write(buf[:])
+	return hash.Sum64()
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestAnomalyDetectorAnnotatesDeviatingDataPoints(t *testing.T) {
+	config := createDefaultConfig().(*Config).AnomalyDetection
+	config.Metrics = []string{"http.server.*"}
+	config.MinSamples = 3
+	detector, err := newAnomalyDetector(&config)
+	require.NoError(t, err)
+
+	newMetrics := func(latency float64, requests int64, at time.Time) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service.name", "checkout")
+		metrics := rm.ScopeMetrics().AppendEmpty().Metrics()
+
+		gauge := metrics.AppendEmpty()
+		gauge.SetName("http.server.latency")
+		dp := gauge.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(latency)
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(at))
+		dp.Attributes().PutStr("http.route", "/cart")
+
+		// Not analyzed
+		other := metrics.AppendEmpty()
+		other.SetName("queue.depth")
+		other.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(requests)
+		return md
+	}
+	anomaly := func(md pmetric.Metrics, metric int) map[string]interface{} {
+		attributes := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(metric).Gauge().DataPoints().At(0).Attributes().AsRaw()
+		delete(attributes, "http.route")
+		return attributes
+	}
+
+	start := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		md := newMetrics(100+float64(i%3), 5, start.Add(time.Duration(i)*time.Minute))
+		detector.annotate(md, "ai.")
+		assert.Empty(t, anomaly(md, 0))
+	}
+
+	md := newMetrics(20, 5000, start.Add(10*time.Minute))
+	detector.annotate(md, "ai.")
+	score := anomaly(md, 0)["ai.anomaly.score"]
+	assert.Greater(t, score, 3.0)
+	assert.Equal(t, "down", anomaly(md, 0)["ai.anomaly.direction"])
+	assert.Empty(t, anomaly(md, 1))
+}
+
+func TestAnomalyDetectorScoresHistogramQuantiles(t *testing.T) {
+	config := createDefaultConfig().(*Config).AnomalyDetection
+	config.MinSamples = 3
+	detector, err := newAnomalyDetector(&config)
+	require.NoError(t, err)
+
+	// A cumulative histogram whose slow requests jump after a while
+	counts := []uint64{0, 0, 0}
+	newMetrics := func(fast uint64, slow uint64) (pmetric.Metrics, pmetric.HistogramDataPoint) {
+		counts[0] += fast
+		counts[2] += slow
+		md := pmetric.NewMetrics()
+		histogram := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		histogram.SetName("http.server.duration")
+		histogram.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		dp := histogram.Histogram().DataPoints().AppendEmpty()
+		dp.ExplicitBounds().FromRaw([]float64{100, 1000})
+		dp.BucketCounts().FromRaw(counts)
+		return md, dp
+	}
+
+	for i := 0; i < 6; i++ {
+		md, dp := newMetrics(1000, 0)
+		detector.annotate(md, "ai.")
+		assert.Empty(t, dp.Attributes().AsRaw())
+	}
+	md, dp := newMetrics(900, 100)
+	detector.annotate(md, "ai.")
+	assert.Equal(t, "up", dp.Attributes().AsRaw()["ai.anomaly.direction"])
+}
@@ -0,0 +1,115 @@
+// This file contains the sizing and metrics of the process-wide caches
+// shared by all processors
+
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/common"
+)
+
+// sharedCache describes a process-wide cache for its metrics and stats
+type sharedCache struct {
+	name       string // metric name component
+	key        string // control-plane stats key
+	contents   string
+	statistics func() common.CacheStats
+}
+
+// sharedCaches are the process-wide caches reported by the processors
+var sharedCaches = []sharedCache{
+	{name: "attribute", key: "attributes", contents: "Attribute maps", statistics: common.AttributeCacheStatistics},
+	{name: "resource", key: "resources", contents: "Resources", statistics: common.ResourceCacheStatistics},
+}
+
+// configureCaches sizes the shared caches for config
+func configureCaches(config *ProcessingConfig) error {
+	if err := common.ConfigureAttributeCache(config.AttributeCacheSize); err != nil {
+		return err
+	}
+	if err := common.ConfigureResourceCache(config.ResourceCacheSize); err != nil {
+		return err
+	}
+	common.ConfigureStringInterning(config.InternTableSize)
+	return nil
+}
+
+// cacheInstruments are the metrics of one shared cache
+type cacheInstruments struct {
+	cache     sharedCache
+	size      metric.Int64ObservableGauge
+	hits      metric.Int64ObservableCounter
+	misses    metric.Int64ObservableCounter
+	evictions metric.Int64ObservableCounter
+}
+
+// registerCacheMetrics reports the efficiency of the shared caches through
+// the collector's own telemetry
+func registerCacheMetrics(provider metric.MeterProvider) (metric.Registration, error) {
+	meter := provider.Meter(meterScope)
+
+	var instruments []cacheInstruments
+	var observables []metric.Observable
+	for _, cache := range sharedCaches {
+		prefix := fmt.Sprintf("ai_processor.%s_cache.", cache.name)
+		size, err := meter.Int64ObservableGauge(prefix+"size",
+			metric.WithDescription(fmt.Sprintf("%s in the %s cache", cache.contents, cache.name)))
+		if err != nil {
+			return nil, err
+		}
+		hits, err := meter.Int64ObservableCounter(prefix+"hits",
+			metric.WithDescription(fmt.Sprintf("%s served from the %s cache", cache.contents, cache.name)))
+		if err != nil {
+			return nil, err
+		}
+		misses, err := meter.Int64ObservableCounter(prefix+"misses",
+			metric.WithDescription(fmt.Sprintf("%s not found in the %s cache", cache.contents, cache.name)))
+		if err != nil {
+			return nil, err
+		}
+		evictions, err := meter.Int64ObservableCounter(prefix+"evictions",
+			metric.WithDescription(fmt.Sprintf("%s evicted from the %s cache", cache.contents, cache.name)))
+		if err != nil {
+			return nil, err
+		}
+		instruments = append(instruments, cacheInstruments{cache, size, hits, misses, evictions})
+		observables = append(observables, size, hits, misses, evictions)
+	}
+
+	return meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		for _, instrument := range instruments {
+			stats := instrument.cache.statistics()
+			observer.ObserveInt64(instrument.size, int64(stats.Size))
+			observer.ObserveInt64(instrument.hits, stats.Hits)
+			observer.ObserveInt64(instrument.misses, stats.Misses)
+			observer.ObserveInt64(instrument.evictions, stats.Evictions)
+		}
+		return nil
+	}, observables...)
+}
+
+// cacheStatsMap returns the shared cache statistics for control-plane stats
+func cacheStatsMap() map[string]interface{} {
+	result := make(map[string]interface{}, len(sharedCaches))
+	for _, cache := range sharedCaches {
+		stats := cache.statistics()
+		result[cache.key] = map[string]interface{}{
+			"size":      stats.Size,
+			"capacity":  stats.Capacity,
+			"hits":      stats.Hits,
+			"misses":    stats.Misses,
+			"evictions": stats.Evictions,
+		}
+	}
+
+	interned := common.StringInterningStatistics()
+	result["strings"] = map[string]interface{}{
+		"size":     interned.Size,
+		"capacity": interned.Capacity,
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+// This file contains the splitting of large batches into chunks, which the
+// processors enrich and pass on one at a time in streaming mode
+
+package processor
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// chunkSize returns the size of the chunks batches are split into, 0 unless
+// streaming
+func (c *ProcessingConfig) chunkSize() int {
+	if !c.Streaming {
+		return 0
+	}
+	return c.BatchSize
+}
+
+// chunkPosition is the resource and scope of a batch a chunk last received
+// items of, -1 before its first
+type chunkPosition struct {
+	resource, scope int
+}
+
+// splitTraces moves the spans of td into chunks of about size spans, in
+// order. The spans of a trace go to the chunk its first span went to, so
+// traces are sampled as a whole, and chunks holding large traces may exceed
+// size. td is returned as is unless it holds more than size spans; a size
+// of 0 disables splitting.
+func splitTraces(td ptrace.Traces, size int) []ptrace.Traces {
+	if size <= 0 || td.SpanCount() <= size {
+		return []ptrace.Traces{td}
+	}
+
+	var chunks []ptrace.Traces
+	var counts []int
+	var positions []chunkPosition
+	var scopes []ptrace.ScopeSpans
+	traces := make(map[pcommon.TraceID]int)
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			ss := sss.At(j)
+			spans := ss.Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				chunk, ok := traces[span.TraceID()]
+				if !ok {
+					chunk = len(chunks) - 1
+					if chunk < 0 || counts[chunk] >= size {
+						chunks = append(chunks, ptrace.NewTraces())
+						counts = append(counts, 0)
+						positions = append(positions, chunkPosition{-1, -1})
+						scopes = append(scopes, ptrace.ScopeSpans{})
+						chunk++
+					}
+					traces[span.TraceID()] = chunk
+				}
+
+				// Copy the resource and scope the chunk is missing
+				if position := positions[chunk]; position.resource != i || position.scope != j {
+					resources := chunks[chunk].ResourceSpans()
+					if position.resource != i {
+						dest := resources.AppendEmpty()
+						rs.Resource().CopyTo(dest.Resource())
+						dest.SetSchemaUrl(rs.SchemaUrl())
+					}
+					scopes[chunk] = resources.At(resources.Len() - 1).ScopeSpans().AppendEmpty()
+					ss.Scope().CopyTo(scopes[chunk].Scope())
+					scopes[chunk].SetSchemaUrl(ss.SchemaUrl())
+					positions[chunk] = chunkPosition{i, j}
+				}
+				span.MoveTo(scopes[chunk].Spans().AppendEmpty())
+				counts[chunk]++
+			}
+		}
+	}
+	return chunks
+}
+
+// splitLogs moves the log records of ld into chunks of size records, in
+// order. ld is returned as is unless it holds more than size records; a
+// size of 0 disables splitting.
+func splitLogs(ld plog.Logs, size int) []plog.Logs {
+	if size <= 0 || ld.LogRecordCount() <= size {
+		return []plog.Logs{ld}
+	}
+
+	var chunks []plog.Logs
+	var chunk plog.Logs
+	var scope plog.ScopeLogs
+	var position chunkPosition
+	count := 0
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		rl := rls.At(i)
+		sls := rl.ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			sl := sls.At(j)
+			logs := sl.LogRecords()
+			for k := 0; k < logs.Len(); k++ {
+				// Start a chunk when the current one is full, and copy the
+				// resource and scope the chunk is missing
+				if count%size == 0 {
+					chunks = append(chunks, plog.NewLogs())
+					chunk = chunks[len(chunks)-1]
+					position = chunkPosition{-1, -1}
+				}
+				if position.resource != i || position.scope != j {
+					if position.resource != i {
+						dest := chunk.ResourceLogs().AppendEmpty()
+						rl.Resource().CopyTo(dest.Resource())
+						dest.SetSchemaUrl(rl.SchemaUrl())
+					}
+					resources := chunk.ResourceLogs()
+					scope = resources.At(resources.Len() - 1).ScopeLogs().AppendEmpty()
+					sl.Scope().CopyTo(scope.Scope())
+					scope.SetSchemaUrl(sl.SchemaUrl())
+					position = chunkPosition{i, j}
+				}
+				logs.At(k).MoveTo(scope.LogRecords().AppendEmpty())
+				count++
+			}
+		}
+	}
+	return chunks
+}
+
+// splitMetrics moves the metrics of md into chunks of size metrics, in
+// order. md is returned as is unless it holds more than size metrics; a
+// size of 0 disables splitting.
+func splitMetrics(md pmetric.Metrics, size int) []pmetric.Metrics {
+	if size <= 0 || md.MetricCount() <= size {
+		return []pmetric.Metrics{md}
+	}
+
+	var chunks []pmetric.Metrics
+	var chunk pmetric.Metrics
+	var scope pmetric.ScopeMetrics
+	var position chunkPosition
+	count := 0
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			sm := sms.At(j)
+			metrics := sm.Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				if count%size == 0 {
+					chunks = append(chunks, pmetric.NewMetrics())
+					chunk = chunks[len(chunks)-1]
+					position = chunkPosition{-1, -1}
+				}
+				if position.resource != i || position.scope != j {
+					if position.resource != i {
+						dest := chunk.ResourceMetrics().AppendEmpty()
+						rm.Resource().CopyTo(dest.Resource())
+						dest.SetSchemaUrl(rm.SchemaUrl())
+					}
+					resources := chunk.ResourceMetrics()
+					scope = resources.At(resources.Len() - 1).ScopeMetrics().AppendEmpty()
+					sm.Scope().CopyTo(scope.Scope())
+					scope.SetSchemaUrl(sm.SchemaUrl())
+					position = chunkPosition{i, j}
+				}
+				metrics.At(k).MoveTo(scope.Metrics().AppendEmpty())
+				count++
+			}
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestSplitTracesKeepsTracesTogether(t *testing.T) {
+	td := ptrace.NewTraces()
+	for i, service := range []string{"checkout", "payments"} {
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("service.name", service)
+		ss := rs.ScopeSpans().AppendEmpty()
+		ss.Scope().SetName("tracer")
+		for _, trace := range []byte{1, 2, 1, 3} {
+			span := ss.Spans().AppendEmpty()
+			span.SetTraceID(pcommon.TraceID{trace})
+			span.SetName(service)
+			span.Attributes().PutInt("index", int64(i))
+		}
+	}
+
+	// Traces 1 and 2 fill the first chunk, so its later spans join them
+	chunks := splitTraces(td, 2)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, 6, chunks[0].SpanCount())
+	assert.Equal(t, 2, chunks[1].SpanCount())
+	for _, chunk := range chunks {
+		rss := chunk.ResourceSpans()
+		for i := 0; i < rss.Len(); i++ {
+			service, _ := rss.At(i).Resource().Attributes().Get("service.name")
+			ss := rss.At(i).ScopeSpans().At(0)
+			assert.Equal(t, "tracer", ss.Scope().Name())
+			for k := 0; k < ss.Spans().Len(); k++ {
+				assert.Equal(t, service.Str(), ss.Spans().At(k).Name())
+			}
+		}
+	}
+	assert.Equal(t, 2, chunks[0].ResourceSpans().Len())
+	assert.Equal(t, pcommon.TraceID{3}, chunks[1].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).TraceID())
+
+	// Batches within the size aren't split
+	small := ptrace.NewTraces()
+	small.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	assert.Equal(t, []ptrace.Traces{small}, splitTraces(small, 2))
+	assert.Len(t, splitTraces(small, 0), 1)
+}
+
+func TestSplitLogsAndMetrics(t *testing.T) {
+	ld := plog.NewLogs()
+	md := pmetric.NewMetrics()
+	for _, service := range []string{"checkout", "payments"} {
+		rl := ld.ResourceLogs().AppendEmpty()
+		rl.Resource().Attributes().PutStr("service.name", service)
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service.name", service)
+		for _, scope := range []string{"a", "b"} {
+			sl := rl.ScopeLogs().AppendEmpty()
+			sl.Scope().SetName(scope)
+			sm := rm.ScopeMetrics().AppendEmpty()
+			sm.Scope().SetName(scope)
+			for i := 0; i < 2; i++ {
+				sl.LogRecords().AppendEmpty().Body().SetStr(service + scope)
+				sm.Metrics().AppendEmpty().SetName(service + scope)
+			}
+		}
+	}
+
+	logs := splitLogs(ld, 3)
+	require.Len(t, logs, 3)
+	assert.Equal(t, []int{3, 3, 2}, []int{logs[0].LogRecordCount(), logs[1].LogRecordCount(), logs[2].LogRecordCount()})
+	// The second chunk starts within the second scope of checkout and ends
+	// within the first of payments
+	second := logs[1].ResourceLogs()
+	require.Equal(t, 2, second.Len())
+	assert.Equal(t, "b", second.At(0).ScopeLogs().At(0).Scope().Name())
+	assert.Equal(t, "checkoutb", second.At(0).ScopeLogs().At(0).LogRecords().At(0).Body().Str())
+	service, _ := second.At(1).Resource().Attributes().Get("service.name")
+	assert.Equal(t, "payments", service.Str())
+	assert.Equal(t, 2, second.At(1).ScopeLogs().At(0).LogRecords().Len())
+
+	metrics := splitMetrics(md, 5)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, 5, metrics[0].MetricCount())
+	assert.Equal(t, 3, metrics[1].MetricCount())
+	first := metrics[1].ResourceMetrics().At(0).ScopeMetrics().At(0)
+	assert.Equal(t, "a", first.Scope().Name())
+	assert.Equal(t, "paymentsa", first.Metrics().At(0).Name())
+}
@@ -1,5 +1,12 @@
 package processor
 
+import (
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+)
+
 // Config defines the configuration for the AI processor.
 type Config struct {
 	// In newer versions, we use component.Config instead of configmodels.ProcessorSettings
@@ -20,6 +27,67 @@ type Config struct {
 	
 	// Output configuration for how AI-generated data is presented
 	Output OutputConfig `mapstructure:"output"`
+	
+	// Recording configuration for capturing model inputs for replay testing
+	Recording RecordingConfig `mapstructure:"recording"`
+	
+	// Rules are CEL rules evaluated before model invocation
+	Rules []expression.Rule `mapstructure:"rules"`
+	
+	// Hints configuration for the sampling and skip hints of upstream agents
+	Hints HintsConfig `mapstructure:"hints"`
+	
+	// ControlPlane configuration for runtime management
+	ControlPlane ControlPlaneConfig `mapstructure:"control_plane"`
+	
+	// Privacy configuration for aggregate metrics shared across tenants
+	Privacy PrivacyConfig `mapstructure:"privacy"`
+	
+	// Residency configuration for data-residency labels and backend restrictions
+	Residency ResidencyConfig `mapstructure:"residency"`
+	
+	// Tenancy configuration for identifying the tenant of telemetry
+	Tenancy TenancyConfig `mapstructure:"tenancy"`
+	
+	// Quotas configuration for per-tenant model invocation limits
+	Quotas QuotasConfig `mapstructure:"quotas"`
+	
+	// Memory configuration for allocation telemetry and GC tuning
+	Memory MemoryConfig `mapstructure:"memory"`
+	
+	// ContextLinking configuration for correlating logs with traces
+	ContextLinking ContextLinkingConfig `mapstructure:"context_linking"`
+	
+	// Redaction configuration for the personal data masked by pii_redaction
+	Redaction RedactionConfig `mapstructure:"redaction"`
+	
+	// GenAI configuration for the cost and risk of GenAI spans
+	GenAI GenAIConfig `mapstructure:"genai"`
+	
+	// AnomalyDetection configuration for the baselines of metric series
+	AnomalyDetection AnomalyDetectionConfig `mapstructure:"anomaly_detection"`
+	
+	// LogDedup configuration for collapsing repeated logs
+	LogDedup LogDedupConfig `mapstructure:"log_dedup"`
+	
+	// LogBody configuration for parsing JSON log bodies for the models
+	LogBody LogBodyConfig `mapstructure:"log_body"`
+	
+	// MetricRollup configuration for rolling up the metrics rules drop
+	MetricRollup MetricRollupConfig `mapstructure:"metric_rollup"`
+	
+	// Accounting configuration for the volume kept and dropped per service
+	Accounting AccountingConfig `mapstructure:"accounting"`
+	
+	// Persistence configuration for keeping the caches across restarts
+	Persistence PersistenceConfig `mapstructure:"persistence"`
+	
+	// Ownership configuration for mapping classified errors to teams
+	Ownership OwnershipConfig `mapstructure:"ownership"`
+	
+	// Tenants overrides features, sampling and output for the tenants
+	// identified by tenancy.attribute, keyed by tenant
+	Tenants map[string]TenantConfig `mapstructure:"tenants"`
 }
 
 // ModelsConfig defines the configuration for the AI models.
@@ -27,18 +95,473 @@ type ModelsConfig struct {
 	ErrorClassifier   ModelConfig `mapstructure:"error_classifier"`
 	ImportanceSampler ModelConfig `mapstructure:"importance_sampler"`
 	EntityExtractor   ModelConfig `mapstructure:"entity_extractor"`
+	
+	// Registry from which models referenced with registry:// are pulled
+	Registry RegistryConfig `mapstructure:"registry"`
+	
+	// Download defines how models with a URI as path are downloaded
+	Download DownloadConfig `mapstructure:"download"`
+	
+	// Bundle is an archive of models loaded in place of the paths of the
+	// models it holds
+	Bundle BundleConfig `mapstructure:"bundle"`
+	
+	// CompiledCacheDir is the directory where compiled WASM models are
+	// cached, so restarts skip compilation (empty to disable)
+	CompiledCacheDir string `mapstructure:"compiled_cache_dir"`
+	
+	// Engine tunes the compilation of WASM models
+	Engine WasmEngineConfig `mapstructure:"engine"`
+	
+	// AutoReload reloads models loaded from a path when their file changes
+	AutoReload bool `mapstructure:"auto_reload"`
+	
+	// ValidatePaths checks at startup that the model and rules files exist
+	ValidatePaths bool `mapstructure:"validate_paths"`
+	
+	// Shadow runs candidate models next to the production ones to measure
+	// how their outputs agree, without affecting the emitted attributes
+	Shadow ShadowConfig `mapstructure:"shadow"`
+}
+
+// ShadowConfig defines the shadow models evaluated on a sample of the
+// invocations of the production models. Models without a path, a ref or a
+// backend have no shadow.
+type ShadowConfig struct {
+	// Rate is the fraction of the invocations of a production model also
+	// run by its shadow
+	Rate float64 `mapstructure:"rate"`
+	
+	ErrorClassifier   ModelConfig `mapstructure:"error_classifier"`
+	ImportanceSampler ModelConfig `mapstructure:"importance_sampler"`
+	EntityExtractor   ModelConfig `mapstructure:"entity_extractor"`
+}
+
+// WasmEngineConfig selects the runtime running the WASM models and how they
+// are compiled, trading startup time for throughput. Empty settings use the
+// runtime's defaults.
+type WasmEngineConfig struct {
+	// Runtime is "wasmer", "wazero" or "wasmtime". Empty uses wasmer, or
+	// wazero in builds with the wazero tag and wasmtime in builds with the
+	// wasmtime tag.
+	Runtime string `mapstructure:"runtime"`
+	
+	// Compiler is "cranelift", "llvm" or "singlepass" with wasmer,
+	// "compiler" or "interpreter" with wazero, and "cranelift" with wasmtime
+	Compiler string `mapstructure:"compiler"`
+	
+	// Engine is "universal" or "dylib", only with wasmer
+	Engine string `mapstructure:"engine"`
+	
+	// CPUFeatures are host CPU features the compiler may use, e.g. "avx2",
+	// only with wasmer
+	CPUFeatures []string `mapstructure:"cpu_features"`
 }
 
 // ModelConfig defines the configuration for an individual AI model.
 type ModelConfig struct {
-	// Path to the WASM model file
+	// Path to the WASM model file, or a https://, s3:// or oci:// URI it is
+	// downloaded from
 	Path string `mapstructure:"path"`
 	
+	// SHA256 is the hex encoded digest a downloaded model must have. Pinned
+	// models are downloaded once and not refreshed.
+	SHA256 string `mapstructure:"sha256"`
+	
+	// Ref is a registry reference such as registry://error-classifier@1.4.0.
+	// When set, the model is pulled from the registry and Path is ignored.
+	Ref string `mapstructure:"ref"`
+	
+	// Version names the release of the model in its provenance, unless its
+	// ref or the model bundle names one
+	Version string `mapstructure:"version"`
+	
 	// Memory limit in MB for the WASM module
 	MemoryLimitMB int `mapstructure:"memory_limit_mb"`
 	
-	// Timeout in milliseconds for model inference
+	// ABI the WASM module exchanges inputs and outputs with, "raw" (default),
+	// "tinygo", "assemblyscript", "rust" or "component"
+	ABI string `mapstructure:"abi"`
+	
+	// Timeout in milliseconds for model inference, after which invocations
+	// fail (0 for no limit)
 	TimeoutMs int `mapstructure:"timeout_ms"`
+	
+	// CircuitBreaker stops invoking the model while it keeps failing
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	
+	// NegativeCache stops invoking the model with the inputs it failed on
+	// until their backoff expires
+	NegativeCache NegativeCacheConfig `mapstructure:"negative_cache"`
+	
+	// Fuel bounds the WebAssembly operators each invocation executes, so a
+	// pathological input can't spin a core (0 for no limit)
+	Fuel uint64 `mapstructure:"fuel"`
+	
+	// Instances is the number of instances of the WASM module invoked in
+	// turn, so concurrent invocations run in parallel (default 1)
+	Instances int `mapstructure:"instances"`
+	
+	// Backend selects what serves the model, "wasm", "onnx" or "remote".
+	// When empty, the backend follows from the sidecar, triton, remote and
+	// rules settings, with WASM serving models that have none.
+	Backend string `mapstructure:"backend"`
+	
+	// ONNX defines how inputs and outputs map to the tensors of an ONNX
+	// model loaded from Path or Ref, when Backend is "onnx"
+	ONNX ONNXConfig `mapstructure:"onnx"`
+	
+	// Sidecar runs the model in a subprocess instead of WASM
+	Sidecar SidecarConfig `mapstructure:"sidecar"`
+	
+	// Triton serves the model from a Triton or ONNX-GPU inference server
+	Triton TritonConfig `mapstructure:"triton"`
+	
+	// Remote serves the model from a remote HTTP or gRPC inference endpoint
+	Remote RemoteConfig `mapstructure:"remote"`
+	
+	// Rules serves the model from a YAML rules file, or answers the inputs
+	// the rules match before the model is invoked
+	Rules ModelRulesConfig `mapstructure:"rules"`
+	
+	// MaxInputBytes bounds the encoded input of the model (0 for no limit)
+	MaxInputBytes int `mapstructure:"max_input_bytes"`
+	
+	// Projection selects the parts of items passed to the model
+	Projection ProjectionConfig `mapstructure:"projection"`
+	
+	// CacheKey selects the input fields cached results of the model are
+	// keyed by, when processing.model_cache_results is enabled
+	CacheKey CacheKeyConfig `mapstructure:"cache_key"`
+	
+	// Sandbox constrains what the WASM module can do through its imports
+	Sandbox SandboxConfig `mapstructure:"sandbox"`
+	
+	// PostProcess normalizes the outputs of the model before they are
+	// written as attributes
+	PostProcess PostProcessConfig `mapstructure:"post_process"`
+	
+	// Calibration maps a score the model returns on a scale of its own to
+	// the 0-1 scale, before post-processing
+	Calibration CalibrationConfig `mapstructure:"calibration"`
+	
+	// Variants are error classifiers specialized for the logs of a language
+	// or server, keyed by "java", "go", "python" or "nginx". Error logs
+	// detected as one of them are classified by its variant instead. Only
+	// the error classifier has variants.
+	Variants map[string]ModelConfig `mapstructure:"variants"`
+}
+
+// CalibrationConfig defines how a numeric output of a model, its importance
+// by default, is mapped to the 0-1 scale sampling decisions use.
+type CalibrationConfig struct {
+	// Method is "linear" to map Min to 0 and Max to 1, "piecewise" to
+	// interpolate between Points, or empty to leave the scores alone
+	Method string `mapstructure:"method"`
+	
+	// Key is the output calibrated, "importance" if empty
+	Key string `mapstructure:"key"`
+	
+	// Min and Max are the raw scores mapped to 0 and 1 by the linear
+	// method. Scores outside them are clamped.
+	Min float64 `mapstructure:"min"`
+	Max float64 `mapstructure:"max"`
+	
+	// Points map raw scores to calibrated ones for the piecewise method,
+	// which interpolates linearly between them
+	Points []CalibrationPointConfig `mapstructure:"points"`
+}
+
+// CalibrationPointConfig maps a raw score to a calibrated score
+type CalibrationPointConfig struct {
+	Raw   float64 `mapstructure:"raw"`
+	Score float64 `mapstructure:"score"`
+}
+
+// PostProcessConfig defines how the outputs of a model are normalized. Keys
+// are renamed first, the other settings refer to the renamed keys.
+type PostProcessConfig struct {
+	// Rename maps output keys to the attribute keys they are written as
+	Rename map[string]string `mapstructure:"rename"`
+	
+	// Keys lists the output keys written, other keys are dropped. All keys
+	// are written if empty.
+	Keys []string `mapstructure:"keys"`
+	
+	// Categories canonicalize string outputs to a list of values
+	Categories map[string]CategoryConfig `mapstructure:"categories"`
+	
+	// Ranges clamp numeric outputs, dropping non-numeric values
+	Ranges map[string]RangeConfig `mapstructure:"ranges"`
+	
+	// Precision rounds numeric outputs to a number of decimal places,
+	// dropping non-numeric values
+	Precision map[string]int `mapstructure:"precision"`
+}
+
+// CategoryConfig restricts a string output to a list of values, matched
+// ignoring case and surrounding spaces
+type CategoryConfig struct {
+	// Values are the canonical values
+	Values []string `mapstructure:"values"`
+	
+	// Aliases map other spellings to one of the values
+	Aliases map[string]string `mapstructure:"aliases"`
+	
+	// Default replaces values matching none. Such outputs are dropped if
+	// it is empty.
+	Default string `mapstructure:"default"`
+}
+
+// RangeConfig bounds a numeric output
+type RangeConfig struct {
+	Min float64 `mapstructure:"min"`
+	Max float64 `mapstructure:"max"`
+}
+
+// SandboxConfig constrains the host access of a WASM model. The defaults
+// give WASI modules the host clocks and randomness but no filesystem.
+type SandboxConfig struct {
+	// Directories lists the host directories preopened for WASI modules,
+	// which can read and write them. None by default.
+	Directories []string `mapstructure:"directories"`
+	
+	// Clock is "host" (default) to read the host clocks, or "frozen" to
+	// read the Unix epoch and fail sleeps
+	Clock string `mapstructure:"clock"`
+	
+	// Random is "host" (default) for host randomness, or "deterministic"
+	// for a sequence seeded by RandomSeed
+	Random string `mapstructure:"random"`
+	
+	// RandomSeed seeds deterministic randomness
+	RandomSeed uint64 `mapstructure:"random_seed"`
+	
+	// AllowedImports lists the host functions the module may import, as
+	// module.name like env.abort or wasi_snapshot_preview1.fd_write.
+	// Modules importing others fail to load. All are allowed if empty.
+	AllowedImports []string `mapstructure:"allowed_imports"`
+}
+
+// ProjectionConfig selects the input fields and attributes passed to a model
+type ProjectionConfig struct {
+	// Fields lists the input fields passed, e.g. ["name", "status", "attributes"].
+	// All fields are passed if empty.
+	Fields []string `mapstructure:"fields"`
+	
+	// MaxAttributes bounds the attributes and resource attributes passed
+	// (0 for no limit)
+	MaxAttributes int `mapstructure:"max_attributes"`
+	
+	// PriorityAttributes are kept first when attributes are dropped
+	PriorityAttributes []string `mapstructure:"priority_attributes"`
+	
+	// MaxEvents bounds the span events passed to the error classifier,
+	// exception events first (0 for no limit)
+	MaxEvents int `mapstructure:"max_events"`
+	
+	// MaxStacktraceLength bounds the exception.stacktrace attribute of the
+	// events in bytes (0 for no limit)
+	MaxStacktraceLength int `mapstructure:"max_stacktrace_length"`
+}
+
+// CacheKeyConfig selects the input fields forming the cache key of model
+// results. Inputs differing only in other fields share a cached result.
+type CacheKeyConfig struct {
+	// Fields lists the input fields of the key, e.g. ["name",
+	// "attributes.db.system"]. All fields form the key if empty.
+	Fields []string `mapstructure:"fields"`
+	
+	// Templates lists fields keyed by the template of their value, with
+	// numbers and identifiers masked, e.g. ["status", "body"]
+	Templates []string `mapstructure:"templates"`
+}
+
+// TritonConfig defines a model served by an inference server implementing
+// the KServe v2 protocol. It is enabled when Endpoint is set.
+type TritonConfig struct {
+	// Endpoint is the server's HTTP URL, e.g. http://localhost:8000
+	Endpoint string `mapstructure:"endpoint"`
+	
+	// Model and Version name the model on the server
+	Model   string `mapstructure:"model"`
+	Version string `mapstructure:"version"`
+	
+	// InputName and OutputName are the BYTES tensor names
+	InputName  string `mapstructure:"input_name"`
+	OutputName string `mapstructure:"output_name"`
+	
+	// Headers are added to every request
+	Headers map[string]configopaque.String `mapstructure:"headers"`
+	
+	// MaxBatchSize is the largest number of items per inference request
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+	
+	// MaxBatchDelayMs is how long an item waits for a batch to fill
+	MaxBatchDelayMs int `mapstructure:"max_batch_delay_ms"`
+	
+	// MaxConcurrentBatches bounds the requests in flight
+	MaxConcurrentBatches int `mapstructure:"max_concurrent_batches"`
+}
+
+// RemoteConfig defines a model served by a remote inference endpoint, such
+// as a REST microservice. The endpoint is enabled when Endpoint is set.
+type RemoteConfig struct {
+	// Endpoint is an http(s):// URL the input is posted to, or the
+	// grpc://host:port or grpcs://host:port address of a gRPC service
+	Endpoint string `mapstructure:"endpoint"`
+	
+	// Method is the full gRPC method, e.g. /inference.v1.Models/Classify
+	Method string `mapstructure:"method"`
+	
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]configopaque.String `mapstructure:"headers"`
+	
+	// Fallback invokes the model's WASM module, which is loaded from Path
+	// or Ref, when a request fails
+	Fallback bool `mapstructure:"fallback"`
+}
+
+// ONNXConfig defines a classifier served by ONNX Runtime, such as a
+// scikit-learn or PyTorch model exported to ONNX. ONNX models need a build
+// with the onnx tag.
+type ONNXConfig struct {
+	// LibraryPath is the ONNX Runtime shared library, the system's if empty
+	LibraryPath string `mapstructure:"library_path"`
+	
+	// InputName and OutputName are the names of the input and output
+	// tensors, "input" and "probabilities" by default
+	InputName  string `mapstructure:"input_name"`
+	OutputName string `mapstructure:"output_name"`
+	
+	// Features are the input fields forming the float input tensor, in
+	// order, e.g. "attributes.http.status_code" or "resource.k8s.pod.restarts"
+	Features []string `mapstructure:"features"`
+	
+	// Labels name the classes whose probabilities the model returns. The
+	// most probable is the output, with its probability as confidence.
+	// Without labels, the model returns a single value, e.g. an importance.
+	Labels []string `mapstructure:"labels"`
+	
+	// OutputKey is the output key of the label or value, by default
+	// "error_type", "importance" or "service" depending on the model
+	OutputKey string `mapstructure:"output_key"`
+}
+
+// CircuitBreakerConfig defines when a model that keeps failing or timing
+// out stops being invoked. The breaker is enabled when FailureThreshold is
+// set.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed invocations that
+	// open the circuit (0 disables the breaker)
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	
+	// CoolDownMs is how long the circuit stays open before the model is
+	// probed again
+	CoolDownMs int `mapstructure:"cool_down_ms"`
+	
+	// RecoveryProbes is the number of consecutive successful probes that
+	// close the circuit (default 1)
+	RecoveryProbes int `mapstructure:"recovery_probes"`
+	
+	// Fallback is "heuristic" (default), returning heuristic results while
+	// the circuit is open, or "pass_through", leaving items unenriched
+	Fallback string `mapstructure:"fallback"`
+}
+
+// NegativeCacheConfig defines how long the inputs a model failed on fail
+// again without invoking the model. Inputs are told apart by the fields
+// cached results are keyed by.
+type NegativeCacheConfig struct {
+	// MaxEntries bounds the failed inputs remembered (0 disables the cache)
+	MaxEntries int `mapstructure:"max_entries"`
+	
+	// InitialBackoffMs is how long an input fails after its first failure,
+	// doubled by each further failure
+	InitialBackoffMs int `mapstructure:"initial_backoff_ms"`
+	
+	// MaxBackoffMs bounds the backoff of inputs failing repeatedly
+	MaxBackoffMs int `mapstructure:"max_backoff_ms"`
+	
+	// Jitter is the fraction of each backoff randomized, between 0.0 and
+	// 1.0, so inputs failing together are not retried together
+	Jitter float64 `mapstructure:"jitter"`
+}
+
+// ModelRulesConfig defines the rules file classifying model inputs, see
+// package rules for its format. The rules are enabled when Path is set.
+type ModelRulesConfig struct {
+	// Path is the YAML rules file
+	Path string `mapstructure:"path"`
+	
+	// Prefilter invokes the model, served by WASM or another backend, for
+	// the inputs no rule matches. Otherwise the rules replace the model and
+	// those inputs get the default output of the file.
+	Prefilter bool `mapstructure:"prefilter"`
+}
+
+// SidecarConfig defines a model served by a sidecar process, such as a
+// Python model server. The sidecar is enabled when Command or Socket is set.
+type SidecarConfig struct {
+	// Command starts the sidecar, e.g. ["python3", "/models/classifier.py"]
+	Command []string `mapstructure:"command"`
+	
+	// Env is added to the sidecar environment as KEY=VALUE pairs
+	Env map[string]string `mapstructure:"env"`
+	
+	// Socket is a Unix domain socket path. When empty, requests are sent
+	// over the sidecar's stdin and stdout.
+	Socket string `mapstructure:"socket"`
+	
+	// StartTimeoutMs bounds the time for the sidecar to become healthy
+	StartTimeoutMs int `mapstructure:"start_timeout_ms"`
+	
+	// HealthIntervalMs is the time between health checks
+	HealthIntervalMs int `mapstructure:"health_interval_ms"`
+}
+
+// RegistryConfig defines how models are pulled from a model registry.
+type RegistryConfig struct {
+	// Endpoint is the URL of the registry index JSON, or the oci:// URI of
+	// an artifact holding it
+	Endpoint string `mapstructure:"endpoint"`
+	
+	// CacheDir is the local directory where pulled models are stored
+	CacheDir string `mapstructure:"cache_dir"`
+	
+	// Headers are added to registry requests, e.g. for authorization
+	Headers map[string]configopaque.String `mapstructure:"headers"`
+	
+	// TimeoutMs bounds each registry request
+	TimeoutMs int `mapstructure:"timeout_ms"`
+}
+
+// DownloadConfig defines how models are downloaded from remote URIs.
+type DownloadConfig struct {
+	// CacheDir is the local directory where downloaded models are stored
+	CacheDir string `mapstructure:"cache_dir"`
+	
+	// Headers are added to HTTP requests and to the token requests of OCI
+	// registries, e.g. for authorization
+	Headers map[string]configopaque.String `mapstructure:"headers"`
+	
+	// TimeoutMs bounds each download request
+	TimeoutMs int `mapstructure:"timeout_ms"`
+	
+	// RefreshIntervalMs is how often models without a pinned digest are
+	// downloaded again and reloaded if they changed (0 to only download
+	// them at startup)
+	RefreshIntervalMs int `mapstructure:"refresh_interval_ms"`
+}
+
+// BundleConfig defines the model bundle, a tar archive holding the models
+// of a release and a manifest with their version and expected exports.
+type BundleConfig struct {
+	// Path is the bundle archive, empty to load models from their paths
+	Path string `mapstructure:"path"`
+	
+	// ExtractDir is the local directory where bundles are extracted
+	ExtractDir string `mapstructure:"extract_dir"`
 }
 
 // ProcessingConfig defines the processing settings.
@@ -46,32 +569,72 @@ type ProcessingConfig struct {
 	// BatchSize defines how many telemetry items to process in a batch
 	BatchSize int `mapstructure:"batch_size"`
 	
-	// Concurrency defines how many concurrent model executions to run
+	// Streaming splits batches larger than BatchSize into chunks, each
+	// processed and passed to the next consumer before the following one
+	Streaming bool `mapstructure:"streaming"`
+	
+	// Concurrency bounds the model invocations running at once across the
+	// traces, metrics and logs processors sharing this configuration
 	Concurrency int `mapstructure:"concurrency"`
 	
-	// QueueSize defines the maximum queue size for pending telemetry
+	// MaxConcurrentBatches bounds the batches processed at once by the
+	// processors sharing this configuration (0 for no limit)
+	MaxConcurrentBatches int `mapstructure:"max_concurrent_batches"`
+	
+	// InferenceThreads runs the WASM model invocations on this many dedicated
+	// OS threads instead of the processing goroutines (0 to disable)
+	InferenceThreads int `mapstructure:"inference_threads"`
+	
+	// QueueSize defines the maximum number of scopes queued for the parallel
+	// workers, split evenly between them, and the maximum number of batches
+	// in the intake queue
 	QueueSize int `mapstructure:"queue_size"`
 	
-	// TimeoutMs defines the overall timeout for processing a batch
+	// AsyncIntake queues batches for background workers instead of
+	// processing them in the pipeline, failing batches while the queue is full
+	AsyncIntake bool `mapstructure:"async_intake"`
+	
+	// IntakeWorkers defines the number of workers processing queued batches
+	IntakeWorkers int `mapstructure:"intake_workers"`
+	
+	// IntakeOverflow decides what happens to batches arriving while the
+	// intake queue is full: "backpressure" (default) fails them so receivers
+	// retry, "pass_through" passes them on without enrichment
+	IntakeOverflow string `mapstructure:"intake_overflow"`
+	
+	// TimeoutMs bounds the enrichment of a batch, after which its remaining
+	// items pass on without model outputs (0 for no limit)
 	TimeoutMs int `mapstructure:"timeout_ms"`
 	
 	// EnableParallelProcessing enables processing telemetry items in parallel
 	EnableParallelProcessing bool `mapstructure:"enable_parallel_processing"`
 	
-	// MaxParallelWorkers defines the maximum number of workers for parallel processing
+	// MaxParallelWorkers defines the number of workers for parallel processing.
+	// Items are assigned to a worker by the hash of their resource.
 	MaxParallelWorkers int `mapstructure:"max_parallel_workers"`
 	
+	// OrderedCompletion runs the enrichment hooks of a batch in batch order
+	// once the workers have run the models on all of its items
+	OrderedCompletion bool `mapstructure:"ordered_completion"`
+	
 	// AttributeCacheSize defines the size of the attribute cache (0 to disable)
 	AttributeCacheSize int `mapstructure:"attribute_cache_size"`
 	
 	// ResourceCacheSize defines the size of the resource cache (0 to disable)
 	ResourceCacheSize int `mapstructure:"resource_cache_size"`
 	
+	// InternTableSize defines how many attribute keys and short values are
+	// interned (0 to disable)
+	InternTableSize int `mapstructure:"intern_table_size"`
+	
 	// ModelCacheResults controls whether to cache model results for similar inputs
 	ModelCacheResults bool `mapstructure:"model_cache_results"`
 	
-	// ModelResultsCacheSize defines the size of the model results cache per model
+	// ModelResultsCacheSize defines the size of the model results cache per model and tenant
 	ModelResultsCacheSize int `mapstructure:"model_results_cache_size"`
+	
+	// ModelCacheTenants defines how many tenants' model results are cached
+	ModelCacheTenants int `mapstructure:"model_cache_tenants"`
 }
 
 // FeaturesConfig defines which features are enabled.
@@ -87,6 +650,23 @@ type FeaturesConfig struct {
 	
 	// ContextLinking enables linking related telemetry items
 	ContextLinking bool `mapstructure:"context_linking"`
+	
+	// PIIRedaction enables redaction of personal data in span attributes and logs
+	PIIRedaction bool `mapstructure:"pii_redaction"`
+	
+	// AnomalyDetection enables annotation of anomalous metric data points
+	AnomalyDetection bool `mapstructure:"anomaly_detection"`
+	
+	// LogDedup enables collapsing repeated logs into aggregate records
+	LogDedup bool `mapstructure:"log_dedup"`
+	
+	// NameNormalization replaces the identifiers in span names and HTTP
+	// routes with placeholders, such as /users/{id}
+	NameNormalization bool `mapstructure:"name_normalization"`
+	
+	// GenAI adds the estimated cost and prompt-injection risk of spans
+	// following the GenAI semantic conventions
+	GenAI bool `mapstructure:"genai"`
 }
 
 // SamplingConfig defines the sampling configuration.
@@ -102,6 +682,148 @@ type SamplingConfig struct {
 	
 	// ThresholdMs defines the threshold in ms for slow spans
 	ThresholdMs int `mapstructure:"threshold_ms"`
+	
+	// Randomness selects what rates are compared with: "trace_id", the 63
+	// low bits of the trace ID as the OpenTelemetry ratio samplers do, or
+	// "w3c", the randomness of W3C Trace Context Level 2, which also
+	// decides the logs without a trace by a hash of their content
+	Randomness string `mapstructure:"randomness"`
+	
+	// Tail buffers spans across batches to sample complete traces
+	Tail TailSamplingConfig `mapstructure:"tail"`
+	
+	// Logs defines the sampling rates of logs by severity
+	Logs LogSamplingConfig `mapstructure:"logs"`
+	
+	// DecisionCache remembers kept traces so their later spans are kept too
+	DecisionCache DecisionCacheConfig `mapstructure:"decision_cache"`
+	
+	// Similarity keeps the traces and logs unlike any kept recently and
+	// down-samples those similar to one
+	Similarity SimilaritySamplingConfig `mapstructure:"similarity"`
+	
+	// Adaptive adjusts the normal spans rate to a throughput target
+	Adaptive AdaptiveSamplingConfig `mapstructure:"adaptive"`
+}
+
+// AdaptiveSamplingConfig defines the adjustment of the normal spans rate to
+// keep the spans passed to the next consumer within a throughput budget.
+// The rate starts at NormalSpans and is adjusted by the throughput measured
+// over a sliding window. Error and slow spans are kept at their own rates
+// but count towards the throughput.
+type AdaptiveSamplingConfig struct {
+	// Enabled turns on the rate controller
+	Enabled bool `mapstructure:"enabled"`
+	
+	// TargetSpansPerSecond is the spans per second to pass on (0 for no
+	// target)
+	TargetSpansPerSecond float64 `mapstructure:"target_spans_per_second"`
+	
+	// TargetBytesPerSecond is the bytes per second to pass on, as sized
+	// by the OTLP protobuf encoding (0 for no target). With both targets,
+	// the rate keeps within both.
+	TargetBytesPerSecond float64 `mapstructure:"target_bytes_per_second"`
+	
+	// WindowMs is the sliding window the throughput is measured over
+	WindowMs int `mapstructure:"window_ms"`
+	
+	// MinRate and MaxRate bound the rate (0.0-1.0)
+	MinRate float64 `mapstructure:"min_rate"`
+	MaxRate float64 `mapstructure:"max_rate"`
+}
+
+// SimilaritySamplingConfig defines the sampling of traces and logs by the
+// similarity of their text to that of recently kept ones. Their text, the
+// name and status message of root spans and the body of logs, is embedded
+// as a vector and compared with the embeddings of the items kept recently.
+type SimilaritySamplingConfig struct {
+	// Enabled turns on similarity sampling
+	Enabled bool `mapstructure:"enabled"`
+	
+	// Embedder computes the embeddings: "hashing" hashes the words of the
+	// text without a model, "wasm" runs the WASM module at Path and
+	// "remote" calls the embedding API at Endpoint
+	Embedder string `mapstructure:"embedder"`
+	
+	// Dimensions of the embeddings of the hashing embedder
+	Dimensions int `mapstructure:"dimensions"`
+	
+	// Path is the WASM embedding module, which exports Function
+	Path     string `mapstructure:"path"`
+	Function string `mapstructure:"function"`
+	
+	// Endpoint is the remote embedding API, e.g. an OpenAI-compatible
+	// https://host/v1/embeddings, with Headers added to every request
+	Endpoint string            `mapstructure:"endpoint"`
+	Headers  map[string]configopaque.String `mapstructure:"headers"`
+	
+	// Model names the embedding model of the WASM module or the API
+	Model string `mapstructure:"model"`
+	
+	// TimeoutMs bounds each request to the remote embedding API
+	TimeoutMs int `mapstructure:"timeout_ms"`
+	
+	// Threshold is the cosine similarity (0.0-1.0) from which an item is
+	// similar to a kept one
+	Threshold float64 `mapstructure:"threshold"`
+	
+	// SimilarRate is the rate (0.0-1.0) at which items similar to a kept
+	// one are kept, of those their sampling rate keeps
+	SimilarRate float64 `mapstructure:"similar_rate"`
+	
+	// MaxItems bounds the kept items compared with per signal, the oldest
+	// are forgotten beyond it
+	MaxItems int `mapstructure:"max_items"`
+}
+
+// DecisionCacheConfig defines how long the traces whose spans were kept are
+// remembered. Later spans of a remembered trace are kept without being
+// sampled, so backends don't receive partial traces.
+type DecisionCacheConfig struct {
+	// Enabled turns on the cache
+	Enabled bool `mapstructure:"enabled"`
+	
+	// TTLMs is how long a trace is remembered after its first span was kept
+	TTLMs int `mapstructure:"ttl_ms"`
+	
+	// MaxTraces bounds the remembered traces. The oldest are forgotten
+	// early beyond it (0 for no limit).
+	MaxTraces int `mapstructure:"max_traces"`
+}
+
+// LogSamplingConfig defines the sampling rates (0.0-1.0) of logs by
+// severity. Logs without a severity are sampled at the info rate.
+type LogSamplingConfig struct {
+	// AlwaysKeepErrors keeps logs at ERROR severity or above whatever the
+	// error rate
+	AlwaysKeepErrors bool `mapstructure:"always_keep_errors"`
+	
+	// Error is the sampling rate of ERROR and FATAL logs
+	Error float64 `mapstructure:"error"`
+	
+	// Warn is the sampling rate of WARN logs
+	Warn float64 `mapstructure:"warn"`
+	
+	// Info is the sampling rate of INFO logs
+	Info float64 `mapstructure:"info"`
+	
+	// Debug is the sampling rate of DEBUG and TRACE logs
+	Debug float64 `mapstructure:"debug"`
+}
+
+// TailSamplingConfig defines how spans are buffered by trace before the
+// sampling decision of the trace is made.
+type TailSamplingConfig struct {
+	// Enabled buffers spans by trace instead of sampling each batch
+	Enabled bool `mapstructure:"enabled"`
+	
+	// DecisionWaitMs is how long the spans of a trace are buffered after
+	// its first span arrives
+	DecisionWaitMs int `mapstructure:"decision_wait_ms"`
+	
+	// MaxTraces bounds the buffered traces. The oldest traces are decided
+	// early when more arrive (0 for no limit).
+	MaxTraces int `mapstructure:"max_traces"`
 }
 
 // OutputConfig defines how the AI-generated data is presented.
@@ -114,4 +836,424 @@ type OutputConfig struct {
 	
 	// MaxAttributeLength defines the maximum length for AI-generated attributes
 	MaxAttributeLength int `mapstructure:"max_attribute_length"`
-}
\ No newline at end of file
+	
+	// EntityFormat writes the lists and objects extracted as entities as
+	// "slice" (default) attribute values, "json" strings, or "flat"
+	// attributes per element such as ai.services.0
+	EntityFormat string `mapstructure:"entity_format"`
+	
+	// IncludeSamplingMetadata records why smart sampling kept each span and log
+	IncludeSamplingMetadata bool `mapstructure:"include_sampling_metadata"`
+	
+	// IncludeModelProvenance records the name, version and hash of the
+	// models that enriched each item
+	IncludeModelProvenance bool `mapstructure:"include_model_provenance"`
+	
+	// Severity rewrites the severity of logs and hints the status of spans
+	// from the severity the error classifier gives them
+	Severity SeverityConfig `mapstructure:"severity"`
+}
+
+// SeverityConfig maps the severities the error classifier gives items, such
+// as low or critical, to log severities and span status hints.
+type SeverityConfig struct {
+	// AllowMutation enables the mappings. Rewriting severities changes the
+	// telemetry the sources sent, so it must be allowed explicitly.
+	AllowMutation bool `mapstructure:"allow_mutation"`
+	
+	// Logs maps classified severities to the trace, debug, info, warn,
+	// error or fatal severity logs are rewritten to
+	Logs map[string]string `mapstructure:"logs"`
+	
+	// Spans maps classified severities to the unset, ok or error status
+	// hinted on spans
+	Spans map[string]string `mapstructure:"spans"`
+}
+
+// ControlPlaneConfig defines how the processor is managed at runtime.
+type ControlPlaneConfig struct {
+	// GRPCEndpoint is the host:port of the gRPC control-plane service (disabled if empty)
+	GRPCEndpoint string `mapstructure:"grpc_endpoint"`
+	
+	// HTTPEndpoint is the host:port of the JSON over HTTP admin endpoint (disabled if empty)
+	HTTPEndpoint string `mapstructure:"http_endpoint"`
+	
+	// TLS serves both endpoints over TLS when set
+	TLS *configtls.ServerConfig `mapstructure:"tls"`
+	
+	// BearerToken, when set, must be sent as "Authorization: Bearer <token>"
+	// by every request to both endpoints
+	BearerToken configopaque.String `mapstructure:"bearer_token"`
+	
+	// OpAMP configures the OpAMP client for fleet management
+	OpAMP OpAMPConfig `mapstructure:"opamp"`
+}
+
+// OpAMPConfig defines the connection to an OpAMP server.
+type OpAMPConfig struct {
+	// Endpoint is the OpAMP server URL, ws(s):// or http(s):// (disabled if empty)
+	Endpoint string `mapstructure:"endpoint"`
+	
+	// InstanceUID identifies this processor instance (generated if empty)
+	InstanceUID string `mapstructure:"instance_uid"`
+	
+	// Headers are added to requests to the OpAMP server
+	Headers map[string]configopaque.String `mapstructure:"headers"`
+	
+	// PackagesDir is where model packages offered by the server are stored
+	PackagesDir string `mapstructure:"packages_dir"`
+}
+
+// PrivacyConfig defines the differential privacy and k-anonymity protection
+// applied to aggregate metrics, such as error rates and topology counts.
+type PrivacyConfig struct {
+	// Enabled turns on protection of the listed metrics
+	Enabled bool `mapstructure:"enabled"`
+	
+	// Metrics are the protected metric names; a trailing * matches a prefix
+	Metrics []string `mapstructure:"metrics"`
+	
+	// Epsilon is the privacy budget per released value (0 disables noise)
+	Epsilon float64 `mapstructure:"epsilon"`
+	
+	// Sensitivity is the largest contribution of one individual, 1 for counts
+	Sensitivity float64 `mapstructure:"sensitivity"`
+	
+	// KAnonymity suppresses counts below this threshold (0 disables suppression)
+	KAnonymity int `mapstructure:"k_anonymity"`
+}
+
+// ResidencyConfig defines how telemetry is labeled with its data residency
+// and which model backends may receive data of each residency.
+type ResidencyConfig struct {
+	// Enabled turns on residency labeling and enforcement
+	Enabled bool `mapstructure:"enabled"`
+	
+	// SourceAttributes are the resource attributes holding the region, in order
+	// of preference, e.g. cloud.region
+	SourceAttributes []string `mapstructure:"source_attributes"`
+	
+	// Regions maps regions to residency labels; a trailing * matches a prefix
+	Regions map[string]string `mapstructure:"regions"`
+	
+	// Default is the label of data whose region is missing or not mapped
+	Default string `mapstructure:"default"`
+	
+	// Restricted lists, per residency label, the model backends (wasm,
+	// sidecar, triton or remote) that must not receive its data
+	Restricted map[string][]string `mapstructure:"restricted"`
+}
+
+// AnomalyDetectionConfig defines how metric data points are scored against
+// the baseline of their series when features.anomaly_detection is enabled.
+type AnomalyDetectionConfig struct {
+	// Metrics lists the analyzed metrics, all if empty; a trailing * matches
+	// a prefix
+	Metrics []string `mapstructure:"metrics"`
+	
+	// Alpha is the weight of each new value in the moving baseline, in (0, 1]
+	Alpha float64 `mapstructure:"alpha"`
+	
+	// Threshold is the absolute z-score from which data points are anomalous
+	Threshold float64 `mapstructure:"threshold"`
+	
+	// MinSamples is the number of values a baseline needs before data points
+	// are scored against it
+	MinSamples int `mapstructure:"min_samples"`
+	
+	// MaxSeries bounds the series tracked, forgetting the least recently seen
+	MaxSeries int `mapstructure:"max_series"`
+	
+	// SeasonMs is the period of seasonal baselines, e.g. 86400000 for a day
+	// (0 for a single baseline per series)
+	SeasonMs int64 `mapstructure:"season_ms"`
+	
+	// SeasonBuckets is the number of baselines per season, e.g. 24 for hourly
+	// baselines of a daily season
+	SeasonBuckets int `mapstructure:"season_buckets"`
+	
+	// HistogramQuantile is the quantile, estimated from the buckets, that
+	// histogram data points are scored and passed to the models by, in (0, 1)
+	HistogramQuantile float64 `mapstructure:"histogram_quantile"`
+}
+
+// LogDedupConfig defines how repeated logs are collapsed when
+// features.log_dedup is enabled. Logs repeat one another when they share
+// their resource, scope, severity and body template, the body with its
+// numbers, identifiers and other variable parts masked.
+type LogDedupConfig struct {
+	// WindowMs is how often the aggregate records are forwarded; logs are
+	// collapsed within each window
+	WindowMs int `mapstructure:"window_ms"`
+	
+	// MinSeverity is the lowest severity collapsed: trace, debug, info,
+	// warn, error or fatal
+	MinSeverity string `mapstructure:"min_severity"`
+	
+	// MaxGroups bounds the templates tracked per window. Logs of further
+	// templates pass through (0 for no limit).
+	MaxGroups int `mapstructure:"max_groups"`
+}
+
+// AccountingConfig defines the accounting of the spans and logs kept and
+// dropped by smart sampling per service.name, in items and in bytes of
+// their OTLP protobuf encoding.
+type AccountingConfig struct {
+	// Enabled turns on the accounting
+	Enabled bool `mapstructure:"enabled"`
+	
+	// MaxServices bounds the services accounted separately. Further
+	// services are accounted together as "_other" (0 for no limit).
+	MaxServices int `mapstructure:"max_services"`
+	
+	// ReportIntervalMs is how often a summary of the volume of each
+	// service is logged (0 to disable)
+	ReportIntervalMs int `mapstructure:"report_interval_ms"`
+}
+
+// PersistenceConfig defines the file the trace decision cache and the
+// model results caches are saved to, so they are restored when the
+// collector restarts.
+type PersistenceConfig struct {
+	// Path is the BoltDB file of the caches, which only one collector can
+	// open at a time (empty to disable)
+	Path string `mapstructure:"path"`
+	
+	// SnapshotIntervalMs is how often the caches are saved, besides when
+	// the processors shut down (0 to save them only then)
+	SnapshotIntervalMs int `mapstructure:"snapshot_interval_ms"`
+}
+
+// HintsConfig defines the attributes upstream agents, such as the agents
+// at the edge, set on items to force their sampling decision or skip models
+// before any is invoked. Rules take precedence over hints.
+type HintsConfig struct {
+	// Enabled honors the hints of items
+	Enabled bool `mapstructure:"enabled"`
+	
+	// PriorityAttribute holds the sampling priority of an item: items with
+	// a positive priority are kept, others dropped
+	PriorityAttribute string `mapstructure:"priority_attribute"`
+	
+	// SkipAttribute holds true to skip every model for an item, or the
+	// models to skip
+	SkipAttribute string `mapstructure:"skip_attribute"`
+	
+	// Strip removes the hint attributes from the items passed on
+	Strip bool `mapstructure:"strip"`
+}
+
+// OwnershipConfig defines the team registry the owners, categories and
+// services of classified errors are mapped to teams with
+type OwnershipConfig struct {
+	// Path is the YAML or JSON registry file, read when Endpoint is empty
+	// (both empty to disable)
+	Path string `mapstructure:"path"`
+	
+	// Endpoint is the URL the registry is fetched from
+	Endpoint string `mapstructure:"endpoint"`
+	
+	// Headers are added to the requests of the registry, e.g. for
+	// authorization
+	Headers map[string]configopaque.String `mapstructure:"headers"`
+	
+	// TimeoutMs bounds each request of the registry
+	TimeoutMs int `mapstructure:"timeout_ms"`
+	
+	// RefreshIntervalMs is how often the registry is read again (0 to read
+	// it once)
+	RefreshIntervalMs int `mapstructure:"refresh_interval_ms"`
+}
+
+// RedactionConfig defines the personal data and secrets redacted from span
+// attributes, log bodies and log attributes when features.pii_redaction is
+// enabled.
+type RedactionConfig struct {
+	// Patterns are the detected values, applied in order
+	Patterns []RedactionPattern `mapstructure:"patterns"`
+	
+	// Salt keys the hashes of the hash strategy
+	Salt string `mapstructure:"salt"`
+}
+
+// RedactionPattern defines values to redact and how.
+type RedactionPattern struct {
+	// Name identifies the pattern; email, credit_card and token are built in
+	// and need no regex
+	Name string `mapstructure:"name"`
+	
+	// Regex matches the values to redact
+	Regex string `mapstructure:"regex"`
+	
+	// Strategy is mask, hash or drop, mask if empty
+	Strategy string `mapstructure:"strategy"`
+}
+
+// GenAIConfig defines the enrichment of the spans of GenAI operations, such
+// as LLM calls, enabled by features.genai.
+type GenAIConfig struct {
+	// Prices are the prices in USD per million tokens, keyed by model; a
+	// key applies to the models whose name it starts with, the longest
+	// matching key winning
+	Prices map[string]GenAIPriceConfig `mapstructure:"prices"`
+	
+	// PromptAttributes are the span and span event attributes holding the
+	// prompts checked for injections
+	PromptAttributes []string `mapstructure:"prompt_attributes"`
+	
+	// InjectionPatterns are case-insensitive regular expressions flagging
+	// prompt injections, on top of the built-in ones
+	InjectionPatterns []string `mapstructure:"injection_patterns"`
+}
+
+// GenAIPriceConfig defines the price of a model in USD per million tokens.
+type GenAIPriceConfig struct {
+	// Input is the price of input, or prompt, tokens
+	Input float64 `mapstructure:"input"`
+	
+	// Output is the price of output, or completion, tokens
+	Output float64 `mapstructure:"output"`
+}
+
+// LogBodyConfig defines the parsing of log bodies that are JSON objects, or
+// maps, whose fields are flattened to dotted keys, such as body.user.id,
+// and passed to the models with the attributes of the log.
+type LogBodyConfig struct {
+	// Enabled parses the bodies of the logs passed to the models
+	Enabled bool `mapstructure:"enabled"`
+	
+	// Fields are the dotted paths of the fields passed, with the fields
+	// nested in them; empty passes all fields
+	Fields []string `mapstructure:"fields"`
+	
+	// AttributePrefix prefixes the keys of the fields
+	AttributePrefix string `mapstructure:"attribute_prefix"`
+	
+	// ToAttributes also sets the fields as attributes of the logs
+	ToAttributes bool `mapstructure:"to_attributes"`
+	
+	// MaxDepth is the nesting depth of the fields passed, 0 for no limit
+	MaxDepth int `mapstructure:"max_depth"`
+	
+	// MaxFields is the number of fields passed per log, 0 for no limit
+	MaxFields int `mapstructure:"max_fields"`
+	
+	// MaxBodyBytes is the size of the largest body parsed, 0 for no limit
+	MaxBodyBytes int `mapstructure:"max_body_bytes"`
+}
+
+// MetricRollupConfig defines the rollup of the metrics that rules or hints
+// drop. Instead of being dropped, their data points have high-cardinality
+// attributes removed and those left with the same attributes are merged,
+// which keeps the totals of the metrics with fewer series.
+type MetricRollupConfig struct {
+	// Enabled rolls up the dropped metrics instead of dropping them
+	Enabled bool `mapstructure:"enabled"`
+	
+	// Attributes are the data point attributes removed, e.g. k8s.pod.name
+	Attributes []string `mapstructure:"attributes"`
+	
+	// ResourceAttributes are the resource attributes removed, merging the
+	// metrics of the resources left the same
+	ResourceAttributes []string `mapstructure:"resource_attributes"`
+	
+	// Gauge is the aggregation of merged gauge data points: sum, mean, min,
+	// max or last. Sums and histograms are always added.
+	Gauge string `mapstructure:"gauge"`
+}
+
+// TenancyConfig defines how the tenant of telemetry is identified.
+type TenancyConfig struct {
+	// Attribute is the resource attribute holding the tenant, e.g. tenant.id
+	Attribute string `mapstructure:"attribute"`
+	
+	// Default is the tenant of telemetry without the attribute
+	Default string `mapstructure:"default"`
+}
+
+// TenantConfig overrides settings for the telemetry of a tenant. Each
+// section takes the keys of the processor's section of the same name and
+// overrides only those set. Settings shared by the items of every tenant,
+// such as tail sampling or context linking, can't be overridden.
+type TenantConfig struct {
+	// Features overrides the features enabled for the tenant
+	Features map[string]interface{} `mapstructure:"features"`
+	
+	// Sampling overrides the sampling rates of the tenant
+	Sampling map[string]interface{} `mapstructure:"sampling"`
+	
+	// Output overrides how the tenant's telemetry is annotated
+	Output map[string]interface{} `mapstructure:"output"`
+}
+
+// QuotasConfig defines per-tenant limits on model invocations. Invocations
+// served from the result cache do not count.
+type QuotasConfig struct {
+	// Enabled turns on quota enforcement
+	Enabled bool `mapstructure:"enabled"`
+	
+	// Default limits applied to every tenant without an override
+	QuotaLimits `mapstructure:",squash"`
+	
+	// Tenants overrides the limits of individual tenants
+	Tenants map[string]QuotaLimits `mapstructure:"tenants"`
+}
+
+// QuotaLimits bounds the model invocations of a tenant (0 for unlimited).
+type QuotaLimits struct {
+	// Hourly is the limit per calendar hour (UTC)
+	Hourly int64 `mapstructure:"hourly"`
+	
+	// Daily is the limit per calendar day (UTC)
+	Daily int64 `mapstructure:"daily"`
+}
+
+// RecordingConfig defines how model invocations are captured for replay testing.
+type RecordingConfig struct {
+	// Enabled turns on recording of model inputs and outputs
+	Enabled bool `mapstructure:"enabled"`
+	
+	// Path is the JSON-lines corpus file that records are appended to
+	Path string `mapstructure:"path"`
+	
+	// SampleRate is the fraction of model invocations to record (0.0-1.0)
+	SampleRate float64 `mapstructure:"sample_rate"`
+	
+	// MaxRecords stops recording after this many records (0 for unlimited)
+	MaxRecords int `mapstructure:"max_records"`
+	
+	// RedactKeys are extra attribute key fragments whose values are redacted
+	RedactKeys []string `mapstructure:"redact_keys"`
+}
+// ContextLinkingConfig defines how long traces are remembered to correlate
+// error logs with their spans when features.context_linking is enabled.
+type ContextLinkingConfig struct {
+	// TTLMs is how long a trace is remembered after its first span or log
+	TTLMs int `mapstructure:"ttl_ms"`
+	
+	// MaxTraces bounds the remembered traces. The oldest are forgotten
+	// early beyond it (0 for no limit).
+	MaxTraces int `mapstructure:"max_traces"`
+	
+	// ErrorMetrics lists the metrics whose spikes get the error category of
+	// the traces of their exemplars; a trailing * matches a prefix. If
+	// empty, metrics whose name mentions errors, failures or exceptions.
+	ErrorMetrics []string `mapstructure:"error_metrics"`
+}
+
+// MemoryConfig defines the allocation telemetry of the processors and the
+// tuning of the garbage collector. The GC settings apply to the whole
+// collector process.
+type MemoryConfig struct {
+	// Telemetry reports the allocations and GC activity during batches
+	Telemetry bool `mapstructure:"telemetry"`
+	
+	// GCPercent overrides GOGC when positive
+	GCPercent int `mapstructure:"gc_percent"`
+	
+	// MemoryLimitMiB sets the soft memory limit (GOMEMLIMIT) when positive
+	MemoryLimitMiB int `mapstructure:"memory_limit_mib"`
+	
+	// BallastMiB allocates a heap ballast, delaying collections of small heaps
+	BallastMiB int `mapstructure:"ballast_mib"`
+}
@@ -0,0 +1,51 @@
+// This file contains helpers for loading the processor configuration
+// outside of a running collector, e.g. for the replay command
+
+package processor
+
+import (
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/collector/confmap"
+)
+
+// LoadConfigFile reads the ai_processor configuration from a collector
+// configuration file. Files containing only the processor settings are
+// accepted as well. Unset options keep their default values, and the
+// result is validated as the collector would.
+func LoadConfigFile(path string) (*Config, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	retrieved, err := confmap.NewRetrievedFromYAML(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	conf, err := retrieved.AsConf()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	// Use the processor section of a full collector configuration if present
+	key := "processors" + confmap.KeyDelimiter + typeStr
+	if conf.IsSet(key) {
+		conf, err = conf.Sub(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s section: %w", typeStr, err)
+		}
+	}
+
+	config := createDefaultConfig().(*Config)
+	if err := conf.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("failed to decode %s configuration: %w", typeStr, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s configuration: %w", typeStr, err)
+	}
+
+	return config, nil
+}
@@ -1,9 +1,12 @@
 package processor
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfigDefaults(t *testing.T) {
@@ -171,4 +174,85 @@ func TestSamplingRateLimits(t *testing.T) {
 	assert.Equal(t, 1.0, config.Sampling.ErrorEvents)
 	assert.Equal(t, 0.0, config.Sampling.SlowSpans)
 	assert.Equal(t, 0.5, config.Sampling.NormalSpans)
-}
\ No newline at end of file
+}
+
+func TestValidateAcceptsDefaultConfig(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	assert.NoError(t, config.Validate())
+}
+
+func TestValidateReportsInvalidOptions(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Sampling.NormalSpans = 1.5
+	config.Sampling.Logs.Debug = -0.1
+	config.Processing.Concurrency = 0
+	config.Output.AttributeNamespace = "ai"
+	config.Models.ImportanceSampler.CircuitBreaker.FailureThreshold = 3
+	config.Output.Severity.Logs = map[string]string{"low": "notice"}
+	config.Ownership = OwnershipConfig{Path: "teams.yaml", Endpoint: "http://registry/teams"}
+	config.Models.EntityExtractor.SHA256 = "abc"
+	config.Models.ErrorClassifier.NegativeCache.Jitter = 1.5
+	config.Models.ImportanceSampler.Calibration = CalibrationConfig{Method: "linear", Min: 1, Max: 0}
+	config.GenAI.Prices = map[string]GenAIPriceConfig{"gpt-4o": {Input: -1}}
+	config.Models.ErrorClassifier.Variants = map[string]ModelConfig{"ruby": {}, "java": {TimeoutMs: -1}}
+	config.Models.EntityExtractor.Variants = map[string]ModelConfig{"java": {}}
+
+	err := config.Validate()
+	require.Error(t, err)
+	for _, key := range []string{
+		"sampling.normal_spans",
+		"sampling.logs.debug",
+		"processing.concurrency",
+		"output.attribute_namespace",
+		"models.importance_sampler.circuit_breaker.cool_down_ms",
+		"output.severity.logs.low",
+		"ownership.path",
+		"models.entity_extractor.sha256",
+		"models.error_classifier.negative_cache.jitter",
+		"models.importance_sampler.calibration.min",
+		"genai.prices.gpt-4o",
+		"models.error_classifier.variants.ruby",
+		"models.error_classifier.variants.java.timeout_ms",
+		"models.entity_extractor.variants",
+	} {
+		assert.Contains(t, err.Error(), key)
+	}
+}
+
+func TestValidateChecksModelPathsWhenEnabled(t *testing.T) {
+	model := filepath.Join(t.TempDir(), "model.wasm")
+	require.NoError(t, os.WriteFile(model, []byte{0}, 0o600))
+
+	config := CreateDefaultConfig().(*Config)
+	config.Models.ErrorClassifier.Path = model
+	config.Models.ImportanceSampler.Path = ""
+	config.Models.EntityExtractor.Path = filepath.Join(t.TempDir(), "missing.wasm")
+	assert.NoError(t, config.Validate(), "paths are only checked with validate_paths")
+
+	config.Models.ValidatePaths = true
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "models.entity_extractor.path")
+	assert.NotContains(t, err.Error(), "models.error_classifier.path")
+}
+
+func TestValidateChecksModelBackends(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Models.ErrorClassifier.Backend = "onnx"
+	config.Models.ErrorClassifier.Path = "classifier.onnx"
+	config.Models.ErrorClassifier.ONNX.Features = []string{"duration"}
+	assert.NoError(t, config.Validate())
+
+	config.Models.ErrorClassifier.Remote.Endpoint = "http://localhost:8000/classify"
+	config.Models.ImportanceSampler.Backend = "remote"
+	config.Models.EntityExtractor.Backend = "tflite"
+	err := config.Validate()
+	require.Error(t, err)
+	for _, key := range []string{
+		"models.error_classifier.backend",
+		"models.importance_sampler.remote.endpoint",
+		"models.entity_extractor.backend",
+	} {
+		assert.Contains(t, err.Error(), key)
+	}
+}
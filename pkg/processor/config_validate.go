@@ -0,0 +1,436 @@
+// This file contains the validation of the processor configuration, run by
+// the collector when it loads its configuration
+
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/download"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// attributeNamespacePattern matches namespaces such as "ai." or
+// "acme.ai.": dot-separated names ending with a dot
+var attributeNamespacePattern = regexp.MustCompile(`^([A-Za-z0-9_-]+\.)+$`)
+
+// sha256Pattern matches hex encoded SHA-256 digests
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Validate checks the configuration, so the collector fails to start with
+// the options at fault rather than discovering them while processing
+// telemetry. It implements xconfmap.Validator and reports every invalid
+// option at once.
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(valid bool, format string, args ...interface{}) {
+		if !valid {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	rate := func(key string, value float64) {
+		check(value >= 0 && value <= 1, "%s must be between 0.0 and 1.0, got %v", key, value)
+	}
+	nonNegative := func(key string, value int) {
+		check(value >= 0, "%s must not be negative, got %d", key, value)
+	}
+
+	for _, model := range cfg.Models.named() {
+		if model.key != "error_classifier" {
+			check(len(model.config.Variants) == 0, "models.%s.variants is only supported by the error classifier", model.key)
+		}
+	}
+	for language, variant := range cfg.Models.ErrorClassifier.Variants {
+		check(slices.Contains(logLanguages, language), "models.error_classifier.variants.%s must be one of %s",
+			language, strings.Join(logLanguages, ", "))
+		check(len(variant.Variants) == 0, "models.error_classifier.variants.%s.variants is not supported", language)
+	}
+
+	for _, model := range append(append(cfg.Models.named(), cfg.Models.variants()...), cfg.Models.Shadow.named()...) {
+		key := "models." + model.key
+		nonNegative(key+".memory_limit_mb", model.config.MemoryLimitMB)
+		nonNegative(key+".timeout_ms", model.config.TimeoutMs)
+		nonNegative(key+".instances", model.config.Instances)
+		nonNegative(key+".max_input_bytes", model.config.MaxInputBytes)
+		nonNegative(key+".projection.max_attributes", model.config.Projection.MaxAttributes)
+		nonNegative(key+".projection.max_events", model.config.Projection.MaxEvents)
+		nonNegative(key+".projection.max_stacktrace_length", model.config.Projection.MaxStacktraceLength)
+		for _, fields := range [][]string{model.config.CacheKey.Fields, model.config.CacheKey.Templates} {
+			for _, field := range fields {
+				check(field != "", "%s.cache_key fields must not be empty", key)
+			}
+		}
+
+		breaker := model.config.CircuitBreaker
+		nonNegative(key+".circuit_breaker.failure_threshold", breaker.FailureThreshold)
+		if breaker.FailureThreshold > 0 {
+			check(breaker.CoolDownMs > 0, "%s.circuit_breaker.cool_down_ms must be positive when failure_threshold is set", key)
+			nonNegative(key+".circuit_breaker.recovery_probes", breaker.RecoveryProbes)
+			switch breaker.Fallback {
+			case "", runtime.CircuitFallbackHeuristic, runtime.CircuitFallbackPassThrough:
+			default:
+				errs = append(errs, fmt.Errorf("%s.circuit_breaker.fallback must be %q or %q, got %q",
+					key, runtime.CircuitFallbackHeuristic, runtime.CircuitFallbackPassThrough, breaker.Fallback))
+			}
+		}
+
+		negative := model.config.NegativeCache
+		nonNegative(key+".negative_cache.max_entries", negative.MaxEntries)
+		if negative.MaxEntries > 0 {
+			check(negative.InitialBackoffMs > 0, "%s.negative_cache.initial_backoff_ms must be positive when max_entries is set", key)
+			nonNegative(key+".negative_cache.max_backoff_ms", negative.MaxBackoffMs)
+			rate(key+".negative_cache.jitter", negative.Jitter)
+		}
+
+		calibration := model.config.Calibration
+		switch calibration.Method {
+		case "":
+		case calibrationLinear:
+			check(calibration.Min < calibration.Max, "%s.calibration.min must be below max, got %v and %v", key, calibration.Min, calibration.Max)
+		case calibrationPiecewise:
+			check(len(calibration.Points) >= 2, "%s.calibration.points needs at least two points for the piecewise method", key)
+			raws := make(map[float64]bool, len(calibration.Points))
+			for i, point := range calibration.Points {
+				rate(fmt.Sprintf("%s.calibration.points[%d].score", key, i), point.Score)
+				check(!raws[point.Raw], "%s.calibration.points has raw score %v twice", key, point.Raw)
+				raws[point.Raw] = true
+			}
+		default:
+			check(false, "%s.calibration.method must be linear or piecewise, got %q", key, calibration.Method)
+		}
+
+		backends := model.config.backends()
+		switch model.config.Backend {
+		case "":
+		case runtime.BackendWasm:
+			check(len(backends) == 0, "%s.backend is %q but %s is configured", key, runtime.BackendWasm, strings.Join(backends, ", "))
+		case runtime.BackendONNX:
+			check(len(backends) == 0, "%s.backend is %q but %s is configured", key, runtime.BackendONNX, strings.Join(backends, ", "))
+			check(model.config.Path != "" || model.config.Ref != "", "%s.path or %s.ref is required by the onnx backend", key, key)
+			check(len(model.config.ONNX.Features) > 0, "%s.onnx.features is required by the onnx backend", key)
+		case runtime.BackendRemote:
+			check(model.config.Remote.Endpoint != "", "%s.remote.endpoint is required by the remote backend", key)
+			check(len(backends) <= 1, "%s.backend is %q but %s is configured", key, runtime.BackendRemote, strings.Join(backends, ", "))
+		default:
+			errs = append(errs, fmt.Errorf("%s.backend must be %q, %q or %q, got %q",
+				key, runtime.BackendWasm, runtime.BackendONNX, runtime.BackendRemote, model.config.Backend))
+		}
+
+		if model.config.SHA256 != "" {
+			check(download.IsURI(model.config.Path), "%s.sha256 requires a https://, s3:// or oci:// path", key)
+			check(sha256Pattern.MatchString(model.config.SHA256), "%s.sha256 must be a hex encoded SHA-256 digest", key)
+		}
+		if cfg.Models.ValidatePaths {
+			if model.config.Ref == "" && model.config.Path != "" && cfg.Models.Bundle.Path == "" && !download.IsURI(model.config.Path) && (!model.config.external() || model.config.Remote.Fallback || model.config.Backend == runtime.BackendONNX) {
+				errs = append(errs, fileExists(key+".path", model.config.Path))
+			}
+			if model.config.Rules.Path != "" {
+				errs = append(errs, fileExists(key+".rules.path", model.config.Rules.Path))
+			}
+		}
+	}
+
+	nonNegative("models.download.timeout_ms", cfg.Models.Download.TimeoutMs)
+	nonNegative("models.download.refresh_interval_ms", cfg.Models.Download.RefreshIntervalMs)
+	if cfg.Models.ValidatePaths && cfg.Models.Bundle.Path != "" {
+		errs = append(errs, fileExists("models.bundle.path", cfg.Models.Bundle.Path))
+	}
+	check(cfg.Models.Bundle.Path == "" || cfg.Models.Bundle.ExtractDir != "",
+		"models.bundle.extract_dir is required with models.bundle.path")
+
+	// Shadow invocations don't carry the residency of the items, so shadows
+	// can't use the backends residency restricts
+	rate("models.shadow.rate", cfg.Models.Shadow.Rate)
+	if cfg.Residency.Enabled {
+		for _, model := range cfg.Models.Shadow.named() {
+			for _, kind := range model.config.kinds() {
+				for label, restricted := range cfg.Residency.Restricted {
+					check(!slices.Contains(restricted, kind), "models.%s uses the %s backend, restricted for %s data",
+						model.key, kind, label)
+				}
+			}
+		}
+	}
+
+	processing := &cfg.Processing
+	check(processing.BatchSize > 0, "processing.batch_size must be positive, got %d", processing.BatchSize)
+	check(processing.Concurrency > 0, "processing.concurrency must be positive, got %d", processing.Concurrency)
+	check(processing.QueueSize > 0, "processing.queue_size must be positive, got %d", processing.QueueSize)
+	nonNegative("processing.timeout_ms", processing.TimeoutMs)
+	nonNegative("processing.max_concurrent_batches", processing.MaxConcurrentBatches)
+	nonNegative("processing.inference_threads", processing.InferenceThreads)
+	nonNegative("processing.intake_workers", processing.IntakeWorkers)
+	switch processing.IntakeOverflow {
+	case "", intakeOverflowBackpressure, intakeOverflowPassThrough:
+	default:
+		errs = append(errs, fmt.Errorf("processing.intake_overflow must be %q or %q, got %q",
+			intakeOverflowBackpressure, intakeOverflowPassThrough, processing.IntakeOverflow))
+	}
+	nonNegative("processing.max_parallel_workers", processing.MaxParallelWorkers)
+	nonNegative("processing.attribute_cache_size", processing.AttributeCacheSize)
+	nonNegative("processing.resource_cache_size", processing.ResourceCacheSize)
+	nonNegative("processing.intern_table_size", processing.InternTableSize)
+	if processing.ModelCacheResults {
+		check(processing.ModelResultsCacheSize > 0, "processing.model_results_cache_size must be positive when model_cache_results is enabled, got %d", processing.ModelResultsCacheSize)
+	}
+
+	sampling := &cfg.Sampling
+	rate("sampling.error_events", sampling.ErrorEvents)
+	rate("sampling.slow_spans", sampling.SlowSpans)
+	rate("sampling.normal_spans", sampling.NormalSpans)
+	nonNegative("sampling.threshold_ms", sampling.ThresholdMs)
+	switch sampling.Randomness {
+	case "", samplingRandomnessTraceID, samplingRandomnessW3C:
+	default:
+		errs = append(errs, fmt.Errorf("sampling.randomness must be %q or %q, got %q",
+			samplingRandomnessTraceID, samplingRandomnessW3C, sampling.Randomness))
+	}
+	rate("sampling.logs.error", sampling.Logs.Error)
+	rate("sampling.logs.warn", sampling.Logs.Warn)
+	rate("sampling.logs.info", sampling.Logs.Info)
+	rate("sampling.logs.debug", sampling.Logs.Debug)
+	if sampling.Tail.Enabled {
+		check(sampling.Tail.DecisionWaitMs > 0, "sampling.tail.decision_wait_ms must be positive when tail sampling is enabled, got %d", sampling.Tail.DecisionWaitMs)
+	}
+	nonNegative("sampling.tail.max_traces", sampling.Tail.MaxTraces)
+	if sampling.DecisionCache.Enabled {
+		check(sampling.DecisionCache.TTLMs > 0, "sampling.decision_cache.ttl_ms must be positive when the decision cache is enabled, got %d", sampling.DecisionCache.TTLMs)
+	}
+	nonNegative("sampling.decision_cache.max_traces", sampling.DecisionCache.MaxTraces)
+	if similarity := &sampling.Similarity; similarity.Enabled {
+		switch similarity.Embedder {
+		case "", embedderHashing:
+			check(similarity.Dimensions > 0, "sampling.similarity.dimensions must be positive, got %d", similarity.Dimensions)
+		case embedderWasm:
+			check(similarity.Path != "", "sampling.similarity.path is required by the wasm embedder")
+			check(similarity.Function != "", "sampling.similarity.function is required by the wasm embedder")
+		case embedderRemote:
+			check(similarity.Endpoint != "", "sampling.similarity.endpoint is required by the remote embedder")
+		default:
+			errs = append(errs, fmt.Errorf("sampling.similarity.embedder must be %q, %q or %q, got %q",
+				embedderHashing, embedderWasm, embedderRemote, similarity.Embedder))
+		}
+		rate("sampling.similarity.threshold", similarity.Threshold)
+		rate("sampling.similarity.similar_rate", similarity.SimilarRate)
+		check(similarity.MaxItems > 0, "sampling.similarity.max_items must be positive, got %d", similarity.MaxItems)
+		nonNegative("sampling.similarity.timeout_ms", similarity.TimeoutMs)
+	}
+	if adaptive := &sampling.Adaptive; adaptive.Enabled {
+		check(adaptive.TargetSpansPerSecond > 0 || adaptive.TargetBytesPerSecond > 0,
+			"sampling.adaptive requires target_spans_per_second or target_bytes_per_second when enabled")
+		check(adaptive.TargetSpansPerSecond >= 0, "sampling.adaptive.target_spans_per_second must not be negative, got %v", adaptive.TargetSpansPerSecond)
+		check(adaptive.TargetBytesPerSecond >= 0, "sampling.adaptive.target_bytes_per_second must not be negative, got %v", adaptive.TargetBytesPerSecond)
+		check(adaptive.WindowMs >= rateWindowBuckets, "sampling.adaptive.window_ms must be at least %d, got %d", rateWindowBuckets, adaptive.WindowMs)
+		rate("sampling.adaptive.min_rate", adaptive.MinRate)
+		rate("sampling.adaptive.max_rate", adaptive.MaxRate)
+		check(adaptive.MinRate <= adaptive.MaxRate, "sampling.adaptive.min_rate must not exceed max_rate, got %v and %v", adaptive.MinRate, adaptive.MaxRate)
+	}
+
+	check(attributeNamespacePattern.MatchString(cfg.Output.AttributeNamespace),
+		"output.attribute_namespace must be dot-separated names ending with a dot, such as \"ai.\", got %q", cfg.Output.AttributeNamespace)
+	nonNegative("output.max_attribute_length", cfg.Output.MaxAttributeLength)
+	switch cfg.Output.EntityFormat {
+	case "", entityFormatSlice, entityFormatJSON, entityFormatFlat:
+	default:
+		errs = append(errs, fmt.Errorf("output.entity_format must be %q, %q or %q, got %q",
+			entityFormatSlice, entityFormatJSON, entityFormatFlat, cfg.Output.EntityFormat))
+	}
+
+	if cfg.Recording.Enabled {
+		check(cfg.Recording.Path != "", "recording.path must be set when recording is enabled")
+		rate("recording.sample_rate", cfg.Recording.SampleRate)
+	}
+	nonNegative("recording.max_records", cfg.Recording.MaxRecords)
+
+	if cfg.Privacy.Enabled {
+		check(cfg.Privacy.Epsilon >= 0, "privacy.epsilon must not be negative, got %v", cfg.Privacy.Epsilon)
+		check(cfg.Privacy.Sensitivity > 0, "privacy.sensitivity must be positive, got %v", cfg.Privacy.Sensitivity)
+		nonNegative("privacy.k_anonymity", cfg.Privacy.KAnonymity)
+	}
+
+	if cfg.Quotas.Enabled {
+		check(cfg.Quotas.Hourly >= 0 && cfg.Quotas.Daily >= 0, "quotas.hourly and quotas.daily must not be negative")
+		for tenant, limits := range cfg.Quotas.Tenants {
+			check(limits.Hourly >= 0 && limits.Daily >= 0, "quotas.tenants.%s limits must not be negative", tenant)
+		}
+	}
+
+	check(cfg.LogDedup.WindowMs > 0, "log_dedup.window_ms must be positive, got %d", cfg.LogDedup.WindowMs)
+	_, ok := severityNumbers[strings.ToLower(cfg.LogDedup.MinSeverity)]
+	check(ok, "log_dedup.min_severity must be trace, debug, info, warn, error or fatal, got %q", cfg.LogDedup.MinSeverity)
+	nonNegative("log_dedup.max_groups", cfg.LogDedup.MaxGroups)
+	nonNegative("log_body.max_depth", cfg.LogBody.MaxDepth)
+	nonNegative("log_body.max_fields", cfg.LogBody.MaxFields)
+	nonNegative("log_body.max_body_bytes", cfg.LogBody.MaxBodyBytes)
+	switch cfg.MetricRollup.Gauge {
+	case "", rollupGaugeSum, rollupGaugeMean, rollupGaugeMin, rollupGaugeMax, rollupGaugeLast:
+	default:
+		errs = append(errs, fmt.Errorf("metric_rollup.gauge must be %q, %q, %q, %q or %q, got %q",
+			rollupGaugeSum, rollupGaugeMean, rollupGaugeMin, rollupGaugeMax, rollupGaugeLast, cfg.MetricRollup.Gauge))
+	}
+	check(cfg.AnomalyDetection.HistogramQuantile > 0 && cfg.AnomalyDetection.HistogramQuantile < 1,
+		"anomaly_detection.histogram_quantile must be between 0 and 1 exclusive, got %v", cfg.AnomalyDetection.HistogramQuantile)
+
+	for classified, severity := range cfg.Output.Severity.Logs {
+		_, ok := severityNumbers[strings.ToLower(severity)]
+		check(ok, "output.severity.logs.%s must be trace, debug, info, warn, error or fatal, got %q", classified, severity)
+	}
+	for classified, hint := range cfg.Output.Severity.Spans {
+		check(statusHints[strings.ToLower(hint)], "output.severity.spans.%s must be unset, ok or error, got %q", classified, hint)
+	}
+
+	nonNegative("accounting.max_services", cfg.Accounting.MaxServices)
+	nonNegative("accounting.report_interval_ms", cfg.Accounting.ReportIntervalMs)
+	nonNegative("persistence.snapshot_interval_ms", cfg.Persistence.SnapshotIntervalMs)
+	nonNegative("ownership.timeout_ms", cfg.Ownership.TimeoutMs)
+	nonNegative("ownership.refresh_interval_ms", cfg.Ownership.RefreshIntervalMs)
+	check(cfg.Ownership.Path == "" || cfg.Ownership.Endpoint == "", "ownership.path and ownership.endpoint are mutually exclusive")
+
+	if cfg.Hints.Enabled {
+		check(cfg.Hints.PriorityAttribute != "", "hints.priority_attribute must be set when hints are enabled")
+		check(cfg.Hints.SkipAttribute != "", "hints.skip_attribute must be set when hints are enabled")
+	}
+
+	models := make([]string, 0, len(cfg.GenAI.Prices))
+	for model := range cfg.GenAI.Prices {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		price := cfg.GenAI.Prices[model]
+		check(price.Input >= 0 && price.Output >= 0, "genai.prices.%s must not be negative", model)
+	}
+	for _, pattern := range cfg.GenAI.InjectionPatterns {
+		_, err := regexp.Compile(pattern)
+		check(err == nil, "genai.injection_patterns: invalid pattern %q: %v", pattern, err)
+	}
+
+	nonNegative("context_linking.ttl_ms", cfg.ContextLinking.TTLMs)
+	nonNegative("context_linking.max_traces", cfg.ContextLinking.MaxTraces)
+
+	// Tenants are checked as the configuration they resolve to, once the
+	// configuration they override is valid
+	check(len(cfg.Tenants) == 0 || cfg.Tenancy.Attribute != "", "tenants need tenancy.attribute to identify tenants")
+	if len(errs) == 0 {
+		tenants := make([]string, 0, len(cfg.Tenants))
+		for tenant := range cfg.Tenants {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+		for _, tenant := range tenants {
+			overrides := cfg.Tenants[tenant]
+			resolved, err := resolveTenantConfig(cfg, &overrides)
+			if err == nil {
+				err = resolved.Validate()
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("tenants.%s: %w", tenant, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// namedModel is a model configuration with its configuration key and the
+// name of the model in the runtime
+type namedModel struct {
+	key    string
+	name   string
+	config *ModelConfig
+}
+
+// named returns the model configurations with their configuration keys
+func (c *ModelsConfig) named() []namedModel {
+	return []namedModel{
+		{"error_classifier", runtime.ModelErrorClassifier, &c.ErrorClassifier},
+		{"importance_sampler", runtime.ModelSampler, &c.ImportanceSampler},
+		{"entity_extractor", runtime.ModelEntityExtractor, &c.EntityExtractor},
+	}
+}
+
+// variants returns the variants of the error classifier with their
+// configuration keys, in the order of their languages
+func (c *ModelsConfig) variants() []namedModel {
+	languages := make([]string, 0, len(c.ErrorClassifier.Variants))
+	for language := range c.ErrorClassifier.Variants {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	models := make([]namedModel, 0, len(languages))
+	for _, language := range languages {
+		variant := c.ErrorClassifier.Variants[language]
+		models = append(models, namedModel{"error_classifier.variants." + language, runtime.ModelErrorClassifier, &variant})
+	}
+	return models
+}
+
+// named returns the shadow model configurations with their configuration
+// keys, leaving out the models without a shadow
+func (c *ShadowConfig) named() []namedModel {
+	var models []namedModel
+	for _, model := range []namedModel{
+		{"shadow.error_classifier", runtime.ModelErrorClassifier, &c.ErrorClassifier},
+		{"shadow.importance_sampler", runtime.ModelSampler, &c.ImportanceSampler},
+		{"shadow.entity_extractor", runtime.ModelEntityExtractor, &c.EntityExtractor},
+	} {
+		if model.config.configured() {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// configured reports whether a model to invoke is configured
+func (c *ModelConfig) configured() bool {
+	return c.Path != "" || c.Ref != "" || c.external()
+}
+
+// kinds returns the kinds of the backends that may serve the model
+func (c *ModelConfig) kinds() []string {
+	if c.Backend == runtime.BackendONNX {
+		return []string{runtime.BackendONNX}
+	}
+	kinds := c.backends()
+	if !c.external() || c.Remote.Fallback {
+		kinds = append(kinds, runtime.BackendWasm)
+	}
+	return kinds
+}
+
+// backends returns the backends other than WASM whose settings are
+// configured for the model
+func (c *ModelConfig) backends() []string {
+	var backends []string
+	if len(c.Sidecar.Command) > 0 || c.Sidecar.Socket != "" {
+		backends = append(backends, runtime.BackendSidecar)
+	}
+	if c.Triton.Endpoint != "" {
+		backends = append(backends, runtime.BackendTriton)
+	}
+	if c.Remote.Endpoint != "" {
+		backends = append(backends, runtime.BackendRemote)
+	}
+	if c.Rules.Path != "" && !c.Rules.Prefilter {
+		backends = append(backends, runtime.BackendRules)
+	}
+	return backends
+}
+
+// fileExists returns an error naming key if path is not a readable file
+func fileExists(key string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s: %s is a directory", key, path)
+	}
+	return nil
+}
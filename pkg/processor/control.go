@@ -0,0 +1,749 @@
+// This file contains the runtime-adjustable state shared by the processors
+// created from one configuration, and the control plane that adjusts it
+
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/control"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/ownership"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/quota"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Signal names used in statistics
+const (
+	signalTraces  = "traces"
+	signalLogs    = "logs"
+	signalMetrics = "metrics"
+)
+
+// controlState holds the live configuration and the model runtime shared by
+// all processors created from one configuration, so the traces, logs and
+// metrics pipelines load the models and cache their results once. The live
+// configuration is replaced atomically, so processors read it without
+// locking.
+type controlState struct {
+	key     *Config
+	set     component.TelemetrySettings
+	logger  *zap.Logger
+	config  atomic.Pointer[Config]
+	started time.Time
+
+	mutex   sync.Mutex
+	runtime *runtime.WasmRuntime
+	shadow  *shadowEvaluator // nil unless shadow models are evaluated
+
+	// Variants of the error classifier by log language, nil if none
+	variants classifierVariants
+
+	refs   int
+	server *control.Server
+	admin  *control.HTTPServer
+	opamp  stopper
+
+	// Watcher reloading changed model files, nil if disabled
+	watcher *modelWatcher
+
+	// Provenance of the loaded models, recorded on the items they enrich
+	provenance *modelProvenances
+
+	// Refresher of the models downloaded from URIs, nil unless refreshed
+	refresher *modelRefresher
+
+	// Per-tenant model invocation quota and its metrics registration
+	quota        *quota.Tracker
+	quotaMetrics metric.Registration
+
+	// Metrics registration of the shared caches
+	cacheMetrics metric.Registration
+
+	// Metrics registration of the items processed and the models
+	processorMetrics metric.Registration
+
+	// Slots of the batches processed at once, nil if unbounded
+	batches chan struct{}
+
+	// Traces remembered to link logs with spans across signals
+	links *linkStore
+
+	// Embeddings of recently kept items, nil unless similarity sampling is
+	// enabled
+	similarity *similaritySampler
+
+	// Traces whose spans were kept, shared by the traces processors, nil
+	// unless the decision cache is enabled
+	decisions *decisionCache
+
+	// Snapshots of the caches, nil unless persistence is enabled
+	persistence *cachePersistence
+
+	// Team registry classified errors are mapped to, nil unless configured
+	ownership *ownership.Source
+
+	// Controller of the normal spans rate, nil unless adaptive sampling is
+	// enabled
+	adaptive *rateController
+
+	// Volume kept and dropped per service, nil unless accounting is
+	// enabled
+	accounting *costAccounting
+
+	// Configurations of the tenants with overrides, resolved from the live
+	// configuration
+	tenants atomic.Pointer[tenantConfigs]
+
+	// Allocation telemetry, nil if disabled, and the restoring of the GC
+	// settings in place before the state was created
+	memory    *memoryTelemetry
+	restoreGC func()
+
+	// Per signal counters of items received and dropped
+	received map[string]*atomic.Int64
+	dropped  map[string]*atomic.Int64
+}
+
+// stopper is implemented by management agents started with the state
+type stopper interface {
+	Stop(ctx context.Context) error
+}
+
+var (
+	controlStatesMutex sync.Mutex
+	controlStates      = make(map[*Config]*controlState)
+)
+
+// acquireControlState returns the state shared by processors using config,
+// started, loading the models and starting the control-plane server when
+// the first processor is created
+func acquireControlState(set component.TelemetrySettings, config *Config) (*controlState, error) {
+	state := referenceControlState(set, config)
+	if err := state.start(); err != nil {
+		state.release()
+		return nil, err
+	}
+	return state, nil
+}
+
+// referenceControlState returns the state shared by processors using
+// config without starting it, so creating processors stays cheap and free
+// of side effects, as collector builds and distributions validating their
+// configuration expect. The models are loaded when a processor starts.
+func referenceControlState(set component.TelemetrySettings, config *Config) *controlState {
+	controlStatesMutex.Lock()
+	defer controlStatesMutex.Unlock()
+
+	state, ok := controlStates[config]
+	if !ok {
+		state = &controlState{
+			key:      config,
+			set:      set,
+			logger:   set.Logger,
+			started:  time.Now(),
+			received: make(map[string]*atomic.Int64),
+			dropped:  make(map[string]*atomic.Int64),
+		}
+		for _, signal := range []string{signalTraces, signalLogs, signalMetrics} {
+			state.received[signal] = &atomic.Int64{}
+			state.dropped[signal] = &atomic.Int64{}
+		}
+
+		// Processors work on a copy so control-plane updates never modify the
+		// configuration owned by the collector
+		live := *config
+		state.config.Store(&live)
+
+		if config.Processing.MaxConcurrentBatches > 0 {
+			state.batches = make(chan struct{}, config.Processing.MaxConcurrentBatches)
+		}
+		state.links = newLinkStore(&config.ContextLinking)
+		state.decisions = newDecisionCache(&config.Sampling.DecisionCache)
+		state.adaptive = newRateController(&config.Sampling.Adaptive, config.Sampling.NormalSpans, time.Now())
+		state.accounting = newCostAccounting(set.Logger, &config.Accounting)
+		controlStates[config] = state
+	}
+
+	state.refs++
+	return state
+}
+
+// start loads the models and starts the control plane and the management
+// agents, when the first of the processors sharing the state starts
+func (s *controlState) start() error {
+	controlStatesMutex.Lock()
+	defer controlStatesMutex.Unlock()
+
+	if s.runtime != nil {
+		return nil
+	}
+	set, logger, config := s.set, s.logger, s.key
+
+	wasmRuntime, shadow, provenances, err := newWasmRuntime(logger, config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize WASM runtime: %w", err)
+	}
+	s.runtime = wasmRuntime
+	s.shadow = shadow
+	s.provenance = provenances
+
+	variants, err := newClassifierVariants(logger, config)
+	if err != nil {
+		s.closeRuntime()
+		return fmt.Errorf("failed to initialize error classifier variants: %w", err)
+	}
+	s.variants = variants
+
+	// The indexes of kept items are shared by the processors of a signal
+	similarity, err := newSimilaritySampler(logger, config)
+	if err != nil {
+		s.closeRuntime()
+		return fmt.Errorf("failed to initialize similarity sampling: %w", err)
+	}
+	s.similarity = similarity
+
+	// Restore the caches of the previous run before processing anything
+	persistence, err := openCachePersistence(logger, &config.Persistence, wasmRuntime, s.decisions)
+	if err != nil {
+		s.closeRuntime()
+		return fmt.Errorf("failed to open persisted caches: %w", err)
+	}
+	s.persistence = persistence
+
+	source, err := openOwnership(logger, &config.Ownership)
+	if err != nil {
+		s.closeRuntime()
+		return fmt.Errorf("failed to open team registry: %w", err)
+	}
+	s.ownership = source
+
+	// The caches are shared by all processors in the process
+	if err := configureCaches(&config.Processing); err != nil {
+		s.closeRuntime()
+		return fmt.Errorf("failed to configure caches: %w", err)
+	}
+	registration, err := registerCacheMetrics(set.MeterProvider)
+	if err != nil {
+		s.closeRuntime()
+		return fmt.Errorf("failed to register cache metrics: %w", err)
+	}
+	s.cacheMetrics = registration
+
+	// The processors' own telemetry
+	models, err := newModelTelemetry(set.MeterProvider)
+	if err != nil {
+		s.unregisterMetrics()
+		s.closeRuntime()
+		return fmt.Errorf("failed to create model metrics: %w", err)
+	}
+	wasmRuntime.SetObserver(models)
+	registration, err = registerProcessorMetrics(set.MeterProvider, s)
+	if err != nil {
+		s.unregisterMetrics()
+		s.closeRuntime()
+		return fmt.Errorf("failed to register processor metrics: %w", err)
+	}
+	s.processorMetrics = registration
+
+	memory, err := newMemoryTelemetry(set.MeterProvider, &config.Memory)
+	if err != nil {
+		s.unregisterMetrics()
+		s.closeRuntime()
+		return fmt.Errorf("failed to create memory metrics: %w", err)
+	}
+	s.memory = memory
+
+	// Quotas are shared by all signals so a tenant has one budget
+	if config.Quotas.Enabled {
+		s.quota = newQuotaTracker(&config.Quotas)
+		s.runtime.SetQuota(s.quota)
+		registration, err := registerQuotaMetrics(set.MeterProvider, s.quota)
+		if err != nil {
+			s.unregisterMetrics()
+			s.closeRuntime()
+			return fmt.Errorf("failed to register quota metrics: %w", err)
+		}
+		s.quotaMetrics = registration
+	}
+
+	if config.Models.AutoReload {
+		watcher, err := startModelWatcher(logger, s)
+		if err != nil {
+			s.unregisterMetrics()
+			s.closeRuntime()
+			return fmt.Errorf("failed to watch model files: %w", err)
+		}
+		s.watcher = watcher
+	}
+	s.refresher = startModelRefresher(logger, s)
+
+	security, err := controlSecurity(&config.ControlPlane)
+	if err != nil {
+		s.stopWatcher()
+		s.unregisterMetrics()
+		s.closeRuntime()
+		return err
+	}
+
+	if config.ControlPlane.GRPCEndpoint != "" {
+		server, err := control.Start(logger, config.ControlPlane.GRPCEndpoint, security, s)
+		if err != nil {
+			s.stopWatcher()
+			s.unregisterMetrics()
+			s.closeRuntime()
+			return fmt.Errorf("failed to start control-plane service: %w", err)
+		}
+		s.server = server
+	}
+
+	if config.ControlPlane.HTTPEndpoint != "" {
+		admin, err := control.StartHTTP(logger, config.ControlPlane.HTTPEndpoint, security, s)
+		if err != nil {
+			s.stopServers()
+			s.stopWatcher()
+			s.unregisterMetrics()
+			s.closeRuntime()
+			return fmt.Errorf("failed to start control-plane HTTP service: %w", err)
+		}
+		s.admin = admin
+	}
+
+	if config.ControlPlane.OpAMP.Endpoint != "" {
+		agent, err := startOpAMP(logger, &config.ControlPlane.OpAMP, s)
+		if err != nil {
+			s.stopServers()
+			s.stopWatcher()
+			s.unregisterMetrics()
+			s.closeRuntime()
+			return fmt.Errorf("failed to start OpAMP client: %w", err)
+		}
+		s.opamp = agent
+	}
+
+	// GC settings apply to the whole process until the state is released
+	s.restoreGC = tuneGC(logger, &config.Memory)
+	s.accounting.start()
+	return nil
+}
+
+// release drops a processor's reference, stopping the control-plane server
+// and closing the runtime when the last processor is shut down
+func (s *controlState) release() error {
+	controlStatesMutex.Lock()
+	defer controlStatesMutex.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	delete(controlStates, s.key)
+	s.accounting.shutdown()
+	s.stopWatcher()
+	s.stopServers()
+	if s.opamp != nil {
+		if err := s.opamp.Stop(context.Background()); err != nil {
+			s.logger.Warn("Failed to stop OpAMP client", zap.Error(err))
+		}
+	}
+	s.unregisterMetrics()
+	if s.restoreGC != nil {
+		s.restoreGC()
+	}
+	return s.closeRuntime()
+}
+
+// stopServers stops the control-plane services
+func (s *controlState) stopServers() {
+	if s.server != nil {
+		s.server.Stop()
+		s.server = nil
+	}
+	if s.admin != nil {
+		s.admin.Stop()
+		s.admin = nil
+	}
+}
+
+// stopWatcher stops reloading changed model files and downloaded models
+func (s *controlState) stopWatcher() {
+	if s.watcher != nil {
+		s.watcher.Stop()
+		s.watcher = nil
+	}
+	if s.refresher != nil {
+		s.refresher.Stop()
+		s.refresher = nil
+	}
+}
+
+// closeRuntime persists the caches and closes the shared runtime and
+// embedder
+func (s *controlState) closeRuntime() error {
+	if err := s.persistence.close(); err != nil {
+		s.logger.Warn("Failed to persist caches", zap.Error(err))
+	}
+	s.persistence = nil
+	if err := s.similarity.close(); err != nil {
+		s.logger.Warn("Failed to close embedder", zap.Error(err))
+	}
+	s.similarity = nil
+	if s.ownership != nil {
+		s.ownership.Close()
+		s.ownership = nil
+	}
+	if err := s.variants.close(); err != nil {
+		s.logger.Warn("Failed to close error classifier variants", zap.Error(err))
+	}
+	s.variants = nil
+	if s.runtime == nil {
+		return nil
+	}
+	err := s.runtime.Close()
+	s.runtime = nil
+	s.shadow = nil
+	if err != nil {
+		return fmt.Errorf("failed to close WASM runtime: %w", err)
+	}
+	return nil
+}
+
+// unregisterMetrics stops reporting the metrics registered for the state
+func (s *controlState) unregisterMetrics() {
+	for _, registration := range []metric.Registration{s.cacheMetrics, s.processorMetrics, s.quotaMetrics} {
+		if registration == nil {
+			continue
+		}
+		if err := registration.Unregister(); err != nil {
+			s.logger.Warn("Failed to unregister metrics", zap.Error(err))
+		}
+	}
+	s.cacheMetrics, s.processorMetrics, s.quotaMetrics = nil, nil, nil
+}
+
+// current returns the live configuration
+func (s *controlState) current() *Config {
+	return s.config.Load()
+}
+
+// acquireBatch waits for a slot to process a batch in and returns the
+// function releasing it, or fails if ctx is done first. Waiting batches hold
+// back their pipelines, so bursts of batches don't overwhelm the workers
+// and the runtime.
+func (s *controlState) acquireBatch(ctx context.Context) (func(), error) {
+	if s.batches == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.batches <- struct{}{}:
+		return func() { <-s.batches }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting to process batch: %w", ctx.Err())
+	}
+}
+
+// recordBatch counts the items a processor received and dropped
+func (s *controlState) recordBatch(signal string, received, kept int) {
+	s.received[signal].Add(int64(received))
+	s.dropped[signal].Add(int64(received - kept))
+}
+
+// update applies fn to a copy of the live configuration and publishes it
+func (s *controlState) update(fn func(*Config) error) (*Config, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	next := *s.config.Load()
+	if err := fn(&next); err != nil {
+		return nil, err
+	}
+	s.config.Store(&next)
+	return &next, nil
+}
+
+// ReloadModel implements control.Controller
+func (s *controlState) ReloadModel(ctx context.Context, model string, path string) error {
+	if err := s.reloadModel(model, path); err != nil {
+		return err
+	}
+	s.logger.Info("Model reloaded by control plane", zap.String("model", model), zap.String("path", path))
+	return nil
+}
+
+// reloadModel loads a model from path and records the path in the live
+// configuration
+func (s *controlState) reloadModel(model string, path string) error {
+	switch model {
+	case runtime.ModelErrorClassifier, runtime.ModelSampler, runtime.ModelEntityExtractor:
+	default:
+		return fmt.Errorf("unknown model %q", model)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.runtime.ReloadModel(model, path); err != nil {
+		return err
+	}
+	s.provenance.reload(model, modelFileName(path), path)
+
+	// Record the new path in the effective configuration
+	next := *s.config.Load()
+	setModelPath(&next, model, path)
+	s.config.Store(&next)
+	return nil
+}
+
+// setModelPath sets the configured path of a model
+func setModelPath(config *Config, model string, path string) {
+	switch model {
+	case runtime.ModelErrorClassifier:
+		config.Models.ErrorClassifier.Path = path
+	case runtime.ModelSampler:
+		config.Models.ImportanceSampler.Path = path
+	case runtime.ModelEntityExtractor:
+		config.Models.EntityExtractor.Path = path
+	}
+}
+
+// UpdateSampling implements control.Controller
+func (s *controlState) UpdateSampling(ctx context.Context, rates map[string]float64) (map[string]interface{}, error) {
+	config, err := s.update(func(config *Config) error {
+		return setSamplingRates(config, rates)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A new normal spans rate restarts the controller from it
+	if value, ok := rates["normal_spans"]; ok {
+		s.adaptive.reset(value)
+	}
+	if len(rates) > 0 {
+		s.logger.Info("Sampling updated by control plane", zap.Any("sampling", config.Sampling))
+	}
+	return samplingMap(&config.Sampling), nil
+}
+
+// setSamplingRates sets the sampling rates of config, keyed as in the
+// control API
+func setSamplingRates(config *Config, rates map[string]float64) error {
+	for key, value := range rates {
+		switch key {
+		case "error_events", "slow_spans", "normal_spans", "logs.error", "logs.warn", "logs.info", "logs.debug":
+			if value < 0 || value > 1 {
+				return fmt.Errorf("%s must be between 0.0 and 1.0", key)
+			}
+		}
+
+		switch key {
+		case "error_events":
+			config.Sampling.ErrorEvents = value
+		case "slow_spans":
+			config.Sampling.SlowSpans = value
+		case "normal_spans":
+			config.Sampling.NormalSpans = value
+		case "threshold_ms":
+			config.Sampling.ThresholdMs = int(value)
+		case "logs.error":
+			config.Sampling.Logs.Error = value
+		case "logs.warn":
+			config.Sampling.Logs.Warn = value
+		case "logs.info":
+			config.Sampling.Logs.Info = value
+		case "logs.debug":
+			config.Sampling.Logs.Debug = value
+		default:
+			return fmt.Errorf("unknown sampling setting %q", key)
+		}
+	}
+	return nil
+}
+
+// SetFeatures implements control.Controller
+func (s *controlState) SetFeatures(ctx context.Context, features map[string]bool) (map[string]interface{}, error) {
+	config, err := s.update(func(config *Config) error {
+		for key, enabled := range features {
+			switch key {
+			case "error_classification":
+				config.Features.ErrorClassification = enabled
+			case "smart_sampling":
+				config.Features.SmartSampling = enabled
+			case "entity_extraction":
+				config.Features.EntityExtraction = enabled
+			case "context_linking":
+				config.Features.ContextLinking = enabled
+			case "pii_redaction":
+				config.Features.PIIRedaction = enabled
+			case "anomaly_detection":
+				config.Features.AnomalyDetection = enabled
+			case "log_dedup":
+				config.Features.LogDedup = enabled
+			case "name_normalization":
+				config.Features.NameNormalization = enabled
+			case "genai":
+				config.Features.GenAI = enabled
+			default:
+				return fmt.Errorf("unknown feature %q", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(features) > 0 {
+		s.logger.Info("Features updated by control plane", zap.Any("features", config.Features))
+	}
+	return featuresMap(&config.Features), nil
+}
+
+// Stats implements control.Controller
+func (s *controlState) Stats(ctx context.Context) (map[string]interface{}, error) {
+	config := s.current()
+
+	signals := make(map[string]interface{})
+	for signal, received := range s.received {
+		signals[signal] = map[string]interface{}{
+			"received": received.Load(),
+			"dropped":  s.dropped[signal].Load(),
+		}
+	}
+
+	stats := map[string]interface{}{
+		"uptime_seconds": int64(time.Since(s.started).Seconds()),
+		"signals":        signals,
+		"runtime":        s.runtime.Stats(),
+		"sampling":       samplingMap(&config.Sampling),
+		"features":       featuresMap(&config.Features),
+		"models":         modelVersions(config, s.provenance),
+		"caches":         cacheStatsMap(),
+	}
+	if s.quota != nil {
+		stats["quotas"] = quotaUsageMap(s.quota)
+	}
+	if s.adaptive != nil {
+		stats["adaptive_sampling"] = s.adaptive.stats()
+	}
+	if s.accounting != nil {
+		stats["accounting"] = s.accounting.stats()
+	}
+	return stats, nil
+}
+
+// CacheStats implements control.Controller
+func (s *controlState) CacheStats(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"models": s.runtime.CacheStats(),
+		"caches": cacheStatsMap(),
+	}, nil
+}
+
+// ClearCache implements control.Controller
+func (s *controlState) ClearCache(ctx context.Context, tenant string) (map[string]interface{}, error) {
+	if tenant == "" {
+		s.runtime.ClearCaches()
+	} else {
+		s.runtime.ClearCache(tenant)
+	}
+	s.logger.Info("Model result caches cleared by control plane", zap.String("tenant", tenant))
+	return s.CacheStats(ctx)
+}
+
+// controlSecurity returns how the control-plane endpoints are secured
+func controlSecurity(config *ControlPlaneConfig) (control.Security, error) {
+	security := control.Security{BearerToken: string(config.BearerToken)}
+	if config.TLS != nil && (config.GRPCEndpoint != "" || config.HTTPEndpoint != "") {
+		tlsConfig, err := config.TLS.LoadTLSConfig(context.Background())
+		if err != nil {
+			return security, fmt.Errorf("invalid control-plane TLS settings: %w", err)
+		}
+		security.TLS = tlsConfig
+	}
+	return security, nil
+}
+
+// modelPaths returns the path of each configured model
+func modelPaths(config *Config) map[string]string {
+	return map[string]string{
+		runtime.ModelErrorClassifier: config.Models.ErrorClassifier.Path,
+		runtime.ModelSampler:         config.Models.ImportanceSampler.Path,
+		runtime.ModelEntityExtractor: config.Models.EntityExtractor.Path,
+	}
+}
+
+// modelVersions returns the local file and SHA-256 digest each model was
+// loaded from, as recorded in its provenance, and the path and digest of the
+// model bundle. Models without a provenance report their configured path.
+func modelVersions(config *Config, provenances *modelProvenances) map[string]interface{} {
+	models := modelPaths(config)
+
+	versions := make(map[string]interface{}, len(models))
+	for model, path := range models {
+		version := map[string]interface{}{"path": path}
+		if provenance := provenances.get(model); provenance != nil && provenance.file != "" {
+			version["path"] = provenance.file
+			if provenance.hash != "" {
+				version["sha256"] = provenance.hash
+			}
+		}
+		versions[model] = version
+	}
+	if bundle := config.Models.Bundle.Path; bundle != "" {
+		version := map[string]interface{}{"path": bundle}
+		if digest, err := runtime.FileSHA256(bundle); err == nil {
+			version["sha256"] = digest
+		}
+		versions["bundle"] = version
+	}
+	return versions
+}
+
+// effectiveConfigJSON encodes the live configuration with its configuration
+// keys, as reported to management servers
+func effectiveConfigJSON(config *Config) ([]byte, error) {
+	conf := confmap.New()
+	if err := conf.Marshal(config); err != nil {
+		return nil, err
+	}
+	return json.Marshal(conf.ToStringMap())
+}
+
+// samplingMap returns the sampling settings keyed by their configuration names
+func samplingMap(sampling *SamplingConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"error_events": sampling.ErrorEvents,
+		"slow_spans":   sampling.SlowSpans,
+		"normal_spans": sampling.NormalSpans,
+		"threshold_ms": sampling.ThresholdMs,
+		"logs.error":   sampling.Logs.Error,
+		"logs.warn":    sampling.Logs.Warn,
+		"logs.info":    sampling.Logs.Info,
+		"logs.debug":   sampling.Logs.Debug,
+	}
+}
+
+// featuresMap returns the feature toggles keyed by their configuration names
+func featuresMap(features *FeaturesConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"error_classification": features.ErrorClassification,
+		"smart_sampling":       features.SmartSampling,
+		"entity_extraction":    features.EntityExtraction,
+		"context_linking":      features.ContextLinking,
+		"pii_redaction":        features.PIIRedaction,
+		"anomaly_detection":    features.AnomalyDetection,
+		"log_dedup":            features.LogDedup,
+		"name_normalization":   features.NameNormalization,
+		"genai":                features.GenAI,
+	}
+}
@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/control"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// nopTelemetry returns telemetry settings that discard logs and metrics
+func nopTelemetry() component.TelemetrySettings {
+	return component.TelemetrySettings{
+		Logger:        zap.NewNop(),
+		MeterProvider: noop.NewMeterProvider(),
+	}
+}
+
+// configWithoutModels returns the default configuration without model
+// paths, so acquiring its state loads no models in the fullwasm build either
+func configWithoutModels() *Config {
+	config := CreateDefaultConfig().(*Config)
+	config.Models.ErrorClassifier.Path = ""
+	config.Models.ImportanceSampler.Path = ""
+	config.Models.EntityExtractor.Path = ""
+	return config
+}
+
+func TestControlPlaneUpdatesLiveConfig(t *testing.T) {
+	config := configWithoutModels()
+	config.ControlPlane.GRPCEndpoint = "127.0.0.1:0"
+
+	state, err := acquireControlState(nopTelemetry(), config)
+	require.NoError(t, err)
+	defer state.release()
+
+	// A second processor shares the state and its models
+	shared, err := acquireControlState(nopTelemetry(), config)
+	require.NoError(t, err)
+	assert.Same(t, state, shared)
+	assert.Same(t, state.runtime, shared.runtime)
+	require.NoError(t, shared.release())
+
+	conn, err := grpc.NewClient(state.server.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+
+	sampling, err := control.Call(ctx, conn, control.MethodUpdateSampling, map[string]interface{}{"normal_spans": 0.05})
+	require.NoError(t, err)
+	assert.Equal(t, 0.05, sampling["normal_spans"])
+	assert.Equal(t, 0.05, state.current().Sampling.NormalSpans)
+
+	// The collector's configuration is never modified
+	assert.Equal(t, 0.1, config.Sampling.NormalSpans)
+
+	features, err := control.Call(ctx, conn, control.MethodSetFeatures, map[string]interface{}{"smart_sampling": false})
+	require.NoError(t, err)
+	assert.Equal(t, false, features["smart_sampling"])
+	assert.False(t, state.current().Features.SmartSampling)
+
+	_, err = control.Call(ctx, conn, control.MethodUpdateSampling, map[string]interface{}{"normal_spans": 2.0})
+	assert.Error(t, err)
+	_, err = control.Call(ctx, conn, control.MethodReloadModel, map[string]interface{}{"model": "unknown", "path": "/x.wasm"})
+	assert.Error(t, err)
+
+	state.recordBatch(signalTraces, 10, 4)
+	stats, err := control.Call(ctx, conn, control.MethodGetStats, nil)
+	require.NoError(t, err)
+	traces := stats["signals"].(map[string]interface{})[signalTraces].(map[string]interface{})
+	assert.Equal(t, 10.0, traces["received"])
+	assert.Equal(t, 6.0, traces["dropped"])
+	assert.Contains(t, stats, "runtime")
+}
+
+func TestControlPlaneSecurity(t *testing.T) {
+	config := configWithoutModels()
+	config.ControlPlane.GRPCEndpoint = ":0"
+	config.ControlPlane.BearerToken = "s3cret"
+
+	state, err := acquireControlState(nopTelemetry(), config)
+	require.NoError(t, err)
+	defer state.release()
+
+	conn, err := grpc.NewClient(state.server.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = control.Call(context.Background(), conn, control.MethodGetStats, nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// TLS settings that can't be loaded fail the processor
+	config = configWithoutModels()
+	config.ControlPlane.GRPCEndpoint = "127.0.0.1:0"
+	config.ControlPlane.TLS = &configtls.ServerConfig{Config: configtls.Config{CertFile: "missing.crt", KeyFile: "missing.key"}}
+	_, err = acquireControlState(nopTelemetry(), config)
+	assert.ErrorContains(t, err, "control-plane TLS")
+}
+
+func TestEffectiveConfigAndModelVersions(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	model := filepath.Join(t.TempDir(), "sampler.wasm")
+	require.NoError(t, os.WriteFile(model, []byte("model"), 0o600))
+	config.Models.ImportanceSampler.Path = model
+
+	body, err := effectiveConfigJSON(config)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Contains(t, decoded, "models")
+	assert.Contains(t, decoded, "control_plane")
+
+	provenances := newModelProvenances([3]*modelProvenance{nil, newModelProvenance("sampler", "", model), nil})
+	versions := modelVersions(config, provenances)
+	sampler := versions[runtime.ModelSampler].(map[string]interface{})
+	assert.Equal(t, model, sampler["path"])
+	assert.Equal(t, "9372c470eeadd5ecd9c3c74c2b3cb633f8e2f2fad799250a0f70d652b6b825e4", sampler["sha256"])
+	assert.NotContains(t, versions[runtime.ModelErrorClassifier], "sha256")
+}
+
+func TestEffectiveConfigRedactsHeaders(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Models.Registry.Headers = map[string]configopaque.String{"Authorization": "Bearer registry-secret"}
+	config.Models.ErrorClassifier.Remote.Headers = map[string]configopaque.String{"X-Api-Key": "remote-secret"}
+
+	body, err := effectiveConfigJSON(config)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "secret")
+	assert.Contains(t, string(body), "Authorization")
+}
+
+func TestAcquireBatchBoundsConcurrentBatches(t *testing.T) {
+	config := configWithoutModels()
+	config.Processing.MaxConcurrentBatches = 1
+
+	state, err := acquireControlState(nopTelemetry(), config)
+	require.NoError(t, err)
+	defer state.release()
+
+	release, err := state.acquireBatch(context.Background())
+	require.NoError(t, err)
+
+	// Further batches wait until the slot is released or their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = state.acquireBatch(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release, err = state.acquireBatch(context.Background())
+	require.NoError(t, err)
+	release()
+}
@@ -0,0 +1,112 @@
+// This file contains the cache of kept traces used to keep the later spans
+// of a trace once any of its spans was kept
+
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// decisionCache remembers the traces whose spans were kept. Traces are
+// forgotten ttl after they were first kept, and the oldest are forgotten
+// early beyond maxTraces. A nil cache remembers nothing.
+type decisionCache struct {
+	ttl       time.Duration
+	maxTraces int
+
+	mutex sync.Mutex
+	kept  map[pcommon.TraceID]struct{}
+	order []keptTrace // in keeping order, which is expiry order
+}
+
+// keptTrace is a trace remembered by the cache
+type keptTrace struct {
+	id   pcommon.TraceID
+	kept time.Time
+}
+
+// newDecisionCache creates a cache for the decision cache configuration,
+// nil if it is disabled
+func newDecisionCache(config *DecisionCacheConfig) *decisionCache {
+	if !config.Enabled {
+		return nil
+	}
+	return &decisionCache{
+		ttl:       time.Duration(config.TTLMs) * time.Millisecond,
+		maxTraces: config.MaxTraces,
+		kept:      make(map[pcommon.TraceID]struct{}),
+	}
+}
+
+// add remembers that spans of the trace were kept at now
+func (c *decisionCache) add(id pcommon.TraceID, now time.Time) {
+	if c == nil || id.IsEmpty() {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.expire(now)
+
+	if _, ok := c.kept[id]; ok {
+		return
+	}
+	c.kept[id] = struct{}{}
+	c.order = append(c.order, keptTrace{id: id, kept: now})
+	for c.maxTraces > 0 && len(c.kept) > c.maxTraces {
+		c.pop()
+	}
+}
+
+// contains reports whether spans of the trace were kept within the TTL
+func (c *decisionCache) contains(id pcommon.TraceID, now time.Time) bool {
+	if c == nil || id.IsEmpty() {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.expire(now)
+
+	_, ok := c.kept[id]
+	return ok
+}
+
+// expire forgets the traces kept longer than the TTL ago. The caller holds
+// the mutex.
+func (c *decisionCache) expire(now time.Time) {
+	for len(c.order) > 0 && now.Sub(c.order[0].kept) >= c.ttl {
+		c.pop()
+	}
+}
+
+// pop forgets the oldest trace. The caller holds the mutex.
+func (c *decisionCache) pop() {
+	delete(c.kept, c.order[0].id)
+	c.order = c.order[1:]
+}
+
+// snapshot calls fn with the traces remembered at now, oldest first
+func (c *decisionCache) snapshot(now time.Time, fn func(id pcommon.TraceID, kept time.Time)) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	c.expire(now)
+	order := append([]keptTrace(nil), c.order...)
+	c.mutex.Unlock()
+
+	for _, trace := range order {
+		fn(trace.id, trace.kept)
+	}
+}
+
+// restore remembers a trace of a snapshot kept at kept, unless its TTL
+// passed by now. Traces must be restored oldest first.
+func (c *decisionCache) restore(id pcommon.TraceID, kept time.Time, now time.Time) {
+	if c == nil || now.Sub(kept) >= c.ttl {
+		return
+	}
+	c.add(id, kept)
+}
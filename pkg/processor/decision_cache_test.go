@@ -0,0 +1,34 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestDecisionCacheForgetsExpiredAndOldestTraces(t *testing.T) {
+	cache := newDecisionCache(&DecisionCacheConfig{Enabled: true, TTLMs: 1000, MaxTraces: 2})
+	start := time.Unix(0, 0)
+	first, second, third := pcommon.TraceID([16]byte{1}), pcommon.TraceID([16]byte{2}), pcommon.TraceID([16]byte{3})
+
+	cache.add(first, start)
+	cache.add(second, start.Add(500*time.Millisecond))
+	assert.True(t, cache.contains(first, start.Add(500*time.Millisecond)))
+	assert.False(t, cache.contains(third, start.Add(500*time.Millisecond)))
+
+	// The oldest trace is forgotten beyond the maximum
+	cache.add(third, start.Add(600*time.Millisecond))
+	assert.False(t, cache.contains(first, start.Add(600*time.Millisecond)))
+	assert.True(t, cache.contains(second, start.Add(600*time.Millisecond)))
+
+	// Traces are forgotten once their TTL has passed
+	assert.False(t, cache.contains(second, start.Add(1500*time.Millisecond)))
+	assert.True(t, cache.contains(third, start.Add(1500*time.Millisecond)))
+
+	// Disabled caches remember nothing
+	disabled := newDecisionCache(&DecisionCacheConfig{TTLMs: 1000})
+	disabled.add(first, start)
+	assert.False(t, disabled.contains(first, start))
+}
@@ -0,0 +1,7 @@
+//go:generate mdatagen metadata.yaml
+
+// Package processor implements the ai_processor, which enriches, samples and
+// redacts telemetry with models. NewFactory is the component to add to a
+// collector, including distributions built with the OpenTelemetry Collector
+// Builder.
+package processor
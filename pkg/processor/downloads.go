@@ -0,0 +1,139 @@
+// This file contains the refreshing of models downloaded from remote URIs,
+// which are downloaded again periodically and reloaded when they change
+
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/download"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// newDownloadClient creates the client downloading the models of config
+func newDownloadClient(config *DownloadConfig) *download.Client {
+	return download.NewClient(download.Config{
+		CacheDir: config.CacheDir,
+		Headers:  headerValues(config.Headers),
+		Timeout:  time.Duration(config.TimeoutMs) * time.Millisecond,
+	})
+}
+
+// modelRefresher downloads the models of a state with a URI as path again
+// at every interval, and reloads the ones that changed
+type modelRefresher struct {
+	logger *zap.Logger
+	state  *controlState
+	client *download.Client
+
+	// The URI and the digest of the last download of each model
+	uris    map[string]string
+	digests map[string]string
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startModelRefresher refreshes the models of a state downloaded from a URI
+// without a pinned digest. It returns nil if there are none or refreshing
+// is disabled.
+func startModelRefresher(logger *zap.Logger, state *controlState) *modelRefresher {
+	models := &state.current().Models
+	if models.Download.RefreshIntervalMs <= 0 || models.Bundle.Path != "" {
+		return nil
+	}
+
+	r := &modelRefresher{
+		logger:  logger,
+		state:   state,
+		client:  newDownloadClient(&models.Download),
+		uris:    make(map[string]string),
+		digests: make(map[string]string),
+		done:    make(chan struct{}),
+	}
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		if model.Ref != "" || model.SHA256 != "" || !download.IsURI(model.Path) {
+			continue
+		}
+		r.uris[name] = model.Path
+
+		// The model was downloaded to the cache when it was loaded
+		if path, err := r.client.CachePath(model.Path); err == nil {
+			r.digests[name], _ = runtime.FileSHA256(path)
+		}
+	}
+	if len(r.uris) == 0 {
+		return nil
+	}
+
+	r.wg.Add(1)
+	go r.run(time.Duration(models.Download.RefreshIntervalMs) * time.Millisecond)
+	return r
+}
+
+// run refreshes the models at every interval until the refresher is stopped
+func (r *modelRefresher) run(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// refresh downloads the models again and reloads the ones whose digest
+// changed
+func (r *modelRefresher) refresh() {
+	models := &r.state.current().Models
+	paths := map[string]string{
+		runtime.ModelErrorClassifier: models.ErrorClassifier.Path,
+		runtime.ModelSampler:         models.ImportanceSampler.Path,
+		runtime.ModelEntityExtractor: models.EntityExtractor.Path,
+	}
+	for model, uri := range r.uris {
+		// Models the control plane loaded from elsewhere are left alone
+		if paths[model] != uri {
+			continue
+		}
+
+		path, digest, err := r.client.Fetch(context.Background(), uri, "")
+		if err != nil {
+			r.logger.Warn("Failed to refresh model, keeping the loaded one",
+				zap.String("model", model), zap.String("uri", uri), zap.Error(err))
+			continue
+		}
+		if digest == r.digests[model] {
+			continue
+		}
+		r.digests[model] = digest
+
+		// The configuration keeps the URI, so the model is refreshed again
+		r.state.mutex.Lock()
+		err = r.state.runtime.ReloadModel(model, path)
+		r.state.mutex.Unlock()
+		if err != nil {
+			r.logger.Error("Failed to reload downloaded model, keeping the loaded one",
+				zap.String("model", model), zap.String("uri", uri), zap.Error(err))
+			continue
+		}
+		r.state.provenance.reload(model, modelFileName(uri), path)
+		r.logger.Info("Model reloaded after it changed", zap.String("model", model),
+			zap.String("uri", uri), zap.String("sha256", digest))
+	}
+}
+
+// Stop stops refreshing the models
+func (r *modelRefresher) Stop() {
+	close(r.done)
+	r.wg.Wait()
+}
@@ -0,0 +1,101 @@
+// This file contains the writing of entity extractor results as attributes,
+// including the lists and objects that plain attribute values can't hold
+
+package processor
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// Representations of the list and object outputs of the entity extractor,
+// such as the services of a span
+const (
+	// entityFormatSlice writes slice and map attribute values
+	entityFormatSlice = "slice"
+
+	// entityFormatJSON writes JSON strings
+	entityFormatJSON = "json"
+
+	// entityFormatFlat writes one attribute per element, such as
+	// ai.services.0 and ai.services.1
+	entityFormatFlat = "flat"
+)
+
+// setEntityAttributes writes the result of the entity extractor in
+// attributes, under the output namespace
+func setEntityAttributes(attributes pcommon.Map, result map[string]interface{}, output *OutputConfig) {
+	for k, v := range result {
+		setEntityAttribute(attributes, output.AttributeNamespace+k, v, output)
+	}
+}
+
+// setEntityAttribute writes an output of the entity extractor in attributes
+// in the configured entity format
+func setEntityAttribute(attributes pcommon.Map, key string, value interface{}, output *OutputConfig) {
+	switch v := value.(type) {
+	case []interface{}, map[string]interface{}:
+		switch output.EntityFormat {
+		case entityFormatJSON:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return
+			}
+			attributes.PutStr(key, string(encoded))
+		case entityFormatFlat:
+			flattenEntity(attributes, key, v)
+		default:
+			putEntityValue(attributes.PutEmpty(key), v)
+		}
+	default:
+		setAttribute(attributes, key, v)
+	}
+}
+
+// flattenEntity writes the elements of lists and objects as attributes
+// keyed by their index or key under key
+func flattenEntity(attributes pcommon.Map, key string, value interface{}) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, element := range v {
+			flattenEntity(attributes, key+"."+strconv.Itoa(i), element)
+		}
+	case map[string]interface{}:
+		for k, element := range v {
+			flattenEntity(attributes, key+"."+k, element)
+		}
+	default:
+		setAttribute(attributes, key, v)
+	}
+}
+
+// putEntityValue sets dest to value. Values of other types leave dest
+// empty.
+func putEntityValue(dest pcommon.Value, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		dest.SetStr(v)
+	case bool:
+		dest.SetBool(v)
+	case int:
+		dest.SetInt(int64(v))
+	case int64:
+		dest.SetInt(v)
+	case float64:
+		dest.SetDouble(v)
+	case []interface{}:
+		slice := dest.SetEmptySlice()
+		slice.EnsureCapacity(len(v))
+		for _, element := range v {
+			putEntityValue(slice.AppendEmpty(), element)
+		}
+	case map[string]interface{}:
+		m := dest.SetEmptyMap()
+		m.EnsureCapacity(len(v))
+		for k, element := range v {
+			putEntityValue(m.PutEmpty(k), element)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestSetEntityAttributesFormats(t *testing.T) {
+	result := map[string]interface{}{
+		"service":  "checkout-service",
+		"services": []interface{}{"cart", "payments-gateway"},
+		"database": map[string]interface{}{"system": "postgresql"},
+	}
+
+	slice := pcommon.NewMap()
+	setEntityAttributes(slice, result, &OutputConfig{AttributeNamespace: "ai.", EntityFormat: entityFormatSlice})
+	assert.Equal(t, map[string]interface{}{
+		"ai.service":  "checkout-service",
+		"ai.services": []interface{}{"cart", "payments-gateway"},
+		"ai.database": map[string]interface{}{"system": "postgresql"},
+	}, slice.AsRaw())
+
+	encoded := pcommon.NewMap()
+	setEntityAttributes(encoded, result, &OutputConfig{AttributeNamespace: "ai.", EntityFormat: entityFormatJSON})
+	assert.Equal(t, map[string]interface{}{
+		"ai.service":  "checkout-service",
+		"ai.services": `["cart","payments-gateway"]`,
+		"ai.database": `{"system":"postgresql"}`,
+	}, encoded.AsRaw())
+
+	flat := pcommon.NewMap()
+	setEntityAttributes(flat, result, &OutputConfig{AttributeNamespace: "ai.", EntityFormat: entityFormatFlat})
+	assert.Equal(t, map[string]interface{}{
+		"ai.service":         "checkout-service",
+		"ai.services.0":      "cart",
+		"ai.services.1":      "payments-gateway",
+		"ai.database.system": "postgresql",
+	}, flat.AsRaw())
+}
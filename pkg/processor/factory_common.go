@@ -5,10 +5,14 @@ package processor
 
 import (
 	"context"
+	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/processor"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/processor/internal/metadata"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/redaction"
 )
 
 const (
@@ -17,18 +21,26 @@ const (
 )
 
 // NewFactory creates a factory for the AI processor.
-func NewFactory() processor.Factory {
+// Options such as WithEnrichmentHooks customize the created processors.
+// Creating processors only validates their configuration; the models are
+// loaded and the control plane started when the first processor starts.
+func NewFactory(options ...FactoryOption) processor.Factory {
+	opts := &factoryOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	
 	return processor.NewFactory(
-		component.MustNewType(typeStr),
+		metadata.Type,
 		createDefaultConfig,
-		processor.WithTraces(createTracesWrapper, component.StabilityLevelStable),
-		processor.WithMetrics(createMetricsWrapper, component.StabilityLevelStable),
-		processor.WithLogs(createLogsWrapper, component.StabilityLevelStable),
+		processor.WithTraces(opts.createTracesWrapper, metadata.TracesStability),
+		processor.WithMetrics(opts.createMetricsWrapper, metadata.MetricsStability),
+		processor.WithLogs(opts.createLogsWrapper, metadata.LogsStability),
 	)
 }
 
 // Create wrappers with the exact parameter types required by processor.CreateTracesFunc, etc.
-func createTracesWrapper(
+func (o *factoryOptions) createTracesWrapper(
 	ctx context.Context,
 	set processor.Settings,
 	cfg component.Config,
@@ -37,7 +49,7 @@ func createTracesWrapper(
 	pCfg := cfg.(*Config)
 	
 	// Create a new processor instance
-	proc, err := newTracesProcessor(set.Logger, pCfg, nextConsumer)
+	proc, err := newTracesProcessor(set.TelemetrySettings, pCfg, nextConsumer, o.hooks)
 	if err != nil {
 		return nil, err
 	}
@@ -45,11 +57,15 @@ func createTracesWrapper(
 	wrapper := &tracesProcessorWrapper{
 		processor: proc,
 		next:      nextConsumer,
+		intake:    newIntakeQueue(set.Logger, &pCfg.Processing),
+		stop:      newBatchStop(),
+		timeout:   time.Duration(pCfg.Processing.TimeoutMs) * time.Millisecond,
+		chunkSize: pCfg.Processing.chunkSize(),
 	}
 	return wrapper, nil
 }
 
-func createMetricsWrapper(
+func (o *factoryOptions) createMetricsWrapper(
 	ctx context.Context,
 	set processor.Settings,
 	cfg component.Config,
@@ -58,7 +74,7 @@ func createMetricsWrapper(
 	pCfg := cfg.(*Config)
 	
 	// Create a new processor instance
-	proc, err := newMetricsProcessor(set.Logger, pCfg, nextConsumer)
+	proc, err := newMetricsProcessor(set.TelemetrySettings, pCfg, nextConsumer, o.hooks)
 	if err != nil {
 		return nil, err
 	}
@@ -66,11 +82,15 @@ func createMetricsWrapper(
 	wrapper := &metricsProcessorWrapper{
 		processor: proc,
 		next:      nextConsumer,
+		intake:    newIntakeQueue(set.Logger, &pCfg.Processing),
+		stop:      newBatchStop(),
+		timeout:   time.Duration(pCfg.Processing.TimeoutMs) * time.Millisecond,
+		chunkSize: pCfg.Processing.chunkSize(),
 	}
 	return wrapper, nil
 }
 
-func createLogsWrapper(
+func (o *factoryOptions) createLogsWrapper(
 	ctx context.Context,
 	set processor.Settings,
 	cfg component.Config,
@@ -79,7 +99,7 @@ func createLogsWrapper(
 	pCfg := cfg.(*Config)
 	
 	// Create a new processor instance
-	proc, err := newLogsProcessor(set.Logger, pCfg, nextConsumer)
+	proc, err := newLogsProcessor(set.TelemetrySettings, pCfg, nextConsumer, o.hooks)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +107,10 @@ func createLogsWrapper(
 	wrapper := &logsProcessorWrapper{
 		processor: proc,
 		next:      nextConsumer,
+		intake:    newIntakeQueue(set.Logger, &pCfg.Processing),
+		stop:      newBatchStop(),
+		timeout:   time.Duration(pCfg.Processing.TimeoutMs) * time.Millisecond,
+		chunkSize: pCfg.Processing.chunkSize(),
 	}
 	return wrapper, nil
 }
@@ -99,6 +123,12 @@ func CreateDefaultConfig() component.Config {
 
 // createDefaultConfig creates the default configuration for the processor.
 func createDefaultConfig() component.Config {
+	negativeCache := NegativeCacheConfig{
+		MaxEntries:       10000,
+		InitialBackoffMs: 1000,
+		MaxBackoffMs:     60000,
+		Jitter:           0.2,
+	}
 	return &Config{
 		TypeVal: typeStr,
 		NameVal: typeStr,
@@ -107,16 +137,38 @@ func createDefaultConfig() component.Config {
 				Path:         "/models/error-classifier.wasm",
 				MemoryLimitMB:  100,
 				TimeoutMs:    50,
+				NegativeCache: negativeCache,
+				Projection: ProjectionConfig{
+					MaxEvents:           8,
+					MaxStacktraceLength: 2048,
+				},
 			},
 			ImportanceSampler: ModelConfig{
 				Path:         "/models/importance-sampler.wasm",
 				MemoryLimitMB:  80,
 				TimeoutMs:    30,
+				NegativeCache: negativeCache,
 			},
 			EntityExtractor: ModelConfig{
 				Path:         "/models/entity-extractor.wasm",
 				MemoryLimitMB:  150,
 				TimeoutMs:    50,
+				NegativeCache: negativeCache,
+			},
+			Registry: RegistryConfig{
+				CacheDir:  "/var/lib/otel-ai-processor/models",
+				TimeoutMs: 30000,
+			},
+			Download: DownloadConfig{
+				CacheDir:          "/var/lib/otel-ai-processor/downloads",
+				TimeoutMs:         60000,
+				RefreshIntervalMs: 300000,
+			},
+			Bundle: BundleConfig{
+				ExtractDir: "/var/lib/otel-ai-processor/bundles",
+			},
+			Shadow: ShadowConfig{
+				Rate: 0.1,
 			},
 		},
 		Processing: ProcessingConfig{
@@ -126,27 +178,154 @@ func createDefaultConfig() component.Config {
 			TimeoutMs:             500,
 			EnableParallelProcessing: true,
 			MaxParallelWorkers:    8,
+			IntakeWorkers:         2,
+			IntakeOverflow:        intakeOverflowBackpressure,
 			AttributeCacheSize:    1000,
 			ResourceCacheSize:     100,
+			InternTableSize:       10000,
 			ModelCacheResults:     true,
 			ModelResultsCacheSize: 1000,
+			ModelCacheTenants:     100,
 		},
 		Features: FeaturesConfig{
 			ErrorClassification: true,
 			SmartSampling:       true,
 			EntityExtraction:    false,
 			ContextLinking:      false,
+			PIIRedaction:        false,
+			AnomalyDetection:    false,
+			LogDedup:            false,
+			NameNormalization:   false,
+			GenAI:               false,
 		},
 		Sampling: SamplingConfig{
 			ErrorEvents:  1.0,
 			SlowSpans:    1.0,
 			NormalSpans:  0.1,
 			ThresholdMs:  500,
+			Randomness:   samplingRandomnessTraceID,
+			Tail: TailSamplingConfig{
+				Enabled:        false,
+				DecisionWaitMs: 10000,
+				MaxTraces:      50000,
+			},
+			Logs: LogSamplingConfig{
+				AlwaysKeepErrors: true,
+				Error:            1.0,
+				Warn:             1.0,
+				Info:             0.1,
+				Debug:            0.01,
+			},
+			DecisionCache: DecisionCacheConfig{
+				Enabled:   false,
+				TTLMs:     60000,
+				MaxTraces: 100000,
+			},
+			Similarity: SimilaritySamplingConfig{
+				Enabled:     false,
+				Embedder:    embedderHashing,
+				Dimensions:  256,
+				Function:    "embed",
+				TimeoutMs:   1000,
+				Threshold:   0.9,
+				SimilarRate: 0.1,
+				MaxItems:    10000,
+			},
+			Adaptive: AdaptiveSamplingConfig{
+				Enabled:  false,
+				WindowMs: 10000,
+				MinRate:  0.001,
+				MaxRate:  1.0,
+			},
 		},
 		Output: OutputConfig{
 			AttributeNamespace:     "ai.",
 			IncludeConfidenceScores: true,
 			MaxAttributeLength:      256,
+			EntityFormat:            entityFormatSlice,
+			IncludeSamplingMetadata: false,
+			IncludeModelProvenance:  false,
+		},
+		Recording: RecordingConfig{
+			Enabled:    false,
+			Path:       "/var/lib/otel-ai-processor/corpus.jsonl",
+			SampleRate: 0.01,
+			MaxRecords: 100000,
+		},
+		Privacy: PrivacyConfig{
+			Enabled:     false,
+			Epsilon:     1.0,
+			Sensitivity: 1.0,
+			KAnonymity:  10,
+		},
+		Residency: ResidencyConfig{
+			Enabled:          false,
+			SourceAttributes: []string{"cloud.region"},
+			Default:          "unknown",
+		},
+		Tenancy: TenancyConfig{
+			Attribute: "tenant.id",
+			Default:   "default",
+		},
+		Quotas: QuotasConfig{
+			Enabled: false,
+		},
+		ContextLinking: ContextLinkingConfig{
+			TTLMs:     60000,
+			MaxTraces: 100000,
+		},
+		AnomalyDetection: AnomalyDetectionConfig{
+			Alpha:             0.1,
+			Threshold:         3,
+			MinSamples:        10,
+			MaxSeries:         100000,
+			SeasonBuckets:     24,
+			HistogramQuantile: 0.99,
+		},
+		LogDedup: LogDedupConfig{
+			WindowMs:    10000,
+			MinSeverity: "error",
+			MaxGroups:   10000,
+		},
+		LogBody: LogBodyConfig{
+			Enabled:         false,
+			AttributePrefix: "body.",
+			MaxDepth:        4,
+			MaxFields:       32,
+			MaxBodyBytes:    16384,
+		},
+		MetricRollup: MetricRollupConfig{
+			Enabled: false,
+			Gauge:   rollupGaugeSum,
+		},
+		Accounting: AccountingConfig{
+			Enabled:          false,
+			MaxServices:      1000,
+			ReportIntervalMs: 0,
+		},
+		Persistence: PersistenceConfig{
+			Path:               "",
+			SnapshotIntervalMs: 60000,
+		},
+		Ownership: OwnershipConfig{
+			TimeoutMs:         10000,
+			RefreshIntervalMs: 60000,
+		},
+		Hints: HintsConfig{
+			Enabled:           false,
+			PriorityAttribute: "sampling.priority",
+			SkipAttribute:     "ai.skip",
+			Strip:             true,
+		},
+		GenAI: GenAIConfig{
+			PromptAttributes: []string{"gen_ai.prompt", "gen_ai.input.messages"},
+		},
+		Redaction: RedactionConfig{
+			Patterns: []RedactionPattern{
+				{Name: redaction.Email, Strategy: redaction.StrategyMask},
+				{Name: redaction.CreditCard, Strategy: redaction.StrategyMask},
+				{Name: redaction.Token, Strategy: redaction.StrategyMask},
+			},
 		},
 	}
 }
\ No newline at end of file
@@ -1,9 +1,20 @@
 package processor
 
 import (
+	"context"
+	"errors"
 	"testing"
 	
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor"
+	"go.uber.org/zap"
 )
 
 func TestFactory_Type(t *testing.T) {
@@ -27,4 +38,75 @@ func TestFactory_CreateDefaultConfig(t *testing.T) {
 	assert.True(t, pCfg.Features.SmartSampling)
 	assert.False(t, pCfg.Features.EntityExtraction)
 	assert.False(t, pCfg.Features.ContextLinking)
-}
\ No newline at end of file
+}
+
+// testHook tags spans and fails or panics for logs and metrics
+type testHook struct{}
+
+func (testHook) OnSpan(ctx context.Context, span ptrace.Span, resource pcommon.Resource) error {
+	span.Attributes().PutStr("team", "payments")
+	return nil
+}
+
+func (testHook) OnLog(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) error {
+	return errors.New("lookup failed")
+}
+
+func (testHook) OnMetric(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource) error {
+	panic("boom")
+}
+
+func TestFactory_WithEnrichmentHooks(t *testing.T) {
+	opts := &factoryOptions{}
+	WithEnrichmentHooks(testHook{}, testHook{})(opts)
+	assert.Len(t, opts.hooks, 2)
+	
+	span := ptrace.NewSpan()
+	opts.hooks.onSpan(context.Background(), zap.NewNop(), span, pcommon.NewResource())
+	team, ok := span.Attributes().Get("team")
+	assert.True(t, ok)
+	assert.Equal(t, "payments", team.Str())
+	
+	// Hook errors and panics must not escape into the pipeline
+	assert.NotPanics(t, func() {
+		opts.hooks.onLog(context.Background(), zap.NewNop(), plog.NewLogRecord(), pcommon.NewResource())
+		opts.hooks.onMetric(context.Background(), zap.NewNop(), pmetric.NewMetric(), pcommon.NewResource())
+	})
+	
+	factory := NewFactory(WithEnrichmentHooks(testHook{}))
+	assert.Equal(t, "ai_processor", factory.Type().String())
+}
+
+// nopHost is a host without extensions
+type nopHost struct{}
+
+func (nopHost) GetExtensions() map[component.ID]component.Component { return nil }
+
+func TestFactory_LoadsModelsOnStart(t *testing.T) {
+	factory := NewFactory()
+	assert.Equal(t, component.StabilityLevelStable, factory.TracesStability())
+
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Models.ErrorClassifier.Path = ""
+	cfg.Models.ImportanceSampler.Path = ""
+	cfg.Models.EntityExtractor.Path = ""
+	set := processor.Settings{
+		ID:                component.NewID(factory.Type()),
+		TelemetrySettings: nopTelemetry(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	next, err := consumer.NewTraces(func(ctx context.Context, td ptrace.Traces) error { return nil })
+	require.NoError(t, err)
+
+	// Creating the processor leaves the models unloaded
+	traces, err := factory.CreateTraces(context.Background(), set, cfg, next)
+	require.NoError(t, err)
+	state := referenceControlState(set.TelemetrySettings, cfg)
+	assert.Nil(t, state.runtime)
+
+	require.NoError(t, traces.Start(context.Background(), nopHost{}))
+	assert.NotNil(t, state.runtime)
+	require.NoError(t, state.release())
+	require.NoError(t, traces.Shutdown(context.Background()))
+	assert.Nil(t, state.runtime, "the last processor to shut down closes the models")
+}
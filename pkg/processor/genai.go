@@ -0,0 +1,250 @@
+// This file contains the enrichment of spans following the GenAI semantic
+// conventions, which estimates the cost of LLM calls from their token
+// counts and flags prompts that look like prompt injections
+
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Attributes added to GenAI spans under the output namespace
+const (
+	genAICostAttribute = "genai.cost_usd"
+	genAIRiskAttribute = "genai.risk"
+)
+
+// genAIRiskInjection is the risk of spans whose prompt looks like a prompt
+// injection
+const genAIRiskInjection = "prompt_injection"
+
+// genAISpanAttributes identify the spans of GenAI operations
+var genAISpanAttributes = []string{
+	"gen_ai.system",
+	"gen_ai.provider.name",
+	"gen_ai.operation.name",
+	"gen_ai.request.model",
+}
+
+// Attributes holding the model and token counts of a GenAI span, in order
+// of preference; the second of each pair is deprecated but still emitted
+// by many instrumentations
+var (
+	genAIModelAttributes       = []string{"gen_ai.response.model", "gen_ai.request.model"}
+	genAIInputTokenAttributes  = []string{"gen_ai.usage.input_tokens", "gen_ai.usage.prompt_tokens"}
+	genAIOutputTokenAttributes = []string{"gen_ai.usage.output_tokens", "gen_ai.usage.completion_tokens"}
+)
+
+// defaultInjectionPatterns match the phrasings of common prompt injections,
+// such as asking a model to ignore its instructions or reveal its prompt
+var defaultInjectionPatterns = []string{
+	`\b(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(of\s+)?(the\s+|your\s+|my\s+)?(previous|prior|above|earlier|preceding|system)\s+(instructions|prompts?|rules|directions)`,
+	`\b(reveal|print|show|repeat|output)\s+(me\s+)?(your|the)\s+(system\s+prompt|hidden\s+instructions|initial\s+instructions|instructions\s+above)`,
+	`\byou\s+are\s+now\s+(in\s+)?(DAN|developer\s+mode|jailbroken|unrestricted)\b`,
+	`\bjailbreak\b`,
+	`<\|?(im_start|im_end|system)\|?>`,
+}
+
+// genAIPrice is the price of a model, matched by name prefix
+type genAIPrice struct {
+	model  string
+	input  float64
+	output float64
+}
+
+// genAIEnricher adds the estimated cost and risk of GenAI spans
+type genAIEnricher struct {
+	// prices of the models, longest model first so the most specific one
+	// matches
+	prices []genAIPrice
+
+	promptAttributes []string
+	injection        []*regexp.Regexp
+}
+
+// newGenAIEnricher compiles the prices and patterns of config. The enricher
+// is created whether or not features.genai is enabled, since the control
+// plane can enable it.
+func newGenAIEnricher(config *GenAIConfig) (*genAIEnricher, error) {
+	e := &genAIEnricher{promptAttributes: config.PromptAttributes}
+	for model, price := range config.Prices {
+		e.prices = append(e.prices, genAIPrice{model: model, input: price.Input, output: price.Output})
+	}
+	sort.Slice(e.prices, func(i, j int) bool {
+		if len(e.prices[i].model) != len(e.prices[j].model) {
+			return len(e.prices[i].model) > len(e.prices[j].model)
+		}
+		return e.prices[i].model < e.prices[j].model
+	})
+
+	for _, pattern := range append(append([]string{}, defaultInjectionPatterns...), config.InjectionPatterns...) {
+		regex, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid injection pattern %q: %w", pattern, err)
+		}
+		e.injection = append(e.injection, regex)
+	}
+	return e, nil
+}
+
+// enrichTraces enriches the GenAI spans of the resources with features.genai
+// enabled
+func (e *genAIEnricher) enrichTraces(td ptrace.Traces, state *controlState) {
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		config := state.resourceConfig(rss.At(i).Resource())
+		if !config.Features.GenAI {
+			continue
+		}
+		namespace := config.Output.AttributeNamespace
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				e.enrichSpan(spans.At(k), namespace)
+			}
+		}
+	}
+}
+
+// enrichSpan adds the cost and risk of a span under namespace, if it is the
+// span of a GenAI operation
+func (e *genAIEnricher) enrichSpan(span ptrace.Span, namespace string) {
+	attributes := span.Attributes()
+	if !isGenAISpan(attributes) {
+		return
+	}
+	if cost, ok := e.cost(attributes); ok {
+		attributes.PutDouble(namespace+genAICostAttribute, cost)
+	}
+	if e.injected(span) {
+		attributes.PutStr(namespace+genAIRiskAttribute, genAIRiskInjection)
+	}
+}
+
+// isGenAISpan reports whether attributes are those of a GenAI span
+func isGenAISpan(attributes pcommon.Map) bool {
+	for _, key := range genAISpanAttributes {
+		if _, ok := attributes.Get(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cost returns the estimated cost in USD of a span, if its model has a
+// price and it has token counts
+func (e *genAIEnricher) cost(attributes pcommon.Map) (float64, bool) {
+	model, ok := firstString(attributes, genAIModelAttributes)
+	if !ok {
+		return 0, false
+	}
+	price, ok := e.price(model)
+	if !ok {
+		return 0, false
+	}
+	input, hasInput := firstNumber(attributes, genAIInputTokenAttributes)
+	output, hasOutput := firstNumber(attributes, genAIOutputTokenAttributes)
+	if !hasInput && !hasOutput {
+		return 0, false
+	}
+	return (input*price.input + output*price.output) / 1e6, true
+}
+
+// price returns the price of the longest model name model starts with
+func (e *genAIEnricher) price(model string) (genAIPrice, bool) {
+	for _, price := range e.prices {
+		if strings.HasPrefix(model, price.model) {
+			return price, true
+		}
+	}
+	return genAIPrice{}, false
+}
+
+// injected reports whether a prompt of a span, in its attributes or those
+// of its events, matches an injection pattern
+func (e *genAIEnricher) injected(span ptrace.Span) bool {
+	if e.injectedIn(span.Attributes()) {
+		return true
+	}
+	events := span.Events()
+	for i := 0; i < events.Len(); i++ {
+		if e.injectedIn(events.At(i).Attributes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectedIn reports whether a prompt attribute of attributes matches an
+// injection pattern
+func (e *genAIEnricher) injectedIn(attributes pcommon.Map) bool {
+	for _, key := range e.promptAttributes {
+		if value, ok := attributes.Get(key); ok && e.injectedValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectedValue reports whether a string of value, including those nested
+// in maps and slices such as structured messages, matches an injection
+// pattern
+func (e *genAIEnricher) injectedValue(value pcommon.Value) bool {
+	switch value.Type() {
+	case pcommon.ValueTypeStr:
+		for _, regex := range e.injection {
+			if regex.MatchString(value.Str()) {
+				return true
+			}
+		}
+	case pcommon.ValueTypeSlice:
+		slice := value.Slice()
+		for i := 0; i < slice.Len(); i++ {
+			if e.injectedValue(slice.At(i)) {
+				return true
+			}
+		}
+	case pcommon.ValueTypeMap:
+		found := false
+		value.Map().Range(func(_ string, v pcommon.Value) bool {
+			found = e.injectedValue(v)
+			return !found
+		})
+		return found
+	}
+	return false
+}
+
+// firstString returns the first of keys that is a string attribute
+func firstString(attributes pcommon.Map, keys []string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := attributes.Get(key); ok && value.Type() == pcommon.ValueTypeStr && value.Str() != "" {
+			return value.Str(), true
+		}
+	}
+	return "", false
+}
+
+// firstNumber returns the first of keys that is a numeric attribute
+func firstNumber(attributes pcommon.Map, keys []string) (float64, bool) {
+	for _, key := range keys {
+		value, ok := attributes.Get(key)
+		if !ok {
+			continue
+		}
+		switch value.Type() {
+		case pcommon.ValueTypeInt:
+			return float64(value.Int()), true
+		case pcommon.ValueTypeDouble:
+			return value.Double(), true
+		}
+	}
+	return 0, false
+}
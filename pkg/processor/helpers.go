@@ -16,6 +16,11 @@ func attributesToMap(attributes pcommon.Map) map[string]interface{} {
 	return common.AttributesToMap(attributes)
 }
 
+// resourceToMap converts the attributes of a resource to a Go map
+func resourceToMap(resource pcommon.Resource) map[string]interface{} {
+	return common.ResourceToMap(resource)
+}
+
 // calculateAttributeMapHash calculates a hash for an attribute map
 func calculateAttributeMapHash(attributes pcommon.Map) uint64 {
 	return common.CalculateAttributeMapHash(attributes)
@@ -42,6 +47,12 @@ func randomSample(rate float64) bool {
 	return common.RandomSample(rate)
 }
 
+// traceIDSample returns true if the trace should be kept based on the
+// sampling rate (0.0-1.0), deciding the same for every span of the trace
+func traceIDSample(id pcommon.TraceID, rate float64) bool {
+	return common.TraceIDSample(id, rate)
+}
+
 // getOrCreateResource finds a matching resource in the traces or creates a new one
 func getOrCreateResource(traces ptrace.Traces, resource pcommon.Resource) ptrace.ResourceSpans {
 	return common.GetOrCreateTraceResource(traces, resource)
@@ -0,0 +1,96 @@
+// This file contains the enrichment hints upstream agents send as
+// attributes, which force sampling decisions and skip models like rules do
+
+package processor
+
+import (
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+)
+
+// applyHints merges the hints of an item's attributes into the result of
+// the rules, which take precedence: the priority hint forces a decision
+// unless a rule did, and the skip hint adds to the models rules skip. The
+// hint attributes are removed if config strips them.
+func applyHints(config *HintsConfig, attributes pcommon.Map, result *expression.Result) {
+	if priority, ok := attributes.Get(config.PriorityAttribute); ok {
+		if decision := priorityDecision(priority); decision != "" && result.Sampling == "" {
+			result.Sampling = decision
+		}
+		if config.Strip {
+			attributes.Remove(config.PriorityAttribute)
+		}
+	}
+	if skip, ok := attributes.Get(config.SkipAttribute); ok {
+		for _, model := range skippedModels(skip) {
+			if result.SkipModels == nil {
+				result.SkipModels = make(map[string]bool)
+			}
+			result.SkipModels[model] = true
+		}
+		if config.Strip {
+			attributes.Remove(config.SkipAttribute)
+		}
+	}
+}
+
+// priorityDecision returns the decision a sampling priority forces: items
+// with a positive priority are kept and the others dropped. Priorities that
+// are not numbers force none.
+func priorityDecision(priority pcommon.Value) string {
+	var value float64
+	switch priority.Type() {
+	case pcommon.ValueTypeInt:
+		value = float64(priority.Int())
+	case pcommon.ValueTypeDouble:
+		value = priority.Double()
+	case pcommon.ValueTypeStr:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(priority.Str()), 64)
+		if err != nil {
+			return ""
+		}
+		value = parsed
+	default:
+		return ""
+	}
+	if value > 0 {
+		return expression.SamplingKeep
+	}
+	return expression.SamplingDrop
+}
+
+// skippedModels returns the models a skip hint skips: all of them for true,
+// or those listed by a comma-separated string or a slice of strings
+func skippedModels(skip pcommon.Value) []string {
+	switch skip.Type() {
+	case pcommon.ValueTypeBool:
+		if skip.Bool() {
+			return []string{expression.SkipAllModels}
+		}
+	case pcommon.ValueTypeStr:
+		var models []string
+		for _, model := range strings.Split(skip.Str(), ",") {
+			switch model = strings.TrimSpace(model); model {
+			case "", "false":
+			case "true":
+				models = append(models, expression.SkipAllModels)
+			default:
+				models = append(models, model)
+			}
+		}
+		return models
+	case pcommon.ValueTypeSlice:
+		var models []string
+		for i := 0; i < skip.Slice().Len(); i++ {
+			if model := skip.Slice().At(i); model.Type() == pcommon.ValueTypeStr {
+				models = append(models, model.Str())
+			}
+		}
+		return models
+	}
+	return nil
+}
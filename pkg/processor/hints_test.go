@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+)
+
+func TestApplyHints(t *testing.T) {
+	config := &CreateDefaultConfig().(*Config).Hints
+	config.Enabled = true
+
+	attributes := pcommon.NewMap()
+	attributes.PutInt("sampling.priority", 1)
+	attributes.PutStr("ai.skip", "sampler, entity_extractor")
+	attributes.PutStr("http.method", "GET")
+	var result expression.Result
+	applyHints(config, attributes, &result)
+	assert.Equal(t, expression.SamplingKeep, result.Sampling)
+	assert.True(t, result.Skips("sampler"))
+	assert.True(t, result.Skips("entity_extractor"))
+	assert.False(t, result.Skips("error_classifier"))
+	assert.Equal(t, map[string]interface{}{"http.method": "GET"}, attributes.AsRaw())
+
+	// Rules take precedence, and hints are kept unless stripped
+	config.Strip = false
+	attributes = pcommon.NewMap()
+	attributes.PutStr("sampling.priority", "0")
+	attributes.PutBool("ai.skip", true)
+	result = expression.Result{Sampling: expression.SamplingKeep}
+	applyHints(config, attributes, &result)
+	assert.Equal(t, expression.SamplingKeep, result.Sampling)
+	assert.True(t, result.Skips("error_classifier"))
+	assert.Equal(t, 2, attributes.Len())
+
+	result = expression.Result{}
+	applyHints(config, attributes, &result)
+	assert.Equal(t, expression.SamplingDrop, result.Sampling)
+}
+
+func TestPriorityDecision(t *testing.T) {
+	assert.Equal(t, expression.SamplingKeep, priorityDecision(pcommon.NewValueDouble(0.5)))
+	assert.Equal(t, expression.SamplingDrop, priorityDecision(pcommon.NewValueInt(-1)))
+	assert.Equal(t, expression.SamplingKeep, priorityDecision(pcommon.NewValueStr("2")))
+	assert.Equal(t, "", priorityDecision(pcommon.NewValueStr("high")))
+	assert.Equal(t, "", priorityDecision(pcommon.NewValueBool(true)))
+}
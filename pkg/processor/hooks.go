@@ -0,0 +1,80 @@
+// This file contains the enrichment hook interface that lets programs
+// embedding the processor add their own enrichment logic in Go
+
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+)
+
+// EnrichmentHook is implemented by custom Go enrichment logic. Hooks are
+// called for every span, log record and metric after the AI models have
+// added their attributes, so they can read and override the model output.
+//
+// Hooks are called concurrently when parallel processing is enabled and
+// must be safe for concurrent use, unless processing.ordered_completion is
+// set, which calls them in batch order. A returned error is logged and does
+// not stop processing.
+type EnrichmentHook interface {
+	OnSpan(ctx context.Context, span ptrace.Span, resource pcommon.Resource) error
+	OnLog(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) error
+	OnMetric(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource) error
+}
+
+// FactoryOption configures the processor factory
+type FactoryOption func(*factoryOptions)
+
+// factoryOptions holds the settings applied by FactoryOption
+type factoryOptions struct {
+	hooks enrichmentHooks
+}
+
+// WithEnrichmentHooks registers hooks that are called by every processor
+// created by the factory, in the order they are given
+func WithEnrichmentHooks(hooks ...EnrichmentHook) FactoryOption {
+	return func(o *factoryOptions) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
+
+// enrichmentHooks runs a list of hooks, isolating the pipeline from hook
+// errors and panics
+type enrichmentHooks []EnrichmentHook
+
+func (h enrichmentHooks) onSpan(ctx context.Context, logger *zap.Logger, span ptrace.Span, resource pcommon.Resource) {
+	for _, hook := range h {
+		h.call(logger, "span", func() error { return hook.OnSpan(ctx, span, resource) })
+	}
+}
+
+func (h enrichmentHooks) onLog(ctx context.Context, logger *zap.Logger, log plog.LogRecord, resource pcommon.Resource) {
+	for _, hook := range h {
+		h.call(logger, "log", func() error { return hook.OnLog(ctx, log, resource) })
+	}
+}
+
+func (h enrichmentHooks) onMetric(ctx context.Context, logger *zap.Logger, metric pmetric.Metric, resource pcommon.Resource) {
+	for _, hook := range h {
+		h.call(logger, "metric", func() error { return hook.OnMetric(ctx, metric, resource) })
+	}
+}
+
+// call invokes a single hook, logging its error or recovered panic
+func (h enrichmentHooks) call(logger *zap.Logger, signal string, fn func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Enrichment hook panicked", zap.String("signal", signal), zap.String("panic", fmt.Sprint(r)))
+		}
+	}()
+
+	if err := fn(); err != nil {
+		logger.Warn("Enrichment hook failed", zap.String("signal", signal), zap.Error(err))
+	}
+}
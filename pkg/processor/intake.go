@@ -0,0 +1,183 @@
+// This file contains the asynchronous intake queue, which decouples the
+// latency of the pipeline from the latency of the models
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errIntakeFull is returned to the pipeline when the intake queue is full,
+// so receivers apply backpressure or retry
+var errIntakeFull = errors.New("ai_processor intake queue is full")
+
+// Policies for batches arriving while the intake queue is full
+const (
+	intakeOverflowBackpressure = "backpressure"
+	intakeOverflowPassThrough  = "pass_through"
+)
+
+// intakeQueue holds batches accepted from the pipeline until background
+// workers process them and pass them on
+type intakeQueue struct {
+	logger  *zap.Logger
+	workers int
+	queue   chan intakeBatch
+	wg      sync.WaitGroup
+
+	// passThrough passes batches on unenriched while the queue is full
+	passThrough bool
+}
+
+// intakeBatch is a queued batch and the context it was consumed with
+type intakeBatch struct {
+	ctx     context.Context
+	consume func(ctx context.Context) error
+}
+
+// newIntakeQueue returns the intake queue for config, or nil if batches are
+// processed synchronously
+func newIntakeQueue(logger *zap.Logger, config *ProcessingConfig) *intakeQueue {
+	if !config.AsyncIntake {
+		return nil
+	}
+
+	workers := config.IntakeWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	size := config.QueueSize
+	if size < 1 {
+		size = 1
+	}
+
+	return &intakeQueue{
+		logger:      logger,
+		workers:     workers,
+		queue:       make(chan intakeBatch, size),
+		passThrough: config.IntakeOverflow == intakeOverflowPassThrough,
+	}
+}
+
+// start starts the background workers
+func (q *intakeQueue) start() {
+	if q == nil {
+		return
+	}
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.run()
+	}
+}
+
+// run processes queued batches until the queue is closed
+func (q *intakeQueue) run() {
+	defer q.wg.Done()
+	for batch := range q.queue {
+		if err := batch.consume(batch.ctx); err != nil {
+			q.logger.Error("Failed to process queued batch", zap.Error(err))
+		}
+	}
+}
+
+// enqueue queues consume, which processes a batch and passes it on. If the
+// queue is full, it calls pass, which passes the batch on without the
+// models, with the pass_through policy and fails without blocking
+// otherwise. The batch keeps the values of ctx but not its deadline, since
+// the pipeline stops waiting for it.
+func (q *intakeQueue) enqueue(ctx context.Context, consume func(ctx context.Context) error, pass func(ctx context.Context) error) error {
+	select {
+	case q.queue <- intakeBatch{ctx: context.WithoutCancel(ctx), consume: consume}:
+		return nil
+	default:
+	}
+	if q.passThrough {
+		q.logger.Debug("Intake queue is full, passing batch on without models")
+		return pass(ctx)
+	}
+	return errIntakeFull
+}
+
+// close stops accepting batches and waits for the queued ones to be
+// processed
+func (q *intakeQueue) close() {
+	if q == nil {
+		return
+	}
+	close(q.queue)
+	q.wg.Wait()
+}
+
+// batchStop interrupts the batches being enriched once a processor shuts
+// down, so shutdown doesn't wait for their models
+type batchStop struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newBatchStop() *batchStop {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &batchStop{ctx: ctx, cancel: cancel}
+}
+
+// stop interrupts the batches being enriched and those enriched after
+func (s *batchStop) stop() {
+	if s != nil {
+		s.cancel()
+	}
+}
+
+// batchContext returns the context a batch is enriched with, which is done
+// once timeout passes (0 for no limit) or the processor shuts down
+func batchContext(ctx context.Context, stop *batchStop, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if stop == nil && timeout <= 0 {
+		return ctx, func() {}
+	}
+	batchCtx, cancel := context.WithCancel(ctx)
+	release := func() bool { return true }
+	if stop != nil {
+		release = context.AfterFunc(stop.ctx, cancel)
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		batchCtx, cancelTimeout = context.WithTimeout(batchCtx, timeout)
+		cancelBatch := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelBatch()
+		}
+	}
+	return batchCtx, func() {
+		release()
+		cancel()
+	}
+}
+
+// batchInterrupted reports whether err ended the processing of a batch
+// because its timeout passed or the processor shut down, rather than the
+// pipeline giving up on it, in which case the batch is passed on as far as
+// it was processed
+func batchInterrupted(ctx context.Context, batchCtx context.Context, err error) bool {
+	return ctx.Err() == nil && batchCtx.Err() != nil && errors.Is(err, batchCtx.Err())
+}
+
+// skipModelsKey is the context key marking batches processed without models
+type skipModelsKey struct{}
+
+// withoutModels returns a context in which batches are processed without
+// invoking the models. Everything else still applies, such as redaction,
+// rules and sampling rates, so only the enrichment is lost.
+func withoutModels(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipModelsKey{}, true)
+}
+
+// modelsSkipped reports whether items processed with ctx skip the models,
+// because their batch overflowed the intake queue or its timeout passed
+func modelsSkipped(ctx context.Context) bool {
+	return ctx.Err() != nil || ctx.Value(skipModelsKey{}) != nil
+}
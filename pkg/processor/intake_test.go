@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+)
+
+func TestIntakeQueueAppliesBackpressure(t *testing.T) {
+	assert.Nil(t, newIntakeQueue(zap.NewNop(), &ProcessingConfig{QueueSize: 2}))
+
+	queue := newIntakeQueue(zap.NewNop(), &ProcessingConfig{AsyncIntake: true, QueueSize: 2, IntakeWorkers: 1})
+	require.NotNil(t, queue)
+
+	// Batches are accepted until the queue is full, even once the
+	// pipeline's context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	var processed atomic.Int32
+	consume := func(ctx context.Context) error {
+		assert.NoError(t, ctx.Err())
+		processed.Add(1)
+		return nil
+	}
+	require.NoError(t, queue.enqueue(ctx, consume, nil))
+	require.NoError(t, queue.enqueue(ctx, consume, nil))
+	assert.ErrorIs(t, queue.enqueue(ctx, consume, nil), errIntakeFull)
+	cancel()
+
+	// Queued batches are processed before the queue closes
+	queue.start()
+	queue.close()
+	assert.Equal(t, int32(2), processed.Load())
+}
+
+func TestIntakeQueuePassesBatchesThroughWhenFull(t *testing.T) {
+	queue := newIntakeQueue(zap.NewNop(), &ProcessingConfig{
+		AsyncIntake: true, QueueSize: 1, IntakeOverflow: intakeOverflowPassThrough,
+	})
+	require.NotNil(t, queue)
+
+	consume := func(ctx context.Context) error { return nil }
+	var passed bool
+	pass := func(ctx context.Context) error {
+		passed = true
+		assert.True(t, modelsSkipped(withoutModels(ctx)))
+		return nil
+	}
+	require.NoError(t, queue.enqueue(context.Background(), consume, pass))
+	assert.False(t, passed)
+	require.NoError(t, queue.enqueue(context.Background(), consume, pass))
+	assert.True(t, passed, "batches overflowing the queue are passed on")
+
+	queue.start()
+	queue.close()
+}
+
+// slowTracesProcessor processes batches until their context is done
+type slowTracesProcessor struct{ tracesProcessor }
+
+func (p *slowTracesProcessor) processTraces(ctx context.Context, td ptrace.Traces) (ptrace.Traces, error) {
+	<-ctx.Done()
+	return td, ctx.Err()
+}
+
+func TestBatchTimeoutPassesBatchOn(t *testing.T) {
+	var spans int
+	next, err := consumer.NewTraces(func(ctx context.Context, td ptrace.Traces) error {
+		spans += td.SpanCount()
+		return nil
+	})
+	require.NoError(t, err)
+	wrapper := &tracesProcessorWrapper{processor: &slowTracesProcessor{}, next: next, timeout: 10 * time.Millisecond}
+
+	td := ptrace.NewTraces()
+	td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	require.NoError(t, wrapper.ConsumeTraces(context.Background(), td))
+	assert.Equal(t, 1, spans, "the batch is passed on once its timeout passes")
+
+	// The pipeline giving up still fails the batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wrapper.timeout = 0
+	assert.ErrorIs(t, wrapper.ConsumeTraces(ctx, td), context.Canceled)
+	assert.Equal(t, 1, spans)
+}
+
+func TestShutdownInterruptsBatches(t *testing.T) {
+	var spans atomic.Int32
+	next, err := consumer.NewTraces(func(ctx context.Context, td ptrace.Traces) error {
+		spans.Add(int32(td.SpanCount()))
+		return nil
+	})
+	require.NoError(t, err)
+	wrapper := &tracesProcessorWrapper{processor: &slowTracesProcessor{}, next: next, stop: newBatchStop()}
+
+	td := ptrace.NewTraces()
+	td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	done := make(chan error)
+	go func() { done <- wrapper.ConsumeTraces(context.Background(), td) }()
+
+	// The batch has no timeout, so only the processor stopping ends it
+	wrapper.stop.stop()
+	require.NoError(t, <-done)
+	assert.Equal(t, int32(1), spans.Load(), "the interrupted batch is passed on")
+
+	// Batches arriving once it stopped are passed on without waiting
+	require.NoError(t, wrapper.ConsumeTraces(context.Background(), td))
+	assert.Equal(t, int32(2), spans.Load())
+}
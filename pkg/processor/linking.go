@@ -0,0 +1,247 @@
+// This file contains context linking, which correlates error logs with the
+// spans of their traces through their trace and span IDs
+
+package processor
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/anomaly"
+)
+
+// Attributes written by context linking, under the output namespace
+const (
+	linkedTraceAttribute = "linked_trace"
+	linkedLogsAttribute  = "linked_logs"
+
+	// errorCategoryAttribute is set on the spikes of error metrics
+	errorCategoryAttribute = "error.category"
+)
+
+// errorMetricWords identify error metrics when none are configured
+var errorMetricWords = []string{"error", "fail", "exception"}
+
+// linkStore holds what the processors have seen of recent traces. Traces
+// are forgotten ttl after they were first seen, and the oldest are
+// forgotten early beyond maxTraces.
+type linkStore struct {
+	ttl       time.Duration
+	maxTraces int
+
+	mutex  sync.Mutex
+	traces map[pcommon.TraceID]*traceLinks
+	order  []*traceLinks // in creation order, which is expiry order
+}
+
+// traceLinks is what was seen of a trace
+type traceLinks struct {
+	id      pcommon.TraceID
+	created time.Time
+
+	// spans is set once spans of the trace were processed
+	spans bool
+
+	// errorLogs counts the error logs of each span, logs without a span
+	// being counted under the empty span ID
+	errorLogs map[pcommon.SpanID]int
+
+	// category is the first category the error classifier gave a span or
+	// log of the trace
+	category string
+}
+
+// newLinkStore creates a store for the context linking configuration
+func newLinkStore(config *ContextLinkingConfig) *linkStore {
+	return &linkStore{
+		ttl:       time.Duration(config.TTLMs) * time.Millisecond,
+		maxTraces: config.MaxTraces,
+		traces:    make(map[pcommon.TraceID]*traceLinks),
+	}
+}
+
+// linkSpans records the traces of td and sets the number of error logs
+// linked to each span. Root spans also count the error logs of their trace
+// without a span ID.
+func (s *linkStore) linkSpans(td ptrace.Traces, namespace string, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now)
+
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				if span.TraceID().IsEmpty() {
+					continue
+				}
+				links := s.get(span.TraceID(), now)
+				links.spans = true
+
+				count := links.errorLogs[span.SpanID()]
+				if span.ParentSpanID().IsEmpty() {
+					count += links.errorLogs[pcommon.SpanID{}]
+				}
+				if count > 0 {
+					span.Attributes().PutInt(namespace+linkedLogsAttribute, int64(count))
+				}
+			}
+		}
+	}
+}
+
+// linkLogs records the error logs of ld and links the logs of traces whose
+// spans were seen to their trace
+func (s *linkStore) linkLogs(ld plog.Logs, namespace string, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now)
+
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		sls := rls.At(i).ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			logs := sls.At(j).LogRecords()
+			for k := 0; k < logs.Len(); k++ {
+				log := logs.At(k)
+				if log.TraceID().IsEmpty() {
+					continue
+				}
+				links := s.get(log.TraceID(), now)
+				if log.SeverityNumber() >= plog.SeverityNumberError {
+					if links.errorLogs == nil {
+						links.errorLogs = make(map[pcommon.SpanID]int)
+					}
+					links.errorLogs[log.SpanID()]++
+				}
+				if links.spans {
+					log.Attributes().PutStr(namespace+linkedTraceAttribute, log.TraceID().String())
+				}
+			}
+		}
+	}
+}
+
+// classify records the category the error classifier gave an item of a
+// trace, unless the trace already has one
+func (s *linkStore) classify(id pcommon.TraceID, category string, now time.Time) {
+	if id.IsEmpty() || category == "" {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now)
+
+	if links := s.get(id, now); links.category == "" {
+		links.category = category
+	}
+}
+
+// linkExemplars sets the error category on the data points of error metrics
+// that anomaly detection found spiking up, from the first trace of their
+// exemplars with a classified error
+func (s *linkStore) linkExemplars(md pmetric.Metrics, config *ContextLinkingConfig, namespace string, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now)
+
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		sms := rms.At(i).ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			metrics := sms.At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				metric := metrics.At(k)
+				if !isErrorMetric(config.ErrorMetrics, metric.Name()) {
+					continue
+				}
+
+				var dps pmetric.NumberDataPointSlice
+				switch metric.Type() {
+				case pmetric.MetricTypeGauge:
+					dps = metric.Gauge().DataPoints()
+				case pmetric.MetricTypeSum:
+					dps = metric.Sum().DataPoints()
+				default:
+					continue
+				}
+
+				for l := 0; l < dps.Len(); l++ {
+					dp := dps.At(l)
+					direction, ok := dp.Attributes().Get(namespace + anomalyDirectionAttribute)
+					if !ok || direction.Str() != anomaly.Up {
+						continue
+					}
+					if category := s.exemplarCategory(dp.Exemplars()); category != "" {
+						dp.Attributes().PutStr(namespace+errorCategoryAttribute, category)
+					}
+				}
+			}
+		}
+	}
+}
+
+// exemplarCategory returns the category of the first trace of exemplars
+// with a classified error. The caller holds the mutex.
+func (s *linkStore) exemplarCategory(exemplars pmetric.ExemplarSlice) string {
+	for i := 0; i < exemplars.Len(); i++ {
+		if links, ok := s.traces[exemplars.At(i).TraceID()]; ok && links.category != "" {
+			return links.category
+		}
+	}
+	return ""
+}
+
+// isErrorMetric reports whether a metric counts or measures errors, by the
+// configured patterns or, without any, by its name
+func isErrorMetric(patterns []string, name string) bool {
+	if len(patterns) > 0 {
+		return metricNameMatches(patterns, name)
+	}
+	name = strings.ToLower(name)
+	for _, word := range errorMetricWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the links of a trace, creating them if needed. The caller
+// holds the mutex.
+func (s *linkStore) get(id pcommon.TraceID, now time.Time) *traceLinks {
+	if links, ok := s.traces[id]; ok {
+		return links
+	}
+
+	links := &traceLinks{id: id, created: now}
+	s.traces[id] = links
+	s.order = append(s.order, links)
+	for s.maxTraces > 0 && len(s.traces) > s.maxTraces {
+		s.pop()
+	}
+	return links
+}
+
+// expire forgets the traces older than the TTL. The caller holds the mutex.
+func (s *linkStore) expire(now time.Time) {
+	for len(s.order) > 0 && now.Sub(s.order[0].created) >= s.ttl {
+		s.pop()
+	}
+}
+
+// pop forgets the oldest trace. The caller holds the mutex.
+func (s *linkStore) pop() {
+	delete(s.traces, s.order[0].id)
+	s.order[0] = nil
+	s.order = s.order[1:]
+}
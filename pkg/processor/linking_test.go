@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestLinkStoreCorrelatesLogsWithSpans(t *testing.T) {
+	store := newLinkStore(&ContextLinkingConfig{TTLMs: 1000, MaxTraces: 2})
+	start := time.Unix(0, 0)
+	checkout := pcommon.TraceID([16]byte{1})
+	charge := pcommon.SpanID([8]byte{2})
+
+	newLogs := func(trace pcommon.TraceID, span pcommon.SpanID, severities ...plog.SeverityNumber) plog.Logs {
+		ld := plog.NewLogs()
+		logs := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+		for _, severity := range severities {
+			log := logs.AppendEmpty()
+			log.SetTraceID(trace)
+			log.SetSpanID(span)
+			log.SetSeverityNumber(severity)
+		}
+		return ld
+	}
+	newSpans := func(trace pcommon.TraceID) (ptrace.Traces, ptrace.Span, ptrace.Span) {
+		td := ptrace.NewTraces()
+		spans := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+		root := spans.AppendEmpty()
+		root.SetTraceID(trace)
+		root.SetSpanID(pcommon.SpanID([8]byte{1}))
+		child := spans.AppendEmpty()
+		child.SetTraceID(trace)
+		child.SetSpanID(charge)
+		child.SetParentSpanID(root.SpanID())
+		return td, root, child
+	}
+
+	// Error logs arriving before the spans are counted on them, logs of
+	// the trace without a span on the root
+	ld := newLogs(checkout, charge, plog.SeverityNumberError, plog.SeverityNumberFatal, plog.SeverityNumberInfo)
+	store.linkLogs(ld, "ai.", start)
+	store.linkLogs(newLogs(checkout, pcommon.SpanID{}, plog.SeverityNumberError), "ai.", start)
+	_, linked := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Get("ai.linked_trace")
+	assert.False(t, linked)
+
+	td, root, child := newSpans(checkout)
+	store.linkSpans(td, "ai.", start.Add(500*time.Millisecond))
+	count, _ := child.Attributes().Get("ai.linked_logs")
+	assert.Equal(t, int64(2), count.Int())
+	count, _ = root.Attributes().Get("ai.linked_logs")
+	assert.Equal(t, int64(1), count.Int())
+
+	// Logs arriving after the spans are linked to the trace
+	ld = newLogs(checkout, charge, plog.SeverityNumberWarn)
+	store.linkLogs(ld, "ai.", start.Add(500*time.Millisecond))
+	trace, _ := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Get("ai.linked_trace")
+	assert.Equal(t, checkout.String(), trace.Str())
+
+	// Traces are forgotten after the TTL
+	td, _, child = newSpans(checkout)
+	store.linkSpans(td, "ai.", start.Add(time.Second))
+	_, linked = child.Attributes().Get("ai.linked_logs")
+	assert.False(t, linked)
+
+	// and beyond the maximum number of traces
+	store.linkLogs(newLogs(pcommon.TraceID([16]byte{2}), charge, plog.SeverityNumberError), "ai.", start.Add(time.Second))
+	store.linkLogs(newLogs(pcommon.TraceID([16]byte{3}), charge, plog.SeverityNumberError), "ai.", start.Add(time.Second))
+	assert.Len(t, store.traces, 2)
+	assert.NotContains(t, store.traces, checkout)
+}
+
+func TestLinkStoreCategorizesErrorMetricSpikes(t *testing.T) {
+	store := newLinkStore(&ContextLinkingConfig{TTLMs: 1000})
+	now := time.Unix(0, 0)
+	timeout := pcommon.TraceID([16]byte{1})
+	store.classify(pcommon.TraceID([16]byte{2}), "", now)
+	store.classify(timeout, "timeout", now)
+	store.classify(timeout, "database_error", now)
+
+	md := pmetric.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+	newPoint := func(name string, direction string) pmetric.NumberDataPoint {
+		metric := metrics.AppendEmpty()
+		metric.SetName(name)
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		if direction != "" {
+			dp.Attributes().PutStr("ai.anomaly.direction", direction)
+		}
+		dp.Exemplars().AppendEmpty().SetTraceID(pcommon.TraceID([16]byte{2}))
+		dp.Exemplars().AppendEmpty().SetTraceID(timeout)
+		return dp
+	}
+	spike := newPoint("http.server.errors", "up")
+	drop := newPoint("http.server.errors", "down")
+	normal := newPoint("http.server.errors", "")
+	latency := newPoint("http.server.duration", "up")
+
+	store.linkExemplars(md, &ContextLinkingConfig{}, "ai.", now)
+	category, _ := spike.Attributes().Get("ai.error.category")
+	assert.Equal(t, "timeout", category.Str())
+	for _, dp := range []pmetric.NumberDataPoint{drop, normal, latency} {
+		_, found := dp.Attributes().Get("ai.error.category")
+		assert.False(t, found)
+	}
+
+	// Configured metrics replace the names mentioning errors
+	store.linkExemplars(md, &ContextLinkingConfig{ErrorMetrics: []string{"http.server.duration"}}, "ai.", now)
+	_, found := latency.Attributes().Get("ai.error.category")
+	assert.True(t, found)
+}
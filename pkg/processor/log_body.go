@@ -0,0 +1,158 @@
+// This file contains the parsing of structured log bodies, whose fields are
+// passed to the models as attributes instead of a raw JSON string
+
+package processor
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// logBodyFields returns the fields of a log body that is a JSON object, or
+// a map, flattened to dotted keys under config.AttributePrefix. Bodies that
+// are not objects, or are larger than config.MaxBodyBytes, have no fields.
+func logBodyFields(body pcommon.Value, config *LogBodyConfig) map[string]interface{} {
+	var object map[string]interface{}
+	switch body.Type() {
+	case pcommon.ValueTypeMap:
+		object = body.Map().AsRaw()
+	case pcommon.ValueTypeStr:
+		text := strings.TrimSpace(body.Str())
+		if !strings.HasPrefix(text, "{") || (config.MaxBodyBytes > 0 && len(text) > config.MaxBodyBytes) {
+			return nil
+		}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	flattener := &logBodyFlattener{config: config, fields: make(map[string]interface{})}
+	if len(config.Fields) == 0 {
+		flattener.addObject("", object, 0)
+	} else {
+		for _, path := range config.Fields {
+			if value, ok := lookupLogBodyField(object, path); ok {
+				flattener.add(path, value, strings.Count(path, ".")+1)
+			}
+		}
+	}
+	if len(flattener.fields) == 0 {
+		return nil
+	}
+	return flattener.fields
+}
+
+// logBodyFlattener collects the scalar fields of a log body, within the
+// depth and number of fields of its configuration
+type logBodyFlattener struct {
+	config *LogBodyConfig
+	fields map[string]interface{}
+}
+
+// add adds the field key at depth, or its nested fields if it is an object.
+// Arrays and null fields are left out.
+func (f *logBodyFlattener) add(key string, value interface{}, depth int) {
+	if object, ok := value.(map[string]interface{}); ok {
+		f.addObject(key+".", object, depth)
+		return
+	}
+	if f.config.MaxFields > 0 && len(f.fields) >= f.config.MaxFields {
+		return
+	}
+	if scalar, ok := logBodyScalar(value); ok {
+		f.fields[f.config.AttributePrefix+key] = scalar
+	}
+}
+
+// addObject adds the fields of an object at depth, in key order so the
+// fields kept within the limit don't vary
+func (f *logBodyFlattener) addObject(prefix string, object map[string]interface{}, depth int) {
+	if f.config.MaxDepth > 0 && depth >= f.config.MaxDepth {
+		return
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f.add(prefix+key, object[key], depth+1)
+	}
+}
+
+// lookupLogBodyField returns the field of object at a dotted path
+func lookupLogBodyField(object map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := object[path]; ok {
+		return value, true
+	}
+	var value interface{} = object
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = nested[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// logBodyScalar returns a scalar field as an attribute value, with JSON
+// numbers as integers when they are
+func logBodyScalar(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string, bool, int64, float64:
+		return v, true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// parseLogBody returns the fields of a log's body for the models. With
+// to_attributes, they are set as attributes of the log instead, without
+// replacing existing ones, and none are returned.
+func parseLogBody(log plog.LogRecord, config *LogBodyConfig) map[string]interface{} {
+	if !config.Enabled {
+		return nil
+	}
+	fields := logBodyFields(log.Body(), config)
+	if !config.ToAttributes {
+		return fields
+	}
+	attributes := log.Attributes()
+	for key, value := range fields {
+		if _, exists := attributes.Get(key); !exists {
+			setAttribute(attributes, key, value)
+		}
+	}
+	return nil
+}
+
+// withLogBodyFields returns attributes with the fields of a log body that
+// don't collide with an attribute. attributes may be shared with the
+// attribute cache, so fields are added to a copy.
+func withLogBodyFields(attributes map[string]interface{}, fields map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(attributes)+len(fields))
+	for key, value := range fields {
+		merged[key] = value
+	}
+	for key, value := range attributes {
+		merged[key] = value
+	}
+	return merged
+}
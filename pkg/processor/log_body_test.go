@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestLogBodyFields(t *testing.T) {
+	config := CreateDefaultConfig().(*Config).LogBody
+	body := pcommon.NewValueStr(`{"msg": "payment failed", "status": 502, "latency": 1.5,
+		"user": {"id": "u-1", "address": {"geo": {"lat": 1, "lon": 2}}}, "tags": ["a"], "error": null}`)
+
+	config.MaxDepth = 3
+	assert.Equal(t, map[string]interface{}{
+		"body.msg":     "payment failed",
+		"body.status":  int64(502),
+		"body.latency": 1.5,
+		"body.user.id": "u-1",
+	}, logBodyFields(body, &config))
+
+	// Selected fields, within the number of fields
+	config.Fields = []string{"user", "status", "missing"}
+	config.MaxFields = 2
+	config.MaxDepth = 0
+	assert.Equal(t, map[string]interface{}{
+		"body.user.address.geo.lat": int64(1),
+		"body.user.address.geo.lon": int64(2),
+	}, logBodyFields(body, &config))
+
+	// Bodies that are not objects, or too large, have no fields
+	config.MaxBodyBytes = 10
+	assert.Nil(t, logBodyFields(body, &config))
+	assert.Nil(t, logBodyFields(pcommon.NewValueStr("payment failed"), &config))
+	assert.Nil(t, logBodyFields(pcommon.NewValueStr("{not json"), &config))
+}
+
+func TestParseLogBody(t *testing.T) {
+	config := CreateDefaultConfig().(*Config).LogBody
+	config.Enabled = true
+
+	log := plog.NewLogRecord()
+	log.Body().SetEmptyMap().PutStr("level", "error")
+	log.Attributes().PutStr("body.level", "set")
+	fields := parseLogBody(log, &config)
+	assert.Equal(t, map[string]interface{}{"body.level": "error"}, fields)
+
+	// Attributes take precedence over the fields passed to the models
+	assert.Equal(t, map[string]interface{}{"body.level": "set", "service": "api"},
+		withLogBodyFields(map[string]interface{}{"body.level": "set", "service": "api"}, fields))
+
+	// Fields set as attributes don't replace existing ones
+	config.ToAttributes = true
+	log.Body().Map().PutStr("code", "E42")
+	assert.Nil(t, parseLogBody(log, &config))
+	assert.Equal(t, map[string]interface{}{"body.level": "set", "body.code": "E42"}, log.Attributes().AsRaw())
+}
@@ -0,0 +1,244 @@
+// This file contains the deduplication of repeated logs, shared by the stub
+// and fullwasm logs processors
+
+package processor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/logtemplate"
+)
+
+// Attributes written on the aggregate records of deduplicated logs, under
+// the output namespace
+const (
+	dedupCountAttribute    = "dedup.count"
+	dedupTemplateAttribute = "dedup.template"
+)
+
+// severityNumbers maps the severities of configuration options to the
+// lowest severity number of each
+var severityNumbers = map[string]plog.SeverityNumber{
+	"trace": plog.SeverityNumberTrace,
+	"debug": plog.SeverityNumberDebug,
+	"info":  plog.SeverityNumberInfo,
+	"warn":  plog.SeverityNumberWarn,
+	"error": plog.SeverityNumberError,
+	"fatal": plog.SeverityNumberFatal,
+}
+
+// logDeduplicator collapses the logs sharing a resource, scope, severity
+// and body template within a window. The first log of each group passes
+// through; the later ones are removed from their batch, and at the end of
+// the window one aggregate record per group stands for them.
+type logDeduplicator struct {
+	window      time.Duration
+	minSeverity plog.SeverityNumber
+	maxGroups   int
+
+	mutex  sync.Mutex
+	groups map[uint64]*logGroup
+
+	// The loop forwarding the aggregates
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// logGroup is the logs of a template seen in the current window
+type logGroup struct {
+	template string
+
+	// duplicates counts the logs removed since the first one passed
+	duplicates int64
+
+	// aggregate holds the first duplicate, with its resource and scope, once
+	// there is one
+	aggregate plog.Logs
+	last      pcommon.Timestamp
+}
+
+// newLogDeduplicator creates the deduplicator for config. It is created
+// whether or not features.log_dedup is enabled, since the control plane
+// can enable it.
+func newLogDeduplicator(config *LogDedupConfig) (*logDeduplicator, error) {
+	if config.WindowMs <= 0 {
+		return nil, errors.New("window must be positive")
+	}
+	severity, ok := severityNumbers[strings.ToLower(config.MinSeverity)]
+	if !ok {
+		return nil, fmt.Errorf("unknown minimum severity %q", config.MinSeverity)
+	}
+	return &logDeduplicator{
+		window:      time.Duration(config.WindowMs) * time.Millisecond,
+		minSeverity: severity,
+		maxGroups:   config.MaxGroups,
+		groups:      make(map[uint64]*logGroup),
+	}, nil
+}
+
+// collapse removes the logs of ld repeating a log seen in the window, along
+// with the scopes and resources they leave empty
+func (d *logDeduplicator) collapse(ld plog.Logs) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ld.ResourceLogs().RemoveIf(func(rl plog.ResourceLogs) bool {
+		resource := calculateResourceHash(rl.Resource())
+		rl.ScopeLogs().RemoveIf(func(sl plog.ScopeLogs) bool {
+			scope := sl.Scope().Name()
+			sl.LogRecords().RemoveIf(func(log plog.LogRecord) bool {
+				if log.SeverityNumber() < d.minSeverity {
+					return false
+				}
+				body := log.Body().AsString()
+				if body == "" {
+					return false
+				}
+
+				template := logtemplate.Template(body)
+				key := logGroupKey(resource, scope, log.SeverityNumber(), template)
+				group, ok := d.groups[key]
+				if !ok {
+					// Logs of groups beyond the limit pass through
+					if d.maxGroups <= 0 || len(d.groups) < d.maxGroups {
+						d.groups[key] = &logGroup{template: template}
+					}
+					return false
+				}
+
+				if group.duplicates == 0 {
+					group.aggregate = plog.NewLogs()
+					aggregate := group.aggregate.ResourceLogs().AppendEmpty()
+					rl.Resource().CopyTo(aggregate.Resource())
+					aggregate.SetSchemaUrl(rl.SchemaUrl())
+					scope := aggregate.ScopeLogs().AppendEmpty()
+					sl.Scope().CopyTo(scope.Scope())
+					scope.SetSchemaUrl(sl.SchemaUrl())
+					log.CopyTo(scope.LogRecords().AppendEmpty())
+				}
+				group.duplicates++
+				if log.Timestamp() > group.last {
+					group.last = log.Timestamp()
+				}
+				return true
+			})
+			return sl.LogRecords().Len() == 0
+		})
+		return rl.ScopeLogs().Len() == 0
+	})
+}
+
+// flush ends the window, returning the aggregate records of the groups that
+// had duplicates. Each records the number of logs it stands for and their
+// template, and carries the timestamp of the latest.
+func (d *logDeduplicator) flush(namespace string) plog.Logs {
+	d.mutex.Lock()
+	groups := d.groups
+	d.groups = make(map[uint64]*logGroup, len(groups))
+	d.mutex.Unlock()
+
+	aggregates := plog.NewLogs()
+	for _, group := range groups {
+		if group.duplicates == 0 {
+			continue
+		}
+		log := group.aggregate.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+		log.Attributes().PutInt(namespace+dedupCountAttribute, group.duplicates)
+		log.Attributes().PutStr(namespace+dedupTemplateAttribute, group.template)
+		if group.last > log.Timestamp() {
+			log.SetTimestamp(group.last)
+		}
+		group.aggregate.ResourceLogs().MoveAndAppendTo(aggregates.ResourceLogs())
+	}
+	return aggregates
+}
+
+// start forwards the aggregates with forward at the end of every window,
+// until stopped
+func (d *logDeduplicator) start(namespace func() string, forward func(context.Context, plog.Logs)) {
+	if d == nil {
+		return
+	}
+	d.stop = make(chan struct{})
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		ticker := time.NewTicker(d.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if aggregates := d.flush(namespace()); aggregates.LogRecordCount() > 0 {
+					forward(context.Background(), aggregates)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// shutdown stops forwarding the aggregates and forwards those of the
+// current window
+func (d *logDeduplicator) shutdown(ctx context.Context, namespace string, forward func(context.Context, plog.Logs)) {
+	if d == nil {
+		return
+	}
+	if d.stop != nil {
+		close(d.stop)
+		d.done.Wait()
+	}
+	if aggregates := d.flush(namespace); aggregates.LogRecordCount() > 0 {
+		forward(ctx, aggregates)
+	}
+}
+
+// logGroupKey identifies the group of a log by its resource, scope,
+// severity and template
+func logGroupKey(resource uint64, scope string, severity plog.SeverityNumber, template string) uint64 {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], resource)
+	binary.LittleEndian.PutUint64(buf[8:], logtemplate.Hash(template))
+
+	hash := fnv.New64a()
+	hash.Write([]byte(scope))
+	hash.Write([]byte{byte(severity)})
+	hash.Write(buf[:])
+	return hash.Sum64()
+}
+
+// forwardAggregates returns the function passing the aggregate records of
+// deduplicated logs to next
+func forwardAggregates(logger *zap.Logger, state *controlState, next consumer.Logs) func(context.Context, plog.Logs) {
+	return func(ctx context.Context, aggregates plog.Logs) {
+		// Collapsed logs were counted as dropped by the batches they arrived in
+		state.recordBatch(signalLogs, 0, aggregates.LogRecordCount())
+
+		// Templates are as long as the messages they were made from
+		for i := 0; i < aggregates.ResourceLogs().Len(); i++ {
+			rl := aggregates.ResourceLogs().At(i)
+			output := state.resourceOutput(rl.Resource())
+			for j := 0; j < rl.ScopeLogs().Len(); j++ {
+				logs := rl.ScopeLogs().At(j).LogRecords()
+				for k := 0; k < logs.Len(); k++ {
+					truncateAttributes(logs.At(k).Attributes(), output)
+				}
+			}
+		}
+		if err := next.ConsumeLogs(ctx, aggregates); err != nil {
+			logger.Error("Failed to pass deduplicated logs on", zap.Error(err))
+		}
+	}
+}
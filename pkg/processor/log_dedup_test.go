@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestLogDeduplicatorCollapsesRepeatedLogs(t *testing.T) {
+	d, err := newLogDeduplicator(&LogDedupConfig{WindowMs: 1000, MinSeverity: "warn", MaxGroups: 2})
+	require.NoError(t, err)
+
+	newLogs := func(service string, severity plog.SeverityNumber, bodies ...string) plog.Logs {
+		ld := plog.NewLogs()
+		rl := ld.ResourceLogs().AppendEmpty()
+		rl.Resource().Attributes().PutStr("service.name", service)
+		logs := rl.ScopeLogs().AppendEmpty().LogRecords()
+		for i, body := range bodies {
+			log := logs.AppendEmpty()
+			log.SetSeverityNumber(severity)
+			log.SetTimestamp(pcommon.Timestamp(i + 1))
+			log.Body().SetStr(body)
+		}
+		return ld
+	}
+
+	// The first log of a template passes, the repeats are collapsed
+	ld := newLogs("checkout", plog.SeverityNumberError,
+		"order 17 not found", "order 18 not found", "order 19 not found", "payment declined")
+	d.collapse(ld)
+	require.Equal(t, 2, ld.LogRecordCount())
+	logs := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	assert.Equal(t, "order 17 not found", logs.At(0).Body().Str())
+	assert.Equal(t, "payment declined", logs.At(1).Body().Str())
+
+	// Logs below the minimum severity, of other resources and beyond the
+	// tracked templates pass through; the last batch is removed whole
+	info := newLogs("checkout", plog.SeverityNumberInfo, "order 20 not found")
+	d.collapse(info)
+	assert.Equal(t, 1, info.LogRecordCount())
+	other := newLogs("cart", plog.SeverityNumberError, "order 21 not found", "order 22 not found")
+	d.collapse(other)
+	assert.Equal(t, 2, other.LogRecordCount())
+	repeat := newLogs("checkout", plog.SeverityNumberError, "order 23 not found")
+	d.collapse(repeat)
+	assert.Equal(t, 0, repeat.ResourceLogs().Len())
+
+	// One aggregate stands for the collapsed logs of a template
+	aggregates := d.flush("ai.")
+	require.Equal(t, 1, aggregates.LogRecordCount())
+	rl := aggregates.ResourceLogs().At(0)
+	service, _ := rl.Resource().Attributes().Get("service.name")
+	assert.Equal(t, "checkout", service.Str())
+	aggregate := rl.ScopeLogs().At(0).LogRecords().At(0)
+	assert.Equal(t, "order 18 not found", aggregate.Body().Str())
+	count, _ := aggregate.Attributes().Get("ai.dedup.count")
+	assert.Equal(t, int64(3), count.Int())
+	template, _ := aggregate.Attributes().Get("ai.dedup.template")
+	assert.Equal(t, "order <*> not found", template.Str())
+	assert.Equal(t, pcommon.Timestamp(3), aggregate.Timestamp())
+
+	// The next window starts over
+	ld = newLogs("checkout", plog.SeverityNumberError, "order 24 not found")
+	d.collapse(ld)
+	assert.Equal(t, 1, ld.LogRecordCount())
+	assert.Equal(t, 0, d.flush("ai.").LogRecordCount())
+}
@@ -0,0 +1,124 @@
+// This file contains the detection of the language or server that wrote a
+// log, routing error logs to the variant of the error classifier trained on
+// its stack traces or formats
+
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Languages error classifier variants are keyed by
+const (
+	logLanguageJava   = "java"
+	logLanguageGo     = "go"
+	logLanguagePython = "python"
+	logLanguageNginx  = "nginx"
+)
+
+var logLanguages = []string{logLanguageJava, logLanguageGo, logLanguagePython, logLanguageNginx}
+
+// logLanguageScanBytes bounds the start of a log body the languages are
+// detected in, so detecting them stays cheap on large bodies
+const logLanguageScanBytes = 4096
+
+var (
+	// javaFramePattern matches a frame of a Java stack trace, such as
+	// "\tat com.acme.Checkout.pay(Checkout.java:42)"
+	javaFramePattern = regexp.MustCompile(`(?m)^\s+at [\w$.<>/]+\([^()\n]*\)\s*$`)
+
+	// nginxAccessPattern matches the combined log format of nginx access
+	// logs
+	nginxAccessPattern = regexp.MustCompile(`^\S+ - \S+ \[[^\]]+\] "[A-Z]+ [^"]* HTTP/[0-9.]+" \d{3} `)
+
+	// nginxErrorPattern matches nginx error logs, such as
+	// "2024/05/01 12:00:00 [error] 31#31: *1 connect() failed"
+	nginxErrorPattern = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} \[[a-z]+\] \d+#\d+: `)
+)
+
+// detectLogLanguage returns the language or server that wrote a log body,
+// or "" if it isn't recognized. Substrings are checked before patterns, so
+// most bodies are rejected without running a regular expression.
+func detectLogLanguage(body string) string {
+	if len(body) > logLanguageScanBytes {
+		body = body[:logLanguageScanBytes]
+	}
+	switch {
+	case strings.Contains(body, "Traceback (most recent call last):"):
+		return logLanguagePython
+	case strings.HasPrefix(body, "panic: ") || (strings.Contains(body, "goroutine ") && strings.Contains(body, " [running]:")):
+		return logLanguageGo
+	case strings.Contains(body, "at ") && javaFramePattern.MatchString(body):
+		return logLanguageJava
+	case strings.Contains(body, " HTTP/") && nginxAccessPattern.MatchString(body),
+		strings.Contains(body, "#") && nginxErrorPattern.MatchString(body):
+		return logLanguageNginx
+	}
+	return ""
+}
+
+// classifierVariant is a variant of the error classifier, served by a
+// runtime of its own
+type classifierVariant struct {
+	runtime    *runtime.WasmRuntime
+	provenance *modelProvenances
+}
+
+// classifierVariants are the variants of the error classifier by language
+type classifierVariants map[string]*classifierVariant
+
+// newClassifierVariants loads the variants of the error classifier of
+// config. It returns nil if there is none.
+func newClassifierVariants(logger *zap.Logger, config *Config) (classifierVariants, error) {
+	if len(config.Models.ErrorClassifier.Variants) == 0 {
+		return nil, nil
+	}
+	variants := make(classifierVariants, len(config.Models.ErrorClassifier.Variants))
+	for language, model := range config.Models.ErrorClassifier.Variants {
+		wasmRuntime, provenance, err := newRuntimeFromConfig(logger.With(zap.String("variant", language)), variantRuntimeConfig(config, model))
+		if err != nil {
+			variants.close()
+			return nil, fmt.Errorf("failed to load %s variant: %w", language, err)
+		}
+		variants[language] = &classifierVariant{runtime: wasmRuntime, provenance: provenance}
+		logger.Info("Loaded error classifier variant", zap.String("language", language))
+	}
+	return variants, nil
+}
+
+// variantRuntimeConfig returns the configuration of the runtime serving a
+// variant of the error classifier of config, alone
+func variantRuntimeConfig(config *Config, model ModelConfig) *Config {
+	variant := *config
+	variant.Models.ErrorClassifier = model
+	variant.Models.ImportanceSampler = ModelConfig{}
+	variant.Models.EntityExtractor = ModelConfig{}
+	variant.Models.Shadow = ShadowConfig{}
+	variant.Models.Bundle = BundleConfig{}
+	return &variant
+}
+
+// detect returns the variant classifying a log body, or nil if the error
+// classifier does
+func (v classifierVariants) detect(body string) *classifierVariant {
+	if len(v) == 0 {
+		return nil
+	}
+	return v[detectLogLanguage(body)]
+}
+
+// close unloads the variants
+func (v classifierVariants) close() error {
+	var errs []error
+	for _, variant := range v {
+		errs = append(errs, variant.runtime.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLogLanguage(t *testing.T) {
+	for body, language := range map[string]string{
+		"Traceback (most recent call last):\n  File \"app.py\", line 3, in <module>\nKeyError: 'id'":                                  logLanguagePython,
+		"panic: runtime error: index out of range\n\ngoroutine 1 [running]:\nmain.main()":                                             logLanguageGo,
+		"worker failed\ngoroutine 7 [running]:\nmain.work()":                                                                          logLanguageGo,
+		"java.lang.IllegalStateException: closed\n\tat com.acme.Checkout.pay(Checkout.java:42)\n\tat com.acme.Main.main(Main.java:7)": logLanguageJava,
+		`10.0.0.1 - - [01/May/2024:12:00:00 +0000] "GET /pay HTTP/1.1" 502 157 "-" "curl/8.0"`:                                        logLanguageNginx,
+		"2024/05/01 12:00:00 [error] 31#31: *1 connect() failed (111: Connection refused)":                                            logLanguageNginx,
+		"payment failed at checkout (retrying)":                                                                                       "",
+		"":                                                                                                                            "",
+	} {
+		assert.Equal(t, language, detectLogLanguage(body), body)
+	}
+}
+
+func TestClassifierVariantsDetect(t *testing.T) {
+	java := &classifierVariant{}
+	variants := classifierVariants{logLanguageJava: java}
+	assert.Same(t, java, variants.detect("Exception\n\tat com.acme.Main.main(Main.java:7)"))
+	assert.Nil(t, variants.detect("Traceback (most recent call last):"))
+	assert.Nil(t, classifierVariants(nil).detect("Exception\n\tat com.acme.Main.main(Main.java:7)"))
+}
@@ -0,0 +1,58 @@
+// This file contains the severity tiers used to sample logs
+
+package processor
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/common"
+)
+
+// rate returns the sampling rate of logs at a severity. Logs at ERROR
+// severity or above have a rate of 1.0 with AlwaysKeepErrors.
+func (c *LogSamplingConfig) rate(severity plog.SeverityNumber) float64 {
+	switch {
+	case severity >= plog.SeverityNumberError:
+		if c.AlwaysKeepErrors {
+			return 1.0
+		}
+		return c.Error
+	case severity >= plog.SeverityNumberWarn:
+		return c.Warn
+	case severity >= plog.SeverityNumberInfo, severity == plog.SeverityNumberUnspecified:
+		return c.Info
+	default:
+		return c.Debug
+	}
+}
+
+// sampleLog returns true if the log should be kept based on the sampling
+// rate (0.0-1.0). Logs of a trace are decided by their trace ID, as spans
+// are, so the logs of a trace at the same rate are kept or dropped together.
+func sampleLog(log plog.LogRecord, rate float64) bool {
+	if traceID := log.TraceID(); !traceID.IsEmpty() {
+		return traceIDSample(traceID, rate)
+	}
+	return randomSample(rate)
+}
+
+// sampleLogW3C returns true if the log should be kept based on the
+// sampling rate (0.0-1.0), with the randomness of W3C Trace Context Level 2.
+// Logs of a trace are decided by their trace ID, and logs without one by a
+// hash of their timestamp, severity and body, so collectors receiving the
+// same log decide the same.
+func sampleLogW3C(log plog.LogRecord, rate float64) bool {
+	if traceID := log.TraceID(); !traceID.IsEmpty() {
+		return common.ThresholdSample(common.TraceRandomness(traceID, ""), rate)
+	}
+	hash := fnv.New64a()
+	var buffer [9]byte
+	binary.BigEndian.PutUint64(buffer[:8], uint64(log.Timestamp()))
+	buffer[8] = byte(log.SeverityNumber())
+	hash.Write(buffer[:])
+	hash.Write([]byte(log.Body().AsString()))
+	return common.ThresholdSample(hash.Sum64()>>8, rate)
+}
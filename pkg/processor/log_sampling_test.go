@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestLogSamplingRateBySeverity(t *testing.T) {
+	config := LogSamplingConfig{AlwaysKeepErrors: true, Error: 0.5, Warn: 0.4, Info: 0.3, Debug: 0.2}
+
+	assert.Equal(t, 1.0, config.rate(plog.SeverityNumberFatal))
+	assert.Equal(t, 1.0, config.rate(plog.SeverityNumberError))
+	assert.Equal(t, 0.4, config.rate(plog.SeverityNumberWarn4))
+	assert.Equal(t, 0.3, config.rate(plog.SeverityNumberInfo))
+	assert.Equal(t, 0.3, config.rate(plog.SeverityNumberUnspecified))
+	assert.Equal(t, 0.2, config.rate(plog.SeverityNumberDebug))
+	assert.Equal(t, 0.2, config.rate(plog.SeverityNumberTrace))
+
+	config.AlwaysKeepErrors = false
+	assert.Equal(t, 0.5, config.rate(plog.SeverityNumberError2))
+}
+
+func TestSampleLogDecidesLogsOfATraceTogether(t *testing.T) {
+	logs := plog.NewLogRecordSlice()
+	for i := 0; i < 100; i++ {
+		logs.AppendEmpty().SetTraceID(pcommon.TraceID([16]byte{8: byte(i), 15: 1}))
+	}
+
+	for i := 0; i < logs.Len(); i++ {
+		kept := sampleLog(logs.At(i), 0.5)
+		for j := 0; j < 10; j++ {
+			assert.Equal(t, kept, sampleLog(logs.At(i), 0.5))
+		}
+		// A log kept at a rate is kept at any higher rate
+		if kept {
+			assert.True(t, sampleLog(logs.At(i), 0.6))
+		}
+	}
+}
+
+func TestSampleLogW3C(t *testing.T) {
+	// Logs of a trace use the 56 low bits of the trace ID: 0x80... is kept
+	// at rates of one half or more
+	log := plog.NewLogRecord()
+	log.SetTraceID(pcommon.TraceID([16]byte{8: 0xff, 9: 0x80}))
+	assert.True(t, sampleLogW3C(log, 0.5))
+	assert.False(t, sampleLogW3C(log, 0.49))
+
+	// Logs without a trace are decided by their content, the same every time
+	logs := plog.NewLogRecordSlice()
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		log := logs.AppendEmpty()
+		log.SetTimestamp(pcommon.Timestamp(i))
+		log.Body().SetStr("disk quota exceeded")
+		if sampleLogW3C(log, 0.5) {
+			kept++
+			assert.True(t, sampleLogW3C(log, 0.5))
+			assert.True(t, sampleLogW3C(log, 0.6))
+		}
+	}
+	assert.InDelta(t, 500, kept, 100)
+}
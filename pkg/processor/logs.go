@@ -7,62 +7,153 @@ package processor
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.uber.org/zap"
 
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
 	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
 )
 
 type fullLogsProcessor struct {
 	logger       *zap.Logger
-	config       *Config
+	state        *controlState
 	nextConsumer consumer.Logs
 	wasmRuntime  *runtime.WasmRuntime
+	hooks        enrichmentHooks
+	residency    *residencyPolicy
+	redaction    *redactionFilter
+	pool         *shardedPool
+	rules        *expression.Engine
+	dedup        *logDeduplicator
+}
+
+// config returns the live configuration, which the control plane can update
+func (p *fullLogsProcessor) config() *Config {
+	return p.state.current()
 }
 
 func newLogsProcessor(
-	logger *zap.Logger,
+	set component.TelemetrySettings,
 	config *Config,
 	nextConsumer consumer.Logs,
+	hooks enrichmentHooks,
 ) (logsProcessor, error) {
-	// Initialize WASM runtime
-	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
-		ErrorClassifierPath:   config.Models.ErrorClassifier.Path,
-		ErrorClassifierMemory: config.Models.ErrorClassifier.MemoryLimitMB,
-		SamplerPath:           config.Models.ImportanceSampler.Path,
-		SamplerMemory:         config.Models.ImportanceSampler.MemoryLimitMB,
-		EntityExtractorPath:   config.Models.EntityExtractor.Path,
-		EntityExtractorMemory: config.Models.EntityExtractor.MemoryLimitMB,
-	})
+	logger := set.Logger
+
+	// Share the live configuration with the other processors, and the control
+	// plane and models once started
+	state := referenceControlState(set, config)
+
+	// Compile the rules evaluated before model invocation
+	rules, err := newRulesEngine(config)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("failed to compile rules: %w", err)
+	}
+
+	// Label data residency and restrict model backends accordingly
+	residency, err := newResidencyPolicy(&config.Residency, config.Output.AttributeNamespace)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid residency configuration: %w", err)
+	}
+
+	// Compile the patterns of personal data to redact
+	redaction, err := newRedactionFilter(&config.Redaction)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid redaction configuration: %w", err)
+	}
+
+	// Track the templates of logs to collapse repeated ones
+	dedup, err := newLogDeduplicator(&config.LogDedup)
 	if err != nil {
-		return nil, err
+		state.release()
+		return nil, fmt.Errorf("invalid log deduplication configuration: %w", err)
 	}
 
 	return &fullLogsProcessor{
 		logger:       logger,
-		config:       config,
+		state:        state,
 		nextConsumer: nextConsumer,
-		wasmRuntime:  wasmRuntime,
+		hooks:        hooks,
+		rules:        rules,
+		residency:    residency,
+		redaction:    redaction,
+		dedup:        dedup,
 	}, nil
 }
 
-func (p *fullLogsProcessor) processLogs(ctx context.Context, ld plog.Logs) (plog.Logs, error) {
-	// If no AI features are enabled, pass through the data unchanged
-	if !p.config.Features.ErrorClassification && 
-	   !p.config.Features.SmartSampling && 
-	   !p.config.Features.EntityExtraction {
+func (p *fullLogsProcessor) processLogs(ctx context.Context, ld plog.Logs) (out plog.Logs, err error) {
+	// Count received and dropped items for the control plane
+	received := ld.LogRecordCount()
+	usage := p.state.memory.start()
+	defer func() {
+		p.state.recordBatch(signalLogs, received, out.LogRecordCount())
+		p.state.memory.record(ctx, signalLogs, usage, received)
+	}()
+
+	// Label residency before anything else reads the resources
+	p.residency.tagLogs(ld)
+
+	// Redact personal data before models, backends or exporters see it
+	if p.state.anyConfig(piiRedaction) {
+		p.redaction.redactLogs(ld, p.state.redacts)
+	}
+
+	// Collapse repeated logs before models look at them
+	if p.config().Features.LogDedup {
+		p.dedup.collapse(ld)
+	}
+
+	// If no AI features, hooks, rules or hints are enabled, pass through the data unchanged
+	if !p.state.anyConfig(modelFeatures) &&
+	   !p.config().Features.ContextLinking &&
+	   len(p.hooks) == 0 &&
+	   p.rules == nil &&
+	   !p.config().Hints.Enabled {
 		return ld, nil
 	}
 
+	// Collect the decisions forced by rules, drops are applied once the batch is processed
+	ctx, decisions := withRuleDecisions(ctx)
+	defer func() {
+		// Apply sampling if enabled, otherwise only the drops forced by rules.
+		// Batches interrupted before all their logs were processed are
+		// sampled too, at the sampling rates alone.
+		if p.state.anyConfig(smartSampling) {
+			p.sampleLogs(ctx, ld)
+		} else {
+			removeDroppedLogs(ld, decisions)
+		}
+	}()
+
+	// Wait while the processors are busy with other batches
+	release, err := p.state.acquireBatch(ctx)
+	if err != nil {
+		return ld, err
+	}
+	defer release()
+
+	// Link the logs with the traces seen and count their errors
+	if p.config().Features.ContextLinking {
+		p.state.links.linkLogs(ld, p.config().Output.AttributeNamespace, time.Now())
+	}
+
 	// Use parallel processing if enabled
-	if p.config.Processing.EnableParallelProcessing {
+	if p.pool != nil {
 		return p.processLogsParallel(ctx, ld)
 	}
 
 	// Serial processing
+	errorsOnly := p.errorLogsOnly()
 	rls := ld.ResourceLogs()
 	for i := 0; i < rls.Len(); i++ {
 		rl := rls.At(i)
@@ -74,6 +165,9 @@ func (p *fullLogsProcessor) processLogs(ctx context.Context, ld plog.Logs) (plog
 			
 			for k := 0; k < logs.Len(); k++ {
 				log := logs.At(k)
+				if errorsOnly && log.SeverityNumber() < plog.SeverityNumberError {
+					continue
+				}
 				p.processLogRecord(ctx, log, rl.Resource())
 			}
 		}
@@ -84,70 +178,167 @@ func (p *fullLogsProcessor) processLogs(ctx context.Context, ld plog.Logs) (plog
 
 // Process logs in parallel for better performance
 func (p *fullLogsProcessor) processLogsParallel(ctx context.Context, ld plog.Logs) (plog.Logs, error) {
-	// Create a worker pool
-	numWorkers := p.config.Processing.MaxParallelWorkers
-	if numWorkers <= 0 {
-		numWorkers = 8 // Default to 8 workers
-	}
-	pool := newWorkerPool(numWorkers)
-	defer pool.close()
+	var batch sync.WaitGroup
 
-	// Process each resource log
-	rls := ld.ResourceLogs()
-	for i := 0; i < rls.Len(); i++ {
-		rl := rls.At(i)
-		sls := rl.ScopeLogs()
-		
-		for j := 0; j < sls.Len(); j++ {
-			sl := sls.At(j)
-			
-			// Process logs in parallel
-			processLogsInParallel(ctx, pool, sl.LogRecords(), rl.Resource(), p.processLogRecord)
+	// With ordered completion the workers only run the models, and the
+	// hooks run in batch order once all items are enriched
+	ordered := p.config().Processing.OrderedCompletion
+	process := p.processLogRecord
+	if ordered {
+		process = func(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) {
+			p.enrichLogRecord(itemContext(ctx, p.state, p.residency, resource), log, resource)
+		}
+	}
+	if p.errorLogsOnly() {
+		enrich := process
+		process = func(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) {
+			if log.SeverityNumber() >= plog.SeverityNumberError {
+				enrich(ctx, log, resource)
+			}
 		}
 	}
 
+	// Process the logs of each scope in parallel on the shard of its resource
+	if err := processLogsInParallel(ctx, p.pool, &batch, ld, process); err != nil {
+		batch.Wait()
+		return ld, err
+	}
+
 	// Wait for all logs to be processed
-	pool.wait()
+	batch.Wait()
+	if ordered {
+		p.runHooksInOrder(ctx, ld)
+	}
 
 	return ld, nil
 }
 
+// errorLogsOnly reports whether only error logs need processing, which is
+// the case when no model, hook, rule or hint other than the error classifier
+// looks at individual logs
+func (p *fullLogsProcessor) errorLogsOnly() bool {
+	return !p.state.anyConfig(entityExtraction) && len(p.hooks) == 0 && p.rules == nil && !p.config().Hints.Enabled
+}
+
+// processLogRecord enriches a log and runs the hooks on it
 func (p *fullLogsProcessor) processLogRecord(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) {
-	// Extract information for classification
-	logInfo := map[string]interface{}{
-		"severity":    log.SeverityText(),
-		"body":        log.Body().AsString(),
-		"attributes":  attributesToMap(log.Attributes()),
-		"resource":    attributesToMap(resource.Attributes()),
+	ctx = itemContext(ctx, p.state, p.residency, resource)
+	p.enrichLogRecord(ctx, log, resource)
+
+	// Run custom enrichment hooks after the models
+	p.hooks.onLog(ctx, p.logger, log, resource)
+}
+
+// enrichLogRecord evaluates the rules and invokes the models for a log, ctx
+// being its item context
+func (p *fullLogsProcessor) enrichLogRecord(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) {
+	// Parse JSON bodies first, so rules see the fields set as attributes
+	bodyFields := parseLogBody(log, &p.config().LogBody)
+
+	// Evaluate rules and hints before invoking the models
+	var rules expression.Result
+	if p.rules != nil {
+		rules = evaluateRules(p.logger, p.rules, logRuleInput(log, resource))
+		applyRuleAttributes(&rules, log.Attributes())
 	}
+	if hints := &p.config().Hints; hints.Enabled {
+		applyHints(hints, log.Attributes(), &rules)
+	}
+	ruleDecisionsFrom(ctx).set(log, &rules)
+
+	// Logs of batches passed through or past their timeout skip the models
+	if modelsSkipped(ctx) {
+		return
+	}
+
+	features := &itemConfig(ctx, p.config()).Features
+	classify := features.ErrorClassification && log.SeverityNumber() >= plog.SeverityNumberError &&
+		!rules.Skips(runtime.ModelErrorClassifier)
+	extract := features.EntityExtraction && !rules.Skips(runtime.ModelEntityExtractor)
+
+	if classify || extract {
+		// Extract information for classification, shared by both models
+		severity := log.SeverityText()
+		body := log.Body().AsString()
+		attributes := attributesToMap(log.Attributes())
+		if len(bodyFields) > 0 {
+			attributes = withLogBodyFields(attributes, bodyFields)
+		}
+		resourceAttributes := resourceToMap(resource)
+
+		// Classify error logs if enabled
+		if classify {
+			p.classifyLogError(ctx, log, &runtime.ErrorInput{
+				Severity:   severity,
+				Body:       body,
+				Attributes: attributes,
+				Resource:   resourceAttributes,
+			})
+		}
+
+		// Extract entities if enabled
+		if extract {
+			p.extractLogEntities(ctx, log, &runtime.EntityInput{
+				Severity:   severity,
+				Body:       body,
+				Attributes: attributes,
+				Resource:   resourceAttributes,
+			})
+		}
+	}
+}
 
-	// Classify error logs if enabled
-	if p.config.Features.ErrorClassification && log.SeverityNumber() >= plog.SeverityNumberError {
-		p.classifyLogError(ctx, log, logInfo)
+// runHooksInOrder runs the enrichment hooks on the log records of ld in order
+func (p *fullLogsProcessor) runHooksInOrder(ctx context.Context, ld plog.Logs) {
+	if len(p.hooks) == 0 {
+		return
 	}
 
-	// Extract entities if enabled
-	if p.config.Features.EntityExtraction {
-		p.extractLogEntities(ctx, log, logInfo)
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		rl := rls.At(i)
+		itemCtx := itemContext(ctx, p.state, p.residency, rl.Resource())
+		sls := rl.ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			logs := sls.At(j).LogRecords()
+			for k := 0; k < logs.Len(); k++ {
+				p.hooks.onLog(itemCtx, p.logger, logs.At(k), rl.Resource())
+			}
+		}
 	}
 }
 
-func (p *fullLogsProcessor) classifyLogError(ctx context.Context, log plog.LogRecord, logInfo map[string]interface{}) {
-	// Call error classifier model
-	result, err := p.wasmRuntime.ClassifyError(ctx, logInfo)
+func (p *fullLogsProcessor) classifyLogError(ctx context.Context, log plog.LogRecord, logInfo *runtime.ErrorInput) {
+	// Call error classifier model, or its variant for the log's language
+	classifier, provenance := p.wasmRuntime, p.state.provenance
+	if variant := p.state.variants.detect(logInfo.Body); variant != nil {
+		classifier, provenance = variant.runtime, variant.provenance
+	}
+	result, err := classifier.ClassifyError(ctx, logInfo)
 	if err != nil {
 		p.logger.Error("Failed to classify log error", zap.Error(err))
 		return
 	}
 
 	// Add classification attributes to log
+	output := &itemConfig(ctx, p.config()).Output
 	for k, v := range result {
-		attrKey := p.config.Output.AttributeNamespace + k
+		attrKey := output.AttributeNamespace + k
 		setAttribute(log.Attributes(), attrKey, v)
 	}
+	output.Severity.rewriteLog(log, result, output.AttributeNamespace)
+	setOwnerAttributes(log.Attributes(), p.state.ownership, result, logInfo, output.AttributeNamespace)
+	truncateAttributes(log.Attributes(), output)
+	provenance.annotate(log.Attributes(), runtime.ModelErrorClassifier, output)
+
+	// Remember the category for the spikes of error metrics
+	if p.config().Features.ContextLinking {
+		category, _ := result["category"].(string)
+		p.state.links.classify(log.TraceID(), truncateString(category, output.MaxAttributeLength), time.Now())
+	}
 }
 
-func (p *fullLogsProcessor) extractLogEntities(ctx context.Context, log plog.LogRecord, logInfo map[string]interface{}) {
+func (p *fullLogsProcessor) extractLogEntities(ctx context.Context, log plog.LogRecord, logInfo *runtime.EntityInput) {
 	// Call entity extractor model
 	result, err := p.wasmRuntime.ExtractEntities(ctx, logInfo)
 	if err != nil {
@@ -156,15 +347,116 @@ func (p *fullLogsProcessor) extractLogEntities(ctx context.Context, log plog.Log
 	}
 
 	// Add entity attributes to log
-	for k, v := range result {
-		attrKey := p.config.Output.AttributeNamespace + k
-		setAttribute(log.Attributes(), attrKey, v)
+	output := &itemConfig(ctx, p.config()).Output
+	setEntityAttributes(log.Attributes(), result, output)
+	truncateAttributes(log.Attributes(), output)
+	p.state.provenance.annotate(log.Attributes(), runtime.ModelEntityExtractor, output)
+}
+
+// sampleLogs keeps or drops the log records of ld at the rate of their
+// severity, weighted by the importance the sampler model gives them unless
+// the rate is 1.0, and with similarity sampling by their novelty. Decisions
+// forced by rules take precedence. Dropped logs are removed from ld in
+// place, along with the scopes and resources they leave empty. The logs of
+// tenants with smart sampling disabled are only dropped by rules.
+func (p *fullLogsProcessor) sampleLogs(ctx context.Context, ld plog.Logs) {
+	decisions := ruleDecisionsFrom(ctx)
+	tally := p.state.accounting.tally()
+	ld.ResourceLogs().RemoveIf(func(rl plog.ResourceLogs) bool {
+		itemCtx := itemContext(ctx, p.state, p.residency, rl.Resource())
+		service := accountingService(rl.Resource())
+		config := itemConfig(itemCtx, p.config())
+		metadata := config.Output.IncludeSamplingMetadata
+		namespace := config.Output.AttributeNamespace
+		rl.ScopeLogs().RemoveIf(func(sl plog.ScopeLogs) bool {
+			sl.LogRecords().RemoveIf(func(log plog.LogRecord) bool {
+				var decision samplingDecision
+				rules := decisions.get(log)
+				if !config.Features.SmartSampling {
+					return rules.sampling == expression.SamplingDrop
+				}
+				switch rules.sampling {
+				case expression.SamplingKeep:
+					decision = samplingDecision{keep: true, reason: samplingReasonRule}
+				case expression.SamplingDrop:
+					tally.addLog(service, log, false)
+					return true
+				default:
+					decision = p.makeLogSamplingDecision(itemCtx, log, rl.Resource(), rules.skipSampler)
+					decision = p.state.similarity.decide(itemCtx, &p.config().Sampling.Similarity, signalLogs,
+						similarityText(rl.Resource(), log.Body().AsString()), decision)
+				}
+				if decision.keep && metadata {
+					decision.annotate(log.Attributes(), namespace)
+				}
+				tally.addLog(service, log, decision.keep)
+				return !decision.keep
+			})
+			return sl.LogRecords().Len() == 0
+		})
+		return rl.ScopeLogs().Len() == 0
+	})
+	p.state.accounting.record(signalLogs, tally)
+}
+
+// makeLogSamplingDecision decides whether to keep a log, ctx being its item
+// context
+func (p *fullLogsProcessor) makeLogSamplingDecision(ctx context.Context, log plog.LogRecord, resource pcommon.Resource, skipSampler bool) samplingDecision {
+	sampling := &itemConfig(ctx, p.config()).Sampling
+	sample := func(rate float64) bool {
+		if sampling.Randomness == samplingRandomnessW3C {
+			return sampleLogW3C(log, rate)
+		}
+		return sampleLog(log, rate)
+	}
+
+	// Rates of 1.0 and 0.0 do not depend on the importance
+	rate := sampling.Logs.rate(log.SeverityNumber())
+	if rate >= 1.0 || rate <= 0.0 {
+		return samplingDecision{keep: rate >= 1.0, reason: samplingReasonSeverity}
+	}
+	if skipSampler || modelsSkipped(ctx) {
+		return samplingDecision{keep: sample(rate), reason: samplingReasonRate}
 	}
+
+	// Call the sampler model with the log's body as its name
+	status := log.SeverityText()
+	if status == "" {
+		status = log.SeverityNumber().String()
+	}
+	result, err := p.wasmRuntime.SampleTelemetry(ctx, &runtime.SampleInput{
+		Name:       log.Body().AsString(),
+		Status:     status,
+		Attributes: attributesToMap(log.Attributes()),
+		Resource:   resourceToMap(resource),
+	})
+	if err != nil {
+		p.logger.Error("Failed to make log sampling decision", zap.Error(err))
+		// Default to the severity's rate
+		return samplingDecision{keep: sample(rate), reason: samplingReasonRate}
+	}
+	return modelSamplingDecision(result, rate, sample)
 }
 
-func (p *fullLogsProcessor) shutdown(ctx context.Context) error {
-	if p.wasmRuntime != nil {
-		return p.wasmRuntime.Close()
+// start starts the processing workers, which are shared by all batches
+func (p *fullLogsProcessor) start(ctx context.Context, host component.Host) error {
+	// The first processor to start loads the models shared by all of them
+	if err := p.state.start(); err != nil {
+		return err
 	}
+	p.wasmRuntime = p.state.runtime
+	p.pool = newProcessingPool(&p.config().Processing)
+	p.dedup.start(p.namespace, forwardAggregates(p.logger, p.state, p.nextConsumer))
 	return nil
+}
+
+func (p *fullLogsProcessor) shutdown(ctx context.Context) error {
+	p.pool.close()
+	p.dedup.shutdown(ctx, p.namespace(), forwardAggregates(p.logger, p.state, p.nextConsumer))
+	return p.state.release()
+}
+
+// namespace returns the live attribute namespace
+func (p *fullLogsProcessor) namespace() string {
+	return p.config().Output.AttributeNamespace
 }
\ No newline at end of file
@@ -7,7 +7,9 @@ package processor
 
 import (
 	"context"
+	"fmt"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.uber.org/zap"
@@ -20,41 +22,97 @@ type stubLogsProcessor struct {
 	config       *Config
 	nextConsumer consumer.Logs
 	wasmRuntime  *runtime.WasmRuntime
+	hooks        enrichmentHooks
+	residency    *residencyPolicy
+	redaction    *redactionFilter
+	dedup        *logDeduplicator
+	state        *controlState
 }
 
 func newLogsProcessor(
-	logger *zap.Logger,
+	set component.TelemetrySettings,
 	config *Config,
 	nextConsumer consumer.Logs,
+	hooks enrichmentHooks,
 ) (logsProcessor, error) {
-	// Initialize WASM runtime
-	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
-		ErrorClassifierPath:   config.Models.ErrorClassifier.Path,
-		ErrorClassifierMemory: config.Models.ErrorClassifier.MemoryLimitMB,
-		SamplerPath:           config.Models.ImportanceSampler.Path,
-		SamplerMemory:         config.Models.ImportanceSampler.MemoryLimitMB,
-		EntityExtractorPath:   config.Models.EntityExtractor.Path,
-		EntityExtractorMemory: config.Models.EntityExtractor.MemoryLimitMB,
-	})
+	logger := set.Logger
+
+	// Share the live configuration with the other processors, and the control
+	// plane and models once started
+	state := referenceControlState(set, config)
+
+	// Label data residency and restrict model backends accordingly
+	residency, err := newResidencyPolicy(&config.Residency, config.Output.AttributeNamespace)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid residency configuration: %w", err)
+	}
+
+	// Compile the patterns of personal data to redact
+	redaction, err := newRedactionFilter(&config.Redaction)
 	if err != nil {
-		return nil, err
+		state.release()
+		return nil, fmt.Errorf("invalid redaction configuration: %w", err)
+	}
+
+	// Track the templates of logs to collapse repeated ones
+	dedup, err := newLogDeduplicator(&config.LogDedup)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid log deduplication configuration: %w", err)
 	}
 
 	return &stubLogsProcessor{
 		logger:       logger,
 		config:       config,
 		nextConsumer: nextConsumer,
-		wasmRuntime:  wasmRuntime,
+		hooks:        hooks,
+		state:        state,
+		residency:    residency,
+		redaction:    redaction,
+		dedup:        dedup,
 	}, nil
 }
 
 func (p *stubLogsProcessor) processLogs(ctx context.Context, ld plog.Logs) (plog.Logs, error) {
+	received := ld.LogRecordCount()
+
+	// Label data residency, which applies without models too
+	p.residency.tagLogs(ld)
+
+	// Redact personal data before models, backends or exporters see it
+	if p.state.anyConfig(piiRedaction) {
+		p.redaction.redactLogs(ld, p.state.redacts)
+	}
+
+	// Collapse repeated logs, which needs no models either
+	if p.state.current().Features.LogDedup {
+		p.dedup.collapse(ld)
+	}
+
 	// Stub implementation just passes logs through
 	p.logger.Debug("Stub logs processor called", 
 		zap.Int("log_record_count", ld.LogRecordCount()))
+	p.state.recordBatch(signalLogs, received, ld.LogRecordCount())
 	return ld, nil
 }
 
+func (p *stubLogsProcessor) start(ctx context.Context, host component.Host) error {
+	// The first processor to start loads the models shared by all of them
+	if err := p.state.start(); err != nil {
+		return err
+	}
+	p.wasmRuntime = p.state.runtime
+	p.dedup.start(p.namespace, forwardAggregates(p.logger, p.state, p.nextConsumer))
+	return nil
+}
+
 func (p *stubLogsProcessor) shutdown(ctx context.Context) error {
-	return p.wasmRuntime.Close()
+	p.dedup.shutdown(ctx, p.namespace(), forwardAggregates(p.logger, p.state, p.nextConsumer))
+	return p.state.release()
+}
+
+// namespace returns the live attribute namespace
+func (p *stubLogsProcessor) namespace() string {
+	return p.state.current().Output.AttributeNamespace
 }
\ No newline at end of file
@@ -0,0 +1,51 @@
+//go:build fullwasm
+// +build fullwasm
+
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+)
+
+func TestSampleLogsKeepsErrorsAndDropsBySeverity(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Sampling.Logs = LogSamplingConfig{AlwaysKeepErrors: true, Error: 0, Warn: 1, Info: 0, Debug: 0}
+
+	state := &controlState{}
+	state.config.Store(config)
+	p := &fullLogsProcessor{logger: zap.NewNop(), state: state}
+
+	ld := plog.NewLogs()
+	addLog := func(rl plog.ResourceLogs, severity plog.SeverityNumber, body string) plog.LogRecord {
+		log := rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+		log.SetSeverityNumber(severity)
+		log.Body().SetStr(body)
+		return log
+	}
+
+	// Errors are kept despite their rate, info logs are dropped with the
+	// resource they leave empty unless a rule keeps them
+	payments := ld.ResourceLogs().AppendEmpty()
+	addLog(payments, plog.SeverityNumberError, "payment declined")
+	addLog(payments, plog.SeverityNumberWarn, "retrying charge")
+	addLog(payments, plog.SeverityNumberInfo, "charge started")
+	addLog(ld.ResourceLogs().AppendEmpty(), plog.SeverityNumberDebug, "cache hit")
+	forced := addLog(ld.ResourceLogs().AppendEmpty(), plog.SeverityNumberInfo, "audit")
+
+	ctx, decisions := withRuleDecisions(context.Background())
+	decisions.set(forced, &expression.Result{Sampling: expression.SamplingKeep})
+
+	p.sampleLogs(ctx, ld)
+	require.Equal(t, 2, ld.ResourceLogs().Len())
+	assert.Equal(t, 2, ld.ResourceLogs().At(0).ScopeLogs().Len())
+	assert.Equal(t, "audit", ld.ResourceLogs().At(1).ScopeLogs().At(0).LogRecords().At(0).Body().Str())
+	assert.Equal(t, 3, ld.LogRecordCount())
+}
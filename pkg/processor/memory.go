@@ -0,0 +1,170 @@
+// This file contains the allocation and garbage collection telemetry of the
+// processors, and the tuning of the garbage collector
+
+package processor
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Runtime metrics read around each batch
+const (
+	heapAllocsMetric = "/gc/heap/allocs:bytes"
+	gcCyclesMetric   = "/gc/cycles/total:gc-cycles"
+	gcPausesMetric   = "/sched/pauses/total/gc:seconds"
+)
+
+// memoryTelemetry reports the allocations and GC activity of the process
+// while batches are processed. The runtime only counts them per process, so
+// batches processed at the same time, by these or other components, are
+// each charged with all activity during them.
+type memoryTelemetry struct {
+	allocatedPerItem metric.Float64Histogram
+	gcCycles         metric.Int64Counter
+	gcPauses         metric.Float64Counter
+}
+
+// memoryUsage is a reading of the runtime metrics at the start of a batch
+type memoryUsage struct {
+	allocated uint64
+	gcCycles  uint64
+	gcPauses  metrics.Float64Histogram
+}
+
+// newMemoryTelemetry creates the instruments of the memory telemetry, or
+// returns nil if it is disabled
+func newMemoryTelemetry(provider metric.MeterProvider, config *MemoryConfig) (*memoryTelemetry, error) {
+	if !config.Telemetry {
+		return nil, nil
+	}
+	meter := provider.Meter(meterScope)
+
+	allocatedPerItem, err := meter.Float64Histogram("ai_processor.allocated_bytes_per_item",
+		metric.WithDescription("Bytes allocated per item while a batch was processed"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	gcCycles, err := meter.Int64Counter("ai_processor.gc.cycles",
+		metric.WithDescription("GC cycles completed while batches were processed"))
+	if err != nil {
+		return nil, err
+	}
+	gcPauses, err := meter.Float64Counter("ai_processor.gc.pause_time",
+		metric.WithDescription("Estimated GC stop-the-world time while batches were processed"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryTelemetry{allocatedPerItem: allocatedPerItem, gcCycles: gcCycles, gcPauses: gcPauses}, nil
+}
+
+// start reads the runtime metrics at the start of a batch
+func (m *memoryTelemetry) start() *memoryUsage {
+	if m == nil {
+		return nil
+	}
+	usage := &memoryUsage{}
+	usage.read()
+	return usage
+}
+
+// record reports the activity since start for a batch of items
+func (m *memoryTelemetry) record(ctx context.Context, signal string, start *memoryUsage, items int) {
+	if m == nil {
+		return
+	}
+	var end memoryUsage
+	end.read()
+
+	attributes := metric.WithAttributes(attribute.String("signal", signal))
+	if items > 0 {
+		m.allocatedPerItem.Record(ctx, float64(end.allocated-start.allocated)/float64(items), attributes)
+	}
+	if cycles := end.gcCycles - start.gcCycles; cycles > 0 {
+		m.gcCycles.Add(ctx, int64(cycles), attributes)
+		m.gcPauses.Add(ctx, pauseTime(&start.gcPauses, &end.gcPauses), attributes)
+	}
+}
+
+// read reads the runtime metrics into u
+func (u *memoryUsage) read() {
+	samples := [3]metrics.Sample{{Name: heapAllocsMetric}, {Name: gcCyclesMetric}, {Name: gcPausesMetric}}
+	metrics.Read(samples[:])
+
+	u.allocated = samples[0].Value.Uint64()
+	u.gcCycles = samples[1].Value.Uint64()
+	if samples[2].Value.Kind() == metrics.KindFloat64Histogram {
+		u.gcPauses = *samples[2].Value.Float64Histogram()
+	}
+}
+
+// pauseTime estimates the pause time between two readings of the pause
+// histogram from the midpoints of the buckets of the new pauses
+func pauseTime(start, end *metrics.Float64Histogram) float64 {
+	var total float64
+	for i, count := range end.Counts {
+		if i < len(start.Counts) {
+			count -= start.Counts[i]
+		}
+		if count == 0 {
+			continue
+		}
+		low, high := end.Buckets[i], end.Buckets[i+1]
+		if math.IsInf(low, -1) {
+			low = 0
+		}
+		if math.IsInf(high, 1) {
+			high = low
+		}
+		total += float64(count) * (low + high) / 2
+	}
+	return total
+}
+
+// tuneGC applies the GC settings of config to the process and returns the
+// function restoring the previous settings
+func tuneGC(logger *zap.Logger, config *MemoryConfig) func() {
+	var restore []func()
+
+	if config.GCPercent > 0 {
+		if gogc := os.Getenv("GOGC"); gogc != "" {
+			logger.Info("memory.gc_percent overrides GOGC", zap.String("GOGC", gogc), zap.Int("gc_percent", config.GCPercent))
+		}
+		previous := debug.SetGCPercent(config.GCPercent)
+		restore = append(restore, func() { debug.SetGCPercent(previous) })
+	}
+
+	if config.MemoryLimitMiB > 0 {
+		previous := debug.SetMemoryLimit(int64(config.MemoryLimitMiB) << 20)
+		restore = append(restore, func() { debug.SetMemoryLimit(previous) })
+	} else if config.GCPercent > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		// A higher GOGC lets the heap grow further between collections,
+		// which containers may not have room for without a limit
+		logger.Info("memory.gc_percent is set without a memory limit, consider memory.memory_limit_mib")
+	}
+
+	if config.BallastMiB > 0 {
+		if config.MemoryLimitMiB > 0 {
+			logger.Warn("memory.ballast_mib is redundant with memory.memory_limit_mib, which bounds the heap by itself")
+		}
+		// The ballast is never written, so it takes address space but no
+		// resident memory, and only raises the heap size GOGC scales
+		ballast := make([]byte, config.BallastMiB<<20)
+		restore = append(restore, func() { runtime.KeepAlive(ballast) })
+	}
+
+	return func() {
+		for i := len(restore) - 1; i >= 0; i-- {
+			restore[i]()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTuneGCRestoresSettings(t *testing.T) {
+	gcPercent := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(gcPercent)
+	memoryLimit := debug.SetMemoryLimit(math.MaxInt64)
+	defer debug.SetMemoryLimit(memoryLimit)
+
+	restore := tuneGC(zap.NewNop(), &MemoryConfig{GCPercent: 200, MemoryLimitMiB: 512, BallastMiB: 1})
+	assert.Equal(t, 200, debug.SetGCPercent(-1))
+	debug.SetGCPercent(200)
+	assert.Equal(t, int64(512<<20), debug.SetMemoryLimit(-1))
+
+	restore()
+	assert.Equal(t, 100, debug.SetGCPercent(-1))
+	debug.SetGCPercent(100)
+	assert.Equal(t, int64(math.MaxInt64), debug.SetMemoryLimit(-1))
+}
+
+func TestPauseTimeCountsNewPauses(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 0.001, 0.003, math.Inf(1)}
+	start := metrics.Float64Histogram{Counts: []uint64{0, 1, 0}, Buckets: buckets}
+	end := metrics.Float64Histogram{Counts: []uint64{0, 2, 1}, Buckets: buckets}
+
+	// One new pause in [1ms, 3ms) and one of at least 3ms
+	assert.InDelta(t, 0.002+0.003, pauseTime(&start, &end), 1e-9)
+	assert.Zero(t, pauseTime(&end, &end))
+}
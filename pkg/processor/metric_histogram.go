@@ -0,0 +1,159 @@
+// This file contains the quantiles of histogram data points estimated from
+// their buckets, so histograms are scored and passed to the models as one
+// value like gauges and sums
+
+package processor
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// histogramBucket is a bucket of a histogram, counting the values in
+// (lower, upper]
+type histogramBucket struct {
+	lower float64
+	upper float64
+	count uint64
+}
+
+// explicitBuckets returns the buckets of a histogram data point in
+// ascending order. The first and last buckets are bounded by the minimum
+// and maximum of the data point if it has them, and are unbounded otherwise.
+func explicitBuckets(dp pmetric.HistogramDataPoint) []histogramBucket {
+	bounds := dp.ExplicitBounds()
+	counts := dp.BucketCounts()
+	if counts.Len() != bounds.Len()+1 {
+		return nil
+	}
+	buckets := make([]histogramBucket, counts.Len())
+	for i := range buckets {
+		buckets[i] = histogramBucket{lower: math.Inf(-1), upper: math.Inf(1), count: counts.At(i)}
+		if i > 0 {
+			buckets[i].lower = bounds.At(i - 1)
+		}
+		if i < bounds.Len() {
+			buckets[i].upper = bounds.At(i)
+		}
+	}
+	if dp.HasMin() && dp.Min() <= buckets[0].upper {
+		buckets[0].lower = dp.Min()
+	}
+	if last := len(buckets) - 1; dp.HasMax() && dp.Max() >= buckets[last].lower {
+		buckets[last].upper = dp.Max()
+	}
+	return buckets
+}
+
+// exponentialBuckets returns the buckets of an exponential histogram data
+// point in ascending order: the negative buckets, the zero bucket and the
+// positive buckets
+func exponentialBuckets(dp pmetric.ExponentialHistogramDataPoint) []histogramBucket {
+	// Bucket index i counts the values in (base^i, base^(i+1)], with base
+	// 2^(2^-scale)
+	bound := func(index int64) float64 {
+		return math.Exp2(float64(index) * math.Exp2(-float64(dp.Scale())))
+	}
+	negative, positive := dp.Negative(), dp.Positive()
+	buckets := make([]histogramBucket, 0, negative.BucketCounts().Len()+1+positive.BucketCounts().Len())
+	for i := negative.BucketCounts().Len() - 1; i >= 0; i-- {
+		index := int64(negative.Offset()) + int64(i)
+		buckets = append(buckets, histogramBucket{lower: -bound(index + 1), upper: -bound(index), count: negative.BucketCounts().At(i)})
+	}
+	buckets = append(buckets, histogramBucket{lower: -dp.ZeroThreshold(), upper: dp.ZeroThreshold(), count: dp.ZeroCount()})
+	for i := 0; i < positive.BucketCounts().Len(); i++ {
+		index := int64(positive.Offset()) + int64(i)
+		buckets = append(buckets, histogramBucket{lower: bound(index), upper: bound(index + 1), count: positive.BucketCounts().At(i)})
+	}
+	return buckets
+}
+
+// bucketQuantile estimates the q quantile of the values counted by buckets,
+// interpolating linearly within the bucket it falls in. It returns false if
+// the buckets are empty. A quantile in an unbounded bucket is its finite
+// bound, and the lower bound of a first bucket holding positive values is 0.
+func bucketQuantile(buckets []histogramBucket, q float64) (float64, bool) {
+	var total uint64
+	for _, bucket := range buckets {
+		total += bucket.count
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := q * float64(total)
+	var seen uint64
+	for i, bucket := range buckets {
+		if bucket.count == 0 {
+			continue
+		}
+		seen += bucket.count
+		if float64(seen) < rank && i < len(buckets)-1 {
+			continue
+		}
+
+		lower, upper := bucket.lower, bucket.upper
+		switch {
+		case math.IsInf(lower, -1) && math.IsInf(upper, 1):
+			return 0, false
+		case math.IsInf(upper, 1):
+			return lower, true
+		case math.IsInf(lower, -1):
+			if upper <= 0 {
+				return upper, true
+			}
+			lower = 0
+		}
+		fraction := (rank - float64(seen-bucket.count)) / float64(bucket.count)
+		return lower + (upper-lower)*math.Min(math.Max(fraction, 0), 1), true
+	}
+	return 0, false
+}
+
+// withCounts returns buckets with other counts, such as their increase
+// since the previous data point of a cumulative series
+func withCounts(buckets []histogramBucket, counts []uint64) []histogramBucket {
+	updated := make([]histogramBucket, len(buckets))
+	for i, bucket := range buckets {
+		updated[i] = histogramBucket{lower: bucket.lower, upper: bucket.upper, count: counts[i]}
+	}
+	return updated
+}
+
+// bucketCounts returns the counts of buckets
+func bucketCounts(buckets []histogramBucket) []uint64 {
+	counts := make([]uint64, len(buckets))
+	for i, bucket := range buckets {
+		counts[i] = bucket.count
+	}
+	return counts
+}
+
+// bucketLayout identifies the bounds of buckets. The bounds of the first and
+// last buckets are left out, since they follow the minimum and maximum of
+// each data point.
+func bucketLayout(buckets []histogramBucket) uint64 {
+	hash := fnv.New64a()
+	var buf [8]byte
+	for i, bucket := range buckets {
+		if i > 0 {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(bucket.lower))
+			hash.Write(buf[:])
+		}
+	}
+	return hash.Sum64()
+}
+
+// histogramQuantile estimates the q quantile of a histogram data point
+func histogramQuantile(dp pmetric.HistogramDataPoint, q float64) (float64, bool) {
+	return bucketQuantile(explicitBuckets(dp), q)
+}
+
+// exponentialHistogramQuantile estimates the q quantile of an exponential
+// histogram data point
+func exponentialHistogramQuantile(dp pmetric.ExponentialHistogramDataPoint, q float64) (float64, bool) {
+	return bucketQuantile(exponentialBuckets(dp), q)
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	dp := pmetric.NewHistogramDataPoint()
+	dp.ExplicitBounds().FromRaw([]float64{10, 100, 1000})
+	dp.BucketCounts().FromRaw([]uint64{50, 40, 10, 0})
+
+	p50, ok := histogramQuantile(dp, 0.5)
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, p50)
+
+	p95, _ := histogramQuantile(dp, 0.95)
+	assert.Equal(t, 550.0, p95)
+
+	// Values in the unbounded bucket are estimated by its bound, or the
+	// maximum of the data point
+	dp.BucketCounts().FromRaw([]uint64{0, 0, 0, 10})
+	p99, _ := histogramQuantile(dp, 0.99)
+	assert.Equal(t, 1000.0, p99)
+	dp.SetMax(3000)
+	p99, _ = histogramQuantile(dp, 0.99)
+	assert.InDelta(t, 2980.0, p99, 1e-9)
+
+	_, ok = histogramQuantile(pmetric.NewHistogramDataPoint(), 0.99)
+	assert.False(t, ok)
+}
+
+func TestExponentialHistogramQuantile(t *testing.T) {
+	// At scale 0 bucket i counts the values in (2^i, 2^(i+1)]
+	dp := pmetric.NewExponentialHistogramDataPoint()
+	dp.Positive().SetOffset(3)
+	dp.Positive().BucketCounts().FromRaw([]uint64{90, 10})
+	dp.Negative().BucketCounts().FromRaw([]uint64{10})
+	dp.SetZeroCount(10)
+
+	p99, ok := exponentialHistogramQuantile(dp, 0.99)
+	assert.True(t, ok)
+	assert.InDelta(t, 16+16*0.88, p99, 1e-9)
+
+	p1, _ := exponentialHistogramQuantile(dp, 0.01)
+	assert.InDelta(t, -1.88, p1, 1e-9)
+
+	// The zero bucket holds the values around 0
+	p10, _ := exponentialHistogramQuantile(dp, 0.1)
+	assert.Equal(t, 0.0, p10)
+}
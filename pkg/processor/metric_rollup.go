@@ -0,0 +1,416 @@
+// This file contains the rollup of the metrics rules drop, whose data points
+// are merged across high-cardinality attributes instead of being dropped
+
+package processor
+
+import (
+	"fmt"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Aggregations of the gauge data points merged by a rollup
+const (
+	rollupGaugeSum  = "sum"
+	rollupGaugeMean = "mean"
+	rollupGaugeMin  = "min"
+	rollupGaugeMax  = "max"
+	rollupGaugeLast = "last"
+)
+
+// rollupDroppedMetrics replaces the metrics that rules dropped with their
+// rollup, whose data points have the attributes of config removed and are
+// merged. Exponential histograms and summaries can't be merged across
+// series, so they are left for removeDroppedMetrics.
+func rollupDroppedMetrics(md pmetric.Metrics, decisions *ruleDecisions, config *MetricRollupConfig) {
+	if !config.Enabled || !decisions.hasDrops() {
+		return
+	}
+	rollup := &metricRollup{config: config, resources: make(map[uint64]*rollupResource)}
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		resourceHash := calculateResourceHash(rm.Resource())
+		var resource *rollupResource
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			sm := sms.At(j)
+			var scope *rollupScope
+			sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				if decisions.get(metric).sampling != expression.SamplingDrop || !rollable(metric) {
+					return false
+				}
+				if resource == nil {
+					resource = rollup.resource(rm)
+				}
+				if scope == nil {
+					scope = resource.scope(sm)
+				}
+				scope.metric(metric).add(metric, resourceHash, config)
+				return true
+			})
+		}
+	}
+	rollup.appendTo(md)
+}
+
+// rollable reports whether the data points of metric can be merged
+func rollable(metric pmetric.Metric) bool {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge, pmetric.MetricTypeSum, pmetric.MetricTypeHistogram:
+		return true
+	}
+	return false
+}
+
+// metricRollup collects the rolled up metrics of a batch by resource, scope
+// and metric, in the order they are first seen
+type metricRollup struct {
+	config    *MetricRollupConfig
+	resources map[uint64]*rollupResource
+	order     []*rollupResource
+}
+
+type rollupResource struct {
+	resource  pcommon.Resource
+	schemaURL string
+	scopes    map[string]*rollupScope
+	order     []*rollupScope
+}
+
+type rollupScope struct {
+	scope     pcommon.InstrumentationScope
+	schemaURL string
+	metrics   map[string]*rollupMetric
+	order     []*rollupMetric
+}
+
+// rollupMetric collects the data points of a metric by their attributes
+// once rolled up
+type rollupMetric struct {
+	metric pmetric.Metric
+	points map[uint64]*rollupPoint
+	order  []*rollupPoint
+}
+
+// rollupPoint collects the data points merged into one. Data points of
+// cumulative sums and histograms, and of gauges, are the latest of each of
+// the series merged, those of delta ones are all added.
+type rollupPoint struct {
+	attributes pcommon.Map
+	series     map[rollupSeries]int
+	numbers    []pmetric.NumberDataPoint
+	histograms []pmetric.HistogramDataPoint
+}
+
+// rollupSeries identifies a series merged by a rollup, before its
+// attributes are removed
+type rollupSeries struct {
+	resource   uint64
+	attributes uint64
+}
+
+// resource returns the rollup of the resource of rm, without the resource
+// attributes of the configuration
+func (r *metricRollup) resource(rm pmetric.ResourceMetrics) *rollupResource {
+	resource := pcommon.NewResource()
+	rm.Resource().CopyTo(resource)
+	removeAttributes(resource.Attributes(), r.config.ResourceAttributes)
+
+	hash := calculateResourceHash(resource)
+	if rolled, ok := r.resources[hash]; ok {
+		return rolled
+	}
+	rolled := &rollupResource{
+		resource:  resource,
+		schemaURL: rm.SchemaUrl(),
+		scopes:    make(map[string]*rollupScope),
+	}
+	r.resources[hash] = rolled
+	r.order = append(r.order, rolled)
+	return rolled
+}
+
+// scope returns the rollup of the scope of sm
+func (r *rollupResource) scope(sm pmetric.ScopeMetrics) *rollupScope {
+	key := sm.Scope().Name() + "\x00" + sm.Scope().Version()
+	if rolled, ok := r.scopes[key]; ok {
+		return rolled
+	}
+	rolled := &rollupScope{
+		scope:     pcommon.NewInstrumentationScope(),
+		schemaURL: sm.SchemaUrl(),
+		metrics:   make(map[string]*rollupMetric),
+	}
+	sm.Scope().CopyTo(rolled.scope)
+	r.scopes[key] = rolled
+	r.order = append(r.order, rolled)
+	return rolled
+}
+
+// metric returns the rollup of metric, shared by the metrics of the same
+// name, type, unit and temporality
+func (s *rollupScope) metric(metric pmetric.Metric) *rollupMetric {
+	key := fmt.Sprintf("%s\x00%d\x00%s", metric.Name(), metric.Type(), metric.Unit())
+	switch metric.Type() {
+	case pmetric.MetricTypeSum:
+		key += fmt.Sprintf("\x00%d\x00%t", metric.Sum().AggregationTemporality(), metric.Sum().IsMonotonic())
+	case pmetric.MetricTypeHistogram:
+		key += fmt.Sprintf("\x00%d", metric.Histogram().AggregationTemporality())
+	}
+	if rolled, ok := s.metrics[key]; ok {
+		return rolled
+	}
+
+	rolled := &rollupMetric{metric: pmetric.NewMetric(), points: make(map[uint64]*rollupPoint)}
+	rolled.metric.SetName(metric.Name())
+	rolled.metric.SetDescription(metric.Description())
+	rolled.metric.SetUnit(metric.Unit())
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		rolled.metric.SetEmptyGauge()
+	case pmetric.MetricTypeSum:
+		rolled.metric.SetEmptySum().SetAggregationTemporality(metric.Sum().AggregationTemporality())
+		rolled.metric.Sum().SetIsMonotonic(metric.Sum().IsMonotonic())
+	case pmetric.MetricTypeHistogram:
+		rolled.metric.SetEmptyHistogram().SetAggregationTemporality(metric.Histogram().AggregationTemporality())
+	}
+	s.metrics[key] = rolled
+	s.order = append(s.order, rolled)
+	return rolled
+}
+
+// add adds the data points of metric, from the resource with resourceHash
+func (m *rollupMetric) add(metric pmetric.Metric, resourceHash uint64, config *MetricRollupConfig) {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		points := metric.Gauge().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			point, series := m.point(points.At(i).Attributes(), resourceHash, config)
+			point.addNumber(series, points.At(i), true)
+		}
+	case pmetric.MetricTypeSum:
+		latest := metric.Sum().AggregationTemporality() != pmetric.AggregationTemporalityDelta
+		points := metric.Sum().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			point, series := m.point(points.At(i).Attributes(), resourceHash, config)
+			point.addNumber(series, points.At(i), latest)
+		}
+	case pmetric.MetricTypeHistogram:
+		latest := metric.Histogram().AggregationTemporality() != pmetric.AggregationTemporalityDelta
+		points := metric.Histogram().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			point, series := m.point(points.At(i).Attributes(), resourceHash, config)
+			point.addHistogram(series, points.At(i), latest)
+		}
+	}
+}
+
+// point returns the rollup of the data point with attributes, without the
+// attributes of the configuration, and the series the data point is of
+func (m *rollupMetric) point(attributes pcommon.Map, resourceHash uint64, config *MetricRollupConfig) (*rollupPoint, rollupSeries) {
+	series := rollupSeries{resource: resourceHash, attributes: calculateAttributeMapHash(attributes)}
+
+	rolled := pcommon.NewMap()
+	attributes.CopyTo(rolled)
+	removeAttributes(rolled, config.Attributes)
+	hash := calculateAttributeMapHash(rolled)
+	if point, ok := m.points[hash]; ok {
+		return point, series
+	}
+	point := &rollupPoint{attributes: rolled, series: make(map[rollupSeries]int)}
+	m.points[hash] = point
+	m.order = append(m.order, point)
+	return point, series
+}
+
+// addNumber adds a data point of series. With latest, it only replaces an
+// earlier data point of the series.
+func (p *rollupPoint) addNumber(series rollupSeries, dp pmetric.NumberDataPoint, latest bool) {
+	if latest {
+		if i, ok := p.series[series]; ok {
+			if dp.Timestamp() >= p.numbers[i].Timestamp() {
+				p.numbers[i] = dp
+			}
+			return
+		}
+		p.series[series] = len(p.numbers)
+	}
+	p.numbers = append(p.numbers, dp)
+}
+
+// addHistogram adds a data point of series. With latest, it only replaces
+// an earlier data point of the series.
+func (p *rollupPoint) addHistogram(series rollupSeries, dp pmetric.HistogramDataPoint, latest bool) {
+	if latest {
+		if i, ok := p.series[series]; ok {
+			if dp.Timestamp() >= p.histograms[i].Timestamp() {
+				p.histograms[i] = dp
+			}
+			return
+		}
+		p.series[series] = len(p.histograms)
+	}
+	p.histograms = append(p.histograms, dp)
+}
+
+// appendTo appends the rolled up metrics to md
+func (r *metricRollup) appendTo(md pmetric.Metrics) {
+	for _, resource := range r.order {
+		rm := md.ResourceMetrics().AppendEmpty()
+		resource.resource.MoveTo(rm.Resource())
+		rm.SetSchemaUrl(resource.schemaURL)
+		for _, scope := range resource.order {
+			sm := rm.ScopeMetrics().AppendEmpty()
+			scope.scope.MoveTo(sm.Scope())
+			sm.SetSchemaUrl(scope.schemaURL)
+			for _, metric := range scope.order {
+				metric.merge(r.config)
+				metric.metric.MoveTo(sm.Metrics().AppendEmpty())
+			}
+		}
+	}
+}
+
+// merge sets the data points of the rolled up metric, one per rolled up
+// attributes
+func (m *rollupMetric) merge(config *MetricRollupConfig) {
+	for _, point := range m.order {
+		switch m.metric.Type() {
+		case pmetric.MetricTypeGauge:
+			mergeNumberPoints(point, m.metric.Gauge().DataPoints().AppendEmpty(), config.Gauge)
+		case pmetric.MetricTypeSum:
+			mergeNumberPoints(point, m.metric.Sum().DataPoints().AppendEmpty(), rollupGaugeSum)
+		case pmetric.MetricTypeHistogram:
+			mergeHistogramPoints(point, m.metric.Histogram().DataPoints().AppendEmpty())
+		}
+	}
+}
+
+// mergeNumberPoints merges the data points of point into dp with
+// aggregation. The value stays an integer unless a data point is a double
+// or they are averaged.
+func mergeNumberPoints(point *rollupPoint, dp pmetric.NumberDataPoint, aggregation string) {
+	point.attributes.MoveTo(dp.Attributes())
+	ints := make([]int64, 0, len(point.numbers))
+	doubles := make([]float64, 0, len(point.numbers))
+	isInt := aggregation != rollupGaugeMean
+	last := point.numbers[0]
+	for _, number := range point.numbers {
+		mergeTimestamps(dp, number.StartTimestamp(), number.Timestamp())
+		if number.Timestamp() >= last.Timestamp() {
+			last = number
+		}
+		switch number.ValueType() {
+		case pmetric.NumberDataPointValueTypeInt:
+			ints = append(ints, number.IntValue())
+			doubles = append(doubles, float64(number.IntValue()))
+		case pmetric.NumberDataPointValueTypeDouble:
+			isInt = false
+			doubles = append(doubles, number.DoubleValue())
+		}
+	}
+
+	switch {
+	case aggregation == rollupGaugeLast && last.ValueType() == pmetric.NumberDataPointValueTypeInt:
+		dp.SetIntValue(last.IntValue())
+	case aggregation == rollupGaugeLast:
+		dp.SetDoubleValue(last.DoubleValue())
+	case isInt:
+		dp.SetIntValue(aggregate(ints, aggregation))
+	default:
+		dp.SetDoubleValue(aggregate(doubles, aggregation))
+	}
+}
+
+// aggregate returns the sum, mean, minimum or maximum of values
+func aggregate[T int64 | float64](values []T, aggregation string) T {
+	result := values[0]
+	for _, value := range values[1:] {
+		switch aggregation {
+		case rollupGaugeMin:
+			if value < result {
+				result = value
+			}
+		case rollupGaugeMax:
+			if value > result {
+				result = value
+			}
+		default:
+			result += value
+		}
+	}
+	if aggregation == rollupGaugeMean {
+		result /= T(len(values))
+	}
+	return result
+}
+
+// mergeHistogramPoints merges the data points of point into dp, adding
+// their counts. Data points whose bucket bounds differ from those of the
+// first can't be merged and are dropped, as the rule decided.
+func mergeHistogramPoints(point *rollupPoint, dp pmetric.HistogramDataPoint) {
+	point.attributes.MoveTo(dp.Attributes())
+	first := point.histograms[0]
+	first.ExplicitBounds().CopyTo(dp.ExplicitBounds())
+	buckets := make([]uint64, first.BucketCounts().Len())
+	hasSum, hasMin, hasMax := false, true, true
+	var sum float64
+	for _, histogram := range point.histograms {
+		if !histogram.ExplicitBounds().Equal(first.ExplicitBounds()) || histogram.BucketCounts().Len() != len(buckets) {
+			continue
+		}
+		mergeTimestamps(dp, histogram.StartTimestamp(), histogram.Timestamp())
+		dp.SetCount(dp.Count() + histogram.Count())
+		for i := range buckets {
+			buckets[i] += histogram.BucketCounts().At(i)
+		}
+		if histogram.HasSum() {
+			hasSum = true
+			sum += histogram.Sum()
+		}
+		hasMin = hasMin && histogram.HasMin()
+		if hasMin && (!dp.HasMin() || histogram.Min() < dp.Min()) {
+			dp.SetMin(histogram.Min())
+		}
+		hasMax = hasMax && histogram.HasMax()
+		if hasMax && (!dp.HasMax() || histogram.Max() > dp.Max()) {
+			dp.SetMax(histogram.Max())
+		}
+	}
+	dp.BucketCounts().FromRaw(buckets)
+	if hasSum {
+		dp.SetSum(sum)
+	}
+	if !hasMin {
+		dp.RemoveMin()
+	}
+	if !hasMax {
+		dp.RemoveMax()
+	}
+}
+
+// mergeTimestamps widens the start and end of dp to those of a data point
+// merged into it
+func mergeTimestamps(dp interface {
+	StartTimestamp() pcommon.Timestamp
+	SetStartTimestamp(pcommon.Timestamp)
+	Timestamp() pcommon.Timestamp
+	SetTimestamp(pcommon.Timestamp)
+}, start, end pcommon.Timestamp) {
+	if start != 0 && (dp.StartTimestamp() == 0 || start < dp.StartTimestamp()) {
+		dp.SetStartTimestamp(start)
+	}
+	if end > dp.Timestamp() {
+		dp.SetTimestamp(end)
+	}
+}
+
+// removeAttributes removes keys from attributes
+func removeAttributes(attributes pcommon.Map, keys []string) {
+	for _, key := range keys {
+		attributes.Remove(key)
+	}
+}
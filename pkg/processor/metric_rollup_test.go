@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestRollupDroppedMetrics(t *testing.T) {
+	_, decisions := withRuleDecisions(context.Background())
+	drop := &expression.Result{Sampling: expression.SamplingDrop}
+
+	md := pmetric.NewMetrics()
+	for i, pod := range []string{"pod-a", "pod-b"} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service.name", "checkout")
+		rm.Resource().Attributes().PutStr("k8s.pod.name", pod)
+		metrics := rm.ScopeMetrics().AppendEmpty().Metrics()
+
+		requests := metrics.AppendEmpty()
+		requests.SetName("http.requests")
+		requests.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		for _, value := range []int64{10, 20} {
+			dp := requests.Sum().DataPoints().AppendEmpty()
+			dp.Attributes().PutStr("route", "/pay")
+			dp.Attributes().PutStr("client.address", pod)
+			dp.SetTimestamp(1000 + pcommon.Timestamp(value))
+			dp.SetIntValue(value * int64(i+1))
+		}
+		decisions.set(requests, drop)
+
+		memory := metrics.AppendEmpty()
+		memory.SetName("memory.usage")
+		dp := memory.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(float64(100 * (i + 1)))
+		decisions.set(memory, drop)
+
+		latency := metrics.AppendEmpty()
+		latency.SetName("http.latency")
+		latency.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		hdp := latency.Histogram().DataPoints().AppendEmpty()
+		hdp.ExplicitBounds().FromRaw([]float64{10, 100})
+		hdp.BucketCounts().FromRaw([]uint64{1, 2, 3})
+		hdp.SetCount(6)
+		hdp.SetSum(float64(300 * (i + 1)))
+		decisions.set(latency, drop)
+
+		summary := metrics.AppendEmpty()
+		summary.SetName("gc.pause")
+		summary.SetEmptySummary().DataPoints().AppendEmpty()
+		decisions.set(summary, drop)
+
+		kept := metrics.AppendEmpty()
+		kept.SetName("errors")
+		kept.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(1)
+	}
+
+	config := CreateDefaultConfig().(*Config).MetricRollup
+	config.Enabled = true
+	config.Attributes = []string{"client.address"}
+	config.ResourceAttributes = []string{"k8s.pod.name"}
+	rollupDroppedMetrics(md, decisions, &config)
+	removeDroppedMetrics(md, decisions)
+
+	require.Equal(t, 3, md.ResourceMetrics().Len())
+	for i := 0; i < 2; i++ {
+		metrics := md.ResourceMetrics().At(i).ScopeMetrics().At(0).Metrics()
+		require.Equal(t, 1, metrics.Len())
+		assert.Equal(t, "errors", metrics.At(0).Name())
+	}
+
+	rolled := md.ResourceMetrics().At(2)
+	assert.Equal(t, map[string]interface{}{"service.name": "checkout"}, rolled.Resource().Attributes().AsRaw())
+	metrics := rolled.ScopeMetrics().At(0).Metrics()
+	require.Equal(t, 3, metrics.Len())
+
+	// The latest value of each pod's cumulative series is added
+	requests := metrics.At(0).Sum()
+	assert.Equal(t, pmetric.AggregationTemporalityCumulative, requests.AggregationTemporality())
+	require.Equal(t, 1, requests.DataPoints().Len())
+	assert.Equal(t, map[string]interface{}{"route": "/pay"}, requests.DataPoints().At(0).Attributes().AsRaw())
+	assert.Equal(t, int64(20+40), requests.DataPoints().At(0).IntValue())
+	assert.Equal(t, 1000+pcommon.Timestamp(20), requests.DataPoints().At(0).Timestamp())
+
+	assert.Equal(t, 300.0, metrics.At(1).Gauge().DataPoints().At(0).DoubleValue())
+
+	latency := metrics.At(2).Histogram().DataPoints().At(0)
+	assert.Equal(t, uint64(12), latency.Count())
+	assert.Equal(t, 900.0, latency.Sum())
+	assert.Equal(t, []uint64{2, 4, 6}, latency.BucketCounts().AsRaw())
+	assert.Equal(t, []float64{10, 100}, latency.ExplicitBounds().AsRaw())
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{4, 1, 7}
+	assert.Equal(t, 12.0, aggregate(values, rollupGaugeSum))
+	assert.Equal(t, 4.0, aggregate(values, rollupGaugeMean))
+	assert.Equal(t, 1.0, aggregate(values, rollupGaugeMin))
+	assert.Equal(t, 7.0, aggregate(values, rollupGaugeMax))
+	assert.Equal(t, int64(7), aggregate([]int64{4, 1, 7}, rollupGaugeMax))
+}
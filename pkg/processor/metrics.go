@@ -7,58 +7,143 @@ package processor
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.uber.org/zap"
 
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
 	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
 )
 
 type fullMetricsProcessor struct {
 	logger       *zap.Logger
-	config       *Config
+	state        *controlState
 	nextConsumer consumer.Metrics
 	wasmRuntime  *runtime.WasmRuntime
+	hooks        enrichmentHooks
+	residency    *residencyPolicy
+	pool         *shardedPool
+	privacy      *privacyFilter
+	anomalies    *anomalyDetector
+	rules        *expression.Engine
+}
+
+// config returns the live configuration, which the control plane can update
+func (p *fullMetricsProcessor) config() *Config {
+	return p.state.current()
 }
 
 func newMetricsProcessor(
-	logger *zap.Logger,
+	set component.TelemetrySettings,
 	config *Config,
 	nextConsumer consumer.Metrics,
+	hooks enrichmentHooks,
 ) (metricsProcessor, error) {
-	// Initialize WASM runtime
-	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
-		ErrorClassifierPath:   config.Models.ErrorClassifier.Path,
-		ErrorClassifierMemory: config.Models.ErrorClassifier.MemoryLimitMB,
-		SamplerPath:           config.Models.ImportanceSampler.Path,
-		SamplerMemory:         config.Models.ImportanceSampler.MemoryLimitMB,
-		EntityExtractorPath:   config.Models.EntityExtractor.Path,
-		EntityExtractorMemory: config.Models.EntityExtractor.MemoryLimitMB,
-	})
+	logger := set.Logger
+
+	// Share the live configuration with the other processors, and the control
+	// plane and models once started
+	state := referenceControlState(set, config)
+
+	// Compile the rules evaluated before model invocation
+	rules, err := newRulesEngine(config)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("failed to compile rules: %w", err)
+	}
+
+	// Label data residency and restrict model backends accordingly
+	residency, err := newResidencyPolicy(&config.Residency, config.Output.AttributeNamespace)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid residency configuration: %w", err)
+	}
+
+	// Protect aggregate metrics shared across tenants
+	privacy, err := newPrivacyFilter(&config.Privacy)
 	if err != nil {
-		return nil, err
+		state.release()
+		return nil, fmt.Errorf("invalid privacy configuration: %w", err)
+	}
+
+	// Track the baselines of metric series to annotate anomalies
+	anomalies, err := newAnomalyDetector(&config.AnomalyDetection)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid anomaly detection configuration: %w", err)
 	}
 
 	return &fullMetricsProcessor{
 		logger:       logger,
-		config:       config,
+		state:        state,
 		nextConsumer: nextConsumer,
-		wasmRuntime:  wasmRuntime,
+		hooks:        hooks,
+		rules:        rules,
+		residency:    residency,
+		privacy:      privacy,
+		anomalies:    anomalies,
 	}, nil
 }
 
-func (p *fullMetricsProcessor) processMetrics(ctx context.Context, md pmetric.Metrics) (pmetric.Metrics, error) {
-	// If no AI features are enabled, pass through the data unchanged
-	if !p.config.Features.ErrorClassification && 
-	   !p.config.Features.SmartSampling && 
-	   !p.config.Features.EntityExtraction {
+func (p *fullMetricsProcessor) processMetrics(ctx context.Context, md pmetric.Metrics) (out pmetric.Metrics, err error) {
+	// Count received and dropped items for the control plane
+	received := md.MetricCount()
+	usage := p.state.memory.start()
+	defer func() {
+		p.state.recordBatch(signalMetrics, received, out.MetricCount())
+		p.state.memory.record(ctx, signalMetrics, usage, received)
+	}()
+
+	// Label residency before anything else reads the resources
+	p.residency.tagMetrics(md)
+
+	// Score data points against their baselines, which models don't need
+	if p.config().Features.AnomalyDetection {
+		p.anomalies.annotate(md, p.config().Output.AttributeNamespace)
+
+		// Point the spikes of error metrics at the errors of their traces
+		if p.config().Features.ContextLinking {
+			p.state.links.linkExemplars(md, &p.config().ContextLinking, p.config().Output.AttributeNamespace, time.Now())
+		}
+	}
+
+	// Protect aggregates once everything else has been applied
+	defer func() { p.privacy.apply(out) }()
+
+	// If no entity extraction, hooks, rules or hints are enabled, pass
+	// through the data unchanged, since the other models don't look at
+	// metrics
+	if !p.state.anyConfig(entityExtraction) &&
+	   len(p.hooks) == 0 &&
+	   p.rules == nil &&
+	   !p.config().Hints.Enabled {
 		return md, nil
 	}
 
+	// Collect the decisions forced by rules, drops are applied once the batch is processed,
+	// after rolling up the dropped metrics when metric_rollup is enabled. Interrupted
+	// batches get the drops decided for the metrics processed before.
+	ctx, decisions := withRuleDecisions(ctx)
+	defer func() {
+		rollupDroppedMetrics(md, decisions, &p.config().MetricRollup)
+		removeDroppedMetrics(md, decisions)
+	}()
+
+	// Wait while the processors are busy with other batches
+	release, err := p.state.acquireBatch(ctx)
+	if err != nil {
+		return md, err
+	}
+	defer release()
+
 	// Use parallel processing if enabled
-	if p.config.Processing.EnableParallelProcessing {
+	if p.pool != nil {
 		return p.processMetricsParallel(ctx, md)
 	}
 
@@ -84,41 +169,79 @@ func (p *fullMetricsProcessor) processMetrics(ctx context.Context, md pmetric.Me
 
 // Process metrics in parallel for better performance
 func (p *fullMetricsProcessor) processMetricsParallel(ctx context.Context, md pmetric.Metrics) (pmetric.Metrics, error) {
-	// Create a worker pool
-	numWorkers := p.config.Processing.MaxParallelWorkers
-	if numWorkers <= 0 {
-		numWorkers = 8 // Default to 8 workers
-	}
-	pool := newWorkerPool(numWorkers)
-	defer pool.close()
+	var batch sync.WaitGroup
 
-	// Process each resource metric
-	rms := md.ResourceMetrics()
-	for i := 0; i < rms.Len(); i++ {
-		rm := rms.At(i)
-		sms := rm.ScopeMetrics()
-		
-		for j := 0; j < sms.Len(); j++ {
-			sm := sms.At(j)
-			
-			// Process metrics in parallel
-			processMetricsInParallel(ctx, pool, sm.Metrics(), rm.Resource(), p.processMetric)
+	// With ordered completion the workers only run the models, and the
+	// hooks run in batch order once all items are enriched
+	ordered := p.config().Processing.OrderedCompletion
+	process := p.processMetric
+	if ordered {
+		process = func(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource) {
+			p.enrichMetric(itemContext(ctx, p.state, p.residency, resource), metric, resource)
 		}
 	}
 
+	// Process the metrics of each scope in parallel on the shard of its resource
+	if err := processMetricsInParallel(ctx, p.pool, &batch, md, process); err != nil {
+		batch.Wait()
+		return md, err
+	}
+
 	// Wait for all metrics to be processed
-	pool.wait()
+	batch.Wait()
+	if ordered {
+		p.runHooksInOrder(ctx, md)
+	}
 
 	return md, nil
 }
 
+// processMetric enriches a metric and runs the hooks on it
 func (p *fullMetricsProcessor) processMetric(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource) {
+	ctx = itemContext(ctx, p.state, p.residency, resource)
+	p.enrichMetric(ctx, metric, resource)
+
+	// Run custom enrichment hooks after the models
+	p.hooks.onMetric(ctx, p.logger, metric, resource)
+}
+
+// enrichMetric evaluates the rules and invokes the models for a metric, ctx
+// being its item context
+func (p *fullMetricsProcessor) enrichMetric(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource) {
+	// Evaluate rules and the hints of the data points before invoking the
+	// models, the first data point with a hint deciding for the metric
+	var rules expression.Result
+	hints := &p.config().Hints
+	if p.rules != nil || hints.Enabled {
+		if p.rules != nil {
+			rules = evaluateRules(p.logger, p.rules, metricRuleInput(metric, resource))
+		}
+		for _, attributes := range dataPointAttributes(metric) {
+			applyRuleAttributes(&rules, attributes)
+			if hints.Enabled {
+				applyHints(hints, attributes, &rules)
+			}
+		}
+		ruleDecisionsFrom(ctx).set(metric, &rules)
+		
+		// The models only extract entities from metrics
+		if rules.Skips(runtime.ModelEntityExtractor) {
+			return
+		}
+	}
+	
+	// Without entity extraction there is no model input to build, and
+	// batches passed through or past their timeout skip the models
+	if !itemConfig(ctx, p.config()).Features.EntityExtraction || modelsSkipped(ctx) {
+		return
+	}
+	
 	// Extract information for classification and enrichment
-	metricInfo := map[string]interface{}{
-		"name":        metric.Name(),
-		"description": metric.Description(),
-		"unit":        metric.Unit(),
-		"resource":    attributesToMap(resource.Attributes()),
+	metricInfo := &runtime.EntityInput{
+		Name:        metric.Name(),
+		Description: metric.Description(),
+		Unit:        metric.Unit(),
+		Resource:    resourceToMap(resource),
 	}
 
 	// Add attributes based on metric type
@@ -136,7 +259,27 @@ func (p *fullMetricsProcessor) processMetric(ctx context.Context, metric pmetric
 	}
 }
 
-func (p *fullMetricsProcessor) processGauge(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo map[string]interface{}) {
+// runHooksInOrder runs the enrichment hooks on the metrics of md in order
+func (p *fullMetricsProcessor) runHooksInOrder(ctx context.Context, md pmetric.Metrics) {
+	if len(p.hooks) == 0 {
+		return
+	}
+
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		itemCtx := itemContext(ctx, p.state, p.residency, rm.Resource())
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			metrics := sms.At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				p.hooks.onMetric(itemCtx, p.logger, metrics.At(k), rm.Resource())
+			}
+		}
+	}
+}
+
+func (p *fullMetricsProcessor) processGauge(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo *runtime.EntityInput) {
 	gauge := metric.Gauge()
 	dataPoints := gauge.DataPoints()
 	
@@ -146,13 +289,14 @@ func (p *fullMetricsProcessor) processGauge(ctx context.Context, metric pmetric.
 	}
 }
 
-func (p *fullMetricsProcessor) processSum(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo map[string]interface{}) {
+func (p *fullMetricsProcessor) processSum(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo *runtime.EntityInput) {
 	sum := metric.Sum()
 	dataPoints := sum.DataPoints()
 	
 	// Add sum-specific metadata
-	metricInfo["is_monotonic"] = sum.IsMonotonic()
-	metricInfo["aggregation_temporality"] = sum.AggregationTemporality().String()
+	isMonotonic := sum.IsMonotonic()
+	metricInfo.IsMonotonic = &isMonotonic
+	metricInfo.AggregationTemporality = sum.AggregationTemporality().String()
 	
 	for i := 0; i < dataPoints.Len(); i++ {
 		dp := dataPoints.At(i)
@@ -160,21 +304,26 @@ func (p *fullMetricsProcessor) processSum(ctx context.Context, metric pmetric.Me
 	}
 }
 
-func (p *fullMetricsProcessor) processHistogram(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo map[string]interface{}) {
+func (p *fullMetricsProcessor) processHistogram(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo *runtime.EntityInput) {
 	histogram := metric.Histogram()
 	dataPoints := histogram.DataPoints()
 	
-	metricInfo["aggregation_temporality"] = histogram.AggregationTemporality().String()
+	metricInfo.AggregationTemporality = histogram.AggregationTemporality().String()
 	
+	// Histogram data points are passed to the models by a quantile of their buckets
+	quantile := p.config().AnomalyDetection.HistogramQuantile
 	for i := 0; i < dataPoints.Len(); i++ {
-		// Just log basic information since we don't process histogram data points specifically
-		p.logger.Debug("Processing histogram data point", 
-			zap.String("metric", metric.Name()),
-			zap.Int("buckets", dataPoints.At(i).BucketCounts().Len()))
+		dp := dataPoints.At(i)
+		pointInfo := *metricInfo
+		pointInfo.Attributes = attributesToMap(dp.Attributes())
+		if value, ok := histogramQuantile(dp, quantile); ok {
+			pointInfo.Value = value
+		}
+		p.extractEntities(ctx, dp.Attributes(), &pointInfo)
 	}
 }
 
-func (p *fullMetricsProcessor) processSummary(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo map[string]interface{}) {
+func (p *fullMetricsProcessor) processSummary(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo *runtime.EntityInput) {
 	summary := metric.Summary()
 	dataPoints := summary.DataPoints()
 	
@@ -189,48 +338,48 @@ func (p *fullMetricsProcessor) processSummary(ctx context.Context, metric pmetri
 	}
 }
 
-func (p *fullMetricsProcessor) processExponentialHistogram(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo map[string]interface{}) {
+func (p *fullMetricsProcessor) processExponentialHistogram(ctx context.Context, metric pmetric.Metric, resource pcommon.Resource, metricInfo *runtime.EntityInput) {
 	histogram := metric.ExponentialHistogram()
 	dataPoints := histogram.DataPoints()
 	
-	metricInfo["aggregation_temporality"] = histogram.AggregationTemporality().String()
+	metricInfo.AggregationTemporality = histogram.AggregationTemporality().String()
 	
+	quantile := p.config().AnomalyDetection.HistogramQuantile
 	for i := 0; i < dataPoints.Len(); i++ {
-		// Just log basic information since we don't process exponential histogram data points specifically
 		dp := dataPoints.At(i)
-		p.logger.Debug("Processing exponential histogram data point", 
-			zap.String("metric", metric.Name()),
-			zap.Uint64("count", dp.Count()),
-			zap.Int("positive buckets", dp.Positive().BucketCounts().Len()),
-			zap.Int("negative buckets", dp.Negative().BucketCounts().Len()))
+		pointInfo := *metricInfo
+		pointInfo.Attributes = attributesToMap(dp.Attributes())
+		if value, ok := exponentialHistogramQuantile(dp, quantile); ok {
+			pointInfo.Value = value
+		}
+		p.extractEntities(ctx, dp.Attributes(), &pointInfo)
 	}
 }
 
-func (p *fullMetricsProcessor) processDataPoint(ctx context.Context, metric pmetric.Metric, dp pmetric.NumberDataPoint, resource pcommon.Resource, metricInfo map[string]interface{}) {
-	// Add data point attributes to metric info
-	pointInfo := make(map[string]interface{})
-	for k, v := range metricInfo {
-		pointInfo[k] = v
-	}
+func (p *fullMetricsProcessor) processDataPoint(ctx context.Context, metric pmetric.Metric, dp pmetric.NumberDataPoint, resource pcommon.Resource, metricInfo *runtime.EntityInput) {
+	// Copy the metric info for the data point
+	pointInfo := *metricInfo
 	
 	// Add data point attributes
-	pointInfo["attributes"] = attributesToMap(dp.Attributes())
+	pointInfo.Attributes = attributesToMap(dp.Attributes())
 	
 	// Add value based on data type
 	switch dp.ValueType() {
 	case pmetric.NumberDataPointValueTypeInt:
-		pointInfo["value"] = dp.IntValue()
+		pointInfo.Value = dp.IntValue()
 	case pmetric.NumberDataPointValueTypeDouble:
-		pointInfo["value"] = dp.DoubleValue()
+		pointInfo.Value = dp.DoubleValue()
 	}
 	
 	// Extract entities if enabled
-	if p.config.Features.EntityExtraction {
-		p.extractEntities(ctx, metric, dp, pointInfo)
+	if itemConfig(ctx, p.config()).Features.EntityExtraction {
+		p.extractEntities(ctx, dp.Attributes(), &pointInfo)
 	}
 }
 
-func (p *fullMetricsProcessor) extractEntities(ctx context.Context, metric pmetric.Metric, dp pmetric.NumberDataPoint, metricInfo map[string]interface{}) {
+// extractEntities invokes the entity extractor for a data point and sets
+// the entities on its attributes
+func (p *fullMetricsProcessor) extractEntities(ctx context.Context, attributes pcommon.Map, metricInfo *runtime.EntityInput) {
 	// Call entity extractor model
 	result, err := p.wasmRuntime.ExtractEntities(ctx, metricInfo)
 	if err != nil {
@@ -239,15 +388,24 @@ func (p *fullMetricsProcessor) extractEntities(ctx context.Context, metric pmetr
 	}
 
 	// Add entity attributes to data point
-	for k, v := range result {
-		attrKey := p.config.Output.AttributeNamespace + k
-		setAttribute(dp.Attributes(), attrKey, v)
-	}
+	output := &itemConfig(ctx, p.config()).Output
+	setEntityAttributes(attributes, result, output)
+	truncateAttributes(attributes, output)
+	p.state.provenance.annotate(attributes, runtime.ModelEntityExtractor, output)
 }
 
-func (p *fullMetricsProcessor) shutdown(ctx context.Context) error {
-	if p.wasmRuntime != nil {
-		return p.wasmRuntime.Close()
+// start starts the processing workers, which are shared by all batches
+func (p *fullMetricsProcessor) start(ctx context.Context, host component.Host) error {
+	// The first processor to start loads the models shared by all of them
+	if err := p.state.start(); err != nil {
+		return err
 	}
+	p.wasmRuntime = p.state.runtime
+	p.pool = newProcessingPool(&p.config().Processing)
 	return nil
+}
+
+func (p *fullMetricsProcessor) shutdown(ctx context.Context) error {
+	p.pool.close()
+	return p.state.release()
 }
\ No newline at end of file
@@ -7,7 +7,9 @@ package processor
 
 import (
 	"context"
+	"fmt"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.uber.org/zap"
@@ -20,41 +22,85 @@ type stubMetricsProcessor struct {
 	config       *Config
 	nextConsumer consumer.Metrics
 	wasmRuntime  *runtime.WasmRuntime
+	hooks        enrichmentHooks
+	residency    *residencyPolicy
+	privacy      *privacyFilter
+	anomalies    *anomalyDetector
+	state        *controlState
 }
 
 func newMetricsProcessor(
-	logger *zap.Logger,
+	set component.TelemetrySettings,
 	config *Config,
 	nextConsumer consumer.Metrics,
+	hooks enrichmentHooks,
 ) (metricsProcessor, error) {
-	// Initialize WASM runtime
-	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
-		ErrorClassifierPath:   config.Models.ErrorClassifier.Path,
-		ErrorClassifierMemory: config.Models.ErrorClassifier.MemoryLimitMB,
-		SamplerPath:           config.Models.ImportanceSampler.Path,
-		SamplerMemory:         config.Models.ImportanceSampler.MemoryLimitMB,
-		EntityExtractorPath:   config.Models.EntityExtractor.Path,
-		EntityExtractorMemory: config.Models.EntityExtractor.MemoryLimitMB,
-	})
+	logger := set.Logger
+
+	// Share the live configuration with the other processors, and the control
+	// plane and models once started
+	state := referenceControlState(set, config)
+
+	// Label data residency and restrict model backends accordingly
+	residency, err := newResidencyPolicy(&config.Residency, config.Output.AttributeNamespace)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid residency configuration: %w", err)
+	}
+
+	// Protect aggregate metrics shared across tenants
+	privacy, err := newPrivacyFilter(&config.Privacy)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid privacy configuration: %w", err)
+	}
+
+	// Track the baselines of metric series to annotate anomalies
+	anomalies, err := newAnomalyDetector(&config.AnomalyDetection)
 	if err != nil {
-		return nil, err
+		state.release()
+		return nil, fmt.Errorf("invalid anomaly detection configuration: %w", err)
 	}
 
 	return &stubMetricsProcessor{
 		logger:       logger,
 		config:       config,
 		nextConsumer: nextConsumer,
-		wasmRuntime:  wasmRuntime,
+		hooks:        hooks,
+		state:        state,
+		residency:    residency,
+		privacy:      privacy,
+		anomalies:    anomalies,
 	}, nil
 }
 
 func (p *stubMetricsProcessor) processMetrics(ctx context.Context, md pmetric.Metrics) (pmetric.Metrics, error) {
+	// Label data residency, which applies without models too
+	p.residency.tagMetrics(md)
+
+	// Score data points against their baselines, which models don't need
+	if p.state.current().Features.AnomalyDetection {
+		p.anomalies.annotate(md, p.state.current().Output.AttributeNamespace)
+	}
+
 	// Stub implementation just passes metrics through
 	p.logger.Debug("Stub metrics processor called", 
 		zap.Int("metric_count", md.MetricCount()))
+	received := md.MetricCount()
+	p.privacy.apply(md)
+	p.state.recordBatch(signalMetrics, received, md.MetricCount())
 	return md, nil
 }
 
+func (p *stubMetricsProcessor) start(ctx context.Context, host component.Host) error {
+	// The first processor to start loads the models shared by all of them
+	if err := p.state.start(); err != nil {
+		return err
+	}
+	p.wasmRuntime = p.state.runtime
+	return nil
+}
+
 func (p *stubMetricsProcessor) shutdown(ctx context.Context) error {
-	return p.wasmRuntime.Close()
+	return p.state.release()
 }
\ No newline at end of file
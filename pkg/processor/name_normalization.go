@@ -0,0 +1,62 @@
+// This file contains the normalization of span names and HTTP routes,
+// which replaces the identifiers embedded in them by a placeholder so
+// backends don't index a name per user or order
+
+package processor
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/spanname"
+)
+
+// Attributes holding the original names of spans whose name or route was
+// normalized, under the output namespace
+const (
+	originalNameAttribute  = "original_name"
+	originalRouteAttribute = "original_route"
+)
+
+// httpRouteAttribute is the semantic convention attribute of the route of
+// HTTP server spans, which instrumentations sometimes fill with the path
+const httpRouteAttribute = "http.route"
+
+// normalizeSpanNames normalizes the names and HTTP routes of the spans of
+// the resources with features.name_normalization enabled
+func normalizeSpanNames(td ptrace.Traces, state *controlState) {
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		config := state.resourceConfig(rss.At(i).Resource())
+		if !config.Features.NameNormalization {
+			continue
+		}
+		namespace := config.Output.AttributeNamespace
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				normalizeSpanName(spans.At(k), namespace)
+			}
+		}
+	}
+}
+
+// normalizeSpanName normalizes the name and HTTP route of a span, keeping
+// the originals under namespace
+func normalizeSpanName(span ptrace.Span, namespace string) {
+	if name := spanname.Normalize(span.Name()); name != span.Name() {
+		span.Attributes().PutStr(namespace+originalNameAttribute, span.Name())
+		span.SetName(name)
+	}
+	route, ok := span.Attributes().Get(httpRouteAttribute)
+	if !ok || route.Type() != pcommon.ValueTypeStr {
+		return
+	}
+	original := route.Str()
+	if normalized := spanname.Normalize(original); normalized != original {
+		// Putting an attribute may move the route's value, so it goes last
+		route.SetStr(normalized)
+		span.Attributes().PutStr(namespace+originalRouteAttribute, original)
+	}
+}
@@ -0,0 +1,29 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestNormalizeSpanName(t *testing.T) {
+	span := ptrace.NewSpan()
+	span.SetName("GET /users/42")
+	span.Attributes().PutStr("http.route", "/users/42")
+	normalizeSpanName(span, "ai.")
+
+	assert.Equal(t, "GET /users/{id}", span.Name())
+	assert.Equal(t, map[string]interface{}{
+		"http.route":        "/users/{id}",
+		"ai.original_name":  "GET /users/42",
+		"ai.original_route": "/users/42",
+	}, span.Attributes().AsRaw())
+
+	// Names without identifiers are left alone
+	span = ptrace.NewSpan()
+	span.SetName("GET /users/{id}")
+	normalizeSpanName(span, "ai.")
+	assert.Equal(t, "GET /users/{id}", span.Name())
+	assert.Equal(t, 0, span.Attributes().Len())
+}
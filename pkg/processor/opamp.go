@@ -0,0 +1,439 @@
+//go:build opamp
+// +build opamp
+
+// This file contains the OpAMP client that reports processor health,
+// effective configuration and model versions to an OpAMP server, applies
+// the remote configurations it pushes and installs model packages offered
+// by it
+
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-telemetry/opamp-go/client"
+	"github.com/open-telemetry/opamp-go/client/types"
+	"github.com/open-telemetry/opamp-go/protobufs"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// opampAgent connects the control state to an OpAMP server
+type opampAgent struct {
+	logger  *zap.Logger
+	state   *controlState
+	client  client.OpAMPClient
+	started time.Time
+
+	packages *opampPackages
+
+	// Hash of the last remote configuration applied
+	remoteConfigHash []byte
+}
+
+// startOpAMP connects to the OpAMP server and starts reporting
+func startOpAMP(logger *zap.Logger, config *OpAMPConfig, state *controlState) (stopper, error) {
+	instanceUID, err := opampInstanceUID(config.InstanceUID)
+	if err != nil {
+		return nil, err
+	}
+
+	packagesDir := config.PackagesDir
+	if packagesDir == "" {
+		packagesDir = filepath.Join(os.TempDir(), "otel-ai-processor", "packages")
+	}
+	if err := os.MkdirAll(packagesDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create packages directory: %w", err)
+	}
+
+	agent := &opampAgent{
+		logger:  logger,
+		state:   state,
+		started: time.Now(),
+	}
+	agent.packages = newOpAMPPackages(packagesDir, agent.installModel)
+
+	if strings.HasPrefix(config.Endpoint, "http") {
+		agent.client = client.NewHTTP(&opampLogger{logger: logger})
+	} else {
+		agent.client = client.NewWebSocket(&opampLogger{logger: logger})
+	}
+
+	if err := agent.client.SetAgentDescription(agent.description()); err != nil {
+		return nil, err
+	}
+	if err := agent.client.SetHealth(agent.health(true, "")); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	for k, v := range config.Headers {
+		header.Set(k, string(v))
+	}
+
+	settings := types.StartSettings{
+		OpAMPServerURL: config.Endpoint,
+		Header:         header,
+		InstanceUid:    instanceUID,
+		Callbacks: types.Callbacks{
+			OnConnect: func(ctx context.Context) {
+				logger.Info("Connected to OpAMP server", zap.String("endpoint", config.Endpoint))
+			},
+			OnConnectFailed: func(ctx context.Context, err error) {
+				logger.Warn("Failed to connect to OpAMP server", zap.Error(err))
+			},
+			OnError: func(ctx context.Context, err *protobufs.ServerErrorResponse) {
+				logger.Warn("OpAMP server returned an error", zap.String("message", err.GetErrorMessage()))
+			},
+			OnMessage:          agent.onMessage,
+			GetEffectiveConfig: agent.effectiveConfig,
+		},
+		PackagesStateProvider: agent.packages,
+		Capabilities: protobufs.AgentCapabilities_AgentCapabilities_ReportsStatus |
+			protobufs.AgentCapabilities_AgentCapabilities_ReportsEffectiveConfig |
+			protobufs.AgentCapabilities_AgentCapabilities_ReportsHealth |
+			protobufs.AgentCapabilities_AgentCapabilities_AcceptsRemoteConfig |
+			protobufs.AgentCapabilities_AgentCapabilities_ReportsRemoteConfig |
+			protobufs.AgentCapabilities_AgentCapabilities_AcceptsPackages |
+			protobufs.AgentCapabilities_AgentCapabilities_ReportsPackageStatuses,
+	}
+
+	if err := agent.client.Start(context.Background(), settings); err != nil {
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+// Stop disconnects from the OpAMP server
+func (a *opampAgent) Stop(ctx context.Context) error {
+	return a.client.Stop(ctx)
+}
+
+// onMessage handles messages from the server. Remote configurations are
+// applied to the live configuration, and package offers are synced through
+// the packages state provider.
+func (a *opampAgent) onMessage(ctx context.Context, msg *types.MessageData) {
+	if msg.RemoteConfig != nil {
+		a.applyRemoteConfig(ctx, msg.RemoteConfig)
+	}
+	if msg.PackageSyncer == nil {
+		return
+	}
+
+	if err := msg.PackageSyncer.Sync(ctx); err != nil {
+		a.logger.Warn("Failed to sync OpAMP packages", zap.Error(err))
+		return
+	}
+
+	go func() {
+		<-msg.PackageSyncer.Done()
+		// Model paths changed, report the new versions
+		if err := a.client.SetAgentDescription(a.description()); err != nil {
+			a.logger.Debug("Failed to update OpAMP agent description", zap.Error(err))
+		}
+	}()
+}
+
+// applyRemoteConfig applies a remote configuration and reports its status,
+// along with the new effective configuration and model versions. The
+// processor's configuration is the file named ai_processor, or the unnamed
+// one, of the configuration map. Configurations already applied are not
+// applied again when the server sends them anew.
+func (a *opampAgent) applyRemoteConfig(ctx context.Context, offered *protobufs.AgentRemoteConfig) {
+	hash := offered.GetConfigHash()
+	if a.remoteConfigHash != nil && bytes.Equal(hash, a.remoteConfigHash) {
+		return
+	}
+
+	status := &protobufs.RemoteConfigStatus{
+		LastRemoteConfigHash: hash,
+		Status:               protobufs.RemoteConfigStatuses_RemoteConfigStatuses_APPLIED,
+	}
+	err := a.applyRemoteConfigFile(ctx, offered.GetConfig().GetConfigMap())
+	if err != nil {
+		a.logger.Warn("Failed to apply OpAMP remote configuration", zap.Error(err))
+		status.Status = protobufs.RemoteConfigStatuses_RemoteConfigStatuses_FAILED
+		status.ErrorMessage = err.Error()
+	} else {
+		a.remoteConfigHash = hash
+	}
+
+	if err := a.client.SetRemoteConfigStatus(status); err != nil {
+		a.logger.Debug("Failed to report OpAMP remote configuration status", zap.Error(err))
+	}
+	if err := a.client.UpdateEffectiveConfig(ctx); err != nil {
+		a.logger.Debug("Failed to report OpAMP effective configuration", zap.Error(err))
+	}
+	if err := a.client.SetAgentDescription(a.description()); err != nil {
+		a.logger.Debug("Failed to update OpAMP agent description", zap.Error(err))
+	}
+}
+
+// applyRemoteConfigFile applies the processor's file of a remote
+// configuration map, if it has one
+func (a *opampAgent) applyRemoteConfigFile(ctx context.Context, files map[string]*protobufs.AgentConfigFile) error {
+	file, ok := files[typeStr]
+	if !ok {
+		file, ok = files[""]
+	}
+	if !ok {
+		return nil
+	}
+	config, err := parseRemoteConfig(file.GetBody())
+	if err != nil {
+		return err
+	}
+	return a.state.applyRemoteConfig(ctx, config)
+}
+
+// installModel reloads a model from a package written by the packages provider
+func (a *opampAgent) installModel(model string, path string) error {
+	err := a.state.ReloadModel(context.Background(), model, path)
+	if err != nil {
+		a.client.SetHealth(a.health(false, fmt.Sprintf("failed to install model %s: %v", model, err)))
+		return err
+	}
+	return a.client.SetHealth(a.health(true, ""))
+}
+
+// effectiveConfig returns the live configuration as JSON
+func (a *opampAgent) effectiveConfig(ctx context.Context) (*protobufs.EffectiveConfig, error) {
+	body, err := effectiveConfigJSON(a.state.current())
+	if err != nil {
+		return nil, err
+	}
+
+	return &protobufs.EffectiveConfig{
+		ConfigMap: &protobufs.AgentConfigMap{
+			ConfigMap: map[string]*protobufs.AgentConfigFile{
+				typeStr: {Body: body, ContentType: "application/json"},
+			},
+		},
+	}, nil
+}
+
+// description identifies the processor and reports the model versions
+func (a *opampAgent) description() *protobufs.AgentDescription {
+	hostname, _ := os.Hostname()
+
+	description := &protobufs.AgentDescription{
+		IdentifyingAttributes: []*protobufs.KeyValue{
+			opampString("service.name", "otel-ai-processor"),
+			opampString("host.name", hostname),
+		},
+	}
+
+	for model, version := range modelVersions(a.state.current(), a.state.provenance) {
+		for key, value := range version.(map[string]interface{}) {
+			description.NonIdentifyingAttributes = append(description.NonIdentifyingAttributes,
+				opampString("ai.model."+model+"."+key, fmt.Sprint(value)))
+		}
+	}
+
+	return description
+}
+
+// health returns the processor health for the server
+func (a *opampAgent) health(healthy bool, lastError string) *protobufs.ComponentHealth {
+	status := "running"
+	if !healthy {
+		status = "degraded"
+	}
+	return &protobufs.ComponentHealth{
+		Healthy:           healthy,
+		StartTimeUnixNano: uint64(a.started.UnixNano()),
+		Status:            status,
+		LastError:         lastError,
+	}
+}
+
+// opampInstanceUID parses the configured instance UID or generates one
+func opampInstanceUID(configured string) (types.InstanceUid, error) {
+	if configured == "" {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return types.InstanceUid{}, err
+		}
+		return types.InstanceUid(id), nil
+	}
+
+	id, err := uuid.Parse(configured)
+	if err != nil {
+		return types.InstanceUid{}, fmt.Errorf("invalid OpAMP instance_uid: %w", err)
+	}
+	return types.InstanceUid(id), nil
+}
+
+func opampString(key, value string) *protobufs.KeyValue {
+	return &protobufs.KeyValue{
+		Key:   key,
+		Value: &protobufs.AnyValue{Value: &protobufs.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// opampLogger adapts zap to the OpAMP client logger
+type opampLogger struct {
+	logger *zap.Logger
+}
+
+func (l *opampLogger) Debugf(ctx context.Context, format string, v ...interface{}) {
+	l.logger.Debug(fmt.Sprintf(format, v...))
+}
+
+func (l *opampLogger) Errorf(ctx context.Context, format string, v ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, v...))
+}
+
+// opampPackages implements types.PackagesStateProvider. Packages are named
+// after the model they contain (error_classifier, sampler, entity_extractor)
+// and stored as files in a directory; installing one reloads the model.
+type opampPackages struct {
+	dir     string
+	install func(model string, path string) error
+
+	mutex    sync.Mutex
+	allHash  []byte
+	states   map[string]types.PackageState
+	statuses *protobufs.PackageStatuses
+}
+
+func newOpAMPPackages(dir string, install func(model string, path string) error) *opampPackages {
+	return &opampPackages{
+		dir:     dir,
+		install: install,
+		states:  make(map[string]types.PackageState),
+	}
+}
+
+func (p *opampPackages) AllPackagesHash() ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.allHash, nil
+}
+
+func (p *opampPackages) SetAllPackagesHash(hash []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.allHash = hash
+	return nil
+}
+
+func (p *opampPackages) Packages() ([]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	names := make([]string, 0, len(p.states))
+	for name := range p.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (p *opampPackages) PackageState(packageName string) (types.PackageState, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.states[packageName], nil
+}
+
+func (p *opampPackages) SetPackageState(packageName string, state types.PackageState) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.states[packageName] = state
+	return nil
+}
+
+func (p *opampPackages) CreatePackage(packageName string, typ protobufs.PackageType) error {
+	switch packageName {
+	case runtime.ModelErrorClassifier, runtime.ModelSampler, runtime.ModelEntityExtractor:
+	default:
+		return fmt.Errorf("unsupported package %q", packageName)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.states[packageName] = types.PackageState{Exists: true, Type: typ}
+	return nil
+}
+
+func (p *opampPackages) FileContentHash(packageName string) ([]byte, error) {
+	digest, err := runtime.FileSHA256(p.path(packageName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(digest)
+}
+
+// UpdateContent stores a downloaded model, verifies its hash and reloads it
+func (p *opampPackages) UpdateContent(ctx context.Context, packageName string, data io.Reader, contentHash, signature []byte) error {
+	tmp, err := os.CreateTemp(p.dir, ".package-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if len(contentHash) > 0 && string(hash.Sum(nil)) != string(contentHash) {
+		return fmt.Errorf("content hash mismatch for package %s", packageName)
+	}
+
+	// Runtimes keep the previous module loaded if the new one fails to load
+	path := p.path(packageName)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return p.install(packageName, path)
+}
+
+func (p *opampPackages) DeletePackage(packageName string) error {
+	p.mutex.Lock()
+	delete(p.states, packageName)
+	p.mutex.Unlock()
+
+	// The model stays loaded until another version is installed
+	return nil
+}
+
+func (p *opampPackages) LastReportedStatuses() (*protobufs.PackageStatuses, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.statuses, nil
+}
+
+func (p *opampPackages) SetLastReportedStatuses(statuses *protobufs.PackageStatuses) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.statuses = statuses
+	return nil
+}
+
+// path returns the file a package is stored in
+func (p *opampPackages) path(packageName string) string {
+	return filepath.Join(p.dir, packageName+".wasm")
+}
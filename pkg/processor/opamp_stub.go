@@ -0,0 +1,18 @@
+//go:build !opamp
+// +build !opamp
+
+// This file contains the OpAMP client used when the processor is built
+// without OpAMP support
+
+package processor
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// startOpAMP fails because OpAMP support is not compiled in
+func startOpAMP(logger *zap.Logger, config *OpAMPConfig, state *controlState) (stopper, error) {
+	return nil, errors.New("the processor was built without OpAMP support, rebuild with -tags opamp")
+}
@@ -0,0 +1,67 @@
+// This file contains the mapping of classified errors to the teams owning
+// them, through the team registry
+
+package processor
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/ownership"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Attributes written for the team owning a classified error, under the
+// output namespace
+const (
+	ownerTeamAttribute      = "owner.team"
+	ownerSlackAttribute     = "owner.slack"
+	ownerPagerDutyAttribute = "owner.pagerduty"
+)
+
+// openOwnership reads the team registry of config and starts refreshing
+// it. It returns nil if no registry is configured.
+func openOwnership(logger *zap.Logger, config *OwnershipConfig) (*ownership.Source, error) {
+	if config.Path == "" && config.Endpoint == "" {
+		return nil, nil
+	}
+	source, err := ownership.Open(logger, ownership.Config{
+		Path:            config.Path,
+		Endpoint:        config.Endpoint,
+		Headers:         headerValues(config.Headers),
+		Timeout:         time.Duration(config.TimeoutMs) * time.Millisecond,
+		RefreshInterval: time.Duration(config.RefreshIntervalMs) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Loaded team registry", zap.Int("teams", source.Registry().Teams()))
+	return source, nil
+}
+
+// setOwnerAttributes sets the team owning a classified error, found from
+// the owner and category the error classifier gave it or the service of the
+// input, on its attributes. Errors no team owns are left as they are.
+func setOwnerAttributes(attributes pcommon.Map, source *ownership.Source, result map[string]interface{},
+	input *runtime.ErrorInput, namespace string) {
+	if source == nil {
+		return
+	}
+	owner, _ := result["owner"].(string)
+	category, _ := result["category"].(string)
+	service, _ := input.Resource["service.name"].(string)
+	team, ok := source.Registry().Resolve(owner, category, service)
+	if !ok {
+		return
+	}
+
+	attributes.PutStr(namespace+ownerTeamAttribute, team.Name)
+	if team.Slack != "" {
+		attributes.PutStr(namespace+ownerSlackAttribute, team.Slack)
+	}
+	if team.PagerDuty != "" {
+		attributes.PutStr(namespace+ownerPagerDutyAttribute, team.PagerDuty)
+	}
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestOwnerAttributesFromTeamRegistry(t *testing.T) {
+	source, err := openOwnership(zap.NewNop(), &OwnershipConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, source, "no registry is opened unless configured")
+
+	path := filepath.Join(t.TempDir(), "teams.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+teams:
+  data-platform: {name: Data Platform, slack: "#data-platform", pagerduty: PDATA01}
+  payments: {slack: "#payments"}
+owners:
+  database-team: data-platform
+services:
+  billing-*: payments
+`), 0o600))
+	source, err = openOwnership(zap.NewNop(), &OwnershipConfig{Path: path})
+	require.NoError(t, err)
+	defer source.Close()
+
+	input := &runtime.ErrorInput{Resource: map[string]interface{}{"service.name": "billing-api"}}
+	attributes := pcommon.NewMap()
+	setOwnerAttributes(attributes, source, map[string]interface{}{"owner": "database-team"}, input, "ai.")
+	assert.Equal(t, map[string]interface{}{
+		"ai.owner.team":      "Data Platform",
+		"ai.owner.slack":     "#data-platform",
+		"ai.owner.pagerduty": "PDATA01",
+	}, attributes.AsRaw())
+
+	// Owners outside the registry fall back to the service
+	attributes = pcommon.NewMap()
+	setOwnerAttributes(attributes, source, map[string]interface{}{"owner": "unknown"}, input, "ai.")
+	assert.Equal(t, map[string]interface{}{"ai.owner.team": "payments", "ai.owner.slack": "#payments"}, attributes.AsRaw())
+
+	attributes = pcommon.NewMap()
+	setOwnerAttributes(attributes, source, nil, &runtime.ErrorInput{}, "ai.")
+	setOwnerAttributes(attributes, nil, map[string]interface{}{"owner": "database-team"}, input, "ai.")
+	assert.Equal(t, 0, attributes.Len())
+}
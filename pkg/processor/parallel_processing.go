@@ -10,119 +10,237 @@ import (
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/common"
 )
 
-// Worker pool for parallel processing of telemetry items
-type workerPool struct {
-	numWorkers int
-	taskChan   chan task
-	wg         sync.WaitGroup
+// shardedPool processes telemetry on long-lived worker shards. The items of
+// a scope are processed by one task, on the shard given by the hash of their
+// resource, so a shard keeps seeing the same resources and processes the
+// items of a resource in order. Each shard has its own bounded queue, so a
+// busy resource only holds back submissions to its shard.
+type shardedPool struct {
+	shards []chan task
+	wg     sync.WaitGroup
 }
 
-// Task to be executed by a worker
+// Task to be executed by a shard. The tasks of a resource share run and only
+// differ in the index of their scope, so scopes are never captured by
+// per-scope closures.
 type task struct {
-	ctx      context.Context
-	fn       func(context.Context)
-	callback func()
+	ctx   context.Context
+	run   func(ctx context.Context, index int)
+	index int
+	batch *sync.WaitGroup
 }
 
-// Create a new worker pool
-func newWorkerPool(numWorkers int) *workerPool {
-	pool := &workerPool{
-		numWorkers: numWorkers,
-		taskChan:   make(chan task, numWorkers*10), // Buffer tasks to avoid blocking
+// newProcessingPool returns the worker shards for config, or nil if parallel
+// processing is disabled
+func newProcessingPool(config *ProcessingConfig) *shardedPool {
+	if !config.EnableParallelProcessing {
+		return nil
+	}
+
+	numShards := config.MaxParallelWorkers
+	if numShards <= 0 {
+		numShards = 8 // Default to 8 workers
 	}
 
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
-		go pool.worker()
+	// The queue size bounds the scopes pending across all shards
+	queueSize := config.QueueSize / numShards
+	if queueSize < 1 {
+		queueSize = 1
 	}
 
+	return newShardedPool(numShards, queueSize)
+}
+
+// newShardedPool starts numShards shards with queues of queueSize tasks
+func newShardedPool(numShards int, queueSize int) *shardedPool {
+	pool := &shardedPool{shards: make([]chan task, numShards)}
+	for i := range pool.shards {
+		pool.shards[i] = make(chan task, queueSize)
+		pool.wg.Add(1)
+		go pool.run(pool.shards[i])
+	}
 	return pool
 }
 
-// Worker goroutine that processes tasks
-func (p *workerPool) worker() {
-	for task := range p.taskChan {
-		// Execute the task
-		task.fn(task.ctx)
-		
-		// Execute callback if provided
-		if task.callback != nil {
-			task.callback()
-		}
-		
-		// Mark task as done
-		p.wg.Done()
+// run processes the tasks of a shard in submission order
+func (p *shardedPool) run(queue chan task) {
+	defer p.wg.Done()
+	for task := range queue {
+		task.run(task.ctx, task.index)
+		task.batch.Done()
 	}
 }
 
-// Submit a task to the worker pool
-func (p *workerPool) submit(ctx context.Context, fn func(context.Context), callback func()) {
-	p.wg.Add(1)
-	p.taskChan <- task{ctx, fn, callback}
+// shard returns the shard of a resource
+func (p *shardedPool) shard(resource pcommon.Resource) int {
+	return int(common.CalculateResourceHash(resource) % uint64(len(p.shards)))
 }
 
-// Wait for all tasks to complete
-func (p *workerPool) wait() {
-	p.wg.Wait()
+// submit queues run for index on a shard and adds it to batch. It blocks
+// while the shard's queue is full and fails if ctx is done first.
+func (p *shardedPool) submit(ctx context.Context, shard int, batch *sync.WaitGroup, run func(context.Context, int), index int) error {
+	batch.Add(1)
+	select {
+	case p.shards[shard] <- task{ctx: ctx, run: run, index: index, batch: batch}:
+		return nil
+	case <-ctx.Done():
+		batch.Done()
+		return ctx.Err()
+	}
+}
+
+// trySubmit queues run for index on a shard and adds it to batch if the
+// shard's queue has room
+func (p *shardedPool) trySubmit(ctx context.Context, shard int, batch *sync.WaitGroup, run func(context.Context, int), index int) bool {
+	batch.Add(1)
+	select {
+	case p.shards[shard] <- task{ctx: ctx, run: run, index: index, batch: batch}:
+		return true
+	default:
+		batch.Done()
+		return false
+	}
+}
+
+// scopeGroup is the items of one scope, processed by a single task on the
+// shard of their resource
+type scopeGroup struct {
+	shard int
+	run   func(ctx context.Context, index int)
+	index int
+}
+
+// submitGroups queues the scope groups of a batch. Groups whose shard is
+// full are passed over for the groups of other shards, so a busy resource
+// doesn't leave the other workers idle, but the groups of a shard are
+// queued in order. It only blocks when every remaining group's shard is
+// full.
+func (p *shardedPool) submitGroups(ctx context.Context, batch *sync.WaitGroup, groups []scopeGroup) error {
+	full := make([]bool, len(p.shards))
+	for len(groups) > 0 {
+		for i := range full {
+			full[i] = false
+		}
+
+		pending := groups[:0]
+		for _, group := range groups {
+			if full[group.shard] || !p.trySubmit(ctx, group.shard, batch, group.run, group.index) {
+				full[group.shard] = true
+				pending = append(pending, group)
+			}
+		}
+
+		// Wait for room for the first group if no shard could take any
+		if len(pending) == len(groups) {
+			group := pending[0]
+			if err := p.submit(ctx, group.shard, batch, group.run, group.index); err != nil {
+				return err
+			}
+			pending = pending[1:]
+		}
+		groups = pending
+	}
+	return nil
 }
 
-// Close the worker pool
-func (p *workerPool) close() {
-	close(p.taskChan)
+// close stops the shards once their queued tasks are processed
+func (p *shardedPool) close() {
+	if p == nil {
+		return
+	}
+	for _, queue := range p.shards {
+		close(queue)
+	}
+	p.wg.Wait()
 }
 
-// Process spans in parallel
+// Process the spans of a batch in parallel, one task per scope
 func processSpansInParallel(
 	ctx context.Context,
-	pool *workerPool,
-	spans ptrace.SpanSlice,
-	resource pcommon.Resource,
+	pool *shardedPool,
+	batch *sync.WaitGroup,
+	td ptrace.Traces,
 	processor func(context.Context, ptrace.Span, pcommon.Resource),
-) {
-	// Submit each span for processing
-	for i := 0; i < spans.Len(); i++ {
-		span := spans.At(i)
-		
-		pool.submit(ctx, func(ctx context.Context) {
-			processor(ctx, span, resource)
-		}, nil)
+) error {
+	var groups []scopeGroup
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		resource := rss.At(i).Resource()
+		sss := rss.At(i).ScopeSpans()
+
+		run := func(ctx context.Context, j int) {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				processor(ctx, spans.At(k), resource)
+			}
+		}
+
+		shard := pool.shard(resource)
+		for j := 0; j < sss.Len(); j++ {
+			groups = append(groups, scopeGroup{shard: shard, run: run, index: j})
+		}
 	}
+	return pool.submitGroups(ctx, batch, groups)
 }
 
-// Process logs in parallel
+// Process the logs of a batch in parallel, one task per scope
 func processLogsInParallel(
 	ctx context.Context,
-	pool *workerPool,
-	logs plog.LogRecordSlice,
-	resource pcommon.Resource,
+	pool *shardedPool,
+	batch *sync.WaitGroup,
+	ld plog.Logs,
 	processor func(context.Context, plog.LogRecord, pcommon.Resource),
-) {
-	// Submit each log for processing
-	for i := 0; i < logs.Len(); i++ {
-		log := logs.At(i)
-		
-		pool.submit(ctx, func(ctx context.Context) {
-			processor(ctx, log, resource)
-		}, nil)
+) error {
+	var groups []scopeGroup
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		resource := rls.At(i).Resource()
+		sls := rls.At(i).ScopeLogs()
+
+		run := func(ctx context.Context, j int) {
+			logs := sls.At(j).LogRecords()
+			for k := 0; k < logs.Len(); k++ {
+				processor(ctx, logs.At(k), resource)
+			}
+		}
+
+		shard := pool.shard(resource)
+		for j := 0; j < sls.Len(); j++ {
+			groups = append(groups, scopeGroup{shard: shard, run: run, index: j})
+		}
 	}
+	return pool.submitGroups(ctx, batch, groups)
 }
 
-// Process metrics in parallel
+// Process the metrics of a batch in parallel, one task per scope
 func processMetricsInParallel(
 	ctx context.Context,
-	pool *workerPool,
-	metrics pmetric.MetricSlice,
-	resource pcommon.Resource,
+	pool *shardedPool,
+	batch *sync.WaitGroup,
+	md pmetric.Metrics,
 	processor func(context.Context, pmetric.Metric, pcommon.Resource),
-) {
-	// Submit each metric for processing
-	for i := 0; i < metrics.Len(); i++ {
-		metric := metrics.At(i)
-		
-		pool.submit(ctx, func(ctx context.Context) {
-			processor(ctx, metric, resource)
-		}, nil)
+) error {
+	var groups []scopeGroup
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		resource := rms.At(i).Resource()
+		sms := rms.At(i).ScopeMetrics()
+
+		run := func(ctx context.Context, j int) {
+			metrics := sms.At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				processor(ctx, metrics.At(k), resource)
+			}
+		}
+
+		shard := pool.shard(resource)
+		for j := 0; j < sms.Len(); j++ {
+			groups = append(groups, scopeGroup{shard: shard, run: run, index: j})
+		}
 	}
-}
\ No newline at end of file
+	return pool.submitGroups(ctx, batch, groups)
+}
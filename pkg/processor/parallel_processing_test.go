@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestShardedPoolPreservesResourceOrder(t *testing.T) {
+	pool := newShardedPool(4, 2)
+	defer pool.close()
+
+	// The records of each resource are spread over several scopes
+	ld := plog.NewLogs()
+	for _, service := range []string{"checkout", "cart", "payments"} {
+		rl := ld.ResourceLogs().AppendEmpty()
+		rl.Resource().Attributes().PutStr("service.name", service)
+		for i := 0; i < 50; i++ {
+			if i%10 == 0 {
+				rl.ScopeLogs().AppendEmpty()
+			}
+			records := rl.ScopeLogs().At(i / 10).LogRecords()
+			records.AppendEmpty().Attributes().PutInt("seq", int64(i))
+		}
+	}
+
+	var mutex sync.Mutex
+	seen := make(map[string][]int64)
+	var batch sync.WaitGroup
+	err := processLogsInParallel(context.Background(), pool, &batch, ld,
+		func(ctx context.Context, log plog.LogRecord, resource pcommon.Resource) {
+			service, _ := resource.Attributes().Get("service.name")
+			seq, _ := log.Attributes().Get("seq")
+			mutex.Lock()
+			seen[service.Str()] = append(seen[service.Str()], seq.Int())
+			mutex.Unlock()
+		})
+	require.NoError(t, err)
+	batch.Wait()
+
+	for service, seqs := range seen {
+		require.Len(t, seqs, 50, service)
+		for i, seq := range seqs {
+			assert.Equal(t, int64(i), seq, service)
+		}
+	}
+	assert.Len(t, seen, 3)
+}
+
+func TestShardedPoolSubmitHonorsContext(t *testing.T) {
+	pool := newShardedPool(1, 1)
+	defer pool.close()
+
+	// Occupy the worker and fill its queue, the second submission only
+	// returns once the worker has taken the first
+	release := make(chan struct{})
+	var batch sync.WaitGroup
+	require.NoError(t, pool.submit(context.Background(), 0, &batch, func(context.Context, int) { <-release }, 0))
+	require.NoError(t, pool.submit(context.Background(), 0, &batch, func(context.Context, int) {}, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := pool.submit(ctx, 0, &batch, func(context.Context, int) {}, 2)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	batch.Wait()
+}
+
+func TestShardedPoolSubmitGroupsPassesOverFullShards(t *testing.T) {
+	pool := newShardedPool(2, 1)
+	defer pool.close()
+
+	// Occupy the first shard's worker and fill its queue
+	release := make(chan struct{})
+	var batch sync.WaitGroup
+	require.NoError(t, pool.submit(context.Background(), 0, &batch, func(context.Context, int) { <-release }, 0))
+	require.NoError(t, pool.submit(context.Background(), 0, &batch, func(context.Context, int) {}, 1))
+
+	// The second shard's group runs while the first shard's waits
+	ran := make(chan int, 2)
+	run := func(ctx context.Context, index int) { ran <- index }
+	done := make(chan error)
+	go func() {
+		done <- pool.submitGroups(context.Background(), &batch, []scopeGroup{
+			{shard: 0, run: run, index: 0},
+			{shard: 1, run: run, index: 1},
+		})
+	}()
+	assert.Equal(t, 1, <-ran)
+
+	close(release)
+	require.NoError(t, <-done)
+	batch.Wait()
+	assert.Equal(t, 0, <-ran)
+}
@@ -0,0 +1,208 @@
+// This file contains the persistence of the trace decision and model result
+// caches across restarts
+
+package processor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/persist"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Buckets of the persisted caches
+const (
+	// persistedDecisionsBucket holds the traces of the decision cache
+	persistedDecisionsBucket = "decisions"
+
+	// persistedResultsBucket prefixes the buckets of the model results
+	// caches, followed by the model
+	persistedResultsBucket = "results/"
+)
+
+// cachePersistence snapshots the trace decision cache and the model results
+// caches into a file every interval and when the processors shut down, and
+// restores them when they start, so a restart neither invokes the models
+// again for inputs seen just before nor splits the traces being kept.
+type cachePersistence struct {
+	logger    *zap.Logger
+	store     *persist.Store
+	runtime   *runtime.WasmRuntime
+	decisions *decisionCache
+
+	// The loop saving the snapshots
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// persistedResult is a model result as it is persisted
+type persistedResult struct {
+	Tenant    string                 `json:"tenant"`
+	Key       []byte                 `json:"key"`
+	ExpiresAt int64                  `json:"expires_at"`
+	Result    map[string]interface{} `json:"result"`
+}
+
+// openCachePersistence opens the persisted caches of config, restoring them
+// into the runtime's result caches and the decision cache, and starts
+// saving them. It returns nil unless persistence is enabled.
+func openCachePersistence(logger *zap.Logger, config *PersistenceConfig, wasmRuntime *runtime.WasmRuntime,
+	decisions *decisionCache) (*cachePersistence, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+	store, err := persist.Open(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	p := &cachePersistence{
+		logger:    logger,
+		store:     store,
+		runtime:   wasmRuntime,
+		decisions: decisions,
+	}
+
+	// A snapshot that can't be restored only costs a cold start
+	if err := p.restore(); err != nil {
+		logger.Warn("Failed to restore persisted caches, starting with empty caches",
+			zap.String("path", config.Path), zap.Error(err))
+	}
+
+	if config.SnapshotIntervalMs > 0 {
+		p.start(time.Duration(config.SnapshotIntervalMs) * time.Millisecond)
+	}
+	return p, nil
+}
+
+// restore loads the snapshots into the caches
+func (p *cachePersistence) restore() error {
+	now := time.Now()
+	var errs []error
+	decisions := 0
+	if p.decisions != nil {
+		errs = append(errs, p.store.Load(persistedDecisionsBucket, func(key, value []byte) error {
+			if len(value) != 24 {
+				return fmt.Errorf("invalid decision of %d bytes", len(value))
+			}
+			var id pcommon.TraceID
+			copy(id[:], value[:16])
+			kept := time.Unix(0, int64(binary.BigEndian.Uint64(value[16:])))
+			p.decisions.restore(id, kept, now)
+			decisions++
+			return nil
+		}))
+	}
+
+	results := 0
+	for model, cache := range p.runtime.ResultCaches() {
+		errs = append(errs, p.store.Load(persistedResultsBucket+model, func(key, value []byte) error {
+			var persisted persistedResult
+			if err := json.Unmarshal(value, &persisted); err != nil {
+				return fmt.Errorf("invalid result of %s: %w", model, err)
+			}
+			restored := runtime.CachedResult{
+				Tenant:    persisted.Tenant,
+				Result:    persisted.Result,
+				ExpiresAt: time.Unix(0, persisted.ExpiresAt),
+			}
+			copy(restored.Key[:], persisted.Key)
+			results++
+			return cache.Restore(restored)
+		}))
+	}
+
+	p.logger.Info("Restored persisted caches", zap.Int("decisions", decisions), zap.Int("results", results))
+	return errors.Join(errs...)
+}
+
+// save writes snapshots of the caches
+func (p *cachePersistence) save() error {
+	now := time.Now()
+	var errs []error
+	if p.decisions != nil {
+		var entries [][]byte
+		p.decisions.snapshot(now, func(id pcommon.TraceID, kept time.Time) {
+			entry := make([]byte, 24)
+			copy(entry, id[:])
+			binary.BigEndian.PutUint64(entry[16:], uint64(kept.UnixNano()))
+			entries = append(entries, entry)
+		})
+		errs = append(errs, p.store.Save(persistedDecisionsBucket, sequence(entries)))
+	}
+
+	for model, cache := range p.runtime.ResultCaches() {
+		var entries [][]byte
+		var failed error
+		cache.Snapshot(func(result runtime.CachedResult) {
+			entry, err := json.Marshal(persistedResult{
+				Tenant:    result.Tenant,
+				Key:       result.Key[:],
+				ExpiresAt: result.ExpiresAt.UnixNano(),
+				Result:    result.Result,
+			})
+			if err != nil {
+				failed = fmt.Errorf("failed to encode result of %s: %w", model, err)
+				return
+			}
+			entries = append(entries, entry)
+		})
+		errs = append(errs, failed, p.store.Save(persistedResultsBucket+model, sequence(entries)))
+	}
+	return errors.Join(errs...)
+}
+
+// sequence returns the entries of a snapshot keyed by their position, so
+// they are loaded in the order they were saved
+func sequence(entries [][]byte) func() ([]byte, []byte) {
+	i := 0
+	return func() ([]byte, []byte) {
+		if i == len(entries) {
+			return nil, nil
+		}
+		key := binary.BigEndian.AppendUint64(nil, uint64(i))
+		i++
+		return key, entries[i-1]
+	}
+}
+
+// start saves snapshots every interval until closed
+func (p *cachePersistence) start(interval time.Duration) {
+	stop := make(chan struct{})
+	p.stop = stop
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.save(); err != nil {
+					p.logger.Warn("Failed to persist caches", zap.Error(err))
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// close saves the last snapshots and closes the file
+func (p *cachePersistence) close() error {
+	if p == nil {
+		return nil
+	}
+	if p.stop != nil {
+		close(p.stop)
+		p.done.Wait()
+	}
+	return errors.Join(p.save(), p.store.Close())
+}
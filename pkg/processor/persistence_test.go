@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestCachePersistenceRestoresCaches(t *testing.T) {
+	config := &PersistenceConfig{Path: filepath.Join(t.TempDir(), "caches.db")}
+	open := func() (*runtime.WasmRuntime, *decisionCache, *cachePersistence) {
+		wasmRuntime, err := runtime.NewWasmRuntime(zap.NewNop(), &runtime.WasmRuntimeConfig{
+			EnableModelCaching: true,
+			ModelCacheSize:     100,
+		})
+		require.NoError(t, err)
+		decisions := newDecisionCache(&DecisionCacheConfig{Enabled: true, TTLMs: 60000})
+		persistence, err := openCachePersistence(zap.NewNop(), config, wasmRuntime, decisions)
+		require.NoError(t, err)
+		return wasmRuntime, decisions, persistence
+	}
+
+	wasmRuntime, decisions, persistence := open()
+	trace := pcommon.TraceID{1, 2, 3}
+	decisions.add(trace, time.Now())
+	cache := wasmRuntime.ResultCaches()[runtime.ModelSampler]
+	require.NotNil(t, cache)
+	input := []byte(`{"name":"GET /checkout"}`)
+	require.NoError(t, cache.Put("acme", input, map[string]interface{}{"importance": 0.8}))
+	require.NoError(t, persistence.close())
+	wasmRuntime.Close()
+
+	// The next run starts with the decisions and results of the previous one
+	wasmRuntime, decisions, persistence = open()
+	defer wasmRuntime.Close()
+	defer persistence.close()
+	assert.True(t, decisions.contains(trace, time.Now()))
+	result, found := wasmRuntime.ResultCaches()[runtime.ModelSampler].Get("acme", input)
+	require.True(t, found)
+	assert.Equal(t, 0.8, result["importance"])
+	_, found = wasmRuntime.ResultCaches()[runtime.ModelSampler].Get("other", input)
+	assert.False(t, found)
+
+	// Without a path nothing is persisted
+	persistence, err := openCachePersistence(zap.NewNop(), &PersistenceConfig{}, wasmRuntime, decisions)
+	require.NoError(t, err)
+	assert.Nil(t, persistence)
+}
@@ -0,0 +1,163 @@
+// This file contains the differential privacy and k-anonymity protection of
+// aggregate metrics, shared by the stub and fullwasm metrics processors
+
+package processor
+
+import (
+	"math"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/privacy"
+)
+
+// privacyFilter applies noise and suppression to the configured metrics
+type privacyFilter struct {
+	mechanism *privacy.Mechanism
+	metrics   []string
+}
+
+// newPrivacyFilter returns the filter for config, or nil if privacy is disabled
+func newPrivacyFilter(config *PrivacyConfig) (*privacyFilter, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	mechanism, err := privacy.New(privacy.Config{
+		Epsilon:     config.Epsilon,
+		Sensitivity: config.Sensitivity,
+		MinCount:    float64(config.KAnonymity),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &privacyFilter{mechanism: mechanism, metrics: config.Metrics}, nil
+}
+
+// matches reports whether a metric is protected
+func (f *privacyFilter) matches(name string) bool {
+	return metricNameMatches(f.metrics, name)
+}
+
+// metricNameMatches reports whether a metric name is one of patterns. Names
+// ending in * match by prefix.
+func metricNameMatches(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// apply protects the matching metrics in md. Sums are treated as counts:
+// they get noise, and data points whose noisy count is below the k-anonymity
+// threshold are removed. Gauges, such as error rates, only get noise.
+// Histograms get noise in their buckets, count and sum, and are suppressed
+// by their noisy count. Metrics left without data points are removed.
+//
+// Noise is drawn afresh on every export, so each export of a cumulative
+// series releases its whole history again and consumes epsilon of the
+// privacy budget, while delta series only release their new values.
+func (f *privacyFilter) apply(md pmetric.Metrics) {
+	if f == nil {
+		return
+	}
+
+	md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
+			sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				if !f.matches(metric.Name()) {
+					return false
+				}
+				return f.protect(metric)
+			})
+			return sm.Metrics().Len() == 0
+		})
+		return rm.ScopeMetrics().Len() == 0
+	})
+}
+
+// protect applies privacy to one metric and reports whether it became empty
+func (f *privacyFilter) protect(metric pmetric.Metric) bool {
+	switch metric.Type() {
+	case pmetric.MetricTypeSum:
+		dps := metric.Sum().DataPoints()
+		dps.RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+			count := f.mechanism.NoisyCount(numberValue(dp))
+			if f.mechanism.Suppressed(count) {
+				return true
+			}
+			setNumberValue(dp, count)
+			return false
+		})
+		return dps.Len() == 0
+
+	case pmetric.MetricTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			setNumberValue(dp, f.mechanism.Noise(numberValue(dp)))
+		}
+		return dps.Len() == 0
+
+	case pmetric.MetricTypeHistogram:
+		dps := metric.Histogram().DataPoints()
+		dps.RemoveIf(func(dp pmetric.HistogramDataPoint) bool {
+			f.protectHistogram(dp)
+			return f.mechanism.Suppressed(float64(dp.Count()))
+		})
+		return dps.Len() == 0
+	}
+
+	// Other types cannot be protected meaningfully and are withheld
+	return true
+}
+
+// protectHistogram adds noise to the buckets and keeps the count consistent
+func (f *privacyFilter) protectHistogram(dp pmetric.HistogramDataPoint) {
+	if dp.HasSum() {
+		dp.SetSum(f.mechanism.Noise(dp.Sum()))
+	}
+
+	// Minimum and maximum are single observations and are not released
+	dp.RemoveMin()
+	dp.RemoveMax()
+
+	buckets := dp.BucketCounts()
+	if buckets.Len() == 0 {
+		dp.SetCount(uint64(f.mechanism.NoisyCount(float64(dp.Count()))))
+		return
+	}
+
+	var total uint64
+	for i := 0; i < buckets.Len(); i++ {
+		count := uint64(f.mechanism.NoisyCount(float64(buckets.At(i))))
+		buckets.SetAt(i, count)
+		total += count
+	}
+	dp.SetCount(total)
+}
+
+// numberValue returns a number data point's value as float64
+func numberValue(dp pmetric.NumberDataPoint) float64 {
+	if dp.ValueType() == pmetric.NumberDataPointValueTypeInt {
+		return float64(dp.IntValue())
+	}
+	return dp.DoubleValue()
+}
+
+// setNumberValue sets a data point's value, keeping its value type
+func setNumberValue(dp pmetric.NumberDataPoint, value float64) {
+	if dp.ValueType() == pmetric.NumberDataPointValueTypeInt {
+		dp.SetIntValue(int64(math.Round(value)))
+		return
+	}
+	dp.SetDoubleValue(value)
+}
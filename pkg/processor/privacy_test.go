@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestPrivacyFilterSuppressesSmallCounts(t *testing.T) {
+	filter, err := newPrivacyFilter(&PrivacyConfig{
+		Enabled:    true,
+		Metrics:    []string{"traces_service_graph_*"},
+		KAnonymity: 5,
+	})
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+
+	edges := metrics.AppendEmpty()
+	edges.SetName("traces_service_graph_request_total")
+	dps := edges.SetEmptySum().DataPoints()
+	dps.AppendEmpty().SetIntValue(3)
+	dps.AppendEmpty().SetIntValue(12)
+
+	rare := metrics.AppendEmpty()
+	rare.SetName("traces_service_graph_request_failed_total")
+	rare.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(1)
+
+	other := metrics.AppendEmpty()
+	other.SetName("http.server.requests")
+	other.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(1)
+
+	filter.apply(md)
+
+	// Epsilon is zero, so only suppression applies
+	require.Equal(t, 2, metrics.Len())
+	assert.Equal(t, "traces_service_graph_request_total", metrics.At(0).Name())
+	require.Equal(t, 1, metrics.At(0).Sum().DataPoints().Len())
+	assert.Equal(t, int64(12), metrics.At(0).Sum().DataPoints().At(0).IntValue())
+	assert.Equal(t, "http.server.requests", metrics.At(1).Name())
+}
+
+func TestPrivacyFilterDisabled(t *testing.T) {
+	filter, err := newPrivacyFilter(&PrivacyConfig{Enabled: false})
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+
+	// A nil filter leaves metrics untouched
+	md := pmetric.NewMetrics()
+	md.ResourceMetrics().AppendEmpty()
+	filter.apply(md)
+	assert.Equal(t, 1, md.ResourceMetrics().Len())
+}
+
+func TestPrivacyFilterSuppressesByNoisyCount(t *testing.T) {
+	filter, err := newPrivacyFilter(&PrivacyConfig{
+		Enabled:    true,
+		Metrics:    []string{"errors_total"},
+		Epsilon:    1.0,
+		KAnonymity: 5,
+	})
+	require.NoError(t, err)
+
+	// A count just below the threshold is released whenever its noise lifts
+	// it above, so suppression doesn't reveal the true count
+	var released int
+	for i := 0; i < 1000; i++ {
+		md := pmetric.NewMetrics()
+		metric := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		metric.SetName("errors_total")
+		metric.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(4)
+
+		filter.apply(md)
+		if md.MetricCount() > 0 {
+			released++
+			assert.GreaterOrEqual(t, md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0).IntValue(), int64(5))
+		}
+	}
+	assert.Greater(t, released, 0)
+	assert.Less(t, released, 1000)
+}
@@ -7,6 +7,7 @@ package processor
 
 import (
 	"context"
+	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
@@ -19,18 +20,21 @@ import (
 
 // tracesProcessor processes trace data
 type tracesProcessor interface {
+	start(ctx context.Context, host component.Host) error
 	processTraces(ctx context.Context, td ptrace.Traces) (ptrace.Traces, error)
 	shutdown(ctx context.Context) error
 }
 
 // metricsProcessor processes metric data
 type metricsProcessor interface {
+	start(ctx context.Context, host component.Host) error
 	processMetrics(ctx context.Context, md pmetric.Metrics) (pmetric.Metrics, error)
 	shutdown(ctx context.Context) error
 }
 
 // logsProcessor processes log data
 type logsProcessor interface {
+	start(ctx context.Context, host component.Host) error
 	processLogs(ctx context.Context, ld plog.Logs) (plog.Logs, error)
 	shutdown(ctx context.Context) error
 }
@@ -41,11 +45,43 @@ type logsProcessor interface {
 type tracesProcessorWrapper struct {
 	processor tracesProcessor
 	next      consumer.Traces
+	intake    *intakeQueue // nil unless batches are processed asynchronously
+	stop      *batchStop
+	timeout   time.Duration
+	chunkSize int // 0 unless large batches are processed in chunks
 }
 
 func (pw *tracesProcessorWrapper) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
-	processed, err := pw.processor.processTraces(ctx, td)
-	if err != nil {
+	if pw.intake != nil {
+		return pw.intake.enqueue(ctx, func(ctx context.Context) error {
+			return pw.consumeTraces(ctx, td)
+		}, func(ctx context.Context) error {
+			return pw.consumeTraces(withoutModels(ctx), td)
+		})
+	}
+	return pw.consumeTraces(ctx, td)
+}
+
+// consumeTraces processes td and passes it to the next consumer, chunk
+// by chunk in streaming mode. Chunks passed on are not taken back if a later
+// one fails.
+func (pw *tracesProcessorWrapper) consumeTraces(ctx context.Context, td ptrace.Traces) error {
+	for _, chunk := range splitTraces(td, pw.chunkSize) {
+		if err := pw.consumeTracesChunk(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeTracesChunk processes a chunk of a batch and passes it to the next
+// consumer
+func (pw *tracesProcessorWrapper) consumeTracesChunk(ctx context.Context, td ptrace.Traces) error {
+	batchCtx, cancel := batchContext(ctx, pw.stop, pw.timeout)
+	processed, err := pw.processor.processTraces(batchCtx, td)
+	interrupted := batchInterrupted(ctx, batchCtx, err)
+	cancel()
+	if err != nil && !interrupted {
 		return err
 	}
 	return pw.next.ConsumeTraces(ctx, processed)
@@ -55,11 +91,19 @@ func (pw *tracesProcessorWrapper) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: true}
 }
 
-func (pw *tracesProcessorWrapper) Start(_ context.Context, _ component.Host) error {
+func (pw *tracesProcessorWrapper) Start(ctx context.Context, host component.Host) error {
+	if err := pw.processor.start(ctx, host); err != nil {
+		return err
+	}
+	pw.intake.start()
 	return nil
 }
 
 func (pw *tracesProcessorWrapper) Shutdown(ctx context.Context) error {
+	// Interrupt the batches being enriched, and pass the queued batches on
+	// without models, before the processor stops
+	pw.stop.stop()
+	pw.intake.close()
 	return pw.processor.shutdown(ctx)
 }
 
@@ -67,11 +111,43 @@ func (pw *tracesProcessorWrapper) Shutdown(ctx context.Context) error {
 type metricsProcessorWrapper struct {
 	processor metricsProcessor
 	next      consumer.Metrics
+	intake    *intakeQueue // nil unless batches are processed asynchronously
+	stop      *batchStop
+	timeout   time.Duration
+	chunkSize int // 0 unless large batches are processed in chunks
 }
 
 func (pw *metricsProcessorWrapper) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
-	processed, err := pw.processor.processMetrics(ctx, md)
-	if err != nil {
+	if pw.intake != nil {
+		return pw.intake.enqueue(ctx, func(ctx context.Context) error {
+			return pw.consumeMetrics(ctx, md)
+		}, func(ctx context.Context) error {
+			return pw.consumeMetrics(withoutModels(ctx), md)
+		})
+	}
+	return pw.consumeMetrics(ctx, md)
+}
+
+// consumeMetrics processes md and passes it to the next consumer, chunk
+// by chunk in streaming mode. Chunks passed on are not taken back if a later
+// one fails.
+func (pw *metricsProcessorWrapper) consumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	for _, chunk := range splitMetrics(md, pw.chunkSize) {
+		if err := pw.consumeMetricsChunk(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeMetricsChunk processes a chunk of a batch and passes it to the next
+// consumer
+func (pw *metricsProcessorWrapper) consumeMetricsChunk(ctx context.Context, md pmetric.Metrics) error {
+	batchCtx, cancel := batchContext(ctx, pw.stop, pw.timeout)
+	processed, err := pw.processor.processMetrics(batchCtx, md)
+	interrupted := batchInterrupted(ctx, batchCtx, err)
+	cancel()
+	if err != nil && !interrupted {
 		return err
 	}
 	return pw.next.ConsumeMetrics(ctx, processed)
@@ -81,11 +157,19 @@ func (pw *metricsProcessorWrapper) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: true}
 }
 
-func (pw *metricsProcessorWrapper) Start(_ context.Context, _ component.Host) error {
+func (pw *metricsProcessorWrapper) Start(ctx context.Context, host component.Host) error {
+	if err := pw.processor.start(ctx, host); err != nil {
+		return err
+	}
+	pw.intake.start()
 	return nil
 }
 
 func (pw *metricsProcessorWrapper) Shutdown(ctx context.Context) error {
+	// Interrupt the batches being enriched, and pass the queued batches on
+	// without models, before the processor stops
+	pw.stop.stop()
+	pw.intake.close()
 	return pw.processor.shutdown(ctx)
 }
 
@@ -93,11 +177,43 @@ func (pw *metricsProcessorWrapper) Shutdown(ctx context.Context) error {
 type logsProcessorWrapper struct {
 	processor logsProcessor
 	next      consumer.Logs
+	intake    *intakeQueue // nil unless batches are processed asynchronously
+	stop      *batchStop
+	timeout   time.Duration
+	chunkSize int // 0 unless large batches are processed in chunks
 }
 
 func (pw *logsProcessorWrapper) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
-	processed, err := pw.processor.processLogs(ctx, ld)
-	if err != nil {
+	if pw.intake != nil {
+		return pw.intake.enqueue(ctx, func(ctx context.Context) error {
+			return pw.consumeLogs(ctx, ld)
+		}, func(ctx context.Context) error {
+			return pw.consumeLogs(withoutModels(ctx), ld)
+		})
+	}
+	return pw.consumeLogs(ctx, ld)
+}
+
+// consumeLogs processes ld and passes it to the next consumer, chunk
+// by chunk in streaming mode. Chunks passed on are not taken back if a later
+// one fails.
+func (pw *logsProcessorWrapper) consumeLogs(ctx context.Context, ld plog.Logs) error {
+	for _, chunk := range splitLogs(ld, pw.chunkSize) {
+		if err := pw.consumeLogsChunk(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeLogsChunk processes a chunk of a batch and passes it to the next
+// consumer
+func (pw *logsProcessorWrapper) consumeLogsChunk(ctx context.Context, ld plog.Logs) error {
+	batchCtx, cancel := batchContext(ctx, pw.stop, pw.timeout)
+	processed, err := pw.processor.processLogs(batchCtx, ld)
+	interrupted := batchInterrupted(ctx, batchCtx, err)
+	cancel()
+	if err != nil && !interrupted {
 		return err
 	}
 	return pw.next.ConsumeLogs(ctx, processed)
@@ -107,10 +223,18 @@ func (pw *logsProcessorWrapper) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: true}
 }
 
-func (pw *logsProcessorWrapper) Start(_ context.Context, _ component.Host) error {
+func (pw *logsProcessorWrapper) Start(ctx context.Context, host component.Host) error {
+	if err := pw.processor.start(ctx, host); err != nil {
+		return err
+	}
+	pw.intake.start()
 	return nil
 }
 
 func (pw *logsProcessorWrapper) Shutdown(ctx context.Context) error {
+	// Interrupt the batches being enriched, and pass the queued batches on
+	// without models, before the processor stops
+	pw.stop.stop()
+	pw.intake.close()
 	return pw.processor.shutdown(ctx)
 }
\ No newline at end of file
@@ -0,0 +1,122 @@
+// This file contains the provenance of the models, recorded on the items
+// they enrich so outputs of different model versions can be told apart
+
+package processor
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Attributes written on enriched items with output.include_model_provenance,
+// under the output namespace
+const (
+	provenanceNameAttribute    = "model.name"
+	provenanceVersionAttribute = "model.version"
+	provenanceHashAttribute    = "model.hash"
+)
+
+// modelProvenance identifies the release of a loaded model and the local
+// file it was loaded from
+type modelProvenance struct {
+	name    string
+	version string
+	file    string // local file, pulled, downloaded or extracted
+	hash    string // hex encoded SHA-256 digest of the model file
+}
+
+// newModelProvenance returns the provenance of the model file at path. The
+// hash is empty if the file can't be read, as with remote models.
+func newModelProvenance(name string, version string, file string) *modelProvenance {
+	provenance := &modelProvenance{name: name, version: version, file: file}
+	if file != "" {
+		provenance.hash, _ = runtime.FileSHA256(file)
+	}
+	return provenance
+}
+
+// modelFileName returns the name of a model from its file or URI, without
+// its extensions, e.g. error-classifier for error-classifier.wasm.zst
+func modelFileName(file string) string {
+	name, _, _ := strings.Cut(path.Base(strings.ReplaceAll(file, "\\", "/")), ".")
+	return name
+}
+
+// modelProvenances holds the provenance of the loaded models, replaced as
+// they reload
+type modelProvenances struct {
+	models sync.Map // model -> *modelProvenance
+}
+
+// newModelProvenances returns the provenances of the error classifier,
+// sampler and entity extractor models
+func newModelProvenances(models [3]*modelProvenance) *modelProvenances {
+	p := &modelProvenances{}
+	names := [3]string{runtime.ModelErrorClassifier, runtime.ModelSampler, runtime.ModelEntityExtractor}
+	for i, model := range names {
+		if models[i] != nil {
+			p.models.Store(model, models[i])
+		}
+	}
+	return p
+}
+
+// reload records the provenance of a model reloaded from file under name.
+// Its version is unknown, since it no longer is the release the
+// configuration names.
+func (p *modelProvenances) reload(model string, name string, file string) {
+	if p != nil {
+		p.models.Store(model, newModelProvenance(name, "", file))
+	}
+}
+
+// get returns the provenance of model, nil if none is known
+func (p *modelProvenances) get(model string) *modelProvenance {
+	if p == nil {
+		return nil
+	}
+	loaded, ok := p.models.Load(model)
+	if !ok {
+		return nil
+	}
+	return loaded.(*modelProvenance)
+}
+
+// restore records a provenance returned by get again, once its model is
+// reloaded from its file
+func (p *modelProvenances) restore(model string, provenance *modelProvenance) {
+	if p != nil {
+		p.models.Store(model, provenance)
+	}
+}
+
+// annotate records the provenance of a model that enriched an item in its
+// attributes. The provenances of the models enriching the same item are
+// joined with commas, in the order they ran.
+func (p *modelProvenances) annotate(attributes pcommon.Map, model string, output *OutputConfig) {
+	if p == nil || !output.IncludeModelProvenance {
+		return
+	}
+	provenance := p.get(model)
+	if provenance == nil {
+		return
+	}
+	appendProvenance(attributes, output.AttributeNamespace+provenanceNameAttribute, provenance.name)
+	appendProvenance(attributes, output.AttributeNamespace+provenanceVersionAttribute, provenance.version)
+	appendProvenance(attributes, output.AttributeNamespace+provenanceHashAttribute, provenance.hash)
+}
+
+// appendProvenance sets key to value, or appends value to the provenance an
+// earlier model set
+func appendProvenance(attributes pcommon.Map, key string, value string) {
+	if existing, ok := attributes.Get(key); ok && existing.Type() == pcommon.ValueTypeStr {
+		attributes.PutStr(key, existing.Str()+","+value)
+		return
+	}
+	attributes.PutStr(key, value)
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestModelFileName(t *testing.T) {
+	assert.Equal(t, "error-classifier", modelFileName("/models/error-classifier.wasm"))
+	assert.Equal(t, "sampler", modelFileName("https://models.example.com/v2/sampler.wasm.zst"))
+	assert.Equal(t, "extractor", modelFileName("extractor"))
+}
+
+func TestModelProvenanceAnnotatesEnrichedItems(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "error-classifier.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("model"), 0o644))
+	digest := sha256.Sum256([]byte("model"))
+
+	provenances := newModelProvenances([3]*modelProvenance{
+		newModelProvenance("error-classifier", "1.4.0", path),
+		nil,
+		newModelProvenance("entity-extractor", "", ""),
+	})
+	output := CreateDefaultConfig().(*Config).Output
+
+	// Nothing is recorded unless enabled
+	attributes := pcommon.NewMap()
+	provenances.annotate(attributes, runtime.ModelErrorClassifier, &output)
+	assert.Equal(t, 0, attributes.Len())
+
+	output.IncludeModelProvenance = true
+	provenances.annotate(attributes, runtime.ModelErrorClassifier, &output)
+	assert.Equal(t, map[string]interface{}{
+		"ai.model.name":    "error-classifier",
+		"ai.model.version": "1.4.0",
+		"ai.model.hash":    hex.EncodeToString(digest[:]),
+	}, attributes.AsRaw())
+
+	// Models enriching the same item are listed in the order they ran
+	provenances.annotate(attributes, runtime.ModelEntityExtractor, &output)
+	name, _ := attributes.Get("ai.model.name")
+	assert.Equal(t, "error-classifier,entity-extractor", name.Str())
+	version, _ := attributes.Get("ai.model.version")
+	assert.Equal(t, "1.4.0,", version.Str())
+
+	// Reloaded models lose the configured version
+	provenances.reload(runtime.ModelErrorClassifier, "error-classifier-v2", path)
+	attributes = pcommon.NewMap()
+	provenances.annotate(attributes, runtime.ModelErrorClassifier, &output)
+	assert.Equal(t, "error-classifier-v2", attributes.AsRaw()["ai.model.name"])
+	assert.Equal(t, "", attributes.AsRaw()["ai.model.version"])
+
+	// Models without a provenance, such as the sampler here, record none
+	attributes = pcommon.NewMap()
+	provenances.annotate(attributes, runtime.ModelSampler, &output)
+	assert.Equal(t, 0, attributes.Len())
+}
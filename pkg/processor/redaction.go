@@ -0,0 +1,105 @@
+// This file contains the redaction of personal data in span attributes and
+// logs, shared by all processors
+
+package processor
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/redaction"
+)
+
+// redactionFilter redacts string values of telemetry, including those
+// nested in maps and slices
+type redactionFilter struct {
+	redactor *redaction.Redactor
+}
+
+// newRedactionFilter compiles the patterns of config. The filter is created
+// whether or not features.pii_redaction is enabled, since the control plane
+// can enable it.
+func newRedactionFilter(config *RedactionConfig) (*redactionFilter, error) {
+	patterns := make([]redaction.Pattern, 0, len(config.Patterns))
+	for _, p := range config.Patterns {
+		patterns = append(patterns, redaction.Pattern{Name: p.Name, Regex: p.Regex, Strategy: p.Strategy})
+	}
+	redactor, err := redaction.New(redaction.Config{Patterns: patterns, Salt: config.Salt})
+	if err != nil {
+		return nil, err
+	}
+	return &redactionFilter{redactor: redactor}, nil
+}
+
+// redactTraces redacts the attributes of spans and their events, of the
+// resources redact holds for, or all if redact is nil
+func (f *redactionFilter) redactTraces(td ptrace.Traces, redact func(resource pcommon.Resource) bool) {
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		if redact != nil && !redact(rss.At(i).Resource()) {
+			continue
+		}
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				f.redactMap(span.Attributes())
+				events := span.Events()
+				for e := 0; e < events.Len(); e++ {
+					f.redactMap(events.At(e).Attributes())
+				}
+			}
+		}
+	}
+}
+
+// redactLogs redacts the bodies and attributes of log records, of the
+// resources redact holds for, or all if redact is nil. Bodies dropped by a
+// pattern are left empty.
+func (f *redactionFilter) redactLogs(ld plog.Logs, redact func(resource pcommon.Resource) bool) {
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		if redact != nil && !redact(rls.At(i).Resource()) {
+			continue
+		}
+		sls := rls.At(i).ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			logs := sls.At(j).LogRecords()
+			for k := 0; k < logs.Len(); k++ {
+				log := logs.At(k)
+				if f.redactValue(log.Body()) {
+					pcommon.NewValueEmpty().CopyTo(log.Body())
+				}
+				f.redactMap(log.Attributes())
+			}
+		}
+	}
+}
+
+// redactMap redacts the values of m, removing those dropped by a pattern
+func (f *redactionFilter) redactMap(m pcommon.Map) {
+	m.RemoveIf(func(_ string, value pcommon.Value) bool {
+		return f.redactValue(value)
+	})
+}
+
+// redactValue redacts a value in place and reports whether it is dropped
+func (f *redactionFilter) redactValue(value pcommon.Value) bool {
+	switch value.Type() {
+	case pcommon.ValueTypeStr:
+		redacted, dropped := f.redactor.Redact(value.Str())
+		if !dropped && redacted != value.Str() {
+			value.SetStr(redacted)
+		}
+		return dropped
+	case pcommon.ValueTypeMap:
+		f.redactMap(value.Map())
+	case pcommon.ValueTypeSlice:
+		value.Slice().RemoveIf(func(element pcommon.Value) bool {
+			return f.redactValue(element)
+		})
+	}
+	return false
+}
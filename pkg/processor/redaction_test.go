@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestRedactionFilterRedactsSpansAndLogs(t *testing.T) {
+	config := createDefaultConfig().(*Config).Redaction
+	config.Patterns = append(config.Patterns, RedactionPattern{Name: "password", Regex: `password=\S+`, Strategy: "drop"})
+	filter, err := newRedactionFilter(&config)
+	require.NoError(t, err)
+
+	td := ptrace.NewTraces()
+	span := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutStr("user.email", "jane@example.com")
+	span.Attributes().PutStr("db.statement", "UPDATE users SET password=hunter2")
+	span.Attributes().PutInt("http.status_code", 500)
+	tags := span.Attributes().PutEmptySlice("tags")
+	tags.AppendEmpty().SetStr("vip")
+	tags.AppendEmpty().SetStr("password=hunter2")
+	event := span.Events().AppendEmpty()
+	event.Attributes().PutStr("exception.message", "token Bearer abc123 rejected")
+	filter.redactTraces(td, nil)
+
+	assert.Equal(t, map[string]interface{}{
+		"user.email":       "[REDACTED:email]",
+		"http.status_code": int64(500),
+		"tags":             []interface{}{"vip"},
+	}, span.Attributes().AsRaw())
+	message, _ := event.Attributes().Get("exception.message")
+	assert.Equal(t, "token [REDACTED:token] rejected", message.Str())
+
+	ld := plog.NewLogs()
+	logs := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	structured := logs.AppendEmpty()
+	structured.Body().SetEmptyMap().PutEmptyMap("payment").PutStr("card", "4111-1111-1111-1111")
+	dropped := logs.AppendEmpty()
+	dropped.Body().SetStr("login with password=hunter2")
+	dropped.Attributes().PutStr("user", "jane@example.com")
+	filter.redactLogs(ld, nil)
+
+	assert.Equal(t, map[string]interface{}{"payment": map[string]interface{}{"card": "[REDACTED:credit_card]"}}, structured.Body().AsRaw())
+	assert.Nil(t, dropped.Body().AsRaw())
+	assert.Equal(t, map[string]interface{}{"user": "[REDACTED:email]"}, dropped.Attributes().AsRaw())
+}
@@ -0,0 +1,149 @@
+// This file contains the remote configurations a management server, such as
+// an OpAMP server, pushes to the processors of a configuration: sampling
+// rates, feature toggles and the URLs of new models
+
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/download"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// remoteConfig is a remote configuration, in YAML or JSON. Its settings are
+// named as in the control plane's UpdateSampling and SetFeatures methods.
+type remoteConfig struct {
+	// Sampling are the sampling rates set, e.g. normal_spans or logs.info
+	Sampling map[string]float64 `yaml:"sampling"`
+
+	// Features are the features enabled or disabled
+	Features map[string]bool `yaml:"features"`
+
+	// Models are the models installed, keyed by error_classifier, sampler
+	// or entity_extractor
+	Models map[string]remoteModel `yaml:"models"`
+}
+
+// remoteModel is a model installed from a URL
+type remoteModel struct {
+	URL string `yaml:"url"`
+
+	// SHA256 is the hex encoded digest the download must have, if set
+	SHA256 string `yaml:"sha256"`
+}
+
+// parseRemoteConfig decodes a remote configuration. Unknown sections fail,
+// so a misspelled setting isn't silently ignored.
+func parseRemoteConfig(body []byte) (*remoteConfig, error) {
+	config := &remoteConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid remote configuration: %w", err)
+	}
+	return config, nil
+}
+
+// applyRemoteConfig applies a remote configuration to the live
+// configuration. Its sampling rates, features and models are checked, and
+// its models downloaded and installed, before the sampling rates and
+// features are applied. The models installed are restored if another fails
+// to install, so an invalid configuration or a failed download or install
+// changes nothing.
+func (s *controlState) applyRemoteConfig(ctx context.Context, config *remoteConfig) error {
+	known := featuresMap(&FeaturesConfig{})
+	for key := range config.Features {
+		if _, ok := known[key]; !ok {
+			return fmt.Errorf("unknown feature %q", key)
+		}
+	}
+	check := *s.current()
+	if err := setSamplingRates(&check, config.Sampling); err != nil {
+		return err
+	}
+
+	models := make([]string, 0, len(config.Models))
+	for model, remote := range config.Models {
+		switch model {
+		case runtime.ModelErrorClassifier, runtime.ModelSampler, runtime.ModelEntityExtractor:
+		default:
+			return fmt.Errorf("unknown model %q", model)
+		}
+		if !download.IsURI(remote.URL) {
+			return fmt.Errorf("model %s: url must be an http(s)://, s3:// or oci:// URI, got %q", model, remote.URL)
+		}
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	paths := make(map[string]string, len(models))
+	if len(models) > 0 {
+		downloads := newDownloadClient(&s.current().Models.Download)
+		for _, model := range models {
+			remote := config.Models[model]
+			path, digest, err := downloads.Fetch(ctx, remote.URL, remote.SHA256)
+			if err != nil {
+				return fmt.Errorf("failed to download model %s: %w", model, err)
+			}
+			s.logger.Info("Downloaded model of remote configuration", zap.String("model", model),
+				zap.String("uri", remote.URL), zap.String("sha256", digest))
+			paths[model] = path
+		}
+	}
+
+	previous := make(map[string]*modelProvenance, len(models))
+	for _, model := range models {
+		previous[model] = s.provenance.get(model)
+	}
+	configured := modelPaths(s.current())
+	for i, model := range models {
+		if err := s.reloadModel(model, paths[model]); err != nil {
+			s.restoreModels(models[:i], previous, configured)
+			return fmt.Errorf("failed to install model %s: %w", model, err)
+		}
+		s.provenance.reload(model, modelFileName(config.Models[model].URL), paths[model])
+		s.logger.Info("Model installed by remote configuration", zap.String("model", model),
+			zap.String("uri", config.Models[model].URL))
+	}
+
+	if _, err := s.UpdateSampling(ctx, config.Sampling); err != nil {
+		return err
+	}
+	if _, err := s.SetFeatures(ctx, config.Features); err != nil {
+		return err
+	}
+	return nil
+}
+
+// restoreModels reloads models from the local files they were loaded from,
+// recorded in their previous provenance, after another model of a remote
+// configuration failed to install. Their provenance and configured paths
+// are restored as well.
+func (s *controlState) restoreModels(models []string, previous map[string]*modelProvenance, configured map[string]string) {
+	for _, model := range models {
+		provenance := previous[model]
+		if provenance == nil || provenance.file == "" {
+			s.logger.Warn("Failed to restore model, no file was loaded before", zap.String("model", model))
+			continue
+		}
+		if err := s.reloadModel(model, provenance.file); err != nil {
+			s.logger.Warn("Failed to restore model", zap.String("model", model),
+				zap.String("path", provenance.file), zap.Error(err))
+			continue
+		}
+		s.provenance.restore(model, provenance)
+		s.update(func(config *Config) error {
+			setModelPath(config, model, configured[model])
+			return nil
+		})
+	}
+}
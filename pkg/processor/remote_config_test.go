@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/registry"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestParseRemoteConfig(t *testing.T) {
+	config, err := parseRemoteConfig([]byte(`
+sampling:
+  normal_spans: 0.05
+features:
+  genai: true
+models:
+  error_classifier:
+    url: https://models.example.com/error-classifier-1.5.wasm
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"normal_spans": 0.05}, config.Sampling)
+	assert.Equal(t, map[string]bool{"genai": true}, config.Features)
+	assert.Equal(t, "https://models.example.com/error-classifier-1.5.wasm", config.Models["error_classifier"].URL)
+
+	// JSON is accepted too, and an empty configuration changes nothing
+	config, err = parseRemoteConfig([]byte(`{"sampling": {"logs.info": 0.2}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"logs.info": 0.2}, config.Sampling)
+	_, err = parseRemoteConfig(nil)
+	require.NoError(t, err)
+
+	_, err = parseRemoteConfig([]byte("sampling_rates:\n  normal_spans: 0.05\n"))
+	assert.ErrorContains(t, err, "sampling_rates")
+}
+
+func TestApplyRemoteConfig(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	config := CreateDefaultConfig().(*Config)
+	config.Models.Download.CacheDir = t.TempDir()
+	state := &controlState{logger: zap.NewNop()}
+	state.config.Store(config)
+	ctx := context.Background()
+
+	require.NoError(t, state.applyRemoteConfig(ctx, &remoteConfig{
+		Sampling: map[string]float64{"normal_spans": 0.05},
+		Features: map[string]bool{"genai": true},
+	}))
+	assert.Equal(t, 0.05, state.current().Sampling.NormalSpans)
+	assert.True(t, state.current().Features.GenAI)
+
+	// Invalid configurations and failed downloads apply nothing
+	for name, remote := range map[string]*remoteConfig{
+		"unknown feature": {
+			Sampling: map[string]float64{"normal_spans": 0.5},
+			Features: map[string]bool{"telepathy": true},
+		},
+		"unknown model": {
+			Sampling: map[string]float64{"normal_spans": 0.5},
+			Models:   map[string]remoteModel{"oracle": {URL: server.URL + "/oracle.wasm"}},
+		},
+		"local model": {
+			Sampling: map[string]float64{"normal_spans": 0.5},
+			Models:   map[string]remoteModel{"sampler": {URL: "/models/sampler.wasm"}},
+		},
+		"failed download": {
+			Sampling: map[string]float64{"normal_spans": 0.5},
+			Models:   map[string]remoteModel{"sampler": {URL: server.URL + "/sampler.wasm"}},
+		},
+	} {
+		assert.Error(t, state.applyRemoteConfig(ctx, remote), name)
+		assert.Equal(t, 0.05, state.current().Sampling.NormalSpans, name)
+	}
+}
+
+// reloadBackend records the paths it is reloaded from, failing with err
+type reloadBackend struct {
+	echoBackend
+	paths []string
+	err   error
+}
+
+func (b *reloadBackend) Reload(path string) error {
+	b.paths = append(b.paths, path)
+	return b.err
+}
+
+func TestApplyRemoteConfigRestoresModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\x00asm"))
+	}))
+	defer server.Close()
+
+	wasmRuntime, err := runtime.NewWasmRuntime(zap.NewNop(), &runtime.WasmRuntimeConfig{})
+	require.NoError(t, err)
+	defer wasmRuntime.Close()
+	classifier := &reloadBackend{}
+	sampler := &reloadBackend{err: errors.New("invalid module")}
+	wasmRuntime.SetBackend(runtime.ModelErrorClassifier, runtime.BackendWasm, classifier)
+	wasmRuntime.SetBackend(runtime.ModelSampler, runtime.BackendWasm, sampler)
+
+	config := CreateDefaultConfig().(*Config)
+	config.Models.Download.CacheDir = t.TempDir()
+	previous := config.Models.ErrorClassifier.Path
+	provenances := newModelProvenances([3]*modelProvenance{newModelProvenance("error-classifier", "", previous), nil, nil})
+	state := &controlState{logger: zap.NewNop(), runtime: wasmRuntime, provenance: provenances}
+	state.config.Store(config)
+
+	// The sampler fails to install once the error classifier is installed,
+	// so the error classifier is restored and nothing else changes
+	err = state.applyRemoteConfig(context.Background(), &remoteConfig{
+		Sampling: map[string]float64{"normal_spans": 0.5},
+		Features: map[string]bool{"genai": true},
+		Models: map[string]remoteModel{
+			runtime.ModelErrorClassifier: {URL: server.URL + "/error-classifier.wasm"},
+			runtime.ModelSampler:         {URL: server.URL + "/sampler.wasm"},
+		},
+	})
+	assert.ErrorContains(t, err, "invalid module")
+	require.Len(t, classifier.paths, 2)
+	assert.Equal(t, previous, classifier.paths[1])
+	assert.Equal(t, previous, state.current().Models.ErrorClassifier.Path)
+	assert.Equal(t, config.Sampling.NormalSpans, state.current().Sampling.NormalSpans)
+	assert.False(t, state.current().Features.GenAI)
+}
+
+func TestApplyRemoteConfigRestoresRegistryModels(t *testing.T) {
+	model := []byte("\x00asm-registry")
+	digest := sha256.Sum256(model)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(registry.Index{Models: []registry.Entry{
+			{Name: "error-classifier", Version: "1.4.0", SHA256: hex.EncodeToString(digest[:]), URL: "models/ec-1.4.0.wasm"},
+		}})
+	})
+	mux.HandleFunc("/models/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(model)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The error classifier is pulled from the registry, so it has no path
+	config := CreateDefaultConfig().(*Config)
+	config.Models.Registry.Endpoint = server.URL + "/index.json"
+	config.Models.Registry.CacheDir = t.TempDir()
+	config.Models.Download.CacheDir = t.TempDir()
+	config.Models.ErrorClassifier.Path = ""
+	config.Models.ErrorClassifier.Ref = "registry://error-classifier@1.4.0"
+	paths, _, provenances, err := resolveModelPaths(zap.NewNop(), &config.Models)
+	require.NoError(t, err)
+
+	wasmRuntime, err := runtime.NewWasmRuntime(zap.NewNop(), &runtime.WasmRuntimeConfig{})
+	require.NoError(t, err)
+	defer wasmRuntime.Close()
+	classifier := &reloadBackend{}
+	wasmRuntime.SetBackend(runtime.ModelErrorClassifier, runtime.BackendWasm, classifier)
+	wasmRuntime.SetBackend(runtime.ModelSampler, runtime.BackendWasm, &reloadBackend{err: errors.New("invalid module")})
+
+	state := &controlState{logger: zap.NewNop(), runtime: wasmRuntime, provenance: newModelProvenances(provenances)}
+	state.config.Store(config)
+
+	err = state.applyRemoteConfig(context.Background(), &remoteConfig{
+		Models: map[string]remoteModel{
+			runtime.ModelErrorClassifier: {URL: server.URL + "/models/error-classifier-1.5.wasm"},
+			runtime.ModelSampler:         {URL: server.URL + "/models/sampler.wasm"},
+		},
+	})
+	assert.ErrorContains(t, err, "invalid module")
+
+	// The error classifier is reloaded from the pulled file and reported
+	// as before
+	require.Len(t, classifier.paths, 2)
+	assert.Equal(t, paths[0], classifier.paths[1])
+	assert.Empty(t, state.current().Models.ErrorClassifier.Path)
+	versions := modelVersions(state.current(), state.provenance)
+	assert.Equal(t, map[string]interface{}{"path": paths[0], "sha256": hex.EncodeToString(digest[:])}, versions[runtime.ModelErrorClassifier])
+	provenance := state.provenance.get(runtime.ModelErrorClassifier)
+	assert.Equal(t, "1.4.0", provenance.version)
+}
@@ -0,0 +1,148 @@
+// This file contains the data-residency labeling of telemetry and the
+// restriction of model backends by residency, shared by all processors
+
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// residencyPolicy labels resources with their residency and restricts the
+// model backends their data is sent to
+type residencyPolicy struct {
+	key          string
+	sources      []string
+	exact        map[string]string
+	prefixes     []regionPrefix
+	defaultLabel string
+	restricted   map[string][]string
+}
+
+// regionPrefix maps regions starting with prefix to a label
+type regionPrefix struct {
+	prefix string
+	label  string
+}
+
+// newResidencyPolicy returns the policy for config, or nil if residency is disabled
+func newResidencyPolicy(config *ResidencyConfig, namespace string) (*residencyPolicy, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	policy := &residencyPolicy{
+		key:          namespace + "residency",
+		sources:      config.SourceAttributes,
+		exact:        make(map[string]string),
+		defaultLabel: config.Default,
+		restricted:   config.Restricted,
+	}
+
+	for region, label := range config.Regions {
+		if prefix, ok := strings.CutSuffix(region, "*"); ok {
+			policy.prefixes = append(policy.prefixes, regionPrefix{prefix: prefix, label: label})
+		} else {
+			policy.exact[region] = label
+		}
+	}
+
+	// The longest matching prefix wins
+	sort.Slice(policy.prefixes, func(i, j int) bool {
+		return len(policy.prefixes[i].prefix) > len(policy.prefixes[j].prefix)
+	})
+
+	for label, backends := range config.Restricted {
+		for _, backend := range backends {
+			switch backend {
+			case runtime.BackendWasm, runtime.BackendSidecar, runtime.BackendTriton, runtime.BackendRemote, runtime.BackendONNX:
+			default:
+				return nil, fmt.Errorf("unknown model backend %q restricted for residency %q", backend, label)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// label returns the residency of a region
+func (p *residencyPolicy) label(region string) string {
+	if label, ok := p.exact[region]; ok {
+		return label
+	}
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(region, prefix.prefix) {
+			return prefix.label
+		}
+	}
+	return p.defaultLabel
+}
+
+// tag sets the residency label on a resource. A label set upstream is kept
+// when the resource has no region attribute.
+func (p *residencyPolicy) tag(resource pcommon.Resource) {
+	attrs := resource.Attributes()
+	for _, source := range p.sources {
+		if region, ok := attrs.Get(source); ok && region.Str() != "" {
+			attrs.PutStr(p.key, p.label(region.Str()))
+			return
+		}
+	}
+
+	if _, ok := attrs.Get(p.key); !ok && p.defaultLabel != "" {
+		attrs.PutStr(p.key, p.defaultLabel)
+	}
+}
+
+// context returns ctx restricted to the backends allowed for the data of a
+// tagged resource
+func (p *residencyPolicy) context(ctx context.Context, resource pcommon.Resource) context.Context {
+	if p == nil || len(p.restricted) == 0 {
+		return ctx
+	}
+
+	label, ok := resource.Attributes().Get(p.key)
+	if !ok {
+		return ctx
+	}
+	return runtime.WithBlockedBackends(ctx, p.restricted[label.Str()])
+}
+
+// tagTraces labels the resources of td
+func (p *residencyPolicy) tagTraces(td ptrace.Traces) {
+	if p == nil {
+		return
+	}
+	for i := 0; i < td.ResourceSpans().Len(); i++ {
+		p.tag(td.ResourceSpans().At(i).Resource())
+	}
+}
+
+// tagLogs labels the resources of ld
+func (p *residencyPolicy) tagLogs(ld plog.Logs) {
+	if p == nil {
+		return
+	}
+	for i := 0; i < ld.ResourceLogs().Len(); i++ {
+		p.tag(ld.ResourceLogs().At(i).Resource())
+	}
+}
+
+// tagMetrics labels the resources of md
+func (p *residencyPolicy) tagMetrics(md pmetric.Metrics) {
+	if p == nil {
+		return
+	}
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		p.tag(md.ResourceMetrics().At(i).Resource())
+	}
+}
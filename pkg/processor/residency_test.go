@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+type echoBackend struct{}
+
+func (echoBackend) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	var output map[string]interface{}
+	err := json.Unmarshal(input, &output)
+	return output, err
+}
+func (echoBackend) Reload(path string) error { return nil }
+func (echoBackend) Close() error             { return nil }
+
+func TestResidencyBlocksRestrictedBackends(t *testing.T) {
+	policy, err := newResidencyPolicy(&ResidencyConfig{
+		Enabled:          true,
+		SourceAttributes: []string{"cloud.region"},
+		Regions:          map[string]string{"eu-*": "eu", "eu-west-9": "eu-sovereign", "us-*": "us"},
+		Default:          "unknown",
+		Restricted:       map[string][]string{"eu": {runtime.BackendTriton}},
+	}, "ai.")
+	require.NoError(t, err)
+
+	td := ptrace.NewTraces()
+	for _, region := range []string{"eu-central-1", "eu-west-9", "us-east-1", ""} {
+		rs := td.ResourceSpans().AppendEmpty()
+		if region != "" {
+			rs.Resource().Attributes().PutStr("cloud.region", region)
+		}
+	}
+	policy.tagTraces(td)
+
+	var labels []string
+	for i := 0; i < td.ResourceSpans().Len(); i++ {
+		label, _ := td.ResourceSpans().At(i).Resource().Attributes().Get("ai.residency")
+		labels = append(labels, label.Str())
+	}
+	assert.Equal(t, []string{"eu", "eu-sovereign", "us", "unknown"}, labels)
+
+	wasmRuntime, err := runtime.NewWasmRuntime(zap.NewNop(), &runtime.WasmRuntimeConfig{})
+	require.NoError(t, err)
+	defer wasmRuntime.Close()
+	wasmRuntime.SetBackend(runtime.ModelEntityExtractor, runtime.BackendTriton, echoBackend{})
+
+	// A fake WASM model, so the error classifier answers in the fullwasm
+	// build as in the stub build
+	wasmRuntime.SetBackend(runtime.ModelErrorClassifier, runtime.BackendWasm, echoBackend{})
+
+	// EU data never reaches the inference server, WASM models still run
+	eu := policy.context(context.Background(), td.ResourceSpans().At(0).Resource())
+	_, err = wasmRuntime.ExtractEntities(eu, &runtime.EntityInput{Name: "op"})
+	assert.ErrorIs(t, err, runtime.ErrBackendBlocked)
+	_, err = wasmRuntime.ClassifyError(eu, &runtime.ErrorInput{Name: "op"})
+	assert.NoError(t, err)
+
+	us := policy.context(context.Background(), td.ResourceSpans().At(2).Resource())
+	_, err = wasmRuntime.ExtractEntities(us, &runtime.EntityInput{Name: "op"})
+	assert.NoError(t, err)
+}
+
+func TestResidencyRejectsUnknownBackends(t *testing.T) {
+	_, err := newResidencyPolicy(&ResidencyConfig{
+		Enabled:    true,
+		Restricted: map[string][]string{"eu": {"llm"}},
+	}, "ai.")
+	assert.Error(t, err)
+}
@@ -0,0 +1,221 @@
+// This file contains the glue between the processors and the CEL rules
+// engine that is evaluated before model invocation
+
+package processor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// newRulesEngine compiles the configured rules. Returns nil if there are none.
+func newRulesEngine(config *Config) (*expression.Engine, error) {
+	if len(config.Rules) == 0 {
+		return nil, nil
+	}
+	return expression.NewEngine(config.Rules)
+}
+
+// evaluateRules evaluates the rules for one telemetry item. Evaluation errors
+// are logged at debug level. A nil engine yields an empty result.
+func evaluateRules(logger *zap.Logger, engine *expression.Engine, input expression.Input) expression.Result {
+	if engine == nil {
+		return expression.Result{}
+	}
+
+	result, err := engine.Evaluate(input)
+	if err != nil {
+		logger.Debug("Failed to evaluate rules", zap.String("signal", input.Signal), zap.Error(err))
+	}
+
+	return result
+}
+
+// applyRuleAttributes sets the attributes produced by the rules
+func applyRuleAttributes(result *expression.Result, attributes pcommon.Map) {
+	for k, v := range result.Attributes {
+		setAttribute(attributes, k, v)
+	}
+}
+
+// dataPointAttributes returns the attribute maps of all data points of a metric
+func dataPointAttributes(metric pmetric.Metric) []pcommon.Map {
+	var attributes []pcommon.Map
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		for i := 0; i < metric.Gauge().DataPoints().Len(); i++ {
+			attributes = append(attributes, metric.Gauge().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeSum:
+		for i := 0; i < metric.Sum().DataPoints().Len(); i++ {
+			attributes = append(attributes, metric.Sum().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeHistogram:
+		for i := 0; i < metric.Histogram().DataPoints().Len(); i++ {
+			attributes = append(attributes, metric.Histogram().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		for i := 0; i < metric.ExponentialHistogram().DataPoints().Len(); i++ {
+			attributes = append(attributes, metric.ExponentialHistogram().DataPoints().At(i).Attributes())
+		}
+	case pmetric.MetricTypeSummary:
+		for i := 0; i < metric.Summary().DataPoints().Len(); i++ {
+			attributes = append(attributes, metric.Summary().DataPoints().At(i).Attributes())
+		}
+	}
+	return attributes
+}
+
+// spanRuleInput builds the rules input for a span
+func spanRuleInput(span ptrace.Span, resource pcommon.Resource) expression.Input {
+	return expression.Input{
+		Signal:        expression.SignalTraces,
+		Name:          span.Name(),
+		Kind:          span.Kind().String(),
+		Status:        span.Status().Code().String(),
+		StatusMessage: span.Status().Message(),
+		DurationMs:    int64(span.EndTimestamp()-span.StartTimestamp()) / 1_000_000,
+		Attributes:    attributesToMap(span.Attributes()),
+		Resource:      resourceToMap(resource),
+	}
+}
+
+// logRuleInput builds the rules input for a log record
+func logRuleInput(log plog.LogRecord, resource pcommon.Resource) expression.Input {
+	return expression.Input{
+		Signal:         expression.SignalLogs,
+		Severity:       log.SeverityText(),
+		SeverityNumber: int64(log.SeverityNumber()),
+		Body:           log.Body().AsString(),
+		Attributes:     attributesToMap(log.Attributes()),
+		Resource:       resourceToMap(resource),
+	}
+}
+
+// metricRuleInput builds the rules input for a metric
+func metricRuleInput(metric pmetric.Metric, resource pcommon.Resource) expression.Input {
+	return expression.Input{
+		Signal:   expression.SignalMetrics,
+		Name:     metric.Name(),
+		Kind:     metric.Type().String(),
+		Resource: resourceToMap(resource),
+	}
+}
+
+// ruleDecision is the part of a rules result needed at sampling time
+type ruleDecision struct {
+	// sampling is the forced decision, or "" if there is none
+	sampling string
+
+	// skipSampler is set when rules skip the sampler model
+	skipSampler bool
+}
+
+// ruleDecisions collects the sampling decisions made by rules while a
+// batch is processed, keyed by the span, log record or metric
+type ruleDecisions struct {
+	decisions sync.Map
+	drops     atomic.Int64
+}
+
+type ruleDecisionsKey struct{}
+
+// withRuleDecisions returns a context carrying a new decision set for one batch
+func withRuleDecisions(ctx context.Context) (context.Context, *ruleDecisions) {
+	decisions := &ruleDecisions{}
+	return context.WithValue(ctx, ruleDecisionsKey{}, decisions), decisions
+}
+
+// ruleDecisionsFrom returns the decision set of the batch, or nil
+func ruleDecisionsFrom(ctx context.Context) *ruleDecisions {
+	decisions, _ := ctx.Value(ruleDecisionsKey{}).(*ruleDecisions)
+	return decisions
+}
+
+// set records the sampling related outcome of the rules for an item
+func (d *ruleDecisions) set(item interface{}, result *expression.Result) {
+	decision := ruleDecision{
+		sampling:    result.Sampling,
+		skipSampler: result.Skips(runtime.ModelSampler),
+	}
+	if d == nil || decision == (ruleDecision{}) {
+		return
+	}
+	d.decisions.Store(item, decision)
+	if decision.sampling == expression.SamplingDrop {
+		d.drops.Add(1)
+	}
+}
+
+// get returns the decision recorded for an item
+func (d *ruleDecisions) get(item interface{}) ruleDecision {
+	if d == nil {
+		return ruleDecision{}
+	}
+	decision, _ := d.decisions.Load(item)
+	r, _ := decision.(ruleDecision)
+	return r
+}
+
+// hasDrops reports whether any item was forced to be dropped
+func (d *ruleDecisions) hasDrops() bool {
+	return d != nil && d.drops.Load() > 0
+}
+
+// removeDroppedSpans removes the spans that rules forced to be dropped
+func removeDroppedSpans(td ptrace.Traces, decisions *ruleDecisions) {
+	if !decisions.hasDrops() {
+		return
+	}
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			sss.At(j).Spans().RemoveIf(func(span ptrace.Span) bool {
+				return decisions.get(span).sampling == expression.SamplingDrop
+			})
+		}
+	}
+}
+
+// removeDroppedLogs removes the log records that rules forced to be dropped
+func removeDroppedLogs(ld plog.Logs, decisions *ruleDecisions) {
+	if !decisions.hasDrops() {
+		return
+	}
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		sls := rls.At(i).ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			sls.At(j).LogRecords().RemoveIf(func(log plog.LogRecord) bool {
+				return decisions.get(log).sampling == expression.SamplingDrop
+			})
+		}
+	}
+}
+
+// removeDroppedMetrics removes the metrics that rules forced to be dropped
+func removeDroppedMetrics(md pmetric.Metrics, decisions *ruleDecisions) {
+	if !decisions.hasDrops() {
+		return
+	}
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		sms := rms.At(i).ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			sms.At(j).Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				return decisions.get(metric).sampling == expression.SamplingDrop
+			})
+		}
+	}
+}
@@ -0,0 +1,622 @@
+// This file contains the construction of the WASM runtime shared by
+// the stub and fullwasm processor implementations
+
+package processor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/bundle"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/download"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/registry"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/remote"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/replay"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/rules"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/sidecar"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/triton"
+)
+
+// NewRuntimeFromConfig creates a WASM runtime with the models configured in config.
+// Models configured with a sidecar, an inference server or rules are served by them.
+// It is exported for tooling such as the replay command.
+func NewRuntimeFromConfig(logger *zap.Logger, config *Config) (*runtime.WasmRuntime, error) {
+	wasmRuntime, _, err := newRuntimeFromConfig(logger, config)
+	return wasmRuntime, err
+}
+
+// newRuntimeFromConfig creates the runtime of NewRuntimeFromConfig and
+// returns the provenance of its models
+func newRuntimeFromConfig(logger *zap.Logger, config *Config) (*runtime.WasmRuntime, *modelProvenances, error) {
+	paths, exports, provenances, err := resolveModelPaths(logger, &config.Models)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Models served by other backends are not loaded as WASM, unless they
+	// fall back to it
+	models := [3]ModelConfig{config.Models.ErrorClassifier, config.Models.ImportanceSampler, config.Models.EntityExtractor}
+	wasmPaths := paths
+	for i, model := range models {
+		if model.external() && !model.Remote.Fallback {
+			wasmPaths[i] = ""
+		}
+	}
+
+	sandboxes, err := modelSandboxes(&config.Models)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
+		ErrorClassifierPath:    wasmPaths[0],
+		ErrorClassifierMemory:  config.Models.ErrorClassifier.MemoryLimitMB,
+		SamplerPath:            wasmPaths[1],
+		SamplerMemory:          config.Models.ImportanceSampler.MemoryLimitMB,
+		EntityExtractorPath:    wasmPaths[2],
+		EntityExtractorMemory:  config.Models.EntityExtractor.MemoryLimitMB,
+		EnableModelCaching:     config.Processing.ModelCacheResults,
+		ModelCacheSize:         config.Processing.ModelResultsCacheSize,
+		ModelCacheTenants:      config.Processing.ModelCacheTenants,
+		CacheKeys:              cacheKeys(&config.Models),
+		CompiledModuleCacheDir: config.Models.CompiledCacheDir,
+		Engine:                 engineConfig(&config.Models.Engine),
+		InputLimits:            inputLimits(&config.Models),
+		ABIs: map[string]string{
+			runtime.ModelErrorClassifier: config.Models.ErrorClassifier.ABI,
+			runtime.ModelSampler:         config.Models.ImportanceSampler.ABI,
+			runtime.ModelEntityExtractor: config.Models.EntityExtractor.ABI,
+		},
+		Fuel:      fuelBudgets(&config.Models),
+		Sandboxes: sandboxes,
+		Instances: map[string]int{
+			runtime.ModelErrorClassifier: config.Models.ErrorClassifier.Instances,
+			runtime.ModelSampler:         config.Models.ImportanceSampler.Instances,
+			runtime.ModelEntityExtractor: config.Models.EntityExtractor.Instances,
+		},
+		Exports:                  exports,
+		OutputRules:              outputRules(&config.Models),
+		InferenceThreads:         config.Processing.InferenceThreads,
+		MaxConcurrentInvocations: config.Processing.Concurrency,
+		Timeouts:                 modelTimeouts(&config.Models),
+		CircuitBreakers:          circuitBreakers(&config.Models),
+		Calibrations:             calibrations(&config.Models),
+		NegativeCaches:           negativeCaches(&config.Models),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := [3]string{runtime.ModelErrorClassifier, runtime.ModelSampler, runtime.ModelEntityExtractor}
+	for i, model := range models {
+		if !model.external() {
+			continue
+		}
+		kind, backend, err := newModelBackend(logger, names[i], paths[i], &model)
+		if err != nil {
+			wasmRuntime.Close()
+			return nil, nil, fmt.Errorf("failed to start %s backend: %w", names[i], err)
+		}
+		wasmRuntime.SetBackend(names[i], kind, backend)
+		if model.Remote.Endpoint != "" && model.Remote.Fallback {
+			wasmRuntime.SetFallback(names[i])
+		}
+	}
+
+	// Rules answer the inputs they match before any backend
+	for i, model := range models {
+		if model.Rules.Path == "" || !model.Rules.Prefilter {
+			continue
+		}
+		classifier, err := rules.Load(model.Rules.Path)
+		if err != nil {
+			wasmRuntime.Close()
+			return nil, nil, fmt.Errorf("failed to load %s rules: %w", names[i], err)
+		}
+		wasmRuntime.SetPrefilter(names[i], classifier)
+		logger.Info("Using rules before model", zap.String("model", names[i]), zap.String("path", model.Rules.Path))
+	}
+
+	return wasmRuntime, newModelProvenances(provenances), nil
+}
+
+// engineConfig returns the runtime's settings of the WASM engine
+func engineConfig(engine *WasmEngineConfig) runtime.EngineConfig {
+	return runtime.EngineConfig{
+		Runtime:     engine.Runtime,
+		Compiler:    engine.Compiler,
+		Engine:      engine.Engine,
+		CPUFeatures: engine.CPUFeatures,
+	}
+}
+
+// external reports whether the model is served by a backend other than WASM
+func (c *ModelConfig) external() bool {
+	switch c.Backend {
+	case runtime.BackendWasm:
+		return false
+	case runtime.BackendONNX:
+		return true
+	}
+	return len(c.Sidecar.Command) > 0 || c.Sidecar.Socket != "" || c.Triton.Endpoint != "" || c.Remote.Endpoint != "" ||
+		(c.Rules.Path != "" && !c.Rules.Prefilter)
+}
+
+// newModelBackend creates the backend serving a model outside WASM and
+// returns its kind
+func newModelBackend(logger *zap.Logger, name string, path string, model *ModelConfig) (string, runtime.ModelBackend, error) {
+	if model.Backend == runtime.BackendONNX {
+		backend, err := newONNXBackend(name, path, model)
+		if err == nil {
+			logger.Info("Using ONNX Runtime for model", zap.String("model", name), zap.String("path", path))
+		}
+		return runtime.BackendONNX, backend, err
+	}
+	if model.Triton.Endpoint != "" {
+		backend, err := newTritonBackend(logger, name, model)
+		return runtime.BackendTriton, backend, err
+	}
+	if model.Rules.Path != "" && !model.Rules.Prefilter {
+		backend, err := rules.Load(model.Rules.Path)
+		if err == nil {
+			logger.Info("Using rules for model", zap.String("model", name), zap.String("path", model.Rules.Path))
+		}
+		return runtime.BackendRules, backend, err
+	}
+	if model.Remote.Endpoint != "" {
+		backend, err := remote.NewClient(remote.Config{
+			Endpoint: model.Remote.Endpoint,
+			Method:   model.Remote.Method,
+			Headers:  headerValues(model.Remote.Headers),
+			Timeout:  time.Duration(model.TimeoutMs) * time.Millisecond,
+		})
+		if err == nil {
+			logger.Info("Using remote inference for model", zap.String("model", name), zap.String("endpoint", model.Remote.Endpoint))
+		}
+		return runtime.BackendRemote, backend, err
+	}
+	backend, err := startSidecar(logger, name, path, model)
+	return runtime.BackendSidecar, backend, err
+}
+
+// onnxOutputKeys are the default output keys of ONNX models, those of the
+// models' main outputs
+var onnxOutputKeys = map[string]string{
+	runtime.ModelErrorClassifier: "error_type",
+	runtime.ModelSampler:         "importance",
+	runtime.ModelEntityExtractor: "service",
+}
+
+// newONNXBackend loads the ONNX model at path
+func newONNXBackend(name string, path string, model *ModelConfig) (runtime.ModelBackend, error) {
+	outputKey := model.ONNX.OutputKey
+	if outputKey == "" {
+		outputKey = onnxOutputKeys[name]
+	}
+	return runtime.NewONNXBackend(runtime.ONNXConfig{
+		Path:        path,
+		LibraryPath: model.ONNX.LibraryPath,
+		InputName:   model.ONNX.InputName,
+		OutputName:  model.ONNX.OutputName,
+		Features:    model.ONNX.Features,
+		Labels:      model.ONNX.Labels,
+		OutputKey:   outputKey,
+	})
+}
+
+// newTritonBackend creates a batching inference server client. The server
+// model defaults to the processor's model name.
+func newTritonBackend(logger *zap.Logger, name string, model *ModelConfig) (*triton.Client, error) {
+	serverModel := model.Triton.Model
+	if serverModel == "" {
+		serverModel = name
+	}
+
+	client, err := triton.NewClient(triton.Config{
+		Endpoint:             model.Triton.Endpoint,
+		Model:                serverModel,
+		Version:              model.Triton.Version,
+		InputName:            model.Triton.InputName,
+		OutputName:           model.Triton.OutputName,
+		Headers:              headerValues(model.Triton.Headers),
+		MaxBatchSize:         model.Triton.MaxBatchSize,
+		MaxBatchDelay:        time.Duration(model.Triton.MaxBatchDelayMs) * time.Millisecond,
+		MaxConcurrentBatches: model.Triton.MaxConcurrentBatches,
+		Timeout:              time.Duration(model.TimeoutMs) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The server may still be loading the model, so readiness is only logged
+	if err := client.Ready(context.Background()); err != nil {
+		logger.Warn("Inference server model is not ready", zap.String("model", serverModel), zap.Error(err))
+	} else {
+		logger.Info("Using inference server for model", zap.String("model", name), zap.String("endpoint", model.Triton.Endpoint))
+	}
+
+	return client, nil
+}
+
+// headerValues returns the values of configured headers, which are opaque
+// so they're redacted wherever the configuration is printed or reported
+func headerValues(headers map[string]configopaque.String) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	values := make(map[string]string, len(headers))
+	for k, v := range headers {
+		values[k] = string(v)
+	}
+	return values
+}
+
+// startSidecar starts the sidecar serving a model. The model path, if any,
+// is passed to the sidecar in the AI_MODEL_PATH environment variable.
+func startSidecar(logger *zap.Logger, name string, path string, model *ModelConfig) (*sidecar.Sidecar, error) {
+	env := make([]string, 0, len(model.Sidecar.Env)+1)
+	for k, v := range model.Sidecar.Env {
+		env = append(env, k+"="+v)
+	}
+	if path != "" {
+		env = append(env, "AI_MODEL_PATH="+path)
+	}
+
+	return sidecar.Start(logger, sidecar.Config{
+		Model:          name,
+		Command:        model.Sidecar.Command,
+		Env:            env,
+		Socket:         model.Sidecar.Socket,
+		Timeout:        time.Duration(model.TimeoutMs) * time.Millisecond,
+		StartTimeout:   time.Duration(model.Sidecar.StartTimeoutMs) * time.Millisecond,
+		HealthInterval: time.Duration(model.Sidecar.HealthIntervalMs) * time.Millisecond,
+	})
+}
+
+// resolveModelPaths returns the local paths of the error classifier, sampler
+// and entity extractor models, pulling registry references on demand and
+// extracting the model bundle, the exports the bundle expects of each model
+// and the provenance of each model
+func resolveModelPaths(logger *zap.Logger, models *ModelsConfig) ([3]string, map[string][]string, [3]*modelProvenance, error) {
+	var paths [3]string
+	var provenances [3]*modelProvenance
+	var client *registry.Client
+	var downloads *download.Client
+
+	modelBundle, err := openModelBundle(logger, models)
+	if err != nil {
+		return paths, nil, provenances, err
+	}
+	exports := make(map[string][]string)
+
+	for i, named := range models.named() {
+		model := named.config
+		if model.Ref == "" {
+			paths[i] = model.Path
+
+			// Models in the bundle replace the ones at their paths
+			if bundled, ok := modelBundle.Models[named.key]; ok {
+				paths[i] = modelBundle.Path(named.key)
+				exports[named.name] = bundled.Exports
+				provenances[i] = newModelProvenance(modelFileName(bundled.File), modelBundle.Version, paths[i])
+				continue
+			}
+
+			if download.IsURI(model.Path) {
+				if downloads == nil {
+					downloads = newDownloadClient(&models.Download)
+				}
+				path, digest, err := downloads.Fetch(context.Background(), model.Path, model.SHA256)
+				if err != nil {
+					return paths, nil, provenances, fmt.Errorf("failed to download model: %w", err)
+				}
+				logger.Info("Downloaded model", zap.String("uri", model.Path), zap.String("path", path), zap.String("sha256", digest))
+				paths[i] = path
+			}
+			if model.Path != "" {
+				provenances[i] = newModelProvenance(modelFileName(model.Path), model.Version, paths[i])
+			}
+			continue
+		}
+
+		// Create the client lazily so configurations without refs never need a registry
+		if client == nil {
+			var err error
+			client, err = registry.NewClient(registry.Config{
+				Endpoint: models.Registry.Endpoint,
+				CacheDir: models.Registry.CacheDir,
+				Headers:  headerValues(models.Registry.Headers),
+				Timeout:  time.Duration(models.Registry.TimeoutMs) * time.Millisecond,
+			})
+			if err != nil {
+				return paths, nil, provenances, fmt.Errorf("failed to create model registry client: %w", err)
+			}
+		}
+
+		path, err := client.PullRef(context.Background(), model.Ref)
+		if err != nil {
+			return paths, nil, provenances, fmt.Errorf("failed to pull model %s: %w", model.Ref, err)
+		}
+		logger.Info("Pulled model from registry", zap.String("ref", model.Ref), zap.String("path", path))
+		paths[i] = path
+
+		// Refs without a version pull the latest, whose version is only
+		// known if configured
+		name, version, _ := registry.ParseRef(model.Ref)
+		if version == "" {
+			version = model.Version
+		}
+		provenances[i] = newModelProvenance(name, version, path)
+	}
+
+	return paths, exports, provenances, nil
+}
+
+// openModelBundle extracts the model bundle of models and checks that it
+// only holds models known by their configuration keys. It returns an empty
+// bundle if none is configured.
+func openModelBundle(logger *zap.Logger, models *ModelsConfig) (*bundle.Bundle, error) {
+	config := &models.Bundle
+	if config.Path == "" {
+		return &bundle.Bundle{}, nil
+	}
+	modelBundle, err := bundle.Extract(config.Path, config.ExtractDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open model bundle %s: %w", config.Path, err)
+	}
+	known := make(map[string]bool)
+	for _, model := range models.named() {
+		known[model.key] = true
+	}
+	for name := range modelBundle.Models {
+		if !known[name] {
+			return nil, fmt.Errorf("model bundle %s holds unknown model %q", config.Path, name)
+		}
+	}
+	logger.Info("Loaded model bundle", zap.String("path", config.Path),
+		zap.String("version", modelBundle.Version), zap.String("dir", modelBundle.Dir))
+	return modelBundle, nil
+}
+
+// inputLimits returns the input limits of the models that have any
+func inputLimits(models *ModelsConfig) map[string]runtime.InputLimits {
+	limits := make(map[string]runtime.InputLimits)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		projection := &model.Projection
+		if model.MaxInputBytes <= 0 && len(projection.Fields) == 0 && projection.MaxAttributes <= 0 &&
+			projection.MaxEvents <= 0 && projection.MaxStacktraceLength <= 0 {
+			continue
+		}
+		limits[name] = runtime.InputLimits{
+			Fields:              projection.Fields,
+			MaxAttributes:       projection.MaxAttributes,
+			PriorityAttributes:  projection.PriorityAttributes,
+			MaxInputBytes:       model.MaxInputBytes,
+			MaxEvents:           projection.MaxEvents,
+			MaxStacktraceLength: projection.MaxStacktraceLength,
+		}
+	}
+	return limits
+}
+
+// cacheKeys returns the cache keys of the models that select fields
+func cacheKeys(models *ModelsConfig) map[string]runtime.CacheKey {
+	keys := make(map[string]runtime.CacheKey)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		if len(model.CacheKey.Fields) > 0 || len(model.CacheKey.Templates) > 0 {
+			keys[name] = runtime.CacheKey{
+				Fields:    model.CacheKey.Fields,
+				Templates: model.CacheKey.Templates,
+			}
+		}
+	}
+	return keys
+}
+
+// outputRules returns the post-processing rules of the models that have any
+func outputRules(models *ModelsConfig) map[string]runtime.OutputRules {
+	rules := make(map[string]runtime.OutputRules)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		config := &model.PostProcess
+		if len(config.Rename) == 0 && len(config.Keys) == 0 && len(config.Categories) == 0 &&
+			len(config.Ranges) == 0 && len(config.Precision) == 0 {
+			continue
+		}
+		modelRules := runtime.OutputRules{
+			Rename:    config.Rename,
+			Keys:      config.Keys,
+			Precision: config.Precision,
+		}
+		if len(config.Categories) > 0 {
+			modelRules.Categories = make(map[string]runtime.Categories, len(config.Categories))
+			for key, categories := range config.Categories {
+				modelRules.Categories[key] = runtime.Categories{
+					Values:  categories.Values,
+					Aliases: categories.Aliases,
+					Default: categories.Default,
+				}
+			}
+		}
+		if len(config.Ranges) > 0 {
+			modelRules.Ranges = make(map[string]runtime.Range, len(config.Ranges))
+			for key, r := range config.Ranges {
+				modelRules.Ranges[key] = runtime.Range{Min: r.Min, Max: r.Max}
+			}
+		}
+		rules[name] = modelRules
+	}
+	return rules
+}
+
+// Calibration methods
+const (
+	calibrationLinear    = "linear"
+	calibrationPiecewise = "piecewise"
+)
+
+// calibrations returns the score calibrations of the models that have one
+func calibrations(models *ModelsConfig) map[string]runtime.Calibration {
+	calibrations := make(map[string]runtime.Calibration)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		config := &model.Calibration
+		calibration := runtime.Calibration{Key: config.Key}
+		switch config.Method {
+		case calibrationLinear:
+			calibration.Points = []runtime.CalibrationPoint{{Raw: config.Min, Score: 0}, {Raw: config.Max, Score: 1}}
+		case calibrationPiecewise:
+			for _, point := range config.Points {
+				calibration.Points = append(calibration.Points, runtime.CalibrationPoint{Raw: point.Raw, Score: point.Score})
+			}
+		default:
+			continue
+		}
+		calibrations[name] = calibration
+	}
+	return calibrations
+}
+
+// fuelBudgets returns the fuel budgets of the WASM models that have one
+func fuelBudgets(models *ModelsConfig) map[string]uint64 {
+	budgets := make(map[string]uint64)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		if model.Fuel > 0 && !model.external() {
+			budgets[name] = model.Fuel
+		}
+	}
+	return budgets
+}
+
+// modelTimeouts returns the invocation timeouts of the models that have one
+func modelTimeouts(models *ModelsConfig) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		if model.TimeoutMs > 0 {
+			timeouts[name] = time.Duration(model.TimeoutMs) * time.Millisecond
+		}
+	}
+	return timeouts
+}
+
+// circuitBreakers returns the circuit breakers of the models that have one
+func circuitBreakers(models *ModelsConfig) map[string]runtime.CircuitBreakerConfig {
+	breakers := make(map[string]runtime.CircuitBreakerConfig)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		if model.CircuitBreaker.FailureThreshold > 0 {
+			breakers[name] = runtime.CircuitBreakerConfig{
+				FailureThreshold: model.CircuitBreaker.FailureThreshold,
+				CoolDown:         time.Duration(model.CircuitBreaker.CoolDownMs) * time.Millisecond,
+				RecoveryProbes:   model.CircuitBreaker.RecoveryProbes,
+				Fallback:         model.CircuitBreaker.Fallback,
+			}
+		}
+	}
+	return breakers
+}
+
+// negativeCaches returns the negative caches of the models that have one
+func negativeCaches(models *ModelsConfig) map[string]runtime.NegativeCacheConfig {
+	caches := make(map[string]runtime.NegativeCacheConfig)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		if model.NegativeCache.MaxEntries > 0 {
+			caches[name] = runtime.NegativeCacheConfig{
+				MaxEntries:     model.NegativeCache.MaxEntries,
+				InitialBackoff: time.Duration(model.NegativeCache.InitialBackoffMs) * time.Millisecond,
+				MaxBackoff:     time.Duration(model.NegativeCache.MaxBackoffMs) * time.Millisecond,
+				Jitter:         model.NegativeCache.Jitter,
+			}
+		}
+	}
+	return caches
+}
+
+// modelSandboxes returns the sandboxes of the models
+func modelSandboxes(models *ModelsConfig) (map[string]runtime.Sandbox, error) {
+	sandboxes := make(map[string]runtime.Sandbox)
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+		config := &model.Sandbox
+		sandbox := runtime.Sandbox{
+			Directories:    config.Directories,
+			RandomSeed:     config.RandomSeed,
+			AllowedImports: config.AllowedImports,
+		}
+		switch config.Clock {
+		case "", "host":
+		case "frozen":
+			sandbox.FrozenClock = true
+		default:
+			return nil, fmt.Errorf("unknown sandbox clock %q for model %s", config.Clock, name)
+		}
+		switch config.Random {
+		case "", "host":
+		case "deterministic":
+			sandbox.DeterministicRandom = true
+		default:
+			return nil, fmt.Errorf("unknown sandbox random %q for model %s", config.Random, name)
+		}
+		sandboxes[name] = sandbox
+	}
+	return sandboxes, nil
+}
+
+// newWasmRuntime creates the WASM runtime for a processor and attaches
+// the invocation recorder if recording is enabled and the evaluator of the
+// shadow models if any is configured, which it returns too
+func newWasmRuntime(logger *zap.Logger, config *Config) (*runtime.WasmRuntime, *shadowEvaluator, *modelProvenances, error) {
+	wasmRuntime, provenances, err := newRuntimeFromConfig(logger, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var recorders invocationRecorders
+	if config.Recording.Enabled {
+		recorder, err := replay.OpenRecorder(replay.RecorderConfig{
+			Path:       config.Recording.Path,
+			SampleRate: config.Recording.SampleRate,
+			MaxRecords: config.Recording.MaxRecords,
+			RedactKeys: config.Recording.RedactKeys,
+		})
+		if err != nil {
+			wasmRuntime.Close()
+			return nil, nil, nil, fmt.Errorf("failed to open model recorder: %w", err)
+		}
+		recorders = append(recorders, recorder)
+
+		logger.Info("Recording model invocations for replay",
+			zap.String("path", config.Recording.Path),
+			zap.Float64("sample_rate", config.Recording.SampleRate))
+	}
+
+	shadow, err := newShadowEvaluator(logger, config)
+	if err != nil {
+		recorders.Close()
+		wasmRuntime.Close()
+		return nil, nil, nil, err
+	}
+	if shadow != nil {
+		recorders = append(recorders, shadow)
+	}
+
+	// The runtime closes its recorders
+	switch len(recorders) {
+	case 0:
+	case 1:
+		wasmRuntime.SetRecorder(recorders[0])
+	default:
+		wasmRuntime.SetRecorder(recorders)
+	}
+	return wasmRuntime, shadow, provenances, nil
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"archive/tar"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestResolveModelPathsFromBundle(t *testing.T) {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for name, content := range map[string]string{
+		"manifest.yaml":    "version: 2.0.0\nmodels:\n  importance_sampler: {file: sampler.wasm.zst, exports: [sample_telemetry]}\n",
+		"sampler.wasm.zst": "model",
+	} {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "models.tar")
+	require.NoError(t, os.WriteFile(path, archive.Bytes(), 0o644))
+
+	config := CreateDefaultConfig().(*Config)
+	config.Models.Bundle = BundleConfig{Path: path, ExtractDir: filepath.Join(dir, "bundles")}
+
+	paths, exports, provenances, err := resolveModelPaths(zap.NewNop(), &config.Models)
+	require.NoError(t, err)
+	assert.Equal(t, config.Models.ErrorClassifier.Path, paths[0], "models outside the bundle keep their path")
+	assert.Equal(t, filepath.Join(dir, "bundles"), filepath.Dir(filepath.Dir(paths[1])))
+	assert.Equal(t, "sampler.wasm.zst", filepath.Base(paths[1]))
+	assert.Equal(t, map[string][]string{runtime.ModelSampler: {"sample_telemetry"}}, exports)
+	assert.Equal(t, "sampler", provenances[1].name)
+	assert.Equal(t, "2.0.0", provenances[1].version, "bundled models have the version of the bundle")
+	assert.Len(t, provenances[1].hash, 64)
+
+	// Bundles may only hold the models of the processor
+	archive.Reset()
+	writer = tar.NewWriter(&archive)
+	manifest := "version: 2.0.1\nmodels:\n  classifier: {file: manifest.yaml}\n"
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "manifest.yaml", Mode: 0o644, Size: int64(len(manifest))}))
+	_, err = writer.Write([]byte(manifest))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, os.WriteFile(path, archive.Bytes(), 0o644))
+	_, _, _, err = resolveModelPaths(zap.NewNop(), &config.Models)
+	assert.ErrorContains(t, err, `unknown model "classifier"`)
+}
+
+func TestResolveModelPathsDownloadsModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("model"))
+	}))
+	defer server.Close()
+
+	config := CreateDefaultConfig().(*Config)
+	config.Models.Download.CacheDir = t.TempDir()
+	config.Models.ErrorClassifier.Path = server.URL + "/error-classifier.wasm"
+	config.Models.ImportanceSampler.Path = server.URL + "/sampler.wasm"
+	config.Models.ImportanceSampler.SHA256 = strings.Repeat("0", 64)
+
+	_, _, _, err := resolveModelPaths(zap.NewNop(), &config.Models)
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	config.Models.ImportanceSampler = ModelConfig{Path: "/models/importance-sampler.wasm"}
+	paths, _, _, err := resolveModelPaths(zap.NewNop(), &config.Models)
+	require.NoError(t, err)
+	assert.Equal(t, config.Models.Download.CacheDir, filepath.Dir(filepath.Dir(paths[0])))
+	data, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	assert.Equal(t, "model", string(data))
+	assert.Equal(t, "/models/importance-sampler.wasm", paths[1])
+}
+
+func TestCalibrationsOfModels(t *testing.T) {
+	models := &ModelsConfig{
+		ImportanceSampler: ModelConfig{Calibration: CalibrationConfig{Method: calibrationLinear, Min: -5, Max: 5}},
+		ErrorClassifier: ModelConfig{Calibration: CalibrationConfig{
+			Method: calibrationPiecewise,
+			Key:    "confidence",
+			Points: []CalibrationPointConfig{{Raw: 0, Score: 0}, {Raw: 80, Score: 0.5}, {Raw: 100, Score: 1}},
+		}},
+	}
+
+	assert.Equal(t, map[string]runtime.Calibration{
+		runtime.ModelSampler: {Points: []runtime.CalibrationPoint{{Raw: -5, Score: 0}, {Raw: 5, Score: 1}}},
+		runtime.ModelErrorClassifier: {Key: "confidence", Points: []runtime.CalibrationPoint{
+			{Raw: 0, Score: 0}, {Raw: 80, Score: 0.5}, {Raw: 100, Score: 1},
+		}},
+	}, calibrations(models))
+}
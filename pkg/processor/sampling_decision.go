@@ -0,0 +1,92 @@
+// This file contains the sampling decisions of traces and logs and the
+// metadata recording them on kept items
+
+package processor
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// Attributes written on kept items with output.include_sampling_metadata,
+// under the output namespace
+const (
+	samplingReasonAttribute     = "sampling.reason"
+	samplingImportanceAttribute = "sampling.importance"
+)
+
+// Reasons of sampling decisions not made by the sampler model
+const (
+	// samplingReasonRule is a decision forced by rules
+	samplingReasonRule = "rule"
+
+	// samplingReasonError and samplingReasonSlow are the decisions of the
+	// error and slow trace tiers
+	samplingReasonError = "error"
+	samplingReasonSlow  = "slow"
+
+	// samplingReasonSeverity is the decision of a log severity whose rate is
+	// 1.0 or 0.0, or of an error log always kept
+	samplingReasonSeverity = "severity"
+
+	// samplingReasonRate is a decision at the plain rate, when rules skip the
+	// sampler model or it fails
+	samplingReasonRate = "rate"
+
+	// samplingReasonTrace is the decision to keep a span of a trace whose
+	// earlier spans were kept, remembered by the decision cache
+	samplingReasonTrace = "trace"
+
+	// samplingReasonImportance is a decision weighted by the sampler model's
+	// importance, when its result has no reason
+	samplingReasonImportance = "importance"
+)
+
+// samplingDecision is the outcome of sampling a trace or log
+type samplingDecision struct {
+	keep   bool
+	reason string
+
+	// importance is the sampler model's importance, if it gave one
+	importance    float64
+	hasImportance bool
+}
+
+// modelSamplingDecision returns the decision to keep an item at rate
+// weighted by the result of the sampler model, sample deciding at a rate
+func modelSamplingDecision(result map[string]interface{}, rate float64, sample func(rate float64) bool) samplingDecision {
+	importance, ok := result["importance"].(float64)
+	if !ok {
+		return samplingDecision{keep: sample(rate), reason: samplingReasonRate}
+	}
+
+	// Higher importance means higher chance of keeping the item
+	decision := samplingDecision{
+		keep:          sample(rate * importance),
+		reason:        samplingReasonImportance,
+		importance:    importance,
+		hasImportance: true,
+	}
+	if reason, ok := result["reason"].(string); ok && reason != "" {
+		decision.reason = reason
+	}
+	return decision
+}
+
+// sampled reports whether the decision was made at a rate, weighted or not
+// by the sampler model, rather than forced by rules, tiers or the decision
+// cache
+func (d samplingDecision) sampled() bool {
+	switch d.reason {
+	case samplingReasonRule, samplingReasonError, samplingReasonSlow, samplingReasonSeverity, samplingReasonTrace:
+		return false
+	}
+	return true
+}
+
+// annotate records the reason and importance of the decision in attributes
+func (d samplingDecision) annotate(attributes pcommon.Map, namespace string) {
+	attributes.PutStr(namespace+samplingReasonAttribute, d.reason)
+	if d.hasImportance {
+		attributes.PutDouble(namespace+samplingImportanceAttribute, d.importance)
+	}
+}
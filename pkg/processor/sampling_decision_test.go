@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestModelSamplingDecisionRecordsImportanceAndReason(t *testing.T) {
+	var rates []float64
+	sample := func(rate float64) bool {
+		rates = append(rates, rate)
+		return true
+	}
+
+	decision := modelSamplingDecision(map[string]interface{}{"importance": 0.5, "reason": "checkout_path"}, 0.2, sample)
+	assert.Equal(t, samplingDecision{keep: true, reason: "checkout_path", importance: 0.5, hasImportance: true}, decision)
+
+	decision = modelSamplingDecision(map[string]interface{}{"importance": 0.5}, 0.2, sample)
+	assert.Equal(t, samplingReasonImportance, decision.reason)
+
+	decision = modelSamplingDecision(map[string]interface{}{}, 0.2, sample)
+	assert.Equal(t, samplingDecision{keep: true, reason: samplingReasonRate}, decision)
+	assert.Equal(t, []float64{0.1, 0.1, 0.2}, rates)
+
+	attributes := pcommon.NewMap()
+	samplingDecision{keep: true, reason: "checkout_path", importance: 0.5, hasImportance: true}.annotate(attributes, "ai.")
+	assert.Equal(t, map[string]interface{}{"ai.sampling.reason": "checkout_path", "ai.sampling.importance": 0.5}, attributes.AsRaw())
+}
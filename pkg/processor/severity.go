@@ -0,0 +1,63 @@
+// This file contains the rewriting of log severities and the span status
+// hints derived from the severity the error classifier gives an item
+
+package processor
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Attributes written by severity rewriting, under the output namespace
+const (
+	originalSeverityAttribute = "original_severity"
+	statusHintAttribute       = "status_hint"
+)
+
+// statusHints are the span status hints the classified severities can map to
+var statusHints = map[string]bool{"unset": true, "ok": true, "error": true}
+
+// classifiedSeverity returns the severity in a result of the error
+// classifier, lowercased, or "" if it has none
+func classifiedSeverity(result map[string]interface{}) string {
+	severity, _ := result["severity"].(string)
+	return strings.ToLower(severity)
+}
+
+// rewriteLog sets the severity of a log to the one its classified severity
+// maps to, recording the severity it replaces. It does nothing unless
+// mutation is allowed.
+func (c *SeverityConfig) rewriteLog(log plog.LogRecord, result map[string]interface{}, namespace string) {
+	if !c.AllowMutation {
+		return
+	}
+	target, ok := c.Logs[classifiedSeverity(result)]
+	if !ok {
+		return
+	}
+	number := severityNumbers[strings.ToLower(target)]
+	if number == log.SeverityNumber() {
+		return
+	}
+
+	original := log.SeverityText()
+	if original == "" {
+		original = log.SeverityNumber().String()
+	}
+	log.Attributes().PutStr(namespace+originalSeverityAttribute, original)
+	log.SetSeverityNumber(number)
+	log.SetSeverityText(strings.ToUpper(target))
+}
+
+// hintSpan sets the status hint its classified severity maps to on a span.
+// It does nothing unless mutation is allowed.
+func (c *SeverityConfig) hintSpan(span ptrace.Span, result map[string]interface{}, namespace string) {
+	if !c.AllowMutation {
+		return
+	}
+	if hint, ok := c.Spans[classifiedSeverity(result)]; ok {
+		span.Attributes().PutStr(namespace+statusHintAttribute, strings.ToLower(hint))
+	}
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestSeverityRewritesLogsAndHintsSpans(t *testing.T) {
+	config := &SeverityConfig{
+		Logs:  map[string]string{"low": "warn", "critical": "fatal"},
+		Spans: map[string]string{"low": "ok"},
+	}
+	low := map[string]interface{}{"category": "timeout", "severity": "LOW"}
+
+	// Nothing changes unless mutation is allowed
+	log := plog.NewLogRecord()
+	log.SetSeverityNumber(plog.SeverityNumberError)
+	log.SetSeverityText("ERROR")
+	span := ptrace.NewSpan()
+	config.rewriteLog(log, low, "ai.")
+	config.hintSpan(span, low, "ai.")
+	assert.Equal(t, plog.SeverityNumberError, log.SeverityNumber())
+	assert.Equal(t, 0, span.Attributes().Len())
+
+	config.AllowMutation = true
+	config.rewriteLog(log, low, "ai.")
+	config.hintSpan(span, low, "ai.")
+	assert.Equal(t, plog.SeverityNumberWarn, log.SeverityNumber())
+	assert.Equal(t, "WARN", log.SeverityText())
+	original, _ := log.Attributes().Get("ai.original_severity")
+	assert.Equal(t, "ERROR", original.Str())
+	hint, _ := span.Attributes().Get("ai.status_hint")
+	assert.Equal(t, "ok", hint.Str())
+
+	// Severities without a mapping are left alone
+	log = plog.NewLogRecord()
+	log.SetSeverityNumber(plog.SeverityNumberError)
+	config.rewriteLog(log, map[string]interface{}{"severity": "medium"}, "ai.")
+	assert.Equal(t, plog.SeverityNumberError, log.SeverityNumber())
+	assert.Equal(t, 0, log.Attributes().Len())
+	config.rewriteLog(log, map[string]interface{}{"severity": "critical"}, "ai.")
+	assert.Equal(t, plog.SeverityNumberFatal, log.SeverityNumber())
+	original, _ = log.Attributes().Get("ai.original_severity")
+	assert.Equal(t, "Error", original.Str())
+}
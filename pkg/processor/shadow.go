@@ -0,0 +1,222 @@
+// This file contains the evaluation of shadow models, candidate models
+// invoked on a sample of the inputs of the production ones to measure how
+// their outputs agree before they are rolled out
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/replay"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// shadowQueueSize bounds the inputs waiting for the shadow models. Inputs
+// sampled while the queue is full are dropped.
+const shadowQueueSize = 1000
+
+// shadowTolerance is the largest difference of numeric outputs considered
+// equal
+const shadowTolerance = 1e-6
+
+// Outcomes of shadow invocations
+const (
+	shadowAgreed    = "agreed"
+	shadowDisagreed = "disagreed"
+	shadowFailed    = "failed"
+	shadowDropped   = "dropped"
+)
+
+var shadowOutcomes = []string{shadowAgreed, shadowDisagreed, shadowFailed, shadowDropped}
+
+// shadowInvocation is an input of a production model and the production
+// model's output, normalized
+type shadowInvocation struct {
+	model  string
+	input  []byte
+	output map[string]interface{}
+}
+
+// shadowEvaluator invokes the shadow models on a sample of the invocations
+// of the production models, in the background, and counts how their outputs
+// agree. It implements runtime.InvocationRecorder to receive the production
+// invocations.
+type shadowEvaluator struct {
+	logger  *zap.Logger
+	runtime *runtime.WasmRuntime
+	models  map[string]bool
+	rate    float64
+	queue   chan shadowInvocation
+	done    sync.WaitGroup
+
+	// mutex guards the queue against invocations recorded while the
+	// evaluator closes
+	mutex  sync.RWMutex
+	closed bool
+
+	// Invocations per model and outcome
+	outcomes map[string]map[string]*atomic.Int64
+}
+
+// newShadowEvaluator loads the shadow models of config and starts invoking
+// them. It returns nil if no model has a shadow.
+func newShadowEvaluator(logger *zap.Logger, config *Config) (*shadowEvaluator, error) {
+	shadow := &config.Models.Shadow
+	models := make(map[string]bool)
+	for _, model := range shadow.named() {
+		models[model.name] = true
+	}
+	if len(models) == 0 || shadow.Rate <= 0 {
+		return nil, nil
+	}
+
+	shadowRuntime, err := NewRuntimeFromConfig(logger.With(zap.String("role", "shadow")), shadowRuntimeConfig(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shadow models: %w", err)
+	}
+
+	evaluator := &shadowEvaluator{
+		logger:   logger,
+		runtime:  shadowRuntime,
+		models:   models,
+		rate:     shadow.Rate,
+		queue:    make(chan shadowInvocation, shadowQueueSize),
+		outcomes: make(map[string]map[string]*atomic.Int64, len(models)),
+	}
+	for model := range models {
+		evaluator.outcomes[model] = make(map[string]*atomic.Int64, len(shadowOutcomes))
+		for _, outcome := range shadowOutcomes {
+			evaluator.outcomes[model][outcome] = &atomic.Int64{}
+		}
+		logger.Info("Evaluating shadow model", zap.String("model", model), zap.Float64("rate", shadow.Rate))
+	}
+
+	evaluator.done.Add(1)
+	go evaluator.run()
+	return evaluator, nil
+}
+
+// shadowRuntimeConfig returns the configuration of the runtime serving the
+// shadow models of config in place of the production ones. Their outputs are
+// compared before post-processing, as they are recorded, and not cached.
+func shadowRuntimeConfig(config *Config) *Config {
+	shadow := *config
+	shadow.Models.ErrorClassifier = config.Models.Shadow.ErrorClassifier
+	shadow.Models.ImportanceSampler = config.Models.Shadow.ImportanceSampler
+	shadow.Models.EntityExtractor = config.Models.Shadow.EntityExtractor
+	for _, model := range shadow.Models.named() {
+		model.config.PostProcess = PostProcessConfig{}
+	}
+	shadow.Models.Shadow = ShadowConfig{}
+	shadow.Models.Bundle = BundleConfig{}
+	shadow.Processing.ModelCacheResults = false
+	return &shadow
+}
+
+// Record implements runtime.InvocationRecorder, queueing a sample of the
+// invocations of the models with a shadow
+func (e *shadowEvaluator) Record(model string, input []byte, output map[string]interface{}) error {
+	if !e.models[model] || rand.Float64() >= e.rate {
+		return nil
+	}
+
+	// The input is reused once Record returns and the output is shared with
+	// the processors, so both are copied
+	normalized, err := replay.Normalize(output)
+	if err != nil {
+		return err
+	}
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.closed {
+		return nil
+	}
+	select {
+	case e.queue <- shadowInvocation{model: model, input: append([]byte(nil), input...), output: normalized}:
+	default:
+		e.outcomes[model][shadowDropped].Add(1)
+	}
+	return nil
+}
+
+// run invokes the shadow models on the queued inputs until the evaluator is
+// closed
+func (e *shadowEvaluator) run() {
+	defer e.done.Done()
+	for invocation := range e.queue {
+		e.outcomes[invocation.model][e.evaluate(invocation)].Add(1)
+	}
+}
+
+// evaluate invokes the shadow of a model on an input and returns the outcome
+func (e *shadowEvaluator) evaluate(invocation shadowInvocation) string {
+	output, err := replay.InvokeEncoded(context.Background(), e.runtime, invocation.model, invocation.input)
+	if err == nil {
+		output, err = replay.Normalize(output)
+	}
+	if err != nil {
+		e.logger.Debug("Shadow model failed", zap.String("model", invocation.model), zap.Error(err))
+		return shadowFailed
+	}
+	if !replay.Agree(invocation.output, output, shadowTolerance) {
+		return shadowDisagreed
+	}
+	return shadowAgreed
+}
+
+// counts calls fn with the number of shadow invocations of each model and
+// outcome
+func (e *shadowEvaluator) counts(fn func(model string, outcome string, count int64)) {
+	if e == nil {
+		return
+	}
+	for model, outcomes := range e.outcomes {
+		for outcome, count := range outcomes {
+			fn(model, outcome, count.Load())
+		}
+	}
+}
+
+// Close implements runtime.InvocationRecorder, evaluating the queued inputs
+// and unloading the shadow models
+func (e *shadowEvaluator) Close() error {
+	e.mutex.Lock()
+	e.closed = true
+	close(e.queue)
+	e.mutex.Unlock()
+	e.done.Wait()
+	return e.runtime.Close()
+}
+
+// invocationRecorders passes the invocations of a runtime to several
+// recorders
+type invocationRecorders []runtime.InvocationRecorder
+
+// Record implements runtime.InvocationRecorder
+func (r invocationRecorders) Record(model string, input []byte, output map[string]interface{}) error {
+	var errs []error
+	for _, recorder := range r {
+		if err := recorder.Record(model, input, output); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close implements runtime.InvocationRecorder
+func (r invocationRecorders) Close() error {
+	var errs []error
+	for _, recorder := range r {
+		if err := recorder.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestShadowEvaluatorCountsAgreement(t *testing.T) {
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(rulesPath, []byte(`
+rules:
+  - name: timeouts
+    match:
+      body: "(?i)timeout"
+    output:
+      category: timeout
+      confidence: 0.9
+default:
+  category: unknown
+`), 0o600))
+
+	config := createDefaultConfig().(*Config)
+	config.Models.Shadow.Rate = 1
+	config.Models.Shadow.ErrorClassifier = ModelConfig{Rules: ModelRulesConfig{Path: rulesPath}}
+	require.NoError(t, config.Validate())
+
+	evaluator, err := newShadowEvaluator(zap.NewNop(), config)
+	require.NoError(t, err)
+	require.NotNil(t, evaluator)
+
+	input := []byte(`{"body":"upstream timeout","attributes":{},"resource":{}}`)
+	require.NoError(t, evaluator.Record(runtime.ModelErrorClassifier, input,
+		map[string]interface{}{"category": "timeout", "confidence": 0.9}))
+	require.NoError(t, evaluator.Record(runtime.ModelErrorClassifier, input,
+		map[string]interface{}{"category": "network", "confidence": 0.9}))
+	// Models without a shadow are not evaluated
+	require.NoError(t, evaluator.Record(runtime.ModelSampler, []byte(`{}`), map[string]interface{}{"keep": true}))
+	require.NoError(t, evaluator.Close())
+
+	counts := make(map[string]int64)
+	evaluator.counts(func(model string, outcome string, count int64) {
+		assert.Equal(t, runtime.ModelErrorClassifier, model)
+		counts[outcome] = count
+	})
+	assert.Equal(t, map[string]int64{shadowAgreed: 1, shadowDisagreed: 1, shadowFailed: 0, shadowDropped: 0}, counts)
+
+	// Without shadow models there is nothing to evaluate
+	config.Models.Shadow.ErrorClassifier = ModelConfig{}
+	evaluator, err = newShadowEvaluator(zap.NewNop(), config)
+	require.NoError(t, err)
+	assert.Nil(t, evaluator)
+}
+
+func TestShadowValidation(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.Models.Shadow.Rate = 2
+	assert.ErrorContains(t, config.Validate(), "models.shadow.rate must be between 0.0 and 1.0")
+
+	// Shadows can't send data to restricted backends
+	config.Models.Shadow.Rate = 0.5
+	config.Models.Shadow.ImportanceSampler = ModelConfig{Remote: RemoteConfig{Endpoint: "http://models:8080"}, TimeoutMs: -1}
+	config.Residency.Enabled = true
+	config.Residency.Restricted = map[string][]string{"eu": {runtime.BackendRemote}}
+	err := config.Validate()
+	assert.ErrorContains(t, err, "models.shadow.importance_sampler uses the remote backend, restricted for eu data")
+	assert.ErrorContains(t, err, "models.shadow.importance_sampler.timeout_ms must not be negative")
+}
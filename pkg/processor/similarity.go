@@ -0,0 +1,190 @@
+// This file contains the down-sampling of traces and logs similar to
+// recently kept ones, by the embeddings of their text
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/embedding"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/remote"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Embedders of similarity sampling
+const (
+	// embedderHashing hashes the words of texts, without a model
+	embedderHashing = "hashing"
+
+	// embedderWasm runs a WASM embedding module
+	embedderWasm = "wasm"
+
+	// embedderRemote calls a remote embedding API
+	embedderRemote = "remote"
+)
+
+// Reasons of the sampling decisions revised by similarity sampling
+const (
+	// samplingReasonNovel is the decision to keep an item unlike any kept
+	// recently
+	samplingReasonNovel = "novel"
+
+	// samplingReasonSimilar is the decision to keep an item similar to one
+	// kept recently, at the similar rate
+	samplingReasonSimilar = "similar"
+)
+
+// Hashing of the embedding indexes: each of the tables compares items on
+// the same side of all of its hyperplanes, which are drawn from the seed so
+// indexes are reproducible
+const (
+	similarityIndexTables = 8
+	similarityIndexBits   = 10
+	similarityIndexSeed   = 0x5eed
+)
+
+// similaritySampler keeps the traces and logs unlike any kept recently and
+// down-samples the others. Each signal has its own index of the embeddings
+// of recently kept items.
+type similaritySampler struct {
+	logger   *zap.Logger
+	embedder embedding.Embedder
+	indexes  map[string]*embedding.Index
+}
+
+// newSimilaritySampler creates the sampler for config, nil unless
+// similarity sampling is enabled
+func newSimilaritySampler(logger *zap.Logger, config *Config) (*similaritySampler, error) {
+	similarity := &config.Sampling.Similarity
+	if !similarity.Enabled {
+		return nil, nil
+	}
+
+	embedder, err := newEmbedder(logger, config)
+	if err != nil {
+		return nil, err
+	}
+	sampler := &similaritySampler{
+		logger:   logger,
+		embedder: embedder,
+		indexes:  make(map[string]*embedding.Index),
+	}
+	for _, signal := range []string{signalTraces, signalLogs} {
+		index, err := embedding.NewIndex(embedding.IndexConfig{
+			Capacity: similarity.MaxItems,
+			Tables:   similarityIndexTables,
+			Bits:     similarityIndexBits,
+			Seed:     similarityIndexSeed,
+		})
+		if err != nil {
+			embedder.Close()
+			return nil, err
+		}
+		sampler.indexes[signal] = index
+	}
+	logger.Info("Enabled similarity sampling", zap.String("embedder", similarity.Embedder))
+	return sampler, nil
+}
+
+// newEmbedder creates the embedder selected by config
+func newEmbedder(logger *zap.Logger, config *Config) (embedding.Embedder, error) {
+	similarity := &config.Sampling.Similarity
+	switch similarity.Embedder {
+	case "", embedderHashing:
+		return embedding.NewHashing(similarity.Dimensions)
+	case embedderWasm:
+		module, err := runtime.NewWasmModule(logger, &runtime.WasmRuntimeConfig{
+			CompiledModuleCacheDir: config.Models.CompiledCacheDir,
+			Engine:                 engineConfig(&config.Models.Engine),
+		}, "embedder", similarity.Path, similarity.Function)
+		if err != nil {
+			return nil, err
+		}
+		return embedding.NewModel(module, similarity.Model), nil
+	case embedderRemote:
+		client, err := remote.NewClient(remote.Config{
+			Endpoint: similarity.Endpoint,
+			Headers:  headerValues(similarity.Headers),
+			Timeout:  time.Duration(similarity.TimeoutMs) * time.Millisecond,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return embedding.NewModel(client, similarity.Model), nil
+	default:
+		return nil, fmt.Errorf("unknown embedder %q", similarity.Embedder)
+	}
+}
+
+// decide revises a decision made at a rate, weighted or not by the sampler
+// model, by the novelty of the item's text. Items unlike any kept recently
+// are kept; items similar to one are kept at the similar rate of the
+// decision, and the decisions of rules and tiers stand.
+func (s *similaritySampler) decide(ctx context.Context, config *SimilaritySamplingConfig, signal string, text string, decision samplingDecision) samplingDecision {
+	if s == nil || !config.Enabled || text == "" || !decision.sampled() || modelsSkipped(ctx) {
+		return decision
+	}
+
+	vector, err := s.embedder.Embed(ctx, text)
+	if errors.Is(err, embedding.ErrEmpty) {
+		return decision
+	}
+	if err != nil {
+		s.logger.Debug("Failed to embed item, keeping its sampling decision", zap.Error(err))
+		return decision
+	}
+	_, novel, err := s.indexes[signal].Observe(vector, config.Threshold)
+	if err != nil {
+		s.logger.Debug("Failed to compare item with kept items", zap.Error(err))
+		return decision
+	}
+
+	if novel {
+		decision.keep = true
+		decision.reason = samplingReasonNovel
+		return decision
+	}
+	if decision.keep {
+		decision.keep = randomSample(config.SimilarRate)
+		decision.reason = samplingReasonSimilar
+	}
+	return decision
+}
+
+// close closes the embedder
+func (s *similaritySampler) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.embedder.Close()
+}
+
+// similarityText returns the text items are compared by: their name or
+// body, with the status message of spans, after the service name of their
+// resource. Items without any have no text.
+func similarityText(resource pcommon.Resource, parts ...string) string {
+	var text strings.Builder
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if text.Len() > 0 {
+			text.WriteByte(' ')
+		}
+		text.WriteString(part)
+	}
+	if text.Len() == 0 {
+		return ""
+	}
+	if service, ok := resource.Attributes().Get("service.name"); ok {
+		return service.AsString() + " " + text.String()
+	}
+	return text.String()
+}
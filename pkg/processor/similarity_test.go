@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+func TestSimilaritySamplerKeepsNovelItems(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.Sampling.Similarity.Enabled = true
+	config.Sampling.Similarity.SimilarRate = 0
+	sampler, err := newSimilaritySampler(zap.NewNop(), config)
+	require.NoError(t, err)
+	defer sampler.close()
+	similarity := &config.Sampling.Similarity
+	ctx := context.Background()
+
+	// Novel items are kept whatever their rate
+	dropped := samplingDecision{keep: false, reason: samplingReasonRate}
+	decision := sampler.decide(ctx, similarity, signalLogs, "payment 4412 declined by issuer", dropped)
+	assert.Equal(t, samplingDecision{keep: true, reason: samplingReasonNovel}, decision)
+
+	// Items similar to a kept one are kept at the similar rate
+	kept := samplingDecision{keep: true, reason: samplingReasonImportance, importance: 0.8, hasImportance: true}
+	decision = sampler.decide(ctx, similarity, signalLogs, "payment 9817 declined by issuer", kept)
+	assert.False(t, decision.keep)
+	assert.Equal(t, samplingReasonSimilar, decision.reason)
+
+	// Each signal compares with its own kept items, and forced decisions stand
+	decision = sampler.decide(ctx, similarity, signalTraces, "payment 9817 declined by issuer", dropped)
+	assert.Equal(t, samplingReasonNovel, decision.reason)
+	forced := samplingDecision{keep: true, reason: samplingReasonError}
+	assert.Equal(t, forced, sampler.decide(ctx, similarity, signalLogs, "payment 1 declined by issuer", forced))
+
+	// Batches past their timeout don't embed
+	assert.Equal(t, dropped, sampler.decide(withoutModels(ctx), similarity, signalLogs, "disk quota exceeded", dropped))
+}
+
+func TestSimilarityTextPrefixesService(t *testing.T) {
+	resource := pcommon.NewResource()
+	assert.Equal(t, "", similarityText(resource, ""))
+	assert.Equal(t, "GET /users not found", similarityText(resource, "GET /users", "not found"))
+
+	resource.Attributes().PutStr("service.name", "api")
+	assert.Equal(t, "api GET /users", similarityText(resource, "GET /users", ""))
+	assert.Equal(t, "", similarityText(resource, ""))
+}
@@ -0,0 +1,146 @@
+// This file contains the buffering of spans by trace across batches used to
+// make one sampling decision per complete trace
+
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+)
+
+// tailBuffer holds the spans of traces until the decision wait of each
+// trace has passed since its first span arrived
+type tailBuffer struct {
+	wait      time.Duration
+	maxTraces int
+
+	mutex  sync.Mutex
+	traces map[pcommon.TraceID]*bufferedTrace
+	order  []*bufferedTrace // in arrival order, which is expiry order
+}
+
+// bufferedTrace is a trace waiting for its sampling decision
+type bufferedTrace struct {
+	arrived time.Time
+	spans   ptrace.Traces
+
+	// skipSampler is set when rules skip the sampler model for every
+	// buffered span
+	skipSampler bool
+}
+
+// newTailBuffer creates a buffer for the tail sampling configuration
+func newTailBuffer(config *TailSamplingConfig) *tailBuffer {
+	return &tailBuffer{
+		wait:      time.Duration(config.DecisionWaitMs) * time.Millisecond,
+		maxTraces: config.MaxTraces,
+		traces:    make(map[pcommon.TraceID]*bufferedTrace),
+	}
+}
+
+// add moves the spans of td into the buffer, except those whose decision
+// rules force: dropped spans are removed and kept spans stay in td, and
+// both are tallied. It returns the oldest traces evicted to stay within
+// maxTraces, which must be decided right away.
+func (b *tailBuffer) add(td ptrace.Traces, decisions *ruleDecisions, tally volumeTally, now time.Time) []*bufferedTrace {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		service := accountingService(rs.Resource())
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			// Spans of a trace in the scope share the buffered scope
+			scopes := make(map[pcommon.TraceID]ptrace.SpanSlice)
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				decision := decisions.get(span)
+				switch decision.sampling {
+				case expression.SamplingKeep:
+					tally.addSpan(service, span, true)
+					return false
+				case expression.SamplingDrop:
+					tally.addSpan(service, span, false)
+					return true
+				}
+
+				trace := b.traces[span.TraceID()]
+				if trace == nil {
+					trace = &bufferedTrace{arrived: now, spans: ptrace.NewTraces(), skipSampler: true}
+					b.traces[span.TraceID()] = trace
+					b.order = append(b.order, trace)
+				}
+				if !decision.skipSampler {
+					trace.skipSampler = false
+				}
+
+				spans, ok := scopes[span.TraceID()]
+				if !ok {
+					buffered := trace.spans.ResourceSpans().AppendEmpty()
+					rs.Resource().CopyTo(buffered.Resource())
+					buffered.SetSchemaUrl(rs.SchemaUrl())
+					scope := buffered.ScopeSpans().AppendEmpty()
+					ss.Scope().CopyTo(scope.Scope())
+					scope.SetSchemaUrl(ss.SchemaUrl())
+					spans = scope.Spans()
+					scopes[span.TraceID()] = spans
+				}
+				span.MoveTo(spans.AppendEmpty())
+				return true
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+
+	var evicted []*bufferedTrace
+	for b.maxTraces > 0 && len(b.traces) > b.maxTraces {
+		evicted = append(evicted, b.pop())
+	}
+	return evicted
+}
+
+// expired removes and returns the traces whose decision wait has passed
+func (b *tailBuffer) expired(now time.Time) []*bufferedTrace {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var expired []*bufferedTrace
+	for len(b.order) > 0 && now.Sub(b.order[0].arrived) >= b.wait {
+		expired = append(expired, b.pop())
+	}
+	return expired
+}
+
+// drain removes and returns all buffered traces
+func (b *tailBuffer) drain() []*bufferedTrace {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var drained []*bufferedTrace
+	for len(b.order) > 0 {
+		drained = append(drained, b.pop())
+	}
+	return drained
+}
+
+// pop removes the oldest trace. The caller holds the mutex.
+func (b *tailBuffer) pop() *bufferedTrace {
+	trace := b.order[0]
+	b.order[0] = nil
+	b.order = b.order[1:]
+
+	id := trace.spans.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).TraceID()
+	delete(b.traces, id)
+	return trace
+}
+
+// summary returns the summary sampling decides the trace by
+func (t *bufferedTrace) summary() *traceSummary {
+	summary := summarizeTraces(t.spans, nil)[0]
+	summary.skipSampler = t.skipSampler
+	return summary
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+)
+
+func TestTailBufferHoldsTracesAcrossBatches(t *testing.T) {
+	buffer := newTailBuffer(&TailSamplingConfig{DecisionWaitMs: 1000, MaxTraces: 2})
+	start := time.Unix(0, 0)
+
+	batch := func(spans ...string) (ptrace.Traces, map[string]ptrace.Span) {
+		td := ptrace.NewTraces()
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("service.name", "checkout")
+		ss := rs.ScopeSpans().AppendEmpty()
+		byName := make(map[string]ptrace.Span)
+		for _, name := range spans {
+			span := ss.Spans().AppendEmpty()
+			span.SetTraceID(pcommon.TraceID([16]byte{name[0]}))
+			span.SetName(name)
+			byName[name] = span
+		}
+		return td, byName
+	}
+
+	// Rules keep and drop spans without buffering them
+	td, spans := batch("a-root", "b-root", "c-ready", "d-health")
+	_, decisions := withRuleDecisions(context.Background())
+	decisions.set(spans["c-ready"], &expression.Result{Sampling: expression.SamplingKeep})
+	decisions.set(spans["d-health"], &expression.Result{Sampling: expression.SamplingDrop})
+	assert.Empty(t, buffer.add(td, decisions, nil, start))
+	require.Equal(t, 1, td.SpanCount())
+	assert.Equal(t, "c-ready", td.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+
+	// Later spans join their trace, new traces evict the oldest
+	td, spans = batch("a-child", "e-root")
+	spans["a-child"].SetParentSpanID(pcommon.SpanID([8]byte{1}))
+	evicted := buffer.add(td, nil, nil, start.Add(500*time.Millisecond))
+	assert.Equal(t, 0, td.SpanCount())
+	require.Len(t, evicted, 1)
+	assert.Equal(t, 2, evicted[0].spans.SpanCount())
+	assert.Equal(t, "a-root", evicted[0].summary().root.Name())
+	service, _ := evicted[0].summary().resource.Attributes().Get("service.name")
+	assert.Equal(t, "checkout", service.Str())
+
+	// Traces are decided once their decision wait has passed
+	assert.Empty(t, buffer.expired(start.Add(999*time.Millisecond)))
+	expired := buffer.expired(start.Add(time.Second))
+	require.Len(t, expired, 1)
+	assert.Equal(t, "b-root", expired[0].summary().root.Name())
+
+	drained := buffer.drain()
+	require.Len(t, drained, 1)
+	assert.Equal(t, "e-root", drained[0].summary().root.Name())
+	assert.Empty(t, buffer.drain())
+}
@@ -0,0 +1,172 @@
+// This file contains the processors' own metrics of the items they process
+// and the models they invoke, reported through the collector's telemetry
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// modelTelemetry records the duration and errors of the model invocations
+// of a runtime
+type modelTelemetry struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+// newModelTelemetry creates the instruments of the model invocations
+func newModelTelemetry(provider metric.MeterProvider) (*modelTelemetry, error) {
+	meter := provider.Meter(meterScope)
+
+	duration, err := meter.Float64Histogram("ai_processor.model.duration",
+		metric.WithDescription("Duration of model invocations not served from the cache"), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1))
+	if err != nil {
+		return nil, err
+	}
+	errorCount, err := meter.Int64Counter("ai_processor.model.errors",
+		metric.WithDescription("Model invocations that failed"))
+	if err != nil {
+		return nil, err
+	}
+	return &modelTelemetry{duration: duration, errors: errorCount}, nil
+}
+
+// ObserveInvocation implements runtime.InvocationObserver
+func (t *modelTelemetry) ObserveInvocation(ctx context.Context, model string, duration time.Duration, err error) {
+	attributes := metric.WithAttributes(attribute.String("model", model))
+	if err == nil {
+		t.duration.Record(ctx, duration.Seconds(), attributes)
+		return
+	}
+
+	reason := "error"
+	switch {
+	case errors.Is(err, runtime.ErrModelTimeout):
+		reason = "timeout"
+	case errors.Is(err, runtime.ErrBackendBlocked):
+		reason = "blocked"
+	}
+	t.errors.Add(ctx, 1, metric.WithAttributes(attribute.String("model", model), attribute.String("reason", reason)))
+	if reason != "blocked" {
+		t.duration.Record(ctx, duration.Seconds(), attributes)
+	}
+}
+
+// registerProcessorMetrics reports the items received and dropped by the
+// processors of each signal, the result caches, timeouts and circuits of
+// each model, the rate normal spans are kept at, and the volume kept and
+// dropped per service
+func registerProcessorMetrics(provider metric.MeterProvider, state *controlState) (metric.Registration, error) {
+	meter := provider.Meter(meterScope)
+
+	received, err := meter.Int64ObservableCounter("ai_processor.items.received",
+		metric.WithDescription("Spans, log records or metric data points received by the processors"))
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := meter.Int64ObservableCounter("ai_processor.items.dropped",
+		metric.WithDescription("Items dropped by sampling, filtering or rules"))
+	if err != nil {
+		return nil, err
+	}
+	hits, err := meter.Int64ObservableCounter("ai_processor.model_cache.hits",
+		metric.WithDescription("Model results served from the results cache"))
+	if err != nil {
+		return nil, err
+	}
+	misses, err := meter.Int64ObservableCounter("ai_processor.model_cache.misses",
+		metric.WithDescription("Model results not found in the results cache"))
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := meter.Int64ObservableCounter("ai_processor.model.timeouts",
+		metric.WithDescription("Model invocations that exceeded the model's timeout"))
+	if err != nil {
+		return nil, err
+	}
+	knownFailures, err := meter.Int64ObservableCounter("ai_processor.model.negative_cache.hits",
+		metric.WithDescription("Model invocations skipped because the model failed on the same input recently"))
+	if err != nil {
+		return nil, err
+	}
+	circuits, err := meter.Int64ObservableGauge("ai_processor.model.circuit_open",
+		metric.WithDescription("Whether the model's circuit is open or half open, so it is not invoked"))
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := meter.Int64ObservableGauge("ai_processor.model.invocations_in_flight",
+		metric.WithDescription("Model invocations running, bounded by processing.concurrency"))
+	if err != nil {
+		return nil, err
+	}
+	normalRate, err := meter.Float64ObservableGauge("ai_processor.sampling.normal_rate",
+		metric.WithDescription("Rate at which normal spans are kept, as adjusted by adaptive sampling"))
+	if err != nil {
+		return nil, err
+	}
+	accountedItems, err := meter.Int64ObservableCounter("ai_processor.accounting.items",
+		metric.WithDescription("Spans and log records kept or dropped by smart sampling per service"))
+	if err != nil {
+		return nil, err
+	}
+	shadows, err := meter.Int64ObservableCounter("ai_processor.shadow.invocations",
+		metric.WithDescription("Invocations of shadow models by whether their outputs agreed with the production models'"))
+	if err != nil {
+		return nil, err
+	}
+	accountedBytes, err := meter.Int64ObservableCounter("ai_processor.accounting.bytes",
+		metric.WithDescription("OTLP protobuf bytes of the spans and log records kept or dropped by smart sampling per service"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		for signal, count := range state.received {
+			observer.ObserveInt64(received, count.Load(), metric.WithAttributes(attribute.String("signal", signal)))
+		}
+		for signal, count := range state.dropped {
+			observer.ObserveInt64(dropped, count.Load(), metric.WithAttributes(attribute.String("signal", signal)))
+		}
+		for model, counters := range state.runtime.CacheCounters() {
+			model := metric.WithAttributes(attribute.String("model", model))
+			observer.ObserveInt64(hits, counters.Hits, model)
+			observer.ObserveInt64(misses, counters.Misses, model)
+		}
+		for model, count := range state.runtime.Timeouts() {
+			observer.ObserveInt64(timeouts, count, metric.WithAttributes(attribute.String("model", model)))
+		}
+		for model, count := range state.runtime.NegativeCacheHits() {
+			observer.ObserveInt64(knownFailures, count, metric.WithAttributes(attribute.String("model", model)))
+		}
+		for model, circuit := range state.runtime.Circuits() {
+			open := int64(0)
+			if circuit != runtime.CircuitClosed {
+				open = 1
+			}
+			observer.ObserveInt64(circuits, open, metric.WithAttributes(attribute.String("model", model)))
+		}
+		state.shadow.counts(func(model string, outcome string, count int64) {
+			observer.ObserveInt64(shadows, count, metric.WithAttributes(attribute.String("model", model), attribute.String("outcome", outcome)))
+		})
+		running, _ := state.runtime.InvocationsInFlight()
+		observer.ObserveInt64(inFlight, int64(running))
+		observer.ObserveFloat64(normalRate, state.adaptive.normalRate(state.current().Sampling.NormalSpans, time.Now()))
+		state.accounting.each(func(signal string, service string, total volume) {
+			kept := metric.WithAttributes(attribute.String("signal", signal), attribute.String("service", service), attribute.String("outcome", "kept"))
+			observer.ObserveInt64(accountedItems, total.keptItems, kept)
+			observer.ObserveInt64(accountedBytes, total.keptBytes, kept)
+			discarded := metric.WithAttributes(attribute.String("signal", signal), attribute.String("service", service), attribute.String("outcome", "dropped"))
+			observer.ObserveInt64(accountedItems, total.droppedItems, discarded)
+			observer.ObserveInt64(accountedBytes, total.droppedBytes, discarded)
+		})
+		return nil
+	}, received, dropped, hits, misses, timeouts, knownFailures, circuits, inFlight, normalRate, shadows, accountedItems, accountedBytes)
+}
@@ -0,0 +1,105 @@
+// This file contains the identification of tenants and the per-tenant model
+// invocation quotas shared by all processors
+
+package processor
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/quota"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// meterScope is the instrumentation scope of the processor's own metrics
+const meterScope = "github.com/fortxun/caza-otel-ai-processor/pkg/processor"
+
+// tenantOf returns the tenant of a resource
+func tenantOf(config *TenancyConfig, resource pcommon.Resource) string {
+	if config.Attribute != "" {
+		if tenant, ok := resource.Attributes().Get(config.Attribute); ok && tenant.Str() != "" {
+			return tenant.Str()
+		}
+	}
+	return config.Default
+}
+
+// itemContext returns ctx for processing an item of a resource. It keeps the
+// item away from backends restricted for its residency, charges model
+// invocations to the resource's tenant and carries the tenant's
+// configuration.
+func itemContext(ctx context.Context, state *controlState, residency *residencyPolicy, resource pcommon.Resource) context.Context {
+	live := state.current()
+	tenant := tenantOf(&live.Tenancy, resource)
+	ctx = residency.context(ctx, resource)
+	ctx = runtime.WithTenant(ctx, tenant)
+	return withItemConfig(ctx, state.configFor(live, tenant))
+}
+
+// newQuotaTracker creates the quota tracker for config
+func newQuotaTracker(config *QuotasConfig) *quota.Tracker {
+	tenants := make(map[string]quota.Limits, len(config.Tenants))
+	for tenant, limits := range config.Tenants {
+		tenants[tenant] = quota.Limits{Hourly: limits.Hourly, Daily: limits.Daily}
+	}
+
+	return quota.New(quota.Config{
+		Default: quota.Limits{Hourly: config.Hourly, Daily: config.Daily},
+		Tenants: tenants,
+	})
+}
+
+// registerQuotaMetrics reports quota usage per tenant through the collector's
+// own telemetry, so platform teams can bill and alert on model usage
+func registerQuotaMetrics(provider metric.MeterProvider, tracker *quota.Tracker) (metric.Registration, error) {
+	meter := provider.Meter(meterScope)
+
+	invocations, err := meter.Int64ObservableGauge("ai_processor.quota.invocations",
+		metric.WithDescription("Model invocations of a tenant in the current quota window"))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := meter.Int64ObservableGauge("ai_processor.quota.limit",
+		metric.WithDescription("Model invocation limit of a tenant per quota window, 0 if unlimited"))
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := meter.Int64ObservableGauge("ai_processor.quota.rejected",
+		metric.WithDescription("Model invocations of a tenant replaced by heuristics today"))
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		for _, usage := range tracker.Usage() {
+			tenant := attribute.String("tenant", usage.Tenant)
+			hourly := metric.WithAttributes(tenant, attribute.String("window", "hourly"))
+			daily := metric.WithAttributes(tenant, attribute.String("window", "daily"))
+
+			observer.ObserveInt64(invocations, usage.Hourly, hourly)
+			observer.ObserveInt64(invocations, usage.Daily, daily)
+			observer.ObserveInt64(limit, usage.Limits.Hourly, hourly)
+			observer.ObserveInt64(limit, usage.Limits.Daily, daily)
+			observer.ObserveInt64(rejected, usage.Rejected, metric.WithAttributes(tenant))
+		}
+		return nil
+	}, invocations, limit, rejected)
+}
+
+// quotaUsageMap returns quota usage keyed by tenant for control-plane stats
+func quotaUsageMap(tracker *quota.Tracker) map[string]interface{} {
+	usages := make(map[string]interface{})
+	for _, usage := range tracker.Usage() {
+		usages[usage.Tenant] = map[string]interface{}{
+			"hourly":       usage.Hourly,
+			"daily":        usage.Daily,
+			"hourly_limit": usage.Limits.Hourly,
+			"daily_limit":  usage.Limits.Daily,
+			"rejected":     usage.Rejected,
+		}
+	}
+	return usages
+}
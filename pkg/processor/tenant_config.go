@@ -0,0 +1,164 @@
+// This file contains the resolution of the configuration of each tenant,
+// the live configuration with the tenant's overrides
+
+package processor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+// Settings tenants can't override, since they are shared by the items of
+// every tenant or apply to whole batches
+var tenantFixedSettings = map[string][]string{
+	"features": {"context_linking", "anomaly_detection", "log_dedup"},
+	"sampling": {"tail", "decision_cache", "similarity", "adaptive"},
+}
+
+// tenantConfigs holds the configuration of each tenant with overrides,
+// resolved from a live configuration
+type tenantConfigs struct {
+	live    *Config
+	configs map[string]*Config
+}
+
+// itemConfigKey is the context key of the configuration of the item
+// processed
+type itemConfigKey struct{}
+
+// resolveTenantConfig returns a copy of live with the overrides of a
+// tenant. The copy has no tenants of its own.
+func resolveTenantConfig(live *Config, tenant *TenantConfig) (*Config, error) {
+	resolved := *live
+	resolved.Tenants = nil
+
+	// Overrides are merged into the maps of the sections, which the copy
+	// mustn't share with live
+	resolved.Output.Severity.Logs = maps.Clone(live.Output.Severity.Logs)
+	resolved.Output.Severity.Spans = maps.Clone(live.Output.Severity.Spans)
+	for _, section := range []struct {
+		key       string
+		overrides map[string]interface{}
+		target    interface{}
+	}{
+		{"features", tenant.Features, &resolved.Features},
+		{"sampling", tenant.Sampling, &resolved.Sampling},
+		{"output", tenant.Output, &resolved.Output},
+	} {
+		if len(section.overrides) == 0 {
+			continue
+		}
+		for _, key := range tenantFixedSettings[section.key] {
+			if _, ok := section.overrides[key]; ok {
+				return nil, fmt.Errorf("%s.%s can't be overridden per tenant", section.key, key)
+			}
+		}
+		if err := confmap.NewFromStringMap(section.overrides).Unmarshal(section.target); err != nil {
+			return nil, fmt.Errorf("invalid %s overrides: %w", section.key, err)
+		}
+	}
+	return &resolved, nil
+}
+
+// configFor returns the configuration of a tenant: the live configuration
+// with the tenant's overrides, or the live configuration itself for
+// tenants without any. The configurations are resolved again once the
+// control plane updates the live one.
+func (s *controlState) configFor(live *Config, tenant string) *Config {
+	if len(live.Tenants) == 0 {
+		return live
+	}
+	resolved := s.tenants.Load()
+	if resolved == nil || resolved.live != live {
+		resolved = s.resolveTenants(live)
+	}
+	if config, ok := resolved.configs[tenant]; ok {
+		return config
+	}
+	return live
+}
+
+// resolveTenants resolves the configurations of the tenants of live.
+// Tenants whose overrides no longer apply, after the control plane changed
+// the live configuration, get the live configuration.
+func (s *controlState) resolveTenants(live *Config) *tenantConfigs {
+	resolved := &tenantConfigs{live: live, configs: make(map[string]*Config, len(live.Tenants))}
+	for tenant, overrides := range live.Tenants {
+		config, err := resolveTenantConfig(live, &overrides)
+		if err != nil {
+			s.logger.Warn("Ignoring invalid tenant overrides", zap.String("tenant", tenant), zap.Error(err))
+			continue
+		}
+		resolved.configs[tenant] = config
+	}
+	s.tenants.Store(resolved)
+	return resolved
+}
+
+// anyConfig reports whether enabled holds for the live configuration or
+// the configuration of any tenant, such as whether a feature is enabled for
+// some of the items
+func (s *controlState) anyConfig(enabled func(config *Config) bool) bool {
+	live := s.current()
+	if enabled(live) {
+		return true
+	}
+	for tenant := range live.Tenants {
+		if enabled(s.configFor(live, tenant)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceConfig returns the configuration of the tenant of a resource
+func (s *controlState) resourceConfig(resource pcommon.Resource) *Config {
+	live := s.current()
+	if len(live.Tenants) == 0 {
+		return live
+	}
+	return s.configFor(live, tenantOf(&live.Tenancy, resource))
+}
+
+// resourceOutput returns the output settings of the tenant of a resource
+func (s *controlState) resourceOutput(resource pcommon.Resource) *OutputConfig {
+	return &s.resourceConfig(resource).Output
+}
+
+// redacts reports whether the personal data of a resource is redacted
+func (s *controlState) redacts(resource pcommon.Resource) bool {
+	return s.resourceConfig(resource).Features.PIIRedaction
+}
+
+// withItemConfig returns ctx carrying the configuration of an item
+func withItemConfig(ctx context.Context, config *Config) context.Context {
+	return context.WithValue(ctx, itemConfigKey{}, config)
+}
+
+// itemConfig returns the configuration of the item processed with ctx,
+// live outside of items
+func itemConfig(ctx context.Context, live *Config) *Config {
+	if config, ok := ctx.Value(itemConfigKey{}).(*Config); ok {
+		return config
+	}
+	return live
+}
+
+// Features checked with anyConfig
+func piiRedaction(config *Config) bool      { return config.Features.PIIRedaction }
+func smartSampling(config *Config) bool     { return config.Features.SmartSampling }
+func entityExtraction(config *Config) bool  { return config.Features.EntityExtraction }
+func nameNormalization(config *Config) bool { return config.Features.NameNormalization }
+func genAI(config *Config) bool             { return config.Features.GenAI }
+
+// modelFeatures reports whether config enables a feature enriching or
+// sampling items
+func modelFeatures(config *Config) bool {
+	return config.Features.ErrorClassification || config.Features.SmartSampling ||
+		config.Features.EntityExtraction
+}
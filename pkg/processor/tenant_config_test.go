@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestTenantOverridesResolvePerResource(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.Features.SmartSampling = true
+	config.Tenancy.Attribute = "tenant.id"
+	config.Tenants = map[string]TenantConfig{
+		"acme": {
+			Features: map[string]interface{}{"smart_sampling": false, "pii_redaction": true},
+			Sampling: map[string]interface{}{"normal_spans": 0.5, "logs": map[string]interface{}{"info": 0.25}},
+			Output:   map[string]interface{}{"attribute_namespace": "acme.ai."},
+		},
+	}
+	require.NoError(t, config.Validate())
+
+	state := &controlState{logger: zap.NewNop()}
+	state.config.Store(config)
+	resource := pcommon.NewResource()
+	resource.Attributes().PutStr("tenant.id", "acme")
+
+	// Overridden settings change, the others are those of the live config
+	acme := state.resourceConfig(resource)
+	assert.False(t, acme.Features.SmartSampling)
+	assert.True(t, acme.Features.PIIRedaction)
+	assert.Equal(t, 0.5, acme.Sampling.NormalSpans)
+	assert.Equal(t, 0.25, acme.Sampling.Logs.Info)
+	assert.Equal(t, config.Sampling.Logs.Debug, acme.Sampling.Logs.Debug)
+	assert.Equal(t, config.Sampling.ErrorEvents, acme.Sampling.ErrorEvents)
+	assert.Equal(t, "acme.ai.", acme.Output.AttributeNamespace)
+	assert.Equal(t, config.Output.MaxAttributeLength, acme.Output.MaxAttributeLength)
+	assert.Same(t, acme, state.resourceConfig(resource))
+	assert.True(t, state.redacts(resource))
+	assert.True(t, state.anyConfig(piiRedaction))
+	assert.False(t, config.Features.PIIRedaction)
+
+	// Items carry the configuration of their tenant
+	ctx := itemContext(context.Background(), state, nil, resource)
+	assert.Same(t, acme, itemConfig(ctx, config))
+	assert.Equal(t, "acme", runtime.TenantFromContext(ctx))
+	other := itemContext(context.Background(), state, nil, pcommon.NewResource())
+	assert.Same(t, config, itemConfig(other, config))
+
+	// A new live configuration is resolved again
+	updated := *config
+	updated.Sampling.Logs.Debug = 0.5
+	state.config.Store(&updated)
+	assert.Equal(t, 0.5, state.resourceConfig(resource).Sampling.Logs.Debug)
+}
+
+func TestTenantOverridesValidation(t *testing.T) {
+	config := createDefaultConfig().(*Config)
+	config.Tenants = map[string]TenantConfig{
+		"acme": {Sampling: map[string]interface{}{"normal_spans": 1.5}},
+	}
+	config.Tenancy.Attribute = ""
+	assert.ErrorContains(t, config.Validate(), "tenants need tenancy.attribute")
+
+	config.Tenancy.Attribute = "tenant.id"
+	assert.ErrorContains(t, config.Validate(), "tenants.acme: sampling.normal_spans must be between 0.0 and 1.0")
+
+	// Settings shared by every tenant can't be overridden
+	config.Tenants["acme"] = TenantConfig{Features: map[string]interface{}{"context_linking": true}}
+	assert.ErrorContains(t, config.Validate(), "tenants.acme: features.context_linking can't be overridden per tenant")
+
+	config.Tenants["acme"] = TenantConfig{Output: map[string]interface{}{"attribute_namespce": "acme."}}
+	assert.ErrorContains(t, config.Validate(), "tenants.acme: invalid output overrides")
+}
@@ -8,42 +8,44 @@ import (
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
 )
 
 // MockWasmRuntime is a mock implementation of the WasmRuntime
 type MockWasmRuntime struct {
 	ClassifyErrorCalled   bool
-	ClassifyErrorInput    map[string]interface{}
+	ClassifyErrorInput    *runtime.ErrorInput
 	ClassifyErrorOutput   map[string]interface{}
 	ClassifyErrorError    error
 	
 	SampleTelemetryCalled   bool
-	SampleTelemetryInput    map[string]interface{}
+	SampleTelemetryInput    *runtime.SampleInput
 	SampleTelemetryOutput   map[string]interface{}
 	SampleTelemetryError    error
 	
 	ExtractEntitiesCalled   bool
-	ExtractEntitiesInput    map[string]interface{}
+	ExtractEntitiesInput    *runtime.EntityInput
 	ExtractEntitiesOutput   map[string]interface{}
 	ExtractEntitiesError    error
 }
 
 // ClassifyError is a mock implementation
-func (m *MockWasmRuntime) ClassifyError(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+func (m *MockWasmRuntime) ClassifyError(ctx context.Context, input *runtime.ErrorInput) (map[string]interface{}, error) {
 	m.ClassifyErrorCalled = true
 	m.ClassifyErrorInput = input
 	return m.ClassifyErrorOutput, m.ClassifyErrorError
 }
 
 // SampleTelemetry is a mock implementation
-func (m *MockWasmRuntime) SampleTelemetry(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+func (m *MockWasmRuntime) SampleTelemetry(ctx context.Context, input *runtime.SampleInput) (map[string]interface{}, error) {
 	m.SampleTelemetryCalled = true
 	m.SampleTelemetryInput = input
 	return m.SampleTelemetryOutput, m.SampleTelemetryError
 }
 
 // ExtractEntities is a mock implementation
-func (m *MockWasmRuntime) ExtractEntities(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+func (m *MockWasmRuntime) ExtractEntities(ctx context.Context, input *runtime.EntityInput) (map[string]interface{}, error) {
 	m.ExtractEntitiesCalled = true
 	m.ExtractEntitiesInput = input
 	return m.ExtractEntitiesOutput, m.ExtractEntitiesError
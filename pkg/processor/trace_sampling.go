@@ -0,0 +1,119 @@
+// This file contains the grouping of spans by trace used to make one
+// sampling decision per trace
+
+package processor
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/common"
+)
+
+// Sources of the randomness sampling rates are compared with
+const (
+	samplingRandomnessTraceID = "trace_id"
+	samplingRandomnessW3C     = "w3c"
+)
+
+// sampleTrace returns true if a trace should be kept based on the sampling
+// rate (0.0-1.0), with the randomness selected by config. The trace state
+// of its spans can carry the randomness of the trace.
+func sampleTrace(config *SamplingConfig, root ptrace.Span, rate float64) bool {
+	if config.Randomness == samplingRandomnessW3C {
+		return common.ThresholdSample(common.TraceRandomness(root.TraceID(), root.TraceState().AsRaw()), rate)
+	}
+	return traceIDSample(root.TraceID(), rate)
+}
+
+// traceSummary aggregates the spans of a trace in a batch for sampling
+type traceSummary struct {
+	// root is the trace's root span, or its first span if the root is not
+	// in the batch, and resource the root's resource
+	root     ptrace.Span
+	resource pcommon.Resource
+	hasRoot  bool
+
+	spans  int
+	errors int
+	slow   int64 // duration of the slowest span in ms
+	start  pcommon.Timestamp
+	end    pcommon.Timestamp
+
+	// skipSampler is set when rules skip the sampler model for every span
+	// whose decision is not forced
+	skipSampler bool
+}
+
+// summarizeTraces groups the spans of td by trace, in batch order
+func summarizeTraces(td ptrace.Traces, decisions *ruleDecisions) []*traceSummary {
+	var summaries []*traceSummary
+	byTrace := make(map[pcommon.TraceID]*traceSummary)
+
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+
+				summary, ok := byTrace[span.TraceID()]
+				if !ok {
+					summary = &traceSummary{
+						root:        span,
+						resource:    rs.Resource(),
+						start:       span.StartTimestamp(),
+						end:         span.EndTimestamp(),
+						skipSampler: true,
+					}
+					byTrace[span.TraceID()] = summary
+					summaries = append(summaries, summary)
+				}
+				if !summary.hasRoot && span.ParentSpanID().IsEmpty() {
+					summary.root, summary.resource, summary.hasRoot = span, rs.Resource(), true
+				}
+
+				summary.spans++
+				if span.Status().Code() == ptrace.StatusCodeError {
+					summary.errors++
+				}
+				if duration := int64(span.EndTimestamp()-span.StartTimestamp()) / 1_000_000; duration > summary.slow {
+					summary.slow = duration
+				}
+				if span.StartTimestamp() < summary.start {
+					summary.start = span.StartTimestamp()
+				}
+				if span.EndTimestamp() > summary.end {
+					summary.end = span.EndTimestamp()
+				}
+
+				if decision := decisions.get(span); decision.sampling == "" && !decision.skipSampler {
+					summary.skipSampler = false
+				}
+			}
+		}
+	}
+	return summaries
+}
+
+// annotateSpans records a sampling decision on every span of td whose
+// resource's output settings include sampling metadata
+func annotateSpans(td ptrace.Traces, decision samplingDecision, output func(resource pcommon.Resource) *OutputConfig) {
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		config := output(rss.At(i).Resource())
+		if !config.IncludeSamplingMetadata {
+			continue
+		}
+		namespace := config.AttributeNamespace
+		sss := rss.At(i).ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				decision.annotate(spans.At(k).Attributes(), namespace)
+			}
+		}
+	}
+}
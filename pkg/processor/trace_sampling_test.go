@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestSummarizeTracesGroupsSpansByTrace(t *testing.T) {
+	checkout := pcommon.TraceID([16]byte{1})
+	health := pcommon.TraceID([16]byte{2})
+
+	td := ptrace.NewTraces()
+	addSpan := func(rs ptrace.ResourceSpans, trace pcommon.TraceID, name string, parent byte, start, end int64) ptrace.Span {
+		span := rs.ScopeSpans().At(0).Spans().AppendEmpty()
+		span.SetTraceID(trace)
+		span.SetName(name)
+		if parent != 0 {
+			span.SetParentSpanID(pcommon.SpanID([8]byte{parent}))
+		}
+		span.SetStartTimestamp(pcommon.Timestamp(start * 1_000_000))
+		span.SetEndTimestamp(pcommon.Timestamp(end * 1_000_000))
+		return span
+	}
+
+	payments := td.ResourceSpans().AppendEmpty()
+	payments.Resource().Attributes().PutStr("service.name", "payments")
+	payments.ScopeSpans().AppendEmpty()
+	charge := addSpan(payments, checkout, "charge", 1, 20, 320)
+	charge.Status().SetCode(ptrace.StatusCodeError)
+	probe := addSpan(payments, health, "GET /health", 0, 0, 1)
+
+	frontend := td.ResourceSpans().AppendEmpty()
+	frontend.Resource().Attributes().PutStr("service.name", "frontend")
+	frontend.ScopeSpans().AppendEmpty()
+	addSpan(frontend, checkout, "POST /checkout", 0, 10, 400)
+
+	// Rules skip the sampler for health checks
+	_, decisions := withRuleDecisions(context.Background())
+	decisions.set(probe, &expression.Result{SkipModels: map[string]bool{runtime.ModelSampler: true}})
+
+	summaries := summarizeTraces(td, decisions)
+	require.Len(t, summaries, 2)
+
+	trace := summaries[0]
+	assert.Equal(t, "POST /checkout", trace.root.Name())
+	service, _ := trace.resource.Attributes().Get("service.name")
+	assert.Equal(t, "frontend", service.Str())
+	assert.Equal(t, 2, trace.spans)
+	assert.Equal(t, 1, trace.errors)
+	assert.Equal(t, int64(390), int64(trace.end-trace.start)/1_000_000)
+	assert.Equal(t, int64(390), trace.slow)
+	assert.False(t, trace.skipSampler)
+
+	assert.Equal(t, "GET /health", summaries[1].root.Name())
+	assert.True(t, summaries[1].skipSampler)
+}
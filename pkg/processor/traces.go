@@ -7,65 +7,183 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.uber.org/zap"
 
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
 	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
 )
 
 // fullTracesProcessor is the implementation of tracesProcessor for the fullwasm build
 type fullTracesProcessor struct {
 	logger       *zap.Logger
-	config       *Config
+	state        *controlState
 	nextConsumer consumer.Traces
 	wasmRuntime  *runtime.WasmRuntime
+	hooks        enrichmentHooks
+	residency    *residencyPolicy
+	redaction    *redactionFilter
+	genAI        *genAIEnricher
+	pool         *shardedPool
+	rules        *expression.Engine
+
+	// Buffered traces awaiting their sampling decision, nil unless tail
+	// sampling is enabled, and the loop deciding them
+	tail     *tailBuffer
+	tailStop chan struct{}
+	tailDone sync.WaitGroup
+
+	// Traces whose spans were kept, shared by the traces processors using
+	// the configuration, nil unless the decision cache is enabled
+	kept *decisionCache
+}
+
+// config returns the live configuration, which the control plane can update
+func (p *fullTracesProcessor) config() *Config {
+	return p.state.current()
 }
 
 func newTracesProcessor(
-	logger *zap.Logger,
+	set component.TelemetrySettings,
 	config *Config,
 	nextConsumer consumer.Traces,
+	hooks enrichmentHooks,
 ) (tracesProcessor, error) {
-	// Initialize WASM runtime
-	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
-		ErrorClassifierPath:   config.Models.ErrorClassifier.Path,
-		ErrorClassifierMemory: config.Models.ErrorClassifier.MemoryLimitMB,
-		SamplerPath:           config.Models.ImportanceSampler.Path,
-		SamplerMemory:         config.Models.ImportanceSampler.MemoryLimitMB,
-		EntityExtractorPath:   config.Models.EntityExtractor.Path,
-		EntityExtractorMemory: config.Models.EntityExtractor.MemoryLimitMB,
-	})
+	logger := set.Logger
+
+	// Share the live configuration with the other processors, and the control
+	// plane and models once started
+	state := referenceControlState(set, config)
+
+	// Compile the rules evaluated before model invocation
+	rules, err := newRulesEngine(config)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("failed to compile rules: %w", err)
+	}
+
+	// Label data residency and restrict model backends accordingly
+	residency, err := newResidencyPolicy(&config.Residency, config.Output.AttributeNamespace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize WASM runtime: %w", err)
+		state.release()
+		return nil, fmt.Errorf("invalid residency configuration: %w", err)
+	}
+
+	// Compile the patterns of personal data to redact
+	redaction, err := newRedactionFilter(&config.Redaction)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid redaction configuration: %w", err)
+	}
+
+	// Compile the prices and injection patterns of GenAI spans
+	genAI, err := newGenAIEnricher(&config.GenAI)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid genai configuration: %w", err)
+	}
+
+	// Buffer spans by trace to sample complete traces
+	var tail *tailBuffer
+	if config.Sampling.Tail.Enabled {
+		if config.Sampling.Tail.DecisionWaitMs <= 0 {
+			state.release()
+			return nil, errors.New("sampling.tail.decision_wait_ms must be positive")
+		}
+		tail = newTailBuffer(&config.Sampling.Tail)
 	}
 
 	return &fullTracesProcessor{
 		logger:       logger,
-		config:       config,
+		state:        state,
 		nextConsumer: nextConsumer,
-		wasmRuntime:  wasmRuntime,
+		hooks:        hooks,
+		rules:        rules,
+		residency:    residency,
+		redaction:    redaction,
+		genAI:        genAI,
+		tail:         tail,
+		kept:         state.decisions,
 	}, nil
 }
 
-func (p *fullTracesProcessor) processTraces(ctx context.Context, td ptrace.Traces) (ptrace.Traces, error) {
-	// If no AI features are enabled, pass through the data unchanged
-	if !p.config.Features.ErrorClassification && 
-	   !p.config.Features.SmartSampling && 
-	   !p.config.Features.EntityExtraction && 
-	   !p.config.Features.ContextLinking {
+func (p *fullTracesProcessor) processTraces(ctx context.Context, td ptrace.Traces) (out ptrace.Traces, err error) {
+	// Count received and dropped items for the control plane
+	received := td.SpanCount()
+	usage := p.state.memory.start()
+	defer func() {
+		p.state.recordBatch(signalTraces, received, out.SpanCount())
+		p.state.observeSpans(out)
+		p.state.memory.record(ctx, signalTraces, usage, received)
+	}()
+
+	// Label residency before anything else reads the resources
+	p.residency.tagTraces(td)
+
+	// Redact personal data before models, backends or exporters see it
+	if p.state.anyConfig(piiRedaction) {
+		p.redaction.redactTraces(td, p.state.redacts)
+	}
+
+	// Normalize span names before models, hooks or rules see them
+	if p.state.anyConfig(nameNormalization) {
+		normalizeSpanNames(td, p.state)
+	}
+
+	// Add the cost and risk of GenAI spans
+	if p.state.anyConfig(genAI) {
+		p.genAI.enrichTraces(td, p.state)
+	}
+
+	// If no AI features, hooks, rules or hints are enabled, pass through the data unchanged
+	if !p.state.anyConfig(modelFeatures) && 
+	   !p.config().Features.ContextLinking &&
+	   len(p.hooks) == 0 &&
+	   p.rules == nil &&
+	   !p.config().Hints.Enabled {
 		return td, nil
 	}
 
+	// Collect the sampling decisions forced by rules for this batch, and
+	// apply sampling if enabled, otherwise only the drops forced by rules,
+	// once it is processed. Batches interrupted before all their spans were
+	// processed are sampled too, at the sampling rates alone.
+	ctx, _ = withRuleDecisions(ctx)
+	defer func() {
+		if p.state.anyConfig(smartSampling) {
+			out = p.sampleTraces(ctx, out)
+		} else {
+			removeDroppedSpans(out, ruleDecisionsFrom(ctx))
+		}
+	}()
+
+	// Wait while the processors are busy with other batches
+	release, err := p.state.acquireBatch(ctx)
+	if err != nil {
+		return td, err
+	}
+	defer release()
+
+	// Link the spans with the error logs seen of their traces
+	if p.config().Features.ContextLinking {
+		p.state.links.linkSpans(td, p.config().Output.AttributeNamespace, time.Now())
+	}
+
 	// Use parallel processing if enabled
-	if p.config.Processing.EnableParallelProcessing {
+	if p.pool != nil {
 		return p.processTracesParallel(ctx, td)
 	}
 
 	// Serial processing
+	errorsOnly := p.errorSpansOnly()
 	rss := td.ResourceSpans()
 	for i := 0; i < rss.Len(); i++ {
 		rs := rss.At(i)
@@ -77,76 +195,133 @@ func (p *fullTracesProcessor) processTraces(ctx context.Context, td ptrace.Trace
 			
 			for k := 0; k < spans.Len(); k++ {
 				span := spans.At(k)
+				if errorsOnly && span.Status().Code() != ptrace.StatusCodeError {
+					continue
+				}
 				p.processSpan(ctx, span, rs.Resource())
 			}
 		}
 	}
 
-	// Apply sampling if enabled
-	if p.config.Features.SmartSampling {
-		td = p.sampleTraces(ctx, td)
-	}
-
 	return td, nil
 }
 
 // Process traces in parallel for better performance
 func (p *fullTracesProcessor) processTracesParallel(ctx context.Context, td ptrace.Traces) (ptrace.Traces, error) {
-	// Create a worker pool
-	numWorkers := p.config.Processing.MaxParallelWorkers
-	if numWorkers <= 0 {
-		numWorkers = 8 // Default to 8 workers
-	}
-	pool := newWorkerPool(numWorkers)
-	defer pool.close()
+	var batch sync.WaitGroup
 
-	// Process each resource span
-	rss := td.ResourceSpans()
-	for i := 0; i < rss.Len(); i++ {
-		rs := rss.At(i)
-		sss := rs.ScopeSpans()
-		
-		for j := 0; j < sss.Len(); j++ {
-			ss := sss.At(j)
-			
-			// Process spans in parallel
-			processSpansInParallel(ctx, pool, ss.Spans(), rs.Resource(), p.processSpan)
+	// With ordered completion the workers only run the models, and the
+	// hooks run in batch order once all spans are enriched
+	ordered := p.config().Processing.OrderedCompletion
+	process := p.processSpan
+	if ordered {
+		process = func(ctx context.Context, span ptrace.Span, resource pcommon.Resource) {
+			p.enrichSpan(itemContext(ctx, p.state, p.residency, resource), span, resource)
+		}
+	}
+	if p.errorSpansOnly() {
+		enrich := process
+		process = func(ctx context.Context, span ptrace.Span, resource pcommon.Resource) {
+			if span.Status().Code() == ptrace.StatusCodeError {
+				enrich(ctx, span, resource)
+			}
 		}
 	}
 
-	// Wait for all spans to be processed
-	pool.wait()
+	// Process the spans of each scope in parallel on the shard of its resource
+	if err := processSpansInParallel(ctx, p.pool, &batch, td, process); err != nil {
+		batch.Wait()
+		return td, err
+	}
 
-	// Apply sampling if enabled
-	if p.config.Features.SmartSampling {
-		td = p.sampleTraces(ctx, td)
+	// Wait for all spans to be processed
+	batch.Wait()
+	if ordered {
+		p.runHooksInOrder(ctx, td)
 	}
 
 	return td, nil
 }
 
+// errorSpansOnly reports whether only error spans need processing, which is
+// the case when no model, hook, rule or hint other than the error classifier
+// looks at individual spans. Other spans then skip the item context and the
+// workers entirely.
+func (p *fullTracesProcessor) errorSpansOnly() bool {
+	return !p.state.anyConfig(entityExtraction) && len(p.hooks) == 0 && p.rules == nil && !p.config().Hints.Enabled
+}
+
+// processSpan enriches a span and runs the hooks on it
 func (p *fullTracesProcessor) processSpan(ctx context.Context, span ptrace.Span, resource pcommon.Resource) {
+	ctx = itemContext(ctx, p.state, p.residency, resource)
+	p.enrichSpan(ctx, span, resource)
+
+	// Run custom enrichment hooks after the models
+	p.hooks.onSpan(ctx, p.logger, span, resource)
+}
+
+// enrichSpan evaluates the rules and invokes the models for a span, ctx
+// being the span's item context
+func (p *fullTracesProcessor) enrichSpan(ctx context.Context, span ptrace.Span, resource pcommon.Resource) {
+	// Evaluate rules and hints before invoking the models
+	var rules expression.Result
+	if p.rules != nil {
+		rules = evaluateRules(p.logger, p.rules, spanRuleInput(span, resource))
+		applyRuleAttributes(&rules, span.Attributes())
+	}
+	if hints := &p.config().Hints; hints.Enabled {
+		applyHints(hints, span.Attributes(), &rules)
+	}
+	ruleDecisionsFrom(ctx).set(span, &rules)
+
+	// Spans of batches passed through or past their timeout skip the models
+	if modelsSkipped(ctx) {
+		return
+	}
+
 	// Extract error information if this is an error span
+	features := &itemConfig(ctx, p.config()).Features
 	if span.Status().Code() == ptrace.StatusCodeError {
-		if p.config.Features.ErrorClassification {
+		if features.ErrorClassification && !rules.Skips(runtime.ModelErrorClassifier) {
 			p.classifyError(ctx, span, resource)
 		}
 	}
 
 	// Extract entities if enabled
-	if p.config.Features.EntityExtraction {
+	if features.EntityExtraction && !rules.Skips(runtime.ModelEntityExtractor) {
 		p.extractEntities(ctx, span, resource)
 	}
 }
 
+// runHooksInOrder runs the enrichment hooks on the spans of td in order
+func (p *fullTracesProcessor) runHooksInOrder(ctx context.Context, td ptrace.Traces) {
+	if len(p.hooks) == 0 {
+		return
+	}
+
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		itemCtx := itemContext(ctx, p.state, p.residency, rs.Resource())
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				p.hooks.onSpan(itemCtx, p.logger, spans.At(k), rs.Resource())
+			}
+		}
+	}
+}
+
 func (p *fullTracesProcessor) classifyError(ctx context.Context, span ptrace.Span, resource pcommon.Resource) {
 	// Prepare error information for classification
-	errorInfo := map[string]interface{}{
-		"name":        span.Name(),
-		"status":      span.Status().Message(),
-		"kind":        span.Kind().String(),
-		"attributes":  attributesToMap(span.Attributes()),
-		"resource":    attributesToMap(resource.Attributes()),
+	errorInfo := &runtime.ErrorInput{
+		Name:       span.Name(),
+		Status:     span.Status().Message(),
+		Kind:       span.Kind().String(),
+		Events:     spanEvents(span.Events()),
+		Attributes: attributesToMap(span.Attributes()),
+		Resource:   resourceToMap(resource),
 	}
 
 	// Call error classifier model
@@ -157,18 +332,47 @@ func (p *fullTracesProcessor) classifyError(ctx context.Context, span ptrace.Spa
 	}
 
 	// Add classification attributes to span
+	output := &itemConfig(ctx, p.config()).Output
 	for k, v := range result {
-		attrKey := p.config.Output.AttributeNamespace + k
+		attrKey := output.AttributeNamespace + k
 		setAttribute(span.Attributes(), attrKey, v)
 	}
+	output.Severity.hintSpan(span, result, output.AttributeNamespace)
+	setOwnerAttributes(span.Attributes(), p.state.ownership, result, errorInfo, output.AttributeNamespace)
+	truncateAttributes(span.Attributes(), output)
+	p.state.provenance.annotate(span.Attributes(), runtime.ModelErrorClassifier, output)
+
+	// Remember the category for the spikes of error metrics
+	if p.config().Features.ContextLinking {
+		category, _ := result["category"].(string)
+		p.state.links.classify(span.TraceID(), truncateString(category, output.MaxAttributeLength), time.Now())
+	}
+}
+
+// spanEvents converts the events of a span, such as its exception events,
+// for the error classifier. Their attributes bypass the attribute cache,
+// since stack traces rarely repeat.
+func spanEvents(events ptrace.SpanEventSlice) []runtime.SpanEvent {
+	if events.Len() == 0 {
+		return nil
+	}
+	converted := make([]runtime.SpanEvent, events.Len())
+	for i := 0; i < events.Len(); i++ {
+		event := events.At(i)
+		converted[i] = runtime.SpanEvent{Name: event.Name()}
+		if event.Attributes().Len() > 0 {
+			converted[i].Attributes = event.Attributes().AsRaw()
+		}
+	}
+	return converted
 }
 
 func (p *fullTracesProcessor) extractEntities(ctx context.Context, span ptrace.Span, resource pcommon.Resource) {
 	// Prepare span information for entity extraction
-	spanInfo := map[string]interface{}{
-		"name":        span.Name(),
-		"attributes":  attributesToMap(span.Attributes()),
-		"resource":    attributesToMap(resource.Attributes()),
+	spanInfo := &runtime.EntityInput{
+		Name:       span.Name(),
+		Attributes: attributesToMap(span.Attributes()),
+		Resource:   resourceToMap(resource),
 	}
 
 	// Call entity extractor model
@@ -179,96 +383,229 @@ func (p *fullTracesProcessor) extractEntities(ctx context.Context, span ptrace.S
 	}
 
 	// Add entity attributes to span
-	for k, v := range result {
-		attrKey := p.config.Output.AttributeNamespace + k
-		setAttribute(span.Attributes(), attrKey, v)
-	}
+	output := &itemConfig(ctx, p.config()).Output
+	setEntityAttributes(span.Attributes(), result, output)
+	truncateAttributes(span.Attributes(), output)
+	p.state.provenance.annotate(span.Attributes(), runtime.ModelEntityExtractor, output)
 }
 
+// sampleTraces keeps or drops the spans of td. Spans are sampled per trace,
+// so the spans of a trace in the batch are kept or dropped together unless
+// rules force a decision for a span. Dropped spans are removed from td in
+// place, along with the scopes and resources they leave empty. With tail
+// sampling, the spans are buffered instead and td keeps those rules keep.
+// With the decision cache, the later spans of traces kept are kept too.
+// The spans of tenants with smart sampling disabled are only dropped by
+// rules.
 func (p *fullTracesProcessor) sampleTraces(ctx context.Context, td ptrace.Traces) ptrace.Traces {
-	// Create a new Traces object to hold the sampled traces
-	sampled := ptrace.NewTraces()
-	
-	// Process all resource spans
-	rss := td.ResourceSpans()
-	for i := 0; i < rss.Len(); i++ {
-		rs := rss.At(i)
-		resource := rs.Resource()
-		sss := rs.ScopeSpans()
-		
-		// Process spans for each scope
-		for j := 0; j < sss.Len(); j++ {
-			ss := sss.At(j)
-			spans := ss.Spans()
-			
-			// Process each span
-			for k := 0; k < spans.Len(); k++ {
-				span := spans.At(k)
-				
-				// Determine sampling decision
-				keep := p.makeSamplingDecision(ctx, span, resource)
-				
-				if keep {
-					// Add span to sampled traces
-					newRS := getOrCreateResource(sampled, resource)
-					newSS := getOrCreateScope(newRS, ss.Scope())
-					newSpan := newSS.Spans().AppendEmpty()
-					span.CopyTo(newSpan)
+	decisions := ruleDecisionsFrom(ctx)
+	tally := p.state.accounting.tally()
+	defer p.state.accounting.record(signalTraces, tally)
+	if p.tail != nil {
+		p.releaseTraces(ctx, p.tail.add(td, decisions, tally, time.Now()))
+		annotateSpans(td, samplingDecision{keep: true, reason: samplingReasonRule}, p.state.resourceOutput)
+		return td
+	}
+	traceDecisions := p.makeSamplingDecisions(ctx, summarizeTraces(td, decisions))
+	now := time.Now()
+
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		service := accountingService(rs.Resource())
+		config := p.state.resourceConfig(rs.Resource())
+		metadata := config.Output.IncludeSamplingMetadata
+		namespace := config.Output.AttributeNamespace
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				if !config.Features.SmartSampling {
+					return decisions.get(span).sampling == expression.SamplingDrop
 				}
+				// Decisions forced by rules take precedence over the trace's
+				decision := traceDecisions[span.TraceID()]
+				switch decisions.get(span).sampling {
+				case expression.SamplingKeep:
+					decision = samplingDecision{keep: true, reason: samplingReasonRule}
+					if !traceDecisions[span.TraceID()].keep {
+						p.kept.add(span.TraceID(), now)
+					}
+				case expression.SamplingDrop:
+					tally.addSpan(service, span, false)
+					return true
+				}
+				if decision.keep && metadata {
+					decision.annotate(span.Attributes(), namespace)
+				}
+				tally.addSpan(service, span, decision.keep)
+				return !decision.keep
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+
+	return td
+}
+
+// makeSamplingDecisions decides which traces to keep
+func (p *fullTracesProcessor) makeSamplingDecisions(ctx context.Context, summaries []*traceSummary) map[pcommon.TraceID]samplingDecision {
+	now := time.Now()
+	decisions := make(map[pcommon.TraceID]samplingDecision, len(summaries))
+	for _, summary := range summaries {
+		if !p.state.resourceConfig(summary.resource).Features.SmartSampling {
+			continue
+		}
+		decisions[summary.root.TraceID()] = p.decideTrace(ctx, summary, now)
+	}
+	return decisions
+}
+
+// decideTrace decides whether to keep a trace. Traces whose spans were kept
+// before are kept without being sampled, and kept traces are remembered.
+// With similarity sampling, traces unlike those kept recently are kept.
+func (p *fullTracesProcessor) decideTrace(ctx context.Context, trace *traceSummary, now time.Time) samplingDecision {
+	traceID := trace.root.TraceID()
+	if p.kept.contains(traceID, now) {
+		return samplingDecision{keep: true, reason: samplingReasonTrace}
+	}
+	decision := p.makeSamplingDecision(ctx, trace)
+	decision = p.state.similarity.decide(ctx, &p.config().Sampling.Similarity, signalTraces,
+		similarityText(trace.resource, trace.root.Name(), trace.root.Status().Message()), decision)
+	if decision.keep {
+		p.kept.add(traceID, now)
+	}
+	return decision
+}
+
+// releaseTraces decides buffered traces and passes the kept ones to the
+// next consumer
+func (p *fullTracesProcessor) releaseTraces(ctx context.Context, traces []*bufferedTrace) {
+	now := time.Now()
+	kept := ptrace.NewTraces()
+	tally := p.state.accounting.tally()
+	defer p.state.accounting.record(signalTraces, tally)
+	for _, trace := range traces {
+		// Traces of tenants with smart sampling disabled are kept as they are
+		summary := trace.summary()
+		decision := samplingDecision{keep: true}
+		if p.state.resourceConfig(summary.resource).Features.SmartSampling {
+			decision = p.decideTrace(ctx, summary, now)
+			if decision.keep {
+				annotateSpans(trace.spans, decision, p.state.resourceOutput)
 			}
 		}
+		tally.addSpans(trace.spans, decision.keep)
+		if !decision.keep {
+			continue
+		}
+		trace.spans.ResourceSpans().MoveAndAppendTo(kept.ResourceSpans())
+	}
+	if kept.ResourceSpans().Len() == 0 {
+		return
+	}
+
+	// Buffered spans were counted as dropped by the batches they arrived in
+	p.state.recordBatch(signalTraces, 0, kept.SpanCount())
+	p.state.observeSpans(kept)
+	if err := p.nextConsumer.ConsumeTraces(ctx, kept); err != nil {
+		p.logger.Error("Failed to pass sampled traces on", zap.Error(err))
 	}
-	
-	return sampled
 }
 
-func (p *fullTracesProcessor) makeSamplingDecision(ctx context.Context, span ptrace.Span, resource pcommon.Resource) bool {
-	// Always keep error spans if configured
-	if span.Status().Code() == ptrace.StatusCodeError && p.config.Sampling.ErrorEvents >= 1.0 {
-		return true
+// decideTraces releases the buffered traces as their decision wait passes,
+// until the processor shuts down
+func (p *fullTracesProcessor) decideTraces() {
+	defer p.tailDone.Done()
+
+	ticker := time.NewTicker(p.tail.wait / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			p.releaseTraces(context.Background(), p.tail.expired(now))
+		case <-p.tailStop:
+			return
+		}
+	}
+}
+
+// makeSamplingDecision decides whether to keep a trace. Traces with errors
+// are kept at the error_events rate and other slow traces at the slow_spans
+// rate; the remaining traces at the normal_spans rate, or the rate of the
+// adaptive controller, weighted by the importance the sampler model gives
+// them. Decisions hash the trace ID, so the spans of a trace split across
+// batches get the same decision.
+func (p *fullTracesProcessor) makeSamplingDecision(ctx context.Context, trace *traceSummary) samplingDecision {
+	sampling := &p.state.resourceConfig(trace.resource).Sampling
+	normalRate := p.state.adaptive.normalRate(sampling.NormalSpans, time.Now())
+	sample := func(rate float64) bool {
+		return sampleTrace(sampling, trace.root, rate)
+	}
+
+	if trace.errors > 0 {
+		return samplingDecision{keep: sample(sampling.ErrorEvents), reason: samplingReasonError}
+	}
+	if trace.slow > int64(sampling.ThresholdMs) {
+		return samplingDecision{keep: sample(sampling.SlowSpans), reason: samplingReasonSlow}
 	}
 	
-	// Check if this is a slow span
-	duration := span.EndTimestamp() - span.StartTimestamp()
-	durationMs := int64(duration) / 1_000_000 // Convert nanoseconds to milliseconds
-	
-	if durationMs > int64(p.config.Sampling.ThresholdMs) && p.config.Sampling.SlowSpans >= 1.0 {
-		return true
+	// Rules can skip the sampler model for this trace, as can batches
+	// passed through or past their timeout
+	if trace.skipSampler || modelsSkipped(ctx) {
+		return samplingDecision{keep: sample(normalRate), reason: samplingReasonRate}
 	}
 	
-	// Call the sampler model
-	spanInfo := map[string]interface{}{
-		"name":      span.Name(),
-		"kind":      span.Kind().String(),
-		"status":    span.Status().Code().String(),
-		"duration":  durationMs,
-		"attributes": attributesToMap(span.Attributes()),
-		"resource":  attributesToMap(resource.Attributes()),
+	// Call the sampler model once for the trace
+	traceInfo := &runtime.SampleInput{
+		Name:       trace.root.Name(),
+		Kind:       trace.root.Kind().String(),
+		Status:     trace.root.Status().Code().String(),
+		Duration:   int64(trace.end-trace.start) / 1_000_000, // Convert nanoseconds to milliseconds
+		Spans:      trace.spans,
+		Errors:     trace.errors,
+		Attributes: attributesToMap(trace.root.Attributes()),
+		Resource:   resourceToMap(trace.resource),
 	}
 	
 	// Call importance sampler model
-	result, err := p.wasmRuntime.SampleTelemetry(ctx, spanInfo)
+	ctx = itemContext(ctx, p.state, p.residency, trace.resource)
+	result, err := p.wasmRuntime.SampleTelemetry(ctx, traceInfo)
 	if err != nil {
 		p.logger.Error("Failed to make sampling decision", zap.Error(err))
 		// Default to the normal spans rate
-		return randomSample(p.config.Sampling.NormalSpans)
-	}
-	
-	importance, ok := result["importance"].(float64)
-	if !ok {
-		return randomSample(p.config.Sampling.NormalSpans)
+		return samplingDecision{keep: sample(normalRate), reason: samplingReasonRate}
 	}
 	
 	// Make sampling decision based on importance
-	// Higher importance means higher chance of keeping the span
-	return randomSample(p.config.Sampling.NormalSpans * importance)
+	return modelSamplingDecision(result, normalRate, sample)
 }
 
-func (p *fullTracesProcessor) shutdown(ctx context.Context) error {
-	if p.wasmRuntime != nil {
-		return p.wasmRuntime.Close()
+// start starts the processing workers, which are shared by all batches
+func (p *fullTracesProcessor) start(ctx context.Context, host component.Host) error {
+	// The first processor to start loads the models shared by all of them
+	if err := p.state.start(); err != nil {
+		return err
+	}
+	p.wasmRuntime = p.state.runtime
+	p.pool = newProcessingPool(&p.config().Processing)
+	if p.tail != nil {
+		p.tailStop = make(chan struct{})
+		p.tailDone.Add(1)
+		go p.decideTraces()
 	}
 	return nil
 }
 
+func (p *fullTracesProcessor) shutdown(ctx context.Context) error {
+	p.pool.close()
+
+	// Decide the buffered traces without waiting for their decision wait
+	if p.tail != nil {
+		if p.tailStop != nil {
+			close(p.tailStop)
+			p.tailDone.Wait()
+		}
+		p.releaseTraces(ctx, p.tail.drain())
+	}
+	return p.state.release()
+}
+
 // Helper functions are now defined in the common package and imported via helpers.go
\ No newline at end of file
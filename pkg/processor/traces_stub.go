@@ -7,7 +7,9 @@ package processor
 
 import (
 	"context"
+	"fmt"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.uber.org/zap"
@@ -20,41 +22,93 @@ type stubTracesProcessor struct {
 	config       *Config
 	nextConsumer consumer.Traces
 	wasmRuntime  *runtime.WasmRuntime
+	hooks        enrichmentHooks
+	residency    *residencyPolicy
+	redaction    *redactionFilter
+	genAI        *genAIEnricher
+	state        *controlState
 }
 
 func newTracesProcessor(
-	logger *zap.Logger,
+	set component.TelemetrySettings,
 	config *Config,
 	nextConsumer consumer.Traces,
+	hooks enrichmentHooks,
 ) (tracesProcessor, error) {
-	// Initialize WASM runtime
-	wasmRuntime, err := runtime.NewWasmRuntime(logger, &runtime.WasmRuntimeConfig{
-		ErrorClassifierPath:   config.Models.ErrorClassifier.Path,
-		ErrorClassifierMemory: config.Models.ErrorClassifier.MemoryLimitMB,
-		SamplerPath:           config.Models.ImportanceSampler.Path,
-		SamplerMemory:         config.Models.ImportanceSampler.MemoryLimitMB,
-		EntityExtractorPath:   config.Models.EntityExtractor.Path,
-		EntityExtractorMemory: config.Models.EntityExtractor.MemoryLimitMB,
-	})
+	logger := set.Logger
+
+	// Share the live configuration with the other processors, and the control
+	// plane and models once started
+	state := referenceControlState(set, config)
+
+	// Label data residency and restrict model backends accordingly
+	residency, err := newResidencyPolicy(&config.Residency, config.Output.AttributeNamespace)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid residency configuration: %w", err)
+	}
+
+	// Compile the patterns of personal data to redact
+	redaction, err := newRedactionFilter(&config.Redaction)
 	if err != nil {
-		return nil, err
+		state.release()
+		return nil, fmt.Errorf("invalid redaction configuration: %w", err)
+	}
+
+	// Compile the prices and injection patterns of GenAI spans
+	genAI, err := newGenAIEnricher(&config.GenAI)
+	if err != nil {
+		state.release()
+		return nil, fmt.Errorf("invalid genai configuration: %w", err)
 	}
 
 	return &stubTracesProcessor{
 		logger:       logger,
 		config:       config,
 		nextConsumer: nextConsumer,
-		wasmRuntime:  wasmRuntime,
+		hooks:        hooks,
+		state:        state,
+		residency:    residency,
+		redaction:    redaction,
+		genAI:        genAI,
 	}, nil
 }
 
 func (p *stubTracesProcessor) processTraces(ctx context.Context, td ptrace.Traces) (ptrace.Traces, error) {
+	// Label data residency, which applies without models too
+	p.residency.tagTraces(td)
+
+	// Redact personal data before models, backends or exporters see it
+	if p.state.anyConfig(piiRedaction) {
+		p.redaction.redactTraces(td, p.state.redacts)
+	}
+
+	// Normalize span names before models, hooks or rules see them
+	if p.state.anyConfig(nameNormalization) {
+		normalizeSpanNames(td, p.state)
+	}
+
+	// Add the cost and risk of GenAI spans
+	if p.state.anyConfig(genAI) {
+		p.genAI.enrichTraces(td, p.state)
+	}
+
 	// Stub implementation just passes traces through
 	p.logger.Debug("Stub traces processor called", 
 		zap.Int("span_count", td.SpanCount()))
+	p.state.recordBatch(signalTraces, td.SpanCount(), td.SpanCount())
 	return td, nil
 }
 
+func (p *stubTracesProcessor) start(ctx context.Context, host component.Host) error {
+	// The first processor to start loads the models shared by all of them
+	if err := p.state.start(); err != nil {
+		return err
+	}
+	p.wasmRuntime = p.state.runtime
+	return nil
+}
+
 func (p *stubTracesProcessor) shutdown(ctx context.Context) error {
-	return p.wasmRuntime.Close()
+	return p.state.release()
 }
\ No newline at end of file
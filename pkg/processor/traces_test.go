@@ -0,0 +1,272 @@
+//go:build fullwasm
+// +build fullwasm
+
+package processor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/expression"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestSampleTracesRemovesDroppedSpansInPlace(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Sampling.ErrorEvents = 1.0
+	config.Sampling.NormalSpans = 0
+
+	state := &controlState{}
+	state.config.Store(config)
+	p := &fullTracesProcessor{logger: zap.NewNop(), state: state}
+
+	td := ptrace.NewTraces()
+	addSpan := func(rs ptrace.ResourceSpans, trace byte, name string) ptrace.Span {
+		span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetTraceID(pcommon.TraceID([16]byte{trace}))
+		span.SetName(name)
+		return span
+	}
+
+	// The failed trace is kept whole, the health check is dropped with the
+	// resource it leaves empty unless a rule keeps it
+	payments := td.ResourceSpans().AppendEmpty()
+	addSpan(payments, 1, "charge").Status().SetCode(ptrace.StatusCodeError)
+	addSpan(payments, 1, "POST /checkout")
+	health := addSpan(td.ResourceSpans().AppendEmpty(), 2, "GET /health")
+	forced := addSpan(td.ResourceSpans().AppendEmpty(), 3, "GET /ready")
+
+	ctx, decisions := withRuleDecisions(context.Background())
+	skipSampler := map[string]bool{runtime.ModelSampler: true}
+	decisions.set(health, &expression.Result{SkipModels: skipSampler})
+	decisions.set(forced, &expression.Result{Sampling: expression.SamplingKeep, SkipModels: skipSampler})
+
+	sampled := p.sampleTraces(ctx, td)
+	require.Equal(t, 2, sampled.ResourceSpans().Len())
+	assert.Equal(t, 2, sampled.ResourceSpans().At(0).ScopeSpans().Len())
+	assert.Equal(t, "GET /ready", sampled.ResourceSpans().At(1).ScopeSpans().At(0).Spans().At(0).Name())
+	assert.Equal(t, 3, sampled.SpanCount())
+}
+
+func TestSampleTracesRecordsSamplingMetadata(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Output.IncludeSamplingMetadata = true
+
+	state := &controlState{}
+	state.config.Store(config)
+	p := &fullTracesProcessor{logger: zap.NewNop(), state: state}
+
+	td := ptrace.NewTraces()
+	spans := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	failed := spans.AppendEmpty()
+	failed.SetTraceID(pcommon.TraceID([16]byte{1}))
+	failed.Status().SetCode(ptrace.StatusCodeError)
+	forced := spans.AppendEmpty()
+	forced.SetTraceID(pcommon.TraceID([16]byte{2}))
+
+	ctx, decisions := withRuleDecisions(context.Background())
+	decisions.set(forced, &expression.Result{Sampling: expression.SamplingKeep})
+
+	sampled := p.sampleTraces(ctx, td)
+	require.Equal(t, 2, sampled.SpanCount())
+	for i, reason := range []string{samplingReasonError, samplingReasonRule} {
+		attributes := sampled.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(i).Attributes()
+		value, ok := attributes.Get("ai.sampling.reason")
+		require.True(t, ok)
+		assert.Equal(t, reason, value.Str())
+		_, ok = attributes.Get("ai.sampling.importance")
+		assert.False(t, ok)
+	}
+}
+
+func TestSampleTracesKeepsLaterSpansOfKeptTraces(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Sampling.NormalSpans = 0
+	config.Sampling.DecisionCache.Enabled = true
+	config.Output.IncludeSamplingMetadata = true
+
+	state := &controlState{}
+	state.config.Store(config)
+	p := &fullTracesProcessor{logger: zap.NewNop(), state: state, kept: newDecisionCache(&config.Sampling.DecisionCache)}
+
+	// Spans skip the sampler model, so only errors are kept at rate 0
+	skip := &expression.Result{SkipModels: map[string]bool{runtime.ModelSampler: true}}
+	batch := func(failed bool, ids ...byte) (context.Context, ptrace.Traces) {
+		ctx, decisions := withRuleDecisions(context.Background())
+		td := ptrace.NewTraces()
+		spans := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+		for _, id := range ids {
+			span := spans.AppendEmpty()
+			span.SetTraceID(pcommon.TraceID([16]byte{15: id}))
+			if failed {
+				span.Status().SetCode(ptrace.StatusCodeError)
+			}
+			decisions.set(span, skip)
+		}
+		return ctx, td
+	}
+
+	ctx, td := batch(true, 1)
+	require.Equal(t, 1, p.sampleTraces(ctx, td).SpanCount())
+
+	// The later span of the kept trace is kept, the other trace's dropped
+	ctx, td = batch(false, 1, 2)
+	sampled := p.sampleTraces(ctx, td)
+	require.Equal(t, 1, sampled.SpanCount())
+	span := sampled.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, pcommon.TraceID([16]byte{15: 1}), span.TraceID())
+	reason, _ := span.Attributes().Get("ai.sampling.reason")
+	assert.Equal(t, samplingReasonTrace, reason.Str())
+}
+
+func TestProcessTracesSamplesInterruptedBatches(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Sampling.ErrorEvents = 1.0
+	config.Sampling.NormalSpans = 0
+
+	// The only batch slot is taken, so the batch is interrupted while it
+	// waits for one
+	state := &controlState{
+		received: map[string]*atomic.Int64{signalTraces: {}},
+		dropped:  map[string]*atomic.Int64{signalTraces: {}},
+		batches:  make(chan struct{}, 1),
+	}
+	state.batches <- struct{}{}
+	state.config.Store(config)
+	p := &fullTracesProcessor{logger: zap.NewNop(), state: state}
+
+	td := ptrace.NewTraces()
+	spans := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	failed := spans.AppendEmpty()
+	failed.SetTraceID(pcommon.TraceID([16]byte{1}))
+	failed.Status().SetCode(ptrace.StatusCodeError)
+	spans.AppendEmpty().SetTraceID(pcommon.TraceID([16]byte{2}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sampled, err := p.processTraces(ctx, td)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The batch is still sampled at the sampling rates alone
+	require.Equal(t, 1, sampled.SpanCount())
+	assert.Equal(t, ptrace.StatusCodeError, sampled.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Status().Code())
+	assert.Equal(t, int64(1), state.dropped[signalTraces].Load())
+}
+
+func TestMakeSamplingDecisionAppliesTierRates(t *testing.T) {
+	config := CreateDefaultConfig().(*Config)
+	config.Sampling.ErrorEvents = 0.5
+	config.Sampling.SlowSpans = 0.25
+	config.Sampling.NormalSpans = 0
+	config.Sampling.ThresholdMs = 500
+
+	state := &controlState{}
+	state.config.Store(config)
+	p := &fullTracesProcessor{logger: zap.NewNop(), state: state}
+
+	summary := func(i int, errors int, slow int64) *traceSummary {
+		span := ptrace.NewSpan()
+		var id [16]byte
+		binary.BigEndian.PutUint64(id[8:], uint64(i)*0x9e3779b97f4a7c15)
+		span.SetTraceID(pcommon.TraceID(id))
+		return &traceSummary{root: span, spans: 1, errors: errors, slow: slow, skipSampler: true}
+	}
+
+	const traces = 10000
+	var failed, slow, normal int
+	for i := 0; i < traces; i++ {
+		decision := p.makeSamplingDecision(context.Background(), summary(i, 1, 0))
+		if decision.keep {
+			failed++
+		}
+		assert.Equal(t, samplingReasonError, decision.reason)
+		// Every batch of a trace gets the same decision
+		assert.Equal(t, decision, p.makeSamplingDecision(context.Background(), summary(i, 1, 0)))
+
+		if p.makeSamplingDecision(context.Background(), summary(i, 0, 800)).keep {
+			slow++
+		}
+		if p.makeSamplingDecision(context.Background(), summary(i, 0, 100)).keep {
+			normal++
+		}
+	}
+	assert.InDelta(t, 0.5, float64(failed)/traces, 0.03)
+	assert.InDelta(t, 0.25, float64(slow)/traces, 0.03)
+	assert.Zero(t, normal)
+}
+
+// BenchmarkProcessTracesErrorClassificationOnly measures batches of spans
+// without errors when error classification is the only feature enabled
+func BenchmarkProcessTracesErrorClassificationOnly(b *testing.B) {
+	config := CreateDefaultConfig().(*Config)
+	config.Features = FeaturesConfig{ErrorClassification: true}
+	config.Processing.EnableParallelProcessing = true
+
+	state := &controlState{
+		received: map[string]*atomic.Int64{signalTraces: {}},
+		dropped:  map[string]*atomic.Int64{signalTraces: {}},
+	}
+	state.config.Store(config)
+
+	td := ptrace.NewTraces()
+	for i := 0; i < 10; i++ {
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("service.name", fmt.Sprintf("service-%d", i))
+		spans := rs.ScopeSpans().AppendEmpty().Spans()
+		for j := 0; j < 100; j++ {
+			span := spans.AppendEmpty()
+			span.SetName("GET /users/{id}")
+			span.Attributes().PutStr("http.method", "GET")
+			span.Attributes().PutInt("http.status_code", 200)
+		}
+	}
+
+	for _, parallel := range []bool{false, true} {
+		name := "serial"
+		if parallel {
+			name = "parallel"
+		}
+		b.Run(name, func(b *testing.B) {
+			p := &fullTracesProcessor{logger: zap.NewNop(), state: state}
+			if parallel {
+				p.pool = newProcessingPool(&config.Processing)
+				defer p.pool.close()
+			}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.processTraces(context.Background(), td); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSpanEventsPassExceptionAttributes(t *testing.T) {
+	span := ptrace.NewSpan()
+	assert.Nil(t, spanEvents(span.Events()))
+
+	span.Events().AppendEmpty().SetName("retry")
+	exception := span.Events().AppendEmpty()
+	exception.SetName("exception")
+	exception.Attributes().PutStr("exception.type", "java.sql.SQLTimeoutException")
+	exception.Attributes().PutStr("exception.message", "query timed out")
+
+	assert.Equal(t, []runtime.SpanEvent{
+		{Name: "retry"},
+		{Name: "exception", Attributes: map[string]interface{}{
+			"exception.type":    "java.sql.SQLTimeoutException",
+			"exception.message": "query timed out",
+		}},
+	}, spanEvents(span.Events()))
+}
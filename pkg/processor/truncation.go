@@ -0,0 +1,89 @@
+// This file contains the truncation of the attributes the processor writes
+// to the maximum attribute length, so long model outputs don't bloat the
+// telemetry or exceed the limits of the backends
+
+package processor
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// truncatedAttribute is set to true, under the output namespace, on items
+// with attributes truncated to the maximum attribute length
+const truncatedAttribute = "truncated"
+
+// truncationMarker ends truncated strings
+const truncationMarker = "…"
+
+// truncateAttributes cuts the strings of the attributes under the output
+// namespace, including the elements of slices and maps, to the maximum
+// attribute length, and marks the item as truncated if any was cut
+func truncateAttributes(attributes pcommon.Map, output *OutputConfig) {
+	limit := output.MaxAttributeLength
+	if limit <= 0 {
+		return
+	}
+	truncated := false
+	attributes.Range(func(key string, value pcommon.Value) bool {
+		if strings.HasPrefix(key, output.AttributeNamespace) && truncateValue(value, limit) {
+			truncated = true
+		}
+		return true
+	})
+	if truncated {
+		attributes.PutBool(output.AttributeNamespace+truncatedAttribute, true)
+	}
+}
+
+// truncateValue cuts the strings of value to limit and reports whether any
+// was cut
+func truncateValue(value pcommon.Value, limit int) bool {
+	switch value.Type() {
+	case pcommon.ValueTypeStr:
+		if len(value.Str()) <= limit {
+			return false
+		}
+		value.SetStr(truncateString(value.Str(), limit))
+		return true
+	case pcommon.ValueTypeSlice:
+		truncated := false
+		slice := value.Slice()
+		for i := 0; i < slice.Len(); i++ {
+			if truncateValue(slice.At(i), limit) {
+				truncated = true
+			}
+		}
+		return truncated
+	case pcommon.ValueTypeMap:
+		truncated := false
+		value.Map().Range(func(_ string, element pcommon.Value) bool {
+			if truncateValue(element, limit) {
+				truncated = true
+			}
+			return true
+		})
+		return truncated
+	}
+	return false
+}
+
+// truncateString cuts s to at most limit bytes, including the truncation
+// marker, without splitting a UTF-8 character (0 for no limit). Limits too
+// short for the marker cut s without it.
+func truncateString(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	marker := truncationMarker
+	if limit <= len(marker) {
+		marker = ""
+	}
+	cut := limit - len(marker)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + marker
+}
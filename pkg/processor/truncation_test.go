@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestTruncateAttributesUnderNamespace(t *testing.T) {
+	attributes := pcommon.NewMap()
+	attributes.PutStr("http.url", "https://example.com/checkout")
+	setEntityAttributes(attributes, map[string]interface{}{
+		"service":  "checkout-service",
+		"services": []interface{}{"cart", "payments-gateway"},
+		"database": map[string]interface{}{"system": "postgresql"},
+		"count":    3,
+	}, &OutputConfig{AttributeNamespace: "ai.", EntityFormat: entityFormatSlice})
+
+	truncateAttributes(attributes, &OutputConfig{AttributeNamespace: "ai.", MaxAttributeLength: 8})
+	assert.Equal(t, map[string]interface{}{
+		"http.url":     "https://example.com/checkout",
+		"ai.service":   "check…",
+		"ai.services":  []interface{}{"cart", "payme…"},
+		"ai.database":  map[string]interface{}{"system": "postg…"},
+		"ai.count":     int64(3),
+		"ai.truncated": true,
+	}, attributes.AsRaw())
+
+	// Items with short enough attributes aren't marked
+	short := pcommon.NewMap()
+	short.PutStr("ai.category", "database_error")
+	truncateAttributes(short, &OutputConfig{AttributeNamespace: "ai.", MaxAttributeLength: 256})
+	assert.Equal(t, map[string]interface{}{"ai.category": "database_error"}, short.AsRaw())
+}
+
+func TestTruncateStringKeepsCharactersWhole(t *testing.T) {
+	assert.Equal(t, "c…", truncateString("cafétéria", 4))
+	assert.Equal(t, "caf…", truncateString("cafétéria", 7))
+	assert.Equal(t, "caf", truncateString("café", 3))
+	assert.Equal(t, "café", truncateString("café", 5))
+	assert.Equal(t, "café", truncateString("café", 0))
+}
@@ -0,0 +1,165 @@
+// This file contains the model watcher, which reloads models when their
+// files change
+
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/download"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// modelReloadDelay is how long the directories of the models must be left
+// unchanged before changed models are reloaded, so files being written are
+// only loaded once complete
+const modelReloadDelay = 500 * time.Millisecond
+
+// modelWatcher reloads the models of a state when their files change. It
+// watches the directories of the files rather than the files, so files
+// replaced by renames or symbolic link swaps, as Kubernetes does with
+// mounted volumes, are seen as well.
+type modelWatcher struct {
+	logger  *zap.Logger
+	state   *controlState
+	watcher *fsnotify.Watcher
+
+	// The watched files of each model, and the watched directories
+	files       map[string]*watchedFile
+	directories map[string]bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// watchedFile is a model file and what it was when it was last loaded
+type watchedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// startModelWatcher watches the files of the models loaded from a path
+func startModelWatcher(logger *zap.Logger, state *controlState) (*modelWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	w := &modelWatcher{
+		logger:      logger,
+		state:       state,
+		watcher:     watcher,
+		files:       make(map[string]*watchedFile),
+		directories: make(map[string]bool),
+		done:        make(chan struct{}),
+	}
+	models := &state.current().Models
+	for _, named := range models.named() {
+		name, model := named.name, named.config
+
+		// Models pulled from the registry are updated by changing their
+		// ref, models of a bundle by replacing the bundle, and downloaded
+		// models are refreshed by downloading them again
+		if model.Path == "" || model.Ref != "" || models.Bundle.Path != "" || download.IsURI(model.Path) {
+			continue
+		}
+		file := &watchedFile{path: filepath.Clean(model.Path)}
+		file.changed()
+		w.files[name] = file
+
+		directory := filepath.Dir(file.path)
+		if !w.directories[directory] {
+			if err := watcher.Add(directory); err != nil {
+				watcher.Close()
+				return nil, fmt.Errorf("failed to watch %s: %w", directory, err)
+			}
+			w.directories[directory] = true
+		}
+	}
+
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// run reloads the changed models once their directories are left unchanged
+// for modelReloadDelay
+func (w *modelWatcher) run() {
+	defer w.wg.Done()
+
+	timer := time.NewTimer(modelReloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.directories[filepath.Dir(event.Name)] {
+				timer.Reset(modelReloadDelay)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("Model file watcher failed", zap.Error(err))
+		case <-timer.C:
+			w.reloadChanged()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// reloadChanged reloads the models whose file changed since it was loaded
+func (w *modelWatcher) reloadChanged() {
+	models := &w.state.current().Models
+	paths := map[string]string{
+		runtime.ModelErrorClassifier: models.ErrorClassifier.Path,
+		runtime.ModelSampler:         models.ImportanceSampler.Path,
+		runtime.ModelEntityExtractor: models.EntityExtractor.Path,
+	}
+	for model, file := range w.files {
+		if !file.changed() {
+			continue
+		}
+
+		// Models the control plane loaded from elsewhere are left alone
+		if filepath.Clean(paths[model]) != file.path {
+			continue
+		}
+		if err := w.state.reloadModel(model, paths[model]); err != nil {
+			w.logger.Error("Failed to reload changed model, keeping the loaded one",
+				zap.String("model", model), zap.String("path", file.path), zap.Error(err))
+			continue
+		}
+		w.logger.Info("Model reloaded after its file changed", zap.String("model", model), zap.String("path", file.path))
+	}
+}
+
+// Stop stops watching the files
+func (w *modelWatcher) Stop() {
+	close(w.done)
+	w.watcher.Close()
+	w.wg.Wait()
+}
+
+// changed reports whether the file changed since it was last seen. Missing
+// files, such as files being replaced, are not changed.
+func (f *watchedFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil || (info.Size() == f.size && info.ModTime().Equal(f.modTime)) {
+		return false
+	}
+	f.size, f.modTime = info.Size(), info.ModTime()
+	return true
+}
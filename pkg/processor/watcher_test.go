@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+func TestModelWatcherReloadsChangedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampler.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("v1"), 0o600))
+
+	wasmRuntime, err := runtime.NewWasmRuntime(zap.NewNop(), &runtime.WasmRuntimeConfig{})
+	require.NoError(t, err)
+	defer wasmRuntime.Close()
+	core, logs := observer.New(zap.InfoLevel)
+	state := &controlState{logger: zap.New(core), runtime: wasmRuntime}
+	config := CreateDefaultConfig().(*Config)
+	config.Models.ErrorClassifier.Path = ""
+	config.Models.ImportanceSampler.Path = path
+	config.Models.EntityExtractor.Path = ""
+	state.config.Store(config)
+
+	watcher, err := startModelWatcher(state.logger, state)
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	// Files replaced by a rename are reloaded once
+	time.Sleep(2 * modelReloadDelay)
+	assert.Zero(t, logs.FilterField(zap.String("path", path)).Len())
+	next := path + ".tmp"
+	require.NoError(t, os.WriteFile(next, []byte("version 2"), 0o600))
+	require.NoError(t, os.Rename(next, path))
+
+	assert.Eventually(t, func() bool {
+		return logs.FilterField(zap.String("model", runtime.ModelSampler)).FilterField(zap.String("path", path)).Len() > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(2 * modelReloadDelay)
+	assert.Equal(t, 1, logs.FilterField(zap.String("model", runtime.ModelSampler)).FilterField(zap.String("path", path)).Len())
+}
@@ -0,0 +1,145 @@
+// Package quota tracks model invocations per tenant against hourly and daily
+// limits. Windows are calendar hours and days in UTC, so usage lines up with
+// billing periods.
+package quota
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limits bounds the invocations of a tenant. Zero means unlimited.
+type Limits struct {
+	Hourly int64
+	Daily  int64
+}
+
+// Config defines the default limits and per-tenant overrides
+type Config struct {
+	Default Limits
+	Tenants map[string]Limits
+}
+
+// Usage is a snapshot of one tenant's usage in the current windows
+type Usage struct {
+	Tenant   string
+	Hourly   int64
+	Daily    int64
+	Limits   Limits
+	Rejected int64
+}
+
+// Tracker counts invocations and enforces limits. It is safe for concurrent use.
+type Tracker struct {
+	config Config
+
+	mutex   sync.Mutex
+	tenants map[string]*usage
+	day     time.Time
+
+	// now returns the current time, replaceable in tests
+	now func() time.Time
+}
+
+// usage is the state of one tenant
+type usage struct {
+	hour     time.Time
+	hourly   int64
+	day      time.Time
+	daily    int64
+	rejected int64
+}
+
+// New creates a tracker for config
+func New(config Config) *Tracker {
+	return &Tracker{
+		config:  config,
+		tenants: make(map[string]*usage),
+		now:     time.Now,
+	}
+}
+
+// Allow records an invocation for tenant if it is within its limits and
+// reports whether it is allowed
+func (t *Tracker) Allow(tenant string) bool {
+	limits := t.limits(tenant)
+	now := t.now().UTC()
+	hour := now.Truncate(time.Hour)
+	day := now.Truncate(24 * time.Hour)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Tenants idle since an earlier day are forgotten to bound memory
+	if !t.day.Equal(day) {
+		t.prune(day)
+		t.day = day
+	}
+
+	u := t.tenants[tenant]
+	if u == nil {
+		u = &usage{}
+		t.tenants[tenant] = u
+	}
+	if !u.hour.Equal(hour) {
+		u.hour = hour
+		u.hourly = 0
+	}
+	if !u.day.Equal(day) {
+		u.day = day
+		u.daily = 0
+		u.rejected = 0
+	}
+
+	if (limits.Hourly > 0 && u.hourly >= limits.Hourly) || (limits.Daily > 0 && u.daily >= limits.Daily) {
+		u.rejected++
+		return false
+	}
+
+	u.hourly++
+	u.daily++
+	return true
+}
+
+// Usage returns the usage of every tenant seen today, sorted by tenant
+func (t *Tracker) Usage() []Usage {
+	now := t.now().UTC()
+	hour := now.Truncate(time.Hour)
+	day := now.Truncate(24 * time.Hour)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make([]Usage, 0, len(t.tenants))
+	for tenant, u := range t.tenants {
+		if !u.day.Equal(day) {
+			continue
+		}
+		snapshot := Usage{Tenant: tenant, Daily: u.daily, Rejected: u.rejected, Limits: t.limits(tenant)}
+		if u.hour.Equal(hour) {
+			snapshot.Hourly = u.hourly
+		}
+		result = append(result, snapshot)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Tenant < result[j].Tenant })
+	return result
+}
+
+// limits returns the limits of tenant
+func (t *Tracker) limits(tenant string) Limits {
+	if limits, ok := t.config.Tenants[tenant]; ok {
+		return limits
+	}
+	return t.config.Default
+}
+
+// prune removes tenants whose usage is from before day. The caller holds the mutex.
+func (t *Tracker) prune(day time.Time) {
+	for tenant, u := range t.tenants {
+		if u.day.Before(day) {
+			delete(t.tenants, tenant)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerEnforcesHourlyAndDailyLimits(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 30, 0, 0, time.UTC)
+	tracker := New(Config{
+		Default: Limits{Hourly: 2, Daily: 3},
+		Tenants: map[string]Limits{"unlimited": {}},
+	})
+	tracker.now = func() time.Time { return now }
+
+	assert.True(t, tracker.Allow("acme"))
+	assert.True(t, tracker.Allow("acme"))
+	assert.False(t, tracker.Allow("acme"), "hourly limit")
+
+	// A new hour resets the hourly window, the daily limit still applies
+	now = now.Add(time.Hour)
+	assert.True(t, tracker.Allow("acme"))
+	assert.False(t, tracker.Allow("acme"), "daily limit")
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, tracker.Allow("unlimited"))
+	}
+
+	usage := tracker.Usage()
+	assert.Equal(t, []Usage{
+		{Tenant: "acme", Hourly: 1, Daily: 3, Limits: Limits{Hourly: 2, Daily: 3}, Rejected: 2},
+		{Tenant: "unlimited", Hourly: 10, Daily: 10},
+	}, usage)
+
+	// A new day resets everything and forgets idle tenants
+	now = now.Add(24 * time.Hour)
+	assert.True(t, tracker.Allow("acme"))
+	assert.Equal(t, []Usage{{Tenant: "acme", Hourly: 1, Daily: 1, Limits: Limits{Hourly: 2, Daily: 3}}}, tracker.Usage())
+}
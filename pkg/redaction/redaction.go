@@ -0,0 +1,180 @@
+// Package redaction detects personal data and secrets, such as email
+// addresses, credit card numbers and access tokens, in strings and masks,
+// hashes or drops them.
+package redaction
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Strategies applied to detected values
+const (
+	// StrategyMask replaces the value with [REDACTED:<pattern>]
+	StrategyMask = "mask"
+
+	// StrategyHash replaces the value with [<pattern>:<hash>], so equal values
+	// can still be correlated
+	StrategyHash = "hash"
+
+	// StrategyDrop drops the whole string holding the value
+	StrategyDrop = "drop"
+)
+
+// Built-in detectors, used by patterns without a regular expression
+const (
+	Email      = "email"
+	CreditCard = "credit_card"
+	Token      = "token"
+)
+
+// builtins are the expressions of the built-in detectors
+var builtins = map[string]string{
+	Email: `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`,
+
+	// 13 to 19 digits, optionally grouped by spaces or dashes
+	CreditCard: `\b\d(?:[ -]?\d){12,18}\b`,
+
+	// Bearer tokens, JWTs, and AWS, GitHub and Slack keys
+	Token: `(?i:bearer)\s+[A-Za-z0-9._~+/-]+=*` +
+		`|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*` +
+		`|\b(?:AKIA|ASIA)[0-9A-Z]{16}\b` +
+		`|\bgh[pousr]_[A-Za-z0-9]{36,}\b` +
+		`|\bxox[abprs]-[A-Za-z0-9-]{10,}`,
+}
+
+// Pattern defines values to detect and how they are redacted
+type Pattern struct {
+	// Name identifies the pattern in redacted values. Patterns without a
+	// regular expression must be named after a built-in detector.
+	Name string
+
+	// Regex matches the values to redact
+	Regex string
+
+	// Strategy is mask, hash or drop, mask if empty
+	Strategy string
+}
+
+// Config defines the redacted values
+type Config struct {
+	// Patterns are applied in order
+	Patterns []Pattern
+
+	// Salt keys the hashes of the hash strategy, so hashes of guessable
+	// values cannot be reversed by whoever does not know it
+	Salt string
+}
+
+// Redactor applies the patterns of a configuration. It is safe for
+// concurrent use.
+type Redactor struct {
+	patterns []pattern
+	salt     []byte
+}
+
+// pattern is a compiled Pattern
+type pattern struct {
+	name     string
+	regex    *regexp.Regexp
+	strategy string
+
+	// valid filters matches, nil to accept all
+	valid func(string) bool
+}
+
+// New compiles the patterns of config
+func New(config Config) (*Redactor, error) {
+	r := &Redactor{salt: []byte(config.Salt)}
+	for _, p := range config.Patterns {
+		if p.Name == "" {
+			return nil, errors.New("redaction pattern without a name")
+		}
+
+		expr := p.Regex
+		if expr == "" {
+			var ok bool
+			if expr, ok = builtins[p.Name]; !ok {
+				return nil, fmt.Errorf("redaction pattern %q needs a regex, it is not a built-in detector", p.Name)
+			}
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex of redaction pattern %q: %w", p.Name, err)
+		}
+
+		switch p.Strategy {
+		case "":
+			p.Strategy = StrategyMask
+		case StrategyMask, StrategyHash, StrategyDrop:
+		default:
+			return nil, fmt.Errorf("unknown strategy %q of redaction pattern %q", p.Strategy, p.Name)
+		}
+
+		compiled := pattern{name: p.Name, regex: regex, strategy: p.Strategy}
+		if p.Name == CreditCard && p.Regex == "" {
+			compiled.valid = luhn
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+	return r, nil
+}
+
+// Redact returns s with the detected values masked or hashed, and whether
+// a value of a pattern with the drop strategy was detected, in which case
+// the whole string should be dropped
+func (r *Redactor) Redact(s string) (string, bool) {
+	for i := range r.patterns {
+		p := &r.patterns[i]
+		dropped := false
+		s = p.regex.ReplaceAllStringFunc(s, func(match string) string {
+			if p.valid != nil && !p.valid(match) {
+				return match
+			}
+			switch p.strategy {
+			case StrategyHash:
+				return "[" + p.name + ":" + r.hash(match) + "]"
+			case StrategyDrop:
+				dropped = true
+			}
+			return "[REDACTED:" + p.name + "]"
+		})
+		if dropped {
+			return "", true
+		}
+	}
+	return s, false
+}
+
+// hash returns the first 64 bits of the keyed hash of a value, in hex
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// luhn reports whether the digits of a number pass the Luhn checksum of
+// payment card numbers, ignoring separators
+func luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 0 && sum%10 == 0
+}
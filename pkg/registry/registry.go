@@ -0,0 +1,327 @@
+// Package registry implements a client for a simple model registry: a JSON
+// index served over HTTP or stored as an OCI artifact that lists model
+// names, versions and hashes, and the model files it points to.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/download"
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// RefScheme is the URI scheme used to reference registry models in configuration
+const RefScheme = "registry://"
+
+// entryPathPattern matches the names and versions of entries, which become
+// directories of the cache, so an index can't point pulls outside of it
+var entryPathPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// Entry describes one model version in the registry index
+type Entry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	// SHA256 is the hex encoded digest of the model file
+	SHA256 string `json:"sha256"`
+
+	// URL of the model file, absolute or relative to the index
+	URL string `json:"url"`
+
+	Size        int64  `json:"size,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Index is the registry index document
+type Index struct {
+	Models []Entry `json:"models"`
+}
+
+// Config defines how the registry is accessed
+type Config struct {
+	// Endpoint is the URL of the index JSON document, or an oci:// URI of
+	// an artifact whose only layer is the index
+	Endpoint string
+
+	// CacheDir is where pulled models are stored
+	CacheDir string
+
+	// Headers are added to every HTTP request and to the token requests of
+	// OCI registries, e.g. for authorization
+	Headers map[string]string
+
+	// Timeout bounds each HTTP request
+	Timeout time.Duration
+}
+
+// Client lists and pulls models from a registry
+type Client struct {
+	endpoint   *url.URL
+	cacheDir   string
+	headers    map[string]string
+	httpClient *http.Client
+
+	// downloads fetches the index and models stored in OCI registries
+	downloads *download.Client
+}
+
+// NewClient creates a registry client
+func NewClient(config Config) (*Client, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("registry endpoint must be set")
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry endpoint: %w", err)
+	}
+
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "otel-ai-processor", "models")
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	httpClient := &http.Client{Timeout: timeout}
+	return &Client{
+		endpoint:   endpoint,
+		cacheDir:   cacheDir,
+		headers:    config.Headers,
+		httpClient: httpClient,
+		downloads:  download.NewClient(download.Config{Headers: config.Headers, HTTPClient: httpClient}),
+	}, nil
+}
+
+// List fetches the registry index
+func (c *Client) List(ctx context.Context) ([]Entry, error) {
+	body, err := c.open(ctx, c.endpoint.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registry index: %w", err)
+	}
+	defer body.Close()
+
+	var index Index
+	if err := json.NewDecoder(body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode registry index: %w", err)
+	}
+
+	return index.Models, nil
+}
+
+// Resolve finds a model version in the registry. An empty version or
+// "latest" selects the highest version of the model.
+func (c *Client) Resolve(ctx context.Context, name, version string) (Entry, error) {
+	entries, err := c.List(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var candidates []Entry
+	for _, entry := range entries {
+		if entry.Name != name {
+			continue
+		}
+		if version == "" || version == "latest" || entry.Version == version {
+			candidates = append(candidates, entry)
+		}
+	}
+
+	if len(candidates) == 0 {
+		if version == "" {
+			version = "latest"
+		}
+		return Entry{}, fmt.Errorf("model %s@%s not found in registry", name, version)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return compareVersions(candidates[i].Version, candidates[j].Version) > 0
+	})
+	return candidates[0], nil
+}
+
+// Pull downloads a model into the cache directory and verifies its digest.
+// Already cached models with a matching digest are not downloaded again.
+// Returns the local path of the model file.
+func (c *Client) Pull(ctx context.Context, entry Entry) (string, error) {
+	if !entryPathPattern.MatchString(entry.Name) || !entryPathPattern.MatchString(entry.Version) {
+		return "", fmt.Errorf("invalid model %q@%q: names and versions may only contain letters, digits, '.', '_', '+' and '-'", entry.Name, entry.Version)
+	}
+	path := filepath.Join(c.cacheDir, entry.Name, entry.Version, entry.Name+".wasm")
+
+	if entry.SHA256 != "" {
+		if digest, err := runtime.FileSHA256(path); err == nil && strings.EqualFold(digest, entry.SHA256) {
+			return path, nil
+		}
+	}
+
+	modelURL, err := c.endpoint.Parse(entry.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid model URL %q: %w", entry.URL, err)
+	}
+	// URLs relative to an artifact have no meaning
+	if c.endpoint.Scheme == "oci" && !strings.Contains(entry.URL, "://") {
+		return "", fmt.Errorf("invalid model URL %q: models of an OCI registry index must have absolute URLs", entry.URL)
+	}
+
+	body, err := c.open(ctx, modelURL.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to download model %s@%s: %w", entry.Name, entry.Version, err)
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Write to a temporary file first so a partial download never replaces a good model
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pull-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download model %s@%s: %w", entry.Name, entry.Version, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if entry.SHA256 != "" && !strings.EqualFold(digest, entry.SHA256) {
+		return "", fmt.Errorf("digest mismatch for model %s@%s: expected %s, got %s", entry.Name, entry.Version, entry.SHA256, digest)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store model: %w", err)
+	}
+
+	return path, nil
+}
+
+// PullRef resolves and pulls a registry reference such as
+// "registry://error-classifier@1.4.0". Returns the local path of the model file.
+func (c *Client) PullRef(ctx context.Context, ref string) (string, error) {
+	name, version, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := c.Resolve(ctx, name, version)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Pull(ctx, entry)
+}
+
+// ParseRef splits a "registry://name@version" reference. The version is
+// optional and defaults to the latest version.
+func ParseRef(ref string) (name string, version string, err error) {
+	if !IsRef(ref) {
+		return "", "", fmt.Errorf("invalid registry reference %q: must start with %s", ref, RefScheme)
+	}
+
+	name = strings.TrimPrefix(ref, RefScheme)
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name, version = name[:i], name[i+1:]
+	}
+
+	if name == "" {
+		return "", "", fmt.Errorf("invalid registry reference %q: missing model name", ref)
+	}
+
+	return name, version, nil
+}
+
+// IsRef reports whether s is a registry reference
+func IsRef(s string) bool {
+	return strings.HasPrefix(s, RefScheme)
+}
+
+// open starts downloading target, through the OCI distribution API for
+// oci:// URIs and with a GET request otherwise
+func (c *Client) open(ctx context.Context, target string) (io.ReadCloser, error) {
+	if strings.HasPrefix(target, "oci://") {
+		return c.downloads.Open(ctx, target)
+	}
+	return c.get(ctx, target)
+}
+
+// get performs a GET request and returns the response body on success
+func (c *Client) get(ctx context.Context, target string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, target)
+	}
+
+	return resp.Body, nil
+}
+
+// compareVersions compares dotted numeric versions such as "1.4.0".
+// Non-numeric parts are compared as strings.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var ap, bp string
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+
+		an, aErr := strconv.Atoi(ap)
+		bn, bErr := strconv.Atoi(bp)
+		if aErr == nil && bErr == nil {
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+
+		if c := strings.Compare(ap, bp); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	name, version, err := ParseRef("registry://error-classifier@1.4.0")
+	require.NoError(t, err)
+	assert.Equal(t, "error-classifier", name)
+	assert.Equal(t, "1.4.0", version)
+
+	name, version, err = ParseRef("registry://sampler")
+	require.NoError(t, err)
+	assert.Equal(t, "sampler", name)
+	assert.Empty(t, version)
+
+	_, _, err = ParseRef("/models/sampler.wasm")
+	assert.Error(t, err)
+}
+
+func TestPullVerifiesAndCachesModels(t *testing.T) {
+	model := []byte("\x00asm-model")
+	digest := sha256.Sum256(model)
+
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Index{Models: []Entry{
+			{Name: "error-classifier", Version: "1.4.0", SHA256: hex.EncodeToString(digest[:]), URL: "models/ec-1.4.0.wasm"},
+			{Name: "error-classifier", Version: "1.10.0", SHA256: "bad", URL: "models/ec-1.10.0.wasm"},
+		}})
+	})
+	mux.HandleFunc("/models/", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(model)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClient(Config{Endpoint: server.URL + "/index.json", CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	// Latest is selected by numeric version order
+	latest, err := client.Resolve(context.Background(), "error-classifier", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1.10.0", latest.Version)
+
+	// A digest mismatch is rejected
+	_, err = client.Pull(context.Background(), latest)
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	path, err := client.PullRef(context.Background(), "registry://error-classifier@1.4.0")
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, model, content)
+
+	// A cached model with a matching digest is not downloaded again
+	_, err = client.PullRef(context.Background(), "registry://error-classifier@1.4.0")
+	require.NoError(t, err)
+	assert.Equal(t, 2, downloads)
+}
+
+func TestPullRejectsEntriesOutsideTheCache(t *testing.T) {
+	client, err := NewClient(Config{Endpoint: "http://registry.invalid/index.json", CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	for _, entry := range []Entry{
+		{Name: "../../etc", Version: "1.0.0"},
+		{Name: "error-classifier", Version: ".."},
+		{Name: "error-classifier", Version: "1.0.0/../../x"},
+		{Name: "error-classifier"},
+	} {
+		_, err := client.Pull(context.Background(), entry)
+		assert.ErrorContains(t, err, "invalid model", "%s@%s", entry.Name, entry.Version)
+	}
+}
+
+func TestPullFromOCIRegistry(t *testing.T) {
+	model := []byte("\x00asm-model")
+	modelDigest := sha256.Sum256(model)
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.TrimPrefix(server.URL, "https://")
+		index, _ := json.Marshal(Index{Models: []Entry{
+			{Name: "sampler", Version: "2.0.0", SHA256: hex.EncodeToString(modelDigest[:]), URL: "oci://" + host + "/acme/sampler:2.0.0"},
+			{Name: "sampler", Version: "2.1.0", URL: "sampler-2.1.0.wasm"},
+		}})
+		indexDigest := sha256.Sum256(index)
+		switch r.URL.Path {
+		case "/v2/acme/models/manifests/stable":
+			w.Write([]byte(`{"layers": [{"mediaType": "application/json", "digest": "sha256:` + hex.EncodeToString(indexDigest[:]) + `"}]}`))
+		case "/v2/acme/models/blobs/sha256:" + hex.EncodeToString(indexDigest[:]):
+			w.Write(index)
+		case "/v2/acme/sampler/manifests/2.0.0":
+			w.Write([]byte(`{"layers": [{"mediaType": "application/vnd.wasm.content.layer.v1+wasm", "digest": "sha256:` + hex.EncodeToString(modelDigest[:]) + `"}]}`))
+		case "/v2/acme/sampler/blobs/sha256:" + hex.EncodeToString(modelDigest[:]):
+			w.Write(model)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Config{Endpoint: "oci://" + strings.TrimPrefix(server.URL, "https://") + "/acme/models:stable", CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	client.httpClient.Transport = server.Client().Transport
+
+	path, err := client.PullRef(context.Background(), "registry://sampler@2.0.0")
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, model, content)
+
+	// Models of an artifact index can't be located relative to it
+	_, err = client.PullRef(context.Background(), "registry://sampler")
+	assert.ErrorContains(t, err, "must have absolute URLs")
+}
@@ -0,0 +1,169 @@
+// Package remote serves models from a remote inference endpoint, such as a
+// REST microservice or an LLM gateway, over HTTP or gRPC.
+//
+// Over HTTP, the JSON-encoded input of the model is posted to the endpoint
+// and the response body is the JSON object output. Over gRPC, the input and
+// output are google.protobuf.Struct messages of a unary method, so services
+// need no generated stubs.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// DefaultMethod is the gRPC method invoked unless another is configured
+const DefaultMethod = "/aiprocessor.inference.v1.Inference/Invoke"
+
+// Config defines the inference endpoint
+type Config struct {
+	// Endpoint is an http:// or https:// URL the input is posted to, or a
+	// grpc://host:port (plaintext) or grpcs://host:port (TLS) address
+	Endpoint string
+
+	// Method is the full gRPC method name, DefaultMethod if empty
+	Method string
+
+	// Headers are added to every request, as metadata over gRPC, for
+	// example to authenticate with a bearer token
+	Headers map[string]string
+
+	// Timeout bounds each request
+	Timeout time.Duration
+}
+
+// Client invokes a model on a remote endpoint
+type Client struct {
+	config Config
+
+	// Exactly one of client and conn is set
+	client *http.Client
+	conn   *grpc.ClientConn
+}
+
+// NewClient creates a client for the endpoint. gRPC connections are
+// established lazily.
+func NewClient(config Config) (*Client, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.Method == "" {
+		config.Method = DefaultMethod
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote endpoint: %w", err)
+	}
+
+	c := &Client{config: config}
+	switch endpoint.Scheme {
+	case "http", "https":
+		c.client = &http.Client{Timeout: config.Timeout}
+	case "grpc", "grpcs":
+		creds := insecure.NewCredentials()
+		if endpoint.Scheme == "grpcs" {
+			creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		}
+		c.conn, err = grpc.NewClient(endpoint.Host, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("remote endpoint %q must be an http, https, grpc or grpcs URL", config.Endpoint)
+	}
+	return c, nil
+}
+
+// Invoke runs the model on a JSON-encoded input
+func (c *Client) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	if c.conn != nil {
+		return c.invokeGRPC(ctx, input)
+	}
+	return c.invokeHTTP(ctx, input)
+}
+
+// invokeHTTP posts the input and decodes the response body
+func (c *Client) invokeHTTP(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.Endpoint, bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("remote inference request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("remote inference returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var output map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+		return nil, fmt.Errorf("failed to decode model output: %w", err)
+	}
+	if output == nil {
+		return nil, errors.New("remote inference returned no output")
+	}
+	return output, nil
+}
+
+// invokeGRPC calls the configured method with the input as a Struct
+func (c *Client) invokeGRPC(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	in := &structpb.Struct{}
+	if err := protojson.Unmarshal(input, in); err != nil {
+		return nil, fmt.Errorf("failed to encode model input: %w", err)
+	}
+	if len(c.config.Headers) > 0 {
+		pairs := make([]string, 0, 2*len(c.config.Headers))
+		for k, v := range c.config.Headers {
+			pairs = append(pairs, strings.ToLower(k), v)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	}
+
+	out := &structpb.Struct{}
+	if err := c.conn.Invoke(ctx, c.config.Method, in, out); err != nil {
+		return nil, fmt.Errorf("remote inference request failed: %w", err)
+	}
+	return out.AsMap(), nil
+}
+
+// Reload does nothing, since models on the endpoint are managed by their
+// service
+func (c *Client) Reload(path string) error {
+	return nil
+}
+
+// Close closes the gRPC connection, if any
+func (c *Client) Close() error {
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestClientInvokesHTTPEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var input map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		json.NewEncoder(w).Encode(map[string]interface{}{"category": "database_error", "name": input["name"]})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Config{Endpoint: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	output, err := client.Invoke(context.Background(), []byte(`{"name":"ExecuteQuery"}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"category": "database_error", "name": "ExecuteQuery"}, output)
+
+	unauthorized, err := NewClient(Config{Endpoint: server.URL})
+	require.NoError(t, err)
+	_, err = unauthorized.Invoke(context.Background(), []byte(`{}`))
+	assert.ErrorContains(t, err, "401 Unauthorized: unauthorized")
+}
+
+func TestClientInvokesGRPCMethod(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "aiprocessor.inference.v1.Inference",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Invoke",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &structpb.Struct{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				md, _ := metadata.FromIncomingContext(ctx)
+				return structpb.NewStruct(map[string]interface{}{
+					"importance": 0.9,
+					"spans":      in.AsMap()["spans"],
+					"tenant":     md.Get("x-tenant")[0],
+				})
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := NewClient(Config{Endpoint: "grpc://" + listener.Addr().String(), Headers: map[string]string{"X-Tenant": "acme"}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	output, err := client.Invoke(context.Background(), []byte(`{"spans":3}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"importance": 0.9, "spans": 3.0, "tenant": "acme"}, output)
+
+	_, err = NewClient(Config{Endpoint: "tcp://localhost:9000"})
+	assert.ErrorContains(t, err, "must be an http, https, grpc or grpcs URL")
+}
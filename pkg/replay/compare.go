@@ -0,0 +1,211 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// CompareOptions controls how two model versions are compared
+type CompareOptions struct {
+	Options
+
+	// CategoryKey is the error classifier output key used for the confusion matrix
+	CategoryKey string
+
+	// KeepKey is the sampler output key holding the keep decision
+	KeepKey string
+}
+
+// ModelComparison summarizes how two versions of one model agree
+type ModelComparison struct {
+	Total  int `json:"total"`
+	Agreed int `json:"agreed"`
+
+	// Failures counts records where either version returned an error
+	BaselineFailures  int `json:"baseline_failures"`
+	CandidateFailures int `json:"candidate_failures"`
+
+	BaselineLatency  time.Duration `json:"baseline_latency"`
+	CandidateLatency time.Duration `json:"candidate_latency"`
+}
+
+// AgreementRate returns the fraction of records with identical outputs
+func (m *ModelComparison) AgreementRate() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+	return float64(m.Agreed) / float64(m.Total)
+}
+
+// LatencyDelta returns the average per-record latency difference (candidate - baseline)
+func (m *ModelComparison) LatencyDelta() time.Duration {
+	if m.Total == 0 {
+		return 0
+	}
+	return (m.CandidateLatency - m.BaselineLatency) / time.Duration(m.Total)
+}
+
+// Comparison is the result of running a corpus through two model versions
+type Comparison struct {
+	Total   int                         `json:"total"`
+	ByModel map[string]*ModelComparison `json:"by_model"`
+
+	// Confusion counts error classifier categories as confusion[baseline][candidate]
+	Confusion map[string]map[string]int `json:"confusion"`
+
+	// Sampler keep counts for each version
+	SamplerTotal  int `json:"sampler_total"`
+	BaselineKept  int `json:"baseline_kept"`
+	CandidateKept int `json:"candidate_kept"`
+}
+
+// KeepRateDelta returns the difference in sampler keep rate (candidate - baseline)
+func (c *Comparison) KeepRateDelta() float64 {
+	if c.SamplerTotal == 0 {
+		return 0
+	}
+	return float64(c.CandidateKept-c.BaselineKept) / float64(c.SamplerTotal)
+}
+
+// Compare replays the corpus through the baseline and candidate invokers
+// and reports how their outputs differ.
+func Compare(ctx context.Context, corpus []Record, baseline, candidate Invoker, options CompareOptions) (*Comparison, error) {
+	if options.CategoryKey == "" {
+		options.CategoryKey = "category"
+	}
+	if options.KeepKey == "" {
+		options.KeepKey = "keep"
+	}
+
+	baselineReport, err := Replay(ctx, corpus, baseline, options.Options)
+	if err != nil {
+		return nil, fmt.Errorf("baseline replay failed: %w", err)
+	}
+	candidateReport, err := Replay(ctx, corpus, candidate, options.Options)
+	if err != nil {
+		return nil, fmt.Errorf("candidate replay failed: %w", err)
+	}
+
+	ignored := make(map[string]bool, len(options.IgnoreKeys))
+	for _, k := range options.IgnoreKeys {
+		ignored[k] = true
+	}
+
+	comparison := &Comparison{
+		Total:     len(corpus),
+		ByModel:   make(map[string]*ModelComparison),
+		Confusion: make(map[string]map[string]int),
+	}
+
+	for i, record := range corpus {
+		base := baselineReport.Results[i]
+		cand := candidateReport.Results[i]
+
+		stats, ok := comparison.ByModel[record.Model]
+		if !ok {
+			stats = &ModelComparison{}
+			comparison.ByModel[record.Model] = stats
+		}
+		stats.Total++
+		stats.BaselineLatency += baselineReport.Latencies[i]
+		stats.CandidateLatency += candidateReport.Latencies[i]
+
+		// Failed invocations have no output
+		if base.Output == nil {
+			stats.BaselineFailures++
+		}
+		if cand.Output == nil {
+			stats.CandidateFailures++
+		}
+		if base.Output == nil || cand.Output == nil {
+			continue
+		}
+
+		if len(compareOutputs(i, record.Model, base.Output, cand.Output, ignored, options.Tolerance)) == 0 {
+			stats.Agreed++
+		}
+
+		switch record.Model {
+		case runtime.ModelErrorClassifier:
+			baseCategory := fmt.Sprint(base.Output[options.CategoryKey])
+			candCategory := fmt.Sprint(cand.Output[options.CategoryKey])
+			if comparison.Confusion[baseCategory] == nil {
+				comparison.Confusion[baseCategory] = make(map[string]int)
+			}
+			comparison.Confusion[baseCategory][candCategory]++
+		case runtime.ModelSampler:
+			comparison.SamplerTotal++
+			if keep, _ := base.Output[options.KeepKey].(bool); keep {
+				comparison.BaselineKept++
+			}
+			if keep, _ := cand.Output[options.KeepKey].(bool); keep {
+				comparison.CandidateKept++
+			}
+		}
+	}
+
+	return comparison, nil
+}
+
+// WriteText writes a human readable comparison report
+func (c *Comparison) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Compared %d records\n\n", c.Total)
+
+	models := make([]string, 0, len(c.ByModel))
+	for model := range c.ByModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	fmt.Fprintln(w, "Agreement:")
+	for _, model := range models {
+		stats := c.ByModel[model]
+		fmt.Fprintf(w, "  %-18s %6.2f%% (%d/%d) failures baseline=%d candidate=%d latency_delta=%s\n",
+			model, stats.AgreementRate()*100, stats.Agreed, stats.Total,
+			stats.BaselineFailures, stats.CandidateFailures, stats.LatencyDelta())
+	}
+
+	if c.SamplerTotal > 0 {
+		fmt.Fprintf(w, "\nSampler keep rate: baseline=%.2f%% candidate=%.2f%% delta=%+.2f%%\n",
+			float64(c.BaselineKept)/float64(c.SamplerTotal)*100,
+			float64(c.CandidateKept)/float64(c.SamplerTotal)*100,
+			c.KeepRateDelta()*100)
+	}
+
+	if len(c.Confusion) == 0 {
+		return
+	}
+
+	// Collect all categories seen by either version for the matrix axes
+	categorySet := make(map[string]bool)
+	for base, row := range c.Confusion {
+		categorySet[base] = true
+		for cand := range row {
+			categorySet[cand] = true
+		}
+	}
+	categories := make([]string, 0, len(categorySet))
+	for category := range categorySet {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	fmt.Fprintln(w, "\nError category confusion matrix (rows: baseline, columns: candidate):")
+	fmt.Fprintf(w, "  %-24s", "")
+	for _, category := range categories {
+		fmt.Fprintf(w, " %24s", category)
+	}
+	fmt.Fprintln(w)
+	for _, base := range categories {
+		fmt.Fprintf(w, "  %-24s", base)
+		for _, cand := range categories {
+			fmt.Fprintf(w, " %24d", c.Confusion[base][cand])
+		}
+		fmt.Fprintln(w)
+	}
+}
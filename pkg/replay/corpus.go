@@ -0,0 +1,85 @@
+// Package replay records model invocations to a corpus file and replays
+// them against the current models to catch regressions before rollout.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Record is a single captured model invocation
+type Record struct {
+	// Model is the model type (see the runtime.Model* constants)
+	Model string `json:"model"`
+
+	// Input is the sanitized model input
+	Input map[string]interface{} `json:"input"`
+
+	// Output is the model output observed when the record was captured
+	Output map[string]interface{} `json:"output"`
+
+	// RecordedAt is the capture time
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ReadCorpus reads a JSON-lines corpus file
+func ReadCorpus(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open corpus: %w", err)
+	}
+	defer file.Close()
+
+	return DecodeCorpus(file)
+}
+
+// DecodeCorpus decodes JSON-lines records from a reader
+func DecodeCorpus(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	// Model inputs can be large, allow lines up to 16MB
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid record on line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %w", err)
+	}
+
+	return records, nil
+}
+
+// WriteCorpus writes records to a JSON-lines corpus file, replacing any existing file
+func WriteCorpus(path string, records []Record) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create corpus: %w", err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write record %d: %w", i, err)
+		}
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,222 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/common"
+)
+
+// RedactedValue replaces the value of sensitive keys in recorded inputs
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactKeys are key fragments that are always redacted from recorded
+// inputs and outputs
+var DefaultRedactKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"authorization",
+	"cookie",
+	"api_key",
+	"apikey",
+	"email",
+	"user.id",
+	"enduser",
+}
+
+// RecorderConfig defines how model invocations are captured
+type RecorderConfig struct {
+	// Path of the JSON-lines corpus file, appended to if it exists
+	Path string
+
+	// SampleRate is the fraction of invocations to record (0.0-1.0)
+	SampleRate float64
+
+	// MaxRecords stops recording after this many records (0 for unlimited)
+	MaxRecords int
+
+	// RedactKeys are additional key fragments whose values are redacted
+	RedactKeys []string
+}
+
+// Recorder appends sanitized model invocations to a corpus file.
+// Recorders are shared per path so traces, metrics and logs processors
+// write to a single file.
+type Recorder struct {
+	mutex      sync.Mutex
+	path       string
+	file       *os.File
+	encoder    *json.Encoder
+	sanitizer  *Sanitizer
+	sampleRate float64
+	maxRecords int
+	count      int
+	refs       int
+}
+
+var (
+	recordersMutex sync.Mutex
+	recorders      = make(map[string]*Recorder)
+)
+
+// OpenRecorder opens the recorder for the configured path, creating it if needed
+func OpenRecorder(config RecorderConfig) (*Recorder, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("recording path must be set")
+	}
+
+	recordersMutex.Lock()
+	defer recordersMutex.Unlock()
+
+	if recorder, ok := recorders[config.Path]; ok {
+		recorder.refs++
+		return recorder, nil
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording file: %w", err)
+	}
+
+	recorder := &Recorder{
+		path:       config.Path,
+		file:       file,
+		encoder:    json.NewEncoder(file),
+		sanitizer:  NewSanitizer(config.RedactKeys),
+		sampleRate: config.SampleRate,
+		maxRecords: config.MaxRecords,
+		refs:       1,
+	}
+	recorders[config.Path] = recorder
+
+	return recorder, nil
+}
+
+// Record sanitizes and appends a model invocation with a JSON-encoded input
+// to the corpus. Outputs are sanitized like inputs, since models such as the
+// entity extractor echo values of the items.
+func (r *Recorder) Record(model string, input []byte, output map[string]interface{}) error {
+	if !common.RandomSample(r.sampleRate) {
+		return nil
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(input, &decoded); err != nil {
+		return fmt.Errorf("failed to decode model input: %w", err)
+	}
+
+	record := Record{
+		Model:      model,
+		Input:      r.sanitizer.Sanitize(decoded),
+		Output:     r.sanitizer.Sanitize(output),
+		RecordedAt: time.Now().UTC(),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return fmt.Errorf("recorder is closed")
+	}
+	if r.maxRecords > 0 && r.count >= r.maxRecords {
+		return nil
+	}
+
+	if err := r.encoder.Encode(&record); err != nil {
+		return err
+	}
+	r.count++
+
+	return nil
+}
+
+// Count returns the number of records written since the recorder was opened
+func (r *Recorder) Count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.count
+}
+
+// Close releases the recorder, closing the file once the last user is done
+func (r *Recorder) Close() error {
+	recordersMutex.Lock()
+	defer recordersMutex.Unlock()
+
+	r.refs--
+	if r.refs > 0 {
+		return nil
+	}
+	delete(recorders, r.path)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Sanitizer removes sensitive values from model inputs and outputs before
+// they are recorded or replayed
+type Sanitizer struct {
+	redactKeys []string
+}
+
+// NewSanitizer creates a sanitizer for the default key fragments plus any extra ones
+func NewSanitizer(extraKeys []string) *Sanitizer {
+	keys := make([]string, 0, len(DefaultRedactKeys)+len(extraKeys))
+	for _, k := range DefaultRedactKeys {
+		keys = append(keys, strings.ToLower(k))
+	}
+	for _, k := range extraKeys {
+		keys = append(keys, strings.ToLower(k))
+	}
+	return &Sanitizer{redactKeys: keys}
+}
+
+// Sanitize returns a deep copy of the input with sensitive values redacted
+func (s *Sanitizer) Sanitize(input map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(input))
+	for k, v := range input {
+		if s.isSensitive(k) {
+			result[k] = RedactedValue
+			continue
+		}
+		result[k] = s.sanitizeValue(v)
+	}
+	return result
+}
+
+func (s *Sanitizer) sanitizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.Sanitize(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = s.sanitizeValue(v[i])
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+func (s *Sanitizer) isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range s.redactKeys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
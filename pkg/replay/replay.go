@@ -0,0 +1,275 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// Invoker runs model inferences. *runtime.WasmRuntime satisfies this interface.
+type Invoker interface {
+	ClassifyError(ctx context.Context, input *runtime.ErrorInput) (map[string]interface{}, error)
+	SampleTelemetry(ctx context.Context, input *runtime.SampleInput) (map[string]interface{}, error)
+	ExtractEntities(ctx context.Context, input *runtime.EntityInput) (map[string]interface{}, error)
+}
+
+// Options controls how replayed outputs are compared with the baseline
+type Options struct {
+	// Tolerance is the maximum absolute difference for numeric values to be considered equal
+	Tolerance float64
+
+	// IgnoreKeys are output keys excluded from the comparison
+	IgnoreKeys []string
+
+	// Sanitizer redacts replayed outputs like the recorder redacted the
+	// baseline, so redacted keys compare equal and replayed results hold no
+	// sensitive values. Defaults to the default redact keys.
+	Sanitizer *Sanitizer
+}
+
+// Diff describes a single difference between the baseline and the replayed output
+type Diff struct {
+	Index    int         `json:"index"`
+	Model    string      `json:"model"`
+	Key      string      `json:"key,omitempty"`
+	Baseline interface{} `json:"baseline,omitempty"`
+	Current  interface{} `json:"current,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// ModelStats summarizes replay results for one model
+type ModelStats struct {
+	Total      int `json:"total"`
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+	Failed     int `json:"failed"`
+
+	// Latency is the cumulative inference time for the model
+	Latency time.Duration `json:"latency"`
+}
+
+// Report is the result of replaying a corpus
+type Report struct {
+	Total      int                    `json:"total"`
+	Matched    int                    `json:"matched"`
+	Mismatched int                    `json:"mismatched"`
+	Failed     int                    `json:"failed"`
+	ByModel    map[string]*ModelStats `json:"by_model"`
+	Diffs      []Diff                 `json:"diffs"`
+
+	// Results holds the replayed records, usable as a new baseline
+	Results []Record `json:"-"`
+
+	// Latencies holds the inference time of each replayed record
+	Latencies []time.Duration `json:"-"`
+}
+
+// Invoke dispatches a recorded input to the model identified by name
+func Invoke(ctx context.Context, invoker Invoker, model string, input map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+	return InvokeEncoded(ctx, invoker, model, encoded)
+}
+
+// InvokeEncoded dispatches a JSON-encoded input, as passed to recorders, to
+// the model identified by name
+func InvokeEncoded(ctx context.Context, invoker Invoker, model string, encoded []byte) (map[string]interface{}, error) {
+	typed, err := runtime.DecodeInput(model, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typed := typed.(type) {
+	case *runtime.ErrorInput:
+		return invoker.ClassifyError(ctx, typed)
+	case *runtime.SampleInput:
+		return invoker.SampleTelemetry(ctx, typed)
+	default:
+		return invoker.ExtractEntities(ctx, typed.(*runtime.EntityInput))
+	}
+}
+
+// Replay runs each corpus record through the invoker and compares the
+// sanitized output with the recorded baseline output.
+func Replay(ctx context.Context, corpus []Record, invoker Invoker, options Options) (*Report, error) {
+	report := &Report{
+		ByModel:   make(map[string]*ModelStats),
+		Results:   make([]Record, 0, len(corpus)),
+		Latencies: make([]time.Duration, 0, len(corpus)),
+	}
+
+	sanitizer := options.Sanitizer
+	if sanitizer == nil {
+		sanitizer = NewSanitizer(nil)
+	}
+
+	ignored := make(map[string]bool, len(options.IgnoreKeys))
+	for _, k := range options.IgnoreKeys {
+		ignored[k] = true
+	}
+
+	for i, record := range corpus {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		stats, ok := report.ByModel[record.Model]
+		if !ok {
+			stats = &ModelStats{}
+			report.ByModel[record.Model] = stats
+		}
+		report.Total++
+		stats.Total++
+
+		start := time.Now()
+		output, err := Invoke(ctx, invoker, record.Model, record.Input)
+		elapsed := time.Since(start)
+		stats.Latency += elapsed
+		report.Latencies = append(report.Latencies, elapsed)
+
+		if err != nil {
+			report.Failed++
+			stats.Failed++
+			report.Diffs = append(report.Diffs, Diff{Index: i, Model: record.Model, Error: err.Error()})
+			report.Results = append(report.Results, Record{Model: record.Model, Input: record.Input, RecordedAt: record.RecordedAt})
+			continue
+		}
+
+		output, err = Normalize(sanitizer.Sanitize(output))
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		report.Results = append(report.Results, Record{
+			Model:      record.Model,
+			Input:      record.Input,
+			Output:     output,
+			RecordedAt: record.RecordedAt,
+		})
+
+		diffs := compareOutputs(i, record.Model, record.Output, output, ignored, options.Tolerance)
+		if len(diffs) == 0 {
+			report.Matched++
+			stats.Matched++
+			continue
+		}
+		report.Mismatched++
+		stats.Mismatched++
+		report.Diffs = append(report.Diffs, diffs...)
+	}
+
+	return report, nil
+}
+
+// MismatchRate returns the fraction of records that did not match the baseline
+func (r *Report) MismatchRate() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Mismatched+r.Failed) / float64(r.Total)
+}
+
+// WriteText writes a human readable summary of the report
+func (r *Report) WriteText(w io.Writer, maxDiffs int) {
+	fmt.Fprintf(w, "Replayed %d records: %d matched, %d mismatched, %d failed (mismatch rate %.2f%%)\n",
+		r.Total, r.Matched, r.Mismatched, r.Failed, r.MismatchRate()*100)
+
+	models := make([]string, 0, len(r.ByModel))
+	for model := range r.ByModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	for _, model := range models {
+		stats := r.ByModel[model]
+		avg := time.Duration(0)
+		if stats.Total > 0 {
+			avg = stats.Latency / time.Duration(stats.Total)
+		}
+		fmt.Fprintf(w, "  %-18s total=%d matched=%d mismatched=%d failed=%d avg_latency=%s\n",
+			model, stats.Total, stats.Matched, stats.Mismatched, stats.Failed, avg)
+	}
+
+	for i, diff := range r.Diffs {
+		if maxDiffs > 0 && i >= maxDiffs {
+			fmt.Fprintf(w, "  ... %d more differences\n", len(r.Diffs)-maxDiffs)
+			break
+		}
+		if diff.Error != "" {
+			fmt.Fprintf(w, "  #%d %s: error: %s\n", diff.Index, diff.Model, diff.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  #%d %s: %s: baseline=%v current=%v\n", diff.Index, diff.Model, diff.Key, diff.Baseline, diff.Current)
+	}
+}
+
+// Normalize round-trips a model output through JSON so that values have the
+// same types as outputs read back from a corpus file.
+func Normalize(output map[string]interface{}) (map[string]interface{}, error) {
+	bytes, err := json.Marshal(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal output: %w", err)
+	}
+
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(bytes, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal output: %w", err)
+	}
+	return normalized, nil
+}
+
+// Agree reports whether two normalized outputs hold the same values, numbers
+// differing by at most tolerance
+func Agree(baseline, candidate map[string]interface{}, tolerance float64) bool {
+	return len(compareOutputs(0, "", baseline, candidate, nil, tolerance)) == 0
+}
+
+// compareOutputs returns one diff per key whose value differs
+func compareOutputs(index int, model string, baseline, current map[string]interface{}, ignored map[string]bool, tolerance float64) []Diff {
+	keys := make(map[string]bool, len(baseline)+len(current))
+	for k := range baseline {
+		keys[k] = true
+	}
+	for k := range current {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if !ignored[k] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	var diffs []Diff
+	for _, k := range sorted {
+		if !valuesEqual(baseline[k], current[k], tolerance) {
+			diffs = append(diffs, Diff{
+				Index:    index,
+				Model:    model,
+				Key:      k,
+				Baseline: baseline[k],
+				Current:  current[k],
+			})
+		}
+	}
+	return diffs
+}
+
+func valuesEqual(a, b interface{}, tolerance float64) bool {
+	af, aIsNum := a.(float64)
+	bf, bIsNum := b.(float64)
+	if aIsNum && bIsNum {
+		return math.Abs(af-bf) <= tolerance
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,191 @@
+package replay
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fortxun/caza-otel-ai-processor/pkg/runtime"
+)
+
+// fakeInvoker returns fixed outputs for each model
+type fakeInvoker struct {
+	classification map[string]interface{}
+	sampling       map[string]interface{}
+	entities       map[string]interface{}
+}
+
+func (f *fakeInvoker) ClassifyError(ctx context.Context, input *runtime.ErrorInput) (map[string]interface{}, error) {
+	return f.classification, nil
+}
+
+func (f *fakeInvoker) SampleTelemetry(ctx context.Context, input *runtime.SampleInput) (map[string]interface{}, error) {
+	return f.sampling, nil
+}
+
+func (f *fakeInvoker) ExtractEntities(ctx context.Context, input *runtime.EntityInput) (map[string]interface{}, error) {
+	return f.entities, nil
+}
+
+func TestSanitizerRedactsNestedKeys(t *testing.T) {
+	sanitizer := NewSanitizer([]string{"customer"})
+
+	result := sanitizer.Sanitize(map[string]interface{}{
+		"name": "GET /users",
+		"attributes": map[string]interface{}{
+			"http.method":          "GET",
+			"http.request.Cookie":  "session=abc",
+			"customer.external_id": "c-42",
+		},
+	})
+
+	attributes := result["attributes"].(map[string]interface{})
+	assert.Equal(t, "GET /users", result["name"])
+	assert.Equal(t, "GET", attributes["http.method"])
+	assert.Equal(t, RedactedValue, attributes["http.request.Cookie"])
+	assert.Equal(t, RedactedValue, attributes["customer.external_id"])
+}
+
+func TestRecorderWritesCorpus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+
+	recorder, err := OpenRecorder(RecorderConfig{Path: path, SampleRate: 1.0, MaxRecords: 2})
+	require.NoError(t, err)
+
+	// A second open for the same path shares the recorder
+	shared, err := OpenRecorder(RecorderConfig{Path: path, SampleRate: 1.0, MaxRecords: 2})
+	require.NoError(t, err)
+	assert.Same(t, recorder, shared)
+
+	for i := 0; i < 3; i++ {
+		err := recorder.Record(runtime.ModelErrorClassifier,
+			[]byte(`{"status":"timeout","password":"hunter2"}`),
+			map[string]interface{}{"category": "network_error"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, shared.Close())
+	require.NoError(t, recorder.Close())
+
+	corpus, err := ReadCorpus(path)
+	require.NoError(t, err)
+	require.Len(t, corpus, 2)
+	assert.Equal(t, runtime.ModelErrorClassifier, corpus[0].Model)
+	assert.Equal(t, RedactedValue, corpus[0].Input["password"])
+	assert.Equal(t, "network_error", corpus[0].Output["category"])
+}
+
+func TestRecorderSanitizesOutputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+
+	recorder, err := OpenRecorder(RecorderConfig{Path: path, SampleRate: 1.0})
+	require.NoError(t, err)
+
+	// The entity extractor returns values of the span it looked at
+	err = recorder.Record(runtime.ModelEntityExtractor,
+		[]byte(`{"name":"POST /login","attributes":{"user.email":"jane@example.com"}}`),
+		map[string]interface{}{"service": "auth", "user.email": "jane@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, recorder.Close())
+
+	corpus, err := ReadCorpus(path)
+	require.NoError(t, err)
+	require.Len(t, corpus, 1)
+	assert.Equal(t, "auth", corpus[0].Output["service"])
+	assert.Equal(t, RedactedValue, corpus[0].Output["user.email"])
+}
+
+func TestReplayReportsDifferences(t *testing.T) {
+	corpus := []Record{
+		{
+			Model:  runtime.ModelErrorClassifier,
+			Input:  map[string]interface{}{"status": "connection refused"},
+			Output: map[string]interface{}{"category": "database_error", "confidence": 0.9},
+		},
+		{
+			Model:  runtime.ModelSampler,
+			Input:  map[string]interface{}{"name": "GET /health"},
+			Output: map[string]interface{}{"importance": 0.2, "keep": false},
+		},
+		{
+			Model:  "unknown",
+			Input:  map[string]interface{}{},
+			Output: map[string]interface{}{},
+		},
+	}
+
+	invoker := &fakeInvoker{
+		classification: map[string]interface{}{"category": "network_error", "confidence": 0.9},
+		sampling:       map[string]interface{}{"importance": 0.2000001, "keep": false},
+	}
+
+	report, err := Replay(context.Background(), corpus, invoker, Options{Tolerance: 1e-3})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 1, report.Mismatched)
+	assert.Equal(t, 1, report.Failed)
+	assert.InDelta(t, 2.0/3.0, report.MismatchRate(), 1e-9)
+
+	require.Len(t, report.Diffs, 2)
+	assert.Equal(t, "category", report.Diffs[0].Key)
+	assert.Equal(t, "database_error", report.Diffs[0].Baseline)
+	assert.Equal(t, "network_error", report.Diffs[0].Current)
+	assert.NotEmpty(t, report.Diffs[1].Error)
+
+	// Replayed outputs can be written back as a new baseline
+	assert.Equal(t, "network_error", report.Results[0].Output["category"])
+}
+
+func TestReplayRedactsOutputsLikeTheRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	recorder, err := OpenRecorder(RecorderConfig{Path: path, SampleRate: 1.0, RedactKeys: []string{"customer"}})
+	require.NoError(t, err)
+
+	output := map[string]interface{}{"service": "auth", "user.email": "jane@example.com", "customer": "c-42"}
+	require.NoError(t, recorder.Record(runtime.ModelEntityExtractor, []byte(`{"name":"POST /login"}`), output))
+	require.NoError(t, recorder.Close())
+	corpus, err := ReadCorpus(path)
+	require.NoError(t, err)
+
+	invoker := &fakeInvoker{entities: output}
+	report, err := Replay(context.Background(), corpus, invoker, Options{Sanitizer: NewSanitizer([]string{"customer"})})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Matched)
+	assert.Empty(t, report.Diffs)
+
+	// The new baseline holds no sensitive values either
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, "auth", report.Results[0].Output["service"])
+	assert.Equal(t, RedactedValue, report.Results[0].Output["user.email"])
+	assert.Equal(t, RedactedValue, report.Results[0].Output["customer"])
+}
+
+func TestCompareModelVersions(t *testing.T) {
+	corpus := []Record{
+		{Model: runtime.ModelErrorClassifier, Input: map[string]interface{}{"status": "deadlock detected"}},
+		{Model: runtime.ModelErrorClassifier, Input: map[string]interface{}{"status": "connection reset"}},
+		{Model: runtime.ModelSampler, Input: map[string]interface{}{"name": "GET /orders"}},
+	}
+
+	baseline := &fakeInvoker{
+		classification: map[string]interface{}{"category": "database_error"},
+		sampling:       map[string]interface{}{"importance": 0.3, "keep": false},
+	}
+	candidate := &fakeInvoker{
+		classification: map[string]interface{}{"category": "network_error"},
+		sampling:       map[string]interface{}{"importance": 0.7, "keep": true},
+	}
+
+	comparison, err := Compare(context.Background(), corpus, baseline, candidate, CompareOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, comparison.Total)
+	assert.Equal(t, 0.0, comparison.ByModel[runtime.ModelErrorClassifier].AgreementRate())
+	assert.Equal(t, 2, comparison.Confusion["database_error"]["network_error"])
+	assert.Equal(t, 1, comparison.SamplerTotal)
+	assert.Equal(t, 1.0, comparison.KeepRateDelta())
+}
@@ -0,0 +1,252 @@
+// Package rules classifies model inputs with rules read from a YAML file,
+// so errors can be classified without building a WASM model. The first rule
+// whose matchers all match an input gives the output:
+//
+//	rules:
+//	  - name: database-timeouts
+//	    match:
+//	      body: "(?i)timeout"
+//	      attributes:
+//	        db.system: "^(postgresql|mysql)$"
+//	    output:
+//	      category: database_timeout
+//	      owner: data-team
+//	      severity: high
+//	default:
+//	  category: unknown
+//
+// Matchers are regular expressions matched against the input field of the
+// same name, nested under maps such as attributes and resource. Inputs
+// without the field do not match.
+//
+// A Classifier serves a model on its own as a runtime.ModelBackend, giving
+// inputs no rule matches the default output, or answers the inputs it
+// matches before the model is invoked as a runtime.ModelPrefilter.
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoMatch is returned for inputs no rule matches without a default output
+var ErrNoMatch = errors.New("no rule matches the input")
+
+// Classifier applies the rules of a file. It is safe for concurrent use.
+type Classifier struct {
+	mutex    sync.RWMutex
+	rules    []rule
+	defaults map[string]interface{}
+}
+
+// file is the YAML rules file
+type file struct {
+	Rules []struct {
+		Name   string                 `yaml:"name"`
+		Match  map[string]interface{} `yaml:"match"`
+		Output map[string]interface{} `yaml:"output"`
+	} `yaml:"rules"`
+	Default map[string]interface{} `yaml:"default"`
+}
+
+// rule is a compiled rule
+type rule struct {
+	matcher matcher
+	output  map[string]interface{}
+}
+
+// matcher matches the fields of a map: strings against their regular
+// expression, maps against their nested matcher
+type matcher map[string]interface{}
+
+// Load reads the rules file at path
+func Load(path string) (*Classifier, error) {
+	c := &Classifier{}
+	if err := c.Reload(path); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Parse compiles the rules of a YAML document
+func Parse(data []byte) (*Classifier, error) {
+	rules, defaults, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{rules: rules, defaults: defaults}, nil
+}
+
+// parse compiles the rules and default output of a YAML document
+func parse(data []byte) ([]rule, map[string]interface{}, error) {
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+
+	rules := make([]rule, 0, len(f.Rules))
+	for i, r := range f.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(r.Output) == 0 {
+			return nil, nil, fmt.Errorf("rule %s has no output", name)
+		}
+		if err := checkOutput(r.Output); err != nil {
+			return nil, nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		m, err := compile(r.Match, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		rules = append(rules, rule{matcher: m, output: r.Output})
+	}
+	if err := checkOutput(f.Default); err != nil {
+		return nil, nil, fmt.Errorf("default: %w", err)
+	}
+	return rules, f.Default, nil
+}
+
+// compile compiles the regular expressions of a match specification of
+// the fields under prefix
+func compile(spec map[string]interface{}, prefix string) (matcher, error) {
+	m := make(matcher, len(spec))
+	for key, value := range spec {
+		switch v := value.(type) {
+		case string:
+			regex, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex of %s%s: %w", prefix, key, err)
+			}
+			m[key] = regex
+		case map[string]interface{}:
+			nested, err := compile(v, prefix+key+".")
+			if err != nil {
+				return nil, err
+			}
+			m[key] = nested
+		default:
+			return nil, fmt.Errorf("matcher of %s%s must be a regex or a map", prefix, key)
+		}
+	}
+	return m, nil
+}
+
+// checkOutput verifies that output values can be written as attributes
+func checkOutput(output map[string]interface{}) error {
+	for key, value := range output {
+		switch value.(type) {
+		case string, bool, int, float64:
+		default:
+			return fmt.Errorf("output %s must be a string, number or bool", key)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the fields of input match
+func (m matcher) matches(input map[string]interface{}) bool {
+	for key, expected := range m {
+		value, ok := input[key]
+		if !ok || value == nil {
+			return false
+		}
+		switch e := expected.(type) {
+		case *regexp.Regexp:
+			s, ok := value.(string)
+			if !ok {
+				s = fmt.Sprint(value)
+			}
+			if !e.MatchString(s) {
+				return false
+			}
+		case matcher:
+			nested, ok := value.(map[string]interface{})
+			if !ok || !e.matches(nested) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Classify returns the output of the first rule matching input
+func (c *Classifier) Classify(input map[string]interface{}) (map[string]interface{}, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, r := range c.rules {
+		if r.matcher.matches(input) {
+			return copyOutput(r.output), true
+		}
+	}
+	return nil, false
+}
+
+// Match returns the output of the first rule matching a JSON-encoded input.
+// It implements runtime.ModelPrefilter.
+func (c *Classifier) Match(input []byte) (map[string]interface{}, bool) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(input, &decoded); err != nil {
+		return nil, false
+	}
+	return c.Classify(decoded)
+}
+
+// Invoke returns the output of the first rule matching a JSON-encoded
+// input, or the default output. It implements runtime.ModelBackend.
+func (c *Classifier) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(input, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode model input: %w", err)
+	}
+	if output, ok := c.Classify(decoded); ok {
+		return output, nil
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.defaults == nil {
+		return nil, ErrNoMatch
+	}
+	return copyOutput(c.defaults), nil
+}
+
+// Reload replaces the rules with those of the file at path, keeping the
+// current rules if it is invalid
+func (c *Classifier) Reload(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read rules file: %w", err)
+	}
+	rules, defaults, err := parse(data)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rules, c.defaults = rules, defaults
+	return nil
+}
+
+// Close does nothing, since rules hold no resources
+func (c *Classifier) Close() error {
+	return nil
+}
+
+// copyOutput copies an output, which callers may modify
+func copyOutput(output map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(output))
+	for k, v := range output {
+		result[k] = v
+	}
+	return result
+}
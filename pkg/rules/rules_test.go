@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+rules:
+  - name: database-timeouts
+    match:
+      body: "(?i)timeout"
+      attributes:
+        db.system: "^(postgresql|mysql)$"
+    output:
+      category: database_timeout
+      owner: data-team
+      severity: high
+  - name: payment-errors
+    match:
+      resource:
+        service.name: "^payments"
+      attributes:
+        http.status_code: "^5"
+    output:
+      category: payment_failure
+      confidence: 0.9
+default:
+  category: unknown
+`
+
+func TestClassifierMatchesFirstRule(t *testing.T) {
+	c, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+
+	output, ok := c.Classify(map[string]interface{}{
+		"body":       "Query Timeout after 30s",
+		"attributes": map[string]interface{}{"db.system": "postgresql"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"category": "database_timeout", "owner": "data-team", "severity": "high"}, output)
+
+	// Numbers are matched in their decimal form
+	output, ok = c.Match([]byte(`{"attributes":{"http.status_code":503},"resource":{"service.name":"payments-api"}}`))
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"category": "payment_failure", "confidence": 0.9}, output)
+
+	// Missing fields don't match, the backend gives the default instead
+	input := []byte(`{"body":"timeout","attributes":{}}`)
+	_, ok = c.Match(input)
+	assert.False(t, ok)
+	output, err = c.Invoke(context.Background(), input)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"category": "unknown"}, output)
+
+	c, err = Parse([]byte("rules: []"))
+	require.NoError(t, err)
+	_, err = c.Invoke(context.Background(), input)
+	assert.ErrorIs(t, err, ErrNoMatch)
+}
+
+func TestClassifierReloadKeepsRulesOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRules), 0o644))
+	c, err := Load(path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - match: {name: \"(\"}\n    output: {category: x}\n"), 0o644))
+	assert.ErrorContains(t, c.Reload(path), "rule #1: invalid regex of name")
+	_, ok := c.Classify(map[string]interface{}{"body": "timeout", "attributes": map[string]interface{}{"db.system": "mysql"}})
+	assert.True(t, ok)
+
+	_, err = Parse([]byte("rules:\n  - match: {attributes: {x: [1]}}\n    output: {category: x}\n"))
+	assert.ErrorContains(t, err, "matcher of attributes.x must be a regex or a map")
+	_, err = Parse([]byte("rules:\n  - name: empty\n    match: {}\n"))
+	assert.ErrorContains(t, err, "rule empty has no output")
+}
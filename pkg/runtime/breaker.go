@@ -0,0 +1,167 @@
+// This file contains the circuit breakers that stop invoking models which
+// keep failing or timing out
+
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// States of a model's circuit
+const (
+	// CircuitClosed invokes the model
+	CircuitClosed = "closed"
+
+	// CircuitOpen returns fallback results without invoking the model
+	CircuitOpen = "open"
+
+	// CircuitHalfOpen invokes the model with one probe at a time, returning
+	// fallback results for the other invocations
+	CircuitHalfOpen = "half_open"
+)
+
+// Results of models whose circuit is open
+const (
+	// CircuitFallbackHeuristic returns the heuristic results also used when
+	// inputs are too large or quotas are exhausted
+	CircuitFallbackHeuristic = "heuristic"
+
+	// CircuitFallbackPassThrough returns empty results, so items pass
+	// through without the model's attributes
+	CircuitFallbackPassThrough = "pass_through"
+)
+
+// CircuitBreakerConfig defines when a model's circuit opens and closes
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed invocations,
+	// including timeouts, that open the circuit
+	FailureThreshold int
+
+	// CoolDown is how long the circuit stays open before it is probed
+	CoolDown time.Duration
+
+	// RecoveryProbes is the number of consecutive successful probes that
+	// close the circuit again (default 1)
+	RecoveryProbes int
+
+	// Fallback is CircuitFallbackHeuristic (default) or
+	// CircuitFallbackPassThrough
+	Fallback string
+}
+
+// circuitBreaker tracks the failures of a model's invocations
+type circuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mutex     sync.Mutex
+	state     string
+	failures  int
+	successes int
+	openedAt  time.Time
+	probing   bool
+}
+
+// newCircuitBreaker validates config and creates a closed circuit
+func newCircuitBreaker(config CircuitBreakerConfig) (*circuitBreaker, error) {
+	if config.FailureThreshold <= 0 {
+		return nil, errors.New("failure threshold must be positive")
+	}
+	if config.CoolDown <= 0 {
+		return nil, errors.New("cool-down must be positive")
+	}
+	if config.RecoveryProbes <= 0 {
+		config.RecoveryProbes = 1
+	}
+	switch config.Fallback {
+	case "":
+		config.Fallback = CircuitFallbackHeuristic
+	case CircuitFallbackHeuristic, CircuitFallbackPassThrough:
+	default:
+		return nil, fmt.Errorf("unknown fallback %q", config.Fallback)
+	}
+	return &circuitBreaker{config: config, state: CircuitClosed}, nil
+}
+
+// allow reports whether an invocation may run at now and whether it probes
+// the circuit. Probes must be followed by done or abandon.
+func (b *circuitBreaker) allow(now time.Time) (allowed bool, probe bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case CircuitClosed:
+		return true, false
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.config.CoolDown {
+			return false, false
+		}
+		b.state = CircuitHalfOpen
+	}
+	if b.probing {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// done records the outcome of an allowed invocation and returns the state
+// of the circuit and whether the invocation changed it
+func (b *circuitBreaker) done(probe bool, failed bool, now time.Time) (string, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if probe {
+		b.probing = false
+		if failed {
+			b.open(now)
+			return b.state, true
+		}
+		b.successes++
+		if b.successes < b.config.RecoveryProbes {
+			return b.state, false
+		}
+		b.state, b.failures, b.successes = CircuitClosed, 0, 0
+		return b.state, true
+	}
+
+	// Invocations started before the circuit opened don't count
+	if b.state != CircuitClosed {
+		return b.state, false
+	}
+	if !failed {
+		b.failures = 0
+		return b.state, false
+	}
+	b.failures++
+	if b.failures < b.config.FailureThreshold {
+		return b.state, false
+	}
+	b.open(now)
+	return b.state, true
+}
+
+// abandon releases a probe whose outcome is unknown, such as an invocation
+// cancelled by its caller
+func (b *circuitBreaker) abandon(probe bool) {
+	if !probe {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+}
+
+// open opens the circuit at now. The caller holds the mutex.
+func (b *circuitBreaker) open(now time.Time) {
+	b.state, b.failures, b.successes, b.openedAt = CircuitOpen, 0, 0, now
+}
+
+// current returns the state of the circuit
+func (b *circuitBreaker) current() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
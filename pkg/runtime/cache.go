@@ -1,24 +1,56 @@
 package runtime
 
 import (
+	"context"
 	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2"
 )
 
-// ModelResultsCache caches model inference results
+// cacheShards is the number of independently locked shards of a tenant's
+// cached results
+const cacheShards = 16
+
+// ModelResultsCache caches model inference results. Results are partitioned
+// by tenant, so a tenant is never served another tenant's results and only
+// evicts its own entries. Each partition is split into shards by key, so
+// workers looking up different inputs don't wait for each other.
 type ModelResultsCache struct {
-	cache       *lru.Cache[string, cacheEntry]
-	mutex       sync.RWMutex
+	partitions  *lru.Cache[string, *cachePartition]
 	maxSize     int
+	maxTenants  int
 	ttlSeconds  int
-	hitCount    int64
-	missCount   int64
+	hitCount    atomic.Int64
+	missCount   atomic.Int64
 	enabled     bool
+	
+	// Invocations in flight for missed inputs
+	flightsMutex sync.Mutex
+	flights      map[flightKey]*flight
+}
+
+// flightKey identifies the invocations of a tenant for an input
+type flightKey struct {
+	tenant string
+	input  [sha256.Size]byte
+}
+
+// flight is an invocation whose result is awaited by the callers that
+// missed the cache for the same input
+type flight struct {
+	done   chan struct{}
+	result map[string]interface{}
+	err    error
+}
+
+// cachePartition holds the results of one tenant
+type cachePartition struct {
+	shards    []*lru.Cache[[sha256.Size]byte, cacheEntry]
+	hitCount  atomic.Int64
+	missCount atomic.Int64
 }
 
 // Cache entry with result and expiration time
@@ -27,73 +59,102 @@ type cacheEntry struct {
 	expiresAt time.Time
 }
 
-// NewModelResultsCache creates a new cache for model results
-func NewModelResultsCache(maxSize int, ttlSeconds int) (*ModelResultsCache, error) {
-	if maxSize <= 0 {
+// NewModelResultsCache creates a new cache for model results holding up to
+// maxSize results for each of up to maxTenants tenants. The least recently
+// used tenant's partition is dropped when another tenant is added.
+func NewModelResultsCache(maxSize int, maxTenants int, ttlSeconds int) (*ModelResultsCache, error) {
+	if maxSize <= 0 || maxTenants <= 0 {
 		// Return a disabled cache
 		return &ModelResultsCache{
 			enabled: false,
 		}, nil
 	}
 
-	cache, err := lru.New[string, cacheEntry](maxSize)
+	partitions, err := lru.New[string, *cachePartition](maxTenants)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ModelResultsCache{
-		cache:      cache,
+		partitions: partitions,
 		maxSize:    maxSize,
+		maxTenants: maxTenants,
 		ttlSeconds: ttlSeconds,
 		enabled:    true,
+		flights:    make(map[flightKey]*flight),
 	}, nil
 }
 
-// Get retrieves a result from the cache
-func (c *ModelResultsCache) Get(input map[string]interface{}) (map[string]interface{}, bool) {
-	if !c.enabled {
-		return nil, false
+// newCachePartition creates the shards of a partition holding about maxSize
+// results. Entries are evicted per shard, so eviction is approximately LRU.
+func newCachePartition(maxSize int) (*cachePartition, error) {
+	numShards := cacheShards
+	if maxSize < numShards {
+		numShards = maxSize
 	}
+	shardSize := (maxSize + numShards - 1) / numShards
 
-	// Create a key from the input
-	key, err := c.createKey(input)
-	if err != nil {
-		return nil, false
+	partition := &cachePartition{shards: make([]*lru.Cache[[sha256.Size]byte, cacheEntry], numShards)}
+	for i := range partition.shards {
+		shard, err := lru.New[[sha256.Size]byte, cacheEntry](shardSize)
+		if err != nil {
+			return nil, err
+		}
+		partition.shards[i] = shard
+	}
+	return partition, nil
+}
+
+// shard returns the shard holding key
+func (p *cachePartition) shard(key [sha256.Size]byte) *lru.Cache[[sha256.Size]byte, cacheEntry] {
+	return p.shards[int(key[0])%len(p.shards)]
+}
+
+// len returns the number of results in the partition
+func (p *cachePartition) len() int {
+	size := 0
+	for _, shard := range p.shards {
+		size += shard.Len()
 	}
+	return size
+}
 
-	c.mutex.RLock()
-	entry, found := c.cache.Get(key)
-	c.mutex.RUnlock()
+// Get retrieves a result of tenant for a JSON-encoded input from the cache
+func (c *ModelResultsCache) Get(tenant string, input []byte) (map[string]interface{}, bool) {
+	if !c.enabled {
+		return nil, false
+	}
 
+	partition, found := c.partitions.Get(tenant)
 	if !found {
-		c.missCount++
+		c.missCount.Add(1)
 		return nil, false
 	}
 
-	// Check if the entry has expired
-	if time.Now().After(entry.expiresAt) {
-		c.mutex.Lock()
-		c.cache.Remove(key)
-		c.mutex.Unlock()
-		c.missCount++
+	// Create a key from the input
+	key := sha256.Sum256(input)
+
+	// Expired entries are misses and are replaced by the next Put
+	entry, found := partition.shard(key).Get(key)
+	if !found || time.Now().After(entry.expiresAt) {
+		partition.missCount.Add(1)
+		c.missCount.Add(1)
 		return nil, false
 	}
 
-	c.hitCount++
+	partition.hitCount.Add(1)
+	c.hitCount.Add(1)
 	return entry.result, true
 }
 
-// Put adds a result to the cache
-func (c *ModelResultsCache) Put(input map[string]interface{}, result map[string]interface{}) error {
+// Put adds a result of tenant for a JSON-encoded input to the cache
+func (c *ModelResultsCache) Put(tenant string, input []byte, result map[string]interface{}) error {
 	if !c.enabled {
 		return nil
 	}
 
 	// Create a key from the input
-	key, err := c.createKey(input)
-	if err != nil {
-		return err
-	}
+	key := sha256.Sum256(input)
 
 	// Create a deep copy of the result to avoid modifying the cached value
 	resultCopy := make(map[string]interface{})
@@ -106,14 +167,123 @@ func (c *ModelResultsCache) Put(input map[string]interface{}, result map[string]
 		expiresAt: time.Now().Add(time.Duration(c.ttlSeconds) * time.Second),
 	}
 
-	c.mutex.Lock()
-	c.cache.Add(key, entry)
-	c.mutex.Unlock()
+	partition, err := c.partition(tenant)
+	if err != nil {
+		return err
+	}
+	partition.shard(key).Add(key, entry)
+
+	return nil
+}
+
+// partition returns the partition of tenant, adding it if needed
+func (c *ModelResultsCache) partition(tenant string) (*cachePartition, error) {
+	if partition, found := c.partitions.Get(tenant); found {
+		return partition, nil
+	}
+	created, err := newCachePartition(c.maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another worker may have added the partition in the meantime
+	if existing, found, _ := c.partitions.PeekOrAdd(tenant, created); found {
+		return existing, nil
+	}
+	return created, nil
+}
+
+// CachedResult is a result held by the cache, as snapshots of the cache
+// hold it. Key is the SHA-256 digest of the input.
+type CachedResult struct {
+	Tenant    string
+	Key       [sha256.Size]byte
+	Result    map[string]interface{}
+	ExpiresAt time.Time
+}
 
+// Snapshot calls fn with the unexpired results of every tenant, the least
+// recently used tenants first and, within each shard, the least recently
+// used results first, so restoring them in order keeps the recent ones.
+func (c *ModelResultsCache) Snapshot(fn func(result CachedResult)) {
+	if !c.enabled {
+		return
+	}
+
+	now := time.Now()
+	for _, tenant := range c.partitions.Keys() {
+		partition, found := c.partitions.Peek(tenant)
+		if !found {
+			continue
+		}
+		for _, shard := range partition.shards {
+			for _, key := range shard.Keys() {
+				entry, found := shard.Peek(key)
+				if !found || now.After(entry.expiresAt) {
+					continue
+				}
+				fn(CachedResult{Tenant: tenant, Key: key, Result: entry.result, ExpiresAt: entry.expiresAt})
+			}
+		}
+	}
+}
+
+// Restore adds a result of a snapshot to the cache, unless it expired
+func (c *ModelResultsCache) Restore(result CachedResult) error {
+	if !c.enabled || time.Now().After(result.ExpiresAt) {
+		return nil
+	}
+	partition, err := c.partition(result.Tenant)
+	if err != nil {
+		return err
+	}
+	partition.shard(result.Key).Add(result.Key, cacheEntry{result: result.Result, expiresAt: result.ExpiresAt})
 	return nil
 }
 
-// GetStats returns cache statistics
+// Do returns the result of tenant for a JSON-encoded input, calling invoke
+// on a miss. Concurrent misses for the same input wait for the first
+// caller's invocation and share its result instead of invoking the model
+// again. A failed invocation isn't shared, the waiting callers invoke the
+// model themselves. invoke is responsible for adding its result to the cache.
+func (c *ModelResultsCache) Do(ctx context.Context, tenant string, input []byte,
+	invoke func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if !c.enabled {
+		return invoke()
+	}
+	if result, found := c.Get(tenant, input); found {
+		return result, nil
+	}
+
+	key := flightKey{tenant: tenant, input: sha256.Sum256(input)}
+	c.flightsMutex.Lock()
+	if pending, found := c.flights[key]; found {
+		c.flightsMutex.Unlock()
+		select {
+		case <-pending.done:
+			if pending.err == nil {
+				return pending.result, nil
+			}
+			return invoke()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	current := &flight{done: make(chan struct{})}
+	c.flights[key] = current
+	c.flightsMutex.Unlock()
+
+	defer func() {
+		c.flightsMutex.Lock()
+		delete(c.flights, key)
+		c.flightsMutex.Unlock()
+		close(current.done)
+	}()
+	current.result, current.err = invoke()
+	return current.result, current.err
+}
+
+// GetStats returns cache statistics, in total and per tenant
 func (c *ModelResultsCache) GetStats() map[string]interface{} {
 	if !c.enabled {
 		return map[string]interface{}{
@@ -121,44 +291,60 @@ func (c *ModelResultsCache) GetStats() map[string]interface{} {
 		}
 	}
 
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	size := 0
+	tenants := make(map[string]interface{}, c.partitions.Len())
+	for _, tenant := range c.partitions.Keys() {
+		partition, found := c.partitions.Peek(tenant)
+		if !found {
+			continue
+		}
+		partitionSize := partition.len()
+		size += partitionSize
+		tenants[tenant] = map[string]interface{}{
+			"size":       partitionSize,
+			"hit_count":  partition.hitCount.Load(),
+			"miss_count": partition.missCount.Load(),
+		}
+	}
 
+	hitCount := c.hitCount.Load()
+	missCount := c.missCount.Load()
 	return map[string]interface{}{
 		"enabled":     true,
-		"size":        c.cache.Len(),
+		"size":        size,
 		"max_size":    c.maxSize,
+		"max_tenants": c.maxTenants,
 		"ttl_seconds": c.ttlSeconds,
-		"hit_count":   c.hitCount,
-		"miss_count":  c.missCount,
-		"hit_ratio":   float64(c.hitCount) / float64(c.hitCount+c.missCount),
+		"hit_count":   hitCount,
+		"miss_count":  missCount,
+		"hit_ratio":   float64(hitCount) / float64(hitCount+missCount),
+		"tenants":     tenants,
 	}
 }
 
+// Counts returns the number of lookups served from the cache and missing it
+func (c *ModelResultsCache) Counts() (hits, misses int64) {
+	return c.hitCount.Load(), c.missCount.Load()
+}
+
 // Clear clears the cache
 func (c *ModelResultsCache) Clear() {
 	if !c.enabled {
 		return
 	}
 
-	c.mutex.Lock()
-	c.cache.Purge()
-	c.hitCount = 0
-	c.missCount = 0
-	c.mutex.Unlock()
+	c.partitions.Purge()
+	c.hitCount.Store(0)
+	c.missCount.Store(0)
 }
 
-// createKey creates a cache key from the input
-func (c *ModelResultsCache) createKey(input map[string]interface{}) (string, error) {
-	// Serialize the input to JSON
-	bytes, err := json.Marshal(input)
-	if err != nil {
-		return "", err
+// ClearTenant removes the results of tenant from the cache
+func (c *ModelResultsCache) ClearTenant(tenant string) {
+	if !c.enabled {
+		return
 	}
 
-	// Create a hash of the serialized input
-	hash := sha256.Sum256(bytes)
-	return hex.EncodeToString(hash[:]), nil
+	c.partitions.Remove(tenant)
 }
 
 // ResourceCache caches processed resources
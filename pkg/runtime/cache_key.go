@@ -0,0 +1,64 @@
+// This file contains the selection of the input fields forming the cache
+// keys of model results
+
+package runtime
+
+import (
+	"github.com/fortxun/caza-otel-ai-processor/pkg/logtemplate"
+)
+
+// CacheKey selects the fields of a model's input that its cached results
+// are keyed by. Inputs differing only in other fields, such as timestamps,
+// durations or request IDs, share a cached result.
+type CacheKey struct {
+	// Fields are the input fields forming the key, named as ONNX features,
+	// e.g. "name" or "attributes.db.system". All fields form the key if
+	// empty.
+	Fields []string
+
+	// Templates are fields whose string values form the key by their
+	// template, e.g. "status" or "body", so messages differing only by
+	// numbers and identifiers share a key
+	Templates []string
+}
+
+// enabled reports whether the key differs from the whole input
+func (k *CacheKey) enabled() bool {
+	return k != nil && (len(k.Fields) > 0 || len(k.Templates) > 0)
+}
+
+// key returns the cache key of a JSON-encoded input. Inputs that can't be
+// decoded are their own key.
+func (k *CacheKey) key(input []byte) []byte {
+	if !k.enabled() {
+		return input
+	}
+	var fields map[string]interface{}
+	if err := jsonAPI.Unmarshal(input, &fields); err != nil {
+		return input
+	}
+
+	selected := make(map[string]interface{}, len(k.Fields)+len(k.Templates))
+	if len(k.Fields) == 0 {
+		for field, value := range fields {
+			selected[field] = value
+		}
+	}
+	for _, field := range k.Fields {
+		selected[field] = lookupFeature(fields, field)
+	}
+	for _, field := range k.Templates {
+		value := lookupFeature(fields, field)
+		if message, ok := value.(string); ok {
+			value = logtemplate.Template(message)
+		}
+		selected[field] = value
+	}
+
+	// Map keys are sorted, so equal selections encode to equal keys
+	key, err := jsonAPI.Marshal(selected)
+	if err != nil {
+		return input
+	}
+	return key
+}
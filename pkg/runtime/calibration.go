@@ -0,0 +1,93 @@
+// This file contains the calibration of model scores, which maps the scores
+// models return on scales of their own, such as logits or percentages, to
+// the 0-1 scale the processor samples by
+
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DefaultCalibrationKey is the output calibrated when no key is set, the
+// importance read by sampling decisions
+const DefaultCalibrationKey = "importance"
+
+// Calibration maps a numeric output of a model to the 0-1 scale by linear
+// interpolation between points. Scores below the first point or above the
+// last get the score of that point.
+type Calibration struct {
+	// Key is the output calibrated, DefaultCalibrationKey if empty
+	Key string
+
+	// Points map raw scores to calibrated ones, at least two with
+	// distinct raw scores
+	Points []CalibrationPoint
+}
+
+// CalibrationPoint maps a raw score to a calibrated score
+type CalibrationPoint struct {
+	Raw   float64
+	Score float64
+}
+
+// calibration is a Calibration prepared for applying it
+type calibration struct {
+	key    string
+	points []CalibrationPoint
+}
+
+// newCalibration validates a calibration and sorts its points
+func newCalibration(config *Calibration) (*calibration, error) {
+	if len(config.Points) < 2 {
+		return nil, errors.New("calibration needs at least two points")
+	}
+	points := append([]CalibrationPoint(nil), config.Points...)
+	sort.Slice(points, func(i, j int) bool { return points[i].Raw < points[j].Raw })
+	for i, point := range points {
+		if point.Score < 0 || point.Score > 1 {
+			return nil, fmt.Errorf("calibrated score %v of raw score %v is not between 0 and 1", point.Score, point.Raw)
+		}
+		if i > 0 && point.Raw == points[i-1].Raw {
+			return nil, fmt.Errorf("raw score %v is calibrated twice", point.Raw)
+		}
+	}
+	key := config.Key
+	if key == "" {
+		key = DefaultCalibrationKey
+	}
+	return &calibration{key: key, points: points}, nil
+}
+
+// apply returns the output with its score calibrated. Outputs without a
+// numeric score are returned unchanged, and the output is not modified.
+func (c *calibration) apply(output map[string]interface{}) map[string]interface{} {
+	if c == nil || output == nil {
+		return output
+	}
+	raw, ok := numericValue(output[c.key])
+	if !ok {
+		return output
+	}
+	result := make(map[string]interface{}, len(output))
+	for key, value := range output {
+		result[key] = value
+	}
+	result[c.key] = c.score(raw)
+	return result
+}
+
+// score returns the calibrated score of a raw score
+func (c *calibration) score(raw float64) float64 {
+	first, last := c.points[0], c.points[len(c.points)-1]
+	if raw <= first.Raw {
+		return first.Score
+	}
+	if raw >= last.Raw {
+		return last.Score
+	}
+	i := sort.Search(len(c.points), func(i int) bool { return c.points[i].Raw >= raw })
+	low, high := c.points[i-1], c.points[i]
+	return low.Score + (raw-low.Raw)/(high.Raw-low.Raw)*(high.Score-low.Score)
+}
@@ -0,0 +1,35 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalibrationInterpolatesBetweenPoints(t *testing.T) {
+	c, err := newCalibration(&Calibration{Points: []CalibrationPoint{
+		{Raw: 100, Score: 1},
+		{Raw: 0, Score: 0},
+		{Raw: 50, Score: 0.2},
+	}})
+	require.NoError(t, err)
+
+	for raw, expected := range map[float64]float64{-10: 0, 0: 0, 25: 0.1, 50: 0.2, 75: 0.6, 100: 1, 150: 1} {
+		assert.InDelta(t, expected, c.score(raw), 1e-9, "raw score %v", raw)
+	}
+
+	output := map[string]interface{}{"importance": 25, "reason": "slow"}
+	assert.Equal(t, map[string]interface{}{"importance": 0.1, "reason": "slow"}, c.apply(output))
+	assert.Equal(t, 25, output["importance"])
+
+	// Outputs without a numeric score are left alone
+	assert.Equal(t, map[string]interface{}{"reason": "slow"}, c.apply(map[string]interface{}{"reason": "slow"}))
+
+	_, err = newCalibration(&Calibration{Points: []CalibrationPoint{{Raw: 0, Score: 0}}})
+	assert.Error(t, err)
+	_, err = newCalibration(&Calibration{Points: []CalibrationPoint{{Raw: 0, Score: 0}, {Raw: 1, Score: 2}}})
+	assert.Error(t, err)
+	_, err = newCalibration(&Calibration{Points: []CalibrationPoint{{Raw: 1, Score: 0}, {Raw: 1, Score: 1}}})
+	assert.Error(t, err)
+}
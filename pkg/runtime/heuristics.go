@@ -0,0 +1,70 @@
+// This file contains the heuristic model results used by the stub runtime
+// and as a fallback when a tenant's model invocation quota is exhausted or
+// a model's circuit is open
+
+package runtime
+
+// heuristicClassifyError returns a default error classification
+func heuristicClassifyError() map[string]interface{} {
+	return map[string]interface{}{
+		"error_type":  "unknown",
+		"error_cause": "system",
+		"severity":    "medium",
+		"confidence":  0.95,
+		"owner":       "platform-team",
+	}
+}
+
+// heuristicSample rates errors and database operations as important
+func heuristicSample(name string, status string) map[string]interface{} {
+	hasError := status == "error"
+
+	// Determine importance based on name and error status
+	importance := 0.5 // default medium importance
+	if hasError {
+		importance = 0.9 // high importance for errors
+	}
+	if name != "" && (len(name) > 3 && (name[:3] == "db." || name[:3] == "sql")) {
+		importance = 0.8 // higher importance for database operations
+	}
+
+	return map[string]interface{}{
+		"importance": importance,
+		"keep":       importance > 0.3,
+		"confidence": 0.9,
+	}
+}
+
+// heuristicExtractEntities derives the service and operation type from the name
+func heuristicExtractEntities(name string) map[string]interface{} {
+	entities := map[string]interface{}{
+		"service":        "unknown-service",
+		"operation_type": "unknown",
+		"confidence":     0.8,
+	}
+
+	if name != "" {
+		if len(name) > 3 && name[:3] == "db." {
+			entities["service"] = "database"
+			entities["operation_type"] = "data-access"
+		} else if len(name) > 4 && name[:4] == "http" {
+			entities["service"] = "web-api"
+			entities["operation_type"] = "http-request"
+		}
+	}
+
+	return entities
+}
+
+// heuristic returns the heuristic result of a model
+func heuristic(model string, input ModelInput) map[string]interface{} {
+	name, status := input.summary()
+	switch model {
+	case ModelErrorClassifier:
+		return heuristicClassifyError()
+	case ModelSampler:
+		return heuristicSample(name, status)
+	default:
+		return heuristicExtractEntities(name)
+	}
+}
@@ -5,11 +5,45 @@ package runtime
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// Model type names accepted by ReloadModel and reported to recorders
+const (
+	ModelErrorClassifier = "error_classifier"
+	ModelSampler         = "sampler"
+	ModelEntityExtractor = "entity_extractor"
+)
+
+// ABIs a WASM model can exchange its inputs and outputs with
+const (
+	// ABIRaw passes UTF-8 JSON through memory reserved with the module's
+	// alloc and dealloc exports
+	ABIRaw = "raw"
+	
+	// ABITinyGo passes UTF-8 JSON through memory reserved with the malloc
+	// and free exports of TinyGo modules
+	ABITinyGo = "tinygo"
+	
+	// ABIAssemblyScript passes JSON as AssemblyScript strings to functions
+	// declared as f(input: string): string
+	ABIAssemblyScript = "assemblyscript"
+	
+	// ABIRust passes UTF-8 JSON like ABIRaw, but functions return a pointer
+	// to a length-prefixed output, as is natural for Rust modules
+	ABIRust = "rust"
+	
+	// ABIComponent passes typed records to the functions of components
+	// implementing the model world of wasm-models/wit/model.wit
+	ABIComponent = "component"
+)
+
 // WasmRuntimeConfig defines the configuration for the Wasm runtime.
 type WasmRuntimeConfig struct {
 	ErrorClassifierPath   string
@@ -22,11 +56,135 @@ type WasmRuntimeConfig struct {
 	// EnableModelCaching enables caching model results
 	EnableModelCaching bool
 	
-	// ModelCacheSize defines the size of the model results cache
+	// ModelCacheSize defines the size of the model results cache of each tenant
 	ModelCacheSize int
 	
+	// ModelCacheTenants defines how many tenants' results are cached
+	ModelCacheTenants int
+	
 	// ModelCacheTTLSeconds defines the TTL for cached model results
 	ModelCacheTTLSeconds int
+	
+	// CacheKeys select the input fields cached results are keyed by, keyed
+	// by model name. Results of models without one are keyed by the whole
+	// input.
+	CacheKeys map[string]CacheKey
+	
+	// CompiledModuleCacheDir is the directory where compiled WASM modules
+	// are cached across restarts, empty to compile models on every load
+	CompiledModuleCacheDir string
+	
+	// Engine tunes the compilation of WASM models
+	Engine EngineConfig
+	
+	// InputLimits bound the inputs of the models, keyed by model name
+	InputLimits map[string]InputLimits
+	
+	// ABIs selects the ABI of the WASM models, keyed by model name. Models
+	// without one use ABIRaw.
+	ABIs map[string]string
+	
+	// Fuel bounds the WebAssembly operators each invocation of a model
+	// executes, keyed by model name. Invocations running out of fuel fail.
+	// If any model has a budget, all models are compiled with metering.
+	Fuel map[string]uint64
+	
+	// Sandboxes constrain the host access of the WASM models, keyed by
+	// model name. Models without one get the default sandbox.
+	Sandboxes map[string]Sandbox
+	
+	// Instances is the number of instances of each WASM model, keyed by
+	// model name, which are invoked in turn. Models without one have a
+	// single instance.
+	Instances map[string]int
+	
+	// Exports are functions the WASM models must export, keyed by model
+	// name, such as the ones listed by the manifest of a model bundle.
+	// Models missing one fail to load.
+	Exports map[string][]string
+	
+	// Rules post-processing the outputs of each model, keyed by model name
+	OutputRules map[string]OutputRules
+	
+	// Calibrations mapping the scores of each model to the 0-1 scale,
+	// keyed by model name. They apply to the model's own outputs, before
+	// post-processing, and not to heuristics or prefilter results.
+	Calibrations map[string]Calibration
+	
+	// MaxConcurrentInvocations bounds the invocations of all models running
+	// at once, whatever their backend, 0 for no limit. Invocations beyond
+	// it wait for a slot.
+	MaxConcurrentInvocations int
+	
+	// InferenceThreads runs WASM invocations on that many goroutines locked
+	// to their own OS threads, 0 to run them on the calling goroutines
+	InferenceThreads int
+	
+	// Timeouts bound each invocation of a model, keyed by model name.
+	// Invocations still running at the deadline fail with ErrModelTimeout.
+	Timeouts map[string]time.Duration
+	
+	// CircuitBreakers stop invoking models that keep failing, keyed by
+	// model name
+	CircuitBreakers map[string]CircuitBreakerConfig
+	
+	// NegativeCaches stop invoking models with the inputs they failed on
+	// until a backoff expires, keyed by model name
+	NegativeCaches map[string]NegativeCacheConfig
+}
+
+// Sandbox constrains what a WASM model can do through its imports
+type Sandbox struct {
+	// Directories are the host directories preopened for WASI modules
+	Directories []string
+	
+	// FrozenClock makes WASI clocks read the Unix epoch and sleeps fail
+	FrozenClock bool
+	
+	// DeterministicRandom makes WASI randomness a sequence seeded by
+	// RandomSeed, restarting when the model is loaded
+	DeterministicRandom bool
+	RandomSeed          uint64
+	
+	// AllowedImports lists the functions a module may import as
+	// module.name. Modules importing others fail to load. All imports the
+	// runtime provides are allowed if empty.
+	AllowedImports []string
+}
+
+// WASM runtimes the models can run in
+const (
+	// RuntimeWasmer runs the models in wasmer, which requires cgo
+	RuntimeWasmer = "wasmer"
+	
+	// RuntimeWazero runs the models in wazero, which is pure Go
+	RuntimeWazero = "wazero"
+	
+	// RuntimeWasmtime runs the models in wasmtime, which requires cgo and
+	// builds with the wasmtime tag
+	RuntimeWasmtime = "wasmtime"
+)
+
+// EngineConfig selects how WASM models are compiled. Empty settings use
+// the runtime's defaults.
+type EngineConfig struct {
+	// Runtime is RuntimeWasmer, RuntimeWazero or RuntimeWasmtime. Builds
+	// with the wazero tag only include wazero, which they use by default;
+	// builds with the wasmtime tag include wasmtime and wazero and use
+	// wasmtime by default; other builds include wasmer and wazero and use
+	// wasmer by default.
+	Runtime string
+	
+	// Compiler is "cranelift", "llvm" or "singlepass" with wasmer,
+	// "compiler" or "interpreter" with wazero, and "cranelift" with wasmtime
+	Compiler string
+	
+	// Engine is "universal" or "dylib", only with wasmer
+	Engine string
+	
+	// CPUFeatures are host CPU features the compiler may use, such as
+	// "sse4.2" or "avx2", only with wasmer
+	CPUFeatures []string
 }
 
 // WasmRuntime manages the WASM modules and provides methods to invoke them.
@@ -39,15 +197,162 @@ type WasmRuntime struct {
 	samplerCache         *ModelResultsCache
 	entityExtractorCache *ModelResultsCache
 	
+	// Optional recorder that captures model inputs and outputs
+	recorder InvocationRecorder
+	
+	// Optional observer of the duration and errors of invocations
+	observer InvocationObserver
+	
+	// Models served by a backend other than WASM and the backend kinds,
+	// keyed by model name
+	backends     map[string]ModelBackend
+	backendKinds map[string]string
+	
+	// Models whose WASM module is invoked when their backend fails
+	fallbacks map[string]bool
+	
+	// Prefilters answering inputs before their model is invoked, keyed by
+	// model name
+	prefilters map[string]ModelPrefilter
+	
+	// Optional per-tenant invocation quota
+	quota QuotaLimiter
+	
+	// Limits applied to the inputs of each model, keyed by model name
+	limits map[string]*InputLimits
+	
+	// Fields the cached results of each model are keyed by, keyed by model
+	// name
+	cacheKeys map[string]*CacheKey
+	
+	// Rules post-processing the outputs of each model, keyed by model name
+	outputs map[string]*outputRules
+	
+	// Calibrations of the scores of each model, keyed by model name
+	calibrations map[string]*calibration
+	
+	// Dedicated threads running WASM invocations, nil to run them on the
+	// calling goroutines
+	threads *inferenceThreads
+	
+	// Slots of the invocations running at once, nil if unbounded
+	invocations chan struct{}
+	
+	// Invocation timeouts and the number of invocations that timed out,
+	// keyed by model name
+	timeouts      map[string]time.Duration
+	timeoutCounts map[string]*atomic.Int64
+	
+	// Circuit breakers of the models that have one, keyed by model name
+	breakers map[string]*circuitBreaker
+	
+	// Inputs the models that have a negative cache failed on, keyed by
+	// model name
+	negatives map[string]*negativeCache
+	
 	// Implementation details are in the implementation-specific files
 	impl wasmRuntimeImpl
 }
 
-// Interface for the implementation-specific parts
+// InvocationRecorder receives the JSON-encoded input and the output of every
+// successful model invocation. It is used to capture corpora for replay testing.
+// The input is only valid during Record.
+type InvocationRecorder interface {
+	Record(model string, input []byte, output map[string]interface{}) error
+	Close() error
+}
+
+// InvocationObserver is notified of every model invocation that is not
+// served from the cache or replaced by a heuristic, with its duration and
+// its error, if any. Invocations of blocked backends are only reported with
+// ErrBackendBlocked.
+type InvocationObserver interface {
+	ObserveInvocation(ctx context.Context, model string, duration time.Duration, err error)
+}
+
+// Backend kinds, used to restrict which backends may receive data
+const (
+	BackendWasm    = "wasm"
+	BackendSidecar = "sidecar"
+	BackendTriton  = "triton"
+	BackendRemote  = "remote"
+	BackendRules   = "rules"
+	BackendONNX    = "onnx"
+)
+
+// ErrBackendBlocked is returned when a model's backend is blocked for the data
+var ErrBackendBlocked = errors.New("model backend is blocked for this data")
+
+// ErrModelTimeout is returned when a model invocation exceeds its timeout
+var ErrModelTimeout = errors.New("model invocation timed out")
+
+// blockedBackendsKey is the context key of the backend kinds blocked for a request
+type blockedBackendsKey struct{}
+
+// WithBlockedBackends returns a context in which models served by the given
+// backend kinds are not invoked, for example to keep data from restricted
+// regions away from remote inference servers
+func WithBlockedBackends(ctx context.Context, kinds []string) context.Context {
+	if len(kinds) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, blockedBackendsKey{}, kinds)
+}
+
+// isBlocked reports whether the backend kind is blocked in ctx
+func isBlocked(ctx context.Context, kind string) bool {
+	blocked, _ := ctx.Value(blockedBackendsKey{}).([]string)
+	for _, b := range blocked {
+		if b == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantKey is the context key of the tenant a request is made for
+type tenantKey struct{}
+
+// WithTenant returns a context for requests made on behalf of tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of a request, or "" if none is set
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// QuotaLimiter decides whether a tenant may invoke a model. Allow is called
+// for every invocation that is not served from the cache.
+type QuotaLimiter interface {
+	Allow(tenant string) bool
+}
+
+// ModelBackend serves a model outside the WASM runtime, for example a model
+// sidecar process. Backends replace the WASM module of their model and
+// receive its JSON-encoded input. The input is only valid during Invoke,
+// backends that hold on to it must copy it.
+type ModelBackend interface {
+	Invoke(ctx context.Context, input []byte) (map[string]interface{}, error)
+	Reload(path string) error
+	Close() error
+}
+
+// ModelPrefilter answers the inputs of a model it can decide without
+// invoking the model, such as inputs matching classification rules. It
+// receives the JSON-encoded input, which is only valid during Match.
+type ModelPrefilter interface {
+	Match(input []byte) (map[string]interface{}, bool)
+}
+
+// Interface for the implementation-specific parts. Each model receives its
+// typed input together with the input's JSON encoding.
 type wasmRuntimeImpl interface {
-	ClassifyError(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error)
-	SampleTelemetry(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error)
-	ExtractEntities(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error)
+	ClassifyError(ctx context.Context, input *ErrorInput, encoded []byte) (map[string]interface{}, error)
+	SampleTelemetry(ctx context.Context, input *SampleInput, encoded []byte) (map[string]interface{}, error)
+	ExtractEntities(ctx context.Context, input *EntityInput, encoded []byte) (map[string]interface{}, error)
 	ReloadModel(modelType string, path string) error
 	Close() error
 }
@@ -55,81 +360,561 @@ type wasmRuntimeImpl interface {
 // Public API methods that delegate to the implementation
 
 // ClassifyError classifies an error using the error classifier model.
-func (r *WasmRuntime) ClassifyError(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error) {
-	// Check cache first if enabled
-	if r.errorClassifierCache != nil {
-		if cachedResult, found := r.errorClassifierCache.Get(errorInfo); found {
-			return cachedResult, nil
+func (r *WasmRuntime) ClassifyError(ctx context.Context, input *ErrorInput) (map[string]interface{}, error) {
+	return r.run(ctx, ModelErrorClassifier, r.errorClassifierCache, input,
+		func(ctx context.Context, encoded []byte) (map[string]interface{}, error) {
+			return r.impl.ClassifyError(ctx, input, encoded)
+		})
+}
+
+// SampleTelemetry determines whether to sample a telemetry item.
+func (r *WasmRuntime) SampleTelemetry(ctx context.Context, input *SampleInput) (map[string]interface{}, error) {
+	return r.run(ctx, ModelSampler, r.samplerCache, input,
+		func(ctx context.Context, encoded []byte) (map[string]interface{}, error) {
+			return r.impl.SampleTelemetry(ctx, input, encoded)
+		})
+}
+
+// ExtractEntities extracts entities from a telemetry item.
+func (r *WasmRuntime) ExtractEntities(ctx context.Context, input *EntityInput) (map[string]interface{}, error) {
+	return r.run(ctx, ModelEntityExtractor, r.entityExtractorCache, input,
+		func(ctx context.Context, encoded []byte) (map[string]interface{}, error) {
+			return r.impl.ExtractEntities(ctx, input, encoded)
+		})
+}
+
+// run encodes the input of a model once, then serves it from the cache or
+// invokes the model and caches and records the result. Identical inputs
+// missing the cache at the same time invoke the model once.
+func (r *WasmRuntime) run(ctx context.Context, model string, cache *ModelResultsCache, input ModelInput,
+	wasm func(context.Context, []byte) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	stream, err := encodeInput(input, r.limits[model])
+	if errors.Is(err, errInputTooLarge) {
+		// Inputs too large even without attributes get the heuristic
+		r.logger.Debug("Model input too large, using heuristic", zap.String("model", model))
+		return r.outputs[model].apply(heuristic(model, input)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s input: %w", model, err)
+	}
+	defer releaseInput(stream)
+	encoded := stream.Buffer()
+	negative := r.negatives[model]
+	key := encoded
+	if cache != nil || negative != nil {
+		key = r.cacheKeys[model].key(encoded)
+	}
+	
+	invoke := func() (map[string]interface{}, error) {
+		// Inputs the model failed on are failed again until their backoff
+		// expires
+		if negative != nil {
+			if err := negative.check(key, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+
+		// Call the backend or the implementation
+		start := time.Now()
+		result, invoked, err := r.invoke(ctx, model, input, encoded, wasm)
+		if invoked || err != nil {
+			r.observe(ctx, model, time.Since(start), err)
+		}
+		if negative != nil && invoked {
+			if err == nil {
+				negative.succeeded(key)
+			} else if ctx.Err() == nil {
+				negative.failed(key, err, time.Now())
+			}
 		}
+		if err != nil {
+			return nil, err
+		}
+		
+		// Prefilter and heuristic results are neither cached nor recorded
+		if !invoked {
+			return r.outputs[model].apply(result), nil
+		}
+
+		// The model's own output is recorded, the calibrated and
+		// post-processed one cached
+		r.record(model, encoded, result)
+		result = r.outputs[model].apply(r.calibrations[model].apply(result))
+		if cache != nil {
+			cache.Put(TenantFromContext(ctx), key, result)
+		}
+		return result, nil
+	}
+	if cache == nil {
+		return invoke()
 	}
 
-	// Call the implementation
-	result, err := r.impl.ClassifyError(ctx, errorInfo)
-	if err != nil {
-		return nil, err
+	// Serve the cache first, concurrent misses share a single invocation
+	return cache.Do(ctx, TenantFromContext(ctx), key, invoke)
+}
+
+// ReloadModel reloads a specific model.
+// Models falling back to WASM reload both.
+func (r *WasmRuntime) ReloadModel(modelType string, path string) error {
+	if backend := r.backend(modelType); backend != nil {
+		if err := backend.Reload(path); err != nil || !r.fallsBack(modelType) {
+			return err
+		}
 	}
+	return r.impl.ReloadModel(modelType, path)
+}
 
-	// Cache the result if caching is enabled
-	if r.errorClassifierCache != nil {
-		r.errorClassifierCache.Put(errorInfo, result)
+// SetBackend serves a model with a backend of the given kind instead of
+// WASM. The runtime closes the backend when it is closed.
+func (r *WasmRuntime) SetBackend(model string, kind string, backend ModelBackend) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.backends == nil {
+		r.backends = make(map[string]ModelBackend)
+		r.backendKinds = make(map[string]string)
 	}
+	r.backends[model] = backend
+	r.backendKinds[model] = kind
+}
 
-	return result, nil
+// SetFallback makes invocations of model whose backend fails invoke the
+// model's WASM module instead, which must be loaded
+func (r *WasmRuntime) SetFallback(model string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.fallbacks == nil {
+		r.fallbacks = make(map[string]bool)
+	}
+	r.fallbacks[model] = true
 }
 
-// SampleTelemetry determines whether to sample a telemetry item.
-func (r *WasmRuntime) SampleTelemetry(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
-	// Check cache first if enabled
-	if r.samplerCache != nil {
-		if cachedResult, found := r.samplerCache.Get(telemetryItem); found {
-			return cachedResult, nil
+// fallsBack reports whether model falls back to WASM
+func (r *WasmRuntime) fallsBack(model string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.fallbacks[model]
+}
+
+// SetPrefilter makes invocations of model return the results of prefilter
+// for the inputs it matches, without invoking the model or counting towards
+// quotas. Their results are not cached.
+func (r *WasmRuntime) SetPrefilter(model string, prefilter ModelPrefilter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.prefilters == nil {
+		r.prefilters = make(map[string]ModelPrefilter)
+	}
+	r.prefilters[model] = prefilter
+}
+
+// SetQuota limits model invocations per tenant. When a tenant's quota is
+// exhausted, heuristic results are returned instead of invoking the model.
+func (r *WasmRuntime) SetQuota(quota QuotaLimiter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.quota = quota
+}
+
+// backend returns the backend serving a model, or nil for WASM models
+func (r *WasmRuntime) backend(model string) ModelBackend {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.backends[model]
+}
+
+// invoke calls the backend serving model, or the WASM implementation,
+// unless the backend is blocked in ctx or the model's circuit is open. It
+// reports whether the model was invoked or a prefilter, heuristic or
+// circuit fallback result returned.
+func (r *WasmRuntime) invoke(ctx context.Context, model string, input ModelInput, encoded []byte,
+	wasm func(context.Context, []byte) (map[string]interface{}, error)) (map[string]interface{}, bool, error) {
+	r.mutex.RLock()
+	backend := r.backends[model]
+	kind := r.backendKinds[model]
+	fallback := r.fallbacks[model]
+	prefilter := r.prefilters[model]
+	quota := r.quota
+	r.mutex.RUnlock()
+	if backend == nil {
+		kind = BackendWasm
+	}
+
+	// Prefilters run in the processor, so they apply whatever the backend
+	if prefilter != nil {
+		if result, ok := prefilter.Match(encoded); ok {
+			return result, false, nil
 		}
 	}
 
-	// Call the implementation
-	result, err := r.impl.SampleTelemetry(ctx, telemetryItem)
-	if err != nil {
-		return nil, err
+	if isBlocked(ctx, kind) {
+		// Models falling back to WASM skip their blocked backend
+		if backend == nil || !fallback || isBlocked(ctx, BackendWasm) {
+			return nil, false, fmt.Errorf("%w: %s model served by %s", ErrBackendBlocked, model, kind)
+		}
+		backend = nil
+	}
+
+	// Models whose circuit is open are not invoked, nor count towards quotas
+	breaker := r.breakers[model]
+	probe := false
+	if breaker != nil {
+		var allowed bool
+		if allowed, probe = breaker.allow(time.Now()); !allowed {
+			return r.circuitFallback(model, input, breaker), false, nil
+		}
 	}
 
-	// Cache the result if caching is enabled
-	if r.samplerCache != nil {
-		r.samplerCache.Put(telemetryItem, result)
+	// Fall back to heuristics once the tenant's quota is exhausted
+	if quota != nil && !quota.Allow(TenantFromContext(ctx)) {
+		breaker.abandon(probe)
+		return heuristic(model, input), false, nil
 	}
 
-	return result, nil
+	// Invocations beyond the limit wait for a slot, or fail once ctx is done
+	if err := r.acquireInvocation(ctx); err != nil {
+		breaker.abandon(probe)
+		return nil, false, err
+	}
+	result, err := r.call(ctx, model, backend, fallback, encoded, wasm)
+	r.releaseInvocation()
+	if breaker != nil {
+		r.recordCircuit(ctx, model, breaker, probe, err)
+	}
+	return result, true, err
 }
 
-// ExtractEntities extracts entities from a telemetry item.
-func (r *WasmRuntime) ExtractEntities(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
-	// Check cache first if enabled
-	if r.entityExtractorCache != nil {
-		if cachedResult, found := r.entityExtractorCache.Get(telemetryItem); found {
-			return cachedResult, nil
+// acquireInvocation takes a slot of the invocations running at once,
+// waiting until one is free or ctx is done
+func (r *WasmRuntime) acquireInvocation(ctx context.Context) error {
+	if r.invocations == nil {
+		return nil
+	}
+	select {
+	case r.invocations <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no free model invocation slot: %w", ctx.Err())
+	}
+}
+
+// releaseInvocation frees the slot taken by acquireInvocation
+func (r *WasmRuntime) releaseInvocation() {
+	if r.invocations != nil {
+		<-r.invocations
+	}
+}
+
+// InvocationsInFlight returns the number of model invocations running, when
+// they are bounded by MaxConcurrentInvocations, and the bound.
+func (r *WasmRuntime) InvocationsInFlight() (running int, limit int) {
+	return len(r.invocations), cap(r.invocations)
+}
+
+// call invokes the backend serving model, falling back to WASM if it fails
+// and the model falls back, or the WASM implementation within the model's
+// timeout
+func (r *WasmRuntime) call(ctx context.Context, model string, backend ModelBackend, fallback bool, encoded []byte,
+	wasm func(context.Context, []byte) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if backend != nil {
+		result, err := backend.Invoke(ctx, encoded)
+		if err == nil || !fallback || ctx.Err() != nil || isBlocked(ctx, BackendWasm) {
+			return result, err
 		}
+		r.logger.Debug("Model backend failed, falling back to WASM", zap.String("model", model), zap.Error(err))
 	}
 
-	// Call the implementation
-	result, err := r.impl.ExtractEntities(ctx, telemetryItem)
-	if err != nil {
-		return nil, err
+	timeout := r.timeouts[model]
+	if timeout == 0 {
+		return r.invokeWasm(ctx, encoded, wasm)
 	}
 
-	// Cache the result if caching is enabled
-	if r.entityExtractorCache != nil {
-		r.entityExtractorCache.Put(telemetryItem, result)
+	// WASM calls may not return at the deadline, so they run on their own
+	// goroutine with their own copy of the input, which the caller releases
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type invocation struct {
+		result map[string]interface{}
+		err    error
 	}
+	done := make(chan invocation, 1)
+	encoded = append([]byte(nil), encoded...)
+	go func() {
+		result, err := r.invokeWasm(timeoutCtx, encoded, wasm)
+		done <- invocation{result, err}
+	}()
 
-	return result, nil
+	var call invocation
+	select {
+	case call = <-done:
+	case <-timeoutCtx.Done():
+		call.err = timeoutCtx.Err()
+	}
+	if call.err != nil && ctx.Err() == nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		r.timeoutCounts[model].Add(1)
+		return nil, fmt.Errorf("%w: %s model after %s", ErrModelTimeout, model, timeout)
+	}
+	return call.result, call.err
 }
 
-// ReloadModel reloads a specific model.
-func (r *WasmRuntime) ReloadModel(modelType string, path string) error {
-	return r.impl.ReloadModel(modelType, path)
+// circuitFallback returns the result of a model whose circuit is open
+func (r *WasmRuntime) circuitFallback(model string, input ModelInput, breaker *circuitBreaker) map[string]interface{} {
+	if breaker.config.Fallback == CircuitFallbackPassThrough {
+		return map[string]interface{}{}
+	}
+	return heuristic(model, input)
+}
+
+// recordCircuit records the outcome of an invocation in the model's circuit
+// breaker, logging the circuit opening and closing. Invocations cancelled by
+// their caller don't count.
+func (r *WasmRuntime) recordCircuit(ctx context.Context, model string, breaker *circuitBreaker, probe bool, err error) {
+	if err != nil && ctx.Err() != nil {
+		breaker.abandon(probe)
+		return
+	}
+	state, changed := breaker.done(probe, err != nil, time.Now())
+	if !changed {
+		return
+	}
+	if state == CircuitOpen {
+		r.logger.Warn("Model circuit opened, using fallback results",
+			zap.String("model", model),
+			zap.String("fallback", breaker.config.Fallback),
+			zap.Duration("cool_down", breaker.config.CoolDown),
+			zap.Error(err))
+		return
+	}
+	r.logger.Info("Model circuit closed", zap.String("model", model))
+}
+
+// invokeWasm calls the WASM implementation on the inference threads, if any
+func (r *WasmRuntime) invokeWasm(ctx context.Context, encoded []byte,
+	wasm func(context.Context, []byte) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if r.threads == nil {
+		return wasm(ctx, encoded)
+	}
+	var result map[string]interface{}
+	var err error
+	if threadErr := r.threads.do(ctx, func() { result, err = wasm(ctx, encoded) }); threadErr != nil {
+		return nil, threadErr
+	}
+	return result, err
+}
+
+// Stats returns the result cache statistics of each model.
+func (r *WasmRuntime) Stats() map[string]interface{} {
+	stats := make(map[string]interface{})
+	for model, cache := range r.CacheStats() {
+		stats[model] = map[string]interface{}{"cache": cache}
+	}
+	for model, count := range r.Timeouts() {
+		modelStats, _ := stats[model].(map[string]interface{})
+		if modelStats == nil {
+			modelStats = make(map[string]interface{})
+			stats[model] = modelStats
+		}
+		modelStats["timeouts"] = count
+	}
+	for model, count := range r.NegativeCacheHits() {
+		modelStats, _ := stats[model].(map[string]interface{})
+		if modelStats == nil {
+			modelStats = make(map[string]interface{})
+			stats[model] = modelStats
+		}
+		modelStats["known_failures"] = count
+	}
+	
+	r.mutex.RLock()
+	for model, backend := range r.backends {
+		if reporter, ok := backend.(interface{ Stats() map[string]interface{} }); ok {
+			modelStats, _ := stats[model].(map[string]interface{})
+			if modelStats == nil {
+				modelStats = make(map[string]interface{})
+				stats[model] = modelStats
+			}
+			modelStats["backend"] = reporter.Stats()
+		}
+	}
+	r.mutex.RUnlock()
+	
+	for model, state := range r.Circuits() {
+		modelStats, _ := stats[model].(map[string]interface{})
+		if modelStats == nil {
+			modelStats = make(map[string]interface{})
+			stats[model] = modelStats
+		}
+		modelStats["circuit"] = state
+	}
+	return stats
+}
+
+// Circuits returns the circuit state of each model with a circuit breaker.
+func (r *WasmRuntime) Circuits() map[string]string {
+	circuits := make(map[string]string, len(r.breakers))
+	for model, breaker := range r.breakers {
+		circuits[model] = breaker.current()
+	}
+	return circuits
+}
+
+// CacheStats returns the statistics of each model's results cache.
+func (r *WasmRuntime) CacheStats() map[string]interface{} {
+	stats := make(map[string]interface{})
+	for model, cache := range map[string]*ModelResultsCache{
+		ModelErrorClassifier: r.errorClassifierCache,
+		ModelSampler:         r.samplerCache,
+		ModelEntityExtractor: r.entityExtractorCache,
+	} {
+		if cache != nil {
+			stats[model] = cache.GetStats()
+		}
+	}
+	return stats
+}
+
+// ResultCaches returns the results cache of each model caching its
+// results, such as to persist them across restarts.
+func (r *WasmRuntime) ResultCaches() map[string]*ModelResultsCache {
+	caches := make(map[string]*ModelResultsCache)
+	for model, cache := range map[string]*ModelResultsCache{
+		ModelErrorClassifier: r.errorClassifierCache,
+		ModelSampler:         r.samplerCache,
+		ModelEntityExtractor: r.entityExtractorCache,
+	} {
+		if cache != nil && cache.enabled {
+			caches[model] = cache
+		}
+	}
+	return caches
+}
+
+// CacheCounters are the lookups of a model's results cache
+type CacheCounters struct {
+	Hits   int64
+	Misses int64
+}
+
+// CacheCounters returns the cache lookups of each model with a results cache.
+func (r *WasmRuntime) CacheCounters() map[string]CacheCounters {
+	counters := make(map[string]CacheCounters)
+	for model, cache := range map[string]*ModelResultsCache{
+		ModelErrorClassifier: r.errorClassifierCache,
+		ModelSampler:         r.samplerCache,
+		ModelEntityExtractor: r.entityExtractorCache,
+	} {
+		if cache != nil {
+			hits, misses := cache.Counts()
+			counters[model] = CacheCounters{Hits: hits, Misses: misses}
+		}
+	}
+	return counters
+}
+
+// Timeouts returns the number of invocations of each model with a timeout
+// that timed out.
+func (r *WasmRuntime) Timeouts() map[string]int64 {
+	timeouts := make(map[string]int64, len(r.timeoutCounts))
+	for model, count := range r.timeoutCounts {
+		timeouts[model] = count.Load()
+	}
+	return timeouts
+}
+
+// NegativeCacheHits returns the number of invocations of each model with a
+// negative cache failed without invoking it, as their input failed recently
+func (r *WasmRuntime) NegativeCacheHits() map[string]int64 {
+	hits := make(map[string]int64, len(r.negatives))
+	for model, negative := range r.negatives {
+		hits[model] = negative.hits.Load()
+	}
+	return hits
+}
+
+// ClearCache removes the cached results of tenant for every model.
+func (r *WasmRuntime) ClearCache(tenant string) {
+	for _, cache := range []*ModelResultsCache{r.errorClassifierCache, r.samplerCache, r.entityExtractorCache} {
+		if cache != nil {
+			cache.ClearTenant(tenant)
+		}
+	}
+}
+
+// ClearCaches removes the cached results of every tenant for every model.
+func (r *WasmRuntime) ClearCaches() {
+	for _, cache := range []*ModelResultsCache{r.errorClassifierCache, r.samplerCache, r.entityExtractorCache} {
+		if cache != nil {
+			cache.Clear()
+		}
+	}
+}
+
+// SetRecorder attaches a recorder that captures model invocations.
+// Passing nil disables recording.
+func (r *WasmRuntime) SetRecorder(recorder InvocationRecorder) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.recorder = recorder
+}
+
+// SetObserver attaches an observer of the model invocations. Passing nil
+// detaches it.
+func (r *WasmRuntime) SetObserver(observer InvocationObserver) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.observer = observer
+}
+
+// observe forwards an invocation to the observer if one is attached
+func (r *WasmRuntime) observe(ctx context.Context, model string, duration time.Duration, err error) {
+	r.mutex.RLock()
+	observer := r.observer
+	r.mutex.RUnlock()
+
+	if observer != nil {
+		observer.ObserveInvocation(ctx, model, duration, err)
+	}
+}
+
+// record forwards an invocation to the recorder if one is attached
+func (r *WasmRuntime) record(model string, input []byte, output map[string]interface{}) {
+	r.mutex.RLock()
+	recorder := r.recorder
+	r.mutex.RUnlock()
+
+	if recorder == nil {
+		return
+	}
+
+	if err := recorder.Record(model, input, output); err != nil {
+		r.logger.Debug("Failed to record model invocation", zap.String("model", model), zap.Error(err))
+	}
 }
 
 // Close cleans up resources used by the WASM runtime.
 func (r *WasmRuntime) Close() error {
+	r.mutex.Lock()
+	recorder := r.recorder
+	r.recorder = nil
+	backends := r.backends
+	r.backends = nil
+	r.backendKinds = nil
+	r.mutex.Unlock()
+
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			r.logger.Warn("Failed to close model recorder", zap.Error(err))
+		}
+	}
+
+	for model, backend := range backends {
+		if err := backend.Close(); err != nil {
+			r.logger.Warn("Failed to close model backend", zap.String("model", model), zap.Error(err))
+		}
+	}
+
+	if r.threads != nil {
+		r.threads.Close()
+	}
 	return r.impl.Close()
 }
 
@@ -140,6 +925,102 @@ func initializeRuntime(logger *zap.Logger, config *WasmRuntimeConfig) (*WasmRunt
 		mutex:  sync.RWMutex{},
 	}
 	
+	for model, abi := range config.ABIs {
+		switch abi {
+		case "", ABIRaw, ABITinyGo, ABIAssemblyScript, ABIRust, ABIComponent:
+		default:
+			return nil, fmt.Errorf("unknown ABI %q for model %s", abi, model)
+		}
+	}
+	
+	switch config.Engine.Runtime {
+	case "", RuntimeWasmer, RuntimeWazero, RuntimeWasmtime:
+	default:
+		return nil, fmt.Errorf("unknown WASM runtime %q", config.Engine.Runtime)
+	}
+	
+	if config.MaxConcurrentInvocations > 0 {
+		runtime.invocations = make(chan struct{}, config.MaxConcurrentInvocations)
+	}
+	
+	if config.InferenceThreads > 0 {
+		runtime.threads = newInferenceThreads(config.InferenceThreads)
+	}
+	
+	for model, timeout := range config.Timeouts {
+		if timeout <= 0 {
+			continue
+		}
+		if runtime.timeouts == nil {
+			runtime.timeouts = make(map[string]time.Duration)
+			runtime.timeoutCounts = make(map[string]*atomic.Int64)
+		}
+		runtime.timeouts[model] = timeout
+		runtime.timeoutCounts[model] = new(atomic.Int64)
+	}
+	
+	for model, breaker := range config.CircuitBreakers {
+		prepared, err := newCircuitBreaker(breaker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker for model %s: %w", model, err)
+		}
+		if runtime.breakers == nil {
+			runtime.breakers = make(map[string]*circuitBreaker)
+		}
+		runtime.breakers[model] = prepared
+	}
+	
+	for model, negative := range config.NegativeCaches {
+		prepared, err := newNegativeCache(negative)
+		if err != nil {
+			return nil, fmt.Errorf("invalid negative cache for model %s: %w", model, err)
+		}
+		if runtime.negatives == nil {
+			runtime.negatives = make(map[string]*negativeCache)
+		}
+		runtime.negatives[model] = prepared
+	}
+	
+	if len(config.InputLimits) > 0 {
+		runtime.limits = make(map[string]*InputLimits, len(config.InputLimits))
+		for model, limits := range config.InputLimits {
+			limits := limits
+			runtime.limits[model] = &limits
+		}
+	}
+	
+	if len(config.CacheKeys) > 0 {
+		runtime.cacheKeys = make(map[string]*CacheKey, len(config.CacheKeys))
+		for model, key := range config.CacheKeys {
+			key := key
+			runtime.cacheKeys[model] = &key
+		}
+	}
+	
+	if len(config.OutputRules) > 0 {
+		runtime.outputs = make(map[string]*outputRules, len(config.OutputRules))
+		for model, rules := range config.OutputRules {
+			rules := rules
+			prepared, err := newOutputRules(&rules)
+			if err != nil {
+				return nil, fmt.Errorf("invalid output rules for model %s: %w", model, err)
+			}
+			runtime.outputs[model] = prepared
+		}
+	}
+	
+	for model, config := range config.Calibrations {
+		config := config
+		prepared, err := newCalibration(&config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calibration for model %s: %w", model, err)
+		}
+		if runtime.calibrations == nil {
+			runtime.calibrations = make(map[string]*calibration)
+		}
+		runtime.calibrations[model] = prepared
+	}
+	
 	// Initialize caches if enabled
 	if config.EnableModelCaching {
 		// Default TTL to 60 seconds if not specified
@@ -148,29 +1029,36 @@ func initializeRuntime(logger *zap.Logger, config *WasmRuntimeConfig) (*WasmRunt
 			ttl = 60
 		}
 		
+		// Default to 100 tenants if not specified
+		tenants := config.ModelCacheTenants
+		if tenants == 0 {
+			tenants = 100
+		}
+		
 		// Create caches for each model
 		var err error
 		
 		// Error classifier cache
-		runtime.errorClassifierCache, err = NewModelResultsCache(config.ModelCacheSize, ttl)
+		runtime.errorClassifierCache, err = NewModelResultsCache(config.ModelCacheSize, tenants, ttl)
 		if err != nil {
 			return nil, err
 		}
 		
 		// Sampler cache
-		runtime.samplerCache, err = NewModelResultsCache(config.ModelCacheSize, ttl)
+		runtime.samplerCache, err = NewModelResultsCache(config.ModelCacheSize, tenants, ttl)
 		if err != nil {
 			return nil, err
 		}
 		
 		// Entity extractor cache
-		runtime.entityExtractorCache, err = NewModelResultsCache(config.ModelCacheSize, ttl)
+		runtime.entityExtractorCache, err = NewModelResultsCache(config.ModelCacheSize, tenants, ttl)
 		if err != nil {
 			return nil, err
 		}
 		
 		logger.Info("Enabled model result caching",
 			zap.Int("cache_size", config.ModelCacheSize),
+			zap.Int("tenants", tenants),
 			zap.Int("ttl_seconds", ttl))
 	}
 
@@ -0,0 +1,143 @@
+// This file contains the limits applied to model inputs while they are
+// encoded, which keep inference payloads small regardless of the size of
+// the telemetry
+
+package runtime
+
+import (
+	"errors"
+	"sort"
+	"unicode/utf8"
+)
+
+// errInputTooLarge is returned when an input exceeds its model's
+// MaxInputBytes even without attributes
+var errInputTooLarge = errors.New("model input exceeds max_input_bytes")
+
+// InputLimits bound the input of a model
+type InputLimits struct {
+	// Fields lists the input fields passed to the model, such as "name",
+	// "status" and "attributes". All fields are passed if empty.
+	Fields []string
+
+	// MaxAttributes bounds the attributes and the resource attributes
+	// passed to the model. 0 passes all attributes.
+	MaxAttributes int
+
+	// PriorityAttributes are kept first when attributes are dropped, the
+	// remaining slots are filled in key order
+	PriorityAttributes []string
+
+	// MaxInputBytes bounds the encoded input. Inputs exceeding it are sent
+	// without attributes, and inputs still exceeding it are answered with
+	// the model's heuristic instead. 0 leaves inputs unbounded.
+	MaxInputBytes int
+
+	// MaxEvents bounds the span events passed to the model, exception
+	// events being kept first. 0 passes all events.
+	MaxEvents int
+
+	// MaxStacktraceLength bounds the exception.stacktrace attribute of
+	// events in bytes. 0 passes whole stack traces.
+	MaxStacktraceLength int
+}
+
+// includes reports whether the field is passed to the model
+func (l *InputLimits) includes(field string) bool {
+	if l == nil || len(l.Fields) == 0 {
+		return true
+	}
+	for _, f := range l.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// selectAttributes appends the sorted keys of the attributes passed to the
+// model to keys
+func (l *InputLimits) selectAttributes(keys []string, attributes map[string]interface{}) []string {
+	if l == nil || l.MaxAttributes <= 0 || len(attributes) <= l.MaxAttributes {
+		for k := range attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	// Keep the priority attributes the item has
+	for _, k := range l.PriorityAttributes {
+		if len(keys) == l.MaxAttributes {
+			break
+		}
+		if _, ok := attributes[k]; ok && !containsString(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	selected := len(keys)
+
+	// Fill the remaining slots in key order
+	for k := range attributes {
+		if !containsString(keys[:selected], k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys[selected:])
+	keys = keys[:l.MaxAttributes]
+	sort.Strings(keys)
+	return keys
+}
+
+// containsString reports whether keys contains k
+func containsString(keys []string, k string) bool {
+	for _, key := range keys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// selectEvents returns the events passed to the model, in their order
+func (l *InputLimits) selectEvents(events []SpanEvent) []SpanEvent {
+	if l == nil || l.MaxEvents <= 0 || len(events) <= l.MaxEvents {
+		return events
+	}
+
+	// Keep exception events first, then the earliest other events
+	keep := make([]bool, len(events))
+	kept := 0
+	for _, exceptions := range []bool{true, false} {
+		for i, event := range events {
+			if kept == l.MaxEvents {
+				break
+			}
+			if !keep[i] && (event.Name == exceptionEventName) == exceptions {
+				keep[i] = true
+				kept++
+			}
+		}
+	}
+
+	selected := make([]SpanEvent, 0, kept)
+	for i, event := range events {
+		if keep[i] {
+			selected = append(selected, event)
+		}
+	}
+	return selected
+}
+
+// truncateStacktrace bounds a stack trace to MaxStacktraceLength bytes
+// without splitting a character
+func (l *InputLimits) truncateStacktrace(stacktrace string) string {
+	if l == nil || l.MaxStacktraceLength <= 0 || len(stacktrace) <= l.MaxStacktraceLength {
+		return stacktrace
+	}
+	end := l.MaxStacktraceLength
+	for end > 0 && !utf8.RuneStart(stacktrace[end]) {
+		end--
+	}
+	return stacktrace[:end]
+}
@@ -0,0 +1,82 @@
+// This file contains the reading of model files, which may be compressed
+// with gzip or zstd to shrink the artifacts models are distributed in
+
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxModelSize bounds the size of decompressed models, so corrupt or
+// malicious files can't exhaust the memory of the collector
+const maxModelSize = 1 << 30
+
+// Magic numbers starting compressed files
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// readModelFile reads a model file, decompressing it if it is compressed
+// with gzip or zstd. Compression is detected from the content rather than
+// the extension, so .wasm.gz and .wasm.zst files as well as compressed
+// models saved under another name are read alike.
+func readModelFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip model %s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case bytes.HasPrefix(data, zstdMagic):
+		zstdReader, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd model %s: %w", path, err)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return data, nil
+	}
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxModelSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress model %s: %w", path, err)
+	}
+	if len(decompressed) > maxModelSize {
+		return nil, fmt.Errorf("model %s exceeds %d bytes once decompressed", path, maxModelSize)
+	}
+	return decompressed, nil
+}
+
+// FileSHA256 returns the hex encoded SHA-256 digest of a file as stored,
+// which is how model digests are pinned and reported
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCompressedModelFiles(t *testing.T) {
+	module := []byte("\x00asm\x01\x00\x00\x00")
+	dir := t.TempDir()
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(module)
+	require.NoError(t, gzipWriter.Close())
+
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zstded := encoder.EncodeAll(module, nil)
+
+	for name, data := range map[string][]byte{
+		"model.wasm":     module,
+		"model.wasm.gz":  gzipped.Bytes(),
+		"model.wasm.zst": zstded,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		read, err := readModelFile(path)
+		require.NoError(t, err, name)
+		assert.Equal(t, module, read, name)
+	}
+
+	path := filepath.Join(dir, "corrupt.wasm.gz")
+	require.NoError(t, os.WriteFile(path, append([]byte{0x1f, 0x8b}, module...), 0o644))
+	_, err = readModelFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+// This file contains the negative caches, which remember the inputs a model
+// failed on so they are not retried on every item until a backoff expires
+
+package runtime
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// ErrKnownFailure is returned for inputs a model failed on recently, while
+// their backoff runs, without invoking the model
+var ErrKnownFailure = errors.New("model failed on this input recently")
+
+// NegativeCacheConfig defines how long the inputs a model failed on are
+// failed without invoking the model. Each further failure of an input
+// doubles its backoff, up to MaxBackoff.
+type NegativeCacheConfig struct {
+	// MaxEntries bounds the failed inputs remembered, the least recently
+	// failed ones are forgotten first
+	MaxEntries int
+
+	// InitialBackoff is how long an input is failed after its first failure
+	InitialBackoff time.Duration
+
+	// MaxBackoff bounds the backoff of inputs failing repeatedly
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of each backoff randomized, between 0 and 1,
+	// so inputs failing together are not all retried at once
+	Jitter float64
+}
+
+// negativeCache remembers the inputs a model failed on
+type negativeCache struct {
+	config  NegativeCacheConfig
+	entries *lru.Cache[[sha256.Size]byte, *failedInput]
+	hits    atomic.Int64
+}
+
+// failedInput is an input a model failed on
+type failedInput struct {
+	mutex    sync.Mutex
+	failures int
+	retryAt  time.Time
+	err      error
+}
+
+// newNegativeCache validates config and creates an empty negative cache
+func newNegativeCache(config NegativeCacheConfig) (*negativeCache, error) {
+	if config.MaxEntries <= 0 {
+		return nil, errors.New("max entries must be positive")
+	}
+	if config.InitialBackoff <= 0 {
+		return nil, errors.New("initial backoff must be positive")
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = config.InitialBackoff
+	}
+	if config.Jitter < 0 || config.Jitter > 1 {
+		return nil, fmt.Errorf("jitter must be between 0 and 1, got %v", config.Jitter)
+	}
+	entries, err := lru.New[[sha256.Size]byte, *failedInput](config.MaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	return &negativeCache{config: config, entries: entries}, nil
+}
+
+// check returns an error wrapping ErrKnownFailure and the last failure if
+// the model failed on input and its backoff hasn't expired at now
+func (c *negativeCache) check(input []byte, now time.Time) error {
+	entry, ok := c.entries.Peek(sha256.Sum256(input))
+	if !ok {
+		return nil
+	}
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	if !now.Before(entry.retryAt) {
+		return nil
+	}
+	c.hits.Add(1)
+	return fmt.Errorf("%w, retrying in %s: %w", ErrKnownFailure, entry.retryAt.Sub(now).Round(time.Millisecond), entry.err)
+}
+
+// failed records a failure of the model on input at now, doubling the
+// backoff of inputs that failed before
+func (c *negativeCache) failed(input []byte, err error, now time.Time) {
+	key := sha256.Sum256(input)
+	entry := &failedInput{}
+	if previous, ok, _ := c.entries.PeekOrAdd(key, entry); ok {
+		entry = previous
+		c.entries.Get(key)
+	}
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	entry.failures++
+	backoff := c.config.InitialBackoff
+	for i := 1; i < entry.failures && backoff < c.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.config.MaxBackoff {
+		backoff = c.config.MaxBackoff
+	}
+	if c.config.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * c.config.Jitter * float64(backoff))
+	}
+	entry.retryAt = now.Add(backoff)
+	entry.err = err
+}
+
+// succeeded forgets the failures of the model on input
+func (c *negativeCache) succeeded(input []byte) {
+	key := sha256.Sum256(input)
+	if c.entries.Contains(key) {
+		c.entries.Remove(key)
+	}
+}
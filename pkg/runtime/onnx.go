@@ -0,0 +1,149 @@
+// This file contains the mapping of model inputs and outputs to the tensors
+// of ONNX models, shared by builds with and without ONNX Runtime
+
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ONNXConfig defines a classifier served by ONNX Runtime, such as a
+// scikit-learn or PyTorch model exported to ONNX. The model takes a float
+// tensor of shape [1, len(Features)] and returns a float tensor of shape
+// [1, len(Labels)], or [1, 1] without labels.
+type ONNXConfig struct {
+	// Path is the .onnx model file
+	Path string
+
+	// LibraryPath is the ONNX Runtime shared library, e.g.
+	// /usr/lib/libonnxruntime.so. The system's library is used if empty.
+	// The first backend created sets it for the whole process.
+	LibraryPath string
+
+	// InputName and OutputName are the tensor names, "input" and
+	// "probabilities" by default
+	InputName  string
+	OutputName string
+
+	// Features are the input fields forming the input tensor, in order.
+	// Fields of the input are named by their JSON key, and attributes by
+	// their map and key, e.g. "attributes.http.status_code".
+	Features []string
+
+	// Labels name the classes whose probabilities the model returns. The
+	// most probable is the output, with its probability as confidence.
+	// Without labels, the model's single output value is the output.
+	Labels []string
+
+	// OutputKey is the result key of the output, e.g. "error_type"
+	OutputKey string
+}
+
+// withDefaults returns the config with the default tensor names
+func (c ONNXConfig) withDefaults() ONNXConfig {
+	if c.InputName == "" {
+		c.InputName = "input"
+	}
+	if c.OutputName == "" {
+		c.OutputName = "probabilities"
+	}
+	return c
+}
+
+// validate checks the settings that don't need ONNX Runtime
+func (c *ONNXConfig) validate() error {
+	if c.Path == "" {
+		return errors.New("model path is required")
+	}
+	if len(c.Features) == 0 {
+		return errors.New("at least one feature is required")
+	}
+	if c.OutputKey == "" {
+		return errors.New("output key is required")
+	}
+	return nil
+}
+
+// outputs returns the number of values the model returns
+func (c *ONNXConfig) outputs() int {
+	if len(c.Labels) == 0 {
+		return 1
+	}
+	return len(c.Labels)
+}
+
+// onnxFeatures returns the input tensor of a JSON-encoded model input.
+// Numbers and numeric strings are taken as is, booleans as 0 or 1, and
+// missing or other values as 0.
+func onnxFeatures(input []byte, features []string) ([]float32, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode model input: %w", err)
+	}
+
+	values := make([]float32, len(features))
+	for i, feature := range features {
+		values[i] = featureValue(lookupFeature(fields, feature))
+	}
+	return values, nil
+}
+
+// lookupFeature returns the value of a feature. Keys of nested maps such as
+// attributes may contain dots themselves, so the rest of the name after a
+// map's field is its key.
+func lookupFeature(fields map[string]interface{}, feature string) interface{} {
+	if value, ok := fields[feature]; ok {
+		return value
+	}
+	field, key, ok := strings.Cut(feature, ".")
+	if !ok {
+		return nil
+	}
+	nested, ok := fields[field].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return lookupFeature(nested, key)
+}
+
+// featureValue converts an input value to a tensor value
+func featureValue(value interface{}) float32 {
+	switch v := value.(type) {
+	case float64:
+		return float32(v)
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		if f, err := strconv.ParseFloat(v, 32); err == nil {
+			return float32(f)
+		}
+	}
+	return 0
+}
+
+// onnxResult returns the model result of an output tensor
+func onnxResult(outputs []float32, config *ONNXConfig) (map[string]interface{}, error) {
+	if len(outputs) != config.outputs() {
+		return nil, fmt.Errorf("model returned %d values, expected %d", len(outputs), config.outputs())
+	}
+	if len(config.Labels) == 0 {
+		return map[string]interface{}{config.OutputKey: float64(outputs[0])}, nil
+	}
+
+	best := 0
+	for i, probability := range outputs {
+		if probability > outputs[best] {
+			best = i
+		}
+	}
+	return map[string]interface{}{
+		config.OutputKey: config.Labels[best],
+		"confidence":     float64(outputs[best]),
+	}, nil
+}
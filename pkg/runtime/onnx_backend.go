@@ -0,0 +1,126 @@
+//go:build onnx
+
+// This file contains the ONNX backend, which runs models in ONNX Runtime
+// through its C API and needs cgo
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// onnxEnvironment is the ONNX Runtime environment of the process, which is
+// initialized once and lives as long as the process
+var onnxEnvironment struct {
+	once sync.Once
+	err  error
+}
+
+// onnxBackend serves a model with an ONNX Runtime session
+type onnxBackend struct {
+	config ONNXConfig
+
+	// mutex guards the session against reloads, sessions run concurrently
+	mutex   sync.RWMutex
+	session *ort.DynamicAdvancedSession
+}
+
+// NewONNXBackend loads the model of config in ONNX Runtime
+func NewONNXBackend(config ONNXConfig) (ModelBackend, error) {
+	config = config.withDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	onnxEnvironment.once.Do(func() {
+		if config.LibraryPath != "" {
+			ort.SetSharedLibraryPath(config.LibraryPath)
+		}
+		onnxEnvironment.err = ort.InitializeEnvironment()
+	})
+	if onnxEnvironment.err != nil {
+		return nil, fmt.Errorf("failed to initialize ONNX Runtime: %w", onnxEnvironment.err)
+	}
+
+	session, err := newONNXSession(&config, config.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &onnxBackend{config: config, session: session}, nil
+}
+
+// newONNXSession loads the model at path
+func newONNXSession(config *ONNXConfig, path string) (*ort.DynamicAdvancedSession, error) {
+	session, err := ort.NewDynamicAdvancedSession(path, []string{config.InputName}, []string{config.OutputName}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ONNX model %s: %w", path, err)
+	}
+	return session, nil
+}
+
+// Invoke implements ModelBackend
+func (b *onnxBackend) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	features, err := onnxFeatures(input, b.config.Features)
+	if err != nil {
+		return nil, err
+	}
+
+	inputTensor, err := ort.NewTensor(ort.NewShape(1, int64(len(features))), features)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create input tensor: %w", err)
+	}
+	defer inputTensor.Destroy()
+	outputTensor, err := ort.NewEmptyTensor[float32](ort.NewShape(1, int64(b.config.outputs())))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+	}
+	defer outputTensor.Destroy()
+
+	b.mutex.RLock()
+	if b.session == nil {
+		b.mutex.RUnlock()
+		return nil, fmt.Errorf("ONNX model %s is closed", b.config.Path)
+	}
+	err = b.session.Run([]ort.Value{inputTensor}, []ort.Value{outputTensor})
+	b.mutex.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ONNX model: %w", err)
+	}
+
+	return onnxResult(outputTensor.GetData(), &b.config)
+}
+
+// Reload implements ModelBackend, loading the model at path
+func (b *onnxBackend) Reload(path string) error {
+	session, err := newONNXSession(&b.config, path)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	previous := b.session
+	b.session = session
+	b.config.Path = path
+	b.mutex.Unlock()
+
+	if previous != nil {
+		return previous.Destroy()
+	}
+	return nil
+}
+
+// Close implements ModelBackend
+func (b *onnxBackend) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.session == nil {
+		return nil
+	}
+	err := b.session.Destroy()
+	b.session = nil
+	return err
+}
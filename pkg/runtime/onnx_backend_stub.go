@@ -0,0 +1,15 @@
+//go:build !onnx
+
+// This file contains the ONNX backend of builds without ONNX Runtime
+
+package runtime
+
+import (
+	"errors"
+)
+
+// NewONNXBackend fails in builds without the onnx tag, which leave ONNX
+// Runtime out
+func NewONNXBackend(config ONNXConfig) (ModelBackend, error) {
+	return nil, errors.New("ONNX models are not supported by this build, build with the onnx tag")
+}
@@ -0,0 +1,35 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestONNXFeaturesFollowConfiguredOrder(t *testing.T) {
+	input := []byte(`{"name":"GET /users","duration":12.5,"status":"error","attributes":{"http.status_code":"503","retry":true}}`)
+
+	features, err := onnxFeatures(input, []string{"attributes.http.status_code", "duration", "attributes.retry", "attributes.missing", "name"})
+	require.NoError(t, err)
+	assert.Equal(t, []float32{503, 12.5, 1, 0, 0}, features)
+
+	_, err = onnxFeatures([]byte("not json"), []string{"duration"})
+	assert.Error(t, err)
+}
+
+func TestONNXResultPicksMostProbableLabel(t *testing.T) {
+	config := &ONNXConfig{Labels: []string{"timeout", "database", "auth"}, OutputKey: "error_type"}
+
+	result, err := onnxResult([]float32{0.2, 0.7, 0.1}, config)
+	require.NoError(t, err)
+	assert.Equal(t, "database", result["error_type"])
+	assert.InDelta(t, 0.7, result["confidence"], 1e-6)
+
+	_, err = onnxResult([]float32{0.5, 0.5}, config)
+	assert.Error(t, err, "the output must have a value per label")
+
+	result, err = onnxResult([]float32{0.25}, &ONNXConfig{OutputKey: "importance"})
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, result["importance"])
+}
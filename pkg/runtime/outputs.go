@@ -0,0 +1,207 @@
+// This file contains the post-processing of model outputs, which normalizes
+// them before they are written as attributes so inconsistent outputs don't
+// reach the backends
+
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// OutputRules post-process the output of a model. Keys are renamed first,
+// the other rules apply to the renamed keys.
+type OutputRules struct {
+	// Rename maps output keys to the keys they are written as, replacing
+	// outputs of that name
+	Rename map[string]string
+
+	// Keys lists the keys written. Other keys are dropped. All keys are
+	// written if empty.
+	Keys []string
+
+	// Categories restrict string outputs to a list of values, keyed by
+	// output key
+	Categories map[string]Categories
+
+	// Ranges clamp numeric outputs, keyed by output key. Non-numeric
+	// values are dropped.
+	Ranges map[string]Range
+
+	// Precision rounds numeric outputs to a number of decimal places, keyed
+	// by output key. Non-numeric values are dropped.
+	Precision map[string]int
+}
+
+// Categories canonicalize a string output to one of Values. Values and
+// Aliases match ignoring case and surrounding spaces.
+type Categories struct {
+	Values []string
+
+	// Aliases map other spellings to one of the Values
+	Aliases map[string]string
+
+	// Default replaces values matching none. Such outputs are dropped if
+	// it is empty.
+	Default string
+}
+
+// Range bounds a numeric output
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// outputRules are OutputRules prepared for applying them
+type outputRules struct {
+	rename     map[string]string
+	keys       map[string]bool
+	categories map[string]*categoryLookup
+	ranges     map[string]Range
+	precision  map[string]float64
+}
+
+// categoryLookup maps normalized spellings to canonical values
+type categoryLookup struct {
+	values   map[string]string
+	fallback string
+}
+
+// newOutputRules validates and prepares the output rules of a model
+func newOutputRules(rules *OutputRules) (*outputRules, error) {
+	prepared := &outputRules{
+		rename: rules.Rename,
+		ranges: rules.Ranges,
+	}
+	if len(rules.Keys) > 0 {
+		prepared.keys = make(map[string]bool, len(rules.Keys))
+		for _, key := range rules.Keys {
+			prepared.keys[key] = true
+		}
+	}
+
+	for key, categories := range rules.Categories {
+		if len(categories.Values) == 0 {
+			return nil, fmt.Errorf("categories of %s have no values", key)
+		}
+		lookup := &categoryLookup{values: make(map[string]string), fallback: categories.Default}
+		for _, value := range categories.Values {
+			lookup.values[normalizeCategory(value)] = value
+		}
+		for alias, value := range categories.Aliases {
+			if !containsString(categories.Values, value) {
+				return nil, fmt.Errorf("alias %q of %s is not one of its values", alias, key)
+			}
+			lookup.values[normalizeCategory(alias)] = value
+		}
+		if prepared.categories == nil {
+			prepared.categories = make(map[string]*categoryLookup)
+		}
+		prepared.categories[key] = lookup
+	}
+
+	for key, r := range rules.Ranges {
+		if r.Min > r.Max {
+			return nil, fmt.Errorf("range of %s has a minimum above its maximum", key)
+		}
+	}
+
+	for key, places := range rules.Precision {
+		if places < 0 {
+			return nil, fmt.Errorf("precision of %s is negative", key)
+		}
+		if prepared.precision == nil {
+			prepared.precision = make(map[string]float64)
+		}
+		prepared.precision[key] = math.Pow10(places)
+	}
+	return prepared, nil
+}
+
+// apply returns the post-processed output. The output is not modified.
+func (r *outputRules) apply(output map[string]interface{}) map[string]interface{} {
+	if r == nil || output == nil {
+		return output
+	}
+
+	result := make(map[string]interface{}, len(output))
+	for key, value := range output {
+		if _, renamed := r.rename[key]; renamed {
+			continue
+		}
+		result[key] = value
+	}
+	for from, to := range r.rename {
+		if value, ok := output[from]; ok {
+			result[to] = value
+		}
+	}
+
+	for key, value := range result {
+		if r.keys != nil && !r.keys[key] {
+			delete(result, key)
+			continue
+		}
+		if lookup := r.categories[key]; lookup != nil {
+			if category := lookup.canonical(value); category != "" {
+				result[key] = category
+			} else {
+				delete(result, key)
+			}
+			continue
+		}
+
+		bounds, ranged := r.ranges[key]
+		scale, rounded := r.precision[key]
+		if !ranged && !rounded {
+			continue
+		}
+		number, ok := numericValue(value)
+		if !ok {
+			delete(result, key)
+			continue
+		}
+		if ranged {
+			number = math.Max(bounds.Min, math.Min(bounds.Max, number))
+		}
+		if rounded {
+			number = math.Round(number*scale) / scale
+		}
+		result[key] = number
+	}
+	return result
+}
+
+// canonical returns the canonical value of an output, the default if it
+// matches none, or "" to drop it
+func (l *categoryLookup) canonical(value interface{}) string {
+	if s, ok := value.(string); ok {
+		if category, ok := l.values[normalizeCategory(s)]; ok {
+			return category
+		}
+	}
+	return l.fallback
+}
+
+// normalizeCategory returns the spelling categories are matched by
+func normalizeCategory(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// numericValue returns an output as a float64. Outputs decoded from JSON
+// are float64, heuristics and backends may return integers.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
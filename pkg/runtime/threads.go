@@ -0,0 +1,103 @@
+// This file contains the dedicated OS threads WASM invocations can run on,
+// away from the goroutines processing pdata
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	goruntime "runtime"
+	"sync"
+)
+
+// errRuntimeClosed is returned for invocations after the runtime is closed
+var errRuntimeClosed = errors.New("model runtime is closed")
+
+// inferenceThreads runs invocations on goroutines locked to their own OS
+// threads. The threads are started by the first invocation and exit when
+// they are closed.
+type inferenceThreads struct {
+	count    int
+	start    sync.Once
+	requests chan *inferenceRequest
+	closed   chan struct{}
+	close    sync.Once
+}
+
+// inferenceRequest is an invocation waiting for a thread
+type inferenceRequest struct {
+	run  func()
+	done chan struct{}
+}
+
+// inferenceRequests recycles requests and their done channels
+var inferenceRequests = sync.Pool{
+	New: func() interface{} {
+		return &inferenceRequest{done: make(chan struct{}, 1)}
+	},
+}
+
+// newInferenceThreads creates count inference threads
+func newInferenceThreads(count int) *inferenceThreads {
+	return &inferenceThreads{
+		count:    count,
+		requests: make(chan *inferenceRequest),
+		closed:   make(chan struct{}),
+	}
+}
+
+// do runs fn on an inference thread and waits for it to return. It fails
+// without running fn if ctx is done before a thread is free.
+func (t *inferenceThreads) do(ctx context.Context, fn func()) error {
+	t.start.Do(func() {
+		for i := 0; i < t.count; i++ {
+			go t.work()
+		}
+	})
+
+	select {
+	case <-t.closed:
+		return errRuntimeClosed
+	default:
+	}
+
+	request := inferenceRequests.Get().(*inferenceRequest)
+	request.run = fn
+	select {
+	case t.requests <- request:
+	case <-ctx.Done():
+		request.run = nil
+		inferenceRequests.Put(request)
+		return ctx.Err()
+	case <-t.closed:
+		request.run = nil
+		inferenceRequests.Put(request)
+		return errRuntimeClosed
+	}
+
+	// fn uses the caller's buffers, so wait for it even if ctx is done
+	<-request.done
+	request.run = nil
+	inferenceRequests.Put(request)
+	return nil
+}
+
+// work runs invocations on a locked thread. The goroutine never unlocks
+// it, so the thread exits with the goroutine instead of running others.
+func (t *inferenceThreads) work() {
+	goruntime.LockOSThread()
+	for {
+		select {
+		case request := <-t.requests:
+			request.run()
+			request.done <- struct{}{}
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// Close stops the threads once their invocations return
+func (t *inferenceThreads) Close() {
+	t.close.Do(func() { close(t.closed) })
+}
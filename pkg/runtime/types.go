@@ -0,0 +1,365 @@
+// This file defines the typed model inputs and their JSON encoding, shared
+// by the stub and full implementations
+
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// jsonAPI encodes model inputs and decodes model outputs. It is compatible
+// with encoding/json, including sorted map keys, so equal inputs encode to
+// equal bytes and share cache entries.
+var jsonAPI = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// ModelInput is the typed input of a model: *ErrorInput, *SampleInput or
+// *EntityInput. Model outputs stay maps, since models may add keys of their
+// own and every key is written as an attribute.
+type ModelInput interface {
+	// summary returns the name and status heuristics are derived from
+	summary() (name string, status string)
+
+	// encode writes the input as a JSON object
+	encode(e *encoder)
+}
+
+// ErrorInput is the input of the error classifier. Spans pass their events,
+// whose exception events carry exception.type, exception.message and
+// exception.stacktrace.
+type ErrorInput struct {
+	Name       string                 `json:"name,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	Kind       string                 `json:"kind,omitempty"`
+	Severity   string                 `json:"severity,omitempty"`
+	Body       string                 `json:"body,omitempty"`
+	Events     []SpanEvent            `json:"events,omitempty"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Resource   map[string]interface{} `json:"resource"`
+}
+
+// SpanEvent is an event of a span passed to a model
+type SpanEvent struct {
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Names of the exception event and its stack trace attribute, as defined by
+// the OpenTelemetry semantic conventions
+const (
+	exceptionEventName  = "exception"
+	stacktraceAttribute = "exception.stacktrace"
+)
+
+func (i *ErrorInput) summary() (string, string) { return i.Name, i.Status }
+
+func (i *ErrorInput) encode(e *encoder) {
+	e.optionalString("name", i.Name)
+	e.optionalString("status", i.Status)
+	e.optionalString("kind", i.Kind)
+	e.optionalString("severity", i.Severity)
+	e.optionalString("body", i.Body)
+	e.events("events", i.Events)
+	e.attributes("attributes", i.Attributes)
+	e.attributes("resource", i.Resource)
+}
+
+// SampleInput is the input of the importance sampler. Traces are sampled as
+// a whole: Name, Kind, Attributes and Resource describe the root span,
+// Duration the trace, and Spans and Errors count its spans.
+type SampleInput struct {
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	Duration   int64                  `json:"duration"`
+	Spans      int                    `json:"spans,omitempty"`
+	Errors     int                    `json:"errors,omitempty"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Resource   map[string]interface{} `json:"resource"`
+}
+
+func (i *SampleInput) summary() (string, string) { return i.Name, i.Status }
+
+func (i *SampleInput) encode(e *encoder) {
+	if e.field("name") {
+		e.stream.WriteString(i.Name)
+	}
+	e.optionalString("kind", i.Kind)
+	e.optionalString("status", i.Status)
+	if e.field("duration") {
+		e.stream.WriteInt64(i.Duration)
+	}
+	e.optionalInt("spans", i.Spans)
+	e.optionalInt("errors", i.Errors)
+	e.attributes("attributes", i.Attributes)
+	e.attributes("resource", i.Resource)
+}
+
+// EntityInput is the input of the entity extractor. Metric data points set
+// the metric fields and Value, log records Severity and Body.
+type EntityInput struct {
+	Name                   string                 `json:"name,omitempty"`
+	Description            string                 `json:"description,omitempty"`
+	Unit                   string                 `json:"unit,omitempty"`
+	IsMonotonic            *bool                  `json:"is_monotonic,omitempty"`
+	AggregationTemporality string                 `json:"aggregation_temporality,omitempty"`
+	Value                  interface{}            `json:"value,omitempty"`
+	Severity               string                 `json:"severity,omitempty"`
+	Body                   string                 `json:"body,omitempty"`
+	Attributes             map[string]interface{} `json:"attributes"`
+	Resource               map[string]interface{} `json:"resource"`
+}
+
+func (i *EntityInput) summary() (string, string) { return i.Name, "" }
+
+func (i *EntityInput) encode(e *encoder) {
+	e.optionalString("name", i.Name)
+	e.optionalString("description", i.Description)
+	e.optionalString("unit", i.Unit)
+	if i.IsMonotonic != nil && e.field("is_monotonic") {
+		e.stream.WriteBool(*i.IsMonotonic)
+	}
+	e.optionalString("aggregation_temporality", i.AggregationTemporality)
+	if i.Value != nil && e.field("value") {
+		e.value(i.Value)
+	}
+	e.optionalString("severity", i.Severity)
+	e.optionalString("body", i.Body)
+	e.attributes("attributes", i.Attributes)
+	e.attributes("resource", i.Resource)
+}
+
+// encoder writes the fields of a JSON object without reflection. Without
+// limits, the output matches encoding/json for the struct tags of the inputs.
+type encoder struct {
+	stream *jsoniter.Stream
+	more   bool
+
+	// limits projects the input, nil to encode all of it
+	limits *InputLimits
+
+	// withoutAttributes writes attribute maps empty
+	withoutAttributes bool
+}
+
+// maxPooledInputSize is the largest buffer returned to the stream pool
+const maxPooledInputSize = 64 * 1024
+
+// keysPool holds the slices used to sort attribute keys
+var keysPool = sync.Pool{
+	New: func() interface{} {
+		keys := make([]string, 0, 32)
+		return &keys
+	},
+}
+
+// encodeInput encodes a model input to JSON into a pooled stream, applying
+// the model's limits, which may be nil. The encoded bytes are
+// stream.Buffer() and are only valid until the stream is returned with
+// releaseInput, so backends must copy inputs they retain.
+func encodeInput(input ModelInput, limits *InputLimits) (*jsoniter.Stream, error) {
+	stream, err := encodeProjected(input, limits, false)
+	if err != nil || limits == nil || limits.MaxInputBytes <= 0 || len(stream.Buffer()) <= limits.MaxInputBytes {
+		return stream, err
+	}
+
+	// Drop the attributes of inputs that are too large
+	releaseInput(stream)
+	stream, err = encodeProjected(input, limits, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(stream.Buffer()) > limits.MaxInputBytes {
+		releaseInput(stream)
+		return nil, errInputTooLarge
+	}
+	return stream, nil
+}
+
+// encodeProjected encodes the fields of input passed by limits
+func encodeProjected(input ModelInput, limits *InputLimits, withoutAttributes bool) (*jsoniter.Stream, error) {
+	stream := jsonAPI.BorrowStream(nil)
+
+	e := encoder{stream: stream, limits: limits, withoutAttributes: withoutAttributes}
+	stream.WriteObjectStart()
+	input.encode(&e)
+	stream.WriteObjectEnd()
+	if stream.Error != nil {
+		releaseInput(stream)
+		return nil, stream.Error
+	}
+	return stream, nil
+}
+
+// releaseInput returns the stream of an encoded input to the pool
+func releaseInput(stream *jsoniter.Stream) {
+	// Do not keep the buffers of unusually large inputs alive
+	if cap(stream.Buffer()) > maxPooledInputSize {
+		return
+	}
+	jsonAPI.ReturnStream(stream)
+}
+
+// field starts a field of the object, unless the limits leave it out
+func (e *encoder) field(name string) bool {
+	if !e.limits.includes(name) {
+		return false
+	}
+	if e.more {
+		e.stream.WriteMore()
+	}
+	e.stream.WriteObjectField(name)
+	e.more = true
+	return true
+}
+
+// optionalString writes a string field unless it is empty
+func (e *encoder) optionalString(name string, value string) {
+	if value == "" || !e.field(name) {
+		return
+	}
+	e.stream.WriteString(value)
+}
+
+// optionalInt writes an integer field unless it is zero
+func (e *encoder) optionalInt(name string, value int) {
+	if value == 0 || !e.field(name) {
+		return
+	}
+	e.stream.WriteInt(value)
+}
+
+// attributes writes an attribute map with sorted keys
+func (e *encoder) attributes(name string, attributes map[string]interface{}) {
+	if !e.field(name) {
+		return
+	}
+	if attributes == nil {
+		e.stream.WriteNil()
+		return
+	}
+	if e.withoutAttributes {
+		e.stream.WriteEmptyObject()
+		return
+	}
+
+	keysPtr := keysPool.Get().(*[]string)
+	keys := e.limits.selectAttributes((*keysPtr)[:0], attributes)
+
+	e.stream.WriteObjectStart()
+	for i, k := range keys {
+		if i > 0 {
+			e.stream.WriteMore()
+		}
+		e.stream.WriteObjectField(k)
+		e.value(attributes[k])
+	}
+	e.stream.WriteObjectEnd()
+
+	*keysPtr = keys[:0]
+	keysPool.Put(keysPtr)
+}
+
+// events writes span events, bounded by the limits. Their attributes are
+// left out with the other attributes of inputs that are too large.
+func (e *encoder) events(name string, events []SpanEvent) {
+	if len(events) == 0 || !e.field(name) {
+		return
+	}
+
+	e.stream.WriteArrayStart()
+	for i, event := range e.limits.selectEvents(events) {
+		if i > 0 {
+			e.stream.WriteMore()
+		}
+		e.stream.WriteObjectStart()
+		e.stream.WriteObjectField("name")
+		e.stream.WriteString(event.Name)
+		if len(event.Attributes) > 0 && !e.withoutAttributes {
+			e.stream.WriteMore()
+			e.stream.WriteObjectField("attributes")
+			e.eventAttributes(event.Attributes)
+		}
+		e.stream.WriteObjectEnd()
+	}
+	e.stream.WriteArrayEnd()
+}
+
+// eventAttributes writes the attributes of an event with sorted keys,
+// truncating its stack trace
+func (e *encoder) eventAttributes(attributes map[string]interface{}) {
+	keysPtr := keysPool.Get().(*[]string)
+	keys := (*keysPtr)[:0]
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e.stream.WriteObjectStart()
+	for i, k := range keys {
+		if i > 0 {
+			e.stream.WriteMore()
+		}
+		e.stream.WriteObjectField(k)
+		if stacktrace, ok := attributes[k].(string); ok && k == stacktraceAttribute {
+			e.stream.WriteString(e.limits.truncateStacktrace(stacktrace))
+			continue
+		}
+		e.value(attributes[k])
+	}
+	e.stream.WriteObjectEnd()
+
+	*keysPtr = keys[:0]
+	keysPool.Put(keysPtr)
+}
+
+// value writes an attribute value, falling back to reflection for nested values
+func (e *encoder) value(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		e.stream.WriteString(v)
+	case bool:
+		e.stream.WriteBool(v)
+	case int64:
+		e.stream.WriteInt64(v)
+	case int:
+		e.stream.WriteInt(v)
+	case float64:
+		e.stream.WriteFloat64(v)
+	default:
+		e.stream.WriteVal(v)
+	}
+}
+
+// decodeOutput decodes the JSON output of a model
+func decodeOutput(data []byte) (map[string]interface{}, error) {
+	var output map[string]interface{}
+	if err := jsonAPI.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// DecodeInput decodes the JSON encoding of a model's input, for example a
+// recorded input being replayed
+func DecodeInput(model string, data []byte) (ModelInput, error) {
+	var input ModelInput
+	switch model {
+	case ModelErrorClassifier:
+		input = &ErrorInput{}
+	case ModelSampler:
+		input = &SampleInput{}
+	case ModelEntityExtractor:
+		input = &EntityInput{}
+	default:
+		return nil, fmt.Errorf("unknown model type: %s", model)
+	}
+
+	if err := jsonAPI.Unmarshal(data, input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
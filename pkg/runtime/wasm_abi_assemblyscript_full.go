@@ -0,0 +1,197 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the ABI of AssemblyScript modules, whose functions
+// take and return managed strings
+
+package runtime
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// With ABIAssemblyScript, model functions are AssemblyScript functions
+// taking and returning a string, built with --exportRuntime:
+//
+//	memory                               the guest's linear memory
+//	__new(size i32, id i32) i32          allocates a managed object
+//	__pin(ptr i32) i32                   keeps an object from being collected
+//	__unpin(ptr i32)                     releases a pinned object
+//	_start()                             optional, run once with --exportStart
+//	<function>(input i32) i32            export function f(input: string): string
+//
+// Strings are UTF-16LE and their byte length is stored in the object header
+// right before the string. The host allocates and pins the input string,
+// transcodes the UTF-8 JSON into it, calls the function and transcodes the
+// returned string back to UTF-8 before the guest can run again.
+const (
+	asNewExport   = "__new"
+	asPinExport   = "__pin"
+	asUnpinExport = "__unpin"
+	asStartExport = "_start"
+
+	// asStringID is the runtime class id of strings
+	asStringID = 2
+
+	// asHeaderSize is the size of the header preceding managed objects,
+	// which ends with the class id and the byte length
+	asHeaderSize = 20
+)
+
+// assemblyScriptABI passes inputs and outputs as AssemblyScript strings
+type assemblyScriptABI struct {
+	memory guestMemory
+	alloc  guestFunction
+	pin    guestFunction
+	unpin  guestFunction
+
+	// output holds the UTF-8 transcoding of the last output, reused across
+	// calls, which the guest module serializes
+	output []byte
+}
+
+// newAssemblyScriptABI resolves the runtime exports of an instance and runs
+// its start function if it exports one
+func newAssemblyScriptABI(instance guestInstance) (*assemblyScriptABI, error) {
+	memory, err := instance.memory(abiMemoryExport)
+	if err != nil {
+		return nil, fmt.Errorf("module does not export its memory: %w", err)
+	}
+
+	abi := &assemblyScriptABI{memory: memory}
+	for name, function := range map[string]*guestFunction{
+		asNewExport:   &abi.alloc,
+		asPinExport:   &abi.pin,
+		asUnpinExport: &abi.unpin,
+	} {
+		if *function, err = instance.function(name); err != nil {
+			return nil, fmt.Errorf("module does not export %s, build it with --exportRuntime: %w", name, err)
+		}
+	}
+
+	// Modules built with --exportStart initialize their globals when the
+	// start function is called
+	if start, err := instance.function(asStartExport); err == nil {
+		if _, err := start(); err != nil {
+			return nil, fmt.Errorf("failed to run %s: %w", asStartExport, err)
+		}
+	}
+	return abi, nil
+}
+
+// invoke implements guestABI
+func (a *assemblyScriptABI) invoke(name string, function guestFunction, input []byte, decode func(output []byte) error) error {
+	inputPtr, err := a.lowerString(input)
+	if err != nil {
+		return err
+	}
+	defer a.unpin(int32(inputPtr))
+
+	result, err := function(int32(inputPtr))
+	if err != nil {
+		return fmt.Errorf("failed to invoke function %s: %w", name, err)
+	}
+	outputPtr, ok := result.(int32)
+	if !ok {
+		return fmt.Errorf("function %s returned %T, expected i32", name, result)
+	}
+
+	output, err := a.liftString(uint32(outputPtr))
+	if err != nil {
+		return fmt.Errorf("function %s returned an invalid string: %w", name, err)
+	}
+	return decode(output)
+}
+
+// lowerString allocates a pinned string holding the UTF-16 transcoding of
+// the UTF-8 input, which the caller unpins
+func (a *assemblyScriptABI) lowerString(input []byte) (uint32, error) {
+	units := 0
+	for _, r := range string(input) {
+		units += utf16.RuneLen(r)
+	}
+
+	result, err := a.alloc(int32(units*2), int32(asStringID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate guest string: %w", err)
+	}
+	ptr, ok := result.(int32)
+	if !ok {
+		return 0, fmt.Errorf("%s returned %T, expected i32", asNewExport, result)
+	}
+	// Pin the string before anything else allocates and may collect it
+	if _, err := a.pin(ptr); err != nil {
+		return 0, fmt.Errorf("failed to pin guest string: %w", err)
+	}
+
+	data := a.memory.Data()
+	start := uint64(uint32(ptr))
+	if start+uint64(units*2) > uint64(len(data)) {
+		a.unpin(ptr)
+		return 0, fmt.Errorf("%s returned memory outside the guest", asNewExport)
+	}
+	out := data[start : start+uint64(units*2)]
+	i := 0
+	for _, r := range string(input) {
+		if utf16.RuneLen(r) == 2 {
+			high, low := utf16.EncodeRune(r)
+			binary.LittleEndian.PutUint16(out[i:], uint16(high))
+			binary.LittleEndian.PutUint16(out[i+2:], uint16(low))
+			i += 4
+			continue
+		}
+		binary.LittleEndian.PutUint16(out[i:], uint16(r))
+		i += 2
+	}
+	return uint32(ptr), nil
+}
+
+// liftString returns the UTF-8 transcoding of the string at ptr, which is
+// only valid until the next call
+func (a *assemblyScriptABI) liftString(ptr uint32) ([]byte, error) {
+	output, err := appendAssemblyScriptString(a.output[:0], a.memory.Data(), ptr)
+	if err != nil {
+		return nil, err
+	}
+	a.output = output
+	return output, nil
+}
+
+// assemblyScriptAbort returns the error of a call to env.abort, whose
+// message and file name are strings in the memory of the instance
+func assemblyScriptAbort(data []byte, msgPtr, filePtr, line, col int32) error {
+	msg, _ := appendAssemblyScriptString(nil, data, uint32(msgPtr))
+	file, _ := appendAssemblyScriptString(nil, data, uint32(filePtr))
+	return fmt.Errorf("AssemblyScript abort: %q at %s:%d:%d", msg, file, line, col)
+}
+
+// appendAssemblyScriptString appends the UTF-8 transcoding of the string at
+// ptr in data to dst. Unpaired surrogates become U+FFFD.
+func appendAssemblyScriptString(dst []byte, data []byte, ptr uint32) ([]byte, error) {
+	if ptr < asHeaderSize || uint64(ptr) > uint64(len(data)) {
+		return nil, fmt.Errorf("pointer %d is outside guest memory", ptr)
+	}
+	if id := binary.LittleEndian.Uint32(data[ptr-8:]); id != asStringID {
+		return nil, fmt.Errorf("object has class id %d", id)
+	}
+	size := uint64(binary.LittleEndian.Uint32(data[ptr-4:]))
+	if uint64(ptr)+size > uint64(len(data)) || size%2 != 0 {
+		return nil, fmt.Errorf("length %d is invalid", size)
+	}
+
+	units := data[ptr : uint64(ptr)+size]
+	for i := 0; i < len(units); i += 2 {
+		r := rune(binary.LittleEndian.Uint16(units[i:]))
+		if utf16.IsSurrogate(r) && i+4 <= len(units) {
+			if pair := utf16.DecodeRune(r, rune(binary.LittleEndian.Uint16(units[i+2:]))); pair != utf8.RuneError {
+				r = pair
+				i += 2
+			}
+		}
+		dst = utf8.AppendRune(dst, r)
+	}
+	return dst, nil
+}
@@ -0,0 +1,840 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the ABI of WebAssembly components implementing the
+// model world of wasm-models/wit/model.wit, whose functions take and return
+// typed records laid out by the canonical ABI
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// With ABIComponent, a model is a component exporting functions of the
+// model world, or the core module of one as built by wit-bindgen. The
+// processor runs the component's core module, whose exports are:
+//
+//	memory                                         the guest's linear memory
+//	cabi_realloc(old i32, size i32, align i32, new i32) i32
+//	                                               allocates memory for inputs
+//	<function>(...) i32                            e.g. classify-error, takes the
+//	                                               flattened input or a pointer
+//	                                               to it, returns a pointer to
+//	                                               the output
+//	cabi_post_<function>(output i32)               optional, frees the output
+//
+// The input is converted from its JSON encoding, so fields dropped by the
+// input projection are empty, and the output is converted back to JSON.
+// Components can't import anything, since their imports would be
+// instantiated by a component runtime.
+const (
+	componentReallocExport = "cabi_realloc"
+	componentPostPrefix    = "cabi_post_"
+
+	// componentMaxFlatParams is the number of flattened parameters past
+	// which the canonical ABI passes them through memory
+	componentMaxFlatParams = 16
+)
+
+// witKind is the kind of a WIT type
+type witKind int
+
+const (
+	witString witKind = iota
+	witBool
+	witU32
+	witS64
+	witF64
+	witList
+	witRecord
+	witOption
+	// witValue is the value variant of attributes
+	witValue
+	// witAttributes is a list of attribute records, converted from and to
+	// a map
+	witAttributes
+)
+
+// witType describes the canonical ABI layout of a WIT type
+type witType struct {
+	kind   witKind
+	elem   *witType   // of lists and options
+	fields []witField // of records
+}
+
+// witField is a record field with the JSON key of the model input or
+// output it is converted from or to
+type witField struct {
+	key string
+	typ *witType
+}
+
+// The types of model.wit
+var (
+	witStringType     = &witType{kind: witString}
+	witBoolType       = &witType{kind: witBool}
+	witU32Type        = &witType{kind: witU32}
+	witS64Type        = &witType{kind: witS64}
+	witF64Type        = &witType{kind: witF64}
+	witValueType      = &witType{kind: witValue}
+	witAttributesType = &witType{kind: witAttributes}
+	witStringsType    = &witType{kind: witList, elem: witStringType}
+
+	// witValueCases are the payloads of text, integer, number, boolean and
+	// json values
+	witValueCases = []*witType{witStringType, witS64Type, witF64Type, witBoolType, witStringType}
+
+	witAttributeType = &witType{kind: witRecord, fields: []witField{
+		{"key", witStringType},
+		{"value", witValueType},
+	}}
+
+	witErrorInputType = &witType{kind: witRecord, fields: []witField{
+		{"name", witStringType},
+		{"status", witStringType},
+		{"kind", witStringType},
+		{"severity", witStringType},
+		{"body", witStringType},
+		{"attributes", witAttributesType},
+		{"resource", witAttributesType},
+	}}
+	witSampleInputType = &witType{kind: witRecord, fields: []witField{
+		{"name", witStringType},
+		{"kind", witStringType},
+		{"status", witStringType},
+		{"duration", witS64Type},
+		{"spans", witU32Type},
+		{"errors", witU32Type},
+		{"attributes", witAttributesType},
+		{"resource", witAttributesType},
+	}}
+	witEntityInputType = &witType{kind: witRecord, fields: []witField{
+		{"name", witStringType},
+		{"description", witStringType},
+		{"unit", witStringType},
+		{"is_monotonic", &witType{kind: witOption, elem: witBoolType}},
+		{"aggregation_temporality", witStringType},
+		{"value", &witType{kind: witOption, elem: witValueType}},
+		{"severity", witStringType},
+		{"body", witStringType},
+		{"attributes", witAttributesType},
+		{"resource", witAttributesType},
+	}}
+
+	witClassificationType = &witType{kind: witRecord, fields: []witField{
+		{"category", witStringType},
+		{"system", witStringType},
+		{"owner", witStringType},
+		{"severity", witStringType},
+		{"impact", witStringType},
+		{"confidence", witF64Type},
+		{"extra", witAttributesType},
+	}}
+	witSamplingDecisionType = &witType{kind: witRecord, fields: []witField{
+		{"importance", witF64Type},
+		{"keep", witBoolType},
+		{"reason", witStringType},
+		{"extra", witAttributesType},
+	}}
+	witEntitiesType = &witType{kind: witRecord, fields: []witField{
+		{"services", witStringsType},
+		{"dependencies", witStringsType},
+		{"operations", witStringsType},
+		{"confidence", witF64Type},
+		{"extra", witAttributesType},
+	}}
+)
+
+// componentJSON decodes inputs keeping numbers as json.Number, so integer
+// attributes are passed as integers
+var componentJSON = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+	UseNumber:              true,
+}.Froze()
+
+// componentFunction is a function of the model world
+type componentFunction struct {
+	export        string
+	input, output *witType
+	inMemory      bool // whether the input is passed through memory
+}
+
+// componentFunctions are the functions of the model world, keyed by the
+// name the runtime invokes them with
+var componentFunctions = map[string]componentFunction{
+	"classify_error":   newComponentFunction("classify-error", witErrorInputType, witClassificationType),
+	"sample_telemetry": newComponentFunction("sample-telemetry", witSampleInputType, witSamplingDecisionType),
+	"extract_entities": newComponentFunction("extract-entities", witEntityInputType, witEntitiesType),
+}
+
+// newComponentFunction describes a function exported as export
+func newComponentFunction(export string, input, output *witType) componentFunction {
+	return componentFunction{
+		export:   export,
+		input:    input,
+		output:   output,
+		inMemory: len(input.flat()) > componentMaxFlatParams,
+	}
+}
+
+// alignment returns the alignment of the type in memory
+func (t *witType) alignment() uint32 {
+	switch t.kind {
+	case witBool:
+		return 1
+	case witS64, witF64:
+		return 8
+	case witRecord:
+		alignment := uint32(1)
+		for _, field := range t.fields {
+			alignment = maxUint32(alignment, field.typ.alignment())
+		}
+		return alignment
+	case witOption, witValue:
+		alignment := uint32(1)
+		for _, payload := range t.cases() {
+			if payload != nil {
+				alignment = maxUint32(alignment, payload.alignment())
+			}
+		}
+		return alignment
+	default:
+		return 4
+	}
+}
+
+// size returns the size of the type in memory
+func (t *witType) size() uint32 {
+	switch t.kind {
+	case witBool:
+		return 1
+	case witU32:
+		return 4
+	case witRecord:
+		offsets := t.offsets()
+		last := t.fields[len(t.fields)-1]
+		return alignTo(offsets[len(offsets)-1]+last.typ.size(), t.alignment())
+	case witOption, witValue:
+		var size uint32
+		for _, payload := range t.cases() {
+			if payload != nil {
+				size = maxUint32(size, payload.size())
+			}
+		}
+		return alignTo(t.payloadOffset()+size, t.alignment())
+	default:
+		return 8
+	}
+}
+
+// offsets returns the offsets of the fields of a record
+func (t *witType) offsets() []uint32 {
+	offsets := make([]uint32, len(t.fields))
+	var offset uint32
+	for i, field := range t.fields {
+		offset = alignTo(offset, field.typ.alignment())
+		offsets[i] = offset
+		offset += field.typ.size()
+	}
+	return offsets
+}
+
+// cases returns the payloads of the cases of a variant, nil for cases
+// without one
+func (t *witType) cases() []*witType {
+	if t.kind == witOption {
+		return []*witType{nil, t.elem}
+	}
+	return witValueCases
+}
+
+// payloadOffset returns the offset of the payload of a variant after its
+// u8 discriminant
+func (t *witType) payloadOffset() uint32 {
+	return alignTo(1, t.alignment())
+}
+
+// flat returns the core types a value of the type is flattened to when it
+// is passed as parameters
+func (t *witType) flat() []valueKind {
+	switch t.kind {
+	case witBool, witU32:
+		return []valueKind{valueI32}
+	case witS64:
+		return []valueKind{valueI64}
+	case witF64:
+		return []valueKind{valueF64}
+	case witRecord:
+		var flat []valueKind
+		for _, field := range t.fields {
+			flat = append(flat, field.typ.flat()...)
+		}
+		return flat
+	case witOption, witValue:
+		// The payloads share the values following the discriminant
+		var payload []valueKind
+		for _, c := range t.cases() {
+			if c == nil {
+				continue
+			}
+			for i, kind := range c.flat() {
+				if i < len(payload) {
+					payload[i] = joinFlat(payload[i], kind)
+				} else {
+					payload = append(payload, kind)
+				}
+			}
+		}
+		return append([]valueKind{valueI32}, payload...)
+	default:
+		return []valueKind{valueI32, valueI32}
+	}
+}
+
+// joinFlat returns the core type holding values of both types
+func joinFlat(a, b valueKind) valueKind {
+	switch {
+	case a == b:
+		return a
+	case (a == valueI32 && b == valueF32) || (a == valueF32 && b == valueI32):
+		return valueI32
+	default:
+		return valueI64
+	}
+}
+
+// componentABI passes inputs and outputs as canonical ABI values
+type componentABI struct {
+	memory  guestMemory
+	realloc guestFunction
+
+	// post holds the post-return functions, keyed by the name the runtime
+	// invokes functions with
+	post map[string]guestFunction
+}
+
+// newComponentABI resolves the canonical ABI exports of an instance and
+// returns the functions of the model world it exports, keyed by the name
+// the runtime invokes them with
+func newComponentABI(instance guestInstance) (*componentABI, map[string]guestFunction, error) {
+	memory, err := instance.memory(abiMemoryExport)
+	if err != nil {
+		return nil, nil, fmt.Errorf("module does not export its memory: %w", err)
+	}
+	realloc, err := instance.function(componentReallocExport)
+	if err != nil {
+		return nil, nil, fmt.Errorf("module does not export %s: %w", componentReallocExport, err)
+	}
+
+	abi := &componentABI{memory: memory, realloc: realloc, post: make(map[string]guestFunction)}
+	functions := make(map[string]guestFunction)
+	for name, signature := range componentFunctions {
+		if function, err := instance.function(signature.export); err == nil {
+			functions[name] = function
+		}
+		if post, err := instance.function(componentPostPrefix + signature.export); err == nil {
+			abi.post[name] = post
+		}
+	}
+	return abi, functions, nil
+}
+
+// invoke implements guestABI
+func (a *componentABI) invoke(name string, function guestFunction, input []byte, decode func(output []byte) error) error {
+	signature, ok := componentFunctions[name]
+	if !ok {
+		return fmt.Errorf("function %s is not part of the model world", name)
+	}
+
+	var fields map[string]interface{}
+	if err := componentJSON.Unmarshal(input, &fields); err != nil {
+		return fmt.Errorf("failed to decode input of function %s: %w", name, err)
+	}
+
+	var args []interface{}
+	var err error
+	if signature.inMemory {
+		var ptr uint32
+		if ptr, err = a.allocate(signature.input.alignment(), signature.input.size()); err == nil {
+			err = a.store(signature.input, fields, ptr)
+			args = append(args, int32(ptr))
+		}
+	} else {
+		args, err = a.lowerFlat(signature.input, fields, args)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pass input to function %s: %w", name, err)
+	}
+
+	result, err := function(args...)
+	if err != nil {
+		return fmt.Errorf("failed to invoke function %s: %w", name, err)
+	}
+	outputPtr, ok := result.(int32)
+	if !ok {
+		return fmt.Errorf("function %s returned %T, expected i32", name, result)
+	}
+
+	output, err := liftComponentValue(a.memory.Data(), signature.output, uint32(outputPtr))
+	if post := a.post[name]; post != nil {
+		if _, postErr := post(outputPtr); postErr != nil && err == nil {
+			err = fmt.Errorf("failed to free output: %w", postErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("function %s returned an invalid output: %w", name, err)
+	}
+
+	encoded, err := jsonAPI.Marshal(componentOutput(output.(map[string]interface{})))
+	if err != nil {
+		return fmt.Errorf("failed to encode output of function %s: %w", name, err)
+	}
+	return decode(encoded)
+}
+
+// allocate reserves size bytes of guest memory with the given alignment
+func (a *componentABI) allocate(alignment, size uint32) (uint32, error) {
+	result, err := a.realloc(int32(0), int32(0), int32(alignment), int32(size))
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate guest memory: %w", err)
+	}
+	ptr, ok := result.(int32)
+	if !ok {
+		return 0, fmt.Errorf("%s returned %T, expected i32", componentReallocExport, result)
+	}
+	if uint64(uint32(ptr))+uint64(size) > uint64(a.memory.DataSize()) {
+		return 0, fmt.Errorf("%s returned memory outside the guest", componentReallocExport)
+	}
+	return uint32(ptr), nil
+}
+
+// store writes v as a value of type t at ptr, in memory the host allocated.
+// Allocations may grow the memory, so it is fetched again for every write.
+func (a *componentABI) store(t *witType, v interface{}, ptr uint32) error {
+	switch t.kind {
+	case witString:
+		s, _ := v.(string)
+		stringPtr, err := a.lowerString(s)
+		if err != nil {
+			return err
+		}
+		a.putUint32(ptr, stringPtr)
+		a.putUint32(ptr+4, uint32(len(s)))
+	case witBool:
+		a.memory.Data()[ptr] = boolByte(v)
+	case witU32:
+		a.putUint32(ptr, uint32(witInteger(v)))
+	case witS64:
+		binary.LittleEndian.PutUint64(a.memory.Data()[ptr:], uint64(witInteger(v)))
+	case witF64:
+		binary.LittleEndian.PutUint64(a.memory.Data()[ptr:], math.Float64bits(witNumber(v)))
+	case witRecord:
+		fields, _ := v.(map[string]interface{})
+		for i, offset := range t.offsets() {
+			if err := a.store(t.fields[i].typ, fields[t.fields[i].key], ptr+offset); err != nil {
+				return err
+			}
+		}
+	case witAttributes:
+		attributes, _ := v.(map[string]interface{})
+		listPtr, err := a.lowerAttributes(attributes)
+		if err != nil {
+			return err
+		}
+		a.putUint32(ptr, listPtr)
+		a.putUint32(ptr+4, uint32(len(attributes)))
+	case witOption, witValue:
+		discriminant, payload := t.choose(v)
+		a.memory.Data()[ptr] = byte(discriminant)
+		if c := t.cases()[discriminant]; c != nil {
+			return a.store(c, payload, ptr+t.payloadOffset())
+		}
+	default:
+		return fmt.Errorf("inputs can't hold values of kind %d", t.kind)
+	}
+	return nil
+}
+
+// lowerFlat appends v as the flattened values of type t to args
+func (a *componentABI) lowerFlat(t *witType, v interface{}, args []interface{}) ([]interface{}, error) {
+	switch t.kind {
+	case witString:
+		s, _ := v.(string)
+		ptr, err := a.lowerString(s)
+		if err != nil {
+			return nil, err
+		}
+		return append(args, int32(ptr), int32(len(s))), nil
+	case witBool:
+		return append(args, int32(boolByte(v))), nil
+	case witU32:
+		return append(args, int32(uint32(witInteger(v)))), nil
+	case witS64:
+		return append(args, witInteger(v)), nil
+	case witF64:
+		return append(args, witNumber(v)), nil
+	case witRecord:
+		fields, _ := v.(map[string]interface{})
+		var err error
+		for _, field := range t.fields {
+			if args, err = a.lowerFlat(field.typ, fields[field.key], args); err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	case witAttributes:
+		attributes, _ := v.(map[string]interface{})
+		ptr, err := a.lowerAttributes(attributes)
+		if err != nil {
+			return nil, err
+		}
+		return append(args, int32(ptr), int32(len(attributes))), nil
+	case witOption, witValue:
+		discriminant, payload := t.choose(v)
+		var values []interface{}
+		if c := t.cases()[discriminant]; c != nil {
+			var err error
+			if values, err = a.lowerFlat(c, payload, nil); err != nil {
+				return nil, err
+			}
+		}
+		// Convert the payload to the joined types of all payloads, and
+		// fill the values it doesn't use with zeros
+		args = append(args, int32(discriminant))
+		for i, kind := range t.flat()[1:] {
+			var value interface{}
+			if i < len(values) {
+				value = values[i]
+			}
+			args = append(args, coerceFlat(value, kind))
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("inputs can't hold values of kind %d", t.kind)
+	}
+}
+
+// coerceFlat converts a flattened value to the joined core type of a
+// variant's payloads, nil converting to zero
+func coerceFlat(v interface{}, kind valueKind) interface{} {
+	switch kind {
+	case valueI32:
+		if i, ok := v.(int32); ok {
+			return i
+		}
+		return int32(0)
+	case valueF64:
+		if f, ok := v.(float64); ok {
+			return f
+		}
+		return float64(0)
+	default:
+		switch value := v.(type) {
+		case int32:
+			return int64(uint32(value))
+		case int64:
+			return value
+		case float64:
+			return int64(math.Float64bits(value))
+		}
+		return int64(0)
+	}
+}
+
+// choose returns the case of a variant holding v and its payload
+func (t *witType) choose(v interface{}) (int, interface{}) {
+	if t.kind == witOption {
+		if v == nil {
+			return 0, nil
+		}
+		return 1, v
+	}
+
+	switch value := v.(type) {
+	case string:
+		return 0, value
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return 1, value
+		}
+		return 2, value
+	case float64:
+		return 2, value
+	case bool:
+		return 3, value
+	}
+	encoded, _ := jsonAPI.Marshal(v)
+	return 4, string(encoded)
+}
+
+// lowerString copies s into guest memory
+func (a *componentABI) lowerString(s string) (uint32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	ptr, err := a.allocate(1, uint32(len(s)))
+	if err != nil {
+		return 0, err
+	}
+	copy(a.memory.Data()[ptr:], s)
+	return ptr, nil
+}
+
+// lowerAttributes copies attributes into guest memory as a list of
+// attribute records in key order
+func (a *componentABI) lowerAttributes(attributes map[string]interface{}) (uint32, error) {
+	if len(attributes) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	size := witAttributeType.size()
+	ptr, err := a.allocate(witAttributeType.alignment(), size*uint32(len(keys)))
+	if err != nil {
+		return 0, err
+	}
+	valueOffset := witAttributeType.offsets()[1]
+	for i, k := range keys {
+		element := ptr + uint32(i)*size
+		if err := a.store(witStringType, k, element); err != nil {
+			return 0, err
+		}
+		if err := a.store(witValueType, attributes[k], element+valueOffset); err != nil {
+			return 0, err
+		}
+	}
+	return ptr, nil
+}
+
+// putUint32 writes a little-endian u32 at ptr
+func (a *componentABI) putUint32(ptr, v uint32) {
+	binary.LittleEndian.PutUint32(a.memory.Data()[ptr:], v)
+}
+
+// liftComponentValue reads a value of type t at ptr in data
+func liftComponentValue(data []byte, t *witType, ptr uint32) (interface{}, error) {
+	if uint64(ptr)+uint64(t.size()) > uint64(len(data)) {
+		return nil, fmt.Errorf("pointer %d is outside guest memory", ptr)
+	}
+
+	switch t.kind {
+	case witString:
+		return liftComponentString(data, ptr)
+	case witBool:
+		return data[ptr] != 0, nil
+	case witU32:
+		return int64(binary.LittleEndian.Uint32(data[ptr:])), nil
+	case witS64:
+		return int64(binary.LittleEndian.Uint64(data[ptr:])), nil
+	case witF64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data[ptr:])), nil
+	case witRecord:
+		fields := make(map[string]interface{}, len(t.fields))
+		for i, offset := range t.offsets() {
+			value, err := liftComponentValue(data, t.fields[i].typ, ptr+offset)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", t.fields[i].key, err)
+			}
+			fields[t.fields[i].key] = value
+		}
+		return fields, nil
+	case witList, witAttributes:
+		elem := t.elem
+		if t.kind == witAttributes {
+			elem = witAttributeType
+		}
+		listPtr, length := binary.LittleEndian.Uint32(data[ptr:]), binary.LittleEndian.Uint32(data[ptr+4:])
+		if uint64(listPtr)+uint64(length)*uint64(elem.size()) > uint64(len(data)) {
+			return nil, fmt.Errorf("list of %d elements at %d is outside guest memory", length, listPtr)
+		}
+
+		if t.kind == witAttributes {
+			attributes := make(map[string]interface{}, length)
+			for i := uint32(0); i < length; i++ {
+				attribute, err := liftComponentValue(data, elem, listPtr+i*elem.size())
+				if err != nil {
+					return nil, err
+				}
+				fields := attribute.(map[string]interface{})
+				attributes[fields["key"].(string)] = fields["value"]
+			}
+			return attributes, nil
+		}
+		list := make([]interface{}, length)
+		for i := range list {
+			value, err := liftComponentValue(data, elem, listPtr+uint32(i)*elem.size())
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case witOption, witValue:
+		cases := t.cases()
+		discriminant := int(data[ptr])
+		if discriminant >= len(cases) {
+			return nil, fmt.Errorf("invalid discriminant %d", discriminant)
+		}
+		if cases[discriminant] == nil {
+			return nil, nil
+		}
+		value, err := liftComponentValue(data, cases[discriminant], ptr+t.payloadOffset())
+		if err != nil || t.kind == witOption || discriminant != len(cases)-1 {
+			return value, err
+		}
+		// Decode json values, keeping invalid JSON as a string
+		var decoded interface{}
+		if err := jsonAPI.Unmarshal([]byte(value.(string)), &decoded); err != nil {
+			return value, nil
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %d", t.kind)
+	}
+}
+
+// liftComponentString copies the string at ptr in data
+func liftComponentString(data []byte, ptr uint32) (string, error) {
+	stringPtr, length := binary.LittleEndian.Uint32(data[ptr:]), binary.LittleEndian.Uint32(data[ptr+4:])
+	if uint64(stringPtr)+uint64(length) > uint64(len(data)) {
+		return "", fmt.Errorf("string of %d bytes at %d is outside guest memory", length, stringPtr)
+	}
+	return string(data[stringPtr : stringPtr+length]), nil
+}
+
+// componentOutput converts a lifted output record to the output of a
+// model: empty strings and lists are left out, and the extra attributes
+// are added unless they collide with a field
+func componentOutput(fields map[string]interface{}) map[string]interface{} {
+	extra, _ := fields["extra"].(map[string]interface{})
+	delete(fields, "extra")
+	for k, v := range fields {
+		switch value := v.(type) {
+		case string:
+			if value == "" {
+				delete(fields, k)
+			}
+		case []interface{}:
+			if len(value) == 0 {
+				delete(fields, k)
+			}
+		}
+	}
+	for k, v := range extra {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// witInteger converts a JSON number to an integer
+func witInteger(v interface{}) int64 {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return int64(f)
+	case float64:
+		return int64(value)
+	}
+	return 0
+}
+
+// witNumber converts a JSON number to a float
+func witNumber(v interface{}) float64 {
+	switch value := v.(type) {
+	case json.Number:
+		f, _ := value.Float64()
+		return f
+	case float64:
+		return value
+	}
+	return 0
+}
+
+// boolByte converts a JSON boolean to a canonical ABI bool
+func boolByte(v interface{}) byte {
+	if b, _ := v.(bool); b {
+		return 1
+	}
+	return 0
+}
+
+// alignTo rounds offset up to a multiple of alignment
+func alignTo(offset, alignment uint32) uint32 {
+	return (offset + alignment - 1) / alignment * alignment
+}
+
+// maxUint32 returns the larger of a and b
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Component binaries start with the \0asm magic followed by this version
+// and layer, where core modules have version 1
+var componentVersion = []byte{0x0d, 0x00, 0x01, 0x00}
+
+// Sections of component binaries
+const (
+	componentCoreModuleSection = 1
+	componentImportSection     = 10
+)
+
+// componentCoreModule returns the core module of a component binary, or
+// the binary itself if it is a core module. Only components embedding a
+// single core module and importing nothing, as wit-bindgen builds them for
+// the model world, are supported.
+func componentCoreModule(wasmBytes []byte) ([]byte, error) {
+	if len(wasmBytes) < 8 || string(wasmBytes[:4]) != "\x00asm" {
+		return nil, errors.New("not a WebAssembly binary")
+	}
+	if !bytes.Equal(wasmBytes[4:8], componentVersion) {
+		return wasmBytes, nil
+	}
+
+	var core []byte
+	for rest := wasmBytes[8:]; len(rest) > 0; {
+		id := rest[0]
+		size, n := binary.Uvarint(rest[1:])
+		if n <= 0 || uint64(1+n)+size > uint64(len(rest)) {
+			return nil, errors.New("malformed component section")
+		}
+		contents := rest[1+n : 1+n+int(size)]
+		rest = rest[1+n+int(size):]
+
+		switch id {
+		case componentCoreModuleSection:
+			if core != nil {
+				return nil, errors.New("component embeds several core modules, only components without imports are supported")
+			}
+			core = contents
+		case componentImportSection:
+			return nil, errors.New("component has imports, only components without imports are supported")
+		}
+	}
+	if core == nil {
+		return nil, errors.New("component does not embed a core module")
+	}
+	return core, nil
+}
@@ -0,0 +1,136 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+	"go.uber.org/zap"
+)
+
+// componentTestModule is the core module of a model component with a bump
+// allocator. sample-telemetry takes its input flattened and returns the
+// duration as importance, whether there are errors as keep, the name as
+// reason and the attributes as extra attributes. extract-entities takes
+// its input through memory and returns the name as the only service and
+// the integer value as confidence.
+const componentTestModule = `(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (global $posts (export "posts") (mut i32) (i32.const 0))
+  (func (export "cabi_realloc") (param i32 i32) (param $align i32) (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (i32.and
+      (i32.add (global.get $next) (i32.sub (local.get $align) (i32.const 1)))
+      (i32.sub (i32.const 0) (local.get $align))))
+    (global.set $next (i32.add (local.get $ptr) (local.get $size)))
+    (local.get $ptr))
+  (func (export "sample-telemetry")
+    (param $name i32) (param $nameLen i32) (param i32 i32 i32 i32)
+    (param $duration i64) (param i32) (param $errors i32)
+    (param $attributes i32) (param $attributesLen i32) (param i32 i32) (result i32)
+    (f64.store (i32.const 64) (f64.convert_i64_s (local.get $duration)))
+    (i32.store8 (i32.const 72) (i32.ne (local.get $errors) (i32.const 0)))
+    (i32.store (i32.const 76) (local.get $name))
+    (i32.store (i32.const 80) (local.get $nameLen))
+    (i32.store (i32.const 84) (local.get $attributes))
+    (i32.store (i32.const 88) (local.get $attributesLen))
+    (i32.const 64))
+  (func (export "cabi_post_sample-telemetry") (param i32)
+    (global.set $posts (i32.add (global.get $posts) (i32.const 1))))
+  (func (export "extract-entities") (param $input i32) (result i32)
+    (i32.store (i32.const 128) (i32.load (local.get $input)))
+    (i32.store (i32.const 132) (i32.load offset=4 (local.get $input)))
+    (i32.store (i32.const 160) (i32.const 128))
+    (i32.store (i32.const 164) (i32.const 1))
+    (f64.store (i32.const 184) (f64.convert_i64_s (i64.load offset=56 (local.get $input))))
+    (i32.const 160)))`
+
+func TestGuestModuleComponentABI(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(componentTestModule)
+	require.NoError(t, err)
+	store := wasmer.NewStore(wasmer.NewEngine())
+	module, err := wasmer.NewModule(store, wasmBytes)
+	require.NoError(t, err)
+	instance, err := wasmer.NewInstance(module, wasmer.NewImportObject())
+	require.NoError(t, err)
+	defer instance.Close()
+
+	guest, err := newGuestModule(wasmerInstance{Instance: instance}, ABIComponent)
+	require.NoError(t, err)
+	pool := &guestPool{guests: []*guestModule{guest}}
+	impl := &fullWasmImpl{logger: zap.NewNop()}
+
+	// Attribute values keep their types through the value variant
+	stream, err := encodeInput(&SampleInput{
+		Name:     "GET /orders",
+		Duration: 250,
+		Errors:   1,
+		Attributes: map[string]interface{}{
+			"http.status_code": int64(500),
+			"ratio":            0.5,
+			"retry":            true,
+			"tags":             []interface{}{"a", "b"},
+		},
+	}, nil)
+	require.NoError(t, err)
+	output, err := impl.invokeWasmFunction(context.Background(), pool, "sample_telemetry", stream.Buffer())
+	releaseInput(stream)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"importance":       250.0,
+		"keep":             true,
+		"reason":           "GET /orders",
+		"http.status_code": 500.0,
+		"ratio":            0.5,
+		"retry":            true,
+		"tags":             []interface{}{"a", "b"},
+	}, output)
+
+	posts, err := instance.Exports.GetGlobal("posts")
+	require.NoError(t, err)
+	count, err := posts.Get()
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), count)
+
+	// Inputs with more than 16 flattened values are passed through memory,
+	// and empty outputs are left out
+	stream, err = encodeInput(&EntityInput{Name: "checkout", Value: int64(3)}, nil)
+	require.NoError(t, err)
+	output, err = impl.invokeWasmFunction(context.Background(), pool, "extract_entities", stream.Buffer())
+	releaseInput(stream)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"services": []interface{}{"checkout"}, "confidence": 3.0}, output)
+
+	_, err = impl.invokeWasmFunction(context.Background(), pool, "classify_error", []byte(`{}`))
+	assert.ErrorContains(t, err, "function classify_error not found")
+}
+
+func TestComponentCoreModule(t *testing.T) {
+	core, err := wasmer.Wat2Wasm(componentTestModule)
+	require.NoError(t, err)
+
+	extracted, err := componentCoreModule(core)
+	require.NoError(t, err)
+	assert.Equal(t, core, extracted)
+
+	component := append([]byte("\x00asm"), componentVersion...)
+	component = append(component, componentCoreModuleSection)
+	component = binary.AppendUvarint(component, uint64(len(core)))
+	component = append(component, core...)
+	extracted, err = componentCoreModule(append(component, 11, 0))
+	require.NoError(t, err)
+	assert.Equal(t, core, extracted)
+
+	_, err = componentCoreModule(append(component, componentImportSection, 0))
+	assert.ErrorContains(t, err, "component has imports")
+
+	_, err = componentCoreModule(append(component, componentCoreModuleSection, 10))
+	assert.ErrorContains(t, err, "malformed component section")
+}
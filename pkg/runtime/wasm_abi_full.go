@@ -0,0 +1,395 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the memory ABI used to pass model inputs and outputs
+// through the linear memory of a WASM guest
+
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// With ABIRaw, a model module exports its linear memory, an allocator and
+// its model functions, all exchanging UTF-8 JSON:
+//
+//	memory                               the guest's linear memory
+//	alloc(size i32) i32                  reserves size bytes for the input
+//	dealloc(ptr i32, size i32)           optional, frees an input or output
+//	<function>(ptr i32, len i32) i64     returns the output as ptr<<32 | len
+//
+// The host writes the input into the reserved bytes, calls the function and
+// decodes the output straight from guest memory, so the only copy of the
+// input is the one into the guest.
+//
+// ABITinyGo is the same convention with the allocator TinyGo exports, which
+// keeps malloc'ed memory from being collected until it is freed, so the
+// output must be malloc'ed by the guest too:
+//
+//	malloc(size i32) i32                 reserves size bytes
+//	free(ptr i32)                        frees an input or output
+//
+// ABIRust uses the exports of ABIRaw, with dealloc required since Rust
+// deallocation needs the size, but functions return a single pointer to
+// the output preceded by its length as a little-endian u32, which a Rust
+// function can return from a Vec<u8> without multi-value returns:
+//
+//	<function>(ptr i32, len i32) i32     returns the output as [len u32][bytes]
+const (
+	abiMemoryExport  = "memory"
+	abiAllocExport   = "alloc"
+	abiDeallocExport = "dealloc"
+
+	// abiInitializeExport initializes the runtime of reactor modules
+	abiInitializeExport = "_initialize"
+
+	tinygoMallocExport = "malloc"
+	tinygoFreeExport   = "free"
+)
+
+// guestInstance is an instance of a model module in one of the WASM
+// runtimes
+type guestInstance interface {
+	// function returns an exported function
+	function(name string) (guestFunction, error)
+
+	// memory returns an exported memory
+	memory(name string) (guestMemory, error)
+
+	// setFuel gives the instance fuel for an invocation, and fuelExhausted
+	// reports whether the invocation ran out of it. They require the module
+	// to be compiled with metering.
+	setFuel(fuel uint64)
+	fuelExhausted() bool
+
+	// bind runs the following calls in ctx. Runtimes that can interrupt
+	// calls abort them once ctx is done, which closes the instance, and
+	// closed reports whether it was.
+	bind(ctx context.Context)
+	closed() bool
+
+	Close()
+}
+
+// guestFunction calls an exported function with int32, int64, float32 or
+// float64 arguments and returns its result, nil if it returns none
+type guestFunction = func(...interface{}) (interface{}, error)
+
+// guestMemory is the linear memory of an instance. Calls into the guest may
+// grow it, so Data is only valid until the next call.
+type guestMemory interface {
+	Data() []byte
+	DataSize() uint
+}
+
+// valueKind is the type of a WebAssembly value
+type valueKind uint8
+
+const (
+	valueI32 valueKind = iota
+	valueI64
+	valueF32
+	valueF64
+)
+
+// errFuelExhausted is returned when an invocation runs out of fuel
+var errFuelExhausted = errors.New("model invocation exceeded its fuel budget")
+
+// errMemoryExceeded is returned when an invocation grows the memory of an
+// instance beyond its limit
+var errMemoryExceeded = errors.New("model invocation exceeded its memory limit")
+
+// errGuestClosed is returned by calls to instances that were released
+var errGuestClosed = errors.New("model instance is closed")
+
+// guestModule is an instantiated model module and the ABI of its functions.
+// WASM instances are single-threaded, so calls are serialized.
+type guestModule struct {
+	instance guestInstance
+	abi      guestABI
+
+	// fuel is the fuel budget of each invocation, 0 for none. It requires
+	// the instance to be compiled by a metered engine.
+	fuel uint64
+
+	// memoryLimit is the size in bytes the memory of the instance may grow
+	// to, 0 for none. Memory can't shrink, so an instance growing beyond it
+	// is replaced.
+	memoryLimit uint
+
+	// respawn creates a new instance of the module, replacing instances
+	// closed by aborted calls
+	respawn func() (*guestModule, error)
+
+	mutex     sync.Mutex
+	functions map[string]guestFunction
+	closed    bool
+}
+
+// guestABI passes the inputs and outputs of a module's functions
+type guestABI interface {
+	// invoke calls function with input and passes its output, which is only
+	// valid during decode, to decode
+	invoke(name string, function guestFunction, input []byte, decode func(output []byte) error) error
+}
+
+// newGuestModule resolves the exports of an instance for abi
+func newGuestModule(instance guestInstance, abi string) (*guestModule, error) {
+	var guest guestABI
+	var err error
+	switch abi {
+	case "", ABIRaw:
+		guest, err = newPointerABI(instance, abiAllocExport, abiDeallocExport, true)
+	case ABITinyGo:
+		guest, err = newPointerABI(instance, tinygoMallocExport, tinygoFreeExport, false)
+	case ABIAssemblyScript:
+		guest, err = newAssemblyScriptABI(instance)
+	case ABIComponent:
+		var functions map[string]guestFunction
+		if guest, functions, err = newComponentABI(instance); err == nil {
+			return &guestModule{instance: instance, abi: guest, functions: functions}, nil
+		}
+	case ABIRust:
+		var pointers *pointerABI
+		if pointers, err = newPointerABI(instance, abiAllocExport, abiDeallocExport, true); err == nil {
+			if pointers.dealloc == nil {
+				err = fmt.Errorf("module does not export %s", abiDeallocExport)
+			}
+			pointers.prefixed = true
+			guest = pointers
+		}
+	default:
+		err = fmt.Errorf("unknown ABI %q", abi)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &guestModule{
+		instance:  instance,
+		abi:       guest,
+		functions: make(map[string]guestFunction),
+	}, nil
+}
+
+// call invokes a model function with input in ctx and passes its output,
+// which is only valid during decode, to decode
+func (g *guestModule) call(ctx context.Context, name string, input []byte, decode func(output []byte) error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return errGuestClosed
+	}
+
+	// Calls whose deadline passed while waiting for the instance don't run
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	function, err := g.function(name)
+	if err != nil {
+		return err
+	}
+	g.instance.bind(ctx)
+	defer g.instance.bind(context.Background())
+	if g.fuel == 0 {
+		err = g.abi.invoke(name, function, input, decode)
+	} else {
+		g.instance.setFuel(g.fuel)
+		err = g.abi.invoke(name, function, input, decode)
+		if err != nil && g.instance.fuelExhausted() {
+			err = fmt.Errorf("function %s: %w (%d operators)", name, errFuelExhausted, g.fuel)
+		}
+	}
+
+	exceeded := false
+	if size, over := g.memoryExceeded(); over {
+		exceeded = true
+		err = fmt.Errorf("function %s: %w (%d of %d bytes)", name, errMemoryExceeded, size, g.memoryLimit)
+	}
+
+	if err != nil && (g.instance.closed() || exceeded) && g.respawn != nil {
+		fresh, respawnErr := g.respawn()
+		if respawnErr != nil {
+			return fmt.Errorf("%w, and the module failed to re-instantiate: %v", err, respawnErr)
+		}
+		g.instance.Close()
+		g.instance, g.abi, g.functions = fresh.instance, fresh.abi, fresh.functions
+	}
+	return err
+}
+
+// memoryExceeded returns the size of the instance's memory and whether it
+// exceeds the memory limit
+func (g *guestModule) memoryExceeded() (uint, bool) {
+	if g.memoryLimit == 0 {
+		return 0, false
+	}
+	memory, err := g.instance.memory(abiMemoryExport)
+	if err != nil {
+		return 0, false
+	}
+	size := memory.DataSize()
+	return size, size > g.memoryLimit
+}
+
+// function returns an exported model function, resolving it on first use
+func (g *guestModule) function(name string) (guestFunction, error) {
+	if function, ok := g.functions[name]; ok {
+		return function, nil
+	}
+	function, err := g.instance.function(name)
+	if err != nil {
+		return nil, fmt.Errorf("function %s not found: %w", name, err)
+	}
+	g.functions[name] = function
+	return function, nil
+}
+
+// Close releases the instance once the running call, if any, returns
+func (g *guestModule) Close() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.closed = true
+	g.instance.Close()
+}
+
+// guestPool holds the instances of a model. Calls go to the instances in
+// turn, so concurrent calls run on different instances.
+type guestPool struct {
+	guests []*guestModule
+	next   atomic.Uint32
+}
+
+// call invokes a model function on the next instance
+func (p *guestPool) call(ctx context.Context, name string, input []byte, decode func(output []byte) error) error {
+	guest := p.guests[(p.next.Add(1)-1)%uint32(len(p.guests))]
+	return guest.call(ctx, name, input, decode)
+}
+
+// Close releases the instances
+func (p *guestPool) Close() {
+	for _, guest := range p.guests {
+		guest.Close()
+	}
+}
+
+// pointerABI passes inputs and outputs as pointers and lengths into memory
+// managed by the module's allocator exports
+type pointerABI struct {
+	memory      guestMemory
+	alloc       guestFunction
+	allocExport string
+	dealloc     guestFunction // nil if the module doesn't free memory
+	sized       bool          // whether dealloc takes the size freed
+	prefixed    bool          // whether outputs are length-prefixed
+}
+
+// newPointerABI resolves the memory and allocator exports of an instance.
+// The deallocator is optional if sized, as with ABIRaw.
+func newPointerABI(instance guestInstance, allocExport, deallocExport string, sized bool) (*pointerABI, error) {
+	memory, err := instance.memory(abiMemoryExport)
+	if err != nil {
+		return nil, fmt.Errorf("module does not export its memory: %w", err)
+	}
+	alloc, err := instance.function(allocExport)
+	if err != nil {
+		return nil, fmt.Errorf("module does not export %s: %w", allocExport, err)
+	}
+
+	abi := &pointerABI{memory: memory, alloc: alloc, allocExport: allocExport, sized: sized}
+	if dealloc, err := instance.function(deallocExport); err == nil {
+		abi.dealloc = dealloc
+	} else if !sized {
+		return nil, fmt.Errorf("module does not export %s: %w", deallocExport, err)
+	}
+	return abi, nil
+}
+
+// invoke implements guestABI
+func (a *pointerABI) invoke(name string, function guestFunction, input []byte, decode func(output []byte) error) error {
+	// Copy the input into guest memory
+	inputPtr, err := a.allocate(len(input))
+	if err != nil {
+		return err
+	}
+	defer a.free(inputPtr, len(input))
+	copy(a.memory.Data()[inputPtr:], input)
+
+	result, err := function(int32(inputPtr), int32(len(input)))
+	if err != nil {
+		return fmt.Errorf("failed to invoke function %s: %w", name, err)
+	}
+
+	// The call may have grown the memory, so fetch it again
+	data := a.memory.Data()
+	outputPtr, outputLen, err := a.output(data, result)
+	if err != nil {
+		return fmt.Errorf("function %s %w", name, err)
+	}
+	if a.prefixed {
+		defer a.free(outputPtr-4, int(outputLen)+4)
+	} else {
+		defer a.free(outputPtr, int(outputLen))
+	}
+
+	return decode(data[outputPtr : outputPtr+outputLen])
+}
+
+// output locates the output of a function in data from its result
+func (a *pointerABI) output(data []byte, result interface{}) (uint32, uint32, error) {
+	var ptr, length uint32
+	if a.prefixed {
+		prefix, ok := result.(int32)
+		if !ok {
+			return 0, 0, fmt.Errorf("returned %T, expected i32", result)
+		}
+		if uint64(uint32(prefix))+4 > uint64(len(data)) {
+			return 0, 0, fmt.Errorf("returned output outside guest memory")
+		}
+		ptr, length = uint32(prefix)+4, binary.LittleEndian.Uint32(data[uint32(prefix):])
+	} else {
+		packed, ok := result.(int64)
+		if !ok {
+			return 0, 0, fmt.Errorf("returned %T, expected i64", result)
+		}
+		ptr, length = uint32(uint64(packed)>>32), uint32(packed)
+	}
+
+	if uint64(ptr)+uint64(length) > uint64(len(data)) {
+		return 0, 0, fmt.Errorf("returned output outside guest memory")
+	}
+	return ptr, length, nil
+}
+
+// allocate reserves size bytes of guest memory
+func (a *pointerABI) allocate(size int) (uint32, error) {
+	result, err := a.alloc(int32(size))
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate guest memory: %w", err)
+	}
+	ptr, ok := result.(int32)
+	if !ok {
+		return 0, fmt.Errorf("%s returned %T, expected i32", a.allocExport, result)
+	}
+	if uint64(uint32(ptr))+uint64(size) > uint64(a.memory.DataSize()) {
+		return 0, fmt.Errorf("%s returned memory outside the guest", a.allocExport)
+	}
+	return uint32(ptr), nil
+}
+
+// free releases guest memory if the module exports a deallocator
+func (a *pointerABI) free(ptr uint32, size int) {
+	switch {
+	case a.dealloc == nil:
+	case a.sized:
+		a.dealloc(int32(ptr), int32(size))
+	default:
+		a.dealloc(int32(ptr))
+	}
+}
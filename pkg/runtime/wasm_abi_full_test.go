@@ -0,0 +1,347 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+	"go.uber.org/zap"
+)
+
+// abiTestModule is a guest with a bump allocator that counts frees, a
+// function echoing its input and one returning output outside its memory
+const abiTestModule = `(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (global $freed (export "freed") (mut i32) (i32.const 0))
+  (func (export "alloc") (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (global.get $next))
+    (global.set $next (i32.add (global.get $next) (local.get $size)))
+    (local.get $ptr))
+  (func (export "dealloc") (param i32 i32)
+    (global.set $freed (i32.add (global.get $freed) (i32.const 1))))
+  (func (export "echo") (param $ptr i32) (param $len i32) (result i64)
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $ptr)) (i64.const 32))
+      (i64.extend_i32_u (local.get $len))))
+  (func (export "outside") (param i32 i32) (result i64)
+    (i64.const -1)))`
+
+func newTestGuestModule(t *testing.T) *guestModule {
+	wasmBytes, err := wasmer.Wat2Wasm(abiTestModule)
+	require.NoError(t, err)
+
+	store := wasmer.NewStore(wasmer.NewEngine())
+	module, err := wasmer.NewModule(store, wasmBytes)
+	require.NoError(t, err)
+	instance, err := wasmer.NewInstance(module, wasmer.NewImportObject())
+	require.NoError(t, err)
+
+	guest, err := newGuestModule(wasmerInstance{Instance: instance}, ABIRaw)
+	require.NoError(t, err)
+	t.Cleanup(guest.Close)
+	return guest
+}
+
+func TestGuestModuleCallPassesInputThroughMemory(t *testing.T) {
+	guest := newTestGuestModule(t)
+
+	input := []byte(`{"name":"GET /","attributes":{"http.status_code":500}}`)
+	var output []byte
+	err := guest.call(context.Background(), "echo", input, func(result []byte) error {
+		output = append(output, result...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, input, output)
+
+	// Both the input and the output are freed
+	assert.Equal(t, int32(2), exportedGlobal(t, guest.instance, "freed"))
+}
+
+func TestGuestModuleCallRejectsInvalidOutput(t *testing.T) {
+	guest := newTestGuestModule(t)
+
+	err := guest.call(context.Background(), "outside", []byte(`{}`), func([]byte) error { return nil })
+	assert.ErrorContains(t, err, "outside guest memory")
+
+	err = guest.call(context.Background(), "missing", []byte(`{}`), func([]byte) error { return nil })
+	assert.ErrorContains(t, err, "function missing not found")
+}
+
+// testRuntimes are the runtimes the loading tests run in
+var testRuntimes = []string{RuntimeWasmer, RuntimeWazero}
+
+// newTestImpl creates an implementation loading models as configured
+func newTestImpl(t *testing.T, config *WasmRuntimeConfig) *fullWasmImpl {
+	loader, err := newModelLoader(zap.NewNop(), config)
+	require.NoError(t, err)
+	return &fullWasmImpl{logger: zap.NewNop(), loader: loader, abis: config.ABIs, instances: config.Instances}
+}
+
+// exportedGlobal returns the value of an exported i32 global
+func exportedGlobal(t *testing.T, instance guestInstance, name string) int32 {
+	switch instance := instance.(type) {
+	case wasmerInstance:
+		global, err := instance.Exports.GetGlobal(name)
+		require.NoError(t, err)
+		value, err := global.Get()
+		require.NoError(t, err)
+		return value.(int32)
+	case *wazeroInstance:
+		global := instance.module.ExportedGlobal(name)
+		require.NotNil(t, global)
+		return int32(global.Get())
+	default:
+		t.Fatalf("unknown instance type %T", instance)
+		return 0
+	}
+}
+
+func TestGuestPoolCallsInstancesInTurn(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(abiTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "echo.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	for _, runtime := range testRuntimes {
+		t.Run(runtime, func(t *testing.T) {
+			impl := newTestImpl(t, &WasmRuntimeConfig{
+				Engine:    EngineConfig{Runtime: runtime},
+				Instances: map[string]int{ModelSampler: 3},
+			})
+			pool, err := impl.loadWasmModel(path, ModelSampler)
+			require.NoError(t, err)
+			defer pool.Close()
+			require.Len(t, pool.guests, 3)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, pool.call(context.Background(), "echo", []byte(`{}`), func([]byte) error { return nil }))
+				}()
+			}
+			wg.Wait()
+
+			// Each instance freed the inputs and outputs of two calls
+			for _, guest := range pool.guests {
+				assert.Equal(t, int32(4), exportedGlobal(t, guest.instance, "freed"))
+			}
+		})
+	}
+}
+
+func TestReloadModelRequiresModelFunction(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(abiTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "echo.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	impl := newTestImpl(t, &WasmRuntimeConfig{})
+	pool, err := impl.loadWasmModel(path, ModelSampler)
+	require.NoError(t, err)
+	impl.sampler.Store(pool)
+	defer impl.Close()
+
+	// The loaded model is kept when the new one lacks the model function
+	err = impl.ReloadModel(ModelSampler, path)
+	assert.ErrorContains(t, err, "function sample_telemetry not found")
+	assert.Same(t, pool, impl.sampler.Load())
+}
+
+// tinygoTestModule is a guest with TinyGo's allocator exports, whose echo
+// function returns a malloc'ed copy of its input
+const tinygoTestModule = `(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (global $freed (export "freed") (mut i32) (i32.const 0))
+  (func $malloc (export "malloc") (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (global.get $next))
+    (global.set $next (i32.add (global.get $next) (local.get $size)))
+    (local.get $ptr))
+  (func (export "free") (param i32)
+    (global.set $freed (i32.add (global.get $freed) (i32.const 1))))
+  (func (export "echo") (param $ptr i32) (param $len i32) (result i64)
+    (local $out i32)
+    (local.set $out (call $malloc (local.get $len)))
+    (memory.copy (local.get $out) (local.get $ptr) (local.get $len))
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $out)) (i64.const 32))
+      (i64.extend_i32_u (local.get $len)))))`
+
+func TestGuestModuleTinyGoABI(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(tinygoTestModule)
+	require.NoError(t, err)
+	store := wasmer.NewStore(wasmer.NewEngine())
+	module, err := wasmer.NewModule(store, wasmBytes)
+	require.NoError(t, err)
+	instance, err := wasmer.NewInstance(module, wasmer.NewImportObject())
+	require.NoError(t, err)
+	defer instance.Close()
+
+	// TinyGo modules don't export the raw ABI's allocator
+	_, err = newGuestModule(wasmerInstance{Instance: instance}, ABIRaw)
+	assert.ErrorContains(t, err, "does not export alloc")
+
+	guest, err := newGuestModule(wasmerInstance{Instance: instance}, ABITinyGo)
+	require.NoError(t, err)
+	input := []byte(`{"name":"GET /"}`)
+	var output []byte
+	require.NoError(t, guest.call(context.Background(), "echo", input, func(result []byte) error {
+		output = append(output, result...)
+		return nil
+	}))
+	assert.Equal(t, input, output)
+
+	freed, err := instance.Exports.GetGlobal("freed")
+	require.NoError(t, err)
+	count, err := freed.Get()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), count)
+}
+
+// rustTestModule is a guest with the raw ABI's allocator, whose echo
+// function returns a length-prefixed copy of its input
+const rustTestModule = `(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (global $freed (export "freed") (mut i32) (i32.const 0))
+  (func $alloc (export "alloc") (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (global.get $next))
+    (global.set $next (i32.add (global.get $next) (local.get $size)))
+    (local.get $ptr))
+  (func (export "dealloc") (param i32 i32)
+    (global.set $freed (i32.add (global.get $freed) (local.get 1))))
+  (func (export "echo") (param $ptr i32) (param $len i32) (result i32)
+    (local $out i32)
+    (local.set $out (call $alloc (i32.add (local.get $len) (i32.const 4))))
+    (i32.store (local.get $out) (local.get $len))
+    (memory.copy (i32.add (local.get $out) (i32.const 4)) (local.get $ptr) (local.get $len))
+    (local.get $out))
+  (func (export "outside") (param i32 i32) (result i32)
+    (i32.const 65534)))`
+
+func TestGuestModuleRustABI(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(rustTestModule)
+	require.NoError(t, err)
+	store := wasmer.NewStore(wasmer.NewEngine())
+	module, err := wasmer.NewModule(store, wasmBytes)
+	require.NoError(t, err)
+	instance, err := wasmer.NewInstance(module, wasmer.NewImportObject())
+	require.NoError(t, err)
+	defer instance.Close()
+
+	guest, err := newGuestModule(wasmerInstance{Instance: instance}, ABIRust)
+	require.NoError(t, err)
+	input := []byte(`{"name":"GET /"}`)
+	var output []byte
+	require.NoError(t, guest.call(context.Background(), "echo", input, func(result []byte) error {
+		output = append(output, result...)
+		return nil
+	}))
+	assert.Equal(t, input, output)
+
+	// The input and the output with its prefix are freed with their sizes
+	freed, err := instance.Exports.GetGlobal("freed")
+	require.NoError(t, err)
+	size, err := freed.Get()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2*len(input)+4), size)
+
+	err = guest.call(context.Background(), "outside", input, func([]byte) error { return nil })
+	assert.ErrorContains(t, err, "outside guest memory")
+}
+
+// assemblyScriptTestModule mimics the AssemblyScript runtime exports, with
+// an echo function returning its input string and one returning an array
+const assemblyScriptTestModule = `(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+  (global $pinned (export "pinned") (mut i32) (i32.const 0))
+  (func $new (export "__new") (param $size i32) (param $id i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (i32.add (global.get $next) (i32.const 20)))
+    (i32.store (i32.sub (local.get $ptr) (i32.const 8)) (local.get $id))
+    (i32.store (i32.sub (local.get $ptr) (i32.const 4)) (local.get $size))
+    (global.set $next (i32.add (local.get $ptr) (local.get $size)))
+    (local.get $ptr))
+  (func (export "__pin") (param $ptr i32) (result i32)
+    (global.set $pinned (i32.add (global.get $pinned) (i32.const 1)))
+    (local.get $ptr))
+  (func (export "__unpin") (param i32)
+    (global.set $pinned (i32.sub (global.get $pinned) (i32.const 1))))
+  (func (export "echo") (param $input i32) (result i32)
+    (local.get $input))
+  (func (export "array") (param i32) (result i32)
+    (call $new (i32.const 4) (i32.const 1))))`
+
+func TestGuestModuleAssemblyScriptABI(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(assemblyScriptTestModule)
+	require.NoError(t, err)
+	store := wasmer.NewStore(wasmer.NewEngine())
+	module, err := wasmer.NewModule(store, wasmBytes)
+	require.NoError(t, err)
+	instance, err := wasmer.NewInstance(module, wasmer.NewImportObject())
+	require.NoError(t, err)
+	defer instance.Close()
+
+	guest, err := newGuestModule(wasmerInstance{Instance: instance}, ABIAssemblyScript)
+	require.NoError(t, err)
+
+	// Strings round-trip through UTF-16, including surrogate pairs
+	input := []byte(`{"name":"café","body":"deploy failed 🚀"}`)
+	var output []byte
+	require.NoError(t, guest.call(context.Background(), "echo", input, func(result []byte) error {
+		output = append(output, result...)
+		return nil
+	}))
+	assert.Equal(t, string(input), string(output))
+
+	// The input is unpinned once the call returns
+	pinned, err := instance.Exports.GetGlobal("pinned")
+	require.NoError(t, err)
+	count, err := pinned.Get()
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), count)
+
+	err = guest.call(context.Background(), "array", input, func([]byte) error { return nil })
+	assert.ErrorContains(t, err, "object has class id 1")
+}
+
+func TestAssemblyScriptABIRunsBundledModel(t *testing.T) {
+	for _, runtime := range testRuntimes {
+		t.Run(runtime, func(t *testing.T) {
+			impl := newTestImpl(t, &WasmRuntimeConfig{
+				Engine: EngineConfig{Runtime: runtime},
+				ABIs:   map[string]string{ModelErrorClassifier: ABIAssemblyScript},
+			})
+
+			guest, err := impl.loadWasmModel("../../wasm-models/error-classifier/build/error-classifier.wasm", ModelErrorClassifier)
+			require.NoError(t, err)
+			defer guest.Close()
+
+			output, err := impl.invokeWasmFunction(context.Background(), guest, "classify_error",
+				[]byte(`{"name":"ExecuteQuery","status":"connection refused by postgres","attributes":{"db.system":"postgresql"},"resource":{"service.name":"orders"}}`))
+			require.NoError(t, err)
+			assert.Equal(t, "database_error", output["category"])
+			assert.Equal(t, "orders", output["system"])
+
+			// Aborts trap with the message lifted from guest memory
+			_, err = impl.invokeWasmFunction(context.Background(), guest, "classify_error", []byte(`{"name":"ExecuteQuery"}`))
+			assert.ErrorContains(t, err, `AssemblyScript abort: "Key does not exist" at ~lib/map.ts`)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+// This file contains the on-disk cache of compiled WASM modules, which
+// spares restarted collectors the compilation of their models
+
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+	"go.uber.org/zap"
+)
+
+// compiledModuleFormat identifies the compiler that produced a cached
+// module. Compiled modules can only be loaded by the same wasmer version on
+// the same platform, so it is part of the cache key.
+var compiledModuleFormat = "wasmer-go-1.0.4-" + goruntime.GOOS + "-" + goruntime.GOARCH
+
+// compileWasmModule compiles wasmBytes, loading the compiled module from
+// cacheDir if it was compiled before by an engine with the same engineID.
+// An empty cacheDir disables the cache. Cache failures are logged and fall
+// back to compiling.
+func compileWasmModule(logger *zap.Logger, store *wasmer.Store, wasmBytes []byte, cacheDir string, engineID string) (*wasmer.Module, error) {
+	if cacheDir == "" {
+		return wasmer.NewModule(store, wasmBytes)
+	}
+
+	key := sha256.New()
+	key.Write([]byte(compiledModuleFormat))
+	key.Write([]byte(engineID))
+	key.Write(wasmBytes)
+	path := filepath.Join(cacheDir, hex.EncodeToString(key.Sum(nil))+".wasmu")
+
+	if compiled, err := os.ReadFile(path); err == nil {
+		module, err := wasmer.DeserializeModule(store, compiled)
+		if err == nil {
+			logger.Debug("Loaded compiled WASM module from cache", zap.String("path", path))
+			return module, nil
+		}
+		logger.Warn("Ignoring unreadable compiled WASM module", zap.String("path", path), zap.Error(err))
+	}
+
+	module, err := wasmer.NewModule(store, wasmBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := storeCompiledModule(module, cacheDir, path); err != nil {
+		logger.Warn("Failed to cache compiled WASM module", zap.String("path", path), zap.Error(err))
+	}
+	return module, nil
+}
+
+// storeCompiledModule writes a compiled module to path, atomically so that
+// collectors sharing cacheDir never load a partial module
+func storeCompiledModule(module *wasmer.Module, cacheDir string, path string) error {
+	compiled, err := module.Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize module: %w", err)
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(cacheDir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(compiled); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
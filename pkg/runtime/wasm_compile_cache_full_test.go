@@ -0,0 +1,49 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+	"go.uber.org/zap"
+)
+
+func TestCompileWasmModuleReusesCompiledModule(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(abiTestModule)
+	require.NoError(t, err)
+	cacheDir := filepath.Join(t.TempDir(), "compiled")
+
+	compile := func() *wasmer.Module {
+		store := wasmer.NewStore(wasmer.NewEngine())
+		module, err := compileWasmModule(zap.NewNop(), store, wasmBytes, cacheDir, "default")
+		require.NoError(t, err)
+		_, err = wasmer.NewInstance(module, wasmer.NewImportObject())
+		require.NoError(t, err)
+		return module
+	}
+
+	// The first load compiles and caches the module
+	compile()
+	cached, err := filepath.Glob(filepath.Join(cacheDir, "*.wasmu"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+
+	// A corrupted module is recompiled and replaced
+	require.NoError(t, os.WriteFile(cached[0], []byte("corrupted"), 0o644))
+	compile()
+	compiled, err := os.ReadFile(cached[0])
+	require.NoError(t, err)
+	assert.NotEqual(t, "corrupted", string(compiled))
+
+	// The cached module is loaded as is
+	compile()
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
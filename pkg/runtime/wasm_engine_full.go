@@ -0,0 +1,107 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+// This file contains the construction of the WASM engine from the engine
+// tuning options
+
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+)
+
+// wasmEngine is the engine compiling the models of a runtime
+type wasmEngine struct {
+	engine *wasmer.Engine
+
+	// id describes the settings that affect compiled code, so modules
+	// compiled with other settings are not loaded from the cache
+	id string
+
+	// metered is whether the engine meters fuel
+	metered bool
+}
+
+// Compilers and engines selectable in EngineConfig
+var (
+	wasmCompilers = map[string]wasmer.CompilerKind{
+		"cranelift":  wasmer.CRANELIFT,
+		"llvm":       wasmer.LLVM,
+		"singlepass": wasmer.SINGLEPASS,
+	}
+	wasmEngines = map[string]wasmer.EngineKind{
+		"universal": wasmer.UNIVERSAL,
+		"dylib":     wasmer.DYLIB,
+	}
+)
+
+// newWasmEngine creates the engine configured by config, metering fuel if
+// metered. Empty settings use wasmer's defaults.
+func newWasmEngine(config EngineConfig, metered bool) (*wasmEngine, error) {
+	if config.Compiler == "" && config.Engine == "" && len(config.CPUFeatures) == 0 && !metered {
+		return &wasmEngine{engine: wasmer.NewEngine(), id: "default"}, nil
+	}
+
+	engineConfig := wasmer.NewConfig()
+	if metered {
+		if err := enableMetering(engineConfig); err != nil {
+			return nil, err
+		}
+	}
+	if config.Compiler != "" {
+		compiler, ok := wasmCompilers[config.Compiler]
+		if !ok {
+			return nil, fmt.Errorf("unknown WASM compiler %q", config.Compiler)
+		}
+		if !wasmer.IsCompilerAvailable(compiler) {
+			return nil, fmt.Errorf("WASM compiler %s is not available in this build", config.Compiler)
+		}
+		switch compiler {
+		case wasmer.CRANELIFT:
+			engineConfig.UseCraneliftCompiler()
+		case wasmer.LLVM:
+			engineConfig.UseLLVMCompiler()
+		case wasmer.SINGLEPASS:
+			engineConfig.UseSinglepassCompiler()
+		}
+	}
+	if config.Engine != "" {
+		engine, ok := wasmEngines[config.Engine]
+		if !ok {
+			return nil, fmt.Errorf("unknown WASM engine %q", config.Engine)
+		}
+		if !wasmer.IsEngineAvailable(engine) {
+			return nil, fmt.Errorf("WASM engine %s is not available in this build", config.Engine)
+		}
+		switch engine {
+		case wasmer.UNIVERSAL:
+			engineConfig.UseUniversalEngine()
+		case wasmer.DYLIB:
+			engineConfig.UseDylibEngine()
+		}
+	}
+
+	// CPU features let the compiler emit host instructions such as AVX2
+	features := append([]string(nil), config.CPUFeatures...)
+	sort.Strings(features)
+	if len(features) > 0 {
+		cpuFeatures := wasmer.NewCpuFeatures()
+		for _, feature := range features {
+			if err := cpuFeatures.Add(feature); err != nil {
+				return nil, fmt.Errorf("invalid CPU feature: %w", err)
+			}
+		}
+		engineConfig.UseTarget(wasmer.NewTarget(wasmer.NewTripleFromHost(), cpuFeatures))
+	}
+
+	// Metering instruments the compiled code
+	id := fmt.Sprintf("%s-%s-%s", config.Compiler, config.Engine, strings.Join(features, "+"))
+	if metered {
+		id += "-metered"
+	}
+	return &wasmEngine{engine: wasmer.NewEngineWithConfig(engineConfig), id: id, metered: metered}, nil
+}
@@ -0,0 +1,29 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+)
+
+func TestNewWasmEngine(t *testing.T) {
+	engine, err := newWasmEngine(EngineConfig{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "default", engine.id)
+
+	if wasmer.IsCompilerAvailable(wasmer.CRANELIFT) {
+		engine, err := newWasmEngine(EngineConfig{Compiler: "cranelift", Engine: "universal"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, "cranelift-universal-", engine.id)
+	}
+
+	_, err = newWasmEngine(EngineConfig{Compiler: "v8"}, false)
+	assert.ErrorContains(t, err, `unknown WASM compiler "v8"`)
+	_, err = newWasmEngine(EngineConfig{Engine: "aot"}, false)
+	assert.ErrorContains(t, err, `unknown WASM engine "aot"`)
+}
@@ -0,0 +1,98 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the host ABI shared by the runtimes: the env functions
+// models can import to log, read the clock and draw random numbers
+
+package runtime
+
+import (
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Functions of the host ABI, imported from the env module
+const (
+	// hostLogImport logs a UTF-8 message: log(level i32, ptr i32, len i32)
+	hostLogImport = "log"
+
+	// hostNowImport returns the Unix time in milliseconds: now_ms() i64
+	hostNowImport = "now_ms"
+
+	// hostRandomImport returns a random number in [0, 1): random() f64
+	hostRandomImport = "random"
+)
+
+// maxHostLogMessage bounds the bytes of a logged message, longer messages
+// being truncated
+const maxHostLogMessage = 1024
+
+// hostFunctions implements the host ABI for an instance of a model
+type hostFunctions struct {
+	logger  *zap.Logger
+	sandbox *Sandbox
+
+	// random is the deterministic randomness of the instance, nil unless
+	// the sandbox makes randomness deterministic
+	random *rand.Rand
+}
+
+// newHostFunctions creates the host functions of an instance of model
+func newHostFunctions(logger *zap.Logger, model string, sandbox *Sandbox) *hostFunctions {
+	host := &hostFunctions{logger: logger.With(zap.String("model", model)), sandbox: sandbox}
+	if sandbox.DeterministicRandom {
+		host.random = rand.New(sandbox.random())
+	}
+	return host
+}
+
+// log logs the message at ptr and length in data at a level of 0 for debug,
+// 1 for info, 2 for warnings and 3 or more for errors. Messages outside
+// data are logged as invalid.
+func (h *hostFunctions) log(data []byte, level, ptr, length int32) {
+	var message string
+	start, end := uint64(uint32(ptr)), uint64(uint32(ptr))+uint64(uint32(length))
+	if end > uint64(len(data)) {
+		message = "<message outside guest memory>"
+	} else {
+		if end-start > maxHostLogMessage {
+			end = start + maxHostLogMessage
+		}
+		message = strings.ToValidUTF8(string(data[start:end]), "\uFFFD")
+	}
+
+	var zapLevel zapcore.Level
+	switch {
+	case level <= 0:
+		zapLevel = zapcore.DebugLevel
+	case level == 1:
+		zapLevel = zapcore.InfoLevel
+	case level == 2:
+		zapLevel = zapcore.WarnLevel
+	default:
+		zapLevel = zapcore.ErrorLevel
+	}
+	if entry := h.logger.Check(zapLevel, "Model log"); entry != nil {
+		entry.Write(zap.String("message", message))
+	}
+}
+
+// nowMs returns the Unix time in milliseconds, 0 if the clock is frozen
+func (h *hostFunctions) nowMs() int64 {
+	if h.sandbox.FrozenClock {
+		return 0
+	}
+	return time.Now().UnixMilli()
+}
+
+// randomFloat returns a random number in [0, 1)
+func (h *hostFunctions) randomFloat() float64 {
+	if h.random != nil {
+		return h.random.Float64()
+	}
+	return rand.Float64()
+}
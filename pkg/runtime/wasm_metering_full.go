@@ -0,0 +1,114 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+// This file contains the fuel metering of model invocations, which bounds
+// the WebAssembly operators an invocation executes. wasmer-go doesn't wrap
+// the metering middleware of the wasmer C API, so its functions are looked
+// up in the wasmer library wasmer-go links.
+
+package runtime
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdbool.h>
+
+typedef void *(*metering_new_t)(uint64_t, uint64_t (*)(int));
+typedef void *(*metering_as_middleware_t)(void *);
+typedef void (*config_push_middleware_t)(void *, void *);
+typedef void (*metering_set_remaining_points_t)(const void *, uint64_t);
+typedef bool (*metering_points_are_exhausted_t)(const void *);
+
+static metering_new_t metering_new;
+static metering_as_middleware_t metering_as_middleware;
+static config_push_middleware_t config_push_middleware;
+static metering_set_remaining_points_t metering_set_remaining_points;
+static metering_points_are_exhausted_t metering_points_are_exhausted;
+
+// Every operator costs one unit of fuel
+static uint64_t operator_cost(int op) {
+	return 1;
+}
+
+static bool metering_resolve(void) {
+	metering_new = (metering_new_t) dlsym(RTLD_DEFAULT, "wasmer_metering_new");
+	metering_as_middleware = (metering_as_middleware_t) dlsym(RTLD_DEFAULT, "wasmer_metering_as_middleware");
+	config_push_middleware = (config_push_middleware_t) dlsym(RTLD_DEFAULT, "wasm_config_push_middleware");
+	metering_set_remaining_points = (metering_set_remaining_points_t) dlsym(RTLD_DEFAULT, "wasmer_metering_set_remaining_points");
+	metering_points_are_exhausted = (metering_points_are_exhausted_t) dlsym(RTLD_DEFAULT, "wasmer_metering_points_are_exhausted");
+	return metering_new && metering_as_middleware && config_push_middleware &&
+		metering_set_remaining_points && metering_points_are_exhausted;
+}
+
+static void metering_push(void *config, uint64_t limit) {
+	config_push_middleware(config, metering_as_middleware(metering_new(limit, operator_cost)));
+}
+
+static void metering_set_fuel(void *instance, uint64_t fuel) {
+	metering_set_remaining_points(instance, fuel);
+}
+
+static bool metering_exhausted(void *instance) {
+	return metering_points_are_exhausted(instance);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"unsafe"
+
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+)
+
+// meteringAvailable resolves the metering functions once
+var meteringAvailable = sync.OnceValue(func() bool {
+	return bool(C.metering_resolve())
+})
+
+// enableMetering adds fuel metering to the engine configuration. Instances
+// start without a budget, so loading a module isn't limited, and each
+// invocation is given its budget when it starts.
+func enableMetering(config *wasmer.Config) error {
+	inner := wasmerInner(config)
+	if inner == nil || !meteringAvailable() {
+		return errors.New("fuel metering is not supported by this wasmer build")
+	}
+	C.metering_push(inner, C.uint64_t(math.MaxUint64))
+	return nil
+}
+
+// checkMetering verifies that fuel can be given to an instance of a metered
+// engine, which needs the C object wrapped by the instance
+func checkMetering(instance *wasmer.Instance) error {
+	if wasmerInner(instance) == nil || !meteringAvailable() {
+		return errors.New("fuel metering is not supported by this wasmer build")
+	}
+	return nil
+}
+
+// setFuel gives an instance of a metered engine fuel for an invocation. The
+// instance must have passed checkMetering.
+func setFuel(instance *wasmer.Instance, fuel uint64) {
+	C.metering_set_fuel(wasmerInner(instance), C.uint64_t(fuel))
+}
+
+// fuelExhausted reports whether an instance of a metered engine ran out of
+// fuel in its last invocation
+func fuelExhausted(instance *wasmer.Instance) bool {
+	return bool(C.metering_exhausted(wasmerInner(instance)))
+}
+
+// wasmerInner returns the C object wrapped by a wasmer-go value, or nil if
+// the value doesn't wrap one as expected
+func wasmerInner(v interface{}) unsafe.Pointer {
+	field := reflect.ValueOf(v).Elem().FieldByName("_inner")
+	if !field.IsValid() || field.Kind() != reflect.Pointer {
+		return nil
+	}
+	return field.UnsafePointer()
+}
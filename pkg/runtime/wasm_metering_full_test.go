@@ -0,0 +1,132 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+)
+
+// meteringTestModule has a function spinning until it is stopped and one
+// returning its input
+const meteringTestModule = `(module
+  (memory (export "memory") 1)
+  (func (export "alloc") (param i32) (result i32)
+    (i32.const 1024))
+  (func (export "spin") (param i32 i32) (result i64)
+    (loop $forever (br $forever))
+    (i64.const 0))
+  (func (export "echo") (param $ptr i32) (param $len i32) (result i64)
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $ptr)) (i64.const 32))
+      (i64.extend_i32_u (local.get $len)))))`
+
+func TestGuestModuleFuelBudget(t *testing.T) {
+	engine, err := newWasmEngine(EngineConfig{}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "---metered", engine.id)
+
+	wasmBytes, err := wasmer.Wat2Wasm(meteringTestModule)
+	require.NoError(t, err)
+	module, err := wasmer.NewModule(wasmer.NewStore(engine.engine), wasmBytes)
+	require.NoError(t, err)
+	instance, err := wasmer.NewInstance(module, wasmer.NewImportObject())
+	require.NoError(t, err)
+	defer instance.Close()
+
+	// Instances that don't wrap a C instance can't be given fuel
+	require.NoError(t, checkMetering(instance))
+	assert.Error(t, checkMetering(&wasmer.Instance{}))
+
+	guest, err := newGuestModule(wasmerInstance{Instance: instance}, ABIRaw)
+	require.NoError(t, err)
+	guest.fuel = 10000
+
+	err = guest.call(context.Background(), "spin", []byte(`{}`), func([]byte) error { return nil })
+	assert.ErrorIs(t, err, errFuelExhausted)
+
+	// Each invocation gets its own budget
+	for i := 0; i < 3; i++ {
+		require.NoError(t, guest.call(context.Background(), "echo", []byte(`{}`), func(output []byte) error {
+			assert.Equal(t, `{}`, string(output))
+			return nil
+		}))
+	}
+}
+
+func TestWazeroAbortsCallsAtDeadline(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(meteringTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "spin.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	impl := newTestImpl(t, &WasmRuntimeConfig{Engine: EngineConfig{Runtime: RuntimeWazero}})
+	pool, err := impl.loadWasmModel(path, ModelSampler)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = pool.call(ctx, "spin", []byte(`{}`), func([]byte) error { return nil })
+	assert.Error(t, err)
+
+	// The aborted instance is replaced
+	require.NoError(t, pool.call(context.Background(), "echo", []byte(`{}`), func(output []byte) error {
+		assert.Equal(t, `{}`, string(output))
+		return nil
+	}))
+}
+
+// memoryTestModule has a function growing its memory by 2 MB, trapping if it
+// can't, and one returning its input
+const memoryTestModule = `(module
+  (memory (export "memory") 1)
+  (func (export "alloc") (param i32) (result i32)
+    (i32.const 1024))
+  (func (export "grow") (param i32 i32) (result i64)
+    (if (i32.lt_s (memory.grow (i32.const 32)) (i32.const 0))
+      (then unreachable))
+    (i64.const 0))
+  (func (export "echo") (param $ptr i32) (param $len i32) (result i64)
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $ptr)) (i64.const 32))
+      (i64.extend_i32_u (local.get $len)))))`
+
+func TestMemoryLimits(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(memoryTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "grow.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	for _, name := range []string{RuntimeWasmer, RuntimeWazero} {
+		t.Run(name, func(t *testing.T) {
+			config := &WasmRuntimeConfig{Engine: EngineConfig{Runtime: name}, SamplerMemory: 1}
+			impl := newTestImpl(t, config)
+			impl.memoryLimits = config.memoryLimits()
+			pool, err := impl.loadWasmModel(path, ModelSampler)
+			require.NoError(t, err)
+			defer pool.Close()
+
+			// wazero fails the growth, wasmer the invocation that grew
+			err = pool.call(context.Background(), "grow", []byte(`{}`), func([]byte) error { return nil })
+			assert.Error(t, err)
+			if name == RuntimeWasmer {
+				assert.ErrorIs(t, err, errMemoryExceeded)
+			}
+
+			// The instance is usable, or replaced, within its limit
+			require.NoError(t, pool.call(context.Background(), "echo", []byte(`{}`), func(output []byte) error {
+				assert.Equal(t, `{}`, string(output))
+				return nil
+			}))
+		})
+	}
+}
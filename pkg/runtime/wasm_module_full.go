@@ -0,0 +1,81 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the WASM modules served outside the models of the
+// runtime, such as embedders. Only built when using the fullwasm build tag
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// wasmModule serves a WASM module exporting one function, invoked with the
+// raw ABI and a JSON-encoded input
+type wasmModule struct {
+	impl     *fullWasmImpl
+	pool     atomic.Pointer[guestPool]
+	name     string
+	function string
+}
+
+// NewWasmModule loads the WASM module at path as a backend invoking its
+// function. It is compiled as configured in config, and the sandbox, fuel
+// budget, memory limit and number of instances of config for name apply to
+// it.
+func NewWasmModule(logger *zap.Logger, config *WasmRuntimeConfig, name string, path string, function string) (ModelBackend, error) {
+	loader, err := newModelLoader(logger, config)
+	if err != nil {
+		return nil, err
+	}
+	m := &wasmModule{
+		impl: &fullWasmImpl{
+			logger:       logger,
+			loader:       loader,
+			abis:         config.ABIs,
+			fuel:         config.Fuel,
+			memoryLimits: config.memoryLimits(),
+			instances:    config.Instances,
+		},
+		name:     name,
+		function: function,
+	}
+	if err := m.Reload(path); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Invoke implements ModelBackend
+func (m *wasmModule) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	return m.impl.invokeModel(ctx, &m.pool, m.function, input)
+}
+
+// Reload implements ModelBackend, replacing the module once the one at path
+// is loaded
+func (m *wasmModule) Reload(path string) error {
+	pool, err := m.impl.loadWasmModel(path, m.name)
+	if err != nil {
+		return fmt.Errorf("failed to load %s module: %w", m.name, err)
+	}
+	if _, err := pool.guests[0].function(m.function); err != nil {
+		pool.Close()
+		return fmt.Errorf("invalid %s module: %w", m.name, err)
+	}
+	if old := m.pool.Swap(pool); old != nil {
+		go old.Close()
+	}
+	return nil
+}
+
+// Close implements ModelBackend
+func (m *wasmModule) Close() error {
+	if pool := m.pool.Swap(nil); pool != nil {
+		pool.Close()
+	}
+	return nil
+}
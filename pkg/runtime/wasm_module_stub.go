@@ -0,0 +1,19 @@
+//go:build !fullwasm
+// +build !fullwasm
+
+// This file contains the WASM modules served outside the models of the
+// runtime of builds without the fullwasm tag
+
+package runtime
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// NewWasmModule fails in builds without the fullwasm tag, which don't run
+// WASM modules
+func NewWasmModule(logger *zap.Logger, config *WasmRuntimeConfig, name string, path string, function string) (ModelBackend, error) {
+	return nil, errors.New("WASM modules are not supported by this build, build with the fullwasm tag")
+}
@@ -1,32 +1,44 @@
 //go:build fullwasm
 // +build fullwasm
 
-// This file contains the full WASM runtime implementation using wasmer-go
-// Only built when using the fullwasm build tag
+// This file contains the full WASM runtime implementation, which runs the
+// models in wasmer or wazero. Only built when using the fullwasm build tag
 
 package runtime
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"sync/atomic"
 
 	"go.uber.org/zap"
-	wasmer "github.com/wasmerio/wasmer-go/wasmer"
 )
 
 // fullWasmImpl is the implementation of wasmRuntimeImpl for the full WASM version
 type fullWasmImpl struct {
 	logger           *zap.Logger
-	errorClassifier  *wasmer.Instance
-	sampler          *wasmer.Instance
-	entityExtractor  *wasmer.Instance
+	
+	// Instances of the models, swapped atomically when they are reloaded
+	errorClassifier  atomic.Pointer[guestPool]
+	sampler          atomic.Pointer[guestPool]
+	entityExtractor  atomic.Pointer[guestPool]
+	
+	// Loader compiling and instantiating the models in the selected runtime
+	loader           modelLoader
+	
+	// ABI, fuel budget, memory limit in MB, number of instances and
+	// required exports of each model, keyed by model name
+	abis             map[string]string
+	fuel             map[string]uint64
+	memoryLimits     map[string]int
+	instances        map[string]int
+	exports          map[string][]string
 	
 	// Function overrides for testing
-	ClassifyErrorFunc    func(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error)
-	SampleTelemetryFunc  func(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error)
-	ExtractEntitiesFunc  func(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error)
+	ClassifyErrorFunc    func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error)
+	SampleTelemetryFunc  func(ctx context.Context, input *SampleInput) (map[string]interface{}, error)
+	ExtractEntitiesFunc  func(ctx context.Context, input *EntityInput) (map[string]interface{}, error)
 	CloseFunc            func() error
 }
 
@@ -38,38 +50,50 @@ func NewWasmRuntime(logger *zap.Logger, config *WasmRuntimeConfig) (*WasmRuntime
 		return nil, err
 	}
 
+	// All models are loaded by one runtime
+	loader, err := newModelLoader(logger, config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the full WASM implementation
 	impl := &fullWasmImpl{
-		logger: logger,
+		logger:    logger,
+		loader:    loader,
+		abis:         config.ABIs,
+		fuel:         config.Fuel,
+		memoryLimits: config.memoryLimits(),
+		instances:    config.Instances,
+		exports:      config.Exports,
 	}
 
 	// Load error classifier model if path is specified
 	if config.ErrorClassifierPath != "" {
-		instance, err := loadWasmModel(config.ErrorClassifierPath)
+		instance, err := impl.loadWasmModel(config.ErrorClassifierPath, ModelErrorClassifier)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load error classifier model: %w", err)
 		}
-		impl.errorClassifier = instance
+		impl.errorClassifier.Store(instance)
 		logger.Info("Loaded error classifier model", zap.String("path", config.ErrorClassifierPath))
 	}
 
 	// Load sampler model if path is specified
 	if config.SamplerPath != "" {
-		instance, err := loadWasmModel(config.SamplerPath)
+		instance, err := impl.loadWasmModel(config.SamplerPath, ModelSampler)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load sampler model: %w", err)
 		}
-		impl.sampler = instance
+		impl.sampler.Store(instance)
 		logger.Info("Loaded sampler model", zap.String("path", config.SamplerPath))
 	}
 
 	// Load entity extractor model if path is specified
 	if config.EntityExtractorPath != "" {
-		instance, err := loadWasmModel(config.EntityExtractorPath)
+		instance, err := impl.loadWasmModel(config.EntityExtractorPath, ModelEntityExtractor)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load entity extractor model: %w", err)
 		}
-		impl.entityExtractor = instance
+		impl.entityExtractor.Store(instance)
 		logger.Info("Loaded entity extractor model", zap.String("path", config.EntityExtractorPath))
 	}
 
@@ -80,126 +104,99 @@ func NewWasmRuntime(logger *zap.Logger, config *WasmRuntimeConfig) (*WasmRuntime
 }
 
 // ClassifyError classifies an error using the error classifier model.
-func (f *fullWasmImpl) ClassifyError(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error) {
+func (f *fullWasmImpl) ClassifyError(ctx context.Context, input *ErrorInput, encoded []byte) (map[string]interface{}, error) {
 	// If we have a testing override, use it
 	if f.ClassifyErrorFunc != nil {
-		return f.ClassifyErrorFunc(ctx, errorInfo)
+		return f.ClassifyErrorFunc(ctx, input)
 	}
 
-	if f.errorClassifier == nil {
+	if f.errorClassifier.Load() == nil {
 		return nil, fmt.Errorf("error classifier model not loaded")
 	}
 
-	// Convert input to JSON
-	input, err := json.Marshal(errorInfo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal error info: %w", err)
-	}
-
 	// Call the WASM function
-	result, err := f.invokeWasmFunction(f.errorClassifier, "classify_error", string(input))
+	classification, err := f.invokeModel(ctx, &f.errorClassifier, "classify_error", encoded)
 	if err != nil {
 		return nil, fmt.Errorf("failed to invoke error classifier: %w", err)
 	}
 
-	// Parse the result
-	var classification map[string]interface{}
-	if err := json.Unmarshal([]byte(result), &classification); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal classification result: %w", err)
-	}
-
 	return classification, nil
 }
 
 // SampleTelemetry determines whether to sample a telemetry item.
-func (f *fullWasmImpl) SampleTelemetry(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
+func (f *fullWasmImpl) SampleTelemetry(ctx context.Context, input *SampleInput, encoded []byte) (map[string]interface{}, error) {
 	// If we have a testing override, use it
 	if f.SampleTelemetryFunc != nil {
-		return f.SampleTelemetryFunc(ctx, telemetryItem)
+		return f.SampleTelemetryFunc(ctx, input)
 	}
 
-	if f.sampler == nil {
+	if f.sampler.Load() == nil {
 		return nil, fmt.Errorf("sampler model not loaded")
 	}
 
-	// Convert input to JSON
-	input, err := json.Marshal(telemetryItem)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal telemetry item: %w", err)
-	}
-
 	// Call the WASM function
-	result, err := f.invokeWasmFunction(f.sampler, "sample_telemetry", string(input))
+	samplingDecision, err := f.invokeModel(ctx, &f.sampler, "sample_telemetry", encoded)
 	if err != nil {
 		return nil, fmt.Errorf("failed to invoke sampler: %w", err)
 	}
 
-	// Parse the result
-	var samplingDecision map[string]interface{}
-	if err := json.Unmarshal([]byte(result), &samplingDecision); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal sampling decision: %w", err)
-	}
-
 	return samplingDecision, nil
 }
 
 // ExtractEntities extracts entities from a telemetry item.
-func (f *fullWasmImpl) ExtractEntities(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
+func (f *fullWasmImpl) ExtractEntities(ctx context.Context, input *EntityInput, encoded []byte) (map[string]interface{}, error) {
 	// If we have a testing override, use it
 	if f.ExtractEntitiesFunc != nil {
-		return f.ExtractEntitiesFunc(ctx, telemetryItem)
+		return f.ExtractEntitiesFunc(ctx, input)
 	}
 
-	if f.entityExtractor == nil {
+	if f.entityExtractor.Load() == nil {
 		return nil, fmt.Errorf("entity extractor model not loaded")
 	}
 
-	// Convert input to JSON
-	input, err := json.Marshal(telemetryItem)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal telemetry item: %w", err)
-	}
-
 	// Call the WASM function
-	result, err := f.invokeWasmFunction(f.entityExtractor, "extract_entities", string(input))
+	entities, err := f.invokeModel(ctx, &f.entityExtractor, "extract_entities", encoded)
 	if err != nil {
 		return nil, fmt.Errorf("failed to invoke entity extractor: %w", err)
 	}
 
-	// Parse the result
-	var entities map[string]interface{}
-	if err := json.Unmarshal([]byte(result), &entities); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal entities: %w", err)
-	}
-
 	return entities, nil
 }
 
-// ReloadModel reloads a specific model.
+// modelFunctions are the functions each model must export
+var modelFunctions = map[string]string{
+	ModelErrorClassifier: "classify_error",
+	ModelSampler:         "sample_telemetry",
+	ModelEntityExtractor: "extract_entities",
+}
+
+// ReloadModel reloads a specific model. The new module must export the
+// model's function, and replaces the old one once it is loaded; calls still
+// running on the old instances complete before they are released.
 func (f *fullWasmImpl) ReloadModel(modelType string, path string) error {
-	instance, err := loadWasmModel(path)
+	var model *atomic.Pointer[guestPool]
+	switch modelType {
+	case ModelErrorClassifier:
+		model = &f.errorClassifier
+	case ModelSampler:
+		model = &f.sampler
+	case ModelEntityExtractor:
+		model = &f.entityExtractor
+	default:
+		return fmt.Errorf("unknown model type: %s", modelType)
+	}
+
+	instance, err := f.loadWasmModel(path, modelType)
 	if err != nil {
 		return fmt.Errorf("failed to load model: %w", err)
 	}
+	if _, err := instance.guests[0].function(modelFunctions[modelType]); err != nil {
+		instance.Close()
+		return fmt.Errorf("invalid %s model: %w", modelType, err)
+	}
 
-	switch modelType {
-	case "error_classifier":
-		if f.errorClassifier != nil {
-			f.errorClassifier.Close()
-		}
-		f.errorClassifier = instance
-	case "sampler":
-		if f.sampler != nil {
-			f.sampler.Close()
-		}
-		f.sampler = instance
-	case "entity_extractor":
-		if f.entityExtractor != nil {
-			f.entityExtractor.Close()
-		}
-		f.entityExtractor = instance
-	default:
-		return fmt.Errorf("unknown model type: %s", modelType)
+	if old := model.Swap(instance); old != nil {
+		go old.Close()
 	}
 
 	f.logger.Info("Reloaded model", zap.String("type", modelType), zap.String("path", path))
@@ -213,19 +210,10 @@ func (f *fullWasmImpl) Close() error {
 		return f.CloseFunc()
 	}
 
-	if f.errorClassifier != nil {
-		f.errorClassifier.Close()
-		f.errorClassifier = nil
-	}
-
-	if f.sampler != nil {
-		f.sampler.Close()
-		f.sampler = nil
-	}
-
-	if f.entityExtractor != nil {
-		f.entityExtractor.Close()
-		f.entityExtractor = nil
+	for _, model := range []*atomic.Pointer[guestPool]{&f.errorClassifier, &f.sampler, &f.entityExtractor} {
+		if instance := model.Swap(nil); instance != nil {
+			instance.Close()
+		}
 	}
 
 	return nil
@@ -233,96 +221,170 @@ func (f *fullWasmImpl) Close() error {
 
 // Helper functions
 
-// loadWasmModel loads a WASM model from a file.
-func loadWasmModel(path string) (*wasmer.Instance, error) {
-	// Read the WASM file
-	wasmBytes, err := os.ReadFile(path)
+// modelLoader compiles and instantiates models in one of the WASM runtimes
+type modelLoader interface {
+	// load compiles a module and creates count instances of it in the
+	// sandbox of model
+	load(wasmBytes []byte, model string, count int) ([]guestInstance, error)
+}
+
+// newModelLoader creates the loader of the runtime selected by config
+func newModelLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	switch config.Engine.Runtime {
+	case "":
+		switch defaultWasmRuntime {
+		case RuntimeWazero:
+			return newWazeroLoader(logger, config)
+		case RuntimeWasmtime:
+			return newWasmtimeLoader(logger, config)
+		}
+		return newWasmerLoader(logger, config)
+	case RuntimeWasmer:
+		return newWasmerLoader(logger, config)
+	case RuntimeWazero:
+		return newWazeroLoader(logger, config)
+	case RuntimeWasmtime:
+		return newWasmtimeLoader(logger, config)
+	default:
+		return nil, fmt.Errorf("unknown WASM runtime %q", config.Engine.Runtime)
+	}
+}
+
+// loadWasmModel loads the instances of a WASM model from a file
+func (f *fullWasmImpl) loadWasmModel(path string, model string) (*guestPool, error) {
+	// Read the WASM file, decompressing it if needed
+	wasmBytes, err := readModelFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read WASM file: %w", err)
 	}
+	if f.abis[model] == ABIComponent {
+		if wasmBytes, err = componentCoreModule(wasmBytes); err != nil {
+			return nil, fmt.Errorf("failed to load WASM component: %w", err)
+		}
+	}
 
-	// Create a new WebAssembly Store
-	store := wasmer.NewStore(wasmer.NewEngine())
-
-	// Compile the WASM module
-	module, err := wasmer.NewModule(store, wasmBytes)
+	// Instances share the compiled module
+	instances, err := f.loader.load(wasmBytes, model, max(f.instances[model], 1))
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile WASM module: %w", err)
+		return nil, err
 	}
+	pool := &guestPool{}
+	for _, instance := range instances {
+		guest, err := f.newGuest(instance, model)
+		if err != nil {
+			for _, instance := range instances[len(pool.guests):] {
+				instance.Close()
+			}
+			pool.Close()
+			return nil, err
+		}
+		guest.respawn = func() (*guestModule, error) {
+			return f.instantiateGuest(wasmBytes, model)
+		}
+		pool.guests = append(pool.guests, guest)
+	}
+	for _, export := range f.exports[model] {
+		if _, err := pool.guests[0].function(export); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("missing expected export: %w", err)
+		}
+	}
+	return pool, nil
+}
 
-	// Create import object with required functions for AssemblyScript
-	importObject := wasmer.NewImportObject()
-	
-	// Create required functions for AssemblyScript
-	// The WASM module requires env.abort function
-	abortFn := wasmer.NewFunction(
-		store,
-		wasmer.NewFunctionType(
-			wasmer.NewValueTypes(wasmer.I32, wasmer.I32, wasmer.I32, wasmer.I32), 
-			wasmer.NewValueTypes(),
-		),
-		func(args []wasmer.Value) ([]wasmer.Value, error) {
-			// Log the abort information
-			msgPtr := args[0].I32()
-			filePtr := args[1].I32()
-			line := args[2].I32()
-			col := args[3].I32()
-			fmt.Printf("AssemblyScript abort called: msg=%d file=%d line=%d col=%d\n", 
-				msgPtr, filePtr, line, col)
-			return []wasmer.Value{}, nil
-		},
-	)
-	
-	// Register the required imports
-	importObject.Register(
-		"env", 
-		map[string]wasmer.IntoExtern{
-			"abort": abortFn,
-		},
-	)
-
-	// Instantiate the WASM module
-	instance, err := wasmer.NewInstance(module, importObject)
+// instantiateGuest creates a single instance of a model module
+func (f *fullWasmImpl) instantiateGuest(wasmBytes []byte, model string) (*guestModule, error) {
+	instances, err := f.loader.load(wasmBytes, model, 1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to instantiate WASM module: %w", err)
+		return nil, err
 	}
-
-	return instance, nil
+	guest, err := f.newGuest(instances[0], model)
+	if err != nil {
+		instances[0].Close()
+		return nil, err
+	}
+	return guest, nil
 }
 
-// invokeWasmFunction invokes a function in a WASM instance.
-func (f *fullWasmImpl) invokeWasmFunction(instance *wasmer.Instance, functionName, input string) (string, error) {
-	// Log that we're invoking a WASM function
-	f.logger.Debug("Invoking WASM function",
-		zap.String("function", functionName),
-		zap.String("input_sample", input[:min(len(input), 50)]+"..."),
-	)
-
-	// Get the function from the instance
-	function, err := instance.Exports.GetFunction(functionName)
+// newGuest wraps an instance of a model with its ABI and limits. Instances
+// whose initial memory already exceeds the model's limit are rejected.
+func (f *fullWasmImpl) newGuest(instance guestInstance, model string) (*guestModule, error) {
+	guest, err := newGuestModule(instance, f.abis[model])
 	if err != nil {
-		return "", fmt.Errorf("function %s not found: %w", functionName, err)
+		return nil, err
 	}
+	guest.fuel = f.fuel[model]
+	guest.memoryLimit = uint(f.memoryLimits[model]) << 20
+	if size, over := guest.memoryExceeded(); over {
+		return nil, fmt.Errorf("module starts with %d bytes of memory, above its limit of %d MB", size, f.memoryLimits[model])
+	}
+	return guest, nil
+}
 
-	// Invoke the function with the input
-	result, err := function(input)
-	if err != nil {
-		return "", fmt.Errorf("failed to invoke function %s: %w", functionName, err)
+// memoryLimits returns the memory limits in MB of the models that have one
+func (c *WasmRuntimeConfig) memoryLimits() map[string]int {
+	limits := make(map[string]int)
+	for name, limit := range map[string]int{
+		ModelErrorClassifier: c.ErrorClassifierMemory,
+		ModelSampler:         c.SamplerMemory,
+		ModelEntityExtractor: c.EntityExtractorMemory,
+	} {
+		if limit > 0 {
+			limits[name] = limit
+		}
 	}
+	return limits
+}
 
-	// Convert the result to a string
-	resultStr, ok := result.(string)
-	if !ok {
-		return "", fmt.Errorf("unexpected result type from function %s", functionName)
+// invokeModel invokes a function of the current instances of a model. Calls
+// racing with a reload retry on the new instances.
+func (f *fullWasmImpl) invokeModel(ctx context.Context, model *atomic.Pointer[guestPool], functionName string, input []byte) (map[string]interface{}, error) {
+	for {
+		pool := model.Load()
+		if pool == nil {
+			return nil, errGuestClosed
+		}
+		output, err := f.invokeWasmFunction(ctx, pool, functionName, input)
+		if !errors.Is(err, errGuestClosed) || model.Load() == pool {
+			return output, err
+		}
 	}
+}
+
+// invokeWasmFunction invokes a function in a WASM module and decodes its output.
+func (f *fullWasmImpl) invokeWasmFunction(ctx context.Context, module *guestPool, functionName string, input []byte) (map[string]interface{}, error) {
+	// Log that we're invoking a WASM function. The samples are only built
+	// when debug logging is enabled, so invocations don't allocate for them.
+	if ce := f.logger.Check(zap.DebugLevel, "Invoking WASM function"); ce != nil {
+		ce.Write(
+			zap.String("function", functionName),
+			zap.ByteString("input_sample", input[:min(len(input), 50)]),
+		)
+	}
+
+	// Invoke the function with the input in guest memory
+	var output map[string]interface{}
+	err := module.call(ctx, functionName, input, func(result []byte) error {
+		// Log the result
+		if ce := f.logger.Check(zap.DebugLevel, "WASM function returned result"); ce != nil {
+			ce.Write(
+				zap.String("function", functionName),
+				zap.ByteString("result_sample", result[:min(len(result), 50)]),
+			)
+		}
 
-	// Log the result
-	f.logger.Debug("WASM function returned result",
-		zap.String("function", functionName),
-		zap.String("result_sample", resultStr[:min(len(resultStr), 50)]+"..."),
-	)
+		var err error
+		output, err = decodeOutput(result)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal result: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	return resultStr, nil
+	return output, nil
 }
 
 // Helper function to get minimum of two integers
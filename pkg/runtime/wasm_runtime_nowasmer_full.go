@@ -0,0 +1,26 @@
+//go:build fullwasm && wazero
+// +build fullwasm,wazero
+
+// This file replaces the wasmer and wasmtime runtimes in builds with the
+// wazero tag, which run the models in wazero only and build without cgo
+
+package runtime
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// defaultWasmRuntime is the runtime used unless the configuration selects one
+const defaultWasmRuntime = RuntimeWazero
+
+// newWasmerLoader fails, since wasmer is not part of the build
+func newWasmerLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	return nil, errors.New("the wasmer runtime is not part of this build, which was built with the wazero tag")
+}
+
+// newWasmtimeLoader fails, since wasmtime is not part of the build
+func newWasmtimeLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	return nil, errors.New("the wasmtime runtime is not part of this build, which was built with the wazero tag")
+}
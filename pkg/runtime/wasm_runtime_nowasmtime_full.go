@@ -0,0 +1,18 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+// This file leaves the wasmtime runtime out of builds without the wasmtime
+// tag, which run the models in wasmer and wazero
+
+package runtime
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// newWasmtimeLoader fails, since wasmtime is not part of the build
+func newWasmtimeLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	return nil, errors.New("the wasmtime runtime is not part of this build, which was built without the wasmtime tag")
+}
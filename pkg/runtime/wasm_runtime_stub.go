@@ -55,77 +55,33 @@ func NewWasmRuntime(logger *zap.Logger, config *WasmRuntimeConfig) (*WasmRuntime
 
 // ClassifyError classifies an error using the error classifier model.
 // In the stub version, it returns a default classification
-func (s *stubImpl) ClassifyError(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error) {
-	s.logger.Info("Stub ClassifyError called", zap.Any("errorInfo", errorInfo))
+func (s *stubImpl) ClassifyError(ctx context.Context, input *ErrorInput, encoded []byte) (map[string]interface{}, error) {
+	s.logger.Info("Stub ClassifyError called", zap.ByteString("input", encoded))
 	
 	// Return stub classification
-	classification := map[string]interface{}{
-		"error_type": "unknown",
-		"error_cause": "system",
-		"severity": "medium", 
-		"confidence": 0.95,
-		"owner": "platform-team",
-	}
+	classification := heuristicClassifyError()
 	
 	return classification, nil
 }
 
 // SampleTelemetry determines whether to sample a telemetry item.
 // In the stub version, it returns a default sampling decision
-func (s *stubImpl) SampleTelemetry(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
-	s.logger.Info("Stub SampleTelemetry called", zap.Any("telemetryItem", telemetryItem))
+func (s *stubImpl) SampleTelemetry(ctx context.Context, input *SampleInput, encoded []byte) (map[string]interface{}, error) {
+	s.logger.Info("Stub SampleTelemetry called", zap.ByteString("input", encoded))
 	
-	// Extract some info from the telemetry item to make the stub more realistic
-	name, _ := telemetryItem["name"].(string)
-	hasError := false
-	if status, ok := telemetryItem["status"].(string); ok {
-		hasError = status == "error"
-	}
-	
-	// Determine importance based on name and error status
-	importance := 0.5 // default medium importance
-	if hasError {
-		importance = 0.9 // high importance for errors
-	}
-	if name != "" && (len(name) > 3 && (name[:3] == "db." || name[:3] == "sql")) {
-		importance = 0.8 // higher importance for database operations
-	}
-
-	// Return stub sampling decision
-	result := map[string]interface{}{
-		"importance": importance,
-		"keep": importance > 0.3,
-		"confidence": 0.9,
-	}
+	// Return a stub sampling decision based on the name and error status
+	result := heuristicSample(input.Name, input.Status)
 	
 	return result, nil
 }
 
 // ExtractEntities extracts entities from a telemetry item.
 // In the stub version, it returns default entities based on telemetry attributes
-func (s *stubImpl) ExtractEntities(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
-	s.logger.Info("Stub ExtractEntities called", zap.Any("telemetryItem", telemetryItem))
-	
-	// Extract some info to make stub more realistic
-	name, _ := telemetryItem["name"].(string)
+func (s *stubImpl) ExtractEntities(ctx context.Context, input *EntityInput, encoded []byte) (map[string]interface{}, error) {
+	s.logger.Info("Stub ExtractEntities called", zap.ByteString("input", encoded))
 	
-	// Default entities
-	entities := map[string]interface{}{
-		"service": "unknown-service",
-		"operation_type": "unknown",
-		"confidence": 0.8,
-	}
-	
-	// Try to extract more specific entities from the name
-	if name != "" {
-		if len(name) > 3 && name[:3] == "db." {
-			entities["service"] = "database"
-			entities["operation_type"] = "data-access"
-		} else if len(name) > 4 && name[:4] == "http" {
-			entities["service"] = "web-api"
-			entities["operation_type"] = "http-request"
-		}
-	}
+	// Return stub entities based on the name
+	entities := heuristicExtractEntities(input.Name)
 	
 	return entities, nil
 }
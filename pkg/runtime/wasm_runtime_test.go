@@ -2,9 +2,16 @@ package runtime
 
 import (
 	"context"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -49,15 +56,15 @@ func TestClassifyError(t *testing.T) {
 	runtime := createMockRuntimeWithOverrides(t)
 	
 	// Test input
-	errorInfo := map[string]interface{}{
-		"name":       "ExecuteQuery",
-		"status":     "Connection refused to database",
-		"kind":       "CLIENT",
-		"attributes": map[string]interface{}{
+	errorInfo := &ErrorInput{
+		Name:   "ExecuteQuery",
+		Status: "Connection refused to database",
+		Kind:   "CLIENT",
+		Attributes: map[string]interface{}{
 			"db.system": "postgresql",
 			"db.name":   "users",
 		},
-		"resource": map[string]interface{}{
+		Resource: map[string]interface{}{
 			"service.name": "user-service",
 		},
 	}
@@ -79,16 +86,16 @@ func TestSampleTelemetry(t *testing.T) {
 	runtime := createMockRuntimeWithOverrides(t)
 	
 	// Test input
-	telemetryInfo := map[string]interface{}{
-		"name":       "ProcessPayment",
-		"status":     "OK",
-		"kind":       "CLIENT",
-		"duration":   150,
-		"attributes": map[string]interface{}{
+	telemetryInfo := &SampleInput{
+		Name:     "ProcessPayment",
+		Status:   "OK",
+		Kind:     "CLIENT",
+		Duration: 150,
+		Attributes: map[string]interface{}{
 			"http.method": "POST",
 			"http.url":    "/api/payments",
 		},
-		"resource": map[string]interface{}{
+		Resource: map[string]interface{}{
 			"service.name": "payment-service",
 		},
 	}
@@ -110,15 +117,14 @@ func TestExtractEntities(t *testing.T) {
 	runtime := createMockRuntimeWithOverrides(t)
 	
 	// Test input
-	telemetryInfo := map[string]interface{}{
-		"name":        "HandleUserRequest",
-		"description": "Process user API request",
-		"type":        "span",
-		"attributes":  map[string]interface{}{
+	telemetryInfo := &EntityInput{
+		Name:        "HandleUserRequest",
+		Description: "Process user API request",
+		Attributes: map[string]interface{}{
 			"http.method": "POST",
 			"http.url":    "/api/users",
 		},
-		"resource": map[string]interface{}{
+		Resource: map[string]interface{}{
 			"service.name": "user-service",
 		},
 	}
@@ -186,7 +192,7 @@ func createMockRuntimeWithOverrides(t *testing.T) *WasmRuntime {
 	
 	// Create a mock implementation
 	mockImpl := &mockImplementation{
-		ClassifyErrorMock: func(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error) {
+		ClassifyErrorMock: func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error) {
 			return map[string]interface{}{
 				"category":   "database_error",
 				"system":     "postgres",
@@ -196,14 +202,14 @@ func createMockRuntimeWithOverrides(t *testing.T) *WasmRuntime {
 				"confidence": 0.85,
 			}, nil
 		},
-		SampleTelemetryMock: func(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
+		SampleTelemetryMock: func(ctx context.Context, input *SampleInput) (map[string]interface{}, error) {
 			return map[string]interface{}{
 				"importance": 0.75,
 				"keep":       true,
 				"reason":     "high_importance_score",
 			}, nil
 		},
-		ExtractEntitiesMock: func(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
+		ExtractEntitiesMock: func(ctx context.Context, input *EntityInput) (map[string]interface{}, error) {
 			return map[string]interface{}{
 				"services":     []interface{}{"user-service", "api-gateway"},
 				"dependencies": []interface{}{"postgres", "redis"},
@@ -227,23 +233,23 @@ func createMockRuntimeWithOverrides(t *testing.T) *WasmRuntime {
 
 // Mock implementation of wasmRuntimeImpl for testing
 type mockImplementation struct {
-	ClassifyErrorMock    func(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error)
-	SampleTelemetryMock  func(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error)
-	ExtractEntitiesMock  func(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error)
+	ClassifyErrorMock    func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error)
+	SampleTelemetryMock  func(ctx context.Context, input *SampleInput) (map[string]interface{}, error)
+	ExtractEntitiesMock  func(ctx context.Context, input *EntityInput) (map[string]interface{}, error)
 	ReloadModelMock      func(modelType string, path string) error
 	CloseMock            func() error
 }
 
-func (m *mockImplementation) ClassifyError(ctx context.Context, errorInfo map[string]interface{}) (map[string]interface{}, error) {
-	return m.ClassifyErrorMock(ctx, errorInfo)
+func (m *mockImplementation) ClassifyError(ctx context.Context, input *ErrorInput, encoded []byte) (map[string]interface{}, error) {
+	return m.ClassifyErrorMock(ctx, input)
 }
 
-func (m *mockImplementation) SampleTelemetry(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
-	return m.SampleTelemetryMock(ctx, telemetryItem)
+func (m *mockImplementation) SampleTelemetry(ctx context.Context, input *SampleInput, encoded []byte) (map[string]interface{}, error) {
+	return m.SampleTelemetryMock(ctx, input)
 }
 
-func (m *mockImplementation) ExtractEntities(ctx context.Context, telemetryItem map[string]interface{}) (map[string]interface{}, error) {
-	return m.ExtractEntitiesMock(ctx, telemetryItem)
+func (m *mockImplementation) ExtractEntities(ctx context.Context, input *EntityInput, encoded []byte) (map[string]interface{}, error) {
+	return m.ExtractEntitiesMock(ctx, input)
 }
 
 func (m *mockImplementation) ReloadModel(modelType string, path string) error {
@@ -252,4 +258,697 @@ func (m *mockImplementation) ReloadModel(modelType string, path string) error {
 
 func (m *mockImplementation) Close() error {
 	return m.CloseMock()
-}
\ No newline at end of file
+}
+
+type denyQuota struct{ tenants []string }
+
+func (q *denyQuota) Allow(tenant string) bool {
+	q.tenants = append(q.tenants, tenant)
+	return false
+}
+
+// TestUnknownABIRejected tests that models can only select known ABIs
+func TestUnknownABIRejected(t *testing.T) {
+	_, err := NewWasmRuntime(zap.NewNop(), &WasmRuntimeConfig{ABIs: map[string]string{ModelSampler: "emscripten"}})
+	assert.ErrorContains(t, err, `unknown ABI "emscripten" for model sampler`)
+}
+
+// TestQuotaFallsBackToHeuristics tests that exhausted quotas return heuristic results
+func TestQuotaFallsBackToHeuristics(t *testing.T) {
+	runtime, err := NewWasmRuntime(zap.NewNop(), &WasmRuntimeConfig{EnableModelCaching: true, ModelCacheSize: 10})
+	assert.NoError(t, err)
+	quota := &denyQuota{}
+	runtime.SetQuota(quota)
+
+	ctx := WithTenant(context.Background(), "acme")
+	result, err := runtime.ExtractEntities(ctx, &EntityInput{Name: "db.query"})
+	assert.NoError(t, err)
+	assert.Equal(t, "database", result["service"])
+	assert.Equal(t, []string{"acme"}, quota.tenants)
+
+	// Heuristic results are not cached, so the quota is consulted again
+	_, err = runtime.ExtractEntities(ctx, &EntityInput{Name: "db.query"})
+	assert.NoError(t, err)
+	assert.Len(t, quota.tenants, 2)
+}
+
+// TestCachePartitionedByTenant tests that cached results are not shared between tenants
+func TestCachePartitionedByTenant(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	calls := 0
+	runtime.impl.(*mockImplementation).SampleTelemetryMock = func(ctx context.Context, input *SampleInput) (map[string]interface{}, error) {
+		calls++
+		return map[string]interface{}{"importance": 0.5, "tenant": TenantFromContext(ctx)}, nil
+	}
+
+	item := &SampleInput{Name: "GET /users"}
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	result, err := runtime.SampleTelemetry(acme, item)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", result["tenant"])
+
+	// The same input from another tenant is not served from acme's entries
+	result, err = runtime.SampleTelemetry(globex, item)
+	assert.NoError(t, err)
+	assert.Equal(t, "globex", result["tenant"])
+	assert.Equal(t, 2, calls)
+
+	_, err = runtime.SampleTelemetry(acme, item)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	stats := runtime.samplerCache.GetStats()
+	tenants := stats["tenants"].(map[string]interface{})
+	assert.Equal(t, int64(1), tenants["acme"].(map[string]interface{})["hit_count"])
+	assert.Equal(t, 1, tenants["globex"].(map[string]interface{})["size"])
+
+	// Clearing a tenant leaves the other tenants' results cached
+	runtime.ClearCache("acme")
+	_, err = runtime.SampleTelemetry(acme, item)
+	assert.NoError(t, err)
+	_, err = runtime.SampleTelemetry(globex, item)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+// TestCacheKeySharesResultsOfSimilarInputs tests that inputs differing
+// only in fields outside the cache key share a cached result
+func TestCacheKeySharesResultsOfSimilarInputs(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	runtime.cacheKeys = map[string]*CacheKey{ModelErrorClassifier: {
+		Fields:    []string{"name", "attributes.db.system"},
+		Templates: []string{"status"},
+	}}
+	calls := 0
+	runtime.impl.(*mockImplementation).ClassifyErrorMock = func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error) {
+		calls++
+		return map[string]interface{}{"error_type": "database"}, nil
+	}
+
+	for _, input := range []*ErrorInput{
+		{Name: "query", Status: "timeout after 30s on conn 12", Attributes: map[string]interface{}{"db.system": "postgresql", "request.id": "a1"}},
+		{Name: "query", Status: "timeout after 45s on conn 7", Attributes: map[string]interface{}{"db.system": "postgresql", "request.id": "b2"}},
+	} {
+		result, err := runtime.ClassifyError(context.Background(), input)
+		assert.NoError(t, err)
+		assert.Equal(t, "database", result["error_type"])
+	}
+	assert.Equal(t, 1, calls)
+
+	// Inputs differing in the key's fields don't
+	_, err := runtime.ClassifyError(context.Background(), &ErrorInput{
+		Name: "query", Status: "timeout after 30s on conn 12", Attributes: map[string]interface{}{"db.system": "mysql"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+// TestCacheConcurrentAccess tests that workers share the cache safely
+func TestCacheConcurrentAccess(t *testing.T) {
+	cache, err := NewModelResultsCache(64, 4, 60)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			tenant := fmt.Sprintf("tenant-%d", worker%2)
+			for i := 0; i < 200; i++ {
+				input := []byte(fmt.Sprintf(`{"name":"op-%d"}`, i%32))
+				if _, found := cache.Get(tenant, input); !found {
+					assert.NoError(t, cache.Put(tenant, input, map[string]interface{}{"keep": true}))
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	stats := cache.GetStats()
+	assert.Equal(t, int64(8*200), stats["hit_count"].(int64)+stats["miss_count"].(int64))
+	assert.Len(t, stats["tenants"], 2)
+	assert.LessOrEqual(t, stats["size"], 2*64)
+}
+
+// TestCacheSharesConcurrentMisses tests that concurrent misses for the same
+// input invoke the model once
+func TestCacheSharesConcurrentMisses(t *testing.T) {
+	cache, err := NewModelResultsCache(64, 4, 60)
+	assert.NoError(t, err)
+
+	input := []byte(`{"name":"GET /checkout"}`)
+	release := make(chan struct{})
+	var invocations atomic.Int32
+	invoke := func() (map[string]interface{}, error) {
+		invocations.Add(1)
+		<-release
+		result := map[string]interface{}{"importance": 0.9}
+		return result, cache.Put("acme", input, result)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cache.Do(context.Background(), "acme", input, invoke)
+			assert.NoError(t, err)
+			assert.Equal(t, 0.9, result["importance"])
+		}()
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), invocations.Load())
+
+	// Another tenant's input is invoked separately
+	_, err = cache.Do(context.Background(), "globex", input, func() (map[string]interface{}, error) {
+		invocations.Add(1)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), invocations.Load())
+}
+
+// TestEncodeInputMatchesEncodingJSON tests that inputs encode as encoding/json
+// encodes their struct tags
+func TestEncodeInputMatchesEncodingJSON(t *testing.T) {
+	monotonic := true
+	inputs := []ModelInput{
+		&ErrorInput{Name: "ExecuteQuery", Status: "timeout <db>", Attributes: map[string]interface{}{
+			"db.system": "postgresql", "retry": int64(3), "ratio": 0.25, "cached": false}},
+		&ErrorInput{Name: "charge", Events: []SpanEvent{{Name: "retry"}, {Name: "exception", Attributes: map[string]interface{}{
+			"exception.type": "TimeoutError", "exception.stacktrace": "at charge (pay.js:12)"}}}},
+		&SampleInput{Name: "GET /", Duration: 12, Resource: map[string]interface{}{"service.name": "web"}},
+		&SampleInput{Name: "checkout", Duration: 840, Spans: 12, Errors: 1},
+		&EntityInput{Name: "requests", IsMonotonic: &monotonic, Value: int64(0), Attributes: map[string]interface{}{
+			"nested": map[string]interface{}{"b": 1, "a": []interface{}{"x"}}}},
+	}
+
+	for _, input := range inputs {
+		stream, err := encodeInput(input, nil)
+		assert.NoError(t, err)
+		encoded := append([]byte(nil), stream.Buffer()...)
+		releaseInput(stream)
+
+		var got, want interface{}
+		expected, err := stdjson.Marshal(input)
+		assert.NoError(t, err)
+		assert.NoError(t, stdjson.Unmarshal(encoded, &got))
+		assert.NoError(t, stdjson.Unmarshal(expected, &want))
+		assert.Equal(t, want, got)
+
+		// Equal inputs encode to equal bytes for the cache
+		again, _ := encodeInput(input, nil)
+		assert.Equal(t, encoded, again.Buffer())
+		releaseInput(again)
+	}
+}
+
+// TestEncodeInputAppliesLimits tests that inputs are projected and bounded
+// before they are passed to models
+func TestEncodeInputAppliesLimits(t *testing.T) {
+	input := &ErrorInput{Name: "ExecuteQuery", Status: "timeout", Kind: "Client", Attributes: map[string]interface{}{
+		"a": 1, "b": 2, "c": 3, "db.system": "postgresql"}}
+	encode := func(limits *InputLimits) map[string]interface{} {
+		stream, err := encodeInput(input, limits)
+		assert.NoError(t, err)
+		defer releaseInput(stream)
+		var got map[string]interface{}
+		assert.NoError(t, stdjson.Unmarshal(stream.Buffer(), &got))
+		return got
+	}
+
+	// Projected fields and priority attributes
+	got := encode(&InputLimits{Fields: []string{"name", "attributes"}, MaxAttributes: 2, PriorityAttributes: []string{"db.system"}})
+	assert.Equal(t, map[string]interface{}{"name": "ExecuteQuery",
+		"attributes": map[string]interface{}{"a": float64(1), "db.system": "postgresql"}}, got)
+
+	// Attributes are dropped from inputs that are too large
+	got = encode(&InputLimits{MaxInputBytes: 90})
+	assert.Equal(t, map[string]interface{}{"name": "ExecuteQuery", "status": "timeout", "kind": "Client",
+		"attributes": map[string]interface{}{}, "resource": nil}, got)
+
+	// Inputs still too large get the heuristic
+	_, err := encodeInput(input, &InputLimits{MaxInputBytes: 10})
+	assert.ErrorIs(t, err, errInputTooLarge)
+	runtime, err := NewWasmRuntime(zap.NewNop(), &WasmRuntimeConfig{
+		InputLimits: map[string]InputLimits{ModelErrorClassifier: {MaxInputBytes: 10}}})
+	assert.NoError(t, err)
+	result, err := runtime.ClassifyError(context.Background(), input)
+	assert.NoError(t, err)
+	assert.Equal(t, heuristic(ModelErrorClassifier, input), result)
+}
+
+// TestEncodeInputBoundsSpanEvents tests that exception events are kept
+// first and their stack traces truncated
+func TestEncodeInputBoundsSpanEvents(t *testing.T) {
+	input := &ErrorInput{Name: "charge", Events: []SpanEvent{
+		{Name: "retry", Attributes: map[string]interface{}{"attempt": int64(1)}},
+		{Name: "cache.miss"},
+		{Name: "exception", Attributes: map[string]interface{}{
+			"exception.type":       "TimeoutError",
+			"exception.stacktrace": "TimeoutError: upstream\n    at charge (pay.js:12)",
+		}},
+	}}
+
+	stream, err := encodeInput(input, &InputLimits{MaxEvents: 2, MaxStacktraceLength: 22})
+	require.NoError(t, err)
+	defer releaseInput(stream)
+	var got map[string]interface{}
+	require.NoError(t, stdjson.Unmarshal(stream.Buffer(), &got))
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "retry", "attributes": map[string]interface{}{"attempt": float64(1)}},
+		map[string]interface{}{"name": "exception", "attributes": map[string]interface{}{
+			"exception.type":       "TimeoutError",
+			"exception.stacktrace": "TimeoutError: upstream",
+		}},
+	}, got["events"])
+
+	// Stack traces are not cut inside a character
+	limits := &InputLimits{MaxStacktraceLength: 2}
+	assert.Equal(t, "a", limits.truncateStacktrace("aé"))
+}
+
+// BenchmarkEncodeInput compares encoding a typed input with the pooled
+// encoder against encoding the equivalent map with encoding/json
+func BenchmarkEncodeInput(b *testing.B) {
+	attributes := map[string]interface{}{"http.method": "GET", "http.route": "/users/{id}", "http.status_code": int64(200)}
+	resource := map[string]interface{}{"service.name": "user-service", "deployment.environment": "production"}
+
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			input := &SampleInput{Name: "GET /users/{id}", Kind: "Server", Status: "Ok", Duration: 42,
+				Attributes: attributes, Resource: resource}
+			stream, err := encodeInput(input, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			releaseInput(stream)
+		}
+	})
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			input := map[string]interface{}{"name": "GET /users/{id}", "kind": "Server", "status": "Ok", "duration": int64(42),
+				"attributes": attributes, "resource": resource}
+			if _, err := stdjson.Marshal(input); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestInferenceThreadsBoundInvocations tests that invocations wait for one
+// of the dedicated threads
+func TestInferenceThreadsBoundInvocations(t *testing.T) {
+	threads := newInferenceThreads(2)
+	defer threads.Close()
+
+	// Two invocations hold both threads
+	release := make(chan struct{})
+	var running atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, threads.do(context.Background(), func() {
+				running.Add(1)
+				<-release
+			}))
+		}()
+	}
+	for running.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A third waits for a thread until its context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	assert.ErrorIs(t, threads.do(ctx, func() { ran = true }), context.DeadlineExceeded)
+	assert.False(t, ran)
+
+	close(release)
+	wg.Wait()
+	assert.NoError(t, threads.do(context.Background(), func() { ran = true }))
+	assert.True(t, ran)
+
+	threads.Close()
+	assert.ErrorIs(t, threads.do(context.Background(), func() {}), errRuntimeClosed)
+}
+
+// TestConcurrentInvocationsBounded tests that model invocations beyond the
+// limit wait for a slot, whatever the model
+func TestConcurrentInvocationsBounded(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	runtime.invocations = make(chan struct{}, 2)
+	release := make(chan struct{})
+	var running atomic.Int32
+	mock := runtime.impl.(*mockImplementation)
+	mock.ClassifyErrorMock = func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error) {
+		running.Add(1)
+		<-release
+		return map[string]interface{}{"error_type": "timeout"}, nil
+	}
+	mock.SampleTelemetryMock = func(ctx context.Context, input *SampleInput) (map[string]interface{}, error) {
+		running.Add(1)
+		return map[string]interface{}{"importance": 0.5}, nil
+	}
+
+	// Two invocations hold both slots
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: fmt.Sprintf("query %d", i)})
+			assert.NoError(t, err)
+		}(i)
+	}
+	for running.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	inFlight, limit := runtime.InvocationsInFlight()
+	assert.Equal(t, 2, inFlight)
+	assert.Equal(t, 2, limit)
+
+	// Another model's invocation waits until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := runtime.SampleTelemetry(ctx, &SampleInput{Name: "GET /"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(2), running.Load())
+
+	close(release)
+	wg.Wait()
+	_, err = runtime.SampleTelemetry(context.Background(), &SampleInput{Name: "GET /"})
+	assert.NoError(t, err)
+	inFlight, _ = runtime.InvocationsInFlight()
+	assert.Equal(t, 0, inFlight)
+}
+
+// TestOutputRulesNormalizeResults tests that model outputs are post-processed
+// before they are returned and cached
+func TestOutputRulesNormalizeResults(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	rules, err := newOutputRules(&OutputRules{
+		Rename: map[string]string{"type": "category"},
+		Keys:   []string{"category", "confidence", "importance"},
+		Categories: map[string]Categories{
+			"category": {Values: []string{"database", "network"}, Aliases: map[string]string{"db": "database"}, Default: "other"},
+		},
+		Ranges:    map[string]Range{"importance": {Min: 0, Max: 1}},
+		Precision: map[string]int{"confidence": 2},
+	})
+	assert.NoError(t, err)
+	runtime.outputs = map[string]*outputRules{ModelErrorClassifier: rules}
+
+	output := map[string]interface{}{"type": " DB ", "confidence": 0.91234, "importance": 3, "debug": "trace"}
+	runtime.impl.(*mockImplementation).ClassifyErrorMock = func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error) {
+		return output, nil
+	}
+
+	result, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "query"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"category": "database", "confidence": 0.91, "importance": 1.0}, result)
+	assert.Equal(t, " DB ", output["type"])
+
+	// Unknown categories get the default, non-numeric values are dropped
+	output = map[string]interface{}{"category": "disk", "confidence": "high"}
+	result, err = runtime.ClassifyError(context.Background(), &ErrorInput{Name: "write"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"category": "other"}, result)
+
+	_, err = newOutputRules(&OutputRules{Categories: map[string]Categories{"category": {Values: []string{"database"}, Aliases: map[string]string{"net": "network"}}}})
+	assert.ErrorContains(t, err, `alias "net" of category is not one of its values`)
+}
+
+type failingBackend struct{ calls atomic.Int32 }
+
+func (b *failingBackend) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	b.calls.Add(1)
+	return nil, fmt.Errorf("connection refused")
+}
+
+func (b *failingBackend) Reload(path string) error { return nil }
+
+func (b *failingBackend) Close() error { return nil }
+
+// TestBackendFallsBackToWasm tests that models falling back to WASM invoke
+// their WASM module when their backend fails or is blocked
+func TestBackendFallsBackToWasm(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	runtime.errorClassifierCache = nil
+	backend := &failingBackend{}
+	runtime.SetBackend(ModelErrorClassifier, BackendRemote, backend)
+
+	_, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "query"})
+	assert.ErrorContains(t, err, "connection refused")
+
+	runtime.SetFallback(ModelErrorClassifier)
+	result, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "query"})
+	assert.NoError(t, err)
+	assert.Equal(t, "database_error", result["category"])
+	assert.Equal(t, int32(2), backend.calls.Load())
+
+	// Blocked backends are skipped, unless WASM is blocked too
+	ctx := WithBlockedBackends(context.Background(), []string{BackendRemote})
+	_, err = runtime.ClassifyError(ctx, &ErrorInput{Name: "query"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), backend.calls.Load())
+
+	ctx = WithBlockedBackends(context.Background(), []string{BackendRemote, BackendWasm})
+	_, err = runtime.ClassifyError(ctx, &ErrorInput{Name: "query"})
+	assert.ErrorIs(t, err, ErrBackendBlocked)
+}
+
+// TestModelTimeoutFailsSlowInvocations tests that invocations exceeding their
+// model's timeout fail fast and are counted
+func TestModelTimeoutFailsSlowInvocations(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	runtime.errorClassifierCache = nil
+	runtime.timeouts = map[string]time.Duration{ModelErrorClassifier: 20 * time.Millisecond}
+	runtime.timeoutCounts = map[string]*atomic.Int64{ModelErrorClassifier: new(atomic.Int64)}
+
+	release := make(chan struct{})
+	defer close(release)
+	runtime.impl.(*mockImplementation).ClassifyErrorMock = func(ctx context.Context, input *ErrorInput) (map[string]interface{}, error) {
+		if input.Name == "slow" {
+			<-release
+		}
+		return map[string]interface{}{"category": "database_error"}, nil
+	}
+
+	result, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "fast"})
+	assert.NoError(t, err)
+	assert.Equal(t, "database_error", result["category"])
+
+	start := time.Now()
+	_, err = runtime.ClassifyError(context.Background(), &ErrorInput{Name: "slow"})
+	assert.ErrorIs(t, err, ErrModelTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, map[string]int64{ModelErrorClassifier: 1}, runtime.Timeouts())
+	assert.Equal(t, int64(1), runtime.Stats()[ModelErrorClassifier].(map[string]interface{})["timeouts"])
+
+	// Invocations cancelled by the caller are not timeouts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = runtime.ClassifyError(ctx, &ErrorInput{Name: "slow"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(1), runtime.Timeouts()[ModelErrorClassifier])
+}
+
+// observedInvocations collects the invocations reported to an observer
+type observedInvocations struct {
+	mutex  sync.Mutex
+	models []string
+	errors []error
+}
+
+func (o *observedInvocations) ObserveInvocation(ctx context.Context, model string, duration time.Duration, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.models = append(o.models, model)
+	o.errors = append(o.errors, err)
+}
+
+// TestObserverSeesInvocationsNotServedFromCache tests that observers are
+// notified of model invocations, but not of cached results
+func TestObserverSeesInvocationsNotServedFromCache(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	observer := &observedInvocations{}
+	runtime.SetObserver(observer)
+
+	for i := 0; i < 2; i++ {
+		_, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "query"})
+		assert.NoError(t, err)
+	}
+	ctx := WithBlockedBackends(context.Background(), []string{BackendWasm})
+	_, err := runtime.SampleTelemetry(ctx, &SampleInput{Name: "GET /"})
+	assert.ErrorIs(t, err, ErrBackendBlocked)
+
+	assert.Equal(t, []string{ModelErrorClassifier, ModelSampler}, observer.models)
+	assert.NoError(t, observer.errors[0])
+	assert.ErrorIs(t, observer.errors[1], ErrBackendBlocked)
+	assert.Equal(t, CacheCounters{Hits: 1, Misses: 1}, runtime.CacheCounters()[ModelErrorClassifier])
+}
+
+// prefilterFunc adapts a function to a ModelPrefilter
+type prefilterFunc func(input []byte) (map[string]interface{}, bool)
+
+func (f prefilterFunc) Match(input []byte) (map[string]interface{}, bool) { return f(input) }
+
+// TestPrefilterAnswersMatchingInputs tests that prefilters answer the inputs
+// they match without invoking the model or its backend
+func TestPrefilterAnswersMatchingInputs(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	backend := &failingBackend{}
+	runtime.SetBackend(ModelErrorClassifier, BackendRemote, backend)
+	runtime.SetPrefilter(ModelErrorClassifier, prefilterFunc(func(input []byte) (map[string]interface{}, bool) {
+		var decoded map[string]interface{}
+		stdjson.Unmarshal(input, &decoded)
+		if decoded["name"] != "db.query" {
+			return nil, false
+		}
+		return map[string]interface{}{"category": "database_timeout"}, true
+	}))
+
+	for i := 0; i < 2; i++ {
+		result, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "db.query"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"category": "database_timeout"}, result)
+	}
+	assert.Equal(t, int32(0), backend.calls.Load())
+
+	_, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: "GET /"})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, int32(1), backend.calls.Load())
+}
+
+// flakyBackend fails while failing is set
+type flakyBackend struct {
+	calls   atomic.Int32
+	failing atomic.Bool
+}
+
+func (b *flakyBackend) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	b.calls.Add(1)
+	if b.failing.Load() {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return map[string]interface{}{"category": "database_error"}, nil
+}
+
+func (b *flakyBackend) Reload(path string) error { return nil }
+
+func (b *flakyBackend) Close() error { return nil }
+
+func TestCircuitBreakerFallsBackWhileOpen(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	runtime.errorClassifierCache = nil
+	backend := &flakyBackend{}
+	backend.failing.Store(true)
+	runtime.SetBackend(ModelErrorClassifier, BackendRemote, backend)
+	breaker, err := newCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 3,
+		CoolDown:         20 * time.Millisecond,
+		Fallback:         CircuitFallbackPassThrough,
+	})
+	assert.NoError(t, err)
+	runtime.breakers = map[string]*circuitBreaker{ModelErrorClassifier: breaker}
+
+	classify := func() (map[string]interface{}, error) {
+		return runtime.ClassifyError(context.Background(), &ErrorInput{Name: "db.query"})
+	}
+
+	// Consecutive failures open the circuit, which then passes items through
+	for i := 0; i < 3; i++ {
+		_, err := classify()
+		assert.Error(t, err)
+	}
+	assert.Equal(t, map[string]string{ModelErrorClassifier: CircuitOpen}, runtime.Circuits())
+	result, err := classify()
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+	assert.Equal(t, int32(3), backend.calls.Load())
+
+	// A failed probe after the cool-down opens it again
+	time.Sleep(25 * time.Millisecond)
+	_, err = classify()
+	assert.Error(t, err)
+	assert.Equal(t, CircuitOpen, runtime.Circuits()[ModelErrorClassifier])
+
+	// A successful probe closes it
+	backend.failing.Store(false)
+	time.Sleep(25 * time.Millisecond)
+	result, err = classify()
+	assert.NoError(t, err)
+	assert.Equal(t, "database_error", result["category"])
+	assert.Equal(t, CircuitClosed, runtime.Circuits()[ModelErrorClassifier])
+	assert.Equal(t, int32(5), backend.calls.Load())
+}
+
+func TestNegativeCacheBacksOffFailingInputs(t *testing.T) {
+	runtime := createMockRuntimeWithOverrides(t)
+	runtime.errorClassifierCache = nil
+	backend := &flakyBackend{}
+	backend.failing.Store(true)
+	runtime.SetBackend(ModelErrorClassifier, BackendRemote, backend)
+	negative, err := newNegativeCache(NegativeCacheConfig{
+		MaxEntries:     10,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	})
+	assert.NoError(t, err)
+	runtime.negatives = map[string]*negativeCache{ModelErrorClassifier: negative}
+
+	classify := func(name string) error {
+		_, err := runtime.ClassifyError(context.Background(), &ErrorInput{Name: name})
+		return err
+	}
+
+	// A failed input fails again without invoking the model, others don't
+	assert.Error(t, classify("db.query"))
+	assert.ErrorIs(t, classify("db.query"), ErrKnownFailure)
+	assert.Error(t, classify("http.get"))
+	assert.Equal(t, int32(2), backend.calls.Load())
+	assert.Equal(t, map[string]int64{ModelErrorClassifier: 1}, runtime.NegativeCacheHits())
+
+	// The input is retried once its backoff expires and forgotten on success
+	backend.failing.Store(false)
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, classify("db.query"))
+	assert.NoError(t, classify("db.query"))
+	assert.Equal(t, int32(4), backend.calls.Load())
+}
+
+func TestNegativeCacheBackoff(t *testing.T) {
+	negative, err := newNegativeCache(NegativeCacheConfig{
+		MaxEntries:     10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Jitter:         0.5,
+	})
+	assert.NoError(t, err)
+	now := time.Now()
+	input := []byte(`{"name": "db.query"}`)
+
+	// Each failure doubles the backoff up to the maximum, less the jitter
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		negative.failed(input, errors.New("failed"), now)
+		assert.Error(t, negative.check(input, now.Add(backoff/2-time.Millisecond)))
+		assert.NoError(t, negative.check(input, now.Add(backoff)))
+	}
+
+	negative.succeeded(input)
+	assert.NoError(t, negative.check(input, now))
+
+	_, err = newNegativeCache(NegativeCacheConfig{MaxEntries: 10, InitialBackoff: time.Second, Jitter: 2})
+	assert.Error(t, err)
+}
@@ -0,0 +1,221 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+// This file contains the loading of models into wasmer, which requires
+// cgo. Builds with the wazero or wasmtime tag leave it out.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+	"go.uber.org/zap"
+)
+
+// defaultWasmRuntime is the runtime used unless the configuration selects one
+const defaultWasmRuntime = RuntimeWasmer
+
+// wasmerLoader loads models into wasmer
+type wasmerLoader struct {
+	logger *zap.Logger
+
+	// Engine compiling the models and the directory caching compiled
+	// modules, empty if disabled
+	engine           *wasmEngine
+	compiledCacheDir string
+
+	// Sandbox of each model, keyed by model name
+	sandboxes map[string]Sandbox
+}
+
+// newWasmerLoader creates the wasmer loader of a runtime. All models are
+// compiled by one engine, metered if any model has a fuel budget.
+func newWasmerLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	engine, err := newWasmEngine(config.Engine, len(config.Fuel) > 0)
+	if err != nil {
+		return nil, err
+	}
+	return &wasmerLoader{
+		logger:           logger,
+		engine:           engine,
+		compiledCacheDir: config.CompiledModuleCacheDir,
+		sandboxes:        config.Sandboxes,
+	}, nil
+}
+
+// load implements modelLoader, reusing the compiled module from the
+// compiled module cache if possible
+func (l *wasmerLoader) load(wasmBytes []byte, model string, count int) ([]guestInstance, error) {
+	// Create a new WebAssembly Store
+	store := wasmer.NewStore(l.engine.engine)
+
+	// Compile the WASM module
+	module, err := compileWasmModule(l.logger, store, wasmBytes, l.compiledCacheDir, l.engine.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile WASM module: %w", err)
+	}
+
+	// Check the imports against the sandbox
+	sandbox := l.sandboxes[model]
+	imports := importNames(module)
+	if err := sandbox.checkImports(imports); err != nil {
+		return nil, err
+	}
+	l.logger.Info("Model imports", zap.String("model", model), zap.Strings("imports", imports))
+
+	instances := make([]guestInstance, 0, count)
+	for i := 0; i < count; i++ {
+		instance, err := l.instantiate(store, module, model, &sandbox)
+		if err != nil {
+			for _, instance := range instances {
+				instance.Close()
+			}
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// instantiate instantiates a compiled WASM model in its sandbox
+func (l *wasmerLoader) instantiate(store *wasmer.Store, module *wasmer.Module, model string, sandbox *Sandbox) (wasmerInstance, error) {
+	// Create the import object with required functions for AssemblyScript,
+	// on top of the sandbox's WASI for modules that import it, such as
+	// TinyGo builds
+	var memory *wasmer.Memory
+	importObject, err := sandbox.imports(store, module, func() *wasmer.Memory { return memory })
+	if err != nil {
+		return wasmerInstance{}, err
+	}
+
+	// The WASM module requires env.abort function, whose message and file
+	// name are strings in the memory of the instance. It records the abort
+	// instead of trapping, since wasmer-go frees the traps of host functions
+	// twice, and the guest traps on the unreachable following the call.
+	aborted := new(error)
+	abortFn := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(wasmer.I32, wasmer.I32, wasmer.I32, wasmer.I32),
+			wasmer.NewValueTypes(),
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			var data []byte
+			if memory != nil {
+				data = memory.Data()
+			}
+			*aborted = assemblyScriptAbort(data, args[0].I32(), args[1].I32(), args[2].I32(), args[3].I32())
+			return nil, nil
+		},
+	)
+
+	// The host ABI lets models log, read the clock and draw random numbers
+	host := newHostFunctions(l.logger, model, sandbox)
+	logFn := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(
+			wasmer.NewValueTypes(wasmer.I32, wasmer.I32, wasmer.I32),
+			wasmer.NewValueTypes(),
+		),
+		func(args []wasmer.Value) ([]wasmer.Value, error) {
+			var data []byte
+			if memory != nil {
+				data = memory.Data()
+			}
+			host.log(data, args[0].I32(), args[1].I32(), args[2].I32())
+			return nil, nil
+		},
+	)
+	nowFn := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(wasmer.NewValueTypes(), wasmer.NewValueTypes(wasmer.I64)),
+		func([]wasmer.Value) ([]wasmer.Value, error) {
+			return []wasmer.Value{wasmer.NewI64(host.nowMs())}, nil
+		},
+	)
+	randomFn := wasmer.NewFunction(
+		store,
+		wasmer.NewFunctionType(wasmer.NewValueTypes(), wasmer.NewValueTypes(wasmer.F64)),
+		func([]wasmer.Value) ([]wasmer.Value, error) {
+			return []wasmer.Value{wasmer.NewF64(host.randomFloat())}, nil
+		},
+	)
+	importObject.Register("env", map[string]wasmer.IntoExtern{
+		"abort":          abortFn,
+		hostLogImport:    logFn,
+		hostNowImport:    nowFn,
+		hostRandomImport: randomFn,
+	})
+
+	// Instantiate the WASM module
+	inner, err := wasmer.NewInstance(module, importObject)
+	if err != nil {
+		return wasmerInstance{}, fmt.Errorf("failed to instantiate WASM module: %w", err)
+	}
+	if l.engine.metered {
+		if err := checkMetering(inner); err != nil {
+			inner.Close()
+			return wasmerInstance{}, err
+		}
+	}
+	memory, _ = inner.Exports.GetMemory(abiMemoryExport)
+	instance := wasmerInstance{Instance: inner, aborted: aborted}
+
+	// Reactor modules initialize their runtime before any other call
+	if initialize, err := instance.function(abiInitializeExport); err == nil {
+		if _, err := initialize(); err != nil {
+			instance.Close()
+			return wasmerInstance{}, fmt.Errorf("failed to initialize WASM module: %w", err)
+		}
+	}
+	return instance, nil
+}
+
+// wasmerInstance is a guestInstance of wasmer
+type wasmerInstance struct {
+	*wasmer.Instance
+
+	// aborted is the abort recorded by env.abort during a call, if any
+	aborted *error
+}
+
+func (i wasmerInstance) function(name string) (guestFunction, error) {
+	function, err := i.Exports.GetFunction(name)
+	if err != nil || i.aborted == nil {
+		return function, err
+	}
+
+	// Calls that trap after an abort fail with the abort
+	return func(args ...interface{}) (interface{}, error) {
+		*i.aborted = nil
+		result, err := function(args...)
+		if err != nil && *i.aborted != nil {
+			err = *i.aborted
+		}
+		return result, err
+	}, nil
+}
+
+func (i wasmerInstance) memory(name string) (guestMemory, error) {
+	memory, err := i.Exports.GetMemory(name)
+	if err != nil {
+		return nil, err
+	}
+	return memory, nil
+}
+
+func (i wasmerInstance) setFuel(fuel uint64) {
+	setFuel(i.Instance, fuel)
+}
+
+func (i wasmerInstance) fuelExhausted() bool {
+	return fuelExhausted(i.Instance)
+}
+
+// bind does nothing, since wasmer can't interrupt calls. Fuel budgets bound
+// their duration instead.
+func (i wasmerInstance) bind(context.Context) {}
+
+func (i wasmerInstance) closed() bool { return false }
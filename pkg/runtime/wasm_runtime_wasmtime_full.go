@@ -0,0 +1,357 @@
+//go:build fullwasm && wasmtime && !wazero
+// +build fullwasm,wasmtime,!wazero
+
+// This file contains the loading of models into wasmtime, which requires
+// cgo. Builds with the wasmtime tag leave wasmer out, since both link the
+// WebAssembly C API.
+
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bytecodealliance/wasmtime-go/v39"
+	"go.uber.org/zap"
+)
+
+// defaultWasmRuntime is the runtime used unless the configuration selects one
+const defaultWasmRuntime = RuntimeWasmtime
+
+// wasmtimeCacheConfig is the file configuring wasmtime's cache of compiled
+// modules in the compiled module cache directory
+const wasmtimeCacheConfig = "wasmtime-cache.toml"
+
+// newWasmerLoader fails, since wasmer is not part of the build
+func newWasmerLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	return nil, errors.New("the wasmer runtime is not part of this build, which was built with the wasmtime tag")
+}
+
+// wasmtimeLoader loads models into wasmtime. All models are compiled by one
+// engine, consuming fuel if any model has a fuel budget, and every instance
+// gets a store of its own, limiting its memory to the model's limit.
+type wasmtimeLoader struct {
+	logger  *zap.Logger
+	engine  *wasmtime.Engine
+	metered bool
+
+	// Sandbox and memory limit in MB of each model, keyed by model name
+	sandboxes    map[string]Sandbox
+	memoryLimits map[string]int
+}
+
+// newWasmtimeLoader creates the wasmtime loader of a runtime. Compiled
+// modules are cached in CompiledModuleCacheDir if it is set.
+func newWasmtimeLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	if config.Engine.Engine != "" || len(config.Engine.CPUFeatures) > 0 {
+		return nil, errors.New("WASM engines and CPU features are not supported by the wasmtime runtime")
+	}
+
+	engineConfig := wasmtime.NewConfig()
+	switch config.Engine.Compiler {
+	case "", "cranelift":
+		engineConfig.SetStrategy(wasmtime.StrategyCranelift)
+	default:
+		return nil, fmt.Errorf("unknown WASM compiler %q for the wasmtime runtime", config.Engine.Compiler)
+	}
+	metered := len(config.Fuel) > 0
+	engineConfig.SetConsumeFuel(metered)
+
+	if dir := config.CompiledModuleCacheDir; dir != "" {
+		path, err := writeWasmtimeCacheConfig(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure compiled module cache: %w", err)
+		}
+		if err := engineConfig.CacheConfigLoad(path); err != nil {
+			return nil, fmt.Errorf("failed to open compiled module cache: %w", err)
+		}
+	}
+
+	return &wasmtimeLoader{
+		logger:       logger,
+		engine:       wasmtime.NewEngineWithConfig(engineConfig),
+		metered:      metered,
+		sandboxes:    config.Sandboxes,
+		memoryLimits: config.memoryLimits(),
+	}, nil
+}
+
+// writeWasmtimeCacheConfig writes the configuration making wasmtime cache
+// compiled modules in dir and returns its path
+func writeWasmtimeCacheConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, wasmtimeCacheConfig)
+	content := "[cache]\ndirectory = " + strconv.Quote(dir) + "\n"
+	return path, os.WriteFile(path, []byte(content), 0o644)
+}
+
+// load implements modelLoader
+func (l *wasmtimeLoader) load(wasmBytes []byte, model string, count int) ([]guestInstance, error) {
+	module, err := wasmtime.NewModule(l.engine, wasmBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile WASM module: %w", err)
+	}
+
+	// Check the imports against the sandbox
+	sandbox := l.sandboxes[model]
+	var imports []string
+	for _, imported := range module.Imports() {
+		name := ""
+		if imported.Name() != nil {
+			name = *imported.Name()
+		}
+		imports = append(imports, imported.Module()+"."+name)
+	}
+	if err := sandbox.checkImports(imports); err != nil {
+		return nil, err
+	}
+	l.logger.Info("Model imports", zap.String("model", model), zap.Strings("imports", imports))
+
+	instances := make([]guestInstance, 0, count)
+	for i := 0; i < count; i++ {
+		instance, err := l.instantiate(module, model, &sandbox, imports)
+		if err != nil {
+			for _, instance := range instances {
+				instance.Close()
+			}
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// instantiate creates an instance of a compiled model in a store of its
+// own, with the sandbox's WASI environment and the host functions. The
+// memory of the instance can't grow beyond the model's limit, and modules
+// starting with more memory fail to instantiate.
+func (l *wasmtimeLoader) instantiate(module *wasmtime.Module, model string, sandbox *Sandbox, imports []string) (*wasmtimeInstance, error) {
+	store := wasmtime.NewStore(l.engine)
+	if limit := l.memoryLimits[model]; limit > 0 {
+		store.Limiter(int64(limit)<<20, -1, -1, -1, -1)
+	}
+
+	// Instances start without a budget, so instantiating and initializing
+	// a module isn't limited, and each invocation is given its budget when
+	// it starts
+	if l.metered {
+		if err := store.SetFuel(math.MaxUint64); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("failed to enable fuel metering: %w", err)
+		}
+	}
+
+	linker, err := sandbox.wasmtimeLinker(l.engine, store, imports, newHostFunctions(l.logger, model, sandbox))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	defer linker.Close()
+
+	inner, err := linker.Instantiate(store, module)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to instantiate WASM module: %w", err)
+	}
+	instance := &wasmtimeInstance{store: store, instance: inner}
+
+	// Reactor modules initialize their runtime before any other call
+	if initialize, err := instance.function(abiInitializeExport); err == nil {
+		if _, err := initialize(); err != nil {
+			instance.Close()
+			return nil, fmt.Errorf("failed to initialize WASM module: %w", err)
+		}
+	}
+	return instance, nil
+}
+
+// wasmtimeLinker returns the linker of an instance in store, with the
+// sandbox's WASI environment, restricted like wasmer's, the env.abort
+// function AssemblyScript modules require and the host ABI
+func (s *Sandbox) wasmtimeLinker(engine *wasmtime.Engine, store *wasmtime.Store, imports []string, host *hostFunctions) (*wasmtime.Linker, error) {
+	linker := wasmtime.NewLinker(engine)
+	linker.AllowShadowing(true)
+
+	// Models get no arguments, environment or standard streams
+	wasi := wasmtime.NewWasiConfig()
+	for _, directory := range s.Directories {
+		if err := wasi.PreopenDir(directory, directory, wasmtime.DIR_READ|wasmtime.DIR_WRITE, wasmtime.FILE_READ|wasmtime.FILE_WRITE); err != nil {
+			linker.Close()
+			return nil, fmt.Errorf("failed to create WASI environment: %w", err)
+		}
+	}
+	store.SetWasi(wasi)
+	if err := linker.DefineWasi(); err != nil {
+		linker.Close()
+		return nil, fmt.Errorf("failed to create WASI imports: %w", err)
+	}
+
+	// Replace the WASI functions the sandbox restricts
+	overrides := s.wasmtimeWasiOverrides()
+	for _, imported := range imports {
+		module, name, _ := strings.Cut(imported, ".")
+		if override, ok := overrides[name]; ok && strings.HasPrefix(module, "wasi_") {
+			if err := linker.FuncWrap(module, name, override); err != nil {
+				linker.Close()
+				return nil, fmt.Errorf("failed to create WASI imports: %w", err)
+			}
+		}
+	}
+
+	env := map[string]interface{}{
+		"abort": func(caller *wasmtime.Caller, msg, file, line, col int32) *wasmtime.Trap {
+			// Trap with the abort information
+			return wasmtime.NewTrap(assemblyScriptAbort(wasmtimeCallerMemory(caller), msg, file, line, col).Error())
+		},
+		hostLogImport: func(caller *wasmtime.Caller, level, ptr, length int32) {
+			host.log(wasmtimeCallerMemory(caller), level, ptr, length)
+		},
+		hostNowImport:    host.nowMs,
+		hostRandomImport: host.randomFloat,
+	}
+	for name, function := range env {
+		if err := linker.FuncWrap("env", name, function); err != nil {
+			linker.Close()
+			return nil, fmt.Errorf("failed to create host imports: %w", err)
+		}
+	}
+	return linker, nil
+}
+
+// wasmtimeWasiOverrides returns the host functions replacing WASI's, keyed
+// by name
+func (s *Sandbox) wasmtimeWasiOverrides() map[string]interface{} {
+	overrides := make(map[string]interface{})
+
+	if s.FrozenClock {
+		// clock_time_get(id, precision, time) and clock_res_get(id, resolution)
+		// write a u64 of the clock
+		frozen := func(caller *wasmtime.Caller, ptr int32, value uint64) int32 {
+			data := wasmtimeCallerMemory(caller)
+			if uint64(uint32(ptr))+8 > uint64(len(data)) {
+				return wasiErrnoFault
+			}
+			binary.LittleEndian.PutUint64(data[uint32(ptr):], value)
+			return wasiErrnoSuccess
+		}
+		overrides["clock_time_get"] = func(caller *wasmtime.Caller, id int32, precision int64, ptr int32) int32 {
+			return frozen(caller, ptr, 0)
+		}
+		overrides["clock_res_get"] = func(caller *wasmtime.Caller, id int32, ptr int32) int32 {
+			return frozen(caller, ptr, 1)
+		}
+		overrides["poll_oneoff"] = func(in, out, subscriptions, events int32) int32 {
+			return wasiErrnoNotSup
+		}
+	}
+
+	if s.DeterministicRandom {
+		random := s.random()
+		overrides["random_get"] = func(caller *wasmtime.Caller, ptr, length int32) int32 {
+			data := wasmtimeCallerMemory(caller)
+			start, end := uint64(uint32(ptr)), uint64(uint32(ptr))+uint64(uint32(length))
+			if end > uint64(len(data)) {
+				return wasiErrnoFault
+			}
+			random.Read(data[start:end])
+			return wasiErrnoSuccess
+		}
+	}
+	return overrides
+}
+
+// wasmtimeCallerMemory returns the memory of the instance calling a host
+// function, nil if it exports none
+func wasmtimeCallerMemory(caller *wasmtime.Caller) []byte {
+	export := caller.GetExport(abiMemoryExport)
+	if export == nil || export.Memory() == nil {
+		return nil
+	}
+	return export.Memory().UnsafeData(caller)
+}
+
+// wasmtimeInstance is a guestInstance of wasmtime. It owns its store.
+type wasmtimeInstance struct {
+	store    *wasmtime.Store
+	instance *wasmtime.Instance
+}
+
+func (i *wasmtimeInstance) function(name string) (guestFunction, error) {
+	function := i.instance.GetFunc(i.store, name)
+	if function == nil {
+		return nil, fmt.Errorf("module does not export function %s", name)
+	}
+
+	// Calls return their results like wasmer's native functions
+	return func(args ...interface{}) (interface{}, error) {
+		result, err := function.Call(i.store, args...)
+		if err != nil {
+			return nil, err
+		}
+		if values, ok := result.([]wasmtime.Val); ok {
+			results := make([]interface{}, len(values))
+			for i, value := range values {
+				results[i] = value.Get()
+			}
+			return results, nil
+		}
+		return result, nil
+	}, nil
+}
+
+func (i *wasmtimeInstance) memory(name string) (guestMemory, error) {
+	export := i.instance.GetExport(i.store, name)
+	if export == nil || export.Memory() == nil {
+		return nil, fmt.Errorf("module does not export memory %s", name)
+	}
+	return wasmtimeMemory{memory: export.Memory(), store: i.store}, nil
+}
+
+// setFuel gives the instance fuel for an invocation. Stores of a metered
+// engine always accept it.
+func (i *wasmtimeInstance) setFuel(fuel uint64) {
+	i.store.SetFuel(fuel)
+}
+
+func (i *wasmtimeInstance) fuelExhausted() bool {
+	fuel, err := i.store.GetFuel()
+	return err == nil && fuel == 0
+}
+
+// bind does nothing, since calls aren't interrupted. Fuel budgets bound
+// their duration instead.
+func (i *wasmtimeInstance) bind(context.Context) {}
+
+func (i *wasmtimeInstance) closed() bool { return false }
+
+// Close releases the instance and its store
+func (i *wasmtimeInstance) Close() {
+	i.store.Close()
+}
+
+// wasmtimeMemory is a guestMemory of wasmtime
+type wasmtimeMemory struct {
+	memory *wasmtime.Memory
+	store  *wasmtime.Store
+}
+
+func (m wasmtimeMemory) Data() []byte {
+	return m.memory.UnsafeData(m.store)
+}
+
+func (m wasmtimeMemory) DataSize() uint {
+	return uint(m.memory.DataSize(m.store))
+}
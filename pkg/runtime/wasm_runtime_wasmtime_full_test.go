@@ -0,0 +1,112 @@
+//go:build fullwasm && wasmtime && !wazero
+// +build fullwasm,wasmtime,!wazero
+
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytecodealliance/wasmtime-go/v39"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// wasmtimeTestModule has a function spinning until it is stopped, one
+// growing its memory by 2 MB, trapping if it can't, and one returning its
+// input
+const wasmtimeTestModule = `(module
+  (memory (export "memory") 1)
+  (func (export "alloc") (param i32) (result i32)
+    (i32.const 1024))
+  (func (export "spin") (param i32 i32) (result i64)
+    (loop $forever (br $forever))
+    (i64.const 0))
+  (func (export "grow") (param i32 i32) (result i64)
+    (if (i32.lt_s (memory.grow (i32.const 32)) (i32.const 0))
+      (then unreachable))
+    (i64.const 0))
+  (func (export "echo") (param $ptr i32) (param $len i32) (result i64)
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $ptr)) (i64.const 32))
+      (i64.extend_i32_u (local.get $len)))))`
+
+// loadWasmtimeTestModel loads the test module as the sampler with config
+func loadWasmtimeTestModel(t *testing.T, config *WasmRuntimeConfig) *guestPool {
+	wasmBytes, err := wasmtime.Wat2Wasm(wasmtimeTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "sampler.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	loader, err := newModelLoader(zap.NewNop(), config)
+	require.NoError(t, err)
+	impl := &fullWasmImpl{logger: zap.NewNop(), loader: loader, fuel: config.Fuel, memoryLimits: config.memoryLimits()}
+	pool, err := impl.loadWasmModel(path, ModelSampler)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestWasmtimeIsTheDefaultRuntime(t *testing.T) {
+	loader, err := newModelLoader(zap.NewNop(), &WasmRuntimeConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, &wasmtimeLoader{}, loader)
+
+	_, err = newModelLoader(zap.NewNop(), &WasmRuntimeConfig{Engine: EngineConfig{Runtime: RuntimeWasmer}})
+	assert.ErrorContains(t, err, "wasmtime tag")
+	_, err = newModelLoader(zap.NewNop(), &WasmRuntimeConfig{Engine: EngineConfig{Runtime: RuntimeWasmtime, Compiler: "llvm"}})
+	assert.Error(t, err)
+}
+
+func TestWasmtimeFuelBudget(t *testing.T) {
+	pool := loadWasmtimeTestModel(t, &WasmRuntimeConfig{Fuel: map[string]uint64{ModelSampler: 10000}})
+
+	err := pool.call(context.Background(), "spin", []byte(`{}`), func([]byte) error { return nil })
+	assert.ErrorIs(t, err, errFuelExhausted)
+
+	// Each invocation gets its own budget
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.call(context.Background(), "echo", []byte(`{}`), func(output []byte) error {
+			assert.Equal(t, `{}`, string(output))
+			return nil
+		}))
+	}
+}
+
+func TestWasmtimeMemoryLimit(t *testing.T) {
+	pool := loadWasmtimeTestModel(t, &WasmRuntimeConfig{SamplerMemory: 1})
+
+	// Growing the memory beyond the limit fails, which traps the invocation
+	err := pool.call(context.Background(), "grow", []byte(`{}`), func([]byte) error { return nil })
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errMemoryExceeded)
+
+	require.NoError(t, pool.call(context.Background(), "echo", []byte(`{}`), func(output []byte) error {
+		assert.Equal(t, `{}`, string(output))
+		return nil
+	}))
+}
+
+func TestWasmtimeCompiledModuleCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "compiled")
+	// wasmtime's cache worker records usage statistics in the background
+	t.Cleanup(func() {
+		assert.Eventually(t, func() bool { return os.RemoveAll(dir) == nil }, time.Second, 10*time.Millisecond)
+	})
+	loadWasmtimeTestModel(t, &WasmRuntimeConfig{CompiledModuleCacheDir: dir})
+
+	files, err := filepath.Glob(filepath.Join(dir, "modules", "*", "*"))
+	require.NoError(t, err)
+	var modules int
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".stats") {
+			modules++
+		}
+	}
+	assert.Equal(t, 1, modules)
+}
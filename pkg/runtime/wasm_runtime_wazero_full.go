@@ -0,0 +1,357 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the loading of models into wazero, a WebAssembly
+// runtime written in Go, so builds with the wazero tag need no cgo
+
+package runtime
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+)
+
+// wazeroPagesPerMB is the number of 64 KiB WebAssembly pages in a MB, and
+// wazeroMaxPages the most pages a 32-bit memory can have
+const (
+	wazeroPagesPerMB = 16
+	wazeroMaxPages   = 65536
+)
+
+// wazeroLoader loads models into wazero. Every instance gets a wazero
+// runtime of its own, holding its sandboxed WASI module, and the runtimes
+// share the compiled modules through the compilation cache.
+type wazeroLoader struct {
+	logger *zap.Logger
+	config wazero.RuntimeConfig
+
+	// Sandbox and memory limit in MB of each model, keyed by model name
+	sandboxes    map[string]Sandbox
+	memoryLimits map[string]int
+}
+
+// newWazeroLoader creates the wazero loader of a runtime. Compiled modules
+// are cached in memory, and in CompiledModuleCacheDir if it is set.
+func newWazeroLoader(logger *zap.Logger, config *WasmRuntimeConfig) (modelLoader, error) {
+	if len(config.Fuel) > 0 {
+		return nil, errors.New("fuel metering is not supported by the wazero runtime")
+	}
+	if config.Engine.Engine != "" || len(config.Engine.CPUFeatures) > 0 {
+		return nil, errors.New("WASM engines and CPU features are not supported by the wazero runtime")
+	}
+
+	var runtimeConfig wazero.RuntimeConfig
+	switch config.Engine.Compiler {
+	case "", "compiler":
+		runtimeConfig = wazero.NewRuntimeConfig()
+	case "interpreter":
+		runtimeConfig = wazero.NewRuntimeConfigInterpreter()
+	default:
+		return nil, fmt.Errorf("unknown WASM compiler %q for the wazero runtime", config.Engine.Compiler)
+	}
+
+	cache := wazero.NewCompilationCache()
+	if config.CompiledModuleCacheDir != "" {
+		var err error
+		if cache, err = wazero.NewCompilationCacheWithDir(config.CompiledModuleCacheDir); err != nil {
+			return nil, fmt.Errorf("failed to open compiled module cache: %w", err)
+		}
+	}
+
+	// Calls bound to a context are aborted once it is done
+	return &wazeroLoader{
+		logger:       logger,
+		config:       runtimeConfig.WithCompilationCache(cache).WithCloseOnContextDone(true),
+		sandboxes:    config.Sandboxes,
+		memoryLimits: config.memoryLimits(),
+	}, nil
+}
+
+// load implements modelLoader
+func (l *wazeroLoader) load(wasmBytes []byte, model string, count int) ([]guestInstance, error) {
+	sandbox := l.sandboxes[model]
+	instances := make([]guestInstance, 0, count)
+	for i := 0; i < count; i++ {
+		instance, imports, err := l.instantiate(wasmBytes, model, &sandbox)
+		if err != nil {
+			for _, instance := range instances {
+				instance.Close()
+			}
+			return nil, err
+		}
+		if i == 0 {
+			l.logger.Info("Model imports", zap.String("model", model), zap.Strings("imports", imports))
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// instantiate creates an instance of a model in a runtime of its own, with
+// the host modules of its sandbox, and returns the module's imports. The
+// memory of the instance can't grow beyond the model's limit, and modules
+// declaring a larger minimum or maximum are rejected.
+func (l *wazeroLoader) instantiate(wasmBytes []byte, model string, sandbox *Sandbox) (*wazeroInstance, []string, error) {
+	ctx := context.Background()
+	config := l.config
+	if limit := l.memoryLimits[model]; limit > 0 {
+		config = config.WithMemoryLimitPages(uint32(min(limit*wazeroPagesPerMB, wazeroMaxPages)))
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+
+	module, err := runtime.CompileModule(ctx, wasmBytes)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, nil, fmt.Errorf("failed to compile WASM module: %w", err)
+	}
+
+	// Check the imports against the sandbox
+	var imports []string
+	for _, function := range module.ImportedFunctions() {
+		moduleName, name, _ := function.Import()
+		imports = append(imports, moduleName+"."+name)
+	}
+	for _, memory := range module.ImportedMemories() {
+		moduleName, name, _ := memory.Import()
+		imports = append(imports, moduleName+"."+name)
+	}
+	if err := sandbox.checkImports(imports); err != nil {
+		runtime.Close(ctx)
+		return nil, nil, err
+	}
+
+	host := newHostFunctions(l.logger, model, sandbox)
+	if err := instantiateWazeroHostModules(ctx, runtime, sandbox, host); err != nil {
+		runtime.Close(ctx)
+		return nil, nil, err
+	}
+
+	// The start functions are run by the ABIs that need them
+	guest, err := runtime.InstantiateModule(ctx, module, sandbox.wazeroModuleConfig())
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, nil, fmt.Errorf("failed to instantiate WASM module: %w", err)
+	}
+	instance := &wazeroInstance{runtime: runtime, module: guest, ctx: ctx}
+
+	// Reactor modules initialize their runtime before any other call
+	if initialize, err := instance.function(abiInitializeExport); err == nil {
+		if _, err := initialize(); err != nil {
+			instance.Close()
+			return nil, nil, fmt.Errorf("failed to initialize WASM module: %w", err)
+		}
+	}
+	return instance, imports, nil
+}
+
+// instantiateWazeroHostModules instantiates WASI, restricted by the sandbox,
+// the env.abort function AssemblyScript modules require and the host ABI
+func instantiateWazeroHostModules(ctx context.Context, runtime wazero.Runtime, sandbox *Sandbox, host *hostFunctions) error {
+	wasi := runtime.NewHostModuleBuilder(wasi_snapshot_preview1.ModuleName)
+	wasi_snapshot_preview1.NewFunctionExporter().ExportFunctions(wasi)
+	if sandbox.FrozenClock {
+		wasi.NewFunctionBuilder().
+			WithFunc(func(ctx context.Context, in, out, subscriptions, events uint32) uint32 {
+				return wasiErrnoNotSup
+			}).
+			Export("poll_oneoff")
+	}
+	if _, err := wasi.Instantiate(ctx); err != nil {
+		return fmt.Errorf("failed to create WASI imports: %w", err)
+	}
+
+	_, err := runtime.NewHostModuleBuilder("env").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, module api.Module, msg, file, line, col int32) {
+			// Trap with the abort information
+			var data []byte
+			if memory := module.Memory(); memory != nil {
+				data, _ = memory.Read(0, memory.Size())
+			}
+			panic(assemblyScriptAbort(data, msg, file, line, col))
+		}).
+		Export("abort").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, module api.Module, level, ptr, length int32) {
+			var data []byte
+			if memory := module.Memory(); memory != nil {
+				data, _ = memory.Read(0, memory.Size())
+			}
+			host.log(data, level, ptr, length)
+		}).
+		Export(hostLogImport).
+		NewFunctionBuilder().
+		WithFunc(func(context.Context) int64 { return host.nowMs() }).
+		Export(hostNowImport).
+		NewFunctionBuilder().
+		WithFunc(func(context.Context) float64 { return host.randomFloat() }).
+		Export(hostRandomImport).
+		Instantiate(ctx)
+	return err
+}
+
+// wazeroModuleConfig returns the configuration of a module in the sandbox.
+// Models get no arguments, environment or standard streams.
+func (s *Sandbox) wazeroModuleConfig() wazero.ModuleConfig {
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions()
+
+	fsConfig := wazero.NewFSConfig()
+	for _, directory := range s.Directories {
+		fsConfig = fsConfig.WithDirMount(directory, directory)
+	}
+	config = config.WithFSConfig(fsConfig)
+
+	if s.FrozenClock {
+		config = config.
+			WithWalltime(func() (int64, int32) { return 0, 0 }, 1).
+			WithNanotime(func() int64 { return 0 }, 1)
+	} else {
+		config = config.WithSysWalltime().WithSysNanotime().WithSysNanosleep()
+	}
+
+	if s.DeterministicRandom {
+		config = config.WithRandSource(s.random())
+	} else {
+		config = config.WithRandSource(rand.Reader)
+	}
+	return config
+}
+
+// wazeroInstance is a guestInstance of wazero. It owns its runtime.
+type wazeroInstance struct {
+	runtime wazero.Runtime
+	module  api.Module
+
+	// ctx is the context calls are bound to
+	ctx context.Context
+}
+
+func (i *wazeroInstance) function(name string) (guestFunction, error) {
+	function := i.module.ExportedFunction(name)
+	if function == nil {
+		return nil, fmt.Errorf("module does not export function %s", name)
+	}
+	params := function.Definition().ParamTypes()
+	results := function.Definition().ResultTypes()
+
+	// Calls convert the arguments and results like wasmer's native functions
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != len(params) {
+			return nil, fmt.Errorf("function %s takes %d arguments, got %d", name, len(params), len(args))
+		}
+		stack := make([]uint64, max(len(params), len(results)))
+		for i, arg := range args {
+			value, err := encodeWazeroValue(arg, params[i])
+			if err != nil {
+				return nil, fmt.Errorf("argument %d of function %s: %w", i, name, err)
+			}
+			stack[i] = value
+		}
+		if err := function.CallWithStack(i.ctx, stack); err != nil {
+			return nil, err
+		}
+
+		switch len(results) {
+		case 0:
+			return nil, nil
+		case 1:
+			return decodeWazeroValue(stack[0], results[0]), nil
+		default:
+			values := make([]interface{}, len(results))
+			for i, kind := range results {
+				values[i] = decodeWazeroValue(stack[i], kind)
+			}
+			return values, nil
+		}
+	}, nil
+}
+
+func (i *wazeroInstance) memory(name string) (guestMemory, error) {
+	memory := i.module.ExportedMemory(name)
+	if memory == nil {
+		return nil, fmt.Errorf("module does not export memory %s", name)
+	}
+	return wazeroMemory{memory}, nil
+}
+
+// setFuel and fuelExhausted are never called, since the wazero loader
+// rejects fuel budgets
+func (i *wazeroInstance) setFuel(uint64) {}
+
+func (i *wazeroInstance) fuelExhausted() bool { return false }
+
+// bind aborts the following calls once ctx is done, closing the module
+func (i *wazeroInstance) bind(ctx context.Context) {
+	i.ctx = ctx
+}
+
+func (i *wazeroInstance) closed() bool {
+	return i.module.IsClosed()
+}
+
+// Close releases the instance and its runtime
+func (i *wazeroInstance) Close() {
+	i.runtime.Close(context.Background())
+}
+
+// wazeroMemory is a guestMemory of wazero
+type wazeroMemory struct {
+	memory api.Memory
+}
+
+func (m wazeroMemory) Data() []byte {
+	data, _ := m.memory.Read(0, m.memory.Size())
+	return data
+}
+
+func (m wazeroMemory) DataSize() uint {
+	return uint(m.memory.Size())
+}
+
+// encodeWazeroValue encodes an argument of a guestFunction as a value of
+// kind
+func encodeWazeroValue(arg interface{}, kind api.ValueType) (uint64, error) {
+	switch value := arg.(type) {
+	case int32:
+		if kind == api.ValueTypeI32 {
+			return api.EncodeI32(value), nil
+		}
+	case int64:
+		if kind == api.ValueTypeI64 {
+			return api.EncodeI64(value), nil
+		}
+	case float32:
+		if kind == api.ValueTypeF32 {
+			return api.EncodeF32(value), nil
+		}
+	case float64:
+		if kind == api.ValueTypeF64 {
+			return api.EncodeF64(value), nil
+		}
+	}
+	return 0, fmt.Errorf("%T is not a %s", arg, api.ValueTypeName(kind))
+}
+
+// decodeWazeroValue decodes a result of kind as wasmer's native functions
+// return it
+func decodeWazeroValue(value uint64, kind api.ValueType) interface{} {
+	switch kind {
+	case api.ValueTypeI32:
+		return int32(uint32(value))
+	case api.ValueTypeI64:
+		return int64(value)
+	case api.ValueTypeF32:
+		return api.DecodeF32(value)
+	case api.ValueTypeF64:
+		return api.DecodeF64(value)
+	default:
+		return value
+	}
+}
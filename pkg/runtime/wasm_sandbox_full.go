@@ -0,0 +1,47 @@
+//go:build fullwasm
+// +build fullwasm
+
+// This file contains the sandbox of WASM models shared by the runtimes: the
+// imports a module may have and the randomness it gets
+
+package runtime
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// WASI errno values returned by the sandboxed host functions
+const (
+	wasiErrnoSuccess = 0
+	wasiErrnoFault   = 21
+	wasiErrnoNotSup  = 58
+)
+
+// checkImports returns an error if the module imports functions, given as
+// module.name, that the sandbox doesn't allow
+func (s *Sandbox) checkImports(imports []string) error {
+	if len(s.AllowedImports) == 0 {
+		return nil
+	}
+	var denied []string
+	for _, name := range imports {
+		if !containsString(s.AllowedImports, name) {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("module imports %s, which the sandbox does not allow", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// random returns the deterministic randomness of an instance, which is the
+// same sequence for every instance
+func (s *Sandbox) random() *rand.ChaCha8 {
+	var seed [32]byte
+	binary.LittleEndian.PutUint64(seed[:], s.RandomSeed)
+	return rand.NewChaCha8(seed)
+}
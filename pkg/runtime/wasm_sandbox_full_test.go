@@ -0,0 +1,149 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// sandboxTestModule is a WASI guest whose probe function returns the time
+// followed by 8 random bytes
+const sandboxTestModule = `(module
+  (import "wasi_snapshot_preview1" "clock_time_get" (func $clock (param i32 i64 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "random_get" (func $random (param i32 i32) (result i32)))
+  (memory (export "memory") 1)
+  (func (export "alloc") (param i32) (result i32)
+    (i32.const 1024))
+  (func (export "probe") (param i32 i32) (result i64)
+    (drop (call $clock (i32.const 0) (i64.const 1) (i32.const 64)))
+    (drop (call $random (i32.const 72) (i32.const 8)))
+    (i64.or (i64.shl (i64.const 64) (i64.const 32)) (i64.const 16))))`
+
+func TestSandboxRestrictsWASI(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(sandboxTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "probe.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	var expected [8]byte
+	var seed [32]byte
+	seed[0] = 7
+	rand.NewChaCha8(seed).Read(expected[:])
+
+	for _, runtime := range testRuntimes {
+		t.Run(runtime, func(t *testing.T) {
+			impl := newTestImpl(t, &WasmRuntimeConfig{
+				Engine: EngineConfig{Runtime: runtime},
+				Sandboxes: map[string]Sandbox{
+					ModelSampler:         {FrozenClock: true, DeterministicRandom: true, RandomSeed: 7},
+					ModelErrorClassifier: {AllowedImports: []string{"wasi_snapshot_preview1.clock_time_get"}},
+				},
+			})
+
+			// The clock is frozen and every load draws the same random bytes
+			for i := 0; i < 2; i++ {
+				guest, err := impl.loadWasmModel(path, ModelSampler)
+				require.NoError(t, err)
+				require.NoError(t, guest.call(context.Background(), "probe", []byte(`{}`), func(output []byte) error {
+					assert.Equal(t, uint64(0), binary.LittleEndian.Uint64(output))
+					assert.Equal(t, expected[:], output[8:])
+					return nil
+				}))
+				guest.Close()
+			}
+
+			// The host clock and randomness are used by default
+			guest, err := impl.loadWasmModel(path, ModelEntityExtractor)
+			require.NoError(t, err)
+			require.NoError(t, guest.call(context.Background(), "probe", []byte(`{}`), func(output []byte) error {
+				assert.NotZero(t, binary.LittleEndian.Uint64(output))
+				return nil
+			}))
+			guest.Close()
+
+			_, err = impl.loadWasmModel(path, ModelErrorClassifier)
+			assert.ErrorContains(t, err, "module imports wasi_snapshot_preview1.random_get, which the sandbox does not allow")
+		})
+	}
+}
+
+// hostTestModule is a guest whose probe function logs a message and returns
+// the time followed by a random number, through the host ABI
+const hostTestModule = `(module
+  (import "env" "log" (func $log (param i32 i32 i32)))
+  (import "env" "now_ms" (func $now (result i64)))
+  (import "env" "random" (func $random (result f64)))
+  (memory (export "memory") 1)
+  (data (i32.const 512) "scoring span")
+  (func (export "alloc") (param i32) (result i32)
+    (i32.const 1024))
+  (func (export "probe") (param i32 i32) (result i64)
+    (call $log (i32.const 2) (i32.const 512) (i32.const 12))
+    (i64.store (i32.const 64) (call $now))
+    (f64.store (i32.const 72) (call $random))
+    (i64.or (i64.shl (i64.const 64) (i64.const 32)) (i64.const 16))))`
+
+func TestHostFunctions(t *testing.T) {
+	wasmBytes, err := wasmer.Wat2Wasm(hostTestModule)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "host.wasm")
+	require.NoError(t, os.WriteFile(path, wasmBytes, 0o600))
+
+	var seed [32]byte
+	seed[0] = 7
+	expected := rand.New(rand.NewChaCha8(seed)).Float64()
+
+	for _, runtime := range testRuntimes {
+		t.Run(runtime, func(t *testing.T) {
+			core, logs := observer.New(zap.DebugLevel)
+			config := &WasmRuntimeConfig{
+				Engine: EngineConfig{Runtime: runtime},
+				Sandboxes: map[string]Sandbox{
+					ModelSampler: {FrozenClock: true, DeterministicRandom: true, RandomSeed: 7},
+				},
+			}
+			loader, err := newModelLoader(zap.New(core), config)
+			require.NoError(t, err)
+			impl := &fullWasmImpl{logger: zap.NewNop(), loader: loader}
+
+			// Messages are logged with the model at their level
+			guest, err := impl.loadWasmModel(path, ModelSampler)
+			require.NoError(t, err)
+			require.NoError(t, guest.call(context.Background(), "probe", []byte(`{}`), func(output []byte) error {
+				assert.Equal(t, uint64(0), binary.LittleEndian.Uint64(output))
+				assert.Equal(t, expected, math.Float64frombits(binary.LittleEndian.Uint64(output[8:])))
+				return nil
+			}))
+			guest.Close()
+			entries := logs.FilterMessage("Model log").All()
+			require.Len(t, entries, 1)
+			assert.Equal(t, zap.WarnLevel, entries[0].Level)
+			assert.Equal(t, map[string]interface{}{"model": ModelSampler, "message": "scoring span"}, entries[0].ContextMap())
+
+			// The host clock and randomness are used by default
+			guest, err = impl.loadWasmModel(path, ModelEntityExtractor)
+			require.NoError(t, err)
+			defer guest.Close()
+			require.NoError(t, guest.call(context.Background(), "probe", []byte(`{}`), func(output []byte) error {
+				assert.InDelta(t, time.Now().UnixMilli(), int64(binary.LittleEndian.Uint64(output)), 60000)
+				random := math.Float64frombits(binary.LittleEndian.Uint64(output[8:]))
+				assert.True(t, random >= 0 && random < 1)
+				return nil
+			}))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+//go:build fullwasm && !wazero && !wasmtime
+// +build fullwasm,!wazero,!wasmtime
+
+// This file contains the sandbox of models loaded into wasmer: the WASI
+// environment and host functions they get
+
+package runtime
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	wasmer "github.com/wasmerio/wasmer-go/wasmer"
+)
+
+// importNames returns the imports of a module as module.name
+func importNames(module *wasmer.Module) []string {
+	var imports []string
+	for _, imported := range module.Imports() {
+		imports = append(imports, imported.Module()+"."+imported.Name())
+	}
+	return imports
+}
+
+// imports returns the imports of a module with the sandbox's WASI
+// environment if it imports WASI. Host functions read and write the
+// instance's memory through memory, which is nil until it is instantiated.
+func (s *Sandbox) imports(store *wasmer.Store, module *wasmer.Module, memory func() *wasmer.Memory) (*wasmer.ImportObject, error) {
+	if wasmer.GetWasiVersion(module) == wasmer.WASI_VERSION_INVALID {
+		return wasmer.NewImportObject(), nil
+	}
+
+	// Models get no arguments, environment or standard streams
+	builder := wasmer.NewWasiStateBuilder("model")
+	for _, directory := range s.Directories {
+		builder.PreopenDirectory(directory)
+	}
+	wasiEnv, err := builder.Finalize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WASI environment: %w", err)
+	}
+	importObject, err := wasiEnv.GenerateImportObject(store, module)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WASI imports: %w", err)
+	}
+
+	// Replace the WASI functions the sandbox restricts
+	overrides := s.wasiOverrides(store, memory)
+	for _, imported := range module.Imports() {
+		if override, ok := overrides[imported.Name()]; ok && strings.HasPrefix(imported.Module(), "wasi_") {
+			importObject.Register(imported.Module(), map[string]wasmer.IntoExtern{imported.Name(): override})
+		}
+	}
+	return importObject, nil
+}
+
+// wasiOverrides returns the host functions replacing WASI's, keyed by name
+func (s *Sandbox) wasiOverrides(store *wasmer.Store, memory func() *wasmer.Memory) map[string]wasmer.IntoExtern {
+	overrides := make(map[string]wasmer.IntoExtern)
+	function := func(params []wasmer.ValueKind, fn func(data []byte, args []wasmer.Value) int32) *wasmer.Function {
+		return wasmer.NewFunction(store,
+			wasmer.NewFunctionType(wasmer.NewValueTypes(params...), wasmer.NewValueTypes(wasmer.I32)),
+			func(args []wasmer.Value) ([]wasmer.Value, error) {
+				var data []byte
+				if m := memory(); m != nil {
+					data = m.Data()
+				}
+				return []wasmer.Value{wasmer.NewI32(fn(data, args))}, nil
+			})
+	}
+
+	if s.FrozenClock {
+		// clock_time_get(id, precision, time) and clock_res_get(id, resolution)
+		// write a u64 of the clock
+		frozen := func(ptr int32, value uint64, data []byte) int32 {
+			if uint64(uint32(ptr))+8 > uint64(len(data)) {
+				return wasiErrnoFault
+			}
+			binary.LittleEndian.PutUint64(data[uint32(ptr):], value)
+			return wasiErrnoSuccess
+		}
+		overrides["clock_time_get"] = function([]wasmer.ValueKind{wasmer.I32, wasmer.I64, wasmer.I32},
+			func(data []byte, args []wasmer.Value) int32 { return frozen(args[2].I32(), 0, data) })
+		overrides["clock_res_get"] = function([]wasmer.ValueKind{wasmer.I32, wasmer.I32},
+			func(data []byte, args []wasmer.Value) int32 { return frozen(args[1].I32(), 1, data) })
+		overrides["poll_oneoff"] = function([]wasmer.ValueKind{wasmer.I32, wasmer.I32, wasmer.I32, wasmer.I32},
+			func([]byte, []wasmer.Value) int32 { return wasiErrnoNotSup })
+	}
+
+	if s.DeterministicRandom {
+		random := s.random()
+		overrides["random_get"] = function([]wasmer.ValueKind{wasmer.I32, wasmer.I32},
+			func(data []byte, args []wasmer.Value) int32 {
+				ptr, length := uint64(uint32(args[0].I32())), uint64(uint32(args[1].I32()))
+				if ptr+length > uint64(len(data)) {
+					return wasiErrnoFault
+				}
+				random.Read(data[ptr : ptr+length])
+				return wasiErrnoSuccess
+			})
+	}
+	return overrides
+}
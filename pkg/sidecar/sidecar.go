@@ -0,0 +1,542 @@
+// Package sidecar runs models implemented outside WASM, for example in
+// Python with scikit-learn or PyTorch, as managed subprocesses.
+//
+// The protocol is newline-delimited JSON over the sidecar's stdin and stdout,
+// or over a Unix domain socket. Each request is one line:
+//
+//	{"id": 1, "method": "invoke", "model": "error_classifier", "input": {...}}
+//
+// and the sidecar answers with one line carrying the same id:
+//
+//	{"id": 1, "output": {...}}
+//	{"id": 1, "error": "model failed"}
+//
+// Methods are "invoke" (run the model on input), "health" (answer with any
+// output when ready) and "reload" (load the model from input["path"]).
+// Responses may be sent in any order. Anything the sidecar writes to stderr
+// is logged.
+package sidecar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Protocol methods
+const (
+	MethodInvoke = "invoke"
+	MethodHealth = "health"
+	MethodReload = "reload"
+)
+
+// ErrUnavailable is returned while the sidecar is not connected
+var ErrUnavailable = errors.New("sidecar is not available")
+
+// Request is a message sent to the sidecar
+type Request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Model  string          `json:"model,omitempty"`
+	Input  json.RawMessage `json:"input,omitempty"`
+}
+
+// Response is a message received from the sidecar
+type Response struct {
+	ID     uint64                 `json:"id"`
+	Output map[string]interface{} `json:"output,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// Config defines how a sidecar is started and monitored
+type Config struct {
+	// Model is the model name sent with every request
+	Model string
+
+	// Command starts the sidecar. When empty, Socket must point to a sidecar
+	// managed outside the processor.
+	Command []string
+
+	// Env is added to the environment of the sidecar
+	Env []string
+
+	// Socket is the Unix domain socket the sidecar listens on. When empty,
+	// the protocol runs over the sidecar's stdin and stdout.
+	Socket string
+
+	// Timeout bounds a single invocation or health check
+	Timeout time.Duration
+
+	// StartTimeout bounds the time for the sidecar to become healthy, and
+	// for it to reload its model
+	StartTimeout time.Duration
+
+	// HealthInterval is the time between health checks
+	HealthInterval time.Duration
+
+	// MaxRestartBackoff caps the delay between restarts
+	MaxRestartBackoff time.Duration
+}
+
+// Sidecar is a supervised connection to a model sidecar
+type Sidecar struct {
+	logger *zap.Logger
+	config Config
+
+	nextID   atomic.Uint64
+	restarts atomic.Int64
+
+	mutex   sync.Mutex
+	conn    *connection
+	closed  bool
+	process *exec.Cmd
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// connection is one session with a running sidecar
+type connection struct {
+	writer io.WriteCloser
+
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	pending    map[uint64]chan Response
+	broken     chan struct{}
+	err        error
+}
+
+// Start starts the sidecar, waits until it is healthy and supervises it
+// until Close is called. Crashed or unhealthy sidecars are restarted with
+// exponential backoff.
+func Start(logger *zap.Logger, config Config) (*Sidecar, error) {
+	if len(config.Command) == 0 && config.Socket == "" {
+		return nil, errors.New("sidecar requires a command or a socket")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.StartTimeout <= 0 {
+		config.StartTimeout = 30 * time.Second
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = 10 * time.Second
+	}
+	if config.MaxRestartBackoff <= 0 {
+		config.MaxRestartBackoff = 30 * time.Second
+	}
+
+	s := &Sidecar{
+		logger: logger.With(zap.String("model", config.Model)),
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	conn, err := s.launch()
+	if err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.supervise(conn)
+
+	return s, nil
+}
+
+// Invoke runs the model on a JSON-encoded input
+func (s *Sidecar) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	return s.call(ctx, MethodInvoke, input)
+}
+
+// Reload asks the sidecar to load the model from path
+func (s *Sidecar) Reload(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.StartTimeout)
+	defer cancel()
+	input, err := json.Marshal(map[string]string{"path": path})
+	if err != nil {
+		return err
+	}
+	_, err = s.call(ctx, MethodReload, input)
+	return err
+}
+
+// Stats returns the connection state and restart count
+func (s *Sidecar) Stats() map[string]interface{} {
+	s.mutex.Lock()
+	connected := s.conn != nil
+	s.mutex.Unlock()
+
+	return map[string]interface{}{
+		"connected": connected,
+		"restarts":  s.restarts.Load(),
+	}
+}
+
+// Close stops supervision and terminates the sidecar
+func (s *Sidecar) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	conn := s.conn
+	s.mutex.Unlock()
+
+	close(s.done)
+	if conn != nil {
+		conn.fail(ErrUnavailable)
+	}
+	s.stopProcess()
+	s.wg.Wait()
+	return nil
+}
+
+// call sends a request on the current connection and waits for the response
+func (s *Sidecar) call(ctx context.Context, method string, input []byte) (map[string]interface{}, error) {
+	s.mutex.Lock()
+	conn := s.conn
+	s.mutex.Unlock()
+
+	if conn == nil {
+		return nil, ErrUnavailable
+	}
+	return s.send(ctx, conn, method, input)
+}
+
+// send sends a request on conn and waits for the response until ctx is
+// done. Callers bound ctx by the timeout of the method.
+func (s *Sidecar) send(ctx context.Context, conn *connection, method string, input []byte) (map[string]interface{}, error) {
+	request := Request{
+		ID:     s.nextID.Add(1),
+		Method: method,
+		Model:  s.config.Model,
+		Input:  input,
+	}
+
+	// Encode terminates the line with a newline
+	line := linePool.Get().(*bytes.Buffer)
+	defer putLine(line)
+	if err := json.NewEncoder(line).Encode(request); err != nil {
+		return nil, fmt.Errorf("failed to encode sidecar request: %w", err)
+	}
+
+	responses := make(chan Response, 1)
+	if err := conn.register(request.ID, responses); err != nil {
+		return nil, err
+	}
+	defer conn.unregister(request.ID)
+
+	conn.writeMutex.Lock()
+	_, err := conn.writer.Write(line.Bytes())
+	conn.writeMutex.Unlock()
+	if err != nil {
+		conn.fail(err)
+		return nil, fmt.Errorf("failed to write sidecar request: %w", err)
+	}
+
+	select {
+	case response := <-responses:
+		if response.Error != "" {
+			return nil, fmt.Errorf("sidecar %s failed: %s", method, response.Error)
+		}
+		return response.Output, nil
+	case <-conn.broken:
+		return nil, fmt.Errorf("sidecar connection lost: %w", conn.err)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("sidecar %s timed out: %w", method, ctx.Err())
+	}
+}
+
+// linePool holds the buffers requests are encoded into
+var linePool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// putLine returns a request buffer to the pool unless it grew unusually large
+func putLine(line *bytes.Buffer) {
+	if line.Cap() > 64*1024 {
+		return
+	}
+	line.Reset()
+	linePool.Put(line)
+}
+
+// supervise health-checks the sidecar and restarts it when it fails
+func (s *Sidecar) supervise(conn *connection) {
+	defer s.wg.Done()
+
+	backoff := 100 * time.Millisecond
+	for {
+		healthy := s.monitor(conn)
+
+		s.mutex.Lock()
+		s.conn = nil
+		s.mutex.Unlock()
+		s.stopProcess()
+
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		// Reset the backoff once a sidecar ran healthy for a while
+		if healthy {
+			backoff = 100 * time.Millisecond
+		}
+
+		for {
+			s.logger.Warn("Restarting model sidecar", zap.Duration("backoff", backoff))
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > s.config.MaxRestartBackoff {
+				backoff = s.config.MaxRestartBackoff
+			}
+
+			var err error
+			conn, err = s.launch()
+			if err == nil {
+				s.restarts.Add(1)
+				break
+			}
+			s.logger.Warn("Failed to restart model sidecar", zap.Error(err))
+		}
+	}
+}
+
+// monitor runs health checks until the connection breaks or the sidecar
+// fails three checks in a row. It reports whether any check succeeded.
+func (s *Sidecar) monitor(conn *connection) bool {
+	ticker := time.NewTicker(s.config.HealthInterval)
+	defer ticker.Stop()
+
+	healthy := false
+	failures := 0
+	for {
+		select {
+		case <-s.done:
+			return healthy
+		case <-conn.broken:
+			s.logger.Warn("Model sidecar connection lost", zap.Error(conn.err))
+			return healthy
+		case <-ticker.C:
+			if err := s.checkHealth(conn); err != nil {
+				failures++
+				s.logger.Warn("Model sidecar health check failed", zap.Int("failures", failures), zap.Error(err))
+				if failures >= 3 {
+					conn.fail(errors.New("health checks failed"))
+					return healthy
+				}
+				continue
+			}
+			failures = 0
+			healthy = true
+		}
+	}
+}
+
+// checkHealth sends a health check on conn, bounded by the request timeout
+func (s *Sidecar) checkHealth(conn *connection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	_, err := s.send(ctx, conn, MethodHealth, nil)
+	return err
+}
+
+// launch starts the sidecar process if configured, connects to it and waits
+// until it answers a health check
+func (s *Sidecar) launch() (*connection, error) {
+	var reader io.ReadCloser
+	var writer io.WriteCloser
+
+	if len(s.config.Command) > 0 {
+		cmd := exec.Command(s.config.Command[0], s.config.Command[1:]...)
+		cmd.Env = append(os.Environ(), s.config.Env...)
+
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			return nil, err
+		}
+		if s.config.Socket == "" {
+			if writer, err = cmd.StdinPipe(); err != nil {
+				return nil, err
+			}
+			if reader, err = cmd.StdoutPipe(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start sidecar: %w", err)
+		}
+		go s.logStderr(stderr)
+
+		s.mutex.Lock()
+		s.process = cmd
+		s.mutex.Unlock()
+	}
+
+	deadline := time.Now().Add(s.config.StartTimeout)
+
+	if s.config.Socket != "" {
+		socket, err := s.dial(deadline)
+		if err != nil {
+			s.stopProcess()
+			return nil, err
+		}
+		reader, writer = socket, socket
+	}
+
+	conn := &connection{
+		writer:  writer,
+		pending: make(map[uint64]chan Response),
+		broken:  make(chan struct{}),
+	}
+	go conn.read(reader)
+
+	// The first health check waits for the sidecar to load its model, so it
+	// is bounded by the start timeout instead of the request timeout
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if _, err := s.send(ctx, conn, MethodHealth, nil); err != nil {
+		conn.fail(err)
+		s.stopProcess()
+		return nil, fmt.Errorf("sidecar did not become healthy: %w", err)
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		conn.fail(ErrUnavailable)
+		s.stopProcess()
+		return nil, ErrUnavailable
+	}
+	s.conn = conn
+	s.mutex.Unlock()
+
+	s.logger.Info("Model sidecar started")
+	return conn, nil
+}
+
+// dial connects to the sidecar socket, retrying until deadline since a
+// freshly started sidecar needs time to listen
+func (s *Sidecar) dial(deadline time.Time) (net.Conn, error) {
+	for {
+		socket, err := net.DialTimeout("unix", s.config.Socket, time.Until(deadline))
+		if err == nil {
+			return socket, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to connect to sidecar socket %s: %w", s.config.Socket, err)
+		}
+
+		select {
+		case <-s.done:
+			return nil, ErrUnavailable
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// stopProcess kills the sidecar process if one is running
+func (s *Sidecar) stopProcess() {
+	s.mutex.Lock()
+	cmd := s.process
+	s.process = nil
+	s.mutex.Unlock()
+
+	if cmd == nil {
+		return
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+}
+
+// logStderr logs each line the sidecar writes to stderr
+func (s *Sidecar) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		s.logger.Info("Model sidecar output", zap.String("line", scanner.Text()))
+	}
+}
+
+// read dispatches responses to their callers until the connection breaks
+func (c *connection) read(reader io.ReadCloser) {
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var response Response
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			c.fail(fmt.Errorf("invalid sidecar response: %w", err))
+			return
+		}
+
+		c.mutex.Lock()
+		responses := c.pending[response.ID]
+		c.mutex.Unlock()
+		// Responses to requests that timed out, or duplicates, are dropped
+		select {
+		case responses <- response:
+		default:
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	c.fail(err)
+}
+
+// register adds a pending request
+func (c *connection) register(id uint64, responses chan Response) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.pending == nil {
+		return fmt.Errorf("sidecar connection lost: %w", c.err)
+	}
+	c.pending[id] = responses
+	return nil
+}
+
+// unregister removes a pending request
+func (c *connection) unregister(id uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.pending, id)
+}
+
+// fail marks the connection broken, waking all pending requests
+func (c *connection) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.pending == nil {
+		return
+	}
+	c.err = err
+	c.pending = nil
+	close(c.broken)
+	c.writer.Close()
+}
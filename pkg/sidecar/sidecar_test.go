@@ -0,0 +1,156 @@
+package sidecar
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// TestMain lets the test binary act as a sidecar when SIDECAR_HELPER is set
+func TestMain(m *testing.M) {
+	if os.Getenv("SIDECAR_HELPER") == "1" {
+		runHelper()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runHelper echoes invoke inputs and exits on {"crash": true}. With
+// SIDECAR_HELPER_DELAY set, it takes that long to start and to reload.
+func runHelper() {
+	delay, _ := time.ParseDuration(os.Getenv("SIDECAR_HELPER_DELAY"))
+	time.Sleep(delay)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	path := os.Getenv("AI_MODEL_PATH")
+
+	for scanner.Scan() {
+		var request Request
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			os.Exit(2)
+		}
+
+		var input map[string]interface{}
+		json.Unmarshal(request.Input, &input)
+
+		response := Response{ID: request.ID}
+		switch request.Method {
+		case MethodHealth:
+			response.Output = map[string]interface{}{"ok": true}
+		case MethodReload:
+			time.Sleep(delay)
+			path, _ = input["path"].(string)
+			response.Output = map[string]interface{}{}
+		case MethodInvoke:
+			if input["crash"] == true {
+				os.Exit(1)
+			}
+			if input["fail"] == true {
+				response.Error = "bad input"
+				break
+			}
+			response.Output = map[string]interface{}{"model": request.Model, "path": path, "input": input}
+		}
+		encoder.Encode(response)
+	}
+}
+
+func startHelper(t *testing.T) *Sidecar {
+	return startHelperWith(t, Config{
+		Timeout:        5 * time.Second,
+		HealthInterval: 50 * time.Millisecond,
+	})
+}
+
+// startHelperWith starts the helper with the timeouts and environment of
+// config
+func startHelperWith(t *testing.T, config Config) *Sidecar {
+	config.Model = "error_classifier"
+	config.Command = []string{os.Args[0]}
+	config.Env = append([]string{"SIDECAR_HELPER=1", "AI_MODEL_PATH=/models/v1"}, config.Env...)
+	config.StartTimeout = 5 * time.Second
+	config.MaxRestartBackoff = 100 * time.Millisecond
+	s, err := Start(zap.NewNop(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSidecarInvokeAndReload(t *testing.T) {
+	s := startHelper(t)
+	ctx := context.Background()
+
+	output, err := s.Invoke(ctx, []byte(`{"name":"GET /"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "error_classifier", output["model"])
+	assert.Equal(t, "/models/v1", output["path"])
+	assert.Equal(t, map[string]interface{}{"name": "GET /"}, output["input"])
+
+	_, err = s.Invoke(ctx, []byte(`{"fail":true}`))
+	assert.ErrorContains(t, err, "bad input")
+
+	require.NoError(t, s.Reload("/models/v2"))
+	output, err = s.Invoke(ctx, []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, "/models/v2", output["path"])
+}
+
+func TestSidecarStartAndReloadOutlastTheRequestTimeout(t *testing.T) {
+	// Loading the model takes far longer than an invocation may
+	s := startHelperWith(t, Config{
+		Env:            []string{"SIDECAR_HELPER_DELAY=300ms"},
+		Timeout:        time.Second / 20,
+		HealthInterval: time.Minute,
+	})
+
+	require.NoError(t, s.Reload("/models/v2"))
+	output, err := s.Invoke(context.Background(), []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, "/models/v2", output["path"])
+}
+
+func TestSidecarConcurrentRequests(t *testing.T) {
+	s := startHelper(t)
+
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		go func(i int) {
+			output, err := s.Invoke(context.Background(), []byte(fmt.Sprintf(`{"i":%d}`, i)))
+			if err == nil && output["input"].(map[string]interface{})["i"] != float64(i) {
+				err = fmt.Errorf("response %v mismatched for request %d", output, i)
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func TestSidecarRestartsAfterCrash(t *testing.T) {
+	s := startHelper(t)
+	ctx := context.Background()
+
+	_, err := s.Invoke(ctx, []byte(`{"crash":true}`))
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := s.Invoke(ctx, []byte(`{}`))
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, int64(1), s.Stats()["restarts"])
+}
+
+func TestStartRequiresCommandOrSocket(t *testing.T) {
+	_, err := Start(zap.NewNop(), Config{Model: "sampler"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+// Package spanname reduces the cardinality of span names and HTTP routes.
+// The identifiers embedded in them, such as numbers, UUIDs and hashes, are
+// replaced by a placeholder, so the spans of the same operation share a
+// name:
+//
+//	GET /users/42/orders/7f9c2ba4-e88f-11ee-9b3a-0242ac120002
+//	GET /users/{id}/orders/{id}
+package spanname
+
+import (
+	"strings"
+)
+
+// Placeholder replaces the identifiers of names
+const Placeholder = "{id}"
+
+// separators delimit the segments of names that are checked separately
+const separators = "/ ,;:=&"
+
+// Normalize returns name with its identifiers replaced by Placeholder and
+// the query string of paths removed. Names without identifiers are
+// returned unchanged.
+func Normalize(name string) string {
+	if i := strings.IndexByte(name, '?'); i > 0 && strings.Contains(name[:i], "/") {
+		name = name[:i]
+	}
+
+	var normalized strings.Builder
+	changed := false
+	start := 0
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && strings.IndexByte(separators, name[i]) < 0 {
+			continue
+		}
+		if segment := name[start:i]; isIdentifier(segment) {
+			if !changed {
+				normalized.Grow(len(name))
+				normalized.WriteString(name[:start])
+				changed = true
+			}
+			normalized.WriteString(Placeholder)
+		} else if changed {
+			normalized.WriteString(segment)
+		}
+		if changed && i < len(name) {
+			normalized.WriteByte(name[i])
+		}
+		start = i + 1
+	}
+	if !changed {
+		return name
+	}
+	return normalized.String()
+}
+
+// isIdentifier reports whether a segment of a name is an identifier: a
+// number, date or address, a UUID, a hexadecimal hash of 12 characters or
+// more, or a token of 16 characters or more mixing letters and digits
+func isIdentifier(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	return isNumeric(segment) || isUUID(segment) || isHexHash(segment) || isToken(segment)
+}
+
+// isNumeric reports whether s holds digits and only dots, dashes and
+// underscores besides them, such as 42, 10.0.0.1 or 2024-03-01
+func isNumeric(s string) bool {
+	digits := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case isDigit(c):
+			digits = true
+		case c == '.' || c == '-' || c == '_':
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
+// isUUID reports whether s is a UUID in its canonical 8-4-4-4-12 form
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHexHash reports whether s is a hexadecimal string of 12 characters or
+// more with a digit, such as a commit hash or an object ID
+func isHexHash(s string) bool {
+	if len(s) < 12 {
+		return false
+	}
+	digits := false
+	for i := 0; i < len(s); i++ {
+		if !isHex(s[i]) {
+			return false
+		}
+		digits = digits || isDigit(s[i])
+	}
+	return digits
+}
+
+// isToken reports whether s is a token of 16 characters or more mixing
+// letters and digits, such as a ULID or a session ID
+func isToken(s string) bool {
+	if len(s) < 16 {
+		return false
+	}
+	digits, letters := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case isDigit(c):
+			digits = true
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			letters = true
+		case c == '-' || c == '_':
+		default:
+			return false
+		}
+	}
+	return digits && letters
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
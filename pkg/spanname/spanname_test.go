@@ -0,0 +1,27 @@
+package spanname
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	for name, expected := range map[string]string{
+		"GET /users/42": "GET /users/{id}",
+		"GET /users/42/orders/7f9c2ba4-e88f-11ee-9b3a-0242ac120002": "GET /users/{id}/orders/{id}",
+		"/api/v2/commits/9fceb02d0ae598e95dc970b74767f19372d61af8":  "/api/v2/commits/{id}",
+		"/sessions/01HQ3ZK8W6Y7J2M4N5P9R0S1T2":                      "/sessions/{id}",
+		"/search?q=shoes&page=2":                                    "/search",
+		"connect 10.0.0.1:5432":                                     "connect {id}:{id}",
+		"report for 2024-03-01":                                     "report for {id}",
+		"user.id=1234":                                              "user.id={id}",
+		"HTTP GET":                                                  "HTTP GET",
+		"/api/v1/oauth2/token":                                      "/api/v1/oauth2/token",
+		"/users/{id}":                                               "/users/{id}",
+		"checkout-service/PlaceOrder":                               "checkout-service/PlaceOrder",
+		"":                                                          "",
+	} {
+		assert.Equal(t, expected, Normalize(name), name)
+	}
+}
@@ -0,0 +1,378 @@
+// Package triton serves models from a Triton Inference Server (or any server
+// implementing the KServe v2 inference protocol, such as an ONNX Runtime GPU
+// server) over HTTP.
+//
+// Telemetry items are encoded as JSON strings in a BYTES input tensor of
+// shape [batch, 1], and the model returns one JSON string per item in a BYTES
+// output tensor. Concurrent invocations are collected into batches so the
+// GPU processes many items per request.
+package triton
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by invocations after Close
+var ErrClosed = errors.New("triton client is closed")
+
+// Config defines the inference endpoint and batching
+type Config struct {
+	// Endpoint is the base URL of the server, e.g. http://localhost:8000
+	Endpoint string
+
+	// Model and Version identify the model on the server. An empty version
+	// uses the server's version policy.
+	Model   string
+	Version string
+
+	// InputName and OutputName are the tensor names, INPUT and OUTPUT by default
+	InputName  string
+	OutputName string
+
+	// Headers are added to every request
+	Headers map[string]string
+
+	// MaxBatchSize is the largest number of items sent in one request
+	MaxBatchSize int
+
+	// MaxBatchDelay is how long the first item of a batch waits for more items
+	MaxBatchDelay time.Duration
+
+	// MaxConcurrentBatches bounds the number of requests in flight
+	MaxConcurrentBatches int
+
+	// Timeout bounds each inference request
+	Timeout time.Duration
+}
+
+// Client batches invocations and sends them to the inference server
+type Client struct {
+	config Config
+	client *http.Client
+
+	queue  chan *call
+	slots  chan struct{}
+	done   chan struct{}
+	closed sync.Once
+	wg     sync.WaitGroup
+}
+
+// call is one item waiting for its inference result
+type call struct {
+	ctx    context.Context
+	input  []byte
+	result chan result
+}
+
+type result struct {
+	output map[string]interface{}
+	err    error
+}
+
+// tensor is a KServe v2 tensor in JSON form
+type tensor struct {
+	Name     string   `json:"name"`
+	Shape    []int    `json:"shape,omitempty"`
+	Datatype string   `json:"datatype,omitempty"`
+	Data     []string `json:"data,omitempty"`
+}
+
+type inferRequest struct {
+	Inputs  []tensor `json:"inputs"`
+	Outputs []tensor `json:"outputs"`
+}
+
+type inferResponse struct {
+	Outputs []tensor `json:"outputs"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// NewClient creates a client and starts batching
+func NewClient(config Config) (*Client, error) {
+	if config.Endpoint == "" || config.Model == "" {
+		return nil, errors.New("triton endpoint and model are required")
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	if config.InputName == "" {
+		config.InputName = "INPUT"
+	}
+	if config.OutputName == "" {
+		config.OutputName = "OUTPUT"
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = 64
+	}
+	if config.MaxBatchDelay <= 0 {
+		config.MaxBatchDelay = 2 * time.Millisecond
+	}
+	if config.MaxConcurrentBatches <= 0 {
+		config.MaxConcurrentBatches = 4
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+
+	c := &Client{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queue:  make(chan *call, config.MaxBatchSize*config.MaxConcurrentBatches),
+		slots:  make(chan struct{}, config.MaxConcurrentBatches),
+		done:   make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.batch()
+
+	return c, nil
+}
+
+// Ready reports whether the model is loaded and ready on the server
+func (c *Client) Ready(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, c.modelURL()+"/ready", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Invoke runs the model on a JSON-encoded input. Concurrent invocations
+// share requests.
+func (c *Client) Invoke(ctx context.Context, input []byte) (map[string]interface{}, error) {
+	select {
+	case <-c.done:
+		return nil, ErrClosed
+	default:
+	}
+
+	// The input is batched after Invoke may have returned, and the runtime
+	// reuses its buffer
+	input = append([]byte(nil), input...)
+
+	pending := &call{ctx: ctx, input: input, result: make(chan result, 1)}
+	select {
+	case c.queue <- pending:
+	case <-c.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case r := <-pending.result:
+		return r.output, r.err
+	case <-c.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Reload asks the server to load the model again. Models on the server are
+// managed through its model repository, so path is not used.
+func (c *Client) Reload(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodPost, c.config.Endpoint+"/v2/repository/models/"+c.config.Model+"/load", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Close stops batching and fails queued invocations
+func (c *Client) Close() error {
+	c.closed.Do(func() {
+		close(c.done)
+		c.wg.Wait()
+	})
+	return nil
+}
+
+// batch collects queued calls into batches of up to MaxBatchSize items,
+// waiting at most MaxBatchDelay after the first item
+func (c *Client) batch() {
+	defer c.wg.Done()
+
+	for {
+		var first *call
+		select {
+		case first = <-c.queue:
+		case <-c.done:
+			c.drain()
+			return
+		}
+
+		calls := []*call{first}
+		timer := time.NewTimer(c.config.MaxBatchDelay)
+	collect:
+		for len(calls) < c.config.MaxBatchSize {
+			select {
+			case next := <-c.queue:
+				calls = append(calls, next)
+			case <-timer.C:
+				break collect
+			case <-c.done:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		// Wait for a free slot so at most MaxConcurrentBatches requests are in flight
+		select {
+		case c.slots <- struct{}{}:
+		case <-c.done:
+			fail(calls, ErrClosed)
+			c.drain()
+			return
+		}
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer func() { <-c.slots }()
+			c.infer(calls)
+		}()
+	}
+}
+
+// drain fails calls still queued after Close
+func (c *Client) drain() {
+	for {
+		select {
+		case pending := <-c.queue:
+			pending.result <- result{err: ErrClosed}
+		default:
+			return
+		}
+	}
+}
+
+// infer sends one batch and delivers the results
+func (c *Client) infer(calls []*call) {
+	// Skip items whose callers gave up while the batch was collected
+	live := calls[:0]
+	for _, pending := range calls {
+		if pending.ctx.Err() == nil {
+			live = append(live, pending)
+		}
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	data := make([]string, len(live))
+	for i, pending := range live {
+		data[i] = string(pending.input)
+	}
+
+	request := inferRequest{
+		Inputs: []tensor{{
+			Name:     c.config.InputName,
+			Shape:    []int{len(data), 1},
+			Datatype: "BYTES",
+			Data:     data,
+		}},
+		Outputs: []tensor{{Name: c.config.OutputName}},
+	}
+
+	outputs, err := c.send(request)
+	if err != nil {
+		fail(live, err)
+		return
+	}
+	if len(outputs) != len(live) {
+		fail(live, fmt.Errorf("triton returned %d outputs for %d inputs", len(outputs), len(live)))
+		return
+	}
+
+	for i, pending := range live {
+		var output map[string]interface{}
+		if err := json.Unmarshal([]byte(outputs[i]), &output); err != nil {
+			pending.result <- result{err: fmt.Errorf("failed to decode model output: %w", err)}
+			continue
+		}
+		pending.result <- result{output: output}
+	}
+}
+
+// send posts an inference request and returns the output tensor data
+func (c *Client) send(request inferRequest) ([]string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodPost, c.modelURL()+"/infer", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response inferResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode triton response: %w", err)
+	}
+
+	for _, output := range response.Outputs {
+		if output.Name == c.config.OutputName {
+			return output.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("triton response has no %s output", c.config.OutputName)
+}
+
+// do sends a request and returns the response if its status is 2xx
+func (c *Client) do(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("triton request failed: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("triton returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// modelURL returns the base URL of the configured model version
+func (c *Client) modelURL() string {
+	url := c.config.Endpoint + "/v2/models/" + c.config.Model
+	if c.config.Version != "" {
+		url += "/versions/" + c.config.Version
+	}
+	return url
+}
+
+// fail delivers err to every call
+func fail(calls []*call, err error) {
+	for _, pending := range calls {
+		pending.result <- result{err: err}
+	}
+}
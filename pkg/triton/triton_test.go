@@ -0,0 +1,98 @@
+package triton
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer returns a server whose model echoes each input under "input"
+func newServer(t *testing.T, requests *atomic.Int64, maxBatch *atomic.Int64) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/models/entity_extractor/ready", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/v2/models/entity_extractor/infer", func(w http.ResponseWriter, r *http.Request) {
+		var request inferRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests.Add(1)
+
+		input := request.Inputs[0]
+		assert.Equal(t, "BYTES", input.Datatype)
+		assert.Equal(t, []int{len(input.Data), 1}, input.Shape)
+		if n := int64(len(input.Data)); n > maxBatch.Load() {
+			maxBatch.Store(n)
+		}
+
+		data := make([]string, len(input.Data))
+		for i, item := range input.Data {
+			data[i] = `{"input":` + item + `}`
+		}
+		json.NewEncoder(w).Encode(inferResponse{Outputs: []tensor{{Name: "OUTPUT", Datatype: "BYTES", Shape: []int{len(data), 1}, Data: data}}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientBatchesConcurrentInvocations(t *testing.T) {
+	var requests, maxBatch atomic.Int64
+	server := newServer(t, &requests, &maxBatch)
+
+	client, err := NewClient(Config{
+		Endpoint:      server.URL,
+		Model:         "entity_extractor",
+		MaxBatchSize:  16,
+		MaxBatchDelay: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Ready(context.Background()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			output, err := client.Invoke(context.Background(), []byte(fmt.Sprintf(`{"i":%d}`, i)))
+			if assert.NoError(t, err) {
+				assert.Equal(t, map[string]interface{}{"i": float64(i)}, output["input"])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Less(t, requests.Load(), int64(32))
+	assert.LessOrEqual(t, maxBatch.Load(), int64(16))
+}
+
+func TestClientReportsServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Config{Endpoint: server.URL, Model: "sampler"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Invoke(context.Background(), []byte(`{}`))
+	assert.ErrorContains(t, err, "model not found")
+	assert.Error(t, client.Ready(context.Background()))
+}
+
+func TestClientClose(t *testing.T) {
+	client, err := NewClient(Config{Endpoint: "http://127.0.0.1:0", Model: "sampler"})
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	_, err = client.Invoke(context.Background(), []byte(`{}`))
+	assert.ErrorIs(t, err, ErrClosed)
+}
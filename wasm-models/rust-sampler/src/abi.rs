@@ -0,0 +1,50 @@
+//! The host side of the `rust` ABI of the processor.
+//!
+//! The processor writes the UTF-8 JSON input into memory returned by `alloc`
+//! and calls the model function with its pointer and length. The function
+//! returns a pointer to the output, prefixed by its length as a little-endian
+//! u32, which the processor frees with `dealloc` once it has read it. The
+//! processor also frees the input, so functions must not keep it.
+
+use serde::de::DeserializeOwned;
+use serde_json::Value;
+use std::alloc::{alloc as allocate, dealloc as deallocate, Layout};
+
+/// Allocates `size` bytes of guest memory for the processor.
+#[no_mangle]
+pub extern "C" fn alloc(size: usize) -> *mut u8 {
+    if size == 0 {
+        return std::ptr::NonNull::dangling().as_ptr();
+    }
+    unsafe { allocate(Layout::from_size_align_unchecked(size, 1)) }
+}
+
+/// Frees memory returned by `alloc` or by a model function.
+#[no_mangle]
+pub extern "C" fn dealloc(ptr: *mut u8, size: usize) {
+    if size == 0 {
+        return;
+    }
+    unsafe { deallocate(ptr, Layout::from_size_align_unchecked(size, 1)) }
+}
+
+/// Decodes the input at `ptr`, runs `model` on it and returns its output.
+///
+/// Invalid inputs panic, which traps with `panic = "abort"`, and the
+/// processor falls back to its heuristics for the item.
+pub fn call<T: DeserializeOwned>(ptr: *const u8, len: usize, model: fn(T) -> Value) -> *mut u8 {
+    let input = unsafe { std::slice::from_raw_parts(ptr, len) };
+    let input: T = serde_json::from_slice(input).expect("invalid model input");
+    respond(&serde_json::to_vec(&model(input)).expect("unencodable model output"))
+}
+
+/// Copies `output` into memory freed by the processor, after its length.
+fn respond(output: &[u8]) -> *mut u8 {
+    let ptr = alloc(output.len() + 4);
+    unsafe {
+        let buffer = std::slice::from_raw_parts_mut(ptr, output.len() + 4);
+        buffer[..4].copy_from_slice(&(output.len() as u32).to_le_bytes());
+        buffer[4..].copy_from_slice(output);
+    }
+    ptr
+}
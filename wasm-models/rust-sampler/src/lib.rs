@@ -0,0 +1,48 @@
+//! An importance sampler written in Rust, extending the processor's built-in
+//! sampling heuristic with slow operations.
+//!
+//! Build it and configure it with `abi: rust` as described in
+//! wasm-models/README.md.
+
+mod abi;
+
+use serde::Deserialize;
+use serde_json::{json, Value};
+
+/// The fields of the sampling input this model reads. Other fields, such as
+/// `attributes` and `resource`, are ignored, and fields the processor's
+/// projection drops take their defaults.
+#[derive(Deserialize, Default)]
+#[serde(default)]
+struct SampleInput {
+    name: String,
+    status: String,
+    /// Duration in milliseconds
+    duration: i64,
+    /// Error count of a whole trace, for trace-level sampling
+    errors: u64,
+}
+
+/// Rates an item, called by the processor as `sample_telemetry`.
+#[no_mangle]
+pub extern "C" fn sample_telemetry(ptr: *const u8, len: usize) -> *mut u8 {
+    abi::call(ptr, len, sample)
+}
+
+fn sample(input: SampleInput) -> Value {
+    let (importance, reason) = if input.status == "error" || input.errors > 0 {
+        (0.9, "error_status")
+    } else if input.name.starts_with("db.") || input.name.starts_with("sql") {
+        (0.8, "database_operation")
+    } else if input.duration > 1000 {
+        (0.7, "slow_duration")
+    } else {
+        (0.5, "default")
+    };
+
+    json!({
+        "importance": importance,
+        "keep": importance > 0.3,
+        "reason": reason,
+    })
+}